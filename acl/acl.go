@@ -0,0 +1,242 @@
+package acl
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/sqlstmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Wildcard matches every peer or table
+	Wildcard   = "*"
+	rolePrefix = "role:"
+)
+
+// Permission is the access level granted on a table
+type Permission string
+
+const (
+	None  Permission = ""
+	Read  Permission = "read"
+	Write Permission = "write"
+)
+
+func (p Permission) includes(other Permission) bool {
+	switch p {
+	case Write:
+		return true
+	case Read:
+		return other == Read || other == None
+	default:
+		return other == None
+	}
+}
+
+// Policy is the authorization matrix. Grants map a subject, which is a peer
+// ID, "role:<name>" or "*", to the permission on every table, where "*"
+// matches all tables. The highest matching permission wins.
+type Policy struct {
+	Roles  map[string][]string              `json:"roles"`
+	Grants map[string]map[string]Permission `json:"grants"`
+}
+
+// LoadPolicy reads a policy from a JSON file
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ACL policy: %w", err)
+	}
+	policy := &Policy{}
+	err = json.Unmarshal(data, policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ACL policy '%s': %w", path, err)
+	}
+	// tables are matched lower cased, like the tables of parsed statements
+	for subject, tables := range policy.Grants {
+		lowered := make(map[string]Permission, len(tables))
+		for table, perm := range tables {
+			if perm != Read && perm != Write {
+				return nil, fmt.Errorf("invalid permission '%s' for '%s' on '%s'", perm, subject, table)
+			}
+			table = strings.ToLower(table)
+			if perm.includes(lowered[table]) {
+				lowered[table] = perm
+			}
+		}
+		policy.Grants[subject] = lowered
+	}
+	return policy, nil
+}
+
+// AddRoles adds peers to roles, e.g. the roles from their certificates
+func (p *Policy) AddRoles(peerRoles map[string][]string) {
+	if p.Roles == nil {
+		p.Roles = map[string][]string{}
+	}
+	for peerID, roles := range peerRoles {
+		for _, role := range roles {
+			p.Roles[role] = append(p.Roles[role], peerID)
+		}
+	}
+}
+
+// HasRole returns true if the peer has the role
+func (p *Policy) HasRole(peerID string, role string) bool {
+	for _, member := range p.Roles[role] {
+		if member == peerID {
+			return true
+		}
+	}
+	return false
+}
+
+// subjects returns all the subjects that apply to a peer
+func (p *Policy) subjects(peerID string) []string {
+	subjects := []string{peerID, Wildcard}
+	for role, members := range p.Roles {
+		for _, member := range members {
+			if member == peerID {
+				subjects = append(subjects, rolePrefix+role)
+				break
+			}
+		}
+	}
+	return subjects
+}
+
+// Permission returns the permission of a peer on a table. Table names are
+// case insensitive.
+func (p *Policy) Permission(peerID string, table string) Permission {
+	table = strings.ToLower(table)
+	perm := None
+	for _, subject := range p.subjects(peerID) {
+		for _, t := range []string{table, Wildcard} {
+			granted := p.Grants[subject][t]
+			if granted.includes(perm) {
+				perm = granted
+			}
+		}
+	}
+	return perm
+}
+
+// Allowed returns true if the peer has the permission on all the tables
+func (p *Policy) Allowed(peerID string, tables []string, perm Permission) bool {
+	for _, table := range tables {
+		if !p.Permission(peerID, table).includes(perm) {
+			return false
+		}
+	}
+	return true
+}
+
+// AuditEntry is a line of the audit log
+type AuditEntry struct {
+	Time    time.Time `json:"time"`
+	Peer    string    `json:"peer"`
+	Action  string    `json:"action"`
+	Tables  []string  `json:"tables"`
+	Allowed bool      `json:"allowed"`
+	Detail  string    `json:"detail,omitempty"`
+}
+
+// Auditor appends authorization decisions to a JSON lines file
+type Auditor struct {
+	mtx  sync.Mutex
+	file *os.File
+}
+
+// NewAuditor opens the audit log for appending
+func NewAuditor(path string) (*Auditor, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Auditor{file: f}, nil
+}
+
+// Record writes an entry to the audit log
+func (a *Auditor) Record(entry AuditEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	_, err = a.file.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes the audit log
+func (a *Auditor) Close() error {
+	return a.file.Close()
+}
+
+// Enforcer checks the requests of peers against the policy and audits every
+// write and every denied request
+type Enforcer struct {
+	Policy  *Policy
+	Auditor *Auditor
+}
+
+// Authorize implements p2psrv.Authorizer. Every table the parsed statement
+// references is checked: the ones it writes need write access, the others
+// read access. Statements that can't be parsed need access to every table.
+func (e *Enforcer) Authorize(peerID string, query string, write bool) error {
+	reads, writes, err := sqlstmt.Access(query)
+	if err != nil {
+		reads, writes = []string{Wildcard}, []string{}
+		if write {
+			reads, writes = []string{}, []string{Wildcard}
+		}
+	}
+	if write && len(writes) == 0 {
+		// writes without a target table, like procedure calls, can change
+		// any table
+		writes = []string{Wildcard}
+	}
+	return e.AuthorizeTables(peerID, reads, writes)
+}
+
+// ReadableTables implements p2psrv.Authorizer
+func (e *Enforcer) ReadableTables(peerID string, tables []string) []string {
+	readable := []string{}
+	for _, table := range tables {
+		if e.Policy.Allowed(peerID, []string{table}, Read) {
+			readable = append(readable, table)
+		}
+	}
+	return readable
+}
+
+// AuthorizeTables checks that a peer can read and write the given tables
+func (e *Enforcer) AuthorizeTables(peerID string, reads []string, writes []string) error {
+	if len(writes) > 0 {
+		allowed := e.Policy.Allowed(peerID, writes, Write)
+		if e.Auditor != nil {
+			// audit failures must not block requests
+			_ = e.Auditor.Record(AuditEntry{Peer: peerID, Action: "write", Tables: writes, Allowed: allowed})
+		}
+		if !allowed {
+			return status.Errorf(codes.PermissionDenied, "peer '%s' can't write %s", peerID, strings.Join(writes, ", "))
+		}
+	}
+	allowed := e.Policy.Allowed(peerID, reads, Read)
+	if !allowed {
+		if e.Auditor != nil {
+			_ = e.Auditor.Record(AuditEntry{Peer: peerID, Action: "read", Tables: reads, Allowed: false})
+		}
+		return status.Errorf(codes.PermissionDenied, "peer '%s' can't read %s", peerID, strings.Join(reads, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package acl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPolicyPermission(t *testing.T) {
+	policy := &Policy{
+		Roles: map[string][]string{"writers": {"peerA"}},
+		Grants: map[string]map[string]Permission{
+			"*":            {"*": Read},
+			"role:writers": {"orders": Write},
+			"peerB":        {"*": Write, "audit": Read},
+		},
+	}
+
+	cases := []struct {
+		peer, table string
+		expected    Permission
+	}{
+		{"peerA", "orders", Write},
+		{"peerA", "users", Read},
+		{"peerB", "users", Write},
+		{"peerB", "audit", Write},
+		{"peerC", "orders", Read},
+	}
+	for _, c := range cases {
+		if perm := policy.Permission(c.peer, c.table); perm != c.expected {
+			t.Errorf("expected %s for %s on %s, got %s", c.expected, c.peer, c.table, perm)
+		}
+	}
+
+	if policy.Allowed("peerA", []string{"orders", "users"}, Write) {
+		t.Error("expected peerA to not be allowed to write users")
+	}
+	if !policy.Allowed("peerC", []string{"orders", "users"}, Read) {
+		t.Error("expected peerC to be allowed to read everything")
+	}
+	if !policy.HasRole("peerA", "writers") || policy.HasRole("peerB", "writers") {
+		t.Error("expected only peerA to have the writers role")
+	}
+}
+
+func TestEnforcerAuthorize(t *testing.T) {
+	enforcer := &Enforcer{Policy: &Policy{
+		Grants: map[string]map[string]Permission{
+			"peerA": {"orders": Write, "users": Read},
+		},
+	}}
+	cases := []struct {
+		query   string
+		write   bool
+		allowed bool
+	}{
+		{"SELECT * FROM orders JOIN users ON orders.user = users.id", false, true},
+		{"SELECT * FROM secrets", false, false},
+		{"SELECT * FROM dolt_diff('HEAD~', 'HEAD', 'secrets')", false, false},
+		{"INSERT INTO orders SELECT * FROM users", true, true},
+		{"INSERT INTO orders SELECT * FROM secrets", true, false},
+		{"UPDATE orders JOIN users ON orders.user = users.id SET users.name = 'x'", true, false},
+		{"CREATE TEMPORARY TABLE tmp SELECT * FROM secrets", true, false},
+		{"CALL DOLT_RESET('--hard')", true, false},
+		{"SELEC * FROM orders", false, false},
+	}
+	for _, c := range cases {
+		err := enforcer.Authorize("peerA", c.query, c.write)
+		if (err == nil) != c.allowed {
+			t.Errorf("expected '%s' allowed=%t, got %v", c.query, c.allowed, err)
+		}
+	}
+}
+
+func TestEnforcerReadableTables(t *testing.T) {
+	enforcer := &Enforcer{Policy: &Policy{
+		Grants: map[string]map[string]Permission{
+			"peerA": {"orders": Write, "users": Read},
+		},
+	}}
+	readable := enforcer.ReadableTables("peerA", []string{"orders", "secrets", "users"})
+	if len(readable) != 2 || readable[0] != "orders" || readable[1] != "users" {
+		t.Errorf("expected orders and users to be readable, got %v", readable)
+	}
+}
+
+func TestLoadPolicyLowersTables(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acl.json")
+	err := os.WriteFile(path, []byte(`{"grants": {"peerA": {"Orders": "write"}}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enforcer := &Enforcer{Policy: policy}
+	if err := enforcer.Authorize("peerA", "INSERT INTO Orders VALUES (1)", true); err != nil {
+		t.Errorf("expected the write to match the rule of Orders, got %v", err)
+	}
+	if policy.Permission("peerA", "ORDERS") != Write {
+		t.Error("expected table names to be case insensitive")
+	}
+}
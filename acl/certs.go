@@ -0,0 +1,65 @@
+package acl
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// LoadCertificateRoles reads the PEM certificates in dir, verifies them
+// against the cluster CA certificate and returns the roles of every peer. The
+// peer ID is the common name of a certificate and its organizational units
+// are the roles, e.g. writer, reader, admin or relay.
+func LoadCertificateRoles(caPath string, dir string) (map[string][]string, error) {
+	caData, err := os.ReadFile(caPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caData) {
+		return nil, fmt.Errorf("no certificate found in '%s'", caPath)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	peerRoles := map[string][]string{}
+	for _, file := range files {
+		cert, err := readCertificate(file)
+		if err != nil {
+			return nil, err
+		}
+		_, err = cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+		if err != nil {
+			return nil, fmt.Errorf("certificate '%s' is not valid: %w", file, err)
+		}
+		_, err = peer.Decode(cert.Subject.CommonName)
+		if err != nil {
+			return nil, fmt.Errorf("certificate '%s' has an invalid peer ID: %w", file, err)
+		}
+		peerRoles[cert.Subject.CommonName] = append(peerRoles[cert.Subject.CommonName], cert.Subject.OrganizationalUnit...)
+	}
+	return peerRoles, nil
+}
+
+func readCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate found in '%s'", path)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate '%s': %w", path, err)
+	}
+	return cert, nil
+}
@@ -0,0 +1,99 @@
+package acl
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func newCertificate(t *testing.T, subject pkix.Name, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               subject,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func newPeerID(t *testing.T) string {
+	_, pub, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id.String()
+}
+
+func TestLoadCertificateRoles(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey, caPEM := newCertificate(t, pkix.Name{CommonName: "cluster CA"}, true, nil, nil)
+	caPath := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caPath, caPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	peerID := newPeerID(t)
+	_, _, peerPEM := newCertificate(t, pkix.Name{CommonName: peerID, OrganizationalUnit: []string{"writer", "relay"}}, false, ca, caKey)
+	if err := os.WriteFile(filepath.Join(dir, "peer.pem"), peerPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	peerRoles, err := LoadCertificateRoles(caPath, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roles := peerRoles[peerID]
+	sort.Strings(roles)
+	if len(roles) != 2 || roles[0] != "relay" || roles[1] != "writer" {
+		t.Errorf("expected the writer and relay roles, got %v", roles)
+	}
+
+	policy := &Policy{Grants: map[string]map[string]Permission{"role:writer": {"*": Write}}}
+	policy.AddRoles(peerRoles)
+	if policy.Permission(peerID, "orders") != Write {
+		t.Error("expected the certificate role to grant write access")
+	}
+
+	otherCA, otherKey, _ := newCertificate(t, pkix.Name{CommonName: "other CA"}, true, nil, nil)
+	_, _, roguePEM := newCertificate(t, pkix.Name{CommonName: newPeerID(t), OrganizationalUnit: []string{"admin"}}, false, otherCA, otherKey)
+	if err := os.WriteFile(filepath.Join(dir, "rogue.pem"), roguePEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCertificateRoles(caPath, dir); err == nil {
+		t.Error("expected certificates from another CA to be rejected")
+	}
+}
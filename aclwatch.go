@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nustiueudinastea/doltswarmdemo/acl"
+	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+)
+
+// checkCommitACL rejects the commits pulled from peers that change tables
+// their signer is not allowed to write, before they are applied. The signer is
+// the verified key of the commit, not its Peer-ID trailer, which anyone can
+// write.
+func checkCommitACL(enforcer *acl.Enforcer) p2p.CommitCheck {
+	return func(commit string, signer string) error {
+		if signer == p2pKey.GetID() {
+			return nil
+		}
+		_, tables, err := pulledCommit(commit)
+		if err != nil {
+			return err
+		}
+		if len(tables) == 0 || enforcer.Policy.Allowed(signer, tables, acl.Write) {
+			return nil
+		}
+
+		if enforcer.Auditor != nil {
+			err := enforcer.Auditor.Record(acl.AuditEntry{Peer: signer, Action: "sync", Tables: tables, Allowed: false, Detail: commit})
+			if err != nil {
+				log.Errorf("Failed to write audit log: %s", err.Error())
+			}
+		}
+		log.Warnf("Rejected commit '%s' from peer '%s': peer is not allowed to write %s", commit, signer, strings.Join(tables, ", "))
+		return fmt.Errorf("peer '%s' is not allowed to write %s", signer, strings.Join(tables, ", "))
+	}
+}
+
+// pulledCommit reads the message of a commit pulled from a peer, and the
+// tables it changes, before it's applied. The tables of a merge commit are the
+// ones changed by the merge itself, like conflict resolutions, since the
+// merged commits are checked on their own.
+func pulledCommit(commit string) (string, []string, error) {
+	if !validCommitHash.MatchString(commit) {
+		return "", nil, fmt.Errorf("invalid commit hash '%s'", commit)
+	}
+	var msg string
+	err := dbi.QueryRow(fmt.Sprintf("SELECT message FROM dolt_log('%s') LIMIT 1;", commit)).Scan(&msg)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read commit '%s': %w", commit, err)
+	}
+	history := sqlHistory{}
+	parents, err := history.Parents(commit)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read the parents of commit '%s': %w", commit, err)
+	}
+	if len(parents) == 0 {
+		return "", nil, fmt.Errorf("commit '%s' has no parent", commit)
+	}
+
+	var tables []string
+	for i, parent := range parents {
+		changed, err := history.ChangedTables(parent, commit)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to read the tables changed by commit '%s': %w", commit, err)
+		}
+		if i == 0 {
+			tables = changed
+			continue
+		}
+		both := []string{}
+		for _, table := range tables {
+			for _, other := range changed {
+				if table == other {
+					both = append(both, table)
+					break
+				}
+			}
+		}
+		tables = both
+	}
+	return msg, tables, nil
+}
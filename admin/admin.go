@@ -0,0 +1,495 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/approvals"
+	"github.com/nustiueudinastea/doltswarmdemo/branchpolicy"
+	"github.com/nustiueudinastea/doltswarmdemo/conflicts"
+	"github.com/nustiueudinastea/doltswarmdemo/lifecycle"
+	"github.com/nustiueudinastea/doltswarmdemo/membership"
+	"github.com/nustiueudinastea/doltswarmdemo/namedqueries"
+	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+	"github.com/nustiueudinastea/doltswarmdemo/p2p/middleware"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"github.com/nustiueudinastea/doltswarmdemo/plugins"
+	"github.com/nustiueudinastea/doltswarmdemo/quarantine"
+	"github.com/nustiueudinastea/doltswarmdemo/tsdb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ p2pproto.AdminServer = (*Server)(nil)
+
+// SyncProgressSource reports how far the node is behind its peers
+type SyncProgressSource interface {
+	SyncProgress() p2p.SyncProgress
+}
+
+// TopologySource reports the links of the node to its peers
+type TopologySource interface {
+	GetID() string
+	Links(ctx context.Context) []p2p.Link
+}
+
+// StandbyController reports the state of a standby and promotes it
+type StandbyController interface {
+	Standby() (p2p.StandbyStatus, bool)
+	Promote(reason string) error
+}
+
+// HealthSource reports the state of the subsystems of the node
+type HealthSource interface {
+	Health() []lifecycle.Health
+	Ready() bool
+}
+
+// DrainController marks the node draining before a restart, so that its
+// peers route around it
+type DrainController interface {
+	SetDraining(ctx context.Context, draining bool) p2p.DrainStatus
+	DrainStatus() p2p.DrainStatus
+}
+
+// Restarter stops the node and starts it again
+type Restarter interface {
+	Restart() error
+}
+
+// CommitTracer asks the node and its peers if and when they applied a commit
+type CommitTracer interface {
+	TraceCommit(ctx context.Context, hash string) []p2p.CommitTrace
+}
+
+// PluginDeployer loads plugins on the node and publishes them to its peers
+type PluginDeployer interface {
+	DeployPlugin(ctx context.Context, name string, wasm []byte) (plugins.Plugin, error)
+	RemovePlugin(ctx context.Context, name string) error
+	Plugins() []plugins.Plugin
+}
+
+// ProtoDumper records the messages exchanged with the peers for protocol
+// debugging
+type ProtoDumper interface {
+	SetEnabled(enabled bool) error
+	Status() middleware.DumpStatus
+	Entries(limit int) []middleware.DumpEntry
+}
+
+// CommitApprover signs approvals of the commits of approval branches with the
+// key of the node
+type CommitApprover interface {
+	Approve(ctx context.Context, branch string, commit string) (approvals.Pending, error)
+	Approvals(merged bool) []approvals.Pending
+	Policy(branch string) branchpolicy.Policy
+}
+
+// Server implements the Admin gRPC service used by operators and dashboards
+type Server struct {
+	Metrics *tsdb.Store
+	Sync    SyncProgressSource
+	// Quarantine holds the rejected writes and commits, which are applied or
+	// discarded by the Resolver
+	Quarantine *quarantine.Store
+	Resolver   quarantine.Resolver
+	Topology   TopologySource
+	Members    *membership.Registry
+	Conflicts  *conflicts.Resolver
+	Standby    StandbyController
+	Health     HealthSource
+	Drain      DrainController
+	// Restarter is optional. Restarts are refused if it's not set
+	Restarter Restarter
+	Tracer    CommitTracer
+	// Plugins is optional. Plugins can't be deployed if it's not set
+	Plugins PluginDeployer
+	// ProtoDump is optional. The dump can't be turned on if it's not set
+	ProtoDump ProtoDumper
+	// Approver is optional. Commits can't be approved if it's not set
+	Approver CommitApprover
+	// NamedQueries is optional. Named queries can't be managed if it's not
+	// set
+	NamedQueries *namedqueries.Registry
+}
+
+func (s *Server) QueryMetrics(ctx context.Context, req *p2pproto.QueryMetricsRequest) (*p2pproto.QueryMetricsResponse, error) {
+	names := req.Names
+	if len(names) == 0 {
+		names = s.Metrics.Names()
+	}
+
+	res := &p2pproto.QueryMetricsResponse{}
+	for _, name := range names {
+		series := &p2pproto.MetricSeries{Name: name}
+		for _, sample := range s.Metrics.Query(name, time.Unix(req.SinceUnix, 0)) {
+			series.Samples = append(series.Samples, &p2pproto.MetricSample{TimeUnixMs: sample.Time.UnixMilli(), Value: sample.Value})
+		}
+		res.Series = append(res.Series, series)
+	}
+	return res, nil
+}
+
+func (s *Server) GetSyncProgress(ctx context.Context, req *p2pproto.GetSyncProgressRequest) (*p2pproto.SyncProgress, error) {
+	return s.Sync.SyncProgress().Proto(), nil
+}
+
+func (s *Server) ListQuarantine(ctx context.Context, req *p2pproto.ListQuarantineRequest) (*p2pproto.ListQuarantineResponse, error) {
+	res := &p2pproto.ListQuarantineResponse{}
+	for _, entry := range s.Quarantine.List() {
+		res.Entries = append(res.Entries, entryToProto(entry))
+	}
+	return res, nil
+}
+
+func (s *Server) ApproveQuarantined(ctx context.Context, req *p2pproto.ResolveQuarantinedRequest) (*p2pproto.QuarantinedEntry, error) {
+	entry, err := s.Quarantine.Approve(req.Id, s.Resolver)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return entryToProto(entry), nil
+}
+
+func (s *Server) PurgeQuarantined(ctx context.Context, req *p2pproto.ResolveQuarantinedRequest) (*p2pproto.QuarantinedEntry, error) {
+	entry, err := s.Quarantine.Purge(req.Id, s.Resolver)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return entryToProto(entry), nil
+}
+
+func (s *Server) GetLinks(ctx context.Context, req *p2pproto.GetLinksRequest) (*p2pproto.GetLinksResponse, error) {
+	res := &p2pproto.GetLinksResponse{PeerId: s.Topology.GetID()}
+	for _, link := range s.Topology.Links(ctx) {
+		res.Links = append(res.Links, link.Proto())
+	}
+	return res, nil
+}
+
+func (s *Server) ListMembers(ctx context.Context, req *p2pproto.ListMembersRequest) (*p2pproto.ListMembersResponse, error) {
+	members, err := s.Members.Members()
+	if err != nil {
+		return nil, err
+	}
+	res := &p2pproto.ListMembersResponse{}
+	for _, member := range members {
+		res.Members = append(res.Members, memberToProto(member))
+	}
+	return res, nil
+}
+
+func (s *Server) AddMember(ctx context.Context, req *p2pproto.MemberRequest) (*p2pproto.Member, error) {
+	return s.applyMembership(membership.OpAdd, req.PeerId)
+}
+
+func (s *Server) RetireMember(ctx context.Context, req *p2pproto.MemberRequest) (*p2pproto.Member, error) {
+	return s.applyMembership(membership.OpRetire, req.PeerId)
+}
+
+func (s *Server) RemoveMember(ctx context.Context, req *p2pproto.MemberRequest) (*p2pproto.Member, error) {
+	return s.applyMembership(membership.OpRemove, req.PeerId)
+}
+
+func (s *Server) applyMembership(op membership.Op, peerID string) (*p2pproto.Member, error) {
+	member, err := s.Members.Apply(op, peerID)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return memberToProto(member), nil
+}
+
+func (s *Server) ListConflicts(ctx context.Context, req *p2pproto.ListConflictsRequest) (*p2pproto.ListConflictsResponse, error) {
+	tables, err := s.Conflicts.Tables()
+	if err != nil {
+		return nil, err
+	}
+	res := &p2pproto.ListConflictsResponse{}
+	for _, table := range tables {
+		res.Tables = append(res.Tables, &p2pproto.ConflictTable{Name: table.Name, Conflicts: int64(table.Conflicts)})
+	}
+	if req.Table == "" {
+		return res, nil
+	}
+
+	rows, err := s.Conflicts.Rows(req.Table)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	for _, row := range rows {
+		res.Rows = append(res.Rows, conflictToProto(row))
+	}
+	return res, nil
+}
+
+func (s *Server) ResolveConflict(ctx context.Context, req *p2pproto.ResolveConflictRequest) (*p2pproto.ResolveConflictResponse, error) {
+	resolution, err := conflicts.ParseResolution(req.Resolution)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	commit, err := s.Conflicts.Resolve(req.Table, req.Id, resolution)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &p2pproto.ResolveConflictResponse{Commit: commit}, nil
+}
+
+func (s *Server) GetStandby(ctx context.Context, req *p2pproto.GetStandbyRequest) (*p2pproto.StandbyStatus, error) {
+	standby, ok := s.Standby.Standby()
+	if !ok {
+		return nil, status.Error(codes.FailedPrecondition, "node is not a standby")
+	}
+	return standby.Proto(), nil
+}
+
+func (s *Server) Promote(ctx context.Context, req *p2pproto.PromoteRequest) (*p2pproto.StandbyStatus, error) {
+	reason := req.Reason
+	if reason == "" {
+		reason = "promoted by an operator"
+	}
+	err := s.Standby.Promote(reason)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	standby, _ := s.Standby.Standby()
+	return standby.Proto(), nil
+}
+
+func conflictToProto(row conflicts.Row) *p2pproto.ConflictRow {
+	res := &p2pproto.ConflictRow{
+		Id:            row.ID,
+		Table:         row.Table,
+		OurDiffType:   row.OurDiffType,
+		TheirDiffType: row.TheirDiffType,
+	}
+	value := func(v conflicts.Value) *p2pproto.ConflictValue {
+		return &p2pproto.ConflictValue{Value: v.Value, Null: v.Null}
+	}
+	for _, column := range row.Columns {
+		res.Columns = append(res.Columns, &p2pproto.ConflictColumn{
+			Name:   column,
+			Base:   value(row.Base[column]),
+			Ours:   value(row.Ours[column]),
+			Theirs: value(row.Theirs[column]),
+		})
+	}
+	return res
+}
+
+func memberToProto(member membership.Member) *p2pproto.Member {
+	return &p2pproto.Member{
+		PeerId:        member.PeerID,
+		State:         string(member.State),
+		UpdatedUnixMs: member.UpdatedAt.UnixMilli(),
+	}
+}
+
+func entryToProto(entry quarantine.Entry) *p2pproto.QuarantinedEntry {
+	return &p2pproto.QuarantinedEntry{
+		Id:         entry.ID,
+		TimeUnixMs: entry.Time.UnixMilli(),
+		Peer:       entry.Peer,
+		Reason:     entry.Reason,
+		Commit:     entry.Commit,
+		Statement:  entry.Statement,
+		Message:    entry.Message,
+		Tables:     entry.Tables,
+		Branch:     entry.Branch,
+		MergeInto:  entry.MergeInto,
+	}
+}
+
+func (s *Server) GetHealth(ctx context.Context, req *p2pproto.GetHealthRequest) (*p2pproto.Health, error) {
+	res := &p2pproto.Health{Ready: s.Health.Ready()}
+	for _, h := range s.Health.Health() {
+		res.Subsystems = append(res.Subsystems, &p2pproto.SubsystemHealth{
+			Name:        h.Name,
+			State:       string(h.State),
+			Required:    h.Required,
+			Attempts:    int32(h.Attempts),
+			Error:       h.Err,
+			SinceUnixMs: h.Since.UnixMilli(),
+		})
+	}
+	return res, nil
+}
+
+func (s *Server) SetDraining(ctx context.Context, req *p2pproto.SetDrainingRequest) (*p2pproto.DrainStatus, error) {
+	return s.Drain.SetDraining(ctx, req.Draining).Proto(), nil
+}
+
+func (s *Server) GetDrainStatus(ctx context.Context, req *p2pproto.GetDrainStatusRequest) (*p2pproto.DrainStatus, error) {
+	return s.Drain.DrainStatus().Proto(), nil
+}
+
+func (s *Server) Restart(ctx context.Context, req *p2pproto.RestartRequest) (*p2pproto.RestartResponse, error) {
+	if s.Restarter == nil {
+		return nil, status.Error(codes.Unimplemented, "node can't be restarted remotely")
+	}
+	err := s.Restarter.Restart()
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &p2pproto.RestartResponse{}, nil
+}
+
+func (s *Server) TraceCommit(ctx context.Context, req *p2pproto.TraceCommitRequest) (*p2pproto.TraceCommitResponse, error) {
+	if req.Commit == "" {
+		return nil, status.Error(codes.InvalidArgument, "commit is required")
+	}
+	res := &p2pproto.TraceCommitResponse{}
+	for _, trace := range s.Tracer.TraceCommit(ctx, req.Commit) {
+		res.Traces = append(res.Traces, trace.Proto())
+	}
+	return res, nil
+}
+
+func (s *Server) DeployPlugin(ctx context.Context, req *p2pproto.DeployPluginRequest) (*p2pproto.PluginInfo, error) {
+	if s.Plugins == nil {
+		return nil, status.Error(codes.Unimplemented, "plugins are disabled on the node")
+	}
+	if req.Name == "" || len(req.Wasm) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "name and wasm are required")
+	}
+	plugin, err := s.Plugins.DeployPlugin(ctx, req.Name, req.Wasm)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return plugin.Info(), nil
+}
+
+func (s *Server) RemovePlugin(ctx context.Context, req *p2pproto.RemovePluginRequest) (*p2pproto.RemovePluginResponse, error) {
+	if s.Plugins == nil {
+		return nil, status.Error(codes.Unimplemented, "plugins are disabled on the node")
+	}
+	if req.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	if err := s.Plugins.RemovePlugin(ctx, req.Name); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &p2pproto.RemovePluginResponse{}, nil
+}
+
+func (s *Server) ListPlugins(ctx context.Context, req *p2pproto.ListPluginsRequest) (*p2pproto.ListPluginsResponse, error) {
+	res := &p2pproto.ListPluginsResponse{}
+	if s.Plugins == nil {
+		return res, nil
+	}
+	for _, plugin := range s.Plugins.Plugins() {
+		res.Plugins = append(res.Plugins, plugin.Info())
+	}
+	return res, nil
+}
+
+func protoDumpStatus(status middleware.DumpStatus) *p2pproto.ProtoDumpStatus {
+	return &p2pproto.ProtoDumpStatus{
+		Enabled:  status.Enabled,
+		Recorded: status.Recorded,
+		Dropped:  status.Dropped,
+		File:     status.File,
+	}
+}
+
+func (s *Server) SetProtoDump(ctx context.Context, req *p2pproto.SetProtoDumpRequest) (*p2pproto.ProtoDumpStatus, error) {
+	if s.ProtoDump == nil {
+		return nil, status.Error(codes.Unimplemented, "protocol dump is not available on the node")
+	}
+	if err := s.ProtoDump.SetEnabled(req.Enabled); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return protoDumpStatus(s.ProtoDump.Status()), nil
+}
+
+func (s *Server) GetProtoDump(ctx context.Context, req *p2pproto.GetProtoDumpRequest) (*p2pproto.GetProtoDumpResponse, error) {
+	if s.ProtoDump == nil {
+		return nil, status.Error(codes.Unimplemented, "protocol dump is not available on the node")
+	}
+	res := &p2pproto.GetProtoDumpResponse{Status: protoDumpStatus(s.ProtoDump.Status())}
+	for _, entry := range s.ProtoDump.Entries(int(req.Limit)) {
+		res.Entries = append(res.Entries, &p2pproto.ProtoDumpEntry{
+			TimeUnixMs: entry.Time.UnixMilli(),
+			Peer:       entry.Peer,
+			Method:     entry.Method,
+			Direction:  entry.Direction,
+			Kind:       entry.Kind,
+			Message:    entry.Message,
+			Size:       int32(entry.Size),
+			Truncated:  entry.Truncated,
+		})
+	}
+	return res, nil
+}
+
+func (s *Server) ApproveCommit(ctx context.Context, req *p2pproto.ApproveCommitRequest) (*p2pproto.PendingApproval, error) {
+	if s.Approver == nil {
+		return nil, status.Error(codes.Unimplemented, "the node has no approval branches")
+	}
+	pending, err := s.Approver.Approve(ctx, req.Branch, req.Commit)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return pending.Proto(s.Approver.Policy(pending.Branch)), nil
+}
+
+func (s *Server) ListApprovals(ctx context.Context, req *p2pproto.ListApprovalsRequest) (*p2pproto.ListApprovalsResponse, error) {
+	res := &p2pproto.ListApprovalsResponse{}
+	if s.Approver == nil {
+		return res, nil
+	}
+	for _, pending := range s.Approver.Approvals(req.Merged) {
+		res.Approvals = append(res.Approvals, pending.Proto(s.Approver.Policy(pending.Branch)))
+	}
+	return res, nil
+}
+
+func (s *Server) ListNamedQueries(ctx context.Context, req *p2pproto.ListNamedQueriesRequest) (*p2pproto.ListNamedQueriesResponse, error) {
+	res := &p2pproto.ListNamedQueriesResponse{}
+	if s.NamedQueries == nil {
+		return res, nil
+	}
+	queries, err := s.NamedQueries.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, q := range queries {
+		res.Queries = append(res.Queries, namedQueryToProto(q))
+	}
+	return res, nil
+}
+
+func (s *Server) DefineNamedQuery(ctx context.Context, req *p2pproto.NamedQuery) (*p2pproto.NamedQuery, error) {
+	if s.NamedQueries == nil {
+		return nil, status.Error(codes.Unimplemented, "the node has no named query registry")
+	}
+	q, err := s.NamedQueries.Define(namedqueries.Query{Name: req.Name, Statement: req.Statement, Params: req.Params, Description: req.Description})
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return namedQueryToProto(q), nil
+}
+
+func (s *Server) DropNamedQuery(ctx context.Context, req *p2pproto.DropNamedQueryRequest) (*p2pproto.DropNamedQueryResponse, error) {
+	if s.NamedQueries == nil {
+		return nil, status.Error(codes.Unimplemented, "the node has no named query registry")
+	}
+	err := s.NamedQueries.Drop(req.Name)
+	if errors.Is(err, namedqueries.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p2pproto.DropNamedQueryResponse{}, nil
+}
+
+func namedQueryToProto(q namedqueries.Query) *p2pproto.NamedQuery {
+	return &p2pproto.NamedQuery{
+		Name:          q.Name,
+		Statement:     q.Statement,
+		Params:        q.Params,
+		Description:   q.Description,
+		UpdatedUnixMs: q.UpdatedAt.UnixMilli(),
+		ReadOnly:      q.ReadOnly(),
+	}
+}
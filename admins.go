@@ -0,0 +1,61 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/nustiueudinastea/doltswarmdemo/acl"
+	"github.com/nustiueudinastea/doltswarmdemo/client"
+	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+)
+
+const (
+	// adminKeyDir holds the identity the CLI uses to call the Admin service of
+	// the local node
+	adminKeyDir = "admin"
+	// adminRole is the ACL role, e.g. from a peer certificate, of the peers
+	// allowed to call the Admin service
+	adminRole = "admin"
+)
+
+// adminPolicy decides which peers can call the Admin service: the local admin
+// identity, the peers given on the command line and the peers with the admin
+// role in the ACL policy
+type adminPolicy struct {
+	local    string
+	peers    map[string]bool
+	enforcer *acl.Enforcer
+}
+
+func newAdminPolicy(peers []string, enforcer *acl.Enforcer) (*adminPolicy, error) {
+	key, err := adminKey()
+	if err != nil {
+		return nil, err
+	}
+	policy := &adminPolicy{local: key.GetID(), peers: map[string]bool{}, enforcer: enforcer}
+	for _, peerID := range peers {
+		policy.peers[peerID] = true
+	}
+	return policy, nil
+}
+
+func (a *adminPolicy) allow(peerID string) bool {
+	if peerID == a.local || a.peers[peerID] {
+		return true
+	}
+	return a.enforcer != nil && a.enforcer.Policy.HasRole(peerID, adminRole)
+}
+
+// adminKey returns the admin identity kept in the working directory, and
+// creates it the first time
+func adminKey() (*p2p.P2PKey, error) {
+	return p2p.NewKey(filepath.Join(workDir, adminKeyDir))
+}
+
+// adminIdentity is the client option connecting with the admin identity
+func adminIdentity() (client.Option, error) {
+	key, err := adminKey()
+	if err != nil {
+		return nil, err
+	}
+	return client.WithIdentity(key.PrivateKey()), nil
+}
@@ -0,0 +1,261 @@
+// Package alerting sends operational alerts, like a peer being down or the
+// disk filling up, to Slack channels and email addresses. Rules route every
+// kind of alert to some notifiers and limit how often the same alert is sent.
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	alertBuffer    = 100
+	notifyTimeout  = 30 * time.Second
+	defaultSubject = "doltswarm"
+)
+
+// Kind is the kind of an alert
+type Kind string
+
+const (
+	// KindPeerDown is raised when a peer stays disconnected for longer than
+	// the peer down threshold
+	KindPeerDown Kind = "peer_down"
+	// KindPeerUp is raised when a peer that was reported down reconnects
+	KindPeerUp Kind = "peer_up"
+	// KindSyncLag is raised when we miss more commits of a peer than the sync
+	// lag threshold
+	KindSyncLag Kind = "sync_lag"
+	// KindQuarantined is raised when a commit or write is quarantined
+	KindQuarantined Kind = "quarantined"
+	// KindDiskFull is raised when the free disk space goes below the
+	// threshold
+	KindDiskFull Kind = "disk_full"
+	// KindOverloaded is raised when the node goes over its resource budgets
+	// and sheds load
+	KindOverloaded Kind = "overloaded"
+)
+
+var kinds = []Kind{KindPeerDown, KindPeerUp, KindSyncLag, KindQuarantined, KindDiskFull, KindOverloaded}
+
+func (k Kind) valid() bool {
+	for _, kind := range kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Severity is how urgent an alert is
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// level returns the rank of the severity, or -1 if it's unknown
+func (s Severity) level() int {
+	switch s {
+	case SeverityInfo:
+		return 0
+	case SeverityWarning:
+		return 1
+	case SeverityCritical:
+		return 2
+	}
+	return -1
+}
+
+// Alert is an operational event worth notifying someone about
+type Alert struct {
+	Kind     Kind
+	Severity Severity
+	// Key identifies what the alert is about, e.g. a peer ID, so that rate
+	// limiting applies to every peer separately
+	Key     string
+	Summary string
+	Details string
+	// Node is the ID of the node raising the alert. It is set when sending.
+	Node string
+	Time time.Time
+	// Suppressed is the number of identical alerts that were not sent
+	// because of rate limiting since the last one
+	Suppressed int
+}
+
+// Notifier delivers alerts
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// delivery is an alert to send to a notifier
+type delivery struct {
+	notifier string
+	alert    Alert
+}
+
+// Dispatcher routes alerts to the notifiers of the rules they match
+type Dispatcher struct {
+	log       *logrus.Entry
+	node      string
+	rules     []Rule
+	notifiers map[string]Notifier
+	now       func() time.Time
+
+	mtx sync.Mutex
+	// last is the time an alert was sent for every rule, kind and key, and
+	// suppressed the number of alerts not sent since then
+	last       map[string]time.Time
+	suppressed map[string]int
+	queue      chan delivery
+}
+
+// New creates a dispatcher for the rules and notifiers of the config. node
+// identifies the local node in the alerts.
+func New(cfg *Config, node string, logger *logrus.Entry) (*Dispatcher, error) {
+	notifiers := map[string]Notifier{}
+	for _, notifierCfg := range cfg.Notifiers {
+		notifier, err := NewNotifier(notifierCfg)
+		if err != nil {
+			return nil, err
+		}
+		notifiers[notifierCfg.Name] = notifier
+	}
+	return &Dispatcher{
+		log:        logger,
+		node:       node,
+		rules:      cfg.Rules,
+		notifiers:  notifiers,
+		now:        time.Now,
+		last:       map[string]time.Time{},
+		suppressed: map[string]int{},
+		queue:      make(chan delivery, alertBuffer),
+	}, nil
+}
+
+func (rule Rule) matches(alert Alert) bool {
+	if alert.Severity.level() < rule.MinSeverity.level() {
+		return false
+	}
+	if len(rule.Kinds) == 0 {
+		return true
+	}
+	for _, kind := range rule.Kinds {
+		if kind == alert.Kind {
+			return true
+		}
+	}
+	return false
+}
+
+// route returns the deliveries of an alert, leaving out the rules that sent
+// the same alert less than their minimum interval ago
+func (d *Dispatcher) route(alert Alert) []delivery {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	deliveries := []delivery{}
+	sent := map[string]bool{}
+	for i, rule := range d.rules {
+		if !rule.matches(alert) {
+			continue
+		}
+		key := fmt.Sprintf("%d/%s/%s", i, alert.Kind, alert.Key)
+		if last, found := d.last[key]; found && alert.Time.Sub(last) < time.Duration(rule.MinInterval) {
+			d.suppressed[key]++
+			continue
+		}
+		d.last[key] = alert.Time
+		routed := alert
+		routed.Suppressed = d.suppressed[key]
+		delete(d.suppressed, key)
+		for _, name := range rule.Notifiers {
+			// a notifier matched by several rules gets the alert once
+			if sent[name] {
+				continue
+			}
+			sent[name] = true
+			deliveries = append(deliveries, delivery{notifier: name, alert: routed})
+		}
+	}
+	return deliveries
+}
+
+// Send queues an alert for the notifiers of the rules it matches. It never
+// blocks: alerts are dropped if the notifiers can't keep up.
+func (d *Dispatcher) Send(alert Alert) {
+	alert.Node = d.node
+	if alert.Time.IsZero() {
+		alert.Time = d.now()
+	}
+	for _, delivery := range d.route(alert) {
+		select {
+		case d.queue <- delivery:
+		default:
+			d.log.Warnf("Alert queue is full. Dropping %s alert for notifier '%s'", alert.Kind, delivery.notifier)
+		}
+	}
+}
+
+// Start delivers the queued alerts until the returned function is called
+func (d *Dispatcher) Start() func() error {
+	stopSignal := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case delivery := <-d.queue:
+				d.deliver(delivery)
+			case <-stopSignal:
+				return
+			}
+		}
+	}()
+	return func() error {
+		close(stopSignal)
+		<-done
+		return nil
+	}
+}
+
+func (d *Dispatcher) deliver(delivery delivery) {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	err := d.notifiers[delivery.notifier].Notify(ctx, delivery.alert)
+	if err != nil {
+		d.log.Errorf("Failed to send %s alert to '%s': %s", delivery.alert.Kind, delivery.notifier, err.Error())
+	}
+}
+
+// title returns the one line description of an alert
+func title(alert Alert) string {
+	s := fmt.Sprintf("[%s] %s", alert.Severity, alert.Summary)
+	if alert.Node != "" {
+		s += " (node " + alert.Node + ")"
+	}
+	return s
+}
+
+// body returns the full description of an alert
+func body(alert Alert) string {
+	s := ""
+	if alert.Details != "" {
+		s += alert.Details + "\n\n"
+	}
+	s += fmt.Sprintf("Kind: %s\nTime: %s\n", alert.Kind, alert.Time.UTC().Format(time.RFC3339))
+	if alert.Node != "" {
+		s += "Node: " + alert.Node + "\n"
+	}
+	if alert.Suppressed > 0 {
+		s += fmt.Sprintf("%d similar alerts were suppressed since the last one\n", alert.Suppressed)
+	}
+	return s
+}
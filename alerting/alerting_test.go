@@ -0,0 +1,167 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func testConfig() *Config {
+	return &Config{
+		Notifiers: []NotifierConfig{
+			{Name: "slack", Type: "slack", WebhookURL: "http://localhost"},
+			{Name: "mail", Type: "smtp", SMTPAddr: "localhost", From: "a@example.com", To: []string{"b@example.com"}},
+		},
+		Rules: []Rule{
+			{Kinds: []Kind{KindPeerDown, KindDiskFull}, Notifiers: []string{"slack"}, MinInterval: Duration(time.Minute)},
+			{MinSeverity: SeverityCritical, Notifiers: []string{"slack", "mail"}},
+		},
+	}
+}
+
+func newTestDispatcher(t *testing.T) *Dispatcher {
+	cfg := testConfig()
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	d, err := New(cfg, "node", logrus.NewEntry(logrus.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func notifierNames(deliveries []delivery) string {
+	names := []string{}
+	for _, delivery := range deliveries {
+		names = append(names, delivery.notifier)
+	}
+	return strings.Join(names, ",")
+}
+
+func TestRoute(t *testing.T) {
+	d := newTestDispatcher(t)
+	now := time.Now()
+
+	tests := []struct {
+		alert    Alert
+		expected string
+	}{
+		{Alert{Kind: KindPeerDown, Severity: SeverityWarning, Key: "a", Time: now}, "slack"},
+		{Alert{Kind: KindSyncLag, Severity: SeverityWarning, Key: "a", Time: now}, ""},
+		{Alert{Kind: KindQuarantined, Severity: SeverityCritical, Key: "a", Time: now}, "slack,mail"},
+		{Alert{Kind: KindDiskFull, Severity: SeverityCritical, Key: "disk", Time: now}, "slack,mail"},
+	}
+	for _, test := range tests {
+		if got := notifierNames(d.route(test.alert)); got != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.alert.Kind, test.expected, got)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	d := newTestDispatcher(t)
+	now := time.Now()
+	alert := Alert{Kind: KindPeerDown, Severity: SeverityWarning, Key: "a", Time: now}
+
+	if got := notifierNames(d.route(alert)); got != "slack" {
+		t.Fatalf("expected the first alert to be sent, got %q", got)
+	}
+	for i := 0; i < 3; i++ {
+		alert.Time = now.Add(time.Duration(i+1) * time.Second)
+		if got := notifierNames(d.route(alert)); got != "" {
+			t.Errorf("expected repeated alerts to be suppressed, got %q", got)
+		}
+	}
+	other := Alert{Kind: KindPeerDown, Severity: SeverityWarning, Key: "b", Time: now.Add(time.Second)}
+	if got := notifierNames(d.route(other)); got != "slack" {
+		t.Errorf("expected alerts for another peer to be sent, got %q", got)
+	}
+
+	alert.Time = now.Add(2 * time.Minute)
+	deliveries := d.route(alert)
+	if len(deliveries) != 1 || deliveries[0].alert.Suppressed != 3 {
+		t.Errorf("expected the alert to be sent with 3 suppressed, got %+v", deliveries)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *Config)
+	}{
+		{"unknown notifier", func(cfg *Config) { cfg.Rules[0].Notifiers = []string{"pager"} }},
+		{"unknown kind", func(cfg *Config) { cfg.Rules[0].Kinds = []Kind{"meteor"} }},
+		{"unknown severity", func(cfg *Config) { cfg.Rules[0].MinSeverity = "fatal" }},
+		{"missing webhook", func(cfg *Config) { cfg.Notifiers[0].WebhookURL = "" }},
+		{"unknown type", func(cfg *Config) { cfg.Notifiers[0].Type = "pager" }},
+		{"duplicate notifier", func(cfg *Config) { cfg.Notifiers[1].Name = "slack" }},
+		{"disk percent", func(cfg *Config) { cfg.Thresholds.DiskFreePercent = 120 }},
+	}
+	for _, test := range tests {
+		cfg := testConfig()
+		test.modify(cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+
+	cfg := testConfig()
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Rules[1].MinInterval != Duration(defaultMinInterval) || cfg.Thresholds.PeerDown != Duration(defaultPeerDown) {
+		t.Errorf("expected defaults to be set, got %+v", cfg)
+	}
+
+	var th Thresholds
+	if err := json.Unmarshal([]byte(`{"peer_down": "90s"}`), &th); err != nil {
+		t.Fatal(err)
+	}
+	if th.PeerDown != Duration(90*time.Second) {
+		t.Errorf("expected 90s, got %s", time.Duration(th.PeerDown))
+	}
+}
+
+func TestSlack(t *testing.T) {
+	received := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		payload := map[string]string{}
+		if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- payload["text"]
+	}))
+	defer srv.Close()
+
+	d := newTestDispatcher(t)
+	d.notifiers["slack"] = &Slack{WebhookURL: srv.URL, Client: srv.Client()}
+	stop := d.Start()
+	defer stop()
+
+	d.Send(Alert{Kind: KindPeerDown, Severity: SeverityWarning, Key: "a", Summary: "Peer a is down"})
+	select {
+	case text := <-received:
+		if !strings.Contains(text, "[warning] Peer a is down (node node)") || !strings.Contains(text, "Kind: peer_down") {
+			t.Errorf("unexpected message %q", text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the alert to be posted")
+	}
+
+	failing := &Slack{WebhookURL: srv.URL + "/missing", Client: srv.Client()}
+	if err := failing.Notify(context.Background(), Alert{Time: time.Now()}); err == nil {
+		t.Errorf("expected an error when the webhook fails")
+	}
+}
@@ -0,0 +1,178 @@
+package alerting
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+)
+
+const (
+	defaultPeerDown          = 5 * time.Minute
+	defaultDiskFreePercent   = 10
+	defaultDiskCheckInterval = time.Minute
+	defaultMinInterval       = 15 * time.Minute
+	defaultSMTPPort          = "587"
+)
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Duration is a time.Duration written as a string like "5m" in the config
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return fmt.Errorf("durations have to be strings like \"5m\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// NotifierConfig describes where alerts are sent. Secrets like the webhook
+// URL and the SMTP password can be references to secrets.
+type NotifierConfig struct {
+	Name string `json:"name"`
+	// Type is either slack or smtp
+	Type string `json:"type"`
+	// WebhookURL is the incoming webhook of a Slack channel
+	WebhookURL string `json:"webhook_url,omitempty"`
+	// SMTPAddr is the host:port of the mail server. The port defaults to 587.
+	SMTPAddr string   `json:"smtp_addr,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+}
+
+// Rule routes the alerts it matches to some notifiers
+type Rule struct {
+	// Kinds are the kinds of alerts matched by the rule. All kinds match if
+	// empty.
+	Kinds []Kind `json:"kinds,omitempty"`
+	// MinSeverity is the lowest severity matched by the rule. Defaults to
+	// info.
+	MinSeverity Severity `json:"min_severity,omitempty"`
+	Notifiers   []string `json:"notifiers"`
+	// MinInterval is the minimum time between two alerts of the same kind
+	// and key sent by the rule. Alerts sent in the meantime are counted and
+	// reported with the next one. Defaults to 15m.
+	MinInterval Duration `json:"min_interval,omitempty"`
+}
+
+// Thresholds control when the operational alerts are raised
+type Thresholds struct {
+	// PeerDown is how long a peer stays disconnected before an alert is
+	// raised. Defaults to 5m.
+	PeerDown Duration `json:"peer_down,omitempty"`
+	// DiskFreePercent raises an alert when the free space of the disk
+	// holding the working directory goes below it. Defaults to 10.
+	DiskFreePercent float64 `json:"disk_free_percent,omitempty"`
+	// DiskCheckInterval is how often the free disk space is checked.
+	// Defaults to 1m.
+	DiskCheckInterval Duration `json:"disk_check_interval,omitempty"`
+}
+
+// Config holds the notifiers and routing rules of a node
+type Config struct {
+	Notifiers  []NotifierConfig `json:"notifiers"`
+	Rules      []Rule           `json:"rules"`
+	Thresholds Thresholds       `json:"thresholds"`
+}
+
+// LoadConfig reads an alerting configuration from a JSON file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alerting config: %w", err)
+	}
+	cfg := &Config{}
+	err = json.Unmarshal(data, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse alerting config '%s': %w", path, err)
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate checks the configuration and sets the defaults
+func (cfg *Config) Validate() error {
+	names := map[string]bool{}
+	for _, notifier := range cfg.Notifiers {
+		if !validName.MatchString(notifier.Name) {
+			return fmt.Errorf("alerting config: invalid notifier name '%s'", notifier.Name)
+		}
+		if names[notifier.Name] {
+			return fmt.Errorf("alerting config: duplicate notifier '%s'", notifier.Name)
+		}
+		names[notifier.Name] = true
+		switch notifier.Type {
+		case "slack":
+			if notifier.WebhookURL == "" {
+				return fmt.Errorf("alerting config: missing webhook URL of notifier '%s'", notifier.Name)
+			}
+		case "smtp":
+			if notifier.SMTPAddr == "" || notifier.From == "" || len(notifier.To) == 0 {
+				return fmt.Errorf("alerting config: notifier '%s' needs an SMTP address, a sender and recipients", notifier.Name)
+			}
+		default:
+			return fmt.Errorf("alerting config: unknown type '%s' of notifier '%s'", notifier.Type, notifier.Name)
+		}
+	}
+
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		for _, kind := range rule.Kinds {
+			if !kind.valid() {
+				return fmt.Errorf("alerting config: unknown alert kind '%s' in rule %d", kind, i)
+			}
+		}
+		if rule.MinSeverity == "" {
+			rule.MinSeverity = SeverityInfo
+		}
+		if rule.MinSeverity.level() < 0 {
+			return fmt.Errorf("alerting config: unknown severity '%s' in rule %d", rule.MinSeverity, i)
+		}
+		if len(rule.Notifiers) == 0 {
+			return fmt.Errorf("alerting config: no notifiers in rule %d", i)
+		}
+		for _, name := range rule.Notifiers {
+			if !names[name] {
+				return fmt.Errorf("alerting config: unknown notifier '%s' in rule %d", name, i)
+			}
+		}
+		if rule.MinInterval < 0 {
+			return fmt.Errorf("alerting config: negative minimum interval in rule %d", i)
+		}
+		if rule.MinInterval == 0 {
+			rule.MinInterval = Duration(defaultMinInterval)
+		}
+	}
+
+	th := &cfg.Thresholds
+	if th.PeerDown == 0 {
+		th.PeerDown = Duration(defaultPeerDown)
+	}
+	if th.DiskFreePercent == 0 {
+		th.DiskFreePercent = defaultDiskFreePercent
+	}
+	if th.DiskFreePercent < 0 || th.DiskFreePercent > 100 {
+		return fmt.Errorf("alerting config: disk free percent has to be between 0 and 100")
+	}
+	if th.DiskCheckInterval == 0 {
+		th.DiskCheckInterval = Duration(defaultDiskCheckInterval)
+	}
+	if th.PeerDown < 0 || th.DiskCheckInterval < 0 {
+		return fmt.Errorf("alerting config: thresholds can't be negative durations")
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+package alerting
+
+import (
+	"syscall"
+)
+
+// DiskFreePercent returns the percentage of the disk holding path that is
+// available to unprivileged users
+func DiskFreePercent(path string) (float64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, err
+	}
+	if stat.Blocks == 0 {
+		return 100, nil
+	}
+	return float64(stat.Bavail) / float64(stat.Blocks) * 100, nil
+}
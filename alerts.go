@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/alerting"
+	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+	"github.com/nustiueudinastea/doltswarmdemo/quarantine"
+	"github.com/nustiueudinastea/doltswarmdemo/secrets"
+)
+
+var alertConfig *alerting.Config
+var alertDispatcher *alerting.Dispatcher
+
+// loadAlertConfig reads the alerting config and resolves the secrets of its
+// notifiers
+func loadAlertConfig(path string, resolver *secrets.Resolver) (*alerting.Config, error) {
+	cfg, err := alerting.LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	for i := range cfg.Notifiers {
+		notifier := &cfg.Notifiers[i]
+		err = resolver.ResolveAll(&notifier.WebhookURL, &notifier.Password)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// sendAlert sends an alert if alerting is configured
+func sendAlert(alert alerting.Alert) {
+	if alertDispatcher != nil {
+		alertDispatcher.Send(alert)
+	}
+}
+
+// startAlerts raises alerts for peers down for too long, peers we lag behind
+// and the disk filling up
+func startAlerts(dispatcher *alerting.Dispatcher, cfg *alerting.Config) func() error {
+	dispatcherStopper := dispatcher.Start()
+	peerDown := time.Duration(cfg.Thresholds.PeerDown)
+
+	var mtx sync.Mutex
+	// down holds a timer for every disconnected peer, and alerted the time
+	// the peers reported down disconnected
+	down := map[string]*time.Timer{}
+	alerted := map[string]time.Time{}
+
+	events, cancel := p2pmgr.SubscribeEvents(p2p.EventPeerConnected, p2p.EventPeerDisconnected, p2p.EventSyncLagExceeded)
+	crashReporter.Go("alerts", func() {
+		for ev := range events {
+			ev := ev
+			switch ev.Type {
+			case p2p.EventSyncLagExceeded:
+				dispatcher.Send(alerting.Alert{
+					Kind:     alerting.KindSyncLag,
+					Severity: alerting.SeverityWarning,
+					Key:      ev.PeerID,
+					Summary:  fmt.Sprintf("Missing %d commits of peer %s", ev.Lag, ev.PeerID),
+				})
+			case p2p.EventPeerDisconnected:
+				mtx.Lock()
+				if _, found := down[ev.PeerID]; !found {
+					down[ev.PeerID] = time.AfterFunc(peerDown, func() {
+						mtx.Lock()
+						alerted[ev.PeerID] = ev.Time
+						mtx.Unlock()
+						dispatcher.Send(alerting.Alert{
+							Kind:     alerting.KindPeerDown,
+							Severity: alerting.SeverityWarning,
+							Key:      ev.PeerID,
+							Summary:  fmt.Sprintf("Peer %s is down for more than %s", ev.PeerID, peerDown),
+							Details:  fmt.Sprintf("The peer disconnected at %s.", ev.Time.Format(time.RFC3339)),
+						})
+					})
+				}
+				mtx.Unlock()
+			case p2p.EventPeerConnected:
+				mtx.Lock()
+				if timer, found := down[ev.PeerID]; found {
+					timer.Stop()
+					delete(down, ev.PeerID)
+				}
+				since, wasAlerted := alerted[ev.PeerID]
+				delete(alerted, ev.PeerID)
+				mtx.Unlock()
+				if wasAlerted {
+					dispatcher.Send(alerting.Alert{
+						Kind:     alerting.KindPeerUp,
+						Severity: alerting.SeverityInfo,
+						Key:      ev.PeerID,
+						Summary:  fmt.Sprintf("Peer %s is back after %s", ev.PeerID, ev.Time.Sub(since).Round(time.Second)),
+					})
+				}
+			}
+		}
+	})
+
+	diskTicker := time.NewTicker(time.Duration(cfg.Thresholds.DiskCheckInterval))
+	stopSignal := make(chan struct{})
+	crashReporter.Go("disk-alerts", func() {
+		for {
+			select {
+			case <-diskTicker.C:
+				free, err := alerting.DiskFreePercent(workDir)
+				if err != nil {
+					log.Errorf("Failed to check free disk space: %s", err.Error())
+					continue
+				}
+				if free < cfg.Thresholds.DiskFreePercent {
+					dispatcher.Send(alerting.Alert{
+						Kind:     alerting.KindDiskFull,
+						Severity: alerting.SeverityCritical,
+						Key:      workDir,
+						Summary:  fmt.Sprintf("Disk is nearly full: %.1f%% free", free),
+						Details:  fmt.Sprintf("The disk holding %s has less than %.1f%% of free space.", workDir, cfg.Thresholds.DiskFreePercent),
+					})
+				}
+			case <-stopSignal:
+				return
+			}
+		}
+	})
+
+	return func() error {
+		cancel()
+		diskTicker.Stop()
+		close(stopSignal)
+		mtx.Lock()
+		for _, timer := range down {
+			timer.Stop()
+		}
+		mtx.Unlock()
+		return dispatcherStopper()
+	}
+}
+
+// alertQuarantinedEntry raises an alert for a new quarantine entry
+func alertQuarantinedEntry(entry quarantine.Entry) {
+	alert := alerting.Alert{
+		Kind:     alerting.KindQuarantined,
+		Severity: alerting.SeverityWarning,
+		Key:      entry.Peer,
+		Details:  "Quarantine entry: " + entry.ID,
+	}
+	switch {
+	case entry.MergeInto != "":
+		alert.Summary = fmt.Sprintf("Commit %s from peer %s is waiting for review to be merged into %s", entry.Commit, entry.Peer, entry.MergeInto)
+	case entry.Commit != "":
+		alert.Summary = fmt.Sprintf("Quarantined commit %s from peer %s: %s", entry.Commit, entry.Peer, entry.Reason)
+	default:
+		alert.Summary = fmt.Sprintf("Quarantined write from peer %s: %s", entry.Peer, entry.Reason)
+	}
+	sendAlert(alert)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+)
+
+const announcementsFile = "announcements.jsonl"
+
+// printAnnouncements prints the heads announced to and by peers that were
+// recorded in the working directory, optionally filtered by peer, direction
+// and age
+func printAnnouncements(peerID string, direction string, since time.Duration) error {
+	if direction != "" && direction != p2p.AnnouncementSent && direction != p2p.AnnouncementReceived {
+		return fmt.Errorf("unknown direction '%s'. Use %s or %s", direction, p2p.AnnouncementSent, p2p.AnnouncementReceived)
+	}
+	announcements, err := p2p.ReadAnnouncements(filepath.Join(workDir, announcementsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no announcement log. Is the server running with --announcement-retention?")
+		}
+		return fmt.Errorf("failed to read announcement log: %w", err)
+	}
+	for _, a := range announcements {
+		if peerID != "" && a.Peer != peerID {
+			continue
+		}
+		if direction != "" && a.Direction != direction {
+			continue
+		}
+		if since > 0 && time.Since(a.Time) > since {
+			continue
+		}
+		line := fmt.Sprintf("%s %-8s %s %s", a.Time.Format(time.RFC3339), a.Direction, a.Peer, a.Head)
+		if a.Err != "" {
+			line += " error: " + a.Err
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/nustiueudinastea/doltswarmdemo/approvals"
+	"github.com/nustiueudinastea/doltswarmdemo/author"
+	"github.com/nustiueudinastea/doltswarmdemo/branchpolicy"
+	"github.com/nustiueudinastea/doltswarmdemo/feed"
+	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"github.com/nustiueudinastea/doltswarmdemo/quarantine"
+)
+
+const (
+	approvalRPCTimeout = 5 * time.Second
+	approvalCLITimeout = 30 * time.Second
+)
+
+// validCommitHash matches the hashes of Dolt commits
+var validCommitHash = regexp.MustCompile(`^[0-9a-v]{32}$`)
+
+// approvalStore holds the commits of the approval branches and the approvals
+// received for them
+var approvalStore *approvals.Store
+
+// approvalMergeMtx keeps a commit from being merged twice when its last
+// approvals arrive together
+var approvalMergeMtx sync.Mutex
+
+// commitApprover signs approvals with the key of the node and sends them to
+// the peers
+type commitApprover struct {
+	key      crypto.PrivKey
+	policies branchpolicy.Policies
+}
+
+// Approve signs an approval of a commit synced on an approval branch and sends
+// it to the peers. Approving a commit again sends the approval again, e.g. to
+// peers that were offline.
+func (c *commitApprover) Approve(ctx context.Context, branch string, commit string) (approvals.Pending, error) {
+	policy, found := c.policies[branch]
+	if !found || policy.Mode != branchpolicy.Approval {
+		return approvals.Pending{}, fmt.Errorf("'%s' is not an approval branch", branch)
+	}
+	if !policy.IsApprover(p2pmgr.GetID()) {
+		return approvals.Pending{}, fmt.Errorf("this node is not an approver of branch '%s'", branch)
+	}
+	// approvers only sign what they can review
+	pending, found := approvalStore.Get(commit)
+	if !found || !pending.Synced || pending.Branch != branch {
+		return approvals.Pending{}, fmt.Errorf("commit '%s' of branch '%s' was not synced by this node", commit, branch)
+	}
+	if pending.Author == p2pmgr.GetID() {
+		return approvals.Pending{}, fmt.Errorf("commit '%s' was made by this node, which can't approve it", commit)
+	}
+
+	a, err := approvals.Sign(c.key, branch, commit, pending.Author, time.Now())
+	if err != nil {
+		return approvals.Pending{}, err
+	}
+	pending, _, err = approvalStore.Add(a)
+	if err != nil {
+		return approvals.Pending{}, err
+	}
+	log.Infof("Approved commit '%s' of branch '%s'", commit, branch)
+	sendApproval(ctx, a)
+	return pending, nil
+}
+
+func (c *commitApprover) Approvals(merged bool) []approvals.Pending {
+	return approvalStore.List(merged)
+}
+
+func (c *commitApprover) Policy(branch string) branchpolicy.Policy {
+	return c.policies[branch]
+}
+
+// sendApproval sends an approval to every connected peer
+func sendApproval(ctx context.Context, a approvals.Approval) {
+	for _, client := range p2pmgr.GetClients() {
+		sendCtx, cancel := context.WithTimeout(ctx, approvalRPCTimeout)
+		_, err := client.SubmitApproval(sendCtx, a.Proto())
+		cancel()
+		if err != nil {
+			log.Warnf("Failed to send the approval of commit '%s' to peer '%s': %s", a.Commit, client.GetID(), err.Error())
+		}
+	}
+}
+
+// proposeCommit records a commit synced on an approval branch, and merges it
+// if its approvals arrived before it. The author is the peer that signed the
+// commit, so that a peer can't pass its commit off as another's and approve
+// it itself.
+func proposeCommit(ev feed.CommitEvent) error {
+	peerID, found := p2pKey.Signer(ev.Hash)
+	if !found {
+		return fmt.Errorf("signer of commit '%s' is unknown", ev.Hash)
+	}
+	pending, err := approvalStore.Propose(ev.Branch, ev.Hash, peerID, ev.Message)
+	if err != nil {
+		return err
+	}
+	if peerID != p2pmgr.GetID() {
+		log.Infof("Commit '%s' on branch '%s' from peer '%s' is waiting for approvals", ev.Hash, ev.Branch, peerID)
+	}
+	mergeIfApproved(pending)
+	return nil
+}
+
+// mergeIfApproved merges a commit of an approval branch into the target branch
+// once it has the required approvals. Like on auto-merge branches, only the
+// author merges its commits, so that the same commit isn't merged by several
+// peers.
+func mergeIfApproved(pending approvals.Pending) {
+	if pending.Author != p2pmgr.GetID() {
+		return
+	}
+	approvalMergeMtx.Lock()
+	defer approvalMergeMtx.Unlock()
+
+	pending, found := approvalStore.Get(pending.Commit)
+	if !found || !pending.Synced || pending.Merged {
+		return
+	}
+	policy := branchPolicies[pending.Branch]
+	counted := approvals.Counted(policy, pending.Branch, pending.Commit, pending.Author, pending.Approvals)
+	if len(counted) < policy.Required {
+		log.Infof("Commit '%s' on branch '%s' has %d of the %d required approvals", pending.Commit, pending.Branch, len(counted), policy.Required)
+		return
+	}
+
+	msg := approvals.Annotate(fmt.Sprintf("Merge approved commit %s from %s", pending.Commit, pending.Branch), counted)
+	msg = author.AnnotatePeer(msg, p2pmgr.GetID())
+	// the merge commit carries the approvals, so it can't be a fast-forward
+	err := mergeInto(dbi, policy.MergeInto, "CALL DOLT_MERGE('--no-ff', '-m', ?, ?);", msg, pending.Commit)
+	if err != nil {
+		log.Errorf("Failed to merge approved commit '%s' into '%s': %s", pending.Commit, policy.MergeInto, err.Error())
+		return
+	}
+	err = approvalStore.SetMerged(pending.Commit)
+	if err != nil {
+		log.Errorf("Failed to record the merge of approved commit '%s': %s", pending.Commit, err.Error())
+	}
+	log.Infof("Merged approved commit '%s' from branch '%s' into '%s'", pending.Commit, pending.Branch, policy.MergeInto)
+}
+
+// checkApprovedMerge checks that a commit on the target branch of approval
+// branches is the merge of a commit with the approvals required by the policy
+// of its branch
+func checkApprovedMerge(policies branchpolicy.Policies, hash string, target string, msg string) error {
+	err := approvals.CheckMerge(policies, target, msg)
+	if err != nil {
+		return err
+	}
+	merged, _ := approvals.FromMessage(msg)
+	return approvals.CheckMergeCommit(sqlHistory{}, hash, merged[0].Commit)
+}
+
+// checkApprovalsBeforeApply rejects the merge commits pulled from peers that
+// carry approvals that don't count, before they are applied
+func checkApprovalsBeforeApply(policies branchpolicy.Policies) p2p.CommitCheck {
+	return func(commit string, signer string) error {
+		if !validCommitHash.MatchString(commit) {
+			return fmt.Errorf("invalid commit hash '%s'", commit)
+		}
+		var msg string
+		err := dbi.QueryRow(fmt.Sprintf("SELECT message FROM dolt_log('%s') LIMIT 1;", commit)).Scan(&msg)
+		if err != nil {
+			return fmt.Errorf("failed to read commit '%s': %w", commit, err)
+		}
+		merged, found := approvals.FromMessage(msg)
+		if !found || len(merged) == 0 {
+			return nil
+		}
+		target := policies[merged[0].Branch].MergeInto
+		if err := checkApprovedMerge(policies, commit, target, msg); err != nil {
+			log.Warnf("Rejected commit '%s' from peer '%s': %s", commit, signer, err.Error())
+			return err
+		}
+		return nil
+	}
+}
+
+// checkApprovalTarget quarantines the commits on the target branch of approval
+// branches that didn't go through the approvals. The merge commits pulled
+// from peers were already checked before they were applied, and are checked
+// again here for the ones made on the node. Other commits are only accepted
+// if an approved merge commit brought them in from an approval branch.
+func checkApprovalTarget(policies branchpolicy.Policies, ev feed.CommitEvent) {
+	err := checkApprovedMerge(policies, ev.Hash, ev.Branch, ev.Message)
+	if err == nil {
+		return
+	}
+	if err == approvals.ErrNotApproved {
+		merged, mergedErr := mergedByApprovedCommit(policies, ev.Hash, ev.Branch)
+		if mergedErr != nil {
+			log.Errorf("Failed to check the approvals of commit '%s' on branch '%s': %s", ev.Hash, ev.Branch, mergedErr.Error())
+			return
+		}
+		if merged {
+			return
+		}
+	}
+
+	peerID, found := p2pKey.Signer(ev.Hash)
+	if !found {
+		peerID, _ = author.PeerFromMessage(ev.Message)
+	}
+	_, err = quarantineStore.Add(quarantine.Entry{Peer: peerID, Reason: "commit on branch '" + ev.Branch + "' is not approved: " + err.Error(), Commit: ev.Hash, Message: ev.Message, Tables: ev.Tables, Branch: ev.Branch})
+	if err != nil {
+		log.Errorf("Failed to quarantine unapproved commit '%s': %s", ev.Hash, err.Error())
+	}
+}
+
+// mergedByApprovedCommit returns true if a commit on the target branch was
+// brought in by an approved merge commit, i.e. it's in the history of the
+// approved commit but not in the history the approval branch started from
+func mergedByApprovedCommit(policies branchpolicy.Policies, hash string, target string) (bool, error) {
+	rows, err := dbi.Query(fmt.Sprintf("SELECT commit_hash, message FROM dolt_log('%s') WHERE message LIKE '%%Approves: %%';", escapeSQL(target)))
+	if err != nil {
+		return false, err
+	}
+	type mergeCommit struct{ hash, msg string }
+	merges := []mergeCommit{}
+	for rows.Next() {
+		var m mergeCommit
+		if err := rows.Scan(&m.hash, &m.msg); err != nil {
+			rows.Close()
+			return false, err
+		}
+		merges = append(merges, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	history := sqlHistory{}
+	for _, m := range merges {
+		if checkApprovedMerge(policies, m.hash, target, m.msg) != nil {
+			continue
+		}
+		parents, err := history.Parents(m.hash)
+		if err != nil {
+			return false, err
+		}
+		base, err := history.MergeBase(parents[0], parents[1])
+		if err != nil {
+			return false, err
+		}
+		approved, err := inHistory(parents[1], hash)
+		if err != nil || !approved {
+			return false, err
+		}
+		before, err := inHistory(base, hash)
+		if err != nil {
+			return false, err
+		}
+		if !before {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// inHistory returns true if commit is in the history of ref
+func inHistory(ref string, commit string) (bool, error) {
+	var count int
+	err := dbi.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM dolt_log('%s') WHERE commit_hash = ?;", escapeSQL(ref)), commit).Scan(&count)
+	return count > 0, err
+}
+
+// sqlHistory reads the commit graph of the database
+type sqlHistory struct{}
+
+func (sqlHistory) Parents(commit string) ([]string, error) {
+	rows, err := dbi.Query("SELECT parent_hash FROM dolt_commit_ancestors WHERE commit_hash = ? ORDER BY parent_index;", commit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	parents := []string{}
+	for rows.Next() {
+		var parent string
+		if err := rows.Scan(&parent); err != nil {
+			return nil, err
+		}
+		parents = append(parents, parent)
+	}
+	return parents, rows.Err()
+}
+
+func (sqlHistory) MergeBase(a string, b string) (string, error) {
+	var base string
+	err := dbi.QueryRow("SELECT DOLT_MERGE_BASE(?, ?);", a, b).Scan(&base)
+	return base, err
+}
+
+func (sqlHistory) ChangedTables(from string, to string) ([]string, error) {
+	rows, err := dbi.Query(fmt.Sprintf("SELECT from_table_name, to_table_name FROM dolt_diff_summary('%s', '%s');", escapeSQL(from), escapeSQL(to)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tables := []string{}
+	for rows.Next() {
+		var fromTable, toTable string
+		if err := rows.Scan(&fromTable, &toTable); err != nil {
+			return nil, err
+		}
+		if toTable == "" {
+			toTable = fromTable
+		}
+		tables = append(tables, toTable)
+	}
+	return tables, rows.Err()
+}
+
+func escapeSQL(s string) string {
+	return strings.ReplaceAll(s, "'", "''")
+}
+
+// approveCommit approves a commit of an approval branch on the node at addr
+func approveCommit(addr string, branch string, commit string) error {
+	api, closer, err := adminClient(addr)
+	if err != nil {
+		return err
+	}
+	defer closer()
+	ctx, cancel := context.WithTimeout(context.Background(), approvalCLITimeout)
+	defer cancel()
+	pending, err := api.ApproveCommit(ctx, &p2pproto.ApproveCommitRequest{Branch: branch, Commit: commit})
+	if err != nil {
+		return err
+	}
+	printPendingApproval(pending)
+	return nil
+}
+
+// listApprovals prints the commits waiting for approval on the node at addr
+func listApprovals(addr string, merged bool) error {
+	api, closer, err := adminClient(addr)
+	if err != nil {
+		return err
+	}
+	defer closer()
+	ctx, cancel := context.WithTimeout(context.Background(), approvalCLITimeout)
+	defer cancel()
+	res, err := api.ListApprovals(ctx, &p2pproto.ListApprovalsRequest{Merged: merged})
+	if err != nil {
+		return err
+	}
+	if len(res.Approvals) == 0 {
+		fmt.Println("No commits waiting for approval")
+	}
+	for _, pending := range res.Approvals {
+		printPendingApproval(pending)
+	}
+	return nil
+}
+
+func printPendingApproval(pending *p2pproto.PendingApproval) {
+	state := "waiting"
+	if pending.Merged {
+		state = "merged"
+	}
+	fmt.Printf("%s %s -> %s by %s: %d/%d approvals, %s\n", pending.Commit, pending.Branch, pending.MergeInto, pending.Author, len(pending.Approvals), pending.Required, state)
+	for _, a := range pending.Approvals {
+		fmt.Printf("  approved by %s at %s\n", a.Approver, time.Unix(0, a.TimeUnixNano).Format(time.RFC3339))
+	}
+}
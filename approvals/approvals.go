@@ -0,0 +1,256 @@
+// Package approvals implements the two-person rule of approval branches. A
+// commit made on such a branch is merged into the target branch only once
+// enough of the designated approvers, other than its author, signed it.
+// Approvals are signed with the libp2p keys of the approvers, so that every
+// peer can check them against the peer IDs of the approvers, and the merge
+// commit carries them in its trailers for the replicas to check. The author
+// of a commit is the peer that signed it, never the Peer-ID trailer of its
+// message, and the merge commit has to be the merge of the approved commit
+// for its approvals to count.
+package approvals
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/nustiueudinastea/doltswarmdemo/branchpolicy"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"github.com/nustiueudinastea/doltswarmdemo/trailer"
+)
+
+const (
+	approvesTrailer   = "Approves"
+	approvedByTrailer = "Approved-By"
+)
+
+// Approval is the signature of a commit of an approval branch by an approver
+type Approval struct {
+	Branch   string `json:"branch"`
+	Commit   string `json:"commit"`
+	Approver string `json:"approver"`
+	// Author is the peer that made the commit. It is signed with the commit,
+	// so that an author can't count as an approver of its own commit
+	Author    string `json:"author"`
+	Signature string `json:"signature"`
+	// Time is when the approval was signed. It isn't part of the signature
+	Time time.Time `json:"time"`
+}
+
+// payload returns the signed content of an approval
+func payload(branch string, commit string, author string) []byte {
+	return []byte("approve " + branch + " " + commit + " by " + author)
+}
+
+// Sign creates the approval of a commit by the owner of the key
+func Sign(key crypto.PrivKey, branch string, commit string, author string, now time.Time) (Approval, error) {
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return Approval{}, err
+	}
+	sig, err := key.Sign(payload(branch, commit, author))
+	if err != nil {
+		return Approval{}, fmt.Errorf("failed to sign approval: %w", err)
+	}
+	return Approval{
+		Branch:    branch,
+		Commit:    commit,
+		Approver:  id.String(),
+		Author:    author,
+		Signature: base64.StdEncoding.EncodeToString(sig),
+		Time:      now.UTC(),
+	}, nil
+}
+
+// Verify checks the signature of the approval against the public key in the
+// peer ID of the approver
+func (a Approval) Verify() error {
+	id, err := peer.Decode(a.Approver)
+	if err != nil {
+		return fmt.Errorf("invalid approver '%s': %w", a.Approver, err)
+	}
+	pubKey, err := id.ExtractPublicKey()
+	if err != nil {
+		return fmt.Errorf("failed to extract public key of approver '%s': %w", a.Approver, err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(a.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature of approver '%s': %w", a.Approver, err)
+	}
+	verified, err := pubKey.Verify(payload(a.Branch, a.Commit, a.Author), sig)
+	if err != nil {
+		return fmt.Errorf("failed to verify signature of approver '%s': %w", a.Approver, err)
+	}
+	if !verified {
+		return fmt.Errorf("invalid signature of approver '%s' for commit '%s'", a.Approver, a.Commit)
+	}
+	return nil
+}
+
+// FromProto converts an approval received from a peer
+func FromProto(a *p2pproto.CommitApproval) Approval {
+	return Approval{
+		Branch:    a.Branch,
+		Commit:    a.Commit,
+		Approver:  a.Approver,
+		Author:    a.Author,
+		Signature: a.Signature,
+		Time:      time.Unix(0, a.TimeUnixNano).UTC(),
+	}
+}
+
+func (a Approval) Proto() *p2pproto.CommitApproval {
+	return &p2pproto.CommitApproval{
+		Branch:       a.Branch,
+		Commit:       a.Commit,
+		Approver:     a.Approver,
+		Author:       a.Author,
+		Signature:    a.Signature,
+		TimeUnixNano: a.Time.UnixNano(),
+	}
+}
+
+// Counted returns the approvals of a commit that count towards the approvals
+// required by the policy of its branch: the ones with a valid signature, by
+// distinct designated approvers other than the author
+func Counted(policy branchpolicy.Policy, branch string, commit string, author string, approvals []Approval) []Approval {
+	counted := []Approval{}
+	seen := map[string]bool{}
+	for _, a := range approvals {
+		if a.Branch != branch || a.Commit != commit || a.Author != author {
+			continue
+		}
+		if seen[a.Approver] || a.Approver == author || !policy.IsApprover(a.Approver) {
+			continue
+		}
+		if a.Verify() != nil {
+			continue
+		}
+		seen[a.Approver] = true
+		counted = append(counted, a)
+	}
+	return counted
+}
+
+// Annotate adds the approvals of a commit to the message of the commit
+// merging it
+func Annotate(msg string, approvals []Approval) string {
+	if len(approvals) == 0 {
+		return msg
+	}
+	first := approvals[0]
+	msg = trailer.Append(msg, approvesTrailer, first.Branch+" "+first.Commit+" "+first.Author)
+	for _, a := range approvals {
+		msg = trailer.Append(msg, approvedByTrailer, a.Approver+" "+a.Signature)
+	}
+	return msg
+}
+
+// FromMessage returns the approvals carried by a merge commit, and false if
+// the message has none
+func FromMessage(msg string) ([]Approval, bool) {
+	approves, found := trailer.Get(msg, approvesTrailer)
+	if !found {
+		return nil, false
+	}
+	fields := strings.Fields(approves)
+	if len(fields) != 3 {
+		return nil, false
+	}
+	approvals := []Approval{}
+	for _, approvedBy := range trailer.GetAll(msg, approvedByTrailer) {
+		approver, signature, found := strings.Cut(approvedBy, " ")
+		if !found {
+			continue
+		}
+		approvals = append(approvals, Approval{Branch: fields[0], Commit: fields[1], Author: fields[2], Approver: approver, Signature: signature})
+	}
+	return approvals, true
+}
+
+// ErrNotApproved is returned for commits that don't carry approvals
+var ErrNotApproved = errors.New("commit carries no approvals")
+
+// CheckMerge checks that a commit on the target branch of approval branches
+// merges a commit with the approvals required by the policy of its branch
+func CheckMerge(policies branchpolicy.Policies, target string, msg string) error {
+	approvals, found := FromMessage(msg)
+	if !found || len(approvals) == 0 {
+		return ErrNotApproved
+	}
+	a := approvals[0]
+	policy, found := policies[a.Branch]
+	if !found || policy.Mode != branchpolicy.Approval || policy.MergeInto != target {
+		return fmt.Errorf("commit approves branch '%s', which isn't an approval branch of '%s'", a.Branch, target)
+	}
+	counted := Counted(policy, a.Branch, a.Commit, a.Author, approvals)
+	if len(counted) < policy.Required {
+		return fmt.Errorf("commit '%s' has %d valid approvals out of the %d required", a.Commit, len(counted), policy.Required)
+	}
+	return nil
+}
+
+// History reads the commit graph of the database
+type History interface {
+	// Parents returns the parents of a commit, the merged commit last
+	Parents(commit string) ([]string, error)
+	MergeBase(a string, b string) (string, error)
+	// ChangedTables returns the tables that differ between two commits
+	ChangedTables(from string, to string) ([]string, error)
+}
+
+// CheckMergeCommit checks that a commit carrying the approvals of the approved
+// commit is its merge: the approved commit is its second parent, and it
+// doesn't change any table that neither of its parents changed since their
+// merge base. Otherwise the approvals of a commit could be copied to any
+// other commit.
+func CheckMergeCommit(h History, commit string, approved string) error {
+	parents, err := h.Parents(commit)
+	if err != nil {
+		return err
+	}
+	if len(parents) != 2 || parents[1] != approved {
+		return fmt.Errorf("commit '%s' is not the merge of approved commit '%s'", commit, approved)
+	}
+	base, err := h.MergeBase(parents[0], approved)
+	if err != nil {
+		return err
+	}
+	ours, err := h.ChangedTables(base, parents[0])
+	if err != nil {
+		return err
+	}
+	theirs, err := h.ChangedTables(base, approved)
+	if err != nil {
+		return err
+	}
+	sides := []struct {
+		parent  string
+		changed []string
+	}{{parents[0], theirs}, {approved, ours}}
+	for _, side := range sides {
+		merged, err := h.ChangedTables(side.parent, commit)
+		if err != nil {
+			return err
+		}
+		for _, table := range merged {
+			if !contains(side.changed, table) {
+				return fmt.Errorf("merge commit '%s' changes table '%s', which the merged commits didn't change", commit, table)
+			}
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
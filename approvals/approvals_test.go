@@ -0,0 +1,181 @@
+package approvals
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/nustiueudinastea/doltswarmdemo/branchpolicy"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type testPeer struct {
+	key crypto.PrivKey
+	id  string
+}
+
+func newTestPeer(t *testing.T) testPeer {
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testPeer{key: key, id: id.String()}
+}
+
+func (p testPeer) approve(t *testing.T, commit string, author string) Approval {
+	a, err := Sign(p.key, "staging", commit, author, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestApprovals(t *testing.T) {
+	alice, bob, carol, mallory := newTestPeer(t), newTestPeer(t), newTestPeer(t), newTestPeer(t)
+	policies := branchpolicy.Policies{"staging": {Mode: branchpolicy.Approval, MergeInto: "main", Approvers: []string{alice.id, bob.id, carol.id}, Required: 2}}
+	policy := policies["staging"]
+
+	fromBob := bob.approve(t, "c1", alice.id)
+	if err := fromBob.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	tampered := fromBob
+	tampered.Commit = "c2"
+	if tampered.Verify() == nil {
+		t.Error("expected the signature to cover the commit")
+	}
+
+	// the author, other peers, duplicates and other commits don't count
+	approvals := []Approval{
+		alice.approve(t, "c1", alice.id),
+		mallory.approve(t, "c1", alice.id),
+		fromBob,
+		bob.approve(t, "c1", alice.id),
+		carol.approve(t, "c2", alice.id),
+	}
+	if counted := Counted(policy, "staging", "c1", alice.id, approvals); len(counted) != 1 {
+		t.Errorf("expected 1 counted approval, got %d", len(counted))
+	}
+	approvals = append(approvals, carol.approve(t, "c1", alice.id))
+	counted := Counted(policy, "staging", "c1", alice.id, approvals)
+	if len(counted) != 2 {
+		t.Fatalf("expected 2 counted approvals, got %d", len(counted))
+	}
+
+	// replicas check the approvals carried by the merge commit
+	msg := Annotate("Merge approved commit c1 from staging", counted)
+	if err := CheckMerge(policies, "main", msg); err != nil {
+		t.Errorf("expected the merge to be approved, got %v", err)
+	}
+	if err := CheckMerge(policies, "main", Annotate("Merge", counted[:1])); err == nil {
+		t.Error("expected a merge with too few approvals to be refused")
+	}
+	if err := CheckMerge(policies, "release", msg); err == nil {
+		t.Error("expected the approvals to only apply to the target branch")
+	}
+	if err := CheckMerge(policies, "main", "Direct commit"); !errors.Is(err, ErrNotApproved) {
+		t.Errorf("expected a commit without approvals to be refused, got %v", err)
+	}
+}
+
+func TestStoreAndServer(t *testing.T) {
+	alice, bob, mallory := newTestPeer(t), newTestPeer(t), newTestPeer(t)
+	policies := branchpolicy.Policies{"staging": {Mode: branchpolicy.Approval, MergeInto: "main", Approvers: []string{alice.id, bob.id}, Required: 1}}
+	path := filepath.Join(t.TempDir(), "approvals.json")
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	approved := []Pending{}
+	srv := &Server{Store: store, Policies: policies, Approved: func(p Pending) { approved = append(approved, p) }}
+	ctx := context.Background()
+
+	for _, a := range []Approval{mallory.approve(t, "c1", alice.id), alice.approve(t, "c1", alice.id)} {
+		if _, err := srv.SubmitApproval(ctx, a.Proto()); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("expected the approval of %s to be denied, got %v", a.Approver, err)
+		}
+	}
+
+	// approvals can arrive before the commit
+	res, err := srv.SubmitApproval(ctx, bob.approve(t, "c1", alice.id).Proto())
+	if err != nil || res.Approvals != 1 || len(approved) != 1 || approved[0].Synced {
+		t.Fatalf("unexpected response %v (%v), approved %+v", res, err, approved)
+	}
+	if _, err := srv.SubmitApproval(ctx, bob.approve(t, "c1", alice.id).Proto()); err != nil || len(approved) != 1 {
+		t.Errorf("expected a repeated approval to be ignored, got %v", err)
+	}
+	pending, err := store.Propose("staging", "c1", alice.id, "Add rows")
+	if err != nil || !pending.Synced || len(pending.Approvals) != 1 {
+		t.Fatalf("unexpected pending commit %+v (%v)", pending, err)
+	}
+	if err := store.SetMerged("c1"); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.List(false)) != 0 || len(reloaded.List(true)) != 1 || reloaded.Waiting() != 0 {
+		t.Errorf("unexpected reloaded approvals %+v", reloaded.List(true))
+	}
+}
+
+type testHistory struct {
+	parents map[string][]string
+	changed map[string][]string
+}
+
+func (h testHistory) Parents(commit string) ([]string, error) {
+	return h.parents[commit], nil
+}
+
+func (h testHistory) MergeBase(a string, b string) (string, error) {
+	return "base", nil
+}
+
+func (h testHistory) ChangedTables(from string, to string) ([]string, error) {
+	return h.changed[from+".."+to], nil
+}
+
+func TestCheckMergeCommit(t *testing.T) {
+	h := testHistory{
+		parents: map[string][]string{
+			"merge":  {"main", "approved"},
+			"other":  {"main", "unapproved"},
+			"single": {"approved"},
+		},
+		changed: map[string][]string{
+			"base..main":       {"a"},
+			"base..approved":   {"b"},
+			"main..merge":      {"b"},
+			"approved..merge":  {"a"},
+			"main..tampered":   {"b", "c"},
+			"approved..single": {},
+		},
+	}
+	if err := CheckMergeCommit(h, "merge", "approved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckMergeCommit(h, "other", "approved"); err == nil {
+		t.Fatal("expected the approvals of another commit to be refused")
+	}
+	if err := CheckMergeCommit(h, "single", "approved"); err == nil {
+		t.Fatal("expected a commit that isn't a merge to be refused")
+	}
+
+	h.parents["tampered"] = []string{"main", "approved"}
+	if err := CheckMergeCommit(h, "tampered", "approved"); err == nil {
+		t.Fatal("expected a merge changing other tables to be refused")
+	}
+}
@@ -0,0 +1,75 @@
+package approvals
+
+import (
+	"context"
+
+	"github.com/nustiueudinastea/doltswarmdemo/branchpolicy"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ p2pproto.ApprovalsServer = (*Server)(nil)
+
+// Server implements the Approvals gRPC service, which receives the approvals
+// signed by the peers
+type Server struct {
+	Store    *Store
+	Policies branchpolicy.Policies
+	// Approved is optional. It is called with the commits that got a new
+	// approval
+	Approved func(Pending)
+}
+
+// Check returns an error if the approval doesn't count for the policy of its
+// branch
+func Check(policies branchpolicy.Policies, a Approval) error {
+	policy, found := policies[a.Branch]
+	if !found || policy.Mode != branchpolicy.Approval {
+		return status.Errorf(codes.InvalidArgument, "'%s' is not an approval branch", a.Branch)
+	}
+	if !policy.IsApprover(a.Approver) {
+		return status.Errorf(codes.PermissionDenied, "peer '%s' is not an approver of branch '%s'", a.Approver, a.Branch)
+	}
+	if a.Approver == a.Author {
+		return status.Errorf(codes.PermissionDenied, "peer '%s' can't approve its own commit", a.Approver)
+	}
+	if err := a.Verify(); err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return nil
+}
+
+func (s *Server) SubmitApproval(ctx context.Context, req *p2pproto.CommitApproval) (*p2pproto.SubmitApprovalResponse, error) {
+	a := FromProto(req)
+	if err := Check(s.Policies, a); err != nil {
+		return nil, err
+	}
+	pending, added, err := s.Store.Add(a)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if added && s.Approved != nil {
+		s.Approved(pending)
+	}
+	counted := Counted(s.Policies[a.Branch], a.Branch, a.Commit, a.Author, pending.Approvals)
+	return &p2pproto.SubmitApprovalResponse{Approvals: int32(len(counted))}, nil
+}
+
+// Proto converts a commit waiting for approval, with the settings of the
+// policy of its branch
+func (p Pending) Proto(policy branchpolicy.Policy) *p2pproto.PendingApproval {
+	res := &p2pproto.PendingApproval{
+		Branch:    p.Branch,
+		Commit:    p.Commit,
+		Author:    p.Author,
+		MergeInto: policy.MergeInto,
+		Message:   p.Message,
+		Required:  int32(policy.Required),
+		Merged:    p.Merged,
+	}
+	for _, a := range p.Approvals {
+		res.Approvals = append(res.Approvals, a.Proto())
+	}
+	return res
+}
@@ -0,0 +1,168 @@
+package approvals
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Pending is a commit of an approval branch and the approvals received for it
+type Pending struct {
+	Branch string `json:"branch"`
+	Commit string `json:"commit"`
+	Author string `json:"author"`
+	// Message is the message of the commit. It's only known once the commit
+	// was synced, since approvals can arrive before the commit they approve.
+	Message   string     `json:"message,omitempty"`
+	Synced    bool       `json:"synced"`
+	Time      time.Time  `json:"time"`
+	Approvals []Approval `json:"approvals"`
+	Merged    bool       `json:"merged"`
+}
+
+// Store is a file backed set of the commits of the approval branches
+type Store struct {
+	mtx     sync.Mutex
+	path    string
+	pending map[string]Pending
+}
+
+// NewStore loads the approvals stored at path, creating them if needed
+func NewStore(path string) (*Store, error) {
+	s := &Store{
+		path:    path,
+		pending: map[string]Pending{},
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("failed to read approvals: %w", err)
+	}
+
+	pending := []Pending{}
+	err = json.Unmarshal(data, &pending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse approvals '%s': %w", path, err)
+	}
+	for _, p := range pending {
+		s.pending[p.Commit] = p
+	}
+	return s, nil
+}
+
+// Propose records a commit synced on an approval branch, keeping the
+// approvals received before it. The author is the signer of the commit, and
+// replaces the author claimed by the approvals received before it, which
+// don't count if they disagree.
+func (s *Store) Propose(branch string, commit string, author string, msg string) (Pending, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	p, found := s.pending[commit]
+	if !found {
+		p = Pending{Branch: branch, Commit: commit, Time: time.Now().UTC()}
+	}
+	p.Author = author
+	p.Message = msg
+	p.Synced = true
+	s.pending[commit] = p
+	return p, s.save()
+}
+
+// Add records an approval and returns the commit it approves. The approval is
+// only added if the approver didn't approve the commit yet.
+func (s *Store) Add(a Approval) (Pending, bool, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	p, found := s.pending[a.Commit]
+	if !found {
+		p = Pending{Branch: a.Branch, Commit: a.Commit, Author: a.Author, Time: time.Now().UTC()}
+	}
+	for _, existing := range p.Approvals {
+		if existing.Approver == a.Approver && existing.Branch == a.Branch && existing.Author == a.Author {
+			return p, false, nil
+		}
+	}
+	p.Approvals = append(p.Approvals, a)
+	s.pending[a.Commit] = p
+	return p, true, s.save()
+}
+
+// SetMerged marks a commit as merged into its target branch
+func (s *Store) SetMerged(commit string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	p, found := s.pending[commit]
+	if !found {
+		return fmt.Errorf("no pending approval for commit '%s'", commit)
+	}
+	p.Merged = true
+	s.pending[commit] = p
+	return s.save()
+}
+
+// Get returns the approvals of a commit
+func (s *Store) Get(commit string) (Pending, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	p, found := s.pending[commit]
+	return p, found
+}
+
+// List returns the commits waiting for approval, oldest first, and the merged
+// ones too if merged is true
+func (s *Store) List(merged bool) []Pending {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	pending := make([]Pending, 0, len(s.pending))
+	for _, p := range s.pending {
+		if merged || !p.Merged {
+			pending = append(pending, p)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Time.Before(pending[j].Time)
+	})
+	return pending
+}
+
+// Waiting returns the number of commits waiting for approval
+func (s *Store) Waiting() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	waiting := 0
+	for _, p := range s.pending {
+		if p.Synced && !p.Merged {
+			waiting++
+		}
+	}
+	return waiting
+}
+
+// save writes the approvals to disk. The caller must hold the lock.
+func (s *Store) save() error {
+	pending := make([]Pending, 0, len(s.pending))
+	for _, p := range s.pending {
+		pending = append(pending, p)
+	}
+	data, err := json.MarshalIndent(pending, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode approvals: %w", err)
+	}
+
+	tmpFile := s.path + ".tmp"
+	err = os.WriteFile(tmpFile, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write approvals: %w", err)
+	}
+	return os.Rename(tmpFile, s.path)
+}
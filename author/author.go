@@ -0,0 +1,70 @@
+package author
+
+import (
+	"fmt"
+	"net/mail"
+
+	"github.com/nustiueudinastea/doltswarmdemo/trailer"
+)
+
+const (
+	authorKey = "Author"
+	peerKey   = "Peer-ID"
+)
+
+// Author identifies the person or service that made a change
+type Author struct {
+	Name  string
+	Email string
+}
+
+func (a Author) String() string {
+	return fmt.Sprintf("%s <%s>", a.Name, a.Email)
+}
+
+// IsZero returns true if the author is not set
+func (a Author) IsZero() bool {
+	return a.Name == "" && a.Email == ""
+}
+
+// Parse parses an author in the "Name <email>" format
+func Parse(s string) (Author, error) {
+	addr, err := mail.ParseAddress(s)
+	if err != nil {
+		return Author{}, fmt.Errorf("invalid author '%s', expected 'Name <email>': %w", s, err)
+	}
+	if addr.Name == "" {
+		return Author{}, fmt.Errorf("invalid author '%s': missing name", s)
+	}
+	return Author{Name: addr.Name, Email: addr.Address}, nil
+}
+
+// Annotate adds the author to a commit message as a trailer line
+func Annotate(msg string, a Author) string {
+	return trailer.Append(msg, authorKey, a.String())
+}
+
+// AnnotatePeer adds the ID of the peer that created the commit to a commit
+// message as a trailer line
+func AnnotatePeer(msg string, peerID string) string {
+	return trailer.Append(msg, peerKey, peerID)
+}
+
+// FromMessage extracts the author from a commit message. It returns false if
+// the message has no author attached.
+func FromMessage(msg string) (Author, bool) {
+	value, found := trailer.Get(msg, authorKey)
+	if !found {
+		return Author{}, false
+	}
+	a, err := Parse(value)
+	if err != nil {
+		return Author{}, false
+	}
+	return a, true
+}
+
+// PeerFromMessage extracts the ID of the peer that created a commit
+func PeerFromMessage(msg string) (string, bool) {
+	return trailer.Get(msg, peerKey)
+}
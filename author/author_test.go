@@ -0,0 +1,33 @@
+package author
+
+import "testing"
+
+func TestAnnotate(t *testing.T) {
+	a, err := Parse("Jane Doe <jane@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := AnnotatePeer(Annotate("Insert rows", a), "12D3KooW")
+	expected := "Insert rows\n\nAuthor: Jane Doe <jane@example.com>\nPeer-ID: 12D3KooW"
+	if msg != expected {
+		t.Fatalf("expected %q, got %q", expected, msg)
+	}
+
+	parsed, found := FromMessage(msg)
+	if !found || parsed != a {
+		t.Errorf("expected author %v, got %v", a, parsed)
+	}
+	peerID, found := PeerFromMessage(msg)
+	if !found || peerID != "12D3KooW" {
+		t.Errorf("expected peer 12D3KooW, got %q", peerID)
+	}
+}
+
+func TestParseRejectsInvalidAuthors(t *testing.T) {
+	for _, s := range []string{"", "jane@example.com", "Jane Doe"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("expected '%s' to be rejected", s)
+		}
+	}
+}
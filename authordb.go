@@ -0,0 +1,30 @@
+package main
+
+import (
+	"github.com/nustiueudinastea/doltswarmdemo/author"
+	p2psrv "github.com/nustiueudinastea/doltswarmdemo/p2p/server"
+)
+
+// authorDB wraps an ExternalDB and records who made every commit: the author,
+// unless one was already set for the change, and the ID of the committing peer.
+type authorDB struct {
+	p2psrv.ExternalDB
+
+	author author.Author
+	peerID string
+}
+
+func newAuthorDB(db p2psrv.ExternalDB, a author.Author, peerID string) *authorDB {
+	return &authorDB{
+		ExternalDB: db,
+		author:     a,
+		peerID:     peerID,
+	}
+}
+
+func (db *authorDB) ExecAndCommit(query string, commitMsg string) (string, error) {
+	if _, found := author.FromMessage(commitMsg); !found && !db.author.IsZero() {
+		commitMsg = author.Annotate(commitMsg, db.author)
+	}
+	return db.ExternalDB.ExecAndCommit(query, author.AnnotatePeer(commitMsg, db.peerID))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+)
+
+const banListFile = "banlist.json"
+
+func loadBanList() (*p2p.BanList, error) {
+	err := ensureDir(workDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create working directory: %v", err)
+	}
+	return p2p.NewBanList(workDir + "/" + banListFile)
+}
+
+// banPeer adds a peer to the ban list of the working directory. A running
+// server picks up the change and disconnects the peer.
+func banPeer(id string, reason string, duration time.Duration) error {
+	bans, err := loadBanList()
+	if err != nil {
+		return err
+	}
+	entry, err := bans.Ban(id, reason, duration)
+	if err != nil {
+		return err
+	}
+	if entry.Until.IsZero() {
+		fmt.Printf("Banned peer %s permanently\n", id)
+	} else {
+		fmt.Printf("Banned peer %s until %s\n", id, entry.Until.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// unbanPeer removes a peer from the ban list of the working directory
+func unbanPeer(id string) error {
+	bans, err := loadBanList()
+	if err != nil {
+		return err
+	}
+	found, err := bans.Unban(id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("peer %s is not banned", id)
+	}
+	fmt.Printf("Unbanned peer %s\n", id)
+	return nil
+}
+
+func printBans() error {
+	bans, err := loadBanList()
+	if err != nil {
+		return err
+	}
+	for _, entry := range bans.Entries() {
+		until := "permanent"
+		if !entry.Until.IsZero() {
+			until = "until " + entry.Until.Format(time.RFC3339)
+		}
+		fmt.Printf("%s since=%s %s %s\n", entry.ID, entry.Since.Format(time.RFC3339), until, entry.Reason)
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package batch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/sqlstmt"
+)
+
+const (
+	defaultMaxStatements = 100
+	defaultMaxDelay      = 10 * time.Second
+	// DefaultTemplate is used to render the commit message of a batch
+	DefaultTemplate = `Batch of {{.Rows}} rows into {{join .Tables ", "}} at {{.Timestamp.Format "2006-01-02T15:04:05Z07:00"}}`
+)
+
+// CommitFunc executes the statements and commits them with the given message,
+// returning the commit hash
+type CommitFunc func(query string, commitMsg string) (string, error)
+
+// Summary describes a batch and is passed to the commit message template
+type Summary struct {
+	Statements int
+	Rows       int
+	Tables     []string
+	Timestamp  time.Time
+}
+
+// Option configures a Writer
+type Option func(w *Writer) error
+
+// WithMaxStatements flushes the batch once it holds n statements
+func WithMaxStatements(n int) Option {
+	return func(w *Writer) error {
+		if n < 1 {
+			return fmt.Errorf("invalid batch size %d", n)
+		}
+		w.maxStatements = n
+		return nil
+	}
+}
+
+// WithMaxDelay flushes the batch once its oldest statement is older than d
+func WithMaxDelay(d time.Duration) Option {
+	return func(w *Writer) error {
+		if d <= 0 {
+			return fmt.Errorf("invalid batch delay %s", d)
+		}
+		w.maxDelay = d
+		return nil
+	}
+}
+
+// WithTemplate sets the commit message template. The template is executed with
+// a Summary and can use the join function.
+func WithTemplate(text string) Option {
+	return func(w *Writer) error {
+		tmpl, err := parseTemplate(text)
+		if err != nil {
+			return err
+		}
+		w.tmpl = tmpl
+		return nil
+	}
+}
+
+// Writer accumulates write statements and commits them together, either when
+// the size or time threshold is reached or when Flush is called.
+type Writer struct {
+	commit        CommitFunc
+	tmpl          *template.Template
+	maxStatements int
+	maxDelay      time.Duration
+
+	mtx     sync.Mutex
+	pending []string
+	rows    int
+	tables  map[string]bool
+	timer   *time.Timer
+	err     error
+}
+
+// NewWriter creates a batch writer that commits using the provided function
+func NewWriter(commit CommitFunc, opts ...Option) (*Writer, error) {
+	tmpl, err := parseTemplate(DefaultTemplate)
+	if err != nil {
+		return nil, err
+	}
+	w := &Writer{
+		commit:        commit,
+		tmpl:          tmpl,
+		maxStatements: defaultMaxStatements,
+		maxDelay:      defaultMaxDelay,
+		tables:        map[string]bool{},
+	}
+	for _, opt := range opts {
+		if err := opt(w); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// Add appends a statement to the batch. If the batch is full it is flushed
+// before returning. Errors of previous time based flushes are returned here.
+func (w *Writer) Add(statement string) error {
+	statement = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(statement), ";"))
+	if statement == "" {
+		return nil
+	}
+
+	// a statement that can't be parsed would fail the whole batch
+	_, writes, err := sqlstmt.Access(statement)
+	if err != nil {
+		return fmt.Errorf("failed to parse statement: %w", err)
+	}
+
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if w.err != nil {
+		err := w.err
+		w.err = nil
+		return err
+	}
+
+	w.pending = append(w.pending, statement)
+	w.rows += sqlstmt.CountRows(statement)
+	for _, table := range writes {
+		w.tables[table] = true
+	}
+
+	if len(w.pending) >= w.maxStatements {
+		_, err := w.flush()
+		return err
+	}
+	if w.timer == nil {
+		w.timer = time.AfterFunc(w.maxDelay, w.timedFlush)
+	}
+	return nil
+}
+
+// Flush commits all the pending statements and returns the commit hash. An
+// empty hash is returned if there was nothing to commit.
+func (w *Writer) Flush() (string, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	hash, err := w.flush()
+	if w.err != nil {
+		err = errors.Join(w.err, err)
+		w.err = nil
+	}
+	return hash, err
+}
+
+// Close flushes the pending statements and stops the writer
+func (w *Writer) Close() error {
+	_, err := w.Flush()
+	return err
+}
+
+func (w *Writer) timedFlush() {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if _, err := w.flush(); err != nil {
+		w.err = errors.Join(w.err, err)
+	}
+}
+
+// flush commits the pending statements. The caller must hold the lock. The
+// statements are discarded even if the commit fails.
+func (w *Writer) flush() (string, error) {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	if len(w.pending) == 0 {
+		return "", nil
+	}
+
+	summary := Summary{
+		Statements: len(w.pending),
+		Rows:       w.rows,
+		Timestamp:  time.Now().UTC(),
+	}
+	for table := range w.tables {
+		summary.Tables = append(summary.Tables, table)
+	}
+	sort.Strings(summary.Tables)
+	query := strings.Join(w.pending, ";\n") + ";"
+
+	w.pending = nil
+	w.rows = 0
+	w.tables = map[string]bool{}
+
+	var msg bytes.Buffer
+	if err := w.tmpl.Execute(&msg, summary); err != nil {
+		return "", fmt.Errorf("failed to render commit message: %w", err)
+	}
+
+	hash, err := w.commit(query, msg.String())
+	if err != nil {
+		return "", fmt.Errorf("failed to commit batch of %d statements: %w", summary.Statements, err)
+	}
+	return hash, nil
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("commit").Funcs(template.FuncMap{"join": strings.Join}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid commit message template: %w", err)
+	}
+	return tmpl, nil
+}
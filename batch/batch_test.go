@@ -0,0 +1,74 @@
+package batch
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriterFlushesOnSize(t *testing.T) {
+	var queries, msgs []string
+	commit := func(query string, msg string) (string, error) {
+		queries = append(queries, query)
+		msgs = append(msgs, msg)
+		return fmt.Sprintf("hash%d", len(queries)), nil
+	}
+
+	w, err := NewWriter(commit, WithMaxStatements(2), WithMaxDelay(time.Hour), WithTemplate("{{.Statements}} statements, {{.Rows}} rows in {{join .Tables \",\"}}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Add("INSERT INTO b VALUES (1), (2);"); err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 0 {
+		t.Fatalf("expected no commit before the batch is full")
+	}
+	if err := w.Add("INSERT INTO"); err == nil {
+		t.Fatal("expected a statement that can't be parsed to be refused")
+	}
+	if err := w.Add("/* a */ INSERT INTO db.A VALUES (3)"); err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 1 {
+		t.Fatalf("expected one commit, got %d", len(queries))
+	}
+	if queries[0] != "INSERT INTO b VALUES (1), (2);\n/* a */ INSERT INTO db.A VALUES (3);" {
+		t.Errorf("unexpected query %q", queries[0])
+	}
+	if msgs[0] != "2 statements, 3 rows in a,b" {
+		t.Errorf("unexpected commit message %q", msgs[0])
+	}
+
+	hash, err := w.Flush()
+	if err != nil || hash != "" {
+		t.Errorf("expected empty flush, got %q, %v", hash, err)
+	}
+}
+
+func TestWriterFlushesOnDelay(t *testing.T) {
+	committed := make(chan string, 1)
+	commit := func(query string, msg string) (string, error) {
+		committed <- query
+		return "hash", nil
+	}
+
+	w, err := NewWriter(commit, WithMaxDelay(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add("DELETE FROM t WHERE id = 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case query := <-committed:
+		if !strings.HasPrefix(query, "DELETE FROM t") {
+			t.Errorf("unexpected query %q", query)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("batch was not flushed after the delay")
+	}
+}
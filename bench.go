@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/bench"
+	"github.com/nustiueudinastea/doltswarmdemo/client"
+)
+
+// benchStartTimeout is how long the nodes of a throwaway cluster have to
+// become reachable
+const benchStartTimeout = 2 * time.Minute
+
+// benchConfig configures the bench command
+type benchConfig struct {
+	Workload bench.Config
+	// Addrs are the nodes of an existing cluster. A throwaway cluster of
+	// Nodes nodes is started when there are none.
+	Addrs    []string
+	Nodes    int
+	BasePort int
+	Output   string
+	Keep     bool
+	// Profile is the tuning profile of the nodes of the throwaway cluster
+	Profile string
+}
+
+// benchTarget runs the benchmark operations on a node through the client
+type benchTarget struct {
+	name string
+	peer *client.Peer
+}
+
+func (t *benchTarget) Name() string {
+	return t.name
+}
+
+func (t *benchTarget) Exec(ctx context.Context, statement string, msg string) (string, error) {
+	res, err := t.peer.Exec(ctx, statement, client.ExecOptions{Message: msg})
+	if err != nil {
+		return "", err
+	}
+	return res.Commit, nil
+}
+
+func (t *benchTarget) Query(ctx context.Context, statement string) error {
+	_, err := t.peer.Query(ctx, statement, client.QueryOptions{})
+	return err
+}
+
+func (t *benchTarget) WaitForCommit(ctx context.Context, commit string) (bool, error) {
+	return t.peer.WaitForCommit(ctx, commit)
+}
+
+// runBench runs the workload against the given nodes, or a throwaway cluster,
+// and prints the report. The JSON report is also written to the output file,
+// if any.
+func runBench(cfg benchConfig) error {
+	if err := cfg.Workload.Validate(); err != nil {
+		return err
+	}
+
+	targets := []bench.Target{}
+	var st *selftest
+	if len(cfg.Addrs) > 0 {
+		c, err := client.New()
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		for _, addr := range cfg.Addrs {
+			peer, err := c.Connect(addr)
+			if err != nil {
+				return fmt.Errorf("failed to connect to %s: %w", addr, err)
+			}
+			targets = append(targets, &benchTarget{name: addr, peer: peer})
+		}
+	} else {
+		if cfg.Nodes < 1 {
+			return fmt.Errorf("the benchmark needs at least 1 node")
+		}
+		binary, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		dir, err := os.MkdirTemp("", "doltswarm-bench-")
+		if err != nil {
+			return err
+		}
+		st = &selftest{
+			cfg:    selftestConfig{Nodes: cfg.Nodes, BasePort: cfg.BasePort, Timeout: benchStartTimeout, Keep: cfg.Keep, Args: []string{"--profile", cfg.Profile}},
+			binary: binary,
+			dir:    dir,
+		}
+		defer st.cleanup()
+		fmt.Printf("Starting %d nodes in %s\n", cfg.Nodes, dir)
+		if err := st.initNodes(); err != nil {
+			return err
+		}
+		if err := st.startNodes(); err != nil {
+			return err
+		}
+		for _, node := range st.nodes {
+			targets = append(targets, &benchTarget{name: node.name, peer: node.peer})
+		}
+	}
+
+	fmt.Printf("Running the workload for %s on %d nodes\n", cfg.Workload.Duration, len(targets))
+	report, err := bench.Run(context.Background(), cfg.Workload, targets, nil)
+	if err != nil {
+		return err
+	}
+	if st != nil {
+		report.Profile = cfg.Profile
+		report.Memory = st.memory()
+	}
+	if err := report.WriteText(os.Stdout); err != nil {
+		return err
+	}
+	if cfg.Output == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(cfg.Output, data, 0644); err != nil {
+		return fmt.Errorf("failed to write the report: %w", err)
+	}
+	fmt.Printf("Report written to %s\n", cfg.Output)
+	return nil
+}
+
+// memory measures the memory footprint of the running nodes of a throwaway
+// cluster. It's read from /proc, so it's only measured on Linux.
+func (st *selftest) memory() []bench.NodeMemory {
+	var res []bench.NodeMemory
+	for _, node := range st.nodes {
+		if node.cmd == nil {
+			continue
+		}
+		m, err := processMemory(node.cmd.Process.Pid)
+		if err != nil {
+			fmt.Printf("Failed to measure the memory of %s: %v\n", node.name, err)
+			continue
+		}
+		m.Node = node.name
+		res = append(res, m)
+	}
+	return res
+}
+
+// processMemory reads the resident and peak resident set sizes of a process
+func processMemory(pid int) (bench.NodeMemory, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return bench.NodeMemory{}, err
+	}
+	m := bench.NodeMemory{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "VmRSS:":
+			m.RSSBytes = kb << 10
+		case "VmHWM:":
+			m.PeakRSSBytes = kb << 10
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,287 @@
+// Package bench runs write and read workloads against a cluster and measures
+// commit latency, convergence time and throughput. The workload only depends
+// on its configuration and seed: the same rows are written on the same nodes
+// in the same order, so that runs can be compared to track regressions.
+package bench
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Target is a node of the cluster under test
+type Target interface {
+	Name() string
+	// Exec commits a write and returns its commit
+	Exec(ctx context.Context, statement string, msg string) (string, error)
+	Query(ctx context.Context, statement string) error
+	// WaitForCommit returns true once the node applied the commit
+	WaitForCommit(ctx context.Context, commit string) (bool, error)
+}
+
+// Config describes a workload
+type Config struct {
+	Duration time.Duration `json:"duration_ns"`
+	// WriteRate is the number of rows written per second, over all the nodes
+	WriteRate float64 `json:"write_rate"`
+	// RowsPerWrite is the number of rows inserted by every write, in a single
+	// commit
+	RowsPerWrite int `json:"rows_per_write"`
+	// ReadRate is the number of reads per second, over all the nodes
+	ReadRate float64 `json:"read_rate"`
+	// PayloadBytes is the size of the payload of every row
+	PayloadBytes int   `json:"payload_bytes"`
+	Seed         int64 `json:"seed"`
+	// Table has an id and a name column, which holds the payload
+	Table string `json:"table"`
+	// ConvergenceTimeout is how long the nodes have to apply a commit before
+	// it counts as not converged
+	ConvergenceTimeout time.Duration `json:"convergence_timeout_ns"`
+	// MaxInFlight bounds the operations running at the same time. The
+	// workload falls behind its schedule when it's reached.
+	MaxInFlight int `json:"max_in_flight"`
+}
+
+// Validate checks that the workload can be generated
+func (cfg Config) Validate() error {
+	switch {
+	case cfg.Duration <= 0:
+		return fmt.Errorf("the benchmark needs a positive duration")
+	case cfg.WriteRate < 0 || cfg.ReadRate < 0:
+		return fmt.Errorf("rates can't be negative")
+	case cfg.WriteRate == 0 && cfg.ReadRate == 0:
+		return fmt.Errorf("the benchmark needs writes or reads")
+	case cfg.RowsPerWrite < 1:
+		return fmt.Errorf("writes need at least 1 row")
+	case cfg.PayloadBytes < 0:
+		return fmt.Errorf("payloads can't be negative")
+	case cfg.Table == "":
+		return fmt.Errorf("the benchmark needs a table")
+	case cfg.ConvergenceTimeout <= 0 || cfg.MaxInFlight < 1:
+		return fmt.Errorf("the benchmark needs a convergence timeout and at least 1 operation in flight")
+	}
+	return nil
+}
+
+// op is an operation of the workload, run on a node at a time from the start
+type op struct {
+	at        time.Duration
+	node      int
+	write     bool
+	rows      int
+	statement string
+}
+
+const payloadChars = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// generate returns the operations of the workload, sorted by time
+func generate(cfg Config, nodes int) []op {
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	ops := []op{}
+
+	written := []string{}
+	if cfg.WriteRate > 0 {
+		interval := time.Duration(float64(time.Second) * float64(cfg.RowsPerWrite) / cfg.WriteRate)
+		for i := 0; time.Duration(i)*interval < cfg.Duration; i++ {
+			values := make([]string, cfg.RowsPerWrite)
+			for j := range values {
+				id := fmt.Sprintf("bench-%d-%d-%d", cfg.Seed, i, j)
+				payload := make([]byte, cfg.PayloadBytes)
+				for k := range payload {
+					payload[k] = payloadChars[rng.Intn(len(payloadChars))]
+				}
+				values[j] = fmt.Sprintf("('%s', '%s')", id, payload)
+				written = append(written, id)
+			}
+			ops = append(ops, op{
+				at:        time.Duration(i) * interval,
+				node:      rng.Intn(nodes),
+				write:     true,
+				rows:      cfg.RowsPerWrite,
+				statement: fmt.Sprintf("INSERT INTO %s (id, name) VALUES %s;", cfg.Table, strings.Join(values, ", ")),
+			})
+		}
+	}
+	if cfg.ReadRate > 0 {
+		interval := time.Duration(float64(time.Second) / cfg.ReadRate)
+		for i := 0; time.Duration(i)*interval < cfg.Duration; i++ {
+			at := time.Duration(i) * interval
+			// reads look up a row written before them, if any
+			statement := fmt.Sprintf("SELECT COUNT(*) FROM %s;", cfg.Table)
+			if cfg.WriteRate > 0 {
+				before := int(float64(at) / float64(time.Second) * cfg.WriteRate)
+				if before > 0 && before <= len(written) {
+					statement = fmt.Sprintf("SELECT id, name FROM %s WHERE id = '%s';", cfg.Table, written[rng.Intn(before)])
+				}
+			}
+			ops = append(ops, op{at: at, node: rng.Intn(nodes), statement: statement})
+		}
+	}
+	sort.SliceStable(ops, func(i, j int) bool {
+		return ops[i].at < ops[j].at
+	})
+	return ops
+}
+
+// recorder collects the measurements of a run
+type recorder struct {
+	mtx          sync.Mutex
+	writes       []time.Duration
+	reads        []time.Duration
+	convergence  []time.Duration
+	rows         int
+	writeErrors  int
+	readErrors   int
+	notConverged int
+	lastError    string
+}
+
+func (r *recorder) fail(err error, write bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if write {
+		r.writeErrors++
+	} else {
+		r.readErrors++
+	}
+	r.lastError = err.Error()
+}
+
+// Run runs the workload against the targets and returns the report. Progress
+// is called every second with the number of operations done so far.
+func Run(ctx context.Context, cfg Config, targets []Target, progress func(done int, total int)) (*Report, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("the benchmark needs at least 1 node")
+	}
+	ops := generate(cfg, len(targets))
+	rec := &recorder{}
+	slots := make(chan struct{}, cfg.MaxInFlight)
+	wg := sync.WaitGroup{}
+	done := 0
+	doneMtx := sync.Mutex{}
+
+	start := time.Now()
+	lastProgress := start
+	for _, o := range ops {
+		select {
+		case <-time.After(time.Until(start.Add(o.at))):
+		case <-ctx.Done():
+			wg.Wait()
+			return nil, ctx.Err()
+		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(o op) {
+			defer func() {
+				<-slots
+				doneMtx.Lock()
+				done++
+				doneMtx.Unlock()
+				wg.Done()
+			}()
+			if o.write {
+				runWrite(ctx, cfg, targets, o, rec)
+			} else {
+				runRead(ctx, targets[o.node], o, rec)
+			}
+		}(o)
+		if progress != nil && time.Since(lastProgress) >= time.Second {
+			lastProgress = time.Now()
+			doneMtx.Lock()
+			progress(done, len(ops))
+			doneMtx.Unlock()
+		}
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	if progress != nil {
+		progress(len(ops), len(ops))
+	}
+
+	report := &Report{
+		Config:       cfg,
+		Nodes:        len(targets),
+		Started:      start,
+		ElapsedMs:    ms(elapsed),
+		Commits:      summarize(rec.writes),
+		Reads:        summarize(rec.reads),
+		Convergence:  summarize(rec.convergence),
+		RowsWritten:  rec.rows,
+		WriteErrors:  rec.writeErrors,
+		ReadErrors:   rec.readErrors,
+		NotConverged: rec.notConverged,
+		LastError:    rec.lastError,
+	}
+	seconds := elapsed.Seconds()
+	report.CommitsPerSec = float64(len(rec.writes)) / seconds
+	report.RowsPerSec = float64(rec.rows) / seconds
+	report.ReadsPerSec = float64(len(rec.reads)) / seconds
+	return report, nil
+}
+
+// runWrite commits a write and waits for every node to apply it
+func runWrite(ctx context.Context, cfg Config, targets []Target, o op, rec *recorder) {
+	started := time.Now()
+	commit, err := targets[o.node].Exec(ctx, o.statement, "bench write")
+	if err != nil {
+		rec.fail(fmt.Errorf("write on %s: %w", targets[o.node].Name(), err), true)
+		return
+	}
+	committed := time.Now()
+	rec.mtx.Lock()
+	rec.writes = append(rec.writes, committed.Sub(started))
+	rec.rows += o.rows
+	rec.mtx.Unlock()
+	if commit == "" {
+		return
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, cfg.ConvergenceTimeout)
+	defer cancel()
+	converged := true
+	wg := sync.WaitGroup{}
+	mtx := sync.Mutex{}
+	for i, target := range targets {
+		if i == o.node {
+			continue
+		}
+		wg.Add(1)
+		go func(target Target) {
+			defer wg.Done()
+			applied, err := target.WaitForCommit(waitCtx, commit)
+			if err != nil || !applied {
+				mtx.Lock()
+				converged = false
+				mtx.Unlock()
+			}
+		}(target)
+	}
+	wg.Wait()
+
+	rec.mtx.Lock()
+	defer rec.mtx.Unlock()
+	if !converged {
+		rec.notConverged++
+		return
+	}
+	rec.convergence = append(rec.convergence, time.Since(committed))
+}
+
+func runRead(ctx context.Context, target Target, o op, rec *recorder) {
+	started := time.Now()
+	if err := target.Query(ctx, o.statement); err != nil {
+		rec.fail(fmt.Errorf("read on %s: %w", target.Name(), err), false)
+		return
+	}
+	rec.mtx.Lock()
+	rec.reads = append(rec.reads, time.Since(started))
+	rec.mtx.Unlock()
+}
@@ -0,0 +1,118 @@
+package bench
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testConfig() Config {
+	return Config{
+		Duration:           200 * time.Millisecond,
+		WriteRate:          100,
+		RowsPerWrite:       2,
+		ReadRate:           50,
+		PayloadBytes:       16,
+		Seed:               7,
+		Table:              "testtable",
+		ConvergenceTimeout: time.Second,
+		MaxInFlight:        8,
+	}
+}
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	cfg := testConfig()
+	ops := generate(cfg, 3)
+	if !reflect.DeepEqual(ops, generate(cfg, 3)) {
+		t.Fatal("expected the same seed to generate the same workload")
+	}
+	writes, reads := 0, 0
+	for _, o := range ops {
+		if o.write {
+			writes++
+		} else {
+			reads++
+		}
+	}
+	// 100 rows/s in writes of 2 rows and 50 reads/s for 200ms
+	if writes != 10 || reads != 10 {
+		t.Errorf("expected 10 writes and 10 reads, got %d and %d", writes, reads)
+	}
+	cfg.Seed = 8
+	if reflect.DeepEqual(ops, generate(cfg, 3)) {
+		t.Error("expected another seed to generate another workload")
+	}
+}
+
+// fakeTarget applies its writes, and the writes of the other fake targets,
+// immediately
+type fakeTarget struct {
+	name    string
+	commits *sync.Map
+	fail    bool
+}
+
+func (f *fakeTarget) Name() string { return f.name }
+
+func (f *fakeTarget) Exec(ctx context.Context, statement string, msg string) (string, error) {
+	if f.fail {
+		return "", errors.New("write refused")
+	}
+	f.commits.Store(statement, true)
+	return statement, nil
+}
+
+func (f *fakeTarget) Query(ctx context.Context, statement string) error { return nil }
+
+func (f *fakeTarget) WaitForCommit(ctx context.Context, commit string) (bool, error) {
+	_, found := f.commits.Load(commit)
+	return found, nil
+}
+
+func TestRun(t *testing.T) {
+	commits := &sync.Map{}
+	targets := []Target{&fakeTarget{name: "a", commits: commits}, &fakeTarget{name: "b", commits: commits}}
+	report, err := Run(context.Background(), testConfig(), targets, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Commits.Count != 10 || report.RowsWritten != 20 || report.Reads.Count != 10 {
+		t.Errorf("unexpected counts %+v", report)
+	}
+	if report.Convergence.Count != 10 || report.NotConverged != 0 {
+		t.Errorf("expected every commit to converge, got %+v", report)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := report.WriteText(buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "convergence") {
+		t.Errorf("unexpected text report %s", buf.String())
+	}
+
+	targets[1].(*fakeTarget).fail = true
+	report, err = Run(context.Background(), testConfig(), targets, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.WriteErrors == 0 || report.LastError == "" {
+		t.Errorf("expected the refused writes to be counted, got %+v", report)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	durations := []time.Duration{}
+	for i := 1; i <= 100; i++ {
+		durations = append(durations, time.Duration(i)*time.Millisecond)
+	}
+	l := summarize(durations)
+	if l.P50Ms != 50 || l.P90Ms != 90 || l.P99Ms != 99 || l.MaxMs != 100 || l.MeanMs != 50.5 {
+		t.Errorf("unexpected latencies %+v", l)
+	}
+}
@@ -0,0 +1,126 @@
+package bench
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Latencies summarizes the durations of a kind of operation, in milliseconds
+type Latencies struct {
+	Count  int     `json:"count"`
+	MeanMs float64 `json:"mean_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P90Ms  float64 `json:"p90_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	MaxMs  float64 `json:"max_ms"`
+}
+
+// Report is the outcome of a run
+type Report struct {
+	Config    Config    `json:"config"`
+	Nodes     int       `json:"nodes"`
+	Started   time.Time `json:"started"`
+	ElapsedMs float64   `json:"elapsed_ms"`
+	// Commits is the latency of the writes, until they are committed
+	Commits Latencies `json:"commits"`
+	Reads   Latencies `json:"reads"`
+	// Convergence is the time between a commit and the moment every other
+	// node applied it
+	Convergence   Latencies `json:"convergence"`
+	RowsWritten   int       `json:"rows_written"`
+	CommitsPerSec float64   `json:"commits_per_sec"`
+	RowsPerSec    float64   `json:"rows_per_sec"`
+	ReadsPerSec   float64   `json:"reads_per_sec"`
+	WriteErrors   int       `json:"write_errors"`
+	ReadErrors    int       `json:"read_errors"`
+	// NotConverged commits were not applied by every node within the
+	// convergence timeout
+	NotConverged int    `json:"not_converged"`
+	LastError    string `json:"last_error,omitempty"`
+	// Profile is the tuning profile of the nodes of a throwaway cluster, and
+	// Memory their memory footprint at the end of the run
+	Profile string       `json:"profile,omitempty"`
+	Memory  []NodeMemory `json:"memory,omitempty"`
+}
+
+// NodeMemory is the memory footprint of a node
+type NodeMemory struct {
+	Node         string `json:"node"`
+	RSSBytes     uint64 `json:"rss_bytes"`
+	PeakRSSBytes uint64 `json:"peak_rss_bytes"`
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// percentile returns the nearest-rank percentile of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p*float64(len(sorted))+0.999999) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+func summarize(durations []time.Duration) Latencies {
+	if len(durations) == 0 {
+		return Latencies{}
+	}
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	return Latencies{
+		Count:  len(sorted),
+		MeanMs: ms(total / time.Duration(len(sorted))),
+		P50Ms:  ms(percentile(sorted, 0.50)),
+		P90Ms:  ms(percentile(sorted, 0.90)),
+		P99Ms:  ms(percentile(sorted, 0.99)),
+		MaxMs:  ms(sorted[len(sorted)-1]),
+	}
+}
+
+// WriteText writes the report in a human readable form
+func (r *Report) WriteText(w io.Writer) error {
+	cfg := r.Config
+	elapsed := time.Duration(r.ElapsedMs * float64(time.Millisecond)).Round(time.Millisecond)
+	_, err := fmt.Fprintf(w, "%d nodes, %s, %.1f rows/s in writes of %d rows, %.1f reads/s, %d byte payloads, seed %d\n\n",
+		r.Nodes, elapsed, cfg.WriteRate, cfg.RowsPerWrite, cfg.ReadRate, cfg.PayloadBytes, cfg.Seed)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%-12s %7s %9s %9s %9s %9s %9s\n", "LATENCY", "COUNT", "MEAN", "P50", "P90", "P99", "MAX")
+	for _, row := range []struct {
+		name string
+		l    Latencies
+	}{{"commit", r.Commits}, {"convergence", r.Convergence}, {"read", r.Reads}} {
+		fmt.Fprintf(w, "%-12s %7d %7.1fms %7.1fms %7.1fms %7.1fms %7.1fms\n", row.name, row.l.Count, row.l.MeanMs, row.l.P50Ms, row.l.P90Ms, row.l.P99Ms, row.l.MaxMs)
+	}
+	fmt.Fprintf(w, "\nThroughput: %.1f commits/s, %.1f rows/s, %.1f reads/s\n", r.CommitsPerSec, r.RowsPerSec, r.ReadsPerSec)
+	_, err = fmt.Fprintf(w, "Errors: %d writes, %d reads, %d commits not converged within %s\n", r.WriteErrors, r.ReadErrors, r.NotConverged, cfg.ConvergenceTimeout)
+	if err == nil && r.LastError != "" {
+		_, err = fmt.Fprintf(w, "Last error: %s\n", r.LastError)
+	}
+	if err != nil || len(r.Memory) == 0 {
+		return err
+	}
+	fmt.Fprintf(w, "\nMemory (%s profile):\n", r.Profile)
+	fmt.Fprintf(w, "%-12s %9s %9s\n", "NODE", "RSS", "PEAK")
+	for _, m := range r.Memory {
+		_, err = fmt.Fprintf(w, "%-12s %7.1fMB %7.1fMB\n", m.Node, float64(m.RSSBytes)/(1<<20), float64(m.PeakRSSBytes)/(1<<20))
+	}
+	return err
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/blobstore"
+	"github.com/nustiueudinastea/doltswarmdemo/feed"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+const (
+	blobsDir = "blobs"
+	// blobSweepInterval is how often archive nodes look for referenced blobs
+	// they don't have, e.g. because no peer had them when they were added
+	blobSweepInterval = 10 * time.Minute
+	blobFetchTimeout  = 10 * time.Minute
+	// blobEvictInterval is how often light nodes evict the blobs above their
+	// cache size
+	blobEvictInterval = 5 * time.Minute
+)
+
+var blobStore *blobstore.Store
+
+// blobCacheBytes is the size of the blobs kept by light nodes. Archive nodes,
+// for which it's 0, keep every blob.
+var blobCacheBytes int64
+var blobRefs = &blobReferences{}
+
+// blobReferences records the blobs in the blobs table, which is created by
+// the first blob added to the cluster
+type blobReferences struct {
+	mtx         sync.Mutex
+	exists      bool
+	consistency p2pproto.Consistency
+	// exec commits to the blobs table, which peers can't write directly
+	exec func(query string, commitMsg string) (string, error)
+}
+
+func (r *blobReferences) setConsistency(consistency p2pproto.Consistency) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.consistency = consistency
+}
+
+func (r *blobReferences) setExec(exec func(query string, commitMsg string) (string, error)) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.exec = exec
+}
+
+// tableExists returns true once the blobs table was created locally or
+// synced from a peer
+func (r *blobReferences) tableExists() (bool, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.exists {
+		return true, nil
+	}
+	rows, err := dbi.Query(fmt.Sprintf("SHOW TABLES LIKE '%s';", blobstore.Table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	r.exists = rows.Next()
+	return r.exists, rows.Err()
+}
+
+func (r *blobReferences) Add(ctx context.Context, info blobstore.Info, name string, contentType string) (string, error) {
+	exists, err := r.tableExists()
+	if err != nil {
+		return "", err
+	}
+	r.mtx.Lock()
+	consistency := r.consistency
+	exec := r.exec
+	r.mtx.Unlock()
+	commit := func(query string, commitMsg string) (string, error) {
+		commit, err := exec(query, commitMsg)
+		if err != nil {
+			return "", err
+		}
+		return commit, p2pmgr.WaitForAcks(ctx, commit, consistency)
+	}
+	if !exists {
+		_, err := commit(blobstore.CreateTable, "Create the blobs table")
+		if err != nil {
+			return "", fmt.Errorf("failed to create the blobs table: %w", err)
+		}
+	}
+	return commit(blobstore.ReferenceStatement(info, name, contentType, time.Now()), fmt.Sprintf("Add blob %s", info.Hash))
+}
+
+func (r *blobReferences) Size(hash string) (int64, bool, error) {
+	exists, err := r.tableExists()
+	if err != nil || !exists {
+		return 0, false, err
+	}
+	var size int64
+	err = dbi.QueryRow(blobstore.SizeStatement(hash)).Scan(&size)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return size, err == nil, err
+}
+
+// blobFetcher fetches blobs from the first peer that has them
+type blobFetcher struct{}
+
+func (blobFetcher) FetchBlob(ctx context.Context, hash string) error {
+	err := fmt.Errorf("no peer has blob %s", hash)
+	for _, client := range p2pmgr.GetClients() {
+		if !client.Supports(p2pproto.Blobs_GetBlob_FullMethodName) {
+			continue
+		}
+		fetchErr := blobstore.Fetch(ctx, client, blobStore, hash)
+		if fetchErr == nil {
+			log.Infof("Fetched blob %s from %s", hash, client.GetID())
+			return nil
+		}
+		err = fmt.Errorf("failed to fetch blob %s from %s: %w", hash, client.GetID(), fetchErr)
+	}
+	return err
+}
+
+func openBlobStore() (*blobstore.Store, error) {
+	return blobstore.Open(filepath.Join(workDir, blobsDir))
+}
+
+// startBlobReplication fetches the blobs referenced in the blobs table as soon
+// as their reference is synced, so that archive nodes keep every blob
+func startBlobReplication() func() error {
+	events, cancel := commitFeed.Subscribe(feed.Filter{Tables: []string{blobstore.Table}})
+	ticker := time.NewTicker(blobSweepInterval)
+	stopSignal := make(chan struct{})
+	crashReporter.Go("blob-replication", func() {
+		fetchMissingBlobs()
+		for {
+			select {
+			case _, ok := <-events:
+				if !ok {
+					return
+				}
+				fetchMissingBlobs()
+			case <-ticker.C:
+				fetchMissingBlobs()
+			case <-stopSignal:
+				return
+			}
+		}
+	})
+	return func() error {
+		cancel()
+		ticker.Stop()
+		close(stopSignal)
+		return nil
+	}
+}
+
+func fetchMissingBlobs() {
+	exists, err := blobRefs.tableExists()
+	if err != nil || !exists {
+		return
+	}
+	rows, err := dbi.Query(blobstore.ListStatement)
+	if err != nil {
+		log.Errorf("Failed to list blobs: %s", err.Error())
+		return
+	}
+	missing := []string{}
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err == nil && !blobStore.Has(hash) {
+			missing = append(missing, hash)
+		}
+	}
+	rows.Close()
+
+	for _, hash := range missing {
+		ctx, cancel := context.WithTimeout(context.Background(), blobFetchTimeout)
+		err := blobFetcher{}.FetchBlob(ctx, hash)
+		cancel()
+		if err != nil {
+			log.Warnf("Blob %s is not replicated yet: %s", hash, err.Error())
+		}
+	}
+}
+
+// startBlobEviction keeps the blobs fetched on read by light nodes under the
+// cache size, evicting the least recently used unpinned blobs first
+func startBlobEviction(maxBytes int64) func() error {
+	ticker := time.NewTicker(blobEvictInterval)
+	stopSignal := make(chan struct{})
+	crashReporter.Go("blob-eviction", func() {
+		for {
+			select {
+			case <-ticker.C:
+				evicted, err := blobStore.Evict(maxBytes)
+				if err != nil {
+					log.Errorf("Failed to evict blobs: %s", err.Error())
+				}
+				if evicted > 0 {
+					log.Infof("Evicted %d blobs", evicted)
+				}
+			case <-stopSignal:
+				return
+			}
+		}
+	})
+	return func() error {
+		ticker.Stop()
+		close(stopSignal)
+		return nil
+	}
+}
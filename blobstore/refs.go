@@ -0,0 +1,42 @@
+package blobstore
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Table references the blobs from SQL. Rows of other tables point to blobs by
+// their hash, and can be joined with it to read their size, name and content
+// type. The table replicates like any other, and nodes fetch the content of
+// the blobs it references from their peers.
+const Table = "doltswarm_blobs"
+
+// CreateTable is the statement creating the blobs table
+var CreateTable = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	hash char(64) PRIMARY KEY,
+	size bigint NOT NULL,
+	name varchar(1024),
+	content_type varchar(255),
+	created_at datetime NOT NULL
+);`, Table)
+
+// ListStatement selects the hashes of all the referenced blobs
+var ListStatement = fmt.Sprintf("SELECT hash FROM %s;", Table)
+
+// SizeStatement returns the statement selecting the size of a referenced blob
+func SizeStatement(hash string) string {
+	return fmt.Sprintf("SELECT size FROM %s WHERE hash = %s;", Table, quote(hash))
+}
+
+// ReferenceStatement returns the statement adding a blob to the blobs table.
+// Blobs that are already referenced keep their row.
+func ReferenceStatement(info Info, name string, contentType string, now time.Time) string {
+	return fmt.Sprintf("INSERT IGNORE INTO %s (hash, size, name, content_type, created_at) VALUES (%s, %d, %s, %s, %s);",
+		Table, quote(info.Hash), info.Size, quote(name), quote(contentType), quote(now.UTC().Format("2006-01-02 15:04:05")))
+}
+
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
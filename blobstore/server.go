@@ -0,0 +1,229 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// chunkSize is the size of the chunks blobs are streamed in
+const chunkSize = 256 << 10
+
+var _ p2pproto.BlobsServer = (*Server)(nil)
+
+// Fetcher stores a blob fetched from the peers of the node
+type Fetcher interface {
+	FetchBlob(ctx context.Context, hash string) error
+}
+
+// References records the blobs in the blobs table
+type References interface {
+	// Add references a new blob and returns the commit adding it
+	Add(ctx context.Context, info Info, name string, contentType string) (string, error)
+	// Size returns the size of a referenced blob, and false if the blob is not
+	// referenced
+	Size(hash string) (int64, bool, error)
+}
+
+// AuthorizeFunc checks a statement against the access rules of the node for
+// the caller of the service. Blob operations are authorized like the
+// statements reading and writing the blobs table.
+type AuthorizeFunc func(ctx context.Context, query string, write bool) error
+
+// Server implements the Blobs gRPC service
+type Server struct {
+	Store *Store
+	Refs  References
+	// Fetcher is optional. Only the local blobs are served if it's not set
+	Fetcher Fetcher
+	// Authorize is optional. All callers are trusted if it's not set
+	Authorize AuthorizeFunc
+}
+
+func (s *Server) authorize(ctx context.Context, write bool) error {
+	if s.Authorize == nil {
+		return nil
+	}
+	if write {
+		return s.Authorize(ctx, ReferenceStatement(Info{}, "", "", time.Time{}), true)
+	}
+	return s.Authorize(ctx, ListStatement, false)
+}
+
+func (s *Server) PutBlob(stream p2pproto.Blobs_PutBlobServer) error {
+	if err := s.authorize(stream.Context(), true); err != nil {
+		return err
+	}
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return status.Error(codes.InvalidArgument, "no blob sent")
+	}
+	if err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := pw.Write(first.Data)
+		for err == nil {
+			var req *p2pproto.PutBlobRequest
+			req, err = stream.Recv()
+			if err == nil {
+				_, err = pw.Write(req.Data)
+			}
+		}
+		if err == io.EOF {
+			err = nil
+		}
+		pw.CloseWithError(err)
+	}()
+	info, err := s.Store.Put(pr)
+	pr.CloseWithError(err)
+	if err != nil {
+		return err
+	}
+
+	res := &p2pproto.BlobInfo{Hash: info.Hash, Size: info.Size, Local: true, Pinned: info.Pinned}
+	_, referenced, err := s.Refs.Size(info.Hash)
+	if err != nil {
+		return err
+	}
+	if !referenced {
+		res.Commit, err = s.Refs.Add(stream.Context(), info, first.Name, first.ContentType)
+		if err != nil {
+			return err
+		}
+	}
+	return stream.SendAndClose(res)
+}
+
+// open returns the content of a blob, fetching it from a peer first if
+// allowed
+func (s *Server) open(ctx context.Context, hash string, fetch bool) (io.ReadCloser, error) {
+	if !ValidHash(hash) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid blob hash '%s'", hash)
+	}
+	f, err := s.Store.Open(hash)
+	if errors.Is(err, ErrNotFound) && fetch && s.Fetcher != nil {
+		if err := s.Fetcher.FetchBlob(ctx, hash); err != nil {
+			return nil, status.Errorf(codes.NotFound, "blob %s is not available: %v", hash, err)
+		}
+		f, err = s.Store.Open(hash)
+	}
+	if errors.Is(err, ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "blob %s not found", hash)
+	}
+	return f, err
+}
+
+func (s *Server) GetBlob(req *p2pproto.GetBlobRequest, stream p2pproto.Blobs_GetBlobServer) error {
+	if err := s.authorize(stream.Context(), false); err != nil {
+		return err
+	}
+	f, err := s.open(stream.Context(), req.Hash, !req.LocalOnly)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if err := stream.Send(&p2pproto.BlobChunk{Data: buf[:n]}); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) StatBlob(ctx context.Context, req *p2pproto.BlobRequest) (*p2pproto.BlobInfo, error) {
+	if err := s.authorize(ctx, false); err != nil {
+		return nil, err
+	}
+	return s.stat(req.Hash)
+}
+
+func (s *Server) stat(hash string) (*p2pproto.BlobInfo, error) {
+	info, err := s.Store.Stat(hash)
+	if err == nil {
+		return &p2pproto.BlobInfo{Hash: hash, Size: info.Size, Local: true, Pinned: info.Pinned}, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	size, referenced, err := s.Refs.Size(hash)
+	if err != nil {
+		return nil, err
+	}
+	if !referenced {
+		return nil, status.Errorf(codes.NotFound, "blob %s not found", hash)
+	}
+	return &p2pproto.BlobInfo{Hash: hash, Size: size, Pinned: s.Store.Pinned(hash)}, nil
+}
+
+func (s *Server) PinBlob(ctx context.Context, req *p2pproto.BlobRequest) (*p2pproto.BlobInfo, error) {
+	if err := s.authorize(ctx, false); err != nil {
+		return nil, err
+	}
+	f, err := s.open(ctx, req.Hash, true)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	if err := s.Store.Pin(req.Hash); err != nil {
+		return nil, err
+	}
+	return s.stat(req.Hash)
+}
+
+func (s *Server) UnpinBlob(ctx context.Context, req *p2pproto.BlobRequest) (*p2pproto.BlobInfo, error) {
+	if err := s.authorize(ctx, false); err != nil {
+		return nil, err
+	}
+	if !ValidHash(req.Hash) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid blob hash '%s'", req.Hash)
+	}
+	if err := s.Store.Unpin(req.Hash); err != nil {
+		return nil, err
+	}
+	return s.stat(req.Hash)
+}
+
+// Fetch copies a blob from a peer into the store, checking its content
+// against its hash
+func Fetch(ctx context.Context, client p2pproto.BlobsClient, store *Store, hash string) error {
+	stream, err := client.GetBlob(ctx, &p2pproto.GetBlobRequest{Hash: hash, LocalOnly: true})
+	if err != nil {
+		return err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		var err error
+		for err == nil {
+			var chunk *p2pproto.BlobChunk
+			chunk, err = stream.Recv()
+			if err == nil {
+				_, err = pw.Write(chunk.Data)
+			}
+		}
+		if err == io.EOF {
+			err = nil
+		}
+		pw.CloseWithError(err)
+	}()
+	_, err = store.PutExpected(pr, hash)
+	pr.CloseWithError(err)
+	return err
+}
@@ -0,0 +1,289 @@
+// Package blobstore keeps files that are too large or awkward for SQL rows in
+// a content-addressed store next to the database. Blobs are named by the
+// SHA-256 of their content, referenced from SQL through the blobs table, and
+// replicated by fetching their content from peers.
+package blobstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+const pinsFile = "pins.json"
+
+var validHash = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ErrNotFound is returned for blobs that are not in the store
+var ErrNotFound = errors.New("blob not found")
+
+// Info describes a blob
+type Info struct {
+	Hash   string `json:"hash"`
+	Size   int64  `json:"size"`
+	Pinned bool   `json:"pinned"`
+}
+
+// ValidHash returns true if the hash can name a blob
+func ValidHash(hash string) bool {
+	return validHash.MatchString(hash)
+}
+
+// Store keeps blobs in a directory, under the first two characters of their
+// hash
+type Store struct {
+	dir string
+
+	mtx  sync.Mutex
+	pins map[string]bool
+}
+
+// Open opens the store in dir, creating it if needed
+func Open(dir string) (*Store, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create blob store: %w", err)
+	}
+	s := &Store{dir: dir, pins: map[string]bool{}}
+	data, err := os.ReadFile(filepath.Join(dir, pinsFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read blob pins: %w", err)
+	}
+	if err == nil {
+		pins := []string{}
+		if err := json.Unmarshal(data, &pins); err != nil {
+			return nil, fmt.Errorf("failed to parse blob pins: %w", err)
+		}
+		for _, hash := range pins {
+			s.pins[hash] = true
+		}
+	}
+	return s, nil
+}
+
+func (s *Store) path(hash string) string {
+	return filepath.Join(s.dir, hash[:2], hash[2:])
+}
+
+// Put stores the content read from r and returns its info. Storing content
+// that is already in the store is a no-op.
+func (s *Store) Put(r io.Reader) (Info, error) {
+	return s.put(r, "")
+}
+
+// PutExpected stores the content read from r, and fails without storing it if
+// its hash is not the expected one, e.g. for content fetched from a peer
+func (s *Store) PutExpected(r io.Reader, hash string) (Info, error) {
+	return s.put(r, hash)
+}
+
+func (s *Store) put(r io.Reader, expected string) (Info, error) {
+	tmp, err := os.CreateTemp(s.dir, "put-*")
+	if err != nil {
+		return Info{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		return Info{}, fmt.Errorf("failed to store blob: %w", err)
+	}
+
+	hash := hex.EncodeToString(h.Sum(nil))
+	if expected != "" && hash != expected {
+		return Info{}, fmt.Errorf("content of blob %s has hash %s", expected, hash)
+	}
+	path := s.path(hash)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return Info{}, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return Info{}, fmt.Errorf("failed to store blob: %w", err)
+	}
+	return Info{Hash: hash, Size: size, Pinned: s.Pinned(hash)}, nil
+}
+
+// Has returns true if the content of the blob is in the store
+func (s *Store) Has(hash string) bool {
+	if !ValidHash(hash) {
+		return false
+	}
+	_, err := os.Stat(s.path(hash))
+	return err == nil
+}
+
+// Stat returns the info of a stored blob
+func (s *Store) Stat(hash string) (Info, error) {
+	if !ValidHash(hash) {
+		return Info{}, ErrNotFound
+	}
+	fi, err := os.Stat(s.path(hash))
+	if os.IsNotExist(err) {
+		return Info{}, ErrNotFound
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Hash: hash, Size: fi.Size(), Pinned: s.Pinned(hash)}, nil
+}
+
+// Open returns the content of a blob. Reading a blob marks it as recently
+// used, so that it's evicted last.
+func (s *Store) Open(hash string) (io.ReadCloser, error) {
+	if !ValidHash(hash) {
+		return nil, ErrNotFound
+	}
+	f, err := os.Open(s.path(hash))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	os.Chtimes(f.Name(), now, now)
+	return f, nil
+}
+
+// Pin keeps a blob from being evicted. Blobs can be pinned before their
+// content is stored.
+func (s *Store) Pin(hash string) error {
+	return s.setPin(hash, true)
+}
+
+// Unpin lets a blob be evicted
+func (s *Store) Unpin(hash string) error {
+	return s.setPin(hash, false)
+}
+
+func (s *Store) setPin(hash string, pinned bool) error {
+	if !ValidHash(hash) {
+		return fmt.Errorf("invalid blob hash '%s'", hash)
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.pins[hash] == pinned {
+		return nil
+	}
+	if pinned {
+		s.pins[hash] = true
+	} else {
+		delete(s.pins, hash)
+	}
+	pins := make([]string, 0, len(s.pins))
+	for h := range s.pins {
+		pins = append(pins, h)
+	}
+	sort.Strings(pins)
+	data, err := json.Marshal(pins)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, pinsFile)
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Pinned returns true if the blob is pinned
+func (s *Store) Pinned(hash string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.pins[hash]
+}
+
+type storedBlob struct {
+	path    string
+	hash    string
+	size    int64
+	lastUse time.Time
+}
+
+func (s *Store) list() ([]storedBlob, error) {
+	blobs := []storedBlob{}
+	dirs, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(s.dir, dir.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			hash := dir.Name() + entry.Name()
+			if !ValidHash(hash) {
+				continue
+			}
+			fi, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			blobs = append(blobs, storedBlob{path: filepath.Join(s.dir, dir.Name(), entry.Name()), hash: hash, size: fi.Size(), lastUse: fi.ModTime()})
+		}
+	}
+	return blobs, nil
+}
+
+// Size returns the number of stored blobs and their total size
+func (s *Store) Size() (count int, bytes int64, err error) {
+	blobs, err := s.list()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, b := range blobs {
+		bytes += b.size
+	}
+	return len(blobs), bytes, nil
+}
+
+// Evict removes the least recently used unpinned blobs until the store holds
+// at most maxBytes, and returns the number of removed blobs. Pinned blobs are
+// kept even if they exceed maxBytes on their own.
+func (s *Store) Evict(maxBytes int64) (int, error) {
+	blobs, err := s.list()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, b := range blobs {
+		total += b.size
+	}
+	sort.Slice(blobs, func(i, j int) bool {
+		return blobs[i].lastUse.Before(blobs[j].lastUse)
+	})
+	evicted := 0
+	for _, b := range blobs {
+		if total <= maxBytes {
+			break
+		}
+		if s.Pinned(b.hash) {
+			continue
+		}
+		if err := os.Remove(b.path); err != nil {
+			return evicted, err
+		}
+		total -= b.size
+		evicted++
+	}
+	return evicted, nil
+}
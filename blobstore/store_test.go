@@ -0,0 +1,105 @@
+package blobstore
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := s.Put(strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Hash != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" || info.Size != 5 {
+		t.Fatalf("unexpected info %+v", info)
+	}
+	if _, err := s.Put(strings.NewReader("hello")); err != nil {
+		t.Fatalf("expected storing the same content again to succeed, got %v", err)
+	}
+	f, err := s.Open(info.Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "hello" {
+		t.Errorf("unexpected content %q", data)
+	}
+	if _, err := s.Open(strings.Repeat("0", 64)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a missing blob to be not found, got %v", err)
+	}
+	if _, err := s.Open("../pins.json"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected an invalid hash to be not found, got %v", err)
+	}
+
+	// fetched content has to match its hash
+	other := strings.Repeat("1", 64)
+	if _, err := s.PutExpected(strings.NewReader("tampered"), other); err == nil {
+		t.Error("expected content with another hash to be refused")
+	}
+	if count, _, _ := s.Size(); count != 1 {
+		t.Errorf("expected the refused content not to be stored, got %d blobs", count)
+	}
+
+	// pins are persisted
+	if err := s.Pin(info.Hash); err != nil {
+		t.Fatal(err)
+	}
+	s, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Pinned(info.Hash) {
+		t.Error("expected the pin to be persisted")
+	}
+}
+
+func TestEvict(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	put := func(content string, lastUse time.Time) Info {
+		info, err := s.Put(strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(s.path(info.Hash), lastUse, lastUse)
+		return info
+	}
+	now := time.Now()
+	pinned := put("pinned", now.Add(-3*time.Hour))
+	old := put("old", now.Add(-2*time.Hour))
+	recent := put("recent", now.Add(-time.Hour))
+	s.Pin(pinned.Hash)
+
+	evicted, err := s.Evict(pinned.Size + recent.Size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if evicted != 1 || s.Has(old.Hash) || !s.Has(recent.Hash) || !s.Has(pinned.Hash) {
+		t.Errorf("expected only the least recently used unpinned blob to be evicted, evicted %d", evicted)
+	}
+	s.Evict(0)
+	if !s.Has(pinned.Hash) || s.Has(recent.Hash) {
+		t.Error("expected pinned blobs to be kept")
+	}
+}
+
+func TestReferenceStatement(t *testing.T) {
+	info := Info{Hash: strings.Repeat("a", 64), Size: 3}
+	statement := ReferenceStatement(info, `it's\here`, "text/plain", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	if !strings.Contains(statement, `'it''s\\here'`) || !strings.Contains(statement, "'2024-01-02 03:04:05'") {
+		t.Errorf("unexpected statement %s", statement)
+	}
+}
@@ -0,0 +1,137 @@
+package branchpolicy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Mode decides what happens with new commits on a branch
+type Mode string
+
+const (
+	// Protected branches only accept commits from their writers. Commits from
+	// other peers are quarantined.
+	Protected Mode = "protected"
+	// AutoMerge branches are merged into their target branch by the peer that
+	// made the commit
+	AutoMerge Mode = "auto-merge"
+	// ManualReview branches queue the commits of other peers for an operator to
+	// approve the merge into the target branch
+	ManualReview Mode = "manual-review"
+	// Approval branches hold the commits of a peer until enough of the
+	// designated approvers, other than the author, signed them. The commit is
+	// then merged into the target branch by the peer that made it.
+	Approval Mode = "approval"
+)
+
+// Policy is the policy of a single branch
+type Policy struct {
+	Mode Mode `json:"mode"`
+	// Writers are the peer IDs allowed to commit to a protected branch
+	Writers []string `json:"writers,omitempty"`
+	// MergeInto is the target branch of auto-merge, manual-review and
+	// approval branches
+	MergeInto string `json:"merge_into,omitempty"`
+	// Approvers are the peer IDs allowed to approve the commits of an
+	// approval branch, and Required is how many of them have to
+	Approvers []string `json:"approvers,omitempty"`
+	Required  int      `json:"required,omitempty"`
+}
+
+// AllowsWriter returns true if the peer may commit to the branch
+func (p Policy) AllowsWriter(peerID string) bool {
+	if p.Mode != Protected {
+		return true
+	}
+	for _, writer := range p.Writers {
+		if writer == peerID {
+			return true
+		}
+	}
+	return false
+}
+
+// IsApprover returns true if the peer may approve the commits of the branch
+func (p Policy) IsApprover(peerID string) bool {
+	if p.Mode != Approval {
+		return false
+	}
+	for _, approver := range p.Approvers {
+		if approver == peerID {
+			return true
+		}
+	}
+	return false
+}
+
+// Policies maps branch names to their policy
+type Policies map[string]Policy
+
+// Load reads the branch policies from a JSON file
+func Load(path string) (Policies, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read branch policies: %w", err)
+	}
+	policies := Policies{}
+	err = json.Unmarshal(data, &policies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse branch policies '%s': %w", path, err)
+	}
+	return policies, policies.Validate()
+}
+
+// Validate checks that every policy has a known mode and the settings it needs
+func (p Policies) Validate() error {
+	for branch, policy := range p {
+		switch policy.Mode {
+		case Protected:
+			if len(policy.Writers) == 0 {
+				return fmt.Errorf("protected branch '%s' has no writers", branch)
+			}
+		case AutoMerge, ManualReview, Approval:
+			if policy.MergeInto == "" {
+				return fmt.Errorf("branch '%s' has no merge_into branch", branch)
+			}
+			if policy.MergeInto == branch {
+				return fmt.Errorf("branch '%s' can't be merged into itself", branch)
+			}
+			if policy.Mode != Approval {
+				continue
+			}
+			if len(policy.Approvers) == 0 {
+				return fmt.Errorf("approval branch '%s' has no approvers", branch)
+			}
+			if policy.Required < 1 || policy.Required > len(policy.Approvers) {
+				return fmt.Errorf("approval branch '%s' requires %d approvals, expected between 1 and %d", branch, policy.Required, len(policy.Approvers))
+			}
+		default:
+			return fmt.Errorf("unknown mode '%s' for branch '%s'", policy.Mode, branch)
+		}
+	}
+	return nil
+}
+
+// Branches returns the names of all the branches with a policy
+func (p Policies) Branches() []string {
+	branches := make([]string, 0, len(p))
+	for branch := range p {
+		branches = append(branches, branch)
+	}
+	sort.Strings(branches)
+	return branches
+}
+
+// ApprovalTargets maps the target branches of the approval branches to the
+// branches merged into them
+func (p Policies) ApprovalTargets() map[string][]string {
+	targets := map[string][]string{}
+	for _, branch := range p.Branches() {
+		if policy := p[branch]; policy.Mode == Approval {
+			targets[policy.MergeInto] = append(targets[policy.MergeInto], branch)
+		}
+	}
+	return targets
+}
@@ -0,0 +1,51 @@
+package branchpolicy
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		policies Policies
+		valid    bool
+	}{
+		{Policies{"main": {Mode: Protected, Writers: []string{"peerA"}}}, true},
+		{Policies{"main": {Mode: Protected}}, false},
+		{Policies{"feature": {Mode: AutoMerge, MergeInto: "main"}}, true},
+		{Policies{"review": {Mode: ManualReview}}, false},
+		{Policies{"main": {Mode: AutoMerge, MergeInto: "main"}}, false},
+		{Policies{"main": {Mode: "other"}}, false},
+		{Policies{"staging": {Mode: Approval, MergeInto: "main", Approvers: []string{"peerA", "peerB"}, Required: 2}}, true},
+		{Policies{"staging": {Mode: Approval, MergeInto: "main", Required: 1}}, false},
+		{Policies{"staging": {Mode: Approval, MergeInto: "main", Approvers: []string{"peerA"}, Required: 2}}, false},
+		{Policies{"staging": {Mode: Approval, MergeInto: "main", Approvers: []string{"peerA"}}}, false},
+	}
+	for i, c := range cases {
+		if err := c.policies.Validate(); (err == nil) != c.valid {
+			t.Errorf("case %d: expected valid=%t, got %v", i, c.valid, err)
+		}
+	}
+}
+
+func TestAllowsWriter(t *testing.T) {
+	protected := Policy{Mode: Protected, Writers: []string{"peerA"}}
+	if !protected.AllowsWriter("peerA") || protected.AllowsWriter("peerB") {
+		t.Error("expected only peerA to write the protected branch")
+	}
+	if !(Policy{Mode: AutoMerge, MergeInto: "main"}).AllowsWriter("peerB") {
+		t.Error("expected everyone to write auto-merge branches")
+	}
+}
+
+func TestApprovalTargets(t *testing.T) {
+	policies := Policies{
+		"staging": {Mode: Approval, MergeInto: "main", Approvers: []string{"peerA"}, Required: 1},
+		"hotfix":  {Mode: Approval, MergeInto: "main", Approvers: []string{"peerA"}, Required: 1},
+		"feature": {Mode: AutoMerge, MergeInto: "main"},
+	}
+	targets := policies.ApprovalTargets()
+	if len(targets) != 1 || len(targets["main"]) != 2 || targets["main"][0] != "hotfix" {
+		t.Errorf("unexpected approval targets %v", targets)
+	}
+	if !policies["staging"].IsApprover("peerA") || policies["feature"].IsApprover("peerA") {
+		t.Error("expected peerA to only approve the commits of the approval branches")
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/nustiueudinastea/doltswarmdemo/branchpolicy"
+	"github.com/nustiueudinastea/doltswarmdemo/feed"
+	"github.com/nustiueudinastea/doltswarmdemo/quarantine"
+)
+
+// startBranchWatcher applies the branch policies to the new commits on the
+// branches that have one, and checks the approvals of the commits on the
+// target branches of the approval branches
+func startBranchWatcher(policies branchpolicy.Policies) func() error {
+	log.Info("Starting branch policy watcher")
+	targets := policies.ApprovalTargets()
+	branches := policies.Branches()
+	for target := range targets {
+		if _, found := policies[target]; !found {
+			branches = append(branches, target)
+		}
+	}
+	events, cancel := commitFeed.Subscribe(feed.Filter{Branches: branches})
+	stopSignal := make(chan struct{})
+	crashReporter.Go("branch-watcher", func() {
+		for {
+			select {
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				if policy, found := policies[ev.Branch]; found {
+					applyBranchPolicy(policy, ev)
+				}
+				if _, found := targets[ev.Branch]; found {
+					checkApprovalTarget(policies, ev)
+				}
+			case <-stopSignal:
+				return
+			}
+		}
+	})
+	return func() error {
+		log.Info("Stopping branch policy watcher")
+		cancel()
+		close(stopSignal)
+		return nil
+	}
+}
+
+// applyBranchPolicy applies the policy of a branch to a new commit. The author
+// of the commit is the peer that signed it, since the Peer-ID trailer can be
+// forged, and commits without a known signer are not allowed.
+func applyBranchPolicy(policy branchpolicy.Policy, ev feed.CommitEvent) {
+	peerID, signed := p2pKey.Signer(ev.Hash)
+	local := signed && peerID == p2pmgr.GetID()
+
+	var err error
+	switch policy.Mode {
+	case branchpolicy.Protected:
+		if local || (signed && policy.AllowsWriter(peerID)) {
+			return
+		}
+		reason := "peer is not a writer of protected branch '" + ev.Branch + "'"
+		if !signed {
+			reason = "commit on protected branch '" + ev.Branch + "' has no verified signer"
+		}
+		_, err = quarantineStore.Add(quarantine.Entry{Peer: peerID, Reason: reason, Commit: ev.Hash, Message: ev.Message, Tables: ev.Tables, Branch: ev.Branch})
+	case branchpolicy.AutoMerge:
+		// every peer merges its own commits, so the same commit isn't merged
+		// by several peers
+		if !local {
+			return
+		}
+		err = mergeCommit(dbi, ev.Hash, policy.MergeInto)
+		if err == nil {
+			log.Infof("Merged commit '%s' from branch '%s' into '%s'", ev.Hash, ev.Branch, policy.MergeInto)
+		}
+	case branchpolicy.ManualReview:
+		if local {
+			return
+		}
+		_, err = quarantineStore.Add(quarantine.Entry{Peer: peerID, Reason: "manual review", Commit: ev.Hash, Message: ev.Message, Tables: ev.Tables, Branch: ev.Branch, MergeInto: policy.MergeInto})
+	case branchpolicy.Approval:
+		err = proposeCommit(ev)
+	}
+	if err != nil {
+		log.Errorf("Failed to apply the policy of branch '%s' to commit '%s': %s", ev.Branch, ev.Hash, err.Error())
+	}
+}
+
+// mergeCommit merges a commit into a branch
+func mergeCommit(beginner txBeginner, commit string, into string) error {
+	return mergeInto(beginner, into, "CALL DOLT_MERGE(?);", commit)
+}
+
+// mergeInto runs a merge procedure on a branch. The checkout and the merge run
+// in the same transaction, since the checkout only applies to the session.
+func mergeInto(beginner txBeginner, into string, merge string, args ...any) error {
+	tx, err := beginner.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("CALL DOLT_CHECKOUT(?);", into)
+	if err == nil {
+		_, err = tx.Exec(merge, args...)
+	}
+	if err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	return tx.Commit()
+}
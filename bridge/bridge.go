@@ -0,0 +1,227 @@
+// Package bridge forwards commits between clusters. A bridge node is a member
+// of the local cluster and forwards the changes made to some tables to a peer
+// of each linked cluster, which commits them there. Commits are tagged with the
+// cluster they originate from, so hub-and-spoke topologies don't loop.
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/cdc"
+	"github.com/nustiueudinastea/doltswarmdemo/commitmeta"
+	"github.com/nustiueudinastea/doltswarmdemo/feed"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// OriginKey is the commit metadata key holding the cluster a forwarded
+	// commit originates from
+	OriginKey = "bridge_origin"
+
+	retryInterval  = 5 * time.Second
+	forwardTimeout = 30 * time.Second
+)
+
+type checkpoint struct {
+	Commit string `json:"commit"`
+}
+
+// Bridge forwards the commits of a link to the remote cluster. The last
+// forwarded commit is checkpointed to disk once the remote cluster committed
+// it, so delivery is at-least-once.
+type Bridge struct {
+	db             feed.Querier
+	feed           *feed.Feed
+	remote         p2pproto.TesterClient
+	log            *logrus.Logger
+	cluster        string
+	link           Link
+	checkpointFile string
+	checkpoint     checkpoint
+}
+
+// New creates a bridge that forwards the commits of the link using the remote
+// client. cluster is the name of the local cluster.
+func New(db feed.Querier, commitFeed *feed.Feed, remote p2pproto.TesterClient, logger *logrus.Logger, cluster string, link Link, checkpointFile string) (*Bridge, error) {
+	b := &Bridge{
+		db:             db,
+		feed:           commitFeed,
+		remote:         remote,
+		log:            logger,
+		cluster:        cluster,
+		link:           link,
+		checkpointFile: checkpointFile,
+	}
+
+	data, err := os.ReadFile(checkpointFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read bridge checkpoint: %w", err)
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &b.checkpoint)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse bridge checkpoint: %w", err)
+		}
+	}
+
+	return b, nil
+}
+
+// Start forwards all the commits made since the last checkpoint and then
+// follows the commit feed. The returned function stops the bridge.
+func (b *Bridge) Start() func() error {
+	events, cancel := b.feed.Subscribe(feed.Filter{Tables: b.link.Tables, Branches: []string{b.link.Branch}})
+	stopSignal := make(chan struct{})
+	go func() {
+		b.log.Infof("Starting bridge to cluster '%s' for tables %v", b.link.Cluster, b.link.Tables)
+		retry := time.NewTicker(retryInterval)
+		defer retry.Stop()
+		for {
+			err := b.forward()
+			if err != nil {
+				b.log.Errorf("Bridge to cluster '%s' failed: %v", b.link.Cluster, err)
+			}
+
+			select {
+			case <-events:
+			case <-retry.C:
+			case <-stopSignal:
+				b.log.Infof("Stopping bridge to cluster '%s'", b.link.Cluster)
+				return
+			}
+		}
+	}()
+	stopper := func() error {
+		stopSignal <- struct{}{}
+		cancel()
+		return nil
+	}
+	return stopper
+}
+
+type pendingCommit struct {
+	hash    string
+	message string
+}
+
+// pendingCommits returns the commits made after the checkpoint, oldest first
+func (b *Bridge) pendingCommits() ([]pendingCommit, error) {
+	rows, err := b.db.Query(fmt.Sprintf("SELECT commit_hash, message FROM dolt_log('%s');", b.link.Branch))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	commits := []pendingCommit{}
+	for rows.Next() {
+		commit := pendingCommit{}
+		err = rows.Scan(&commit.hash, &commit.message)
+		if err != nil {
+			return nil, err
+		}
+		if commit.hash == b.checkpoint.Commit {
+			break
+		}
+		commits = append([]pendingCommit{commit}, commits...)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if b.checkpoint.Commit == "" && len(commits) > 0 {
+		// first run: start forwarding from the current head
+		return nil, b.saveCheckpoint(commits[len(commits)-1].hash)
+	}
+	return commits, nil
+}
+
+func (b *Bridge) forward() error {
+	commits, err := b.pendingCommits()
+	if err != nil {
+		return err
+	}
+
+	for _, commit := range commits {
+		origin := b.cluster
+		if md, found := commitmeta.FromMessage(commit.message); found && md[OriginKey] != "" {
+			origin = md[OriginKey]
+		}
+		if origin != b.link.Cluster {
+			err = b.forwardCommit(commit, origin)
+			if err != nil {
+				return fmt.Errorf("failed to forward commit '%s': %w", commit.hash, err)
+			}
+		}
+		err = b.saveCheckpoint(commit.hash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Bridge) forwardCommit(commit pendingCommit, origin string) error {
+	statements := []string{}
+	for _, table := range b.link.Tables {
+		changes, err := cdc.Changes(b.db, commit.hash, table)
+		if err != nil {
+			if errors.Is(err, cdc.ErrNoDiff) {
+				continue
+			}
+			return err
+		}
+		for _, change := range changes {
+			statement, err := Statement(change)
+			if err != nil {
+				return err
+			}
+			statements = append(statements, statement)
+		}
+	}
+	if len(statements) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), forwardTimeout)
+	defer cancel()
+	resp, err := b.remote.ExecSQL(ctx, &p2pproto.ExecSQLRequest{
+		Statement: strings.Join(statements, ";\n") + ";",
+		Msg:       fmt.Sprintf("Bridged commit %s from cluster %s", commit.hash, b.cluster),
+		Metadata:  commitmeta.Metadata{OriginKey: origin},
+		// a commit forwarded again after a timeout isn't applied twice
+		IdempotencyToken: "bridge-" + b.cluster + "-" + commit.hash,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.Err != "" {
+		return fmt.Errorf("remote commit failed: %s", resp.Err)
+	}
+	b.log.Debugf("Forwarded commit '%s' to cluster '%s' as '%s'", commit.hash, b.link.Cluster, resp.Commit)
+	return nil
+}
+
+func (b *Bridge) saveCheckpoint(commit string) error {
+	data, err := json.Marshal(checkpoint{Commit: commit})
+	if err != nil {
+		return err
+	}
+	tmpFile := b.checkpointFile + ".tmp"
+	err = os.WriteFile(tmpFile, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write bridge checkpoint: %w", err)
+	}
+	err = os.Rename(tmpFile, b.checkpointFile)
+	if err != nil {
+		return fmt.Errorf("failed to write bridge checkpoint: %w", err)
+	}
+	b.checkpoint.Commit = commit
+	return nil
+}
@@ -0,0 +1,72 @@
+package bridge
+
+import (
+	"testing"
+
+	"github.com/nustiueudinastea/doltswarmdemo/cdc"
+)
+
+func TestStatement(t *testing.T) {
+	tests := []struct {
+		change cdc.Change
+		want   string
+	}{
+		{
+			cdc.Change{Table: "t", Op: "insert", After: map[string]any{"id": "1", "name": "it's"}},
+			"REPLACE INTO `t` (`id`, `name`) VALUES ('1', 'it''s')",
+		},
+		{
+			cdc.Change{Table: "t", Op: "update", Before: map[string]any{"id": int64(1), "name": nil}, After: map[string]any{"id": int64(1), "name": "b"}},
+			"UPDATE `t` SET `id` = 1, `name` = 'b' WHERE `id` <=> 1 AND `name` <=> NULL",
+		},
+		{
+			cdc.Change{Table: "t", Op: "delete", Before: map[string]any{"id": "1", "path": `a\b`}},
+			"DELETE FROM `t` WHERE `id` <=> '1' AND `path` <=> 'a\\\\b'",
+		},
+	}
+
+	for _, test := range tests {
+		got, err := Statement(test.change)
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %v", test.change.Op, err)
+		}
+		if got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+
+	invalid := []cdc.Change{
+		{Table: "t;", Op: "insert", After: map[string]any{"id": "1"}},
+		{Table: "t", Op: "insert", After: map[string]any{"id`": "1"}},
+		{Table: "t", Op: "delete"},
+		{Table: "t", Op: "truncate"},
+	}
+	for _, change := range invalid {
+		if _, err := Statement(change); err == nil {
+			t.Errorf("expected an error for %+v", change)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := &Config{Cluster: "a", Links: []Link{{Cluster: "b", Addr: "/ip4/127.0.0.1/udp/1/quic-v1/p2p/x", Tables: []string{"t"}}}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Links[0].Branch != defaultBranch {
+		t.Errorf("expected the default branch, got '%s'", cfg.Links[0].Branch)
+	}
+
+	invalid := []*Config{
+		{Links: []Link{{Cluster: "b", Addr: "addr", Tables: []string{"t"}}}},
+		{Cluster: "a", Links: []Link{{Cluster: "a", Addr: "addr", Tables: []string{"t"}}}},
+		{Cluster: "a", Links: []Link{{Cluster: "b", Tables: []string{"t"}}}},
+		{Cluster: "a", Links: []Link{{Cluster: "b", Addr: "addr"}}},
+		{Cluster: "a", Links: []Link{{Cluster: "b", Addr: "addr", Tables: []string{"t"}}, {Cluster: "b", Addr: "addr", Tables: []string{"t"}}}},
+	}
+	for _, cfg := range invalid {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected an error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+const defaultBranch = "main"
+
+var (
+	validName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	validRef  = regexp.MustCompile(`^[A-Za-z0-9_./-]+$`)
+)
+
+// Link forwards the commits of some tables to another cluster
+type Link struct {
+	// Cluster is the name of the remote cluster
+	Cluster string `json:"cluster"`
+	// Addr is the multiaddr of a peer of the remote cluster, including its
+	// peer ID
+	Addr string `json:"addr"`
+	// Tables whose changes are forwarded
+	Tables []string `json:"tables"`
+	// Branch whose commits are forwarded. Defaults to main. The changes are
+	// always applied to the main branch of the remote cluster.
+	Branch string `json:"branch,omitempty"`
+}
+
+// Config describes the clusters a bridge node forwards commits to
+type Config struct {
+	// Cluster is the name of the local cluster. It is recorded on the
+	// forwarded commits so that they are never sent back.
+	Cluster string `json:"cluster"`
+	Links   []Link `json:"links"`
+}
+
+// LoadConfig reads a bridge configuration from a JSON file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bridge config: %w", err)
+	}
+	cfg := &Config{}
+	err = json.Unmarshal(data, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse bridge config: %w", err)
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate checks the configuration and sets the defaults
+func (cfg *Config) Validate() error {
+	if cfg.Cluster == "" {
+		return fmt.Errorf("bridge config: missing local cluster name")
+	}
+	seen := map[string]bool{}
+	for i := range cfg.Links {
+		link := &cfg.Links[i]
+		if !validName.MatchString(link.Cluster) {
+			return fmt.Errorf("bridge config: invalid cluster name '%s'", link.Cluster)
+		}
+		if link.Cluster == cfg.Cluster {
+			return fmt.Errorf("bridge config: cluster '%s' can't be linked to itself", link.Cluster)
+		}
+		if seen[link.Cluster] {
+			return fmt.Errorf("bridge config: duplicate link to cluster '%s'", link.Cluster)
+		}
+		seen[link.Cluster] = true
+		if link.Addr == "" {
+			return fmt.Errorf("bridge config: missing address of cluster '%s'", link.Cluster)
+		}
+		if len(link.Tables) == 0 {
+			return fmt.Errorf("bridge config: no tables forwarded to cluster '%s'", link.Cluster)
+		}
+		for _, table := range link.Tables {
+			if !validName.MatchString(table) {
+				return fmt.Errorf("bridge config: invalid table name '%s'", table)
+			}
+		}
+		if link.Branch == "" {
+			link.Branch = defaultBranch
+		}
+		if !validRef.MatchString(link.Branch) {
+			return fmt.Errorf("bridge config: invalid branch name '%s'", link.Branch)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package bridge
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/cdc"
+)
+
+// Statement returns the SQL statement that applies a row change. Inserts
+// replace existing rows so that a change can be applied more than once.
+// Updates and deletes match the row on all its previous values, since the
+// primary key is not part of the change record.
+func Statement(change cdc.Change) (string, error) {
+	if !validName.MatchString(change.Table) {
+		return "", fmt.Errorf("invalid table name '%s'", change.Table)
+	}
+
+	switch change.Op {
+	case "insert":
+		columns, err := sortedColumns(change.After)
+		if err != nil {
+			return "", err
+		}
+		if len(columns) == 0 {
+			return "", fmt.Errorf("insert into '%s' has no values", change.Table)
+		}
+		values := make([]string, len(columns))
+		for i, column := range columns {
+			values[i] = literal(change.After[column])
+		}
+		return fmt.Sprintf("REPLACE INTO `%s` (%s) VALUES (%s)", change.Table, quoteColumns(columns), strings.Join(values, ", ")), nil
+	case "update":
+		columns, err := sortedColumns(change.After)
+		if err != nil {
+			return "", err
+		}
+		if len(columns) == 0 {
+			return "", fmt.Errorf("update of '%s' has no values", change.Table)
+		}
+		assignments := make([]string, len(columns))
+		for i, column := range columns {
+			assignments[i] = fmt.Sprintf("`%s` = %s", column, literal(change.After[column]))
+		}
+		where, err := whereClause(change.Before)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("UPDATE `%s` SET %s WHERE %s", change.Table, strings.Join(assignments, ", "), where), nil
+	case "delete":
+		where, err := whereClause(change.Before)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("DELETE FROM `%s` WHERE %s", change.Table, where), nil
+	default:
+		return "", fmt.Errorf("unknown change operation '%s'", change.Op)
+	}
+}
+
+func whereClause(row map[string]any) (string, error) {
+	columns, err := sortedColumns(row)
+	if err != nil {
+		return "", err
+	}
+	if len(columns) == 0 {
+		return "", fmt.Errorf("change has no previous values")
+	}
+	conditions := make([]string, len(columns))
+	for i, column := range columns {
+		conditions[i] = fmt.Sprintf("`%s` <=> %s", column, literal(row[column]))
+	}
+	return strings.Join(conditions, " AND "), nil
+}
+
+func sortedColumns(row map[string]any) ([]string, error) {
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		if !validName.MatchString(column) {
+			return nil, fmt.Errorf("invalid column name '%s'", column)
+		}
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	return columns, nil
+}
+
+func quoteColumns(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = "`" + column + "`"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func literal(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(v)
+	case time.Time:
+		return quote(v.Format("2006-01-02 15:04:05.999999"))
+	case []byte:
+		return quote(string(v))
+	default:
+		return quote(fmt.Sprint(v))
+	}
+}
+
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `''`)
+	return "'" + s + "'"
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/nustiueudinastea/doltswarmdemo/bridge"
+)
+
+// startBridges forwards commits to the clusters linked in the bridge config
+func startBridges(cfg *bridge.Config) error {
+	for _, link := range cfg.Links {
+		remote, closer, err := p2pmgr.DialCluster(link.Addr)
+		if err != nil {
+			return err
+		}
+		b, err := bridge.New(dbi, commitFeed, remote, log, cfg.Cluster, link, workDir+"/bridge-"+link.Cluster+".json")
+		if err != nil {
+			closer()
+			return err
+		}
+		bridgeStopper := b.Start()
+		stoppers.Set("bridge-"+link.Cluster, func() error {
+			bridgeStopper()
+			return closer()
+		})
+	}
+	return nil
+}
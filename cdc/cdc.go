@@ -0,0 +1,270 @@
+package cdc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/feed"
+	"github.com/sirupsen/logrus"
+)
+
+const retryInterval = 5 * time.Second
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// ErrNoDiff is returned when the diff of a table can't be computed for a commit
+var ErrNoDiff = errors.New("no diff")
+
+// Change is a row level change record computed from the dolt diff of a commit
+type Change struct {
+	Commit string         `json:"commit"`
+	Table  string         `json:"table"`
+	Op     string         `json:"op"`
+	Before map[string]any `json:"before,omitempty"`
+	After  map[string]any `json:"after,omitempty"`
+}
+
+type checkpoint struct {
+	Commit string `json:"commit"`
+}
+
+// Exporter publishes the row changes of every new commit touching the
+// configured tables to a sink. The last exported commit is checkpointed to disk
+// after the sink acknowledged all its changes, so delivery is at-least-once.
+type Exporter struct {
+	db             feed.Querier
+	feed           *feed.Feed
+	sink           Sink
+	log            *logrus.Logger
+	tables         []string
+	topicPrefix    string
+	checkpointFile string
+	checkpoint     checkpoint
+}
+
+// NewExporter creates an exporter for the given tables. Topics are named
+// <topicPrefix>.<table>.
+func NewExporter(db feed.Querier, commitFeed *feed.Feed, sink Sink, logger *logrus.Logger, tables []string, topicPrefix string, checkpointFile string) (*Exporter, error) {
+	for _, table := range tables {
+		if !validName.MatchString(table) {
+			return nil, fmt.Errorf("invalid table name '%s'", table)
+		}
+	}
+
+	e := &Exporter{
+		db:             db,
+		feed:           commitFeed,
+		sink:           sink,
+		log:            logger,
+		tables:         tables,
+		topicPrefix:    topicPrefix,
+		checkpointFile: checkpointFile,
+	}
+
+	data, err := os.ReadFile(checkpointFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read CDC checkpoint: %w", err)
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &e.checkpoint)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CDC checkpoint: %w", err)
+		}
+	}
+
+	return e, nil
+}
+
+// Start exports all the commits made since the last checkpoint and then
+// follows the commit feed. The returned function stops the exporter.
+func (e *Exporter) Start() func() error {
+	events, cancel := e.feed.Subscribe(feed.Filter{Tables: e.tables, Branches: []string{"main"}})
+	stopSignal := make(chan struct{})
+	go func() {
+		e.log.Infof("Starting CDC exporter for tables %v", e.tables)
+		retry := time.NewTicker(retryInterval)
+		defer retry.Stop()
+		for {
+			err := e.export()
+			if err != nil {
+				e.log.Errorf("CDC export failed: %v", err)
+			}
+
+			select {
+			case <-events:
+			case <-retry.C:
+			case <-stopSignal:
+				e.log.Info("Stopping CDC exporter")
+				return
+			}
+		}
+	}()
+	stopper := func() error {
+		stopSignal <- struct{}{}
+		cancel()
+		return e.sink.Close()
+	}
+	return stopper
+}
+
+// pendingCommits returns the commits made after the checkpoint, oldest first
+func (e *Exporter) pendingCommits() ([]string, error) {
+	rows, err := e.db.Query("SELECT commit_hash FROM dolt_log;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	commits := []string{}
+	for rows.Next() {
+		var hash string
+		err = rows.Scan(&hash)
+		if err != nil {
+			return nil, err
+		}
+		if hash == e.checkpoint.Commit {
+			break
+		}
+		commits = append([]string{hash}, commits...)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if e.checkpoint.Commit == "" && len(commits) > 0 {
+		// first run: start exporting from the current head
+		return nil, e.saveCheckpoint(commits[len(commits)-1])
+	}
+	return commits, nil
+}
+
+func (e *Exporter) export() error {
+	commits, err := e.pendingCommits()
+	if err != nil {
+		return err
+	}
+
+	for _, commit := range commits {
+		for _, table := range e.tables {
+			changes, err := e.changes(commit, table)
+			if err != nil {
+				return err
+			}
+			for i, change := range changes {
+				payload, err := json.Marshal(change)
+				if err != nil {
+					return err
+				}
+				key := fmt.Sprintf("%s-%s-%d", commit, table, i)
+				err = e.sink.Publish(context.Background(), e.topicPrefix+"."+table, []byte(key), payload)
+				if err != nil {
+					return fmt.Errorf("failed to publish change for commit '%s': %w", commit, err)
+				}
+			}
+		}
+		err = e.saveCheckpoint(commit)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changes computes the row changes a commit made to a table
+func (e *Exporter) changes(commit string, table string) ([]Change, error) {
+	changes, err := Changes(e.db, commit, table)
+	if errors.Is(err, ErrNoDiff) {
+		e.log.Debugf("No diff for table '%s' at commit '%s': %v", table, commit, err)
+		return nil, nil
+	}
+	return changes, err
+}
+
+// Changes computes the row changes a commit made to a table. ErrNoDiff is
+// returned if the table doesn't exist at this commit or the commit has no
+// parent.
+func Changes(db feed.Querier, commit string, table string) ([]Change, error) {
+	if !validName.MatchString(commit) {
+		return nil, fmt.Errorf("invalid commit hash '%s'", commit)
+	}
+	if !validName.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name '%s'", table)
+	}
+
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM dolt_diff('%s~', '%s', '%s');", commit, commit, table))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoDiff, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []Change{}
+	for rows.Next() {
+		values := make([]any, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		err = rows.Scan(dest...)
+		if err != nil {
+			return nil, err
+		}
+
+		change := Change{Commit: commit, Table: table, Before: map[string]any{}, After: map[string]any{}}
+		for i, column := range columns {
+			value := values[i]
+			if b, ok := value.([]byte); ok {
+				value = string(b)
+			}
+			switch {
+			case column == "diff_type":
+				change.Op = fmt.Sprint(value)
+			case column == "to_commit" || column == "to_commit_date" || column == "from_commit" || column == "from_commit_date":
+			case strings.HasPrefix(column, "to_"):
+				change.After[strings.TrimPrefix(column, "to_")] = value
+			case strings.HasPrefix(column, "from_"):
+				change.Before[strings.TrimPrefix(column, "from_")] = value
+			}
+		}
+		switch change.Op {
+		case "added":
+			change.Op = "insert"
+			change.Before = nil
+		case "removed":
+			change.Op = "delete"
+			change.After = nil
+		case "modified":
+			change.Op = "update"
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+func (e *Exporter) saveCheckpoint(commit string) error {
+	data, err := json.Marshal(checkpoint{Commit: commit})
+	if err != nil {
+		return err
+	}
+	tmpFile := e.checkpointFile + ".tmp"
+	err = os.WriteFile(tmpFile, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write CDC checkpoint: %w", err)
+	}
+	err = os.Rename(tmpFile, e.checkpointFile)
+	if err != nil {
+		return fmt.Errorf("failed to write CDC checkpoint: %w", err)
+	}
+	e.checkpoint.Commit = commit
+	return nil
+}
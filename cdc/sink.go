@@ -0,0 +1,95 @@
+package cdc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+)
+
+// Sink publishes change records to a message broker. Publish must only return
+// once the broker acknowledged the message.
+type Sink interface {
+	Publish(ctx context.Context, topic string, key []byte, payload []byte) error
+	Close() error
+}
+
+// NewSink creates a sink by name. Supported sinks are "kafka" and "nats".
+func NewSink(kind string, addrs string) (Sink, error) {
+	switch kind {
+	case "kafka":
+		return NewKafkaSink(strings.Split(addrs, ",")), nil
+	case "nats":
+		return NewNATSSink(addrs)
+	default:
+		return nil, fmt.Errorf("unknown CDC sink '%s'", kind)
+	}
+}
+
+// KafkaSink publishes change records to Kafka topics
+type KafkaSink struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaSink creates a sink that waits for all in-sync replicas to
+// acknowledge every message.
+func NewKafkaSink(brokers []string) *KafkaSink {
+	return &KafkaSink{
+		writer: &kafka.Writer{
+			Addr:                   kafka.TCP(brokers...),
+			Balancer:               &kafka.Hash{},
+			RequiredAcks:           kafka.RequireAll,
+			AllowAutoTopicCreation: true,
+		},
+	}
+}
+
+func (s *KafkaSink) Publish(ctx context.Context, topic string, key []byte, payload []byte) error {
+	return s.writer.WriteMessages(ctx, kafka.Message{Topic: topic, Key: key, Value: payload})
+}
+
+func (s *KafkaSink) Close() error {
+	return s.writer.Close()
+}
+
+// NATSSink publishes change records to NATS JetStream subjects. A stream that
+// captures the subjects has to exist on the server.
+type NATSSink struct {
+	conn *nats.Conn
+	js   nats.JetStreamContext
+}
+
+func NewNATSSink(url string) (*NATSSink, error) {
+	conn, err := nats.Connect(url, nats.Name("doltswarmdemo-cdc"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	js, err := conn.JetStream(nats.PublishAsyncMaxPending(256))
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+	return &NATSSink{conn: conn, js: js}, nil
+}
+
+func (s *NATSSink) Publish(ctx context.Context, topic string, key []byte, payload []byte) error {
+	msg := nats.NewMsg(topic)
+	msg.Data = payload
+	// the change key lets JetStream de-duplicate redeliveries
+	msg.Header.Set(nats.MsgIdHdr, string(key))
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+	}
+	_, err := s.js.PublishMsg(msg, nats.Context(ctx))
+	return err
+}
+
+func (s *NATSSink) Close() error {
+	s.conn.Close()
+	return nil
+}
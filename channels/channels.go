@@ -0,0 +1,288 @@
+package channels
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	p2pgrpc "github.com/birros/go-libp2p-grpc"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+const subscriptionBuffer = 100
+
+var _ p2pproto.ChannelsServer = (*Manager)(nil)
+
+// Message is a decrypted message received on a channel
+type Message struct {
+	Channel string
+	From    string
+	Payload []byte
+}
+
+type channel struct {
+	key   *[32]byte
+	owner string
+}
+
+// ChannelID returns the ID of the channel a peer created with a name. Channels
+// are keyed by their owner and name, so a peer can't take the name of a
+// channel of another peer.
+func ChannelID(owner string, name string) string {
+	return owner + "/" + name
+}
+
+// channelOwner returns the owner in the ID of a channel
+func channelOwner(id string) (string, bool) {
+	owner, name, found := strings.Cut(id, "/")
+	return owner, found && owner != "" && name != ""
+}
+
+// Manager maintains end-to-end encrypted application channels. Every channel
+// has a symmetric key that is only distributed to its members, wrapped with
+// their libp2p public keys. Messages are broadcast to all connected peers, but
+// only members are able to read them.
+type Manager struct {
+	p2p    *p2p.P2P
+	log    *logrus.Logger
+	selfID string
+	prvKey *[32]byte
+
+	mtx      sync.RWMutex
+	channels map[string]*channel
+	subs     map[string][]chan Message
+}
+
+// NewManager creates a channel manager that uses the node's private key to
+// unwrap channel keys.
+func NewManager(p2pmgr *p2p.P2P, prvKey crypto.PrivKey, logger *logrus.Logger) (*Manager, error) {
+	curvePrvKey, err := curve25519PrivateKey(prvKey)
+	if err != nil {
+		return nil, err
+	}
+	selfID, err := peer.IDFromPrivateKey(prvKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Manager{
+		p2p:      p2pmgr,
+		log:      logger,
+		selfID:   selfID.String(),
+		prvKey:   curvePrvKey,
+		channels: map[string]*channel{},
+		subs:     map[string][]chan Message{},
+	}, nil
+}
+
+// Create creates a new channel owned by the node and sends its key to the
+// members. It returns the ID of the channel.
+func (m *Manager) Create(ctx context.Context, name string, members []string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("channel name can't be empty")
+	}
+	key := &[32]byte{}
+	if _, err := rand.Read(key[:]); err != nil {
+		return "", fmt.Errorf("failed to generate channel key: %w", err)
+	}
+
+	id := ChannelID(m.selfID, name)
+	m.mtx.Lock()
+	if _, found := m.channels[id]; found {
+		m.mtx.Unlock()
+		return "", fmt.Errorf("channel '%s' already exists", name)
+	}
+	m.channels[id] = &channel{key: key, owner: m.selfID}
+	m.mtx.Unlock()
+
+	return id, m.AddMembers(ctx, id, members)
+}
+
+// AddMembers sends the key of a channel owned by the node to additional
+// members. Members that are not connected are skipped and reported in the
+// returned error.
+func (m *Manager) AddMembers(ctx context.Context, id string, members []string) error {
+	m.mtx.RLock()
+	ch, found := m.channels[id]
+	m.mtx.RUnlock()
+	if !found {
+		return fmt.Errorf("channel '%s' not found", id)
+	}
+	if ch.owner != m.selfID {
+		return fmt.Errorf("only the owner of channel '%s' can add members", id)
+	}
+
+	clients := map[string]*p2p.P2PClient{}
+	for _, client := range m.p2p.GetClients() {
+		clients[client.GetID()] = client
+	}
+
+	var err error
+	for _, member := range members {
+		client, found := clients[member]
+		if !found {
+			err = errors.Join(err, fmt.Errorf("member '%s' is not connected", member))
+			continue
+		}
+		inviteErr := m.invite(ctx, client, id, ch.key)
+		if inviteErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to invite '%s': %w", member, inviteErr))
+		}
+	}
+	return err
+}
+
+func (m *Manager) invite(ctx context.Context, client *p2p.P2PClient, channelID string, key *[32]byte) error {
+	id, err := peer.Decode(client.GetID())
+	if err != nil {
+		return err
+	}
+	memberKey, err := curve25519PublicKey(id)
+	if err != nil {
+		return err
+	}
+
+	nonce := [24]byte{}
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return err
+	}
+	wrapped := box.Seal(nil, key[:], &nonce, memberKey, m.prvKey)
+	_, err = client.Invite(ctx, &p2pproto.InviteRequest{Channel: channelID, Nonce: nonce[:], WrappedKey: wrapped})
+	return err
+}
+
+// Publish encrypts the payload with the channel key and broadcasts it to all
+// connected peers.
+func (m *Manager) Publish(ctx context.Context, id string, payload []byte) error {
+	m.mtx.RLock()
+	ch, found := m.channels[id]
+	m.mtx.RUnlock()
+	if !found {
+		return fmt.Errorf("not a member of channel '%s'", id)
+	}
+
+	nonce := [24]byte{}
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return err
+	}
+	msg := &p2pproto.ChannelMessage{
+		Channel:    id,
+		Nonce:      nonce[:],
+		Ciphertext: secretbox.Seal(nil, payload, &nonce, ch.key),
+	}
+
+	var err error
+	for _, client := range m.p2p.GetClients() {
+		_, deliverErr := client.Deliver(ctx, msg)
+		if deliverErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to deliver to '%s': %w", client.GetID(), deliverErr))
+		}
+	}
+	return err
+}
+
+// Subscribe returns a channel receiving the decrypted messages of a channel and
+// a function that cancels the subscription.
+func (m *Manager) Subscribe(id string) (<-chan Message, func()) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	messages := make(chan Message, subscriptionBuffer)
+	m.subs[id] = append(m.subs[id], messages)
+
+	cancel := func() {
+		m.mtx.Lock()
+		defer m.mtx.Unlock()
+		subs := m.subs[id]
+		for i, sub := range subs {
+			if sub == messages {
+				m.subs[id] = append(subs[:i], subs[i+1:]...)
+				close(messages)
+				return
+			}
+		}
+	}
+	return messages, cancel
+}
+
+// Invite is called by the owner of a channel that shares the channel key with
+// us. Only the owner in the ID of the channel can send its key.
+func (m *Manager) Invite(ctx context.Context, req *p2pproto.InviteRequest) (*p2pproto.InviteResponse, error) {
+	sender, ok := p2pgrpc.RemotePeerFromContext(ctx)
+	if !ok {
+		return nil, errors.New("no AuthInfo in context")
+	}
+	if len(req.Nonce) != 24 {
+		return nil, fmt.Errorf("invalid nonce")
+	}
+	owner, ok := channelOwner(req.Channel)
+	if !ok {
+		return nil, fmt.Errorf("invalid channel ID '%s'", req.Channel)
+	}
+	if owner != sender.String() {
+		return nil, fmt.Errorf("channel '%s' is owned by another peer", req.Channel)
+	}
+
+	senderKey, err := curve25519PublicKey(sender)
+	if err != nil {
+		return nil, err
+	}
+	nonce := [24]byte{}
+	copy(nonce[:], req.Nonce)
+	rawKey, ok := box.Open(nil, req.WrappedKey, &nonce, senderKey, m.prvKey)
+	if !ok || len(rawKey) != 32 {
+		return nil, fmt.Errorf("failed to unwrap key for channel '%s'", req.Channel)
+	}
+	key := &[32]byte{}
+	copy(key[:], rawKey)
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.channels[req.Channel] = &channel{key: key, owner: owner}
+	m.log.Infof("Joined encrypted channel '%s' owned by '%s'", req.Channel, sender.String())
+
+	return &p2pproto.InviteResponse{}, nil
+}
+
+// Deliver is called by peers broadcasting a channel message. Messages for
+// channels we're not a member of are ignored.
+func (m *Manager) Deliver(ctx context.Context, req *p2pproto.ChannelMessage) (*p2pproto.DeliverResponse, error) {
+	sender, ok := p2pgrpc.RemotePeerFromContext(ctx)
+	if !ok {
+		return nil, errors.New("no AuthInfo in context")
+	}
+
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	ch, found := m.channels[req.Channel]
+	if !found || len(req.Nonce) != 24 {
+		return &p2pproto.DeliverResponse{}, nil
+	}
+
+	nonce := [24]byte{}
+	copy(nonce[:], req.Nonce)
+	payload, ok := secretbox.Open(nil, req.Ciphertext, &nonce, ch.key)
+	if !ok {
+		m.log.Warnf("Failed to decrypt message on channel '%s' from '%s'", req.Channel, sender.String())
+		return &p2pproto.DeliverResponse{}, nil
+	}
+
+	msg := Message{Channel: req.Channel, From: sender.String(), Payload: payload}
+	for _, sub := range m.subs[req.Channel] {
+		select {
+		case sub <- msg:
+		default:
+			m.log.Warnf("Subscriber of channel '%s' is too slow. Dropping message", req.Channel)
+		}
+	}
+	return &p2pproto.DeliverResponse{}, nil
+}
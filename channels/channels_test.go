@@ -0,0 +1,23 @@
+package channels
+
+import "testing"
+
+func TestChannelOwner(t *testing.T) {
+	tests := []struct {
+		id    string
+		owner string
+		valid bool
+	}{
+		{ChannelID("peer1", "updates"), "peer1", true},
+		{ChannelID("peer1", "a/b"), "peer1", true},
+		{"updates", "", false},
+		{"/updates", "", false},
+		{"peer1/", "peer1", false},
+	}
+	for _, test := range tests {
+		owner, valid := channelOwner(test.id)
+		if valid != test.valid || (valid && owner != test.owner) {
+			t.Errorf("channelOwner(%q) = %q, %v, want %q, %v", test.id, owner, valid, test.owner, test.valid)
+		}
+	}
+}
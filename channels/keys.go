@@ -0,0 +1,55 @@
+package channels
+
+import (
+	"crypto/sha512"
+	"fmt"
+
+	"filippo.io/edwards25519"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// curve25519PrivateKey converts an Ed25519 libp2p key into the X25519 key used
+// to unwrap channel keys.
+func curve25519PrivateKey(prvKey crypto.PrivKey) (*[32]byte, error) {
+	if prvKey.Type() != crypto.Ed25519 {
+		return nil, fmt.Errorf("unsupported key type %s. Only Ed25519 keys can be used for channels", prvKey.Type())
+	}
+	raw, err := prvKey.Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha512.Sum512(raw[:32])
+	h[0] &= 248
+	h[31] &= 127
+	h[31] |= 64
+
+	key := [32]byte{}
+	copy(key[:], h[:32])
+	return &key, nil
+}
+
+// curve25519PublicKey returns the X25519 public key of an Ed25519 peer ID
+func curve25519PublicKey(id peer.ID) (*[32]byte, error) {
+	pubKey, err := id.ExtractPublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract public key of peer '%s': %w", id.String(), err)
+	}
+	if pubKey.Type() != crypto.Ed25519 {
+		return nil, fmt.Errorf("peer '%s' uses unsupported key type %s", id.String(), pubKey.Type())
+	}
+	raw, err := pubKey.Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	point, err := new(edwards25519.Point).SetBytes(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key for peer '%s': %w", id.String(), err)
+	}
+
+	key := [32]byte{}
+	copy(key[:], point.BytesMontgomery())
+	return &key, nil
+}
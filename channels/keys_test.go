@@ -0,0 +1,53 @@
+package channels
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/crypto/nacl/box"
+)
+
+func TestKeyWrapping(t *testing.T) {
+	senderKey, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	memberKey, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	senderID, _ := peer.IDFromPrivateKey(senderKey)
+	memberID, _ := peer.IDFromPrivateKey(memberKey)
+
+	senderPrv, err := curve25519PrivateKey(senderKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	memberPrv, err := curve25519PrivateKey(memberKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	senderPub, err := curve25519PublicKey(senderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	memberPub, err := curve25519PublicKey(memberID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channelKey := make([]byte, 32)
+	rand.Read(channelKey)
+	nonce := [24]byte{}
+	wrapped := box.Seal(nil, channelKey, &nonce, memberPub, senderPrv)
+
+	unwrapped, ok := box.Open(nil, wrapped, &nonce, senderPub, memberPrv)
+	if !ok {
+		t.Fatal("member failed to unwrap channel key")
+	}
+	if string(unwrapped) != string(channelKey) {
+		t.Error("unwrapped key doesn't match channel key")
+	}
+}
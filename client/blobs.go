@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"io"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+// blobChunkSize is the size of the chunks blobs are uploaded in
+const blobChunkSize = 256 << 10
+
+// BlobInfo describes a blob stored by the cluster
+type BlobInfo struct {
+	// Hash is the hex-encoded SHA-256 of the content
+	Hash string
+	Size int64
+	// Local is true if the content is stored on the node
+	Local  bool
+	Pinned bool
+	// Commit added the reference of the blob, if PutBlob stored a new blob
+	Commit string
+}
+
+func blobInfoFromProto(info *p2pproto.BlobInfo) BlobInfo {
+	return BlobInfo{Hash: info.Hash, Size: info.Size, Local: info.Local, Pinned: info.Pinned, Commit: info.Commit}
+}
+
+// PutBlob stores the content read from r on the node and references it in the
+// blobs table, from where it's replicated to the other nodes
+func (p *Peer) PutBlob(ctx context.Context, name string, contentType string, r io.Reader) (BlobInfo, error) {
+	stream, err := p.blobs.PutBlob(ctx)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	req := &p2pproto.PutBlobRequest{Name: name, ContentType: contentType}
+	buf := make([]byte, blobChunkSize)
+	for sent := false; ; {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			stream.CloseSend()
+			return BlobInfo{}, err
+		}
+		if n > 0 || !sent {
+			req.Data = buf[:n]
+			if err := stream.Send(req); err != nil {
+				break
+			}
+			sent = true
+			req = &p2pproto.PutBlobRequest{}
+		}
+		if err != nil {
+			break
+		}
+	}
+	info, err := stream.CloseAndRecv()
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	return blobInfoFromProto(info), nil
+}
+
+// GetBlob writes the content of a blob to w. Nodes that don't store the blob
+// fetch it from a peer first.
+func (p *Peer) GetBlob(ctx context.Context, hash string, w io.Writer) error {
+	stream, err := p.blobs.GetBlob(ctx, &p2pproto.GetBlobRequest{Hash: hash})
+	if err != nil {
+		return err
+	}
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(chunk.Data); err != nil {
+			return err
+		}
+	}
+}
+
+// StatBlob describes a blob
+func (p *Peer) StatBlob(ctx context.Context, hash string) (BlobInfo, error) {
+	info, err := p.blobs.StatBlob(ctx, &p2pproto.BlobRequest{Hash: hash})
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	return blobInfoFromProto(info), nil
+}
+
+// PinBlob keeps a blob on the node, fetching it if needed, so that it's never
+// evicted from the cache of a light node
+func (p *Peer) PinBlob(ctx context.Context, hash string) (BlobInfo, error) {
+	info, err := p.blobs.PinBlob(ctx, &p2pproto.BlobRequest{Hash: hash})
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	return blobInfoFromProto(info), nil
+}
+
+// UnpinBlob lets the node evict a blob again
+func (p *Peer) UnpinBlob(ctx context.Context, hash string) (BlobInfo, error) {
+	info, err := p.blobs.UnpinBlob(ctx, &p2pproto.BlobRequest{Hash: hash})
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	return blobInfoFromProto(info), nil
+}
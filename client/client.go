@@ -0,0 +1,157 @@
+// Package client is a Go client for the gRPC services of doltswarm nodes. It
+// dials peers over libp2p, keeps one connection per peer and exposes the
+// Pinger, Tester and DB syncer services with typed, context-aware methods, so
+// programs don't need to set up the gRPC plumbing themselves.
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	p2pgrpc "github.com/birros/go-libp2p-grpc"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/p2p/security/noise"
+	quic "github.com/libp2p/go-libp2p/p2p/transport/quic"
+	swarmproto "github.com/nustiueudinastea/doltswarm/proto"
+	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Option configures a Client
+type Option func(c *Client)
+
+// WithHost uses an existing libp2p host instead of creating one. The host is
+// not closed by Close.
+func WithHost(h host.Host) Option {
+	return func(c *Client) {
+		c.host = h
+	}
+}
+
+// WithIdentity sets the identity of the host created by the client, so that
+// the nodes can authorize it. A random identity is used by default.
+func WithIdentity(key crypto.PrivKey) Option {
+	return func(c *Client) {
+		c.key = key
+	}
+}
+
+// WithDialOptions adds gRPC dial options, e.g. interceptors, to every
+// connection
+func WithDialOptions(opts ...grpc.DialOption) Option {
+	return func(c *Client) {
+		c.dialOpts = append(c.dialOpts, opts...)
+	}
+}
+
+// Client connects to doltswarm nodes. It is safe for concurrent use.
+type Client struct {
+	host     host.Host
+	ownHost  bool
+	key      crypto.PrivKey
+	dialOpts []grpc.DialOption
+
+	mtx   sync.Mutex
+	peers map[peer.ID]*Peer
+}
+
+// New creates a client
+func New(opts ...Option) (*Client, error) {
+	c := &Client{peers: map[peer.ID]*Peer{}}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.host == nil {
+		libp2pOpts := []libp2p.Option{
+			libp2p.NoListenAddrs,
+			libp2p.Security(noise.ID, noise.New),
+			libp2p.Transport(quic.NewTransport),
+		}
+		if c.key != nil {
+			libp2pOpts = append(libp2pOpts, libp2p.Identity(c.key))
+		}
+		h, err := libp2p.New(libp2pOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to setup client host: %w", err)
+		}
+		c.host = h
+		c.ownHost = true
+	}
+	return c, nil
+}
+
+// Connect returns the peer at the given multiaddr, which must include the
+// peer ID. The peer is dialed on the first call.
+func (c *Client) Connect(addr string) (*Peer, error) {
+	info, err := peer.AddrInfoFromString(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer address '%s': %w", addr, err)
+	}
+	c.host.Peerstore().AddAddrs(info.ID, info.Addrs, peerstore.PermanentAddrTTL)
+	return c.Peer(info.ID)
+}
+
+// Peer returns the peer with the given ID. Its addresses must be known by the
+// host, e.g. because Connect was called before. Connections are pooled: every
+// call for the same peer returns the same connection.
+func (c *Client) Peer(id peer.ID) (*Peer, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if p, found := c.peers[id]; found {
+		return p, nil
+	}
+
+	opts := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			stream, err := c.host.NewStream(ctx, id, p2p.RPCProtocols()...)
+			if err != nil {
+				return nil, err
+			}
+			return &p2pgrpc.Conn{Stream: stream}, nil
+		}),
+	}, c.dialOpts...)
+	conn, err := grpc.Dial(id.String(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Peer{
+		id:       id,
+		conn:     conn,
+		pinger:   p2pproto.NewPingerClient(conn),
+		tester:   p2pproto.NewTesterClient(conn),
+		leases:   p2pproto.NewLeasesClient(conn),
+		sessions: p2pproto.NewSessionsClient(conn),
+		blobs:    p2pproto.NewBlobsClient(conn),
+		syncer:   swarmproto.NewDBSyncerClient(conn),
+	}
+	c.peers[id] = p
+	return p, nil
+}
+
+// Close closes the connections to all the peers, and the host if it was
+// created by the client
+func (c *Client) Close() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	for id, p := range c.peers {
+		p.conn.Close()
+		delete(c.peers, id)
+	}
+	if c.ownHost {
+		return c.host.Close()
+	}
+	return nil
+}
@@ -0,0 +1,477 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	swarmproto "github.com/nustiueudinastea/doltswarm/proto"
+	"github.com/nustiueudinastea/doltswarmdemo/commitmeta"
+	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	p2psrv "github.com/nustiueudinastea/doltswarmdemo/p2p/server"
+	"google.golang.org/grpc"
+)
+
+// Consistency is the number of peers that must apply a write before it returns
+type Consistency = p2pproto.Consistency
+
+// Consistency levels
+const (
+	Local  = p2pproto.Consistency_CONSISTENCY_LOCAL
+	Quorum = p2pproto.Consistency_CONSISTENCY_QUORUM
+	All    = p2pproto.Consistency_CONSISTENCY_ALL
+)
+
+// Peer is a connection to a doltswarm node
+type Peer struct {
+	id       peer.ID
+	conn     *grpc.ClientConn
+	pinger   p2pproto.PingerClient
+	tester   p2pproto.TesterClient
+	leases   p2pproto.LeasesClient
+	sessions p2pproto.SessionsClient
+	blobs    p2pproto.BlobsClient
+	syncer   swarmproto.DBSyncerClient
+}
+
+// ID returns the peer ID of the node
+func (p *Peer) ID() peer.ID {
+	return p.id
+}
+
+// Conn returns the gRPC connection to the node, e.g. to call services that
+// have no typed methods
+func (p *Peer) Conn() *grpc.ClientConn {
+	return p.conn
+}
+
+// Info describes a node
+type Info struct {
+	// Version of the API implemented by the node
+	Version string
+	Role    p2p.NodeRole
+	// HistoryDepth is the number of commits kept by light nodes. 0 means the
+	// full history
+	HistoryDepth int64
+}
+
+// Ping checks that the node is reachable and returns its description
+func (p *Peer) Ping(ctx context.Context) (Info, error) {
+	resp, err := p.pinger.Ping(ctx, &p2pproto.PingRequest{Ping: "ping", Version: p2p.ProtocolVersion})
+	if err != nil {
+		return Info{}, err
+	}
+	role := p2p.NodeRole(resp.Role)
+	if role == "" {
+		role = p2p.RoleArchive
+	}
+	return Info{Version: resp.Version, Role: role, HistoryDepth: resp.HistoryDepth}, nil
+}
+
+// ExecOptions configures a write
+type ExecOptions struct {
+	// Message of the commit
+	Message     string
+	Consistency Consistency
+	// Author in the "Name <email>" format. Defaults to the author configured
+	// on the committing node
+	Author   string
+	Metadata commitmeta.Metadata
+	// SessionToken returned by a previous call, for read-your-writes
+	SessionToken string
+	// ExpectedHead only applies the write if the head of the main branch is
+	// still this commit, e.g. the head returned by Head before reading. The
+	// write fails otherwise, and ConflictingHead returns the current head
+	ExpectedHead string
+	// IdempotencyToken identifies the write, e.g. a random ID generated once
+	// and reused by every retry. A retry returns the commit of the first
+	// attempt instead of applying the write again
+	IdempotencyToken string
+}
+
+// ExecResult is the result of a write
+type ExecResult struct {
+	Commit       string
+	SessionToken string
+	// Replayed is true if the write was already applied under the same
+	// idempotency token, in which case Commit is the commit of that attempt
+	Replayed bool
+}
+
+// Exec executes a write on the node and commits it
+func (p *Peer) Exec(ctx context.Context, statement string, opts ExecOptions) (ExecResult, error) {
+	resp, err := p.tester.ExecSQL(ctx, &p2pproto.ExecSQLRequest{
+		Statement:        statement,
+		Msg:              opts.Message,
+		Consistency:      opts.Consistency,
+		SessionToken:     opts.SessionToken,
+		Author:           opts.Author,
+		Metadata:         opts.Metadata,
+		ExpectedHead:     opts.ExpectedHead,
+		IdempotencyToken: opts.IdempotencyToken,
+	})
+	if err != nil {
+		return ExecResult{}, err
+	}
+	if resp.Err != "" {
+		return ExecResult{}, errors.New(resp.Err)
+	}
+	return ExecResult{Commit: resp.Commit, SessionToken: resp.SessionToken, Replayed: resp.Replayed}, nil
+}
+
+// ConflictingHead returns the current head of the node when a write with an
+// expected head failed because the head moved, so that the write can be
+// retried after reading again
+func ConflictingHead(err error) (string, bool) {
+	return p2psrv.ConflictingHead(err)
+}
+
+// QueryOptions configures a read
+type QueryOptions struct {
+	// SessionToken makes the read wait until the writes of the session are
+	// applied on the node
+	SessionToken string
+	// Timeout of the query on the node. 0 uses the node default
+	Timeout time.Duration
+}
+
+// Rows is the result of a read
+type Rows struct {
+	Columns []string
+	Rows    [][]string
+}
+
+// Query runs a read only query on the node
+func (p *Peer) Query(ctx context.Context, statement string, opts QueryOptions) (*Rows, error) {
+	resp, err := p.tester.Query(ctx, &p2pproto.QueryRequest{
+		Statement:    statement,
+		SessionToken: opts.SessionToken,
+		TimeoutMs:    opts.Timeout.Milliseconds(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rowsFromProto(resp), nil
+}
+
+// CallProcedure calls a stored procedure on the main branch of the node
+func (p *Peer) CallProcedure(ctx context.Context, procedure string, args ...string) (*Rows, error) {
+	return p.CallProcedureOnBranch(ctx, "", procedure, args...)
+}
+
+// CallProcedureOnBranch calls a stored procedure on a branch of the node, like
+// dolt_reset, which can't run on main
+func (p *Peer) CallProcedureOnBranch(ctx context.Context, branch string, procedure string, args ...string) (*Rows, error) {
+	resp, err := p.tester.CallProcedure(ctx, &p2pproto.CallProcedureRequest{Procedure: procedure, Args: args, Branch: branch})
+	if err != nil {
+		return nil, err
+	}
+	return rowsFromProto(resp), nil
+}
+
+// NamedQueryOptions configures a run of a named query. Consistency and
+// IdempotencyToken only apply to the queries that write.
+type NamedQueryOptions struct {
+	Consistency      Consistency
+	SessionToken     string
+	IdempotencyToken string
+	// Timeout of the query on the node. 0 uses the node default
+	Timeout time.Duration
+}
+
+// NamedQueryResult is the result of a named query. Rows is set for the
+// queries that read, and Commit for the ones that write.
+type NamedQueryResult struct {
+	Rows         *Rows
+	Commit       string
+	SessionToken string
+	Replayed     bool
+}
+
+// RunNamedQuery runs a query of the named query registry of the node with the
+// values of its parameters
+func (p *Peer) RunNamedQuery(ctx context.Context, name string, params map[string]string, opts NamedQueryOptions) (NamedQueryResult, error) {
+	resp, err := p.tester.RunNamedQuery(ctx, &p2pproto.RunNamedQueryRequest{
+		Name:             name,
+		Params:           params,
+		SessionToken:     opts.SessionToken,
+		Consistency:      opts.Consistency,
+		IdempotencyToken: opts.IdempotencyToken,
+		TimeoutMs:        opts.Timeout.Milliseconds(),
+	})
+	if err != nil {
+		return NamedQueryResult{}, err
+	}
+	result := NamedQueryResult{Commit: resp.Commit, SessionToken: resp.SessionToken, Replayed: resp.Replayed}
+	if resp.Commit == "" {
+		result.Rows = rowsFromProto(&p2pproto.QueryResponse{Columns: resp.Columns, Rows: resp.Rows})
+	}
+	return result, nil
+}
+
+// ExplainOptions of a query plan
+type ExplainOptions struct {
+	// Profile runs the query and returns its execution stats with the plan
+	Profile bool
+	// SessionToken makes the plan wait until the writes of the session are
+	// applied on the node
+	SessionToken string
+	// Timeout of the query on the node. 0 uses the node default
+	Timeout time.Duration
+}
+
+// Plan is the plan of a read query on the node that serves it
+type Plan struct {
+	// Node is the peer ID of the node that planned the query. It's an archive
+	// peer for the history reads of light nodes.
+	Node  string
+	Head  string
+	Lines []string
+	// Profile is only set if the query was profiled
+	Profile *Profile
+}
+
+// Profile is the execution of a read query
+type Profile struct {
+	// SessionWait is how long the query waited for the node to sync past the
+	// session frontier
+	SessionWait time.Duration
+	FirstRow    time.Duration
+	Elapsed     time.Duration
+	Rows        int64
+	Bytes       int64
+}
+
+// Explain returns the plan of a read query on the node, and profiles the
+// query if asked to
+func (p *Peer) Explain(ctx context.Context, statement string, opts ExplainOptions) (Plan, error) {
+	resp, err := p.tester.Explain(ctx, &p2pproto.ExplainRequest{
+		Statement:    statement,
+		Profile:      opts.Profile,
+		SessionToken: opts.SessionToken,
+		TimeoutMs:    opts.Timeout.Milliseconds(),
+	})
+	if err != nil {
+		return Plan{}, err
+	}
+	return planFromProto(resp), nil
+}
+
+func planFromProto(resp *p2pproto.ExplainResponse) Plan {
+	plan := Plan{Node: resp.Node, Head: resp.Head, Lines: resp.Plan}
+	if resp.Profile != nil {
+		plan.Profile = &Profile{
+			SessionWait: time.Duration(resp.Profile.SessionWaitMs) * time.Millisecond,
+			FirstRow:    time.Duration(resp.Profile.FirstRowMs) * time.Millisecond,
+			Elapsed:     time.Duration(resp.Profile.ElapsedMs) * time.Millisecond,
+			Rows:        resp.Profile.Rows,
+			Bytes:       resp.Profile.Bytes,
+		}
+	}
+	return plan
+}
+
+// Decrypt replaces the encrypted values of the rows with their plaintext, e.g.
+// with the Decrypt method of a tablecrypt policy holding the keys of the
+// application. Nodes return the values of encrypted columns as stored.
+func (r *Rows) Decrypt(decrypt func(value string) string) {
+	for _, row := range r.Rows {
+		for i, value := range row {
+			row[i] = decrypt(value)
+		}
+	}
+}
+
+func rowsFromProto(resp *p2pproto.QueryResponse) *Rows {
+	rows := &Rows{Columns: resp.Columns, Rows: make([][]string, 0, len(resp.Rows))}
+	for _, row := range resp.Rows {
+		rows.Rows = append(rows.Rows, row.Values)
+	}
+	return rows
+}
+
+// Head returns the head commit of the main branch of the node
+func (p *Peer) Head(ctx context.Context) (string, error) {
+	resp, err := p.tester.GetHead(ctx, &p2pproto.GetHeadRequest{})
+	if err != nil {
+		return "", err
+	}
+	return resp.Commit, nil
+}
+
+// CommitsOptions selects the commits to list
+type CommitsOptions struct {
+	// Branch to list. Defaults to main
+	Branch string
+	// PageSize is the number of commits sent per message. 0 uses the node
+	// maximum
+	PageSize    int
+	OldestFirst bool
+}
+
+// Commits calls fn with the hashes of the commits on a branch, page by page,
+// until all the commits were listed or fn returns an error
+func (p *Peer) Commits(ctx context.Context, opts CommitsOptions, fn func(hashes []string) error) error {
+	req := &p2pproto.GetAllCommitsRequest{Branch: opts.Branch, Limit: int32(opts.PageSize)}
+	if opts.OldestFirst {
+		req.Order = p2pproto.CommitOrder_COMMIT_ORDER_OLDEST_FIRST
+	}
+	stream, err := p.tester.StreamCommits(ctx, req)
+	if err != nil {
+		return err
+	}
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = fn(resp.Commits); err != nil {
+			return err
+		}
+	}
+}
+
+// WaitForCommit waits until the node applied the commit, or until the context
+// expires. It returns false if the commit was not applied in time.
+func (p *Peer) WaitForCommit(ctx context.Context, commit string) (bool, error) {
+	resp, err := p.tester.AckCommit(ctx, &p2pproto.AckCommitRequest{Commit: commit})
+	if err != nil {
+		return false, err
+	}
+	return resp.Applied, nil
+}
+
+// Comparison is the causal ordering of two commits
+type Comparison struct {
+	Ordering string
+	ClockA   map[string]uint64
+	ClockB   map[string]uint64
+}
+
+// CompareCommits returns the causal ordering of two commits, based on the
+// vector clocks attached to them
+func (p *Peer) CompareCommits(ctx context.Context, a string, b string) (Comparison, error) {
+	resp, err := p.tester.CompareCommits(ctx, &p2pproto.CompareCommitsRequest{A: a, B: b})
+	if err != nil {
+		return Comparison{}, err
+	}
+	return Comparison{Ordering: resp.Ordering, ClockA: resp.ClockA, ClockB: resp.ClockB}, nil
+}
+
+// AdvertiseHead announces a new head to the DB syncer of the node
+func (p *Peer) AdvertiseHead(ctx context.Context, head string) error {
+	_, err := p.syncer.AdvertiseHead(ctx, &swarmproto.AdvertiseHeadRequest{Head: head})
+	return err
+}
+
+// RequestHead returns the head known by the DB syncer of the node
+func (p *Peer) RequestHead(ctx context.Context) (string, error) {
+	resp, err := p.syncer.RequestHead(ctx, &swarmproto.RequestHeadRequest{})
+	if err != nil {
+		return "", err
+	}
+	return resp.Head, nil
+}
+
+// Lease is a named lock held until it expires or is released
+type Lease = p2p.Lease
+
+// AcquireLease acquires a named lease through the node, e.g. to run a
+// migration or a singleton job on one node of the cluster at a time. It fails
+// with a FailedPrecondition status if the lease is held by someone else.
+func (p *Peer) AcquireLease(ctx context.Context, name string, owner string, ttl time.Duration) (Lease, error) {
+	resp, err := p.leases.Acquire(ctx, &p2pproto.AcquireLeaseRequest{Name: name, Owner: owner, TtlMs: ttl.Milliseconds()})
+	if err != nil {
+		return Lease{}, err
+	}
+	return leaseFromProto(resp), nil
+}
+
+// RenewLease extends a lease before it expires
+func (p *Peer) RenewLease(ctx context.Context, lease Lease, ttl time.Duration) (Lease, error) {
+	resp, err := p.leases.Renew(ctx, &p2pproto.RenewLeaseRequest{Name: lease.Name, Token: lease.Token, TtlMs: ttl.Milliseconds()})
+	if err != nil {
+		return Lease{}, err
+	}
+	return leaseFromProto(resp), nil
+}
+
+// ReleaseLease gives up a lease
+func (p *Peer) ReleaseLease(ctx context.Context, lease Lease) error {
+	_, err := p.leases.Release(ctx, &p2pproto.ReleaseLeaseRequest{Name: lease.Name, Token: lease.Token})
+	return err
+}
+
+func leaseFromProto(l *p2pproto.Lease) Lease {
+	return Lease{Name: l.Name, Token: l.Token, Owner: l.Owner, Node: l.Node, Expires: time.Unix(0, l.ExpiresUnixNano)}
+}
+
+// Session is a SQL session on a node. Its statements share temporary tables,
+// user variables and transactions, until it's closed or stays idle for longer
+// than its timeout. Writes to replicated tables are committed on their own
+// and can't run in a transaction.
+type Session struct {
+	sessions    p2pproto.SessionsClient
+	id          string
+	idleTimeout time.Duration
+}
+
+// SessionResult is the result of a statement run in a session
+type SessionResult struct {
+	// Rows is set for reads
+	Rows         *Rows
+	RowsAffected int64
+	// Commit is set for writes to replicated tables
+	Commit string
+}
+
+// OpenSession opens a SQL session on the node. 0 uses the idle timeout of the
+// node, which also caps the requested one.
+func (p *Peer) OpenSession(ctx context.Context, idleTimeout time.Duration) (*Session, error) {
+	resp, err := p.sessions.Open(ctx, &p2pproto.OpenSessionRequest{IdleTimeoutMs: idleTimeout.Milliseconds()})
+	if err != nil {
+		return nil, err
+	}
+	return &Session{sessions: p.sessions, id: resp.SessionId, idleTimeout: time.Duration(resp.IdleTimeoutMs) * time.Millisecond}, nil
+}
+
+// ID returns the ID of the session on the node
+func (s *Session) ID() string {
+	return s.id
+}
+
+// IdleTimeout returns the idle timeout granted by the node
+func (s *Session) IdleTimeout() time.Duration {
+	return s.idleTimeout
+}
+
+// Exec runs a statement in the session. Only the message and the consistency
+// of opts apply, to writes to replicated tables.
+func (s *Session) Exec(ctx context.Context, statement string, opts ExecOptions) (SessionResult, error) {
+	resp, err := s.sessions.Execute(ctx, &p2pproto.SessionStatementRequest{
+		SessionId:   s.id,
+		Statement:   statement,
+		Msg:         opts.Message,
+		Consistency: opts.Consistency,
+	})
+	if err != nil {
+		return SessionResult{}, err
+	}
+	res := SessionResult{RowsAffected: resp.RowsAffected, Commit: resp.Commit}
+	if len(resp.Columns) > 0 {
+		res.Rows = rowsFromProto(&p2pproto.QueryResponse{Columns: resp.Columns, Rows: resp.Rows})
+	}
+	return res, nil
+}
+
+// Close closes the session, rolling back its open transaction
+func (s *Session) Close(ctx context.Context) error {
+	_, err := s.sessions.Close(ctx, &p2pproto.CloseSessionRequest{SessionId: s.id})
+	return err
+}
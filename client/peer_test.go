@@ -0,0 +1,60 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+func TestRowsFromProto(t *testing.T) {
+	rows := rowsFromProto(&p2pproto.QueryResponse{
+		Columns: []string{"id", "name"},
+		Rows:    []*p2pproto.Row{{Values: []string{"1", "a"}}, {Values: []string{"2", "b"}}},
+	})
+	if len(rows.Columns) != 2 || len(rows.Rows) != 2 || rows.Rows[1][1] != "b" {
+		t.Errorf("unexpected rows %+v", rows)
+	}
+
+	empty := rowsFromProto(&p2pproto.QueryResponse{})
+	if empty.Rows == nil || len(empty.Rows) != 0 {
+		t.Errorf("expected no rows, got %+v", empty.Rows)
+	}
+}
+
+func TestPlanFromProto(t *testing.T) {
+	plan := planFromProto(&p2pproto.ExplainResponse{Node: "peerA", Plan: []string{"Project", " └─ Table"}})
+	if plan.Node != "peerA" || len(plan.Lines) != 2 || plan.Profile != nil {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+
+	plan = planFromProto(&p2pproto.ExplainResponse{Profile: &p2pproto.QueryProfile{FirstRowMs: 2, ElapsedMs: 1500, Rows: 3}})
+	if plan.Profile == nil || plan.Profile.Elapsed != 1500*time.Millisecond || plan.Profile.Rows != 3 {
+		t.Errorf("unexpected profile %+v", plan.Profile)
+	}
+}
+
+func TestPeerPool(t *testing.T) {
+	c, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	addr := "/ip4/127.0.0.1/udp/4001/quic-v1/p2p/12D3KooWHHzSeKaY8xuZVzkLbKFfvNgPPeKhFBGrMbNzbm5akpqu"
+	a, err := c.Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != b {
+		t.Error("expected the connection to the peer to be reused")
+	}
+
+	if _, err := c.Connect("/ip4/127.0.0.1/udp/4001/quic-v1"); err == nil {
+		t.Error("expected an error for an address without peer ID")
+	}
+}
@@ -0,0 +1,156 @@
+// Package commitlog lists the commits of a branch in pages, so that large
+// histories can be transferred without building a single huge response.
+package commitlog
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarm"
+)
+
+const (
+	// DefaultBranch is listed when no branch is requested
+	DefaultBranch = "main"
+	// MaxLimit caps the number of commits returned in a single page
+	MaxLimit = 10000
+)
+
+var validRef = regexp.MustCompile(`^[A-Za-z0-9_./-]+$`)
+
+// Order is the order in which commits are listed
+type Order int
+
+const (
+	// NewestFirst lists the most recent commits first, like dolt_log
+	NewestFirst Order = iota
+	// OldestFirst lists the commits starting from the root of the history
+	OldestFirst
+)
+
+// Options selects a page of commits
+type Options struct {
+	// Branch to list. Defaults to DefaultBranch
+	Branch string
+	// Cursor is the NextCursor of the previous page. Empty for the first page
+	Cursor string
+	// Limit is the maximum number of commits in the page. 0 means MaxLimit
+	Limit int
+	Order Order
+}
+
+// Page is a page of commits
+type Page struct {
+	Commits []doltswarm.Commit
+	// NextCursor is used to request the following page. It is empty when
+	// there are no more commits
+	NextCursor string
+}
+
+// Querier runs read queries
+type Querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// List returns a page of the commits on a branch
+func List(db Querier, opts Options) (Page, error) {
+	branch := opts.Branch
+	if branch == "" {
+		branch = DefaultBranch
+	}
+	if !validRef.MatchString(branch) {
+		return Page{}, fmt.Errorf("invalid branch name '%s'", branch)
+	}
+
+	rows, err := db.Query(fmt.Sprintf("SELECT commit_hash, committer, email, date, message FROM dolt_log('%s');", branch))
+	if err != nil {
+		return Page{}, err
+	}
+	defer rows.Close()
+
+	commits := []doltswarm.Commit{}
+	for rows.Next() {
+		commit := doltswarm.Commit{}
+		var date any
+		err = rows.Scan(&commit.Hash, &commit.Committer, &commit.Email, &date, &commit.Message)
+		if err != nil {
+			return Page{}, err
+		}
+		commit.Date = asTime(date)
+		commits = append(commits, commit)
+	}
+	if err = rows.Err(); err != nil {
+		return Page{}, err
+	}
+
+	return Paginate(commits, opts)
+}
+
+// Paginate returns a page of commits, which must be ordered newest first as
+// returned by dolt_log
+func Paginate(commits []doltswarm.Commit, opts Options) (Page, error) {
+	if opts.Limit < 0 {
+		return Page{}, fmt.Errorf("invalid limit %d", opts.Limit)
+	}
+	limit := opts.Limit
+	if limit == 0 || limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	ordered := commits
+	if opts.Order == OldestFirst {
+		ordered = make([]doltswarm.Commit, len(commits))
+		for i, commit := range commits {
+			ordered[len(commits)-1-i] = commit
+		}
+	}
+
+	start := 0
+	if opts.Cursor != "" {
+		start = -1
+		for i, commit := range ordered {
+			if commit.Hash == opts.Cursor {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return Page{}, fmt.Errorf("unknown cursor '%s'", opts.Cursor)
+		}
+	}
+
+	end := start + limit
+	if end > len(ordered) {
+		end = len(ordered)
+	}
+
+	page := Page{Commits: ordered[start:end]}
+	if end < len(ordered) {
+		page.NextCursor = ordered[end-1].Hash
+	}
+	return page, nil
+}
+
+func asTime(v any) time.Time {
+	switch t := v.(type) {
+	case time.Time:
+		return t
+	case []byte:
+		return parseTime(string(t))
+	case string:
+		return parseTime(t)
+	default:
+		return time.Time{}
+	}
+}
+
+func parseTime(s string) time.Time {
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999", time.RFC3339Nano} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,101 @@
+package commitlog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarm"
+)
+
+func hashes(commits []doltswarm.Commit) []string {
+	res := []string{}
+	for _, commit := range commits {
+		res = append(res, commit.Hash)
+	}
+	return res
+}
+
+func equal(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPaginate(t *testing.T) {
+	commits := []doltswarm.Commit{{Hash: "e"}, {Hash: "d"}, {Hash: "c"}, {Hash: "b"}, {Hash: "a"}}
+
+	tests := []struct {
+		name   string
+		opts   Options
+		want   []string
+		cursor string
+	}{
+		{"all", Options{}, []string{"e", "d", "c", "b", "a"}, ""},
+		{"first page", Options{Limit: 2}, []string{"e", "d"}, "d"},
+		{"second page", Options{Limit: 2, Cursor: "d"}, []string{"c", "b"}, "b"},
+		{"last page", Options{Limit: 2, Cursor: "b"}, []string{"a"}, ""},
+		{"exact last page", Options{Limit: 3, Cursor: "d"}, []string{"c", "b", "a"}, ""},
+		{"oldest first", Options{Limit: 2, Order: OldestFirst}, []string{"a", "b"}, "b"},
+		{"oldest first next page", Options{Limit: 2, Order: OldestFirst, Cursor: "b"}, []string{"c", "d"}, "d"},
+		{"cursor at the end", Options{Cursor: "a"}, []string{}, ""},
+	}
+
+	for _, test := range tests {
+		page, err := Paginate(commits, test.opts)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if got := hashes(page.Commits); !equal(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+		if page.NextCursor != test.cursor {
+			t.Errorf("%s: got cursor '%s', want '%s'", test.name, page.NextCursor, test.cursor)
+		}
+	}
+
+	if _, err := Paginate(commits, Options{Cursor: "x"}); err == nil {
+		t.Error("expected an error for an unknown cursor")
+	}
+	if _, err := Paginate(commits, Options{Limit: -1}); err == nil {
+		t.Error("expected an error for a negative limit")
+	}
+}
+
+func TestMissed(t *testing.T) {
+	now := time.Now()
+	commits := []doltswarm.Commit{
+		{Hash: "e", Date: now},
+		{Hash: "d", Date: now.Add(-time.Minute)},
+		{Hash: "c", Date: now.Add(-2 * time.Minute)},
+		{Hash: "b", Date: now.Add(-3 * time.Minute)},
+		{Hash: "a", Date: now.Add(-4 * time.Minute)},
+	}
+
+	tests := []struct {
+		name      string
+		since     time.Time
+		frontier  []string
+		limit     int
+		want      []string
+		truncated bool
+	}{
+		{"frontier", time.Time{}, []string{"c"}, 0, []string{"d", "e"}, false},
+		{"up to date", time.Time{}, []string{"e"}, 0, []string{}, false},
+		{"frontier wins over since", now.Add(-30 * time.Second), []string{"b"}, 0, []string{"c", "d", "e"}, false},
+		{"unknown frontier falls back to since", now.Add(-90 * time.Second), []string{"x"}, 0, []string{"d", "e"}, false},
+		{"no frontier", time.Time{}, nil, 0, []string{"a", "b", "c", "d", "e"}, false},
+		{"limit keeps the newest", time.Time{}, []string{"a"}, 2, []string{"d", "e"}, true},
+	}
+	for _, tt := range tests {
+		missed, truncated := Missed(commits, tt.since, tt.frontier, tt.limit)
+		if !equal(hashes(missed), tt.want) || truncated != tt.truncated {
+			t.Errorf("%s: expected %v (truncated %v), got %v (truncated %v)", tt.name, tt.want, tt.truncated, hashes(missed), truncated)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package commitlog
+
+import (
+	"time"
+
+	"github.com/nustiueudinastea/doltswarm"
+)
+
+// Missed returns the commits a peer missed, oldest first. commits must be
+// ordered newest first. The walk stops at the first commit in the frontier,
+// i.e. the heads the peer already has. If the peer has none of the commits in
+// its frontier, e.g. because the histories diverged, it stops at the first
+// commit older than since instead. At most limit commits are returned, the
+// most recent ones, and truncated is set if there were more.
+func Missed(commits []doltswarm.Commit, since time.Time, frontier []string, limit int) (missed []doltswarm.Commit, truncated bool) {
+	known := map[string]bool{}
+	for _, hash := range frontier {
+		known[hash] = true
+	}
+	if limit <= 0 || limit > MaxLimit {
+		limit = MaxLimit
+	}
+
+	end := len(commits)
+	for i, commit := range commits {
+		if known[commit.Hash] {
+			end = i
+			break
+		}
+	}
+	if end == len(commits) && !since.IsZero() {
+		for i, commit := range commits {
+			if commit.Date.Before(since) {
+				end = i
+				break
+			}
+		}
+	}
+
+	if end > limit {
+		end = limit
+		truncated = true
+	}
+	missed = make([]doltswarm.Commit, end)
+	for i := 0; i < end; i++ {
+		missed[end-1-i] = commits[i]
+	}
+	return missed, truncated
+}
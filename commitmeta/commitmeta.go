@@ -0,0 +1,58 @@
+// Package commitmeta attaches machine readable metadata to commits. The
+// metadata is stored as a JSON object in a trailer of the commit message, so
+// it travels with the commit to every peer.
+package commitmeta
+
+import (
+	"encoding/json"
+
+	"github.com/nustiueudinastea/doltswarmdemo/trailer"
+)
+
+const metadataKey = "Commit-Metadata"
+
+// Well known metadata keys
+const (
+	App       = "app"
+	RequestID = "request_id"
+	User      = "user"
+)
+
+// Metadata holds string values by key
+type Metadata map[string]string
+
+// Annotate adds the metadata to a commit message. Empty metadata leaves the
+// message unchanged.
+func Annotate(msg string, md Metadata) string {
+	if len(md) == 0 {
+		return msg
+	}
+	// marshalling a map of strings can't fail
+	data, _ := json.Marshal(md)
+	return trailer.Append(msg, metadataKey, string(data))
+}
+
+// FromMessage extracts the metadata from a commit message. It returns false if
+// the message has no valid metadata attached.
+func FromMessage(msg string) (Metadata, bool) {
+	value, found := trailer.Get(msg, metadataKey)
+	if !found {
+		return nil, false
+	}
+	md := Metadata{}
+	err := json.Unmarshal([]byte(value), &md)
+	if err != nil {
+		return nil, false
+	}
+	return md, true
+}
+
+// Match returns true if the metadata has all the keys and values of the filter
+func (md Metadata) Match(filter map[string]string) bool {
+	for key, value := range filter {
+		if md[key] != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,34 @@
+package commitmeta
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nustiueudinastea/doltswarmdemo/author"
+)
+
+func TestAnnotate(t *testing.T) {
+	md := Metadata{App: "billing", RequestID: "req-1", User: "jane"}
+	msg := author.AnnotatePeer(Annotate("Insert rows", md), "12D3KooW")
+	if !strings.HasPrefix(msg, "Insert rows\n\nCommit-Metadata: {") || !strings.HasSuffix(msg, "}\nPeer-ID: 12D3KooW") {
+		t.Fatalf("expected the metadata in the trailer block, got %q", msg)
+	}
+
+	parsed, found := FromMessage(msg)
+	if !found || len(parsed) != 3 || parsed[App] != "billing" {
+		t.Fatalf("expected %v, got %v", md, parsed)
+	}
+	if !parsed.Match(map[string]string{App: "billing", User: "jane"}) {
+		t.Error("expected the metadata to match")
+	}
+	if parsed.Match(map[string]string{App: "other"}) {
+		t.Error("expected the metadata to not match another app")
+	}
+
+	if Annotate("Insert rows", nil) != "Insert rows" {
+		t.Error("expected empty metadata to leave the message unchanged")
+	}
+	if _, found := FromMessage("Insert rows\n\nCommit-Metadata: invalid"); found {
+		t.Error("expected invalid metadata to be ignored")
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/conflicts"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	conflictsInterval     = 5 * time.Second
+	conflictsFile         = "conflicts.json"
+	conflictRequestPrefix = "conflict-resolve-"
+	conflictResultPrefix  = "conflict-result-"
+)
+
+// conflictsSnapshot is written to the working directory for the conflicts
+// command
+type conflictsSnapshot struct {
+	Tables    []conflicts.Table `json:"tables"`
+	Rows      []conflicts.Row   `json:"rows"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// conflictRequest asks the running server to resolve conflicts
+type conflictRequest struct {
+	Table      string `json:"table"`
+	ID         string `json:"id,omitempty"`
+	Resolution string `json:"resolution"`
+}
+
+type conflictResult struct {
+	Commit string `json:"commit,omitempty"`
+	Err    string `json:"error,omitempty"`
+}
+
+// startConflictTracker periodically merges the conflicting rows of mergeable
+// columns, writes the remaining merge conflicts to the working directory and
+// applies the resolutions requested by the conflicts command
+func startConflictTracker(resolver *conflicts.Resolver) func() error {
+	log.Info("Starting conflict tracker")
+	ticker := time.NewTicker(conflictsInterval)
+	stopSignal := make(chan struct{})
+	crashReporter.Go("conflict-tracker", func() {
+		for {
+			select {
+			case <-ticker.C:
+				merged, err := resolver.AutoMerge()
+				if err != nil {
+					log.Errorf("Failed to merge conflicting rows: %s", err.Error())
+				} else if merged > 0 {
+					log.Infof("Merged %d conflicting rows using mergeable columns", merged)
+				}
+				processConflictRequests(resolver)
+				err = writeConflicts(resolver)
+				if err != nil {
+					log.Errorf("Failed to write conflicts: %s", err.Error())
+				}
+			case <-stopSignal:
+				return
+			}
+		}
+	})
+	return func() error {
+		log.Info("Stopping conflict tracker")
+		ticker.Stop()
+		close(stopSignal)
+		return nil
+	}
+}
+
+func writeConflicts(resolver *conflicts.Resolver) error {
+	tables, err := resolver.Tables()
+	if err != nil {
+		return err
+	}
+	snapshot := conflictsSnapshot{Tables: tables, Rows: []conflicts.Row{}, UpdatedAt: time.Now()}
+	for _, table := range tables {
+		rows, err := resolver.Rows(table.Name)
+		if err != nil {
+			return err
+		}
+		snapshot.Rows = append(snapshot.Rows, rows...)
+	}
+	return writeJSON(filepath.Join(workDir, conflictsFile), snapshot)
+}
+
+func processConflictRequests(resolver *conflicts.Resolver) {
+	paths, _ := filepath.Glob(filepath.Join(workDir, conflictRequestPrefix+"*.json"))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Errorf("Failed to read conflict resolution request: %s", err.Error())
+			continue
+		}
+		os.Remove(path)
+
+		result := conflictResult{}
+		req := conflictRequest{}
+		err = json.Unmarshal(data, &req)
+		if err == nil {
+			var resolution conflicts.Resolution
+			resolution, err = conflicts.ParseResolution(req.Resolution)
+			if err == nil {
+				result.Commit, err = resolver.Resolve(req.Table, req.ID, resolution)
+			}
+		}
+		if err != nil {
+			result.Err = err.Error()
+		}
+
+		id := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), conflictRequestPrefix), ".json")
+		err = writeJSON(filepath.Join(workDir, conflictResultPrefix+id+".json"), result)
+		if err != nil {
+			log.Errorf("Failed to write conflict resolution result: %s", err.Error())
+		}
+	}
+}
+
+func writeJSON(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(path+".tmp", data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// printConflicts prints the conflicts reported by the server running in the
+// working directory, with the conflicting rows side by side
+func printConflicts(table string) error {
+	data, err := os.ReadFile(filepath.Join(workDir, conflictsFile))
+	if err != nil {
+		return fmt.Errorf("failed to read conflicts. Is the server running? %w", err)
+	}
+	snapshot := conflictsSnapshot{}
+	err = json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to parse conflicts: %w", err)
+	}
+
+	if len(snapshot.Tables) == 0 {
+		fmt.Println("No conflicts")
+		return nil
+	}
+	for _, t := range snapshot.Tables {
+		fmt.Printf("%s: %d conflicts\n", t.Name, t.Conflicts)
+	}
+	for _, row := range snapshot.Rows {
+		if table != "" && row.Table != table {
+			continue
+		}
+		fmt.Println()
+		fmt.Print(conflicts.Format(row))
+	}
+	return nil
+}
+
+// resolveConflicts asks the server running in the working directory to
+// resolve conflicts and returns the hash of the resolution commit
+func resolveConflicts(req conflictRequest, timeout time.Duration) (string, error) {
+	if _, err := conflicts.ParseResolution(req.Resolution); err != nil {
+		return "", err
+	}
+	id := ksuid.New().String()
+	err := writeJSON(filepath.Join(workDir, conflictRequestPrefix+id+".json"), req)
+	if err != nil {
+		return "", err
+	}
+
+	resultPath := filepath.Join(workDir, conflictResultPrefix+id+".json")
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(200 * time.Millisecond)
+		data, err := os.ReadFile(resultPath)
+		if err != nil {
+			continue
+		}
+		os.Remove(resultPath)
+		result := conflictResult{}
+		err = json.Unmarshal(data, &result)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse conflict resolution result: %w", err)
+		}
+		if result.Err != "" {
+			return "", fmt.Errorf("%s", result.Err)
+		}
+		return result.Commit, nil
+	}
+	os.Remove(filepath.Join(workDir, conflictRequestPrefix+id+".json"))
+	return "", fmt.Errorf("no conflict resolution within %s. Is the server running?", timeout)
+}
@@ -0,0 +1,597 @@
+// Package conflicts reads the conflicts left by Dolt merges and builds the
+// statements that resolve them. Conflicts are listed per table in
+// dolt_conflicts, and the conflicting rows of a table in dolt_conflicts_<table>
+// with the base, our and their version of every column.
+package conflicts
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/hlc"
+)
+
+var (
+	validName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+	validID   = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// Resolution picks the version of the conflicting rows that is kept
+type Resolution string
+
+const (
+	// Ours keeps the local version
+	Ours Resolution = "ours"
+	// Theirs keeps the version of the merged branch
+	Theirs Resolution = "theirs"
+	// Latest keeps the most recent version, as dated by the commits that
+	// wrote them
+	Latest Resolution = "latest"
+	// Merge combines the concurrent updates of the mergeable columns
+	Merge Resolution = "merge"
+)
+
+// ParseResolution parses "ours", "theirs", "latest" or "merge"
+func ParseResolution(s string) (Resolution, error) {
+	switch Resolution(s) {
+	case Ours, Theirs, Latest, Merge:
+		return Resolution(s), nil
+	default:
+		return "", fmt.Errorf("unknown resolution '%s', expected ours, theirs, latest or merge", s)
+	}
+}
+
+// Order decides which of two conflicting versions is the most recent
+type Order string
+
+const (
+	// WallClock orders versions by the commit dates, which come from the
+	// clocks of the nodes that made them
+	WallClock Order = "wall"
+	// HybridClock orders versions by their hybrid logical clock timestamps,
+	// which stay ordered when the clocks of the nodes are skewed. Versions
+	// without a timestamp fall back to the commit dates.
+	HybridClock Order = "hlc"
+)
+
+// Version is when a version of a row was written
+type Version struct {
+	Commit string
+	Date   time.Time
+	HLC    hlc.Timestamp
+}
+
+// newer returns true if the version v is more recent than other. Ties are
+// broken with the commit hashes so that every node picks the same version.
+func (v Version) newer(other Version, order Order) bool {
+	if order == HybridClock && !v.HLC.IsZero() && !other.HLC.IsZero() {
+		if cmp := v.HLC.Compare(other.HLC); cmp != 0 {
+			return cmp > 0
+		}
+	} else if !v.Date.Equal(other.Date) {
+		return v.Date.After(other.Date)
+	}
+	return v.Commit > other.Commit
+}
+
+// Table is a table with conflicts
+type Table struct {
+	Name      string `json:"name"`
+	Conflicts int    `json:"conflicts"`
+}
+
+// Value is a column value. Null is set for SQL NULLs and for the missing side
+// of rows that were added or removed.
+type Value struct {
+	Value string `json:"value,omitempty"`
+	Null  bool   `json:"null,omitempty"`
+}
+
+func (v Value) String() string {
+	if v.Null {
+		return "NULL"
+	}
+	return v.Value
+}
+
+// Row is a conflicting row
+type Row struct {
+	ID            string           `json:"id"`
+	Table         string           `json:"table"`
+	Columns       []string         `json:"columns"`
+	Base          map[string]Value `json:"base"`
+	Ours          map[string]Value `json:"ours"`
+	Theirs        map[string]Value `json:"theirs"`
+	OurDiffType   string           `json:"our_diff_type"`
+	TheirDiffType string           `json:"their_diff_type"`
+	// TheirCommit is the merged commit their version comes from
+	TheirCommit string `json:"their_commit,omitempty"`
+}
+
+// Querier runs read queries
+type Querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// Tables returns the tables with conflicts
+func Tables(db Querier) ([]Table, error) {
+	rows, err := db.Query("SELECT `table`, num_conflicts FROM dolt_conflicts;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tables := []Table{}
+	for rows.Next() {
+		table := Table{}
+		err = rows.Scan(&table.Name, &table.Conflicts)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].Name < tables[j].Name })
+	return tables, nil
+}
+
+// Rows returns the conflicting rows of a table
+func Rows(db Querier, table string) ([]Row, error) {
+	if !validName.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name '%s'", table)
+	}
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM `dolt_conflicts_%s`;", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	res := []Row{}
+	for rows.Next() {
+		values := make([]any, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		err = rows.Scan(dest...)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, parseRow(table, columns, values))
+	}
+	return res, rows.Err()
+}
+
+// parseRow splits the columns of a dolt_conflicts_<table> row into the base,
+// our and their versions of the row
+func parseRow(table string, columns []string, values []any) Row {
+	row := Row{Table: table, Base: map[string]Value{}, Ours: map[string]Value{}, Theirs: map[string]Value{}}
+	seen := map[string]bool{}
+	addColumn := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			row.Columns = append(row.Columns, name)
+		}
+	}
+	for i, column := range columns {
+		value := toValue(values[i])
+		switch {
+		case column == "dolt_conflict_id":
+			row.ID = value.Value
+		case column == "from_root_ish":
+			row.TheirCommit = value.Value
+		case column == "our_diff_type":
+			row.OurDiffType = value.Value
+		case column == "their_diff_type":
+			row.TheirDiffType = value.Value
+		case strings.HasPrefix(column, "base_"):
+			name := strings.TrimPrefix(column, "base_")
+			addColumn(name)
+			row.Base[name] = value
+		case strings.HasPrefix(column, "our_"):
+			name := strings.TrimPrefix(column, "our_")
+			addColumn(name)
+			row.Ours[name] = value
+		case strings.HasPrefix(column, "their_"):
+			name := strings.TrimPrefix(column, "their_")
+			addColumn(name)
+			row.Theirs[name] = value
+		}
+	}
+	return row
+}
+
+func toValue(v any) Value {
+	switch t := v.(type) {
+	case nil:
+		return Value{Null: true}
+	case []byte:
+		return Value{Value: string(t)}
+	default:
+		return Value{Value: fmt.Sprint(t)}
+	}
+}
+
+// ResolveTable returns the statement resolving all the conflicts of a table
+func ResolveTable(table string, resolution Resolution) (string, error) {
+	if !validName.MatchString(table) {
+		return "", fmt.Errorf("invalid table name '%s'", table)
+	}
+	if _, err := ParseResolution(string(resolution)); err != nil {
+		return "", err
+	}
+	if resolution == Latest {
+		return "", fmt.Errorf("the latest versions are picked row by row")
+	}
+	if resolution == Merge {
+		return "", fmt.Errorf("the mergeable columns are merged row by row")
+	}
+	return fmt.Sprintf("CALL DOLT_CONFLICTS_RESOLVE('--%s', '%s');", resolution, table), nil
+}
+
+// ResolveRow returns the statements resolving a single conflicting row. Our
+// version is already in the table, so keeping it only clears the conflict.
+// Their version is written over it first.
+func ResolveRow(row Row, resolution Resolution) (string, error) {
+	if !validName.MatchString(row.Table) {
+		return "", fmt.Errorf("invalid table name '%s'", row.Table)
+	}
+	if !validID.MatchString(row.ID) {
+		return "", fmt.Errorf("invalid conflict id '%s'", row.ID)
+	}
+	for _, column := range row.Columns {
+		if !validName.MatchString(column) {
+			return "", fmt.Errorf("invalid column name '%s'", column)
+		}
+	}
+
+	clear := fmt.Sprintf("DELETE FROM `dolt_conflicts_%s` WHERE dolt_conflict_id = '%s';", row.Table, row.ID)
+	switch resolution {
+	case Ours:
+		return clear, nil
+	case Theirs:
+		if row.TheirDiffType == "removed" {
+			if row.OurDiffType == "removed" {
+				return clear, nil
+			}
+			return fmt.Sprintf("DELETE FROM `%s` WHERE %s;\n%s", row.Table, matchRow(row.Columns, row.Ours), clear), nil
+		}
+		columns := make([]string, len(row.Columns))
+		values := make([]string, len(row.Columns))
+		for i, column := range row.Columns {
+			columns[i] = "`" + column + "`"
+			values[i] = literal(row.Theirs[column])
+		}
+		replace := fmt.Sprintf("REPLACE INTO `%s` (%s) VALUES (%s);", row.Table, strings.Join(columns, ", "), strings.Join(values, ", "))
+		if row.OurDiffType == "removed" {
+			return replace + "\n" + clear, nil
+		}
+		// the primary key may differ, so our version is removed first
+		return fmt.Sprintf("DELETE FROM `%s` WHERE %s;\n%s\n%s", row.Table, matchRow(row.Columns, row.Ours), replace, clear), nil
+	default:
+		return "", fmt.Errorf("unknown resolution '%s', expected ours or theirs", resolution)
+	}
+}
+
+// version returns when the commit at rev was made
+func version(db Querier, rev string) (Version, error) {
+	if !validID.MatchString(rev) {
+		return Version{}, fmt.Errorf("invalid revision '%s'", rev)
+	}
+	rows, err := db.Query(fmt.Sprintf("SELECT commit_hash, date, message FROM dolt_log('%s') LIMIT 1;", rev))
+	if err != nil {
+		return Version{}, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return Version{}, err
+		}
+		return Version{}, fmt.Errorf("commit '%s' not found", rev)
+	}
+	var date any
+	v := Version{}
+	msg := ""
+	if err := rows.Scan(&v.Commit, &date, &msg); err != nil {
+		return Version{}, err
+	}
+	v.Date = asTime(date)
+	v.HLC, _ = hlc.FromMessage(msg)
+	return v, nil
+}
+
+func asTime(v any) time.Time {
+	switch t := v.(type) {
+	case time.Time:
+		return t
+	case []byte:
+		return parseTime(string(t))
+	case string:
+		return parseTime(t)
+	default:
+		return time.Time{}
+	}
+}
+
+func parseTime(s string) time.Time {
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999", time.RFC3339Nano} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func matchRow(columns []string, values map[string]Value) string {
+	conditions := make([]string, len(columns))
+	for i, column := range columns {
+		conditions[i] = fmt.Sprintf("`%s` <=> %s", column, literal(values[column]))
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+func literal(v Value) string {
+	if v.Null {
+		return "NULL"
+	}
+	s := strings.ReplaceAll(v.Value, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `''`)
+	return "'" + s + "'"
+}
+
+// Format renders a conflicting row with the base, our and their values side
+// by side
+func Format(row Row) string {
+	header := []string{"column", "base", "ours", "theirs"}
+	lines := [][]string{header}
+	for _, column := range row.Columns {
+		lines = append(lines, []string{column, row.Base[column].String(), row.Ours[column].String(), row.Theirs[column].String()})
+	}
+
+	widths := make([]int, len(header))
+	for _, line := range lines {
+		for i, cell := range line {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "%s %s (ours: %s, theirs: %s)\n", row.Table, row.ID, row.OurDiffType, row.TheirDiffType)
+	for _, line := range lines {
+		cells := make([]string, len(line))
+		for i, cell := range line {
+			cells[i] = fmt.Sprintf("%-*s", widths[i], cell)
+		}
+		b.WriteString(strings.TrimRight(strings.Join(cells, " | "), " ") + "\n")
+	}
+	return b.String()
+}
+
+// CommitFunc executes a statement and commits it, so that the resolution is
+// replicated to every node
+type CommitFunc func(query string, commitMsg string) (string, error)
+
+// Resolver lists the conflicts and commits their resolution
+type Resolver struct {
+	db        Querier
+	commit    CommitFunc
+	order     Order
+	mergeable Columns
+}
+
+// NewResolver creates a resolver committing with the commit function. The
+// latest versions are picked with the given order, and the concurrent updates
+// of the mergeable columns are merged.
+func NewResolver(db Querier, commit CommitFunc, order Order, mergeable Columns) *Resolver {
+	return &Resolver{db: db, commit: commit, order: order, mergeable: mergeable}
+}
+
+// Tables returns the tables with conflicts
+func (r *Resolver) Tables() ([]Table, error) {
+	return Tables(r.db)
+}
+
+// Rows returns the conflicting rows of a table
+func (r *Resolver) Rows(table string) ([]Row, error) {
+	return Rows(r.db, table)
+}
+
+// Resolve resolves a conflicting row, or all the conflicts of the table if id
+// is empty, and returns the hash of the commit
+func (r *Resolver) Resolve(table string, id string, resolution Resolution) (string, error) {
+	var statement string
+	var err error
+	if resolution == Latest {
+		statement, err = r.resolveLatest(table, id)
+	} else if resolution == Merge {
+		statement, _, err = r.resolveMerged(table, id, false)
+	} else if id == "" {
+		statement, err = ResolveTable(table, resolution)
+	} else {
+		var rows []Row
+		rows, err = Rows(r.db, table)
+		if err != nil {
+			return "", err
+		}
+		found := false
+		for _, row := range rows {
+			if row.ID == id {
+				statement, err = ResolveRow(row, resolution)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("conflict '%s' not found in table '%s'", id, table)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	msg := fmt.Sprintf("Resolve conflicts in %s using %s", table, resolution)
+	if id != "" {
+		msg = fmt.Sprintf("Resolve conflict %s in %s using %s", id, table, resolution)
+	}
+	return r.commit(statement, msg)
+}
+
+// resolveLatest returns the statements keeping the most recent version of the
+// conflicting rows of a table, or of a single row if id is set
+func (r *Resolver) resolveLatest(table string, id string) (string, error) {
+	rows, err := Rows(r.db, table)
+	if err != nil {
+		return "", err
+	}
+	versions, err := r.versions()
+	if err != nil {
+		return "", err
+	}
+	statements := []string{}
+	for _, row := range rows {
+		if id != "" && row.ID != id {
+			continue
+		}
+		newer, err := versions.theirsNewer(row)
+		if err != nil {
+			return "", err
+		}
+		resolution := Ours
+		if newer {
+			resolution = Theirs
+		}
+		statement, err := ResolveRow(row, resolution)
+		if err != nil {
+			return "", err
+		}
+		statements = append(statements, statement)
+	}
+	if len(statements) == 0 {
+		if id != "" {
+			return "", fmt.Errorf("conflict '%s' not found in table '%s'", id, table)
+		}
+		return "", fmt.Errorf("no conflicts in table '%s'", table)
+	}
+	return strings.Join(statements, "\n"), nil
+}
+
+// resolveMerged returns the statements merging the mergeable columns of the
+// conflicting rows of a table, or of a single row if id is set, and the number
+// of merged rows. With partial, the rows that aren't mergeable are skipped
+// instead of failing the resolution.
+func (r *Resolver) resolveMerged(table string, id string, partial bool) (string, int, error) {
+	columns, found := r.mergeable[table]
+	if !found {
+		return "", 0, fmt.Errorf("table '%s' has no mergeable columns", table)
+	}
+	rows, err := Rows(r.db, table)
+	if err != nil {
+		return "", 0, err
+	}
+	versions, err := r.versions()
+	if err != nil {
+		return "", 0, err
+	}
+	statements := []string{}
+	for _, row := range rows {
+		if id != "" && row.ID != id {
+			continue
+		}
+		newer, err := versions.theirsNewer(row)
+		if err != nil {
+			return "", 0, err
+		}
+		statement, err := MergeRow(row, columns, newer)
+		if partial && errors.Is(err, ErrNotMergeable) {
+			continue
+		}
+		if err != nil {
+			return "", 0, fmt.Errorf("conflict '%s' in table '%s': %w", row.ID, table, err)
+		}
+		statements = append(statements, statement)
+	}
+	if len(statements) == 0 && !partial {
+		if id != "" {
+			return "", 0, fmt.Errorf("conflict '%s' not found in table '%s'", id, table)
+		}
+		return "", 0, fmt.Errorf("no conflicts in table '%s'", table)
+	}
+	return strings.Join(statements, "\n"), len(statements), nil
+}
+
+// AutoMerge resolves the conflicting rows of the tables with mergeable columns
+// whose concurrent updates only touch mergeable columns, so that these updates
+// never wait for a manual resolution. It returns the number of merged rows.
+func (r *Resolver) AutoMerge() (int, error) {
+	if len(r.mergeable) == 0 {
+		return 0, nil
+	}
+	tables, err := Tables(r.db)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, table := range tables {
+		if _, found := r.mergeable[table.Name]; !found {
+			continue
+		}
+		statement, merged, err := r.resolveMerged(table.Name, "", true)
+		if err != nil {
+			return total, err
+		}
+		if merged == 0 {
+			continue
+		}
+		_, err = r.commit(statement, fmt.Sprintf("Merge %d conflicting rows in %s using mergeable columns", merged, table.Name))
+		if err != nil {
+			return total, err
+		}
+		total += merged
+	}
+	return total, nil
+}
+
+// versions dates the two sides of conflicting rows. Our version is dated by
+// our head and theirs by the merged commit.
+type versions struct {
+	db     Querier
+	order  Order
+	ours   Version
+	theirs map[string]Version
+}
+
+func (r *Resolver) versions() (*versions, error) {
+	ours, err := version(r.db, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	return &versions{db: r.db, order: r.order, ours: ours, theirs: map[string]Version{}}, nil
+}
+
+// theirsNewer returns true if their version of a row is the most recent
+func (v *versions) theirsNewer(row Row) (bool, error) {
+	theirs, found := v.theirs[row.TheirCommit]
+	if !found {
+		var err error
+		theirs, err = version(v.db, row.TheirCommit)
+		if err != nil {
+			return false, err
+		}
+		v.theirs[row.TheirCommit] = theirs
+	}
+	return theirs.newer(v.ours, v.order), nil
+}
@@ -0,0 +1,176 @@
+package conflicts
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/hlc"
+)
+
+func TestParseRow(t *testing.T) {
+	columns := []string{"from_root_ish", "base_id", "base_name", "our_id", "our_name", "our_diff_type", "their_id", "their_name", "their_diff_type", "dolt_conflict_id"}
+	values := []any{[]byte("abc"), []byte("1"), []byte("a"), []byte("1"), []byte("b"), []byte("modified"), []byte("1"), nil, []byte("modified"), []byte("xyz")}
+
+	row := parseRow("t", columns, values)
+	if row.ID != "xyz" || row.TheirCommit != "abc" || row.OurDiffType != "modified" || row.TheirDiffType != "modified" {
+		t.Fatalf("unexpected row %+v", row)
+	}
+	if strings.Join(row.Columns, ",") != "id,name" {
+		t.Errorf("unexpected columns %v", row.Columns)
+	}
+	if row.Base["name"].Value != "a" || row.Ours["name"].Value != "b" || !row.Theirs["name"].Null {
+		t.Errorf("unexpected values %+v", row)
+	}
+}
+
+func TestResolveRow(t *testing.T) {
+	row := Row{
+		ID:            "xyz",
+		Table:         "t",
+		Columns:       []string{"id", "name"},
+		Ours:          map[string]Value{"id": {Value: "1"}, "name": {Value: "it's"}},
+		Theirs:        map[string]Value{"id": {Value: "1"}, "name": {Null: true}},
+		OurDiffType:   "modified",
+		TheirDiffType: "modified",
+	}
+
+	ours, err := ResolveRow(row, Ours)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ours != "DELETE FROM `dolt_conflicts_t` WHERE dolt_conflict_id = 'xyz';" {
+		t.Errorf("unexpected statement %q", ours)
+	}
+
+	theirs, err := ResolveRow(row, Theirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "DELETE FROM `t` WHERE `id` <=> '1' AND `name` <=> 'it''s';\n" +
+		"REPLACE INTO `t` (`id`, `name`) VALUES ('1', NULL);\n" +
+		"DELETE FROM `dolt_conflicts_t` WHERE dolt_conflict_id = 'xyz';"
+	if theirs != want {
+		t.Errorf("got %q, want %q", theirs, want)
+	}
+
+	row.TheirDiffType = "removed"
+	removed, err := ResolveRow(row, Theirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(removed, "DELETE FROM `t` WHERE") || strings.Contains(removed, "REPLACE") {
+		t.Errorf("unexpected statement %q", removed)
+	}
+
+	row.ID = "x'; DROP TABLE t; --"
+	if _, err := ResolveRow(row, Ours); err == nil {
+		t.Error("expected an error for an invalid conflict id")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	row := Row{
+		ID:            "xyz",
+		Table:         "t",
+		Columns:       []string{"id", "name"},
+		Base:          map[string]Value{"id": {Value: "1"}, "name": {Value: "a"}},
+		Ours:          map[string]Value{"id": {Value: "1"}, "name": {Value: "bb"}},
+		Theirs:        map[string]Value{"id": {Value: "1"}, "name": {Null: true}},
+		OurDiffType:   "modified",
+		TheirDiffType: "modified",
+	}
+	want := "t xyz (ours: modified, theirs: modified)\n" +
+		"column | base | ours | theirs\n" +
+		"id     | 1    | 1    | 1\n" +
+		"name   | a    | bb   | NULL\n"
+	if got := Format(row); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestVersionOrder(t *testing.T) {
+	now := time.Now()
+	// theirs was written after ours, by a node with a clock an hour behind
+	ours := Version{Commit: "a", Date: now, HLC: hlc.Timestamp{Wall: now.UnixNano()}}
+	theirs := Version{Commit: "b", Date: now.Add(-time.Hour), HLC: hlc.Timestamp{Wall: now.UnixNano(), Logical: 1}}
+
+	if theirs.newer(ours, WallClock) {
+		t.Errorf("expected the commit dates to favor ours")
+	}
+	if !theirs.newer(ours, HybridClock) || ours.newer(theirs, HybridClock) {
+		t.Errorf("expected the hybrid timestamps to favor theirs")
+	}
+
+	theirs.HLC = hlc.Timestamp{}
+	if theirs.newer(ours, HybridClock) {
+		t.Errorf("expected versions without a timestamp to be ordered by date")
+	}
+
+	theirs.Date = now
+	if !theirs.newer(ours, WallClock) || ours.newer(theirs, WallClock) {
+		t.Errorf("expected ties to be broken by commit hash")
+	}
+}
+
+func TestMergeRow(t *testing.T) {
+	row := Row{
+		ID:            "xyz",
+		Table:         "inventory",
+		Columns:       []string{"id", "stock", "tags", "status", "name"},
+		Base:          map[string]Value{"id": {Value: "1"}, "stock": {Value: "10"}, "tags": {Value: `["a", "b"]`}, "status": {Value: "new"}, "name": {Value: "box"}},
+		Ours:          map[string]Value{"id": {Value: "1"}, "stock": {Value: "7"}, "tags": {Value: `["a","b","c"]`}, "status": {Value: "sold"}, "name": {Value: "box"}},
+		Theirs:        map[string]Value{"id": {Value: "1"}, "stock": {Value: "15"}, "tags": {Value: `["b","d"]`}, "status": {Value: "held"}, "name": {Value: "crate"}},
+		OurDiffType:   "modified",
+		TheirDiffType: "modified",
+	}
+	columns := map[string]MergeType{"stock": Counter, "tags": Set, "status": LastWriterWins}
+
+	merged, err := MergeRow(row, columns, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "UPDATE `inventory` SET `stock` = '12', `tags` = '[\"b\",\"c\",\"d\"]', `status` = 'held', `name` = 'crate' WHERE " + matchRow(row.Columns, row.Ours) + ";\n" +
+		"DELETE FROM `dolt_conflicts_inventory` WHERE dolt_conflict_id = 'xyz';"
+	if merged != want {
+		t.Errorf("got %q, want %q", merged, want)
+	}
+	if merged, err = MergeRow(row, columns, false); err != nil || strings.Contains(merged, "`status` =") {
+		t.Errorf("expected our status to win, got %q (%v)", merged, err)
+	}
+
+	// concurrent updates of other columns are left for a manual resolution
+	row.Ours["name"] = Value{Value: "bin"}
+	if _, err := MergeRow(row, columns, true); !errors.Is(err, ErrNotMergeable) {
+		t.Errorf("expected the row not to be mergeable, got %v", err)
+	}
+	row.Ours["name"] = row.Base["name"]
+	row.TheirDiffType = "removed"
+	if _, err := MergeRow(row, columns, true); !errors.Is(err, ErrNotMergeable) {
+		t.Errorf("expected a removed row not to be mergeable, got %v", err)
+	}
+}
+
+func TestMergeValues(t *testing.T) {
+	counter, err := mergeCounter(Value{Null: true}, Value{Value: "1.5"}, Value{Value: "2"})
+	if err != nil || counter.Value != "3.5" {
+		t.Errorf("unexpected counter %v (%v)", counter, err)
+	}
+	if _, err := mergeCounter(Value{Value: "1"}, Value{Value: "x"}, Value{Value: "2"}); err == nil {
+		t.Error("expected an error for a counter that isn't a number")
+	}
+	set, err := mergeSet(Value{Null: true}, Value{Value: `[2, "a"]`}, Value{Value: `[1]`})
+	if err != nil || set.Value != `["a",1,2]` {
+		t.Errorf("unexpected set %v (%v)", set, err)
+	}
+
+	columns := Columns{"inventory": {"stock": Counter}}
+	if err := columns.Validate(); err != nil {
+		t.Error(err)
+	}
+	columns["inventory"]["tags"] = "bag"
+	if err := columns.Validate(); err == nil {
+		t.Error("expected an error for an unknown merge type")
+	}
+}
@@ -0,0 +1,224 @@
+package conflicts
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MergeType is how the concurrent updates of a mergeable column are combined
+type MergeType string
+
+const (
+	// Counter adds the changes made on both sides to the base value
+	Counter MergeType = "counter"
+	// Set keeps the elements added on either side and drops the elements
+	// removed on either side. Sets are stored as JSON arrays.
+	Set MergeType = "set"
+	// LastWriterWins keeps the value of the most recent version
+	LastWriterWins MergeType = "lww"
+)
+
+// ErrNotMergeable is returned for conflicting rows with concurrent updates of
+// columns that aren't mergeable
+var ErrNotMergeable = errors.New("row is not mergeable")
+
+// Columns maps tables to their mergeable columns
+type Columns map[string]map[string]MergeType
+
+// LoadColumns reads the mergeable columns from a JSON file, e.g.
+// {"inventory": {"stock": "counter", "tags": "set", "status": "lww"}}
+func LoadColumns(path string) (Columns, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mergeable columns: %w", err)
+	}
+	columns := Columns{}
+	err = json.Unmarshal(data, &columns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse mergeable columns '%s': %w", path, err)
+	}
+	return columns, columns.Validate()
+}
+
+// Validate checks the names and merge types of the columns
+func (c Columns) Validate() error {
+	for table, columns := range c {
+		if !validName.MatchString(table) {
+			return fmt.Errorf("invalid table name '%s'", table)
+		}
+		for column, t := range columns {
+			if !validName.MatchString(column) {
+				return fmt.Errorf("invalid column name '%s' in table '%s'", column, table)
+			}
+			switch t {
+			case Counter, Set, LastWriterWins:
+			default:
+				return fmt.Errorf("unknown merge type '%s' for column '%s.%s', expected counter, set or lww", t, table, column)
+			}
+		}
+	}
+	return nil
+}
+
+// MergeRow returns the statements merging the concurrent updates of a
+// conflicting row. Columns changed on a single side keep that change, and
+// columns changed on both sides are merged with the function of their type.
+// theirsNewer tells which side wins the last-writer-wins columns. Rows that
+// were removed on a side, or that have concurrent updates of other columns,
+// return ErrNotMergeable.
+func MergeRow(row Row, columns map[string]MergeType, theirsNewer bool) (string, error) {
+	if !validName.MatchString(row.Table) {
+		return "", fmt.Errorf("invalid table name '%s'", row.Table)
+	}
+	if !validID.MatchString(row.ID) {
+		return "", fmt.Errorf("invalid conflict id '%s'", row.ID)
+	}
+	if row.OurDiffType != row.TheirDiffType || (row.OurDiffType != "modified" && row.OurDiffType != "added") {
+		return "", fmt.Errorf("%w: %s on our side and %s on theirs", ErrNotMergeable, row.OurDiffType, row.TheirDiffType)
+	}
+
+	assignments := []string{}
+	for _, column := range row.Columns {
+		if !validName.MatchString(column) {
+			return "", fmt.Errorf("invalid column name '%s'", column)
+		}
+		base, ours, theirs := row.Base[column], row.Ours[column], row.Theirs[column]
+		if theirs == ours || theirs == base {
+			continue
+		}
+		merged := theirs
+		if ours != base {
+			t, found := columns[column]
+			if !found {
+				return "", fmt.Errorf("%w: column '%s' was changed on both sides", ErrNotMergeable, column)
+			}
+			var err error
+			merged, err = mergeValue(t, base, ours, theirs, theirsNewer)
+			if err != nil {
+				return "", fmt.Errorf("failed to merge column '%s': %w", column, err)
+			}
+			if merged == ours {
+				continue
+			}
+		}
+		assignments = append(assignments, fmt.Sprintf("`%s` = %s", column, literal(merged)))
+	}
+
+	clear := fmt.Sprintf("DELETE FROM `dolt_conflicts_%s` WHERE dolt_conflict_id = '%s';", row.Table, row.ID)
+	if len(assignments) == 0 {
+		return clear, nil
+	}
+	update := fmt.Sprintf("UPDATE `%s` SET %s WHERE %s;", row.Table, strings.Join(assignments, ", "), matchRow(row.Columns, row.Ours))
+	return update + "\n" + clear, nil
+}
+
+// mergeValue merges the values of a column changed on both sides
+func mergeValue(t MergeType, base Value, ours Value, theirs Value, theirsNewer bool) (Value, error) {
+	switch t {
+	case Counter:
+		return mergeCounter(base, ours, theirs)
+	case Set:
+		return mergeSet(base, ours, theirs)
+	case LastWriterWins:
+		if theirsNewer {
+			return theirs, nil
+		}
+		return ours, nil
+	default:
+		return Value{}, fmt.Errorf("unknown merge type '%s'", t)
+	}
+}
+
+// mergeCounter returns ours + theirs - base. NULLs count as zero, and the
+// counters are merged as integers unless one of the values is fractional.
+func mergeCounter(base Value, ours Value, theirs Value) (Value, error) {
+	values := []Value{base, ours, theirs}
+	ints := make([]int64, len(values))
+	isInt := true
+	for i, v := range values {
+		if v.Null {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(v.Value), 10, 64)
+		if err != nil {
+			isInt = false
+			break
+		}
+		ints[i] = n
+	}
+	if isInt {
+		return Value{Value: strconv.FormatInt(ints[1]+ints[2]-ints[0], 10)}, nil
+	}
+
+	floats := make([]float64, len(values))
+	for i, v := range values {
+		if v.Null {
+			continue
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(v.Value), 64)
+		if err != nil {
+			return Value{}, fmt.Errorf("counter value '%s' is not a number", v.Value)
+		}
+		floats[i] = f
+	}
+	return Value{Value: strconv.FormatFloat(floats[1]+floats[2]-floats[0], 'f', -1, 64)}, nil
+}
+
+// mergeSet keeps the elements that are on both sides, and the elements added
+// on either side since the base. NULLs are empty sets. The elements are
+// sorted so that every node merges the same set.
+func mergeSet(base Value, ours Value, theirs Value) (Value, error) {
+	baseSet, err := parseSet(base)
+	if err != nil {
+		return Value{}, err
+	}
+	ourSet, err := parseSet(ours)
+	if err != nil {
+		return Value{}, err
+	}
+	theirSet, err := parseSet(theirs)
+	if err != nil {
+		return Value{}, err
+	}
+
+	merged := []string{}
+	for e := range ourSet {
+		if theirSet[e] || !baseSet[e] {
+			merged = append(merged, e)
+		}
+	}
+	for e := range theirSet {
+		if !ourSet[e] && !baseSet[e] {
+			merged = append(merged, e)
+		}
+	}
+	sort.Strings(merged)
+	return Value{Value: "[" + strings.Join(merged, ",") + "]"}, nil
+}
+
+// parseSet returns the elements of a JSON array, keyed by their compact JSON
+// encoding
+func parseSet(v Value) (map[string]bool, error) {
+	set := map[string]bool{}
+	if v.Null || strings.TrimSpace(v.Value) == "" {
+		return set, nil
+	}
+	elements := []json.RawMessage{}
+	if err := json.Unmarshal([]byte(v.Value), &elements); err != nil {
+		return nil, fmt.Errorf("set value '%s' is not a JSON array: %w", v.Value, err)
+	}
+	for _, e := range elements {
+		compacted := bytes.Buffer{}
+		if err := json.Compact(&compacted, e); err != nil {
+			return nil, err
+		}
+		set[compacted.String()] = true
+	}
+	return set, nil
+}
@@ -0,0 +1,170 @@
+// Package crash handles the panics of the node subsystems. Every panic is
+// written as a report with its stack trace to the crash directory, and then
+// handled according to the configured policy.
+package crash
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// restartDelay is the time waited before a subsystem is restarted, so that a
+// subsystem panicking in a loop doesn't spin
+const restartDelay = time.Second
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// Policy decides what happens after a panic
+type Policy string
+
+const (
+	// PolicyLog logs the panic and lets the subsystem stop. RPC handlers keep
+	// serving the following calls.
+	PolicyLog Policy = "log"
+	// PolicyRestart restarts the subsystem that panicked. It behaves like
+	// PolicyLog for RPC handlers, since every call starts afresh.
+	PolicyRestart Policy = "restart"
+	// PolicyCrash exits the process, e.g. to let a supervisor restart it
+	PolicyCrash Policy = "crash"
+)
+
+// ParsePolicy parses a policy name
+func ParsePolicy(s string) (Policy, error) {
+	switch Policy(s) {
+	case PolicyLog, PolicyRestart, PolicyCrash:
+		return Policy(s), nil
+	default:
+		return "", fmt.Errorf("unknown panic policy '%s', expected log, restart or crash", s)
+	}
+}
+
+// Report describes a panic
+type Report struct {
+	Time      time.Time `json:"time"`
+	Subsystem string    `json:"subsystem"`
+	Panic     string    `json:"panic"`
+	Stack     string    `json:"stack"`
+	Policy    Policy    `json:"policy"`
+}
+
+// Reporter writes crash reports and applies the panic policy. A nil Reporter
+// logs panics and lets the subsystem stop.
+type Reporter struct {
+	dir     string
+	policy  Policy
+	log     *logrus.Logger
+	crashes atomic.Int64
+	// exit is replaced in tests
+	exit func(code int)
+}
+
+// NewReporter creates a reporter writing to the crash directory
+func NewReporter(dir string, policy Policy, logger *logrus.Logger) (*Reporter, error) {
+	if _, err := ParsePolicy(string(policy)); err != nil {
+		return nil, err
+	}
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create crash directory: %w", err)
+	}
+	return &Reporter{dir: dir, policy: policy, log: logger, exit: os.Exit}, nil
+}
+
+// Policy returns the panic policy
+func (r *Reporter) Policy() Policy {
+	if r == nil {
+		return PolicyLog
+	}
+	return r.policy
+}
+
+// Dir returns the crash directory
+func (r *Reporter) Dir() string {
+	if r == nil {
+		return ""
+	}
+	return r.dir
+}
+
+// Crashes returns the number of panics recovered since the node started
+func (r *Reporter) Crashes() int64 {
+	if r == nil {
+		return 0
+	}
+	return r.crashes.Load()
+}
+
+// HandlePanic reports a recovered panic. It exits the process with the crash
+// policy.
+func (r *Reporter) HandlePanic(subsystem string, recovered any, stack []byte) {
+	if r == nil {
+		logrus.StandardLogger().Errorf("panic in %s: %v\n%s", subsystem, recovered, stack)
+		return
+	}
+	r.crashes.Add(1)
+	report := Report{
+		Time:      time.Now().UTC(),
+		Subsystem: subsystem,
+		Panic:     fmt.Sprint(recovered),
+		Stack:     string(stack),
+		Policy:    r.policy,
+	}
+	path, err := r.write(report)
+	if err != nil {
+		r.log.Errorf("panic in %s: %v\n%s", subsystem, recovered, stack)
+		r.log.Errorf("Failed to write crash report: %v", err)
+	} else {
+		r.log.Errorf("panic in %s: %v. Crash report written to %s", subsystem, recovered, path)
+	}
+
+	if r.policy == PolicyCrash {
+		r.exit(2)
+	}
+}
+
+func (r *Reporter) write(report Report) (string, error) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("crash-%s-%s.json", report.Time.Format("20060102T150405.000000000"), unsafeChars.ReplaceAllString(report.Subsystem, "_"))
+	path := filepath.Join(r.dir, name)
+	return path, os.WriteFile(path, data, 0600)
+}
+
+// Go runs a subsystem in a goroutine. If it panics, the panic is reported and,
+// with the restart policy, the subsystem is started again.
+func (r *Reporter) Go(subsystem string, fn func()) {
+	go func() {
+		for {
+			if !r.run(subsystem, fn) {
+				return
+			}
+			if r.Policy() != PolicyRestart {
+				return
+			}
+			time.Sleep(restartDelay)
+			r.log.Infof("Restarting %s", subsystem)
+		}
+	}()
+}
+
+// run calls fn and returns true if it panicked
+func (r *Reporter) run(subsystem string, fn func()) (panicked bool) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			panicked = true
+			r.HandlePanic(subsystem, recovered, debug.Stack())
+		}
+	}()
+	fn()
+	return false
+}
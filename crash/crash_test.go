@@ -0,0 +1,72 @@
+package crash
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestReporter(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewReporter(dir, PolicyRestart, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runs := atomic.Int32{}
+	done := make(chan struct{})
+	r.Go("worker/1", func() {
+		if runs.Add(1) == 1 {
+			panic("boom")
+		}
+		close(done)
+	})
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subsystem was not restarted")
+	}
+	if r.Crashes() != 1 {
+		t.Errorf("expected 1 crash, got %d", r.Crashes())
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "crash-*-worker_1.json"))
+	if len(paths) != 1 {
+		t.Fatalf("expected a crash report, got %v", paths)
+	}
+	data, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := Report{}
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Panic != "boom" || report.Subsystem != "worker/1" || report.Stack == "" {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestCrashPolicy(t *testing.T) {
+	r, err := NewReporter(t.TempDir(), PolicyCrash, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := -1
+	r.exit = func(c int) { code = c }
+
+	r.run("worker", func() { panic("boom") })
+	if code != 2 {
+		t.Errorf("expected the process to exit with code 2, got %d", code)
+	}
+
+	if _, err := ParsePolicy("ignore"); err == nil {
+		t.Error("expected an error for an unknown policy")
+	}
+}
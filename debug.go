@@ -0,0 +1,345 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	debugLogLines = 5000
+	pidFile       = "server.pid"
+)
+
+var recentLogs = &logBuffer{size: debugLogLines}
+var debugConfig = map[string]string{}
+
+var secretWords = []string{"key", "secret", "token", "password", "passwd", "credential"}
+
+// logBuffer is a logrus hook that keeps the most recent log lines in memory so
+// they can be included in a diagnostic bundle
+type logBuffer struct {
+	mtx   sync.Mutex
+	size  int
+	lines []string
+}
+
+func (lb *logBuffer) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (lb *logBuffer) Fire(entry *logrus.Entry) error {
+	line, err := entry.String()
+	if err != nil {
+		return err
+	}
+	lb.mtx.Lock()
+	defer lb.mtx.Unlock()
+	lb.lines = append(lb.lines, line)
+	if len(lb.lines) > lb.size {
+		lb.lines = lb.lines[len(lb.lines)-lb.size:]
+	}
+	return nil
+}
+
+func (lb *logBuffer) String() string {
+	lb.mtx.Lock()
+	defer lb.mtx.Unlock()
+	return strings.Join(lb.lines, "")
+}
+
+// collectConfig returns the value of every flag, with secrets redacted
+func collectConfig(ctx *cli.Context) map[string]string {
+	config := map[string]string{}
+	flags := append([]cli.Flag{}, ctx.App.Flags...)
+	if ctx.Command != nil {
+		flags = append(flags, ctx.Command.Flags...)
+	}
+	for _, flag := range flags {
+		name := flag.Names()[0]
+		config[name] = redact(name, fmt.Sprint(ctx.Value(name)))
+	}
+	return config
+}
+
+func redact(name string, value string) string {
+	for _, word := range secretWords {
+		if strings.Contains(strings.ToLower(name), word) {
+			return "REDACTED"
+		}
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		u.User = url.User("REDACTED")
+		return u.String()
+	}
+	return value
+}
+
+// syncState reports the local head, the head of every connected peer and the
+// requests that are waiting to be replayed
+func syncState() map[string]any {
+	state := map[string]any{"in_flight": p2pmgr.InFlight()}
+	head, err := dbi.GetLastCommit("main")
+	if err != nil {
+		state["head_error"] = err.Error()
+	} else {
+		state["head"] = head.Hash
+	}
+
+	peers := map[string]string{}
+	for _, client := range p2pmgr.GetClients() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		resp, err := client.GetHead(ctx, &p2pproto.GetHeadRequest{})
+		cancel()
+		if err != nil {
+			peers[client.GetID()] = "error: " + err.Error()
+			continue
+		}
+		peers[client.GetID()] = resp.Commit
+	}
+	state["peer_heads"] = peers
+	return state
+}
+
+func dbStats() map[string]any {
+	stats := map[string]any{
+		"storage_dir":  storageBackend.Dir(),
+		"peer_id":      p2pmgr.GetID(),
+		"leader":       p2pmgr.Leader(),
+		"bandwidth":    p2pmgr.TotalBandwidth(),
+		"rpc_lanes":    p2pmgr.RPCLanes(),
+		"protocols":    p2pmgr.Protocols().Protocols(),
+		"services":     p2pmgr.Protocols().Services(),
+		"clock_skews":  p2pmgr.ClockSkews(),
+		"leases":       p2pmgr.Leases(),
+		"sessions":     sessionServer.Sessions(),
+		"zones":        p2pmgr.ZoneStats(),
+		"database":     p2pmgr.DatabaseIdentity(),
+		"drain":        p2pmgr.DrainStatus(),
+		"remote_reads": p2pmgr.RemoteReadStats(),
+		"handlers":     p2pmgr.MessageHandlerStats(),
+		"deadlines":    p2pmgr.DeadlineStats(),
+	}
+	if pluginRuntime != nil {
+		loaded := []*p2pproto.PluginInfo{}
+		for _, plugin := range pluginRuntime.Plugins() {
+			loaded = append(loaded, plugin.Info())
+		}
+		stats["plugins"] = loaded
+	}
+	if protoDumper != nil {
+		stats["proto_dump"] = protoDumper.Status()
+	}
+	if approvalStore != nil {
+		stats["approvals_waiting"] = approvalStore.Waiting()
+	}
+	if snapshotInfo != nil {
+		stats["snapshot"] = snapshotInfo
+	}
+	if startupReport != nil {
+		stats["startup_check"] = startupReport
+	}
+	if tableCrypt != nil {
+		stats["encryption"] = tableCrypt.Tables()
+	}
+	if usage, guarded := p2pmgr.DiskUsage(); guarded {
+		stats["disk"] = usage
+	}
+	if usage, governed := p2pmgr.ResourceUsage(); governed {
+		stats["resources"] = usage
+	}
+	commits, err := dbi.GetAllCommits()
+	if err != nil {
+		stats["commits_error"] = err.Error()
+	} else {
+		stats["commits"] = len(commits)
+	}
+	metrics := map[string]float64{}
+	for _, name := range metricNames {
+		if samples := metricsStore.Last(name, 1); len(samples) > 0 {
+			metrics[name] = samples[0].Value
+		}
+	}
+	stats["metrics"] = metrics
+	return stats
+}
+
+// writeDebugBundle gathers the state of the node into a gzipped tar archive
+func writeDebugBundle(path string) error {
+	files := map[string][]byte{}
+
+	var goroutines bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&goroutines, 2); err != nil {
+		return fmt.Errorf("failed to dump goroutines: %w", err)
+	}
+	files["goroutines.txt"] = goroutines.Bytes()
+	files["logs.txt"] = []byte(recentLogs.String())
+
+	peers := p2pmgr.PeerVersions()
+	addrBook, err := os.ReadFile(filepath.Join(workDir, "addrbook.json"))
+	if err == nil {
+		files["addrbook.json"] = addrBook
+	}
+	if crashReporter.Dir() != "" {
+		reports, _ := filepath.Glob(filepath.Join(crashReporter.Dir(), "crash-*.json"))
+		for _, report := range reports {
+			data, err := os.ReadFile(report)
+			if err == nil {
+				files["crashes/"+filepath.Base(report)] = data
+			}
+		}
+	}
+
+	sections := map[string]any{
+		"peers.json":  peers,
+		"sync.json":   syncState(),
+		"config.json": debugConfig,
+		"db.json":     dbStats(),
+		"health.json": map[string]any{
+			"ready":      p2pmgr.Ready(),
+			"subsystems": p2pmgr.Health(),
+		},
+		"runtime.json": map[string]any{
+			"go_version": runtime.Version(),
+			"goroutines": runtime.NumGoroutine(),
+			"time":       time.Now().UTC(),
+		},
+	}
+	for name, section := range sections {
+		data, err := json.MarshalIndent(section, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", name, err)
+		}
+		files[name] = data
+	}
+
+	tmpFile := path + ".tmp"
+	f, err := os.Create(tmpFile)
+	if err != nil {
+		return fmt.Errorf("failed to create debug bundle: %w", err)
+	}
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	for name, data := range files {
+		hdr := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: time.Now()}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, path)
+}
+
+// startDebugHandler writes a diagnostic bundle to the working directory every
+// time the process receives SIGUSR1
+func startDebugHandler() func() error {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1)
+	stopSignal := make(chan struct{})
+
+	pidPath := filepath.Join(workDir, pidFile)
+	err := os.WriteFile(pidPath, []byte(strconv.Itoa(os.Getpid())), 0600)
+	if err != nil {
+		log.Errorf("Failed to write pid file: %s", err.Error())
+	}
+
+	go func() {
+		for {
+			select {
+			case <-sigs:
+				path := filepath.Join(workDir, fmt.Sprintf("debug-bundle-%d.tar.gz", time.Now().Unix()))
+				err := writeDebugBundle(path)
+				if err != nil {
+					log.Errorf("Failed to write debug bundle: %s", err.Error())
+					continue
+				}
+				log.Infof("Wrote debug bundle to '%s'", path)
+			case <-stopSignal:
+				signal.Stop(sigs)
+				return
+			}
+		}
+	}()
+	stopper := func() error {
+		stopSignal <- struct{}{}
+		return os.Remove(pidPath)
+	}
+	return stopper
+}
+
+// serverProcess returns the server running in the working directory
+func serverProcess() (*os.Process, error) {
+	data, err := os.ReadFile(filepath.Join(workDir, pidFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find a running server: %w", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid pid file: %w", err)
+	}
+	return os.FindProcess(pid)
+}
+
+// requestDebugBundle asks the server running in the working directory to write
+// a diagnostic bundle and returns its path
+func requestDebugBundle(timeout time.Duration) (string, error) {
+	process, err := serverProcess()
+	if err != nil {
+		return "", err
+	}
+	pid := process.Pid
+
+	before, _ := filepath.Glob(filepath.Join(workDir, "debug-bundle-*.tar.gz"))
+	existing := map[string]bool{}
+	for _, path := range before {
+		existing[path] = true
+	}
+
+	err = process.Signal(syscall.SIGUSR1)
+	if err != nil {
+		return "", fmt.Errorf("failed to signal server %d: %w", pid, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(200 * time.Millisecond)
+		after, _ := filepath.Glob(filepath.Join(workDir, "debug-bundle-*.tar.gz"))
+		for _, path := range after {
+			if !existing[path] {
+				return path, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("server %d didn't write a debug bundle within %s", pid, timeout)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nustiueudinastea/doltswarmdemo/alerting"
+	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+	p2psrv "github.com/nustiueudinastea/doltswarmdemo/p2p/server"
+)
+
+var diskGuard *p2p.DiskGuard
+
+// diskGuardDB wraps an ExternalDB and refuses writes while the data directory
+// is nearly full
+type diskGuardDB struct {
+	p2psrv.ExternalDB
+
+	guard *p2p.DiskGuard
+}
+
+func newDiskGuardDB(db p2psrv.ExternalDB, guard *p2p.DiskGuard) *diskGuardDB {
+	return &diskGuardDB{
+		ExternalDB: db,
+		guard:      guard,
+	}
+}
+
+func (db *diskGuardDB) ExecAndCommit(query string, commitMsg string) (string, error) {
+	if db.guard.ReadOnly() {
+		return "", p2p.ErrDiskFull
+	}
+	return db.ExternalDB.ExecAndCommit(query, commitMsg)
+}
+
+// alertDiskGuard raises an alert when the node becomes read-only because the
+// disk is nearly full, and when it accepts writes again
+func alertDiskGuard(readOnly bool, usage p2p.DiskUsage) {
+	if readOnly {
+		sendAlert(alerting.Alert{
+			Kind:     alerting.KindDiskFull,
+			Severity: alerting.SeverityCritical,
+			Key:      "read-only",
+			Summary:  fmt.Sprintf("Node is read-only: %.1f%% of disk space left", usage.FreePercent),
+			Details:  fmt.Sprintf("The data directory %s has %d bytes free. Writes are refused and syncs are paused until space is freed.", storageBackend.Dir(), usage.FreeBytes),
+		})
+		return
+	}
+	sendAlert(alerting.Alert{
+		Kind:     alerting.KindDiskFull,
+		Severity: alerting.SeverityInfo,
+		Key:      "writable",
+		Summary:  fmt.Sprintf("Node accepts writes again: %.1f%% of disk space left", usage.FreePercent),
+	})
+}
+
+// alertGovernor raises an alert when the node goes over its resource budgets
+// and sheds load, and when it's back within them
+func alertGovernor(overloaded bool, usage p2p.ResourceUsage) {
+	if overloaded {
+		sendAlert(alerting.Alert{
+			Kind:     alerting.KindOverloaded,
+			Severity: alerting.SeverityCritical,
+			Key:      "overloaded",
+			Summary:  fmt.Sprintf("Node is over its %s budget", strings.Join(usage.Exceeded, ", ")),
+			Details:  fmt.Sprintf("The node uses %d bytes of heap, %d goroutines and %d streams. New calls are refused and syncs are paused until the usage drops.", usage.HeapBytes, usage.Goroutines, usage.Streams),
+		})
+		return
+	}
+	sendAlert(alerting.Alert{
+		Kind:     alerting.KindOverloaded,
+		Severity: alerting.SeverityInfo,
+		Key:      "recovered",
+		Summary:  "Node is back within its resource budgets",
+	})
+}
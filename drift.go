@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+)
+
+// startDriftAlerts logs an error every time the data of a peer at the same
+// head as us diverges from ours, and when it matches again
+func startDriftAlerts() func() error {
+	events, cancel := p2pmgr.SubscribeEvents(p2p.EventDriftDetected, p2p.EventDriftResolved)
+	crashReporter.Go("drift-alerts", func() {
+		for ev := range events {
+			if ev.Type == p2p.EventDriftResolved {
+				log.Infof("Tables of peer %s match ours again at commit %s", ev.PeerID, ev.Commit)
+				continue
+			}
+			tables := []string{}
+			for _, mismatch := range ev.Drift {
+				tables = append(tables, mismatch.String())
+			}
+			log.Errorf("Tables of peer %s diverged from ours at commit %s: %s", ev.PeerID, ev.Commit, strings.Join(tables, "; "))
+		}
+	})
+	return func() error {
+		cancel()
+		return nil
+	}
+}
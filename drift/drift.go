@@ -0,0 +1,175 @@
+// Package drift detects replicas whose data diverged even though they are at
+// the same commit. It summarises every table of a commit with its row count
+// and a hash of its content, which peers exchange and compare.
+package drift
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Querier is the subset of the database used to read the tables
+type Querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// TableStats summarises the content of a table at a commit
+type TableStats struct {
+	Table string
+	Rows  int64
+	// Hash is the hex encoded SHA-256 of the rows, in primary key order
+	Hash string
+}
+
+// Mismatch describes a table that differs between two replicas. A table
+// missing on one side has an empty hash on that side.
+type Mismatch struct {
+	Table      string
+	LocalRows  int64
+	RemoteRows int64
+	LocalHash  string
+	RemoteHash string
+}
+
+func (m Mismatch) String() string {
+	switch {
+	case m.LocalHash == "":
+		return fmt.Sprintf("%s: missing locally", m.Table)
+	case m.RemoteHash == "":
+		return fmt.Sprintf("%s: missing on peer", m.Table)
+	case m.LocalRows != m.RemoteRows:
+		return fmt.Sprintf("%s: %d rows locally, %d on peer", m.Table, m.LocalRows, m.RemoteRows)
+	default:
+		return fmt.Sprintf("%s: content hash %s locally, %s on peer", m.Table, short(m.LocalHash), short(m.RemoteHash))
+	}
+}
+
+func short(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+func quoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// Collect computes the stats of every table at a commit, sorted by table
+// name. Only committed tables are included, so local-only tables are never
+// compared.
+func Collect(db Querier, commit string) ([]TableStats, error) {
+	tables, err := listTables(db, commit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables at '%s': %w", commit, err)
+	}
+
+	stats := []TableStats{}
+	for _, table := range tables {
+		ts, err := collectTable(db, table, commit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read table '%s' at '%s': %w", table, commit, err)
+		}
+		stats = append(stats, ts)
+	}
+	return stats, nil
+}
+
+func listTables(db Querier, commit string) ([]string, error) {
+	rows, err := db.Query(fmt.Sprintf("SHOW TABLES AS OF %s;", quoteString(commit)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tables := []string{}
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(tables)
+	return tables, nil
+}
+
+// collectTable hashes the rows of a table. Every value is length prefixed so
+// that different rows can't produce the same stream of bytes.
+func collectTable(db Querier, table string, commit string) (TableStats, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s AS OF %s;", quoteIdent(table), quoteString(commit)))
+	if err != nil {
+		return TableStats{}, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return TableStats{}, err
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	h := sha256.New()
+	stats := TableStats{Table: table}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return TableStats{}, err
+		}
+		for _, value := range values {
+			if value == nil {
+				fmt.Fprint(h, "-1:")
+				continue
+			}
+			fmt.Fprintf(h, "%d:", len(value))
+			h.Write(value)
+		}
+		stats.Rows++
+	}
+	if err := rows.Err(); err != nil {
+		return TableStats{}, err
+	}
+	stats.Hash = hex.EncodeToString(h.Sum(nil))
+	return stats, nil
+}
+
+// Compare returns the tables whose stats differ between the local and the
+// remote replica, sorted by table name
+func Compare(local []TableStats, remote []TableStats) []Mismatch {
+	byTable := map[string]*Mismatch{}
+	for _, ts := range local {
+		byTable[ts.Table] = &Mismatch{Table: ts.Table, LocalRows: ts.Rows, LocalHash: ts.Hash}
+	}
+	for _, ts := range remote {
+		m, found := byTable[ts.Table]
+		if !found {
+			m = &Mismatch{Table: ts.Table}
+			byTable[ts.Table] = m
+		}
+		m.RemoteRows = ts.Rows
+		m.RemoteHash = ts.Hash
+	}
+
+	mismatches := []Mismatch{}
+	for _, m := range byTable {
+		if m.LocalHash != m.RemoteHash || m.LocalRows != m.RemoteRows {
+			mismatches = append(mismatches, *m)
+		}
+	}
+	sort.Slice(mismatches, func(i, j int) bool { return mismatches[i].Table < mismatches[j].Table })
+	return mismatches
+}
@@ -0,0 +1,66 @@
+package drift
+
+import (
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	local := []TableStats{
+		{Table: "a", Rows: 2, Hash: "h1"},
+		{Table: "b", Rows: 3, Hash: "h2"},
+		{Table: "c", Rows: 1, Hash: "h3"},
+		{Table: "d", Rows: 5, Hash: "h4"},
+	}
+	remote := []TableStats{
+		{Table: "e", Rows: 1, Hash: "h5"},
+		{Table: "d", Rows: 5, Hash: "h4"},
+		{Table: "b", Rows: 4, Hash: "h6"},
+		{Table: "a", Rows: 2, Hash: "h7"},
+	}
+
+	mismatches := Compare(local, remote)
+	want := []Mismatch{
+		{Table: "a", LocalRows: 2, RemoteRows: 2, LocalHash: "h1", RemoteHash: "h7"},
+		{Table: "b", LocalRows: 3, RemoteRows: 4, LocalHash: "h2", RemoteHash: "h6"},
+		{Table: "c", LocalRows: 1, LocalHash: "h3"},
+		{Table: "e", RemoteRows: 1, RemoteHash: "h5"},
+	}
+	if len(mismatches) != len(want) {
+		t.Fatalf("expected %d mismatches, got %v", len(want), mismatches)
+	}
+	for i := range want {
+		if mismatches[i] != want[i] {
+			t.Errorf("mismatch %d: expected %+v, got %+v", i, want[i], mismatches[i])
+		}
+	}
+
+	if len(Compare(local, local)) != 0 {
+		t.Errorf("expected identical stats to match")
+	}
+}
+
+func TestMismatchString(t *testing.T) {
+	tests := []struct {
+		mismatch Mismatch
+		expected string
+	}{
+		{Mismatch{Table: "t", RemoteHash: "h"}, "t: missing locally"},
+		{Mismatch{Table: "t", LocalHash: "h"}, "t: missing on peer"},
+		{Mismatch{Table: "t", LocalRows: 1, RemoteRows: 2, LocalHash: "a", RemoteHash: "b"}, "t: 1 rows locally, 2 on peer"},
+		{Mismatch{Table: "t", LocalRows: 1, RemoteRows: 1, LocalHash: "0123456789abcdef", RemoteHash: "b"}, "t: content hash 0123456789ab locally, b on peer"},
+	}
+	for _, test := range tests {
+		if got := test.mismatch.String(); got != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, got)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	if got := quoteIdent("we`ird"); got != "`we``ird`" {
+		t.Errorf("unexpected identifier quoting: %s", got)
+	}
+	if got := quoteString("it's"); got != "'it''s'" {
+		t.Errorf("unexpected string quoting: %s", got)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	p2psrv "github.com/nustiueudinastea/doltswarmdemo/p2p/server"
+	"github.com/nustiueudinastea/doltswarmdemo/secrets"
+	"github.com/nustiueudinastea/doltswarmdemo/tablecrypt"
+)
+
+// encryptedDB wraps an ExternalDB and encrypts the values written to the
+// encrypted columns before they are committed
+type encryptedDB struct {
+	p2psrv.ExternalDB
+
+	policy *tablecrypt.Policy
+}
+
+func newEncryptedDB(db p2psrv.ExternalDB, policy *tablecrypt.Policy) *encryptedDB {
+	return &encryptedDB{
+		ExternalDB: db,
+		policy:     policy,
+	}
+}
+
+func (db *encryptedDB) ExecAndCommit(query string, commitMsg string) (string, error) {
+	query, err := db.policy.Rewrite(query)
+	if err != nil {
+		return "", err
+	}
+	return db.ExternalDB.ExecAndCommit(query, commitMsg)
+}
+
+// parseTableKeys returns the keys of the --table-key flags, given as
+// table=<key>, with the keys that are secret references resolved
+func parseTableKeys(values []string, resolver *secrets.Resolver) (map[string]string, error) {
+	keys := map[string]string{}
+	for _, value := range values {
+		table, key, found := strings.Cut(value, "=")
+		if !found || table == "" {
+			return nil, fmt.Errorf("invalid table key, expected table=<key>")
+		}
+		key, err := resolver.Resolve(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve the key of table '%s': %w", table, err)
+		}
+		keys[table] = key
+	}
+	return keys, nil
+}
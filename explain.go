@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/client"
+)
+
+// explainQuery prints the plan of a read query on the node at addr, or on the
+// archive peer serving it for the history reads of light nodes, and the
+// profile of the query if asked to
+func explainQuery(addr string, statement string, profile bool, timeout time.Duration) error {
+	c, err := client.New()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	peer, err := c.Connect(addr)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	plan, err := peer.Explain(ctx, statement, client.ExplainOptions{Profile: profile, Timeout: timeout})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Plan on %s at head %s:\n", plan.Node, plan.Head)
+	for _, line := range plan.Lines {
+		fmt.Printf("  %s\n", line)
+	}
+	if p := plan.Profile; p != nil {
+		fmt.Printf("Profile: %d rows, %d bytes, first row after %s, all rows after %s", p.Rows, p.Bytes, p.FirstRow, p.Elapsed)
+		if p.SessionWait > 0 {
+			fmt.Printf(", after waiting %s for the session", p.SessionWait)
+		}
+		fmt.Println()
+	}
+	return nil
+}
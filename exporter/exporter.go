@@ -0,0 +1,167 @@
+// Package exporter writes whole tables, or the results of queries, to CSV,
+// JSON lines or Parquet. Rows are written as they are read, so exports don't
+// have to fit in memory, and can be taken at any commit of the history.
+package exporter
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Format is the format of an exported file
+type Format string
+
+const (
+	FormatCSV     Format = "csv"
+	FormatJSON    Format = "json"
+	FormatParquet Format = "parquet"
+)
+
+// ParseFormat parses the name of a format. The format is detected from the
+// extension of the file if s is empty, and defaults to CSV.
+func ParseFormat(s string, path string) (Format, error) {
+	if s == "" {
+		s = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		switch s {
+		case "jsonl", "ndjson":
+			s = string(FormatJSON)
+		case "parq":
+			s = string(FormatParquet)
+		case "":
+			s = string(FormatCSV)
+		}
+	}
+	switch Format(s) {
+	case FormatCSV, FormatJSON, FormatParquet:
+		return Format(s), nil
+	default:
+		return "", fmt.Errorf("unknown export format '%s', expected csv, json or parquet", s)
+	}
+}
+
+// Request describes an export: either a whole table or a query, optionally at
+// a past commit, branch or tag
+type Request struct {
+	Table string `json:"table,omitempty"`
+	Query string `json:"query,omitempty"`
+	AsOf  string `json:"as_of,omitempty"`
+}
+
+// Validate checks that exactly one of the table and the query is set
+func (r Request) Validate() error {
+	switch {
+	case r.Table == "" && r.Query == "":
+		return fmt.Errorf("expected a table or a query to export")
+	case r.Table != "" && r.Query != "":
+		return fmt.Errorf("a table and a query can't be exported together")
+	}
+	return nil
+}
+
+// statement returns the query of the export. Tables are read with AS OF, while
+// queries are run against the revision database of the commit, see Export.
+func (r Request) statement() string {
+	if r.Table == "" {
+		return r.Query
+	}
+	if r.AsOf == "" {
+		return fmt.Sprintf("SELECT * FROM %s;", quoteIdent(r.Table))
+	}
+	return fmt.Sprintf("SELECT * FROM %s AS OF %s;", quoteIdent(r.Table), quoteString(r.AsOf))
+}
+
+// Export runs the export and writes the rows to w as they are read. It returns
+// the number of rows written.
+//
+// A query at a past commit runs on its own connection switched to the
+// revision database of the commit, so that every table it reads, including
+// joined ones and subqueries, is read at that commit.
+func Export(ctx context.Context, db *sql.DB, req Request, format Format, w io.Writer) (int64, error) {
+	if err := req.Validate(); err != nil {
+		return 0, err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if req.Query != "" && req.AsOf != "" {
+		var database string
+		err = conn.QueryRowContext(ctx, "SELECT DATABASE();").Scan(&database)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read the current database: %w", err)
+		}
+		_, err = conn.ExecContext(ctx, fmt.Sprintf("USE %s;", quoteIdent(database+"/"+req.AsOf)))
+		if err != nil {
+			return 0, fmt.Errorf("failed to read at '%s': %w", req.AsOf, err)
+		}
+		defer func() {
+			// the connection goes back to the pool, so it has to be reset to
+			// the working set, or discarded
+			if _, err := conn.ExecContext(context.Background(), fmt.Sprintf("USE %s;", quoteIdent(database))); err != nil {
+				conn.Raw(func(any) error { return driver.ErrBadConn })
+			}
+		}()
+	}
+
+	rows, err := conn.QueryContext(ctx, req.statement())
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return 0, err
+	}
+	columns := make([]Column, len(types))
+	for i, t := range types {
+		columns[i] = Column{Name: t.Name(), Kind: kindOf(t.DatabaseTypeName())}
+	}
+
+	ew, err := NewWriter(format, w, columns)
+	if err != nil {
+		return 0, err
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	row := make([]*string, len(columns))
+	count := int64(0)
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return count, err
+		}
+		for i := range values {
+			row[i] = nil
+			if values[i].Valid {
+				row[i] = &values[i].String
+			}
+		}
+		if err := ew.Write(row); err != nil {
+			return count, fmt.Errorf("failed to write row %d: %w", count+1, err)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	return count, ew.Close()
+}
+
+func quoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
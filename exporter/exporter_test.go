@@ -0,0 +1,109 @@
+package exporter
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nustiueudinastea/doltswarmdemo/importer"
+)
+
+func str(s string) *string {
+	return &s
+}
+
+var testColumns = []Column{{Name: "id", Kind: KindInt}, {Name: "name", Kind: KindString}, {Name: "score", Kind: KindFloat}}
+
+var testRows = [][]*string{
+	{str("1"), str("alice, \"al\""), str("1.5")},
+	{str("2"), nil, nil},
+}
+
+func write(t *testing.T, format Format) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(format, buf, testColumns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range testRows {
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriters(t *testing.T) {
+	csv := string(write(t, FormatCSV))
+	expected := "id,name,score\n1,\"alice, \"\"al\"\"\",1.5\n2,,\n"
+	if csv != expected {
+		t.Errorf("unexpected CSV:\n%s", csv)
+	}
+
+	json := string(write(t, FormatJSON))
+	expected = "{\"id\":1,\"name\":\"alice, \\\"al\\\"\",\"score\":1.5}\n{\"id\":2,\"name\":null,\"score\":null}\n"
+	if json != expected {
+		t.Errorf("unexpected JSON:\n%s", json)
+	}
+
+	// the Parquet file is read back with the importer
+	path := filepath.Join(t.TempDir(), "export.parquet")
+	if err := os.WriteFile(path, write(t, FormatParquet), 0600); err != nil {
+		t.Fatal(err)
+	}
+	src, err := importer.Open(path, importer.FormatParquet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if columns := src.Columns(); len(columns) != 3 || columns[0] != "id" || columns[2] != "score" {
+		t.Fatalf("unexpected Parquet columns %v", columns)
+	}
+	row, err := src.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := row["id"].(*int64); *id != 1 {
+		t.Errorf("expected id 1, got %d", *id)
+	}
+	if name := row["name"].(*string); *name != "alice, \"al\"" {
+		t.Errorf("unexpected name %s", *name)
+	}
+	row, err = src.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := row["name"].(*string); name != nil {
+		t.Errorf("expected a NULL name, got %s", *name)
+	}
+}
+
+func TestRequest(t *testing.T) {
+	if err := (Request{}).Validate(); err == nil {
+		t.Error("expected an empty export to be refused")
+	}
+	if err := (Request{Table: "t", Query: "SELECT 1"}).Validate(); err == nil {
+		t.Error("expected a table and a query to be refused")
+	}
+	req := Request{Table: "my`table", AsOf: "main~1'"}
+	if stmt := req.statement(); stmt != "SELECT * FROM `my``table` AS OF 'main~1''';" {
+		t.Errorf("unexpected statement %s", stmt)
+	}
+	// queries at a commit are run on the revision database as is
+	req = Request{Query: "SELECT 1", AsOf: "main~1"}
+	if stmt := req.statement(); stmt != "SELECT 1" {
+		t.Errorf("unexpected statement %s", stmt)
+	}
+
+	for path, expected := range map[string]Format{"a.jsonl": FormatJSON, "a.parquet": FormatParquet, "": FormatCSV} {
+		format, err := ParseFormat("", path)
+		if err != nil || format != expected {
+			t.Errorf("expected %s for '%s', got %s (%v)", expected, path, format, err)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package exporter
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Kind is the type a column is written as
+type Kind int
+
+const (
+	KindString Kind = iota
+	KindInt
+	KindFloat
+)
+
+// Column is a column of the exported rows
+type Column struct {
+	Name string
+	Kind Kind
+}
+
+// kindOf maps the database type of a column to the type it is written as.
+// Unsigned 64 bit integers and decimals are written as strings, since they
+// don't fit in an INT64 or a DOUBLE without losing values.
+func kindOf(databaseType string) Kind {
+	switch strings.ToUpper(databaseType) {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT", "YEAR",
+		"UNSIGNED TINYINT", "UNSIGNED SMALLINT", "UNSIGNED MEDIUMINT", "UNSIGNED INT":
+		return KindInt
+	case "FLOAT", "DOUBLE", "REAL":
+		return KindFloat
+	default:
+		return KindString
+	}
+}
+
+// Writer writes rows in an export format. A nil value is NULL.
+type Writer interface {
+	Write(row []*string) error
+	// Close flushes the rows. It doesn't close the underlying writer.
+	Close() error
+}
+
+// NewWriter creates a writer of rows with the given columns
+func NewWriter(format Format, w io.Writer, columns []Column) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w, columns)
+	case FormatJSON:
+		return newJSONWriter(w, columns)
+	case FormatParquet:
+		return newParquetWriter(w, columns)
+	default:
+		return nil, fmt.Errorf("unknown export format '%s'", format)
+	}
+}
+
+// csvWriter writes a header line followed by the rows. NULL values are
+// written as empty fields.
+type csvWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func newCSVWriter(w io.Writer, columns []Column) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w), record: make([]string, len(columns))}
+	for i, column := range columns {
+		cw.record[i] = column.Name
+	}
+	return cw, cw.w.Write(cw.record)
+}
+
+func (w *csvWriter) Write(row []*string) error {
+	for i, value := range row {
+		w.record[i] = ""
+		if value != nil {
+			w.record[i] = *value
+		}
+	}
+	return w.w.Write(w.record)
+}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// jsonWriter writes one object per line, with the keys in the order of the
+// columns. Numeric columns are written as JSON numbers.
+type jsonWriter struct {
+	w       *bufio.Writer
+	columns []Column
+	keys    [][]byte
+}
+
+func newJSONWriter(w io.Writer, columns []Column) (*jsonWriter, error) {
+	jw := &jsonWriter{w: bufio.NewWriter(w), columns: columns, keys: make([][]byte, len(columns))}
+	for i, column := range columns {
+		key, err := json.Marshal(column.Name)
+		if err != nil {
+			return nil, err
+		}
+		jw.keys[i] = key
+	}
+	return jw, nil
+}
+
+func (w *jsonWriter) Write(row []*string) error {
+	w.w.WriteByte('{')
+	for i, value := range row {
+		if i > 0 {
+			w.w.WriteByte(',')
+		}
+		w.w.Write(w.keys[i])
+		w.w.WriteByte(':')
+		switch {
+		case value == nil:
+			w.w.WriteString("null")
+		case w.columns[i].Kind != KindString && json.Valid([]byte(*value)):
+			w.w.WriteString(*value)
+		default:
+			encoded, err := json.Marshal(*value)
+			if err != nil {
+				return err
+			}
+			w.w.Write(encoded)
+		}
+	}
+	w.w.WriteByte('}')
+	_, err := w.w.WriteString("\n")
+	return err
+}
+
+func (w *jsonWriter) Close() error {
+	return w.w.Flush()
+}
+
+// parquetWriter writes the rows with a flat schema of optional columns
+type parquetWriter struct {
+	w *writer.CSVWriter
+}
+
+func newParquetWriter(w io.Writer, columns []Column) (*parquetWriter, error) {
+	metadata := make([]string, len(columns))
+	for i, column := range columns {
+		// the schema is parsed from key=value pairs separated by commas
+		name := strings.NewReplacer(",", "_", "=", "_").Replace(column.Name)
+		switch column.Kind {
+		case KindInt:
+			metadata[i] = fmt.Sprintf("name=%s, type=INT64, repetitiontype=OPTIONAL", name)
+		case KindFloat:
+			metadata[i] = fmt.Sprintf("name=%s, type=DOUBLE, repetitiontype=OPTIONAL", name)
+		default:
+			metadata[i] = fmt.Sprintf("name=%s, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL", name)
+		}
+	}
+	pw, err := writer.NewCSVWriterFromWriter(metadata, w, 1)
+	if err != nil {
+		return nil, err
+	}
+	return &parquetWriter{w: pw}, nil
+}
+
+func (w *parquetWriter) Write(row []*string) error {
+	return w.w.WriteString(row)
+}
+
+func (w *parquetWriter) Close() error {
+	return w.w.WriteStop()
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/exporter"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	exportsDir          = "exports"
+	exportRequestPrefix = "export-request-"
+	exportResultPrefix  = "export-result-"
+	exportsInterval     = 500 * time.Millisecond
+	exportStartTimeout  = 10 * time.Second
+)
+
+// exportRequest asks the running server to export a table or a query. The
+// rows are written to Output, or to a file in the exports directory that the
+// export command copies to stdout as it grows.
+type exportRequest struct {
+	Export exporter.Request `json:"export"`
+	Format exporter.Format  `json:"format"`
+	Output string           `json:"output,omitempty"`
+}
+
+type exportResult struct {
+	Rows int64  `json:"rows"`
+	Err  string `json:"error,omitempty"`
+}
+
+func exportOutputPath(id string) string {
+	return filepath.Join(workDir, exportsDir, id+".out")
+}
+
+// startExportTracker runs the exports requested by the export command. The
+// server holds the database, so exports go through it instead of opening the
+// database from the command.
+func startExportTracker() func() error {
+	log.Info("Starting export tracker")
+	err := os.MkdirAll(filepath.Join(workDir, exportsDir), 0700)
+	if err != nil {
+		log.Errorf("Failed to create exports directory: %s", err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	ticker := time.NewTicker(exportsInterval)
+	stopSignal := make(chan struct{})
+	crashReporter.Go("export-tracker", func() {
+		for {
+			select {
+			case <-ticker.C:
+				processExportRequests(ctx, wg)
+			case <-stopSignal:
+				return
+			}
+		}
+	})
+	return func() error {
+		log.Info("Stopping export tracker")
+		ticker.Stop()
+		close(stopSignal)
+		cancel()
+		wg.Wait()
+		return nil
+	}
+}
+
+func processExportRequests(ctx context.Context, wg *sync.WaitGroup) {
+	paths, _ := filepath.Glob(filepath.Join(workDir, exportRequestPrefix+"*.json"))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Errorf("Failed to read export request: %s", err.Error())
+			continue
+		}
+		os.Remove(path)
+
+		id := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), exportRequestPrefix), ".json")
+		req := exportRequest{}
+		err = json.Unmarshal(data, &req)
+		if err != nil {
+			writeExportResult(id, exportResult{Err: fmt.Sprintf("failed to parse export request: %s", err.Error())})
+			continue
+		}
+
+		wg.Add(1)
+		crashReporter.Go("export-"+id, func() {
+			defer wg.Done()
+			writeExportResult(id, runExport(ctx, id, req))
+		})
+	}
+}
+
+func runExport(ctx context.Context, id string, req exportRequest) exportResult {
+	output := req.Output
+	if output == "" {
+		output = exportOutputPath(id)
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return exportResult{Err: err.Error()}
+	}
+	defer f.Close()
+
+	log.Infof("Exporting %s to %s", describeExport(req.Export), output)
+	rows, err := exporter.Export(ctx, dbi.DB, req.Export, req.Format, f)
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		log.Errorf("Export %s failed after %d rows: %s", id, rows, err.Error())
+		return exportResult{Rows: rows, Err: err.Error()}
+	}
+	log.Infof("Exported %d rows to %s", rows, output)
+	return exportResult{Rows: rows}
+}
+
+func writeExportResult(id string, result exportResult) {
+	err := writeJSON(filepath.Join(workDir, exportResultPrefix+id+".json"), result)
+	if err != nil {
+		log.Errorf("Failed to write export result: %s", err.Error())
+	}
+}
+
+func describeExport(req exporter.Request) string {
+	what := "query"
+	if req.Table != "" {
+		what = "table " + req.Table
+	}
+	if req.AsOf != "" {
+		what += " as of " + req.AsOf
+	}
+	return what
+}
+
+// export asks the server running in the working directory to export a table
+// or a query. The rows are written to output, or to stdout if it's empty.
+func export(req exporter.Request, format string, output string) error {
+	err := req.Validate()
+	if err != nil {
+		return err
+	}
+	if output == "-" {
+		output = ""
+	}
+	if output != "" {
+		output, err = filepath.Abs(output)
+		if err != nil {
+			return err
+		}
+	}
+	parsed, err := exporter.ParseFormat(format, output)
+	if err != nil {
+		return err
+	}
+
+	id := ksuid.New().String()
+	requestPath := filepath.Join(workDir, exportRequestPrefix+id+".json")
+	err = writeJSON(requestPath, exportRequest{Export: req, Format: parsed, Output: output})
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(exportStartTimeout)
+	for {
+		if _, err := os.Stat(requestPath); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			os.Remove(requestPath)
+			return fmt.Errorf("export was not started within %s. Is the server running?", exportStartTimeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	var result exportResult
+	if output == "" {
+		result, err = followExport(id)
+	} else {
+		result, err = waitExport(id)
+	}
+	if err != nil {
+		return err
+	}
+	if result.Err != "" {
+		return fmt.Errorf("export failed after %d rows: %s", result.Rows, result.Err)
+	}
+	if output != "" {
+		fmt.Printf("Exported %d rows to %s\n", result.Rows, output)
+	}
+	return nil
+}
+
+// readExportResult returns the result of an export, and false while it's
+// running
+func readExportResult(id string) (exportResult, bool, error) {
+	result := exportResult{}
+	path := filepath.Join(workDir, exportResultPrefix+id+".json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return result, false, nil
+	}
+	os.Remove(path)
+	err = json.Unmarshal(data, &result)
+	if err != nil {
+		return result, true, fmt.Errorf("failed to parse export result: %w", err)
+	}
+	return result, true, nil
+}
+
+// waitExport waits for an export to a file to complete
+func waitExport(id string) (exportResult, error) {
+	for {
+		result, done, err := readExportResult(id)
+		if done || err != nil {
+			return result, err
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// followExport copies the rows written by the server to stdout until the
+// export completes
+func followExport(id string) (exportResult, error) {
+	path := exportOutputPath(id)
+	defer os.Remove(path)
+	var f *os.File
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	for {
+		// the result is read before copying, so that the rows written right
+		// before it are still copied
+		result, done, err := readExportResult(id)
+		if err != nil {
+			return result, err
+		}
+		if f == nil {
+			f, _ = os.Open(path)
+		}
+		if f != nil {
+			if _, err := io.Copy(os.Stdout, f); err != nil {
+				return result, err
+			}
+		}
+		if done {
+			return result, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
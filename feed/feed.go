@@ -0,0 +1,114 @@
+package feed
+
+import (
+	"database/sql"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/commitmeta"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBranch      = "main"
+	pollInterval       = 1 * time.Second
+	subscriptionBuffer = 100
+)
+
+var validRef = regexp.MustCompile(`^[A-Za-z0-9_./-]+$`)
+
+// Querier is the subset of the database used to read the commit history
+type Querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// CommitEvent describes a new commit on a branch
+type CommitEvent struct {
+	Hash      string
+	Branch    string
+	Committer string
+	Email     string
+	Date      time.Time
+	Message   string
+	Tables    []string
+	Metadata  commitmeta.Metadata
+}
+
+// Filter selects commit events. Empty fields match everything.
+type Filter struct {
+	Tables   []string
+	Branches []string
+	Authors  []string
+	Metadata map[string]string
+}
+
+// Match returns true if the event satisfies the filter
+func (f Filter) Match(ev CommitEvent) bool {
+	if len(f.Branches) > 0 && !contains(f.Branches, ev.Branch) {
+		return false
+	}
+	if len(f.Authors) > 0 && !contains(f.Authors, ev.Committer) && !contains(f.Authors, ev.Email) {
+		return false
+	}
+	if len(f.Metadata) > 0 && !ev.Metadata.Match(f.Metadata) {
+		return false
+	}
+	if len(f.Tables) > 0 {
+		for _, table := range ev.Tables {
+			if contains(f.Tables, table) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+type subscription struct {
+	filter Filter
+	events chan CommitEvent
+}
+
+// Feed polls the commit history and pushes new commits to subscribers
+type Feed struct {
+	db  Querier
+	log *logrus.Logger
+
+	mtx    sync.Mutex
+	subs   map[int]*subscription
+	nextID int
+	seen   map[string]map[string]bool
+}
+
+// New creates a commit feed for the database
+func New(db Querier, logger *logrus.Logger) *Feed {
+	return &Feed{
+		db:   db,
+		log:  logger,
+		subs: map[int]*subscription{},
+		seen: map[string]map[string]bool{},
+	}
+}
+
+// Subscribe returns a channel receiving all future commits that match the
+// filter, and a function that cancels the subscription.
+func (f *Feed) Subscribe(filter Filter) (<-chan CommitEvent, func()) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	id := f.nextID
+	f.nextID++
+	sub := &subscription{filter: filter, events: make(chan CommitEvent, subscriptionBuffer)}
+	f.subs[id] = sub
+
+	cancel := func() {
+		f.mtx.Lock()
+		defer f.mtx.Unlock()
+		if _, found := f.subs[id]; found {
+			delete(f.subs, id)
+			close(sub.events)
+		}
+	}
+	return sub.events, cancel
+}
@@ -0,0 +1,29 @@
+package feed
+
+import "testing"
+
+func TestFilterMatch(t *testing.T) {
+	ev := CommitEvent{Hash: "abc", Branch: "main", Committer: "peer1", Email: "peer1@example.com", Tables: []string{"testtable"}, Metadata: map[string]string{"app": "billing"}}
+
+	tests := []struct {
+		filter   Filter
+		expected bool
+	}{
+		{Filter{}, true},
+		{Filter{Branches: []string{"main"}}, true},
+		{Filter{Branches: []string{"dev"}}, false},
+		{Filter{Authors: []string{"peer1@example.com"}}, true},
+		{Filter{Authors: []string{"peer2"}}, false},
+		{Filter{Tables: []string{"other", "testtable"}}, true},
+		{Filter{Tables: []string{"other"}}, false},
+		{Filter{Branches: []string{"main"}, Tables: []string{"other"}}, false},
+		{Filter{Metadata: map[string]string{"app": "billing"}}, true},
+		{Filter{Metadata: map[string]string{"app": "other"}}, false},
+	}
+
+	for _, test := range tests {
+		if matched := test.filter.Match(ev); matched != test.expected {
+			t.Errorf("filter %+v: expected %t, got %t", test.filter, test.expected, matched)
+		}
+	}
+}
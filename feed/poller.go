@@ -0,0 +1,190 @@
+package feed
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/commitmeta"
+)
+
+// Start begins polling the commit history. The returned function stops it.
+func (f *Feed) Start() func() error {
+	stopSignal := make(chan struct{})
+	go func() {
+		f.log.Info("Starting commit feed")
+		// commits that exist at startup are not announced
+		for _, branch := range f.branches() {
+			_, err := f.newCommits(branch)
+			if err != nil {
+				f.log.Errorf("Failed to read history for branch '%s': %v", branch, err)
+			}
+		}
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				f.poll()
+			case <-stopSignal:
+				f.log.Info("Stopping commit feed")
+				return
+			}
+		}
+	}()
+	stopper := func() error {
+		stopSignal <- struct{}{}
+		return nil
+	}
+	return stopper
+}
+
+// branches returns all the branches that subscribers are interested in
+func (f *Feed) branches() []string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	branches := []string{defaultBranch}
+	for _, sub := range f.subs {
+		for _, branch := range sub.filter.Branches {
+			if !contains(branches, branch) {
+				branches = append(branches, branch)
+			}
+		}
+	}
+	return branches
+}
+
+func (f *Feed) poll() {
+	for _, branch := range f.branches() {
+		events, err := f.newCommits(branch)
+		if err != nil {
+			f.log.Errorf("Failed to read history for branch '%s': %v", branch, err)
+			continue
+		}
+		for _, ev := range events {
+			f.publish(ev)
+		}
+	}
+}
+
+func (f *Feed) publish(ev CommitEvent) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	for _, sub := range f.subs {
+		if !sub.filter.Match(ev) {
+			continue
+		}
+		select {
+		case sub.events <- ev:
+		default:
+			f.log.Warnf("Commit feed subscriber is too slow. Dropping event for commit '%s'", ev.Hash)
+		}
+	}
+}
+
+// newCommits returns the commits on the branch that were not seen before,
+// oldest first.
+func (f *Feed) newCommits(branch string) ([]CommitEvent, error) {
+	if !validRef.MatchString(branch) {
+		return nil, fmt.Errorf("invalid branch name '%s'", branch)
+	}
+
+	rows, err := f.db.Query(fmt.Sprintf("SELECT commit_hash, committer, email, date, message FROM dolt_log('%s');", branch))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	f.mtx.Lock()
+	seen, initialized := f.seen[branch]
+	if !initialized {
+		seen = map[string]bool{}
+		f.seen[branch] = seen
+	}
+	f.mtx.Unlock()
+
+	events := []CommitEvent{}
+	for rows.Next() {
+		ev := CommitEvent{Branch: branch}
+		var date any
+		err = rows.Scan(&ev.Hash, &ev.Committer, &ev.Email, &date, &ev.Message)
+		if err != nil {
+			return nil, err
+		}
+		ev.Date = asTime(date)
+		ev.Metadata, _ = commitmeta.FromMessage(ev.Message)
+		if seen[ev.Hash] {
+			continue
+		}
+		seen[ev.Hash] = true
+		if initialized {
+			events = append([]CommitEvent{ev}, events...)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range events {
+		events[i].Tables, err = f.changedTables(events[i].Hash)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+func (f *Feed) changedTables(commit string) ([]string, error) {
+	if !validRef.MatchString(commit) {
+		return nil, fmt.Errorf("invalid commit hash '%s'", commit)
+	}
+
+	rows, err := f.db.Query(fmt.Sprintf("SELECT table_name FROM dolt_diff WHERE commit_hash = '%s';", commit))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tables := []string{}
+	for rows.Next() {
+		var table string
+		err = rows.Scan(&table)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+func asTime(v any) time.Time {
+	switch t := v.(type) {
+	case time.Time:
+		return t
+	case []byte:
+		return parseTime(string(t))
+	case string:
+		return parseTime(t)
+	default:
+		return time.Time{}
+	}
+}
+
+func parseTime(s string) time.Time {
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999", time.RFC3339Nano} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func contains(list []string, item string) bool {
+	for _, i := range list {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
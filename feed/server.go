@@ -0,0 +1,46 @@
+package feed
+
+import (
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+var _ p2pproto.CommitsServer = (*Server)(nil)
+
+// Server exposes the feed over the Commits gRPC service
+type Server struct {
+	Feed *Feed
+}
+
+func (s *Server) Subscribe(req *p2pproto.SubscribeRequest, stream p2pproto.Commits_SubscribeServer) error {
+	events, cancel := s.Feed.Subscribe(Filter{Tables: req.Tables, Branches: req.Branches, Authors: req.Authors, Metadata: req.Metadata})
+	defer cancel()
+
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return nil
+			}
+			err := stream.Send(ev.Proto())
+			if err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// Proto converts the event to its protobuf representation
+func (ev CommitEvent) Proto() *p2pproto.CommitEvent {
+	return &p2pproto.CommitEvent{
+		Hash:      ev.Hash,
+		Branch:    ev.Branch,
+		Committer: ev.Committer,
+		Email:     ev.Email,
+		DateUnix:  ev.Date.Unix(),
+		Message:   ev.Message,
+		Tables:    ev.Tables,
+		Metadata:  ev.Metadata,
+	}
+}
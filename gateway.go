@@ -0,0 +1,41 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/nustiueudinastea/doltswarmdemo/client"
+	"github.com/nustiueudinastea/doltswarmdemo/gateway"
+	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+)
+
+const gatewayKeyDir = "gateway"
+
+// startGateway serves the gRPC services of the node over TCP. The gateway
+// reaches the node over libp2p with its own identity, kept in the gateway
+// directory of the working directory, so the ACL policy can grant it access.
+func startGateway(cfg gateway.Config) (func() error, error) {
+	key, err := p2p.NewKey(filepath.Join(workDir, gatewayKeyDir))
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("gRPC gateway uses peer ID %s", key.GetID())
+
+	c, err := client.New(client.WithIdentity(key.PrivateKey()))
+	if err != nil {
+		return nil, err
+	}
+	node, err := c.Connect(p2pmgr.LocalAddr())
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	stopper, err := gateway.Start(cfg, node.Conn(), log)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return func() error {
+		stopper()
+		return c.Close()
+	}, nil
+}
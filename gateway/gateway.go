@@ -0,0 +1,240 @@
+// Package gateway serves the gRPC services of the local node on a TCP
+// listener, so that clients generated from the .proto files in any language
+// can use the node without implementing libp2p. Only the methods used by
+// clients are proxied, unchanged, to the node over libp2p, where they are
+// authorized like the calls of any peer. Clients connect over TLS and
+// authenticate with a bearer token.
+package gateway
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Config configures the gateway
+type Config struct {
+	// Addr is the TCP address the gateway listens on, e.g. 127.0.0.1:9090
+	Addr string
+	// CertFile and KeyFile are the TLS certificate of the gateway
+	CertFile string
+	KeyFile  string
+	// Token is required from clients as a bearer token in the authorization
+	// metadata
+	Token string
+	// Methods are the full names of the proxied methods. DefaultMethods are
+	// proxied if empty.
+	Methods []string
+}
+
+// DefaultMethods are the methods used by clients. The services used between
+// peers, like Admin, aren't reachable through the gateway.
+var DefaultMethods = []string{
+	p2pproto.Pinger_Ping_FullMethodName,
+	p2pproto.Tester_ExecSQL_FullMethodName,
+	p2pproto.Tester_StreamCommits_FullMethodName,
+	p2pproto.Tester_GetHead_FullMethodName,
+	p2pproto.Tester_CompareCommits_FullMethodName,
+	p2pproto.Tester_Query_FullMethodName,
+	p2pproto.Tester_CallProcedure_FullMethodName,
+	p2pproto.Tester_Explain_FullMethodName,
+	p2pproto.Tester_RunNamedQuery_FullMethodName,
+	p2pproto.Leases_Acquire_FullMethodName,
+	p2pproto.Leases_Renew_FullMethodName,
+	p2pproto.Leases_Release_FullMethodName,
+	p2pproto.Sessions_Open_FullMethodName,
+	p2pproto.Sessions_Execute_FullMethodName,
+	p2pproto.Sessions_Close_FullMethodName,
+	p2pproto.Blobs_PutBlob_FullMethodName,
+	p2pproto.Blobs_GetBlob_FullMethodName,
+	p2pproto.Blobs_StatBlob_FullMethodName,
+	p2pproto.Blobs_PinBlob_FullMethodName,
+	p2pproto.Blobs_UnpinBlob_FullMethodName,
+}
+
+// frame is a message passed through the proxy without decoding it
+type frame struct {
+	payload []byte
+}
+
+// rawCodec passes messages through unchanged. It is named after the proto
+// codec so that the content type of the calls is preserved.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	f, ok := v.(*frame)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", v)
+	}
+	return f.payload, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	f, ok := v.(*frame)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", v)
+	}
+	f.payload = append(f.payload[:0], data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+// Gateway proxies the calls received over TCP to the node
+type Gateway struct {
+	node    grpc.ClientConnInterface
+	token   string
+	methods map[string]bool
+	log     *logrus.Logger
+}
+
+// Start serves the gateway until the returned function is called. node is the
+// connection to the local node.
+func Start(cfg Config, node grpc.ClientConnInterface, logger *logrus.Logger) (func() error, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("gRPC gateway requires a TLS certificate and key")
+	}
+	if cfg.Token == "" {
+		return nil, errors.New("gRPC gateway requires a client token")
+	}
+	creds, err := credentials.NewServerTLSFromFile(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load gateway TLS certificate: %w", err)
+	}
+
+	methods := cfg.Methods
+	if len(methods) == 0 {
+		methods = DefaultMethods
+	}
+	g := &Gateway{node: node, token: cfg.Token, methods: map[string]bool{}, log: logger}
+	for _, method := range methods {
+		g.methods[method] = true
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.Creds(creds),
+		grpc.ForceServerCodec(rawCodec{}),
+		grpc.UnknownServiceHandler(g.proxy),
+	}
+
+	listener, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", cfg.Addr, err)
+	}
+	server := grpc.NewServer(opts...)
+	go func() {
+		logger.Infof("Serving gRPC gateway on %s", listener.Addr())
+		if err := server.Serve(listener); err != nil {
+			logger.Errorf("gRPC gateway stopped: %v", err)
+		}
+	}()
+
+	return func() error {
+		server.GracefulStop()
+		return nil
+	}, nil
+}
+
+// authenticate checks the bearer token of the call and returns the metadata
+// forwarded to the node
+func (g *Gateway) authenticate(ctx context.Context) (metadata.MD, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	md = md.Copy()
+	values := md.Get("authorization")
+	md.Delete("authorization")
+	for _, value := range values {
+		token, found := strings.CutPrefix(value, "Bearer ")
+		if found && subtle.ConstantTimeCompare([]byte(token), []byte(g.token)) == 1 {
+			return md, nil
+		}
+	}
+	return nil, status.Error(codes.Unauthenticated, "invalid or missing gateway token")
+}
+
+// proxy forwards a call of any type, unary or streaming, to the node
+func (g *Gateway) proxy(srv any, serverStream grpc.ServerStream) error {
+	method, ok := grpc.MethodFromServerStream(serverStream)
+	if !ok {
+		return status.Error(codes.Internal, "unknown method")
+	}
+	md, err := g.authenticate(serverStream.Context())
+	if err != nil {
+		return err
+	}
+	if !g.methods[method] {
+		return status.Errorf(codes.PermissionDenied, "method %s is not served by the gateway", method)
+	}
+
+	ctx, cancel := context.WithCancel(metadata.NewOutgoingContext(serverStream.Context(), md))
+	defer cancel()
+	desc := &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}
+	clientStream, err := g.node.NewStream(ctx, desc, method, grpc.ForceCodec(rawCodec{}))
+	if err != nil {
+		return err
+	}
+
+	// requests flow from the gateway client to the node. If forwarding fails
+	// the call to the node fails too, which ends the loop below.
+	go g.forwardRequests(method, serverStream, clientStream)
+
+	// responses flow back until the node ends the call
+	header, err := clientStream.Header()
+	if err != nil {
+		return err
+	}
+	if err = serverStream.SendHeader(header); err != nil {
+		return err
+	}
+	for {
+		f := &frame{}
+		err := clientStream.RecvMsg(f)
+		if errors.Is(err, io.EOF) {
+			serverStream.SetTrailer(clientStream.Trailer())
+			return nil
+		}
+		if err != nil {
+			serverStream.SetTrailer(clientStream.Trailer())
+			return err
+		}
+		if err = serverStream.SendMsg(f); err != nil {
+			return err
+		}
+	}
+}
+
+func (g *Gateway) forwardRequests(method string, serverStream grpc.ServerStream, clientStream grpc.ClientStream) {
+	for {
+		f := &frame{}
+		err := serverStream.RecvMsg(f)
+		if err == io.EOF {
+			err = clientStream.CloseSend()
+			if err != nil {
+				g.log.Debugf("gRPC gateway failed to close request stream of %s: %v", method, err)
+			}
+			return
+		}
+		if err != nil {
+			g.log.Debugf("gRPC gateway failed to receive request of %s: %v", method, err)
+			return
+		}
+		err = clientStream.SendMsg(f)
+		if err != nil {
+			g.log.Debugf("gRPC gateway failed to forward request of %s: %v", method, err)
+			return
+		}
+	}
+}
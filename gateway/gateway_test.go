@@ -0,0 +1,137 @@
+package gateway
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type pinger struct {
+	p2pproto.UnimplementedPingerServer
+}
+
+func (pinger) Ping(ctx context.Context, req *p2pproto.PingRequest) (*p2pproto.PingResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if len(md.Get("authorization")) > 0 {
+		return nil, status.Error(codes.InvalidArgument, "token forwarded to the node")
+	}
+	return &p2pproto.PingResponse{Pong: req.Ping, Version: "0.1.0"}, nil
+}
+
+// writeCertificate writes a self-signed certificate for 127.0.0.1 and its key
+func writeCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gateway"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestGateway(t *testing.T) {
+	// the node
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := grpc.NewServer()
+	p2pproto.RegisterPingerServer(node, pinger{})
+	go node.Serve(listener)
+	defer node.Stop()
+	nodeConn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nodeConn.Close()
+
+	// the gateway, on a free port
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := free.Addr().String()
+	free.Close()
+	certFile, keyFile := writeCertificate(t)
+	if _, err := Start(Config{Addr: addr, Token: "secret"}, nodeConn, logrus.New()); err == nil {
+		t.Fatal("expected the gateway to require TLS")
+	}
+	if _, err := Start(Config{Addr: addr, CertFile: certFile, KeyFile: keyFile}, nodeConn, logrus.New()); err == nil {
+		t.Fatal("expected the gateway to require a token")
+	}
+	stop, err := Start(Config{Addr: addr, CertFile: certFile, KeyFile: keyFile, Token: "secret"}, nodeConn, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{InsecureSkipVerify: true})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := p2pproto.NewPingerClient(conn)
+
+	_, err = client.Ping(context.Background(), &p2pproto.PingRequest{Ping: "hi"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated without token, got %v", err)
+	}
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+	resp, err := client.Ping(ctx, &p2pproto.PingRequest{Ping: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Pong != "hi" || resp.Version != "0.1.0" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	_, err = p2pproto.NewAdminClient(conn).Restart(ctx, &p2pproto.RestartRequest{})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected the Admin service to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"github.com/nustiueudinastea/doltswarm"
+	"github.com/nustiueudinastea/doltswarmdemo/commitlog"
+)
+
+// historyDB adds paginated commit listing to the doltswarm database
+type historyDB struct {
+	*doltswarm.DB
+}
+
+func (db historyDB) ListCommits(opts commitlog.Options) (commitlog.Page, error) {
+	return commitlog.List(db.DB, opts)
+}
@@ -0,0 +1,130 @@
+// Package hlc implements hybrid logical clocks. A timestamp is the wall time
+// of the node, unless a later timestamp was seen from another node, in which
+// case that one is advanced by a logical counter. Timestamps respect causality
+// like vector clocks, stay close to the wall time, and are never behind a
+// timestamp the node already knows of, whatever the skew between the clocks.
+package hlc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// trailerPrefix marks the line of a commit message that holds the timestamp
+const trailerPrefix = "HLC: "
+
+// Timestamp is a hybrid logical clock timestamp
+type Timestamp struct {
+	// Wall is the largest wall time seen, in nanoseconds since the epoch
+	Wall int64
+	// Logical orders the timestamps that have the same wall time
+	Logical uint32
+}
+
+// IsZero returns true for the zero timestamp
+func (ts Timestamp) IsZero() bool {
+	return ts.Wall == 0 && ts.Logical == 0
+}
+
+// Compare returns -1, 0 or 1 if ts is before, equal to or after other
+func (ts Timestamp) Compare(other Timestamp) int {
+	switch {
+	case ts.Wall < other.Wall:
+		return -1
+	case ts.Wall > other.Wall:
+		return 1
+	case ts.Logical < other.Logical:
+		return -1
+	case ts.Logical > other.Logical:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Time returns the wall time of the timestamp
+func (ts Timestamp) Time() time.Time {
+	return time.Unix(0, ts.Wall)
+}
+
+func (ts Timestamp) String() string {
+	return fmt.Sprintf("%d.%d", ts.Wall, ts.Logical)
+}
+
+// Parse parses a timestamp formatted by String
+func Parse(s string) (Timestamp, error) {
+	wall, logical, found := strings.Cut(s, ".")
+	if !found {
+		return Timestamp{}, fmt.Errorf("invalid hybrid timestamp '%s'", s)
+	}
+	w, err := strconv.ParseInt(wall, 10, 64)
+	if err != nil {
+		return Timestamp{}, fmt.Errorf("invalid hybrid timestamp '%s': %w", s, err)
+	}
+	l, err := strconv.ParseUint(logical, 10, 32)
+	if err != nil {
+		return Timestamp{}, fmt.Errorf("invalid hybrid timestamp '%s': %w", s, err)
+	}
+	return Timestamp{Wall: w, Logical: uint32(l)}, nil
+}
+
+// Clock hands out hybrid timestamps
+type Clock struct {
+	mtx  sync.Mutex
+	now  func() time.Time
+	last Timestamp
+}
+
+// New creates a clock using the wall time of the node
+func New() *Clock {
+	return &Clock{now: time.Now}
+}
+
+// Now returns a timestamp after every timestamp handed out or seen before
+func (c *Clock) Now() Timestamp {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	wall := c.now().UnixNano()
+	if wall > c.last.Wall {
+		c.last = Timestamp{Wall: wall}
+	} else {
+		c.last.Logical++
+	}
+	return c.last
+}
+
+// Update merges a timestamp received from another node, so that the following
+// timestamps come after it
+func (c *Clock) Update(remote Timestamp) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if remote.Compare(c.last) > 0 {
+		c.last = remote
+	}
+}
+
+// Annotate appends the timestamp to a commit message as a trailer line
+func Annotate(msg string, ts Timestamp) string {
+	return msg + "\n\n" + trailerPrefix + ts.String()
+}
+
+// FromMessage extracts the timestamp from a commit message. It returns false if
+// the message has no timestamp attached.
+func FromMessage(msg string) (Timestamp, bool) {
+	idx := strings.LastIndex(msg, trailerPrefix)
+	if idx < 0 {
+		return Timestamp{}, false
+	}
+	line := msg[idx+len(trailerPrefix):]
+	if end := strings.IndexByte(line, '\n'); end >= 0 {
+		line = line[:end]
+	}
+	ts, err := Parse(strings.TrimSpace(line))
+	if err != nil {
+		return Timestamp{}, false
+	}
+	return ts, true
+}
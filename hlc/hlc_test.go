@@ -0,0 +1,50 @@
+package hlc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	wall := time.Unix(100, 0)
+	c := &Clock{now: func() time.Time { return wall }}
+
+	first := c.Now()
+	second := c.Now()
+	if first.Wall != wall.UnixNano() || second.Compare(first) <= 0 {
+		t.Fatalf("expected increasing timestamps, got %s and %s", first, second)
+	}
+
+	// a node with a clock ahead of ours
+	remote := Timestamp{Wall: time.Unix(200, 0).UnixNano(), Logical: 3}
+	c.Update(remote)
+	if ts := c.Now(); ts.Wall != remote.Wall || ts.Logical != 4 {
+		t.Errorf("expected the timestamp to follow the remote one, got %s", ts)
+	}
+
+	// the wall time catches up
+	wall = time.Unix(300, 0)
+	if ts := c.Now(); ts.Wall != wall.UnixNano() || ts.Logical != 0 {
+		t.Errorf("expected the wall time to be used again, got %s", ts)
+	}
+	c.Update(remote)
+	if ts := c.Now(); ts.Wall != wall.UnixNano() || ts.Logical != 1 {
+		t.Errorf("expected an older remote timestamp to be ignored, got %s", ts)
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	ts := Timestamp{Wall: 1700000000000000000, Logical: 2}
+	msg := Annotate("Periodic commit", ts) + "\nVClock: {}"
+
+	parsed, found := FromMessage(msg)
+	if !found || parsed != ts {
+		t.Fatalf("expected %s in message '%s', got %s", ts, msg, parsed)
+	}
+	if _, found := FromMessage("Periodic commit"); found {
+		t.Errorf("expected no timestamp in a plain message")
+	}
+	if _, found := FromMessage("HLC: garbage"); found {
+		t.Errorf("expected an invalid timestamp to be ignored")
+	}
+}
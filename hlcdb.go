@@ -0,0 +1,44 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/nustiueudinastea/doltswarmdemo/hlc"
+	p2psrv "github.com/nustiueudinastea/doltswarmdemo/p2p/server"
+)
+
+// hlcDB wraps an ExternalDB and attaches a hybrid logical clock timestamp to
+// every commit it creates, so that conflicting writes can be ordered even when
+// the clocks of the nodes are skewed.
+type hlcDB struct {
+	p2psrv.ExternalDB
+
+	mtx   sync.Mutex
+	clock *hlc.Clock
+}
+
+func newHLCDB(db p2psrv.ExternalDB) *hlcDB {
+	return &hlcDB{
+		ExternalDB: db,
+		clock:      hlc.New(),
+	}
+}
+
+// ExecAndCommit merges the timestamps of all known commits into the local
+// clock and attaches a timestamp following all of them to the new commit.
+func (db *hlcDB) ExecAndCommit(query string, commitMsg string) (string, error) {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+
+	commits, err := db.GetAllCommits()
+	if err != nil {
+		return "", err
+	}
+	for _, commit := range commits {
+		if ts, found := hlc.FromMessage(commit.Message); found {
+			db.clock.Update(ts)
+		}
+	}
+
+	return db.ExternalDB.ExecAndCommit(query, hlc.Annotate(commitMsg, db.clock.Now()))
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+	"github.com/nustiueudinastea/doltswarmdemo/trailer"
+)
+
+// databaseIDKey is the trailer of the initial commit holding the ID of the
+// database, which replicates it to the nodes initialized from a peer
+const databaseIDKey = "Database-Id"
+
+// databaseIdentity reads the identity of the database from its history. The
+// ID and genesis commit are left empty until the database is initialized, and
+// the ID stays empty for databases created before it was recorded.
+func databaseIdentity() (p2p.DatabaseIdentity, error) {
+	identity := p2p.DatabaseIdentity{Name: dbName}
+	commits, err := dbi.GetAllCommits()
+	if err != nil {
+		log.Debugf("Database identity not known yet: %v", err)
+		return identity, nil
+	}
+	if len(commits) == 0 {
+		return identity, nil
+	}
+	sort.SliceStable(commits, func(i, j int) bool {
+		return commits[i].Date.Before(commits[j].Date)
+	})
+	identity.Genesis = commits[0].Hash
+	for _, commit := range commits {
+		if id, found := trailer.Get(commit.Message, databaseIDKey); found {
+			identity.ID = id
+			break
+		}
+	}
+	return identity, nil
+}
@@ -0,0 +1,286 @@
+// Package importer loads CSV, JSON and Parquet files into a table. The rows
+// are committed in chunks, so that a large file doesn't end up in a single
+// commit that peers have to pull at once, and the progress is saved after
+// every chunk so that an interrupted import resumes after the last committed
+// row.
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultChunkSize is the number of rows committed together by default
+const DefaultChunkSize = 1000
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// Format is the format of an imported file
+type Format string
+
+const (
+	FormatCSV     Format = "csv"
+	FormatJSON    Format = "json"
+	FormatParquet Format = "parquet"
+)
+
+// ParseFormat parses the name of a format. The format is detected from the
+// extension of the file if s is empty.
+func ParseFormat(s string, path string) (Format, error) {
+	if s == "" {
+		s = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		switch s {
+		case "jsonl", "ndjson":
+			s = string(FormatJSON)
+		case "parq":
+			s = string(FormatParquet)
+		}
+	}
+	switch Format(s) {
+	case FormatCSV, FormatJSON, FormatParquet:
+		return Format(s), nil
+	default:
+		return "", fmt.Errorf("unknown import format '%s', expected csv, json or parquet", s)
+	}
+}
+
+// Status is the state of an import
+type Status string
+
+const (
+	StatusRunning Status = "running"
+	StatusDone    Status = "done"
+	StatusFailed  Status = "failed"
+)
+
+// State describes an import and its progress. It is saved after every chunk.
+type State struct {
+	ID        string `json:"id"`
+	Path      string `json:"path"`
+	Table     string `json:"table"`
+	Format    Format `json:"format"`
+	ChunkSize int    `json:"chunk_size"`
+	// PauseAnnouncements holds back the announcements of the new commits to
+	// peers until the import completes
+	PauseAnnouncements bool `json:"pause_announcements,omitempty"`
+	// FileSize and ModTime identify the imported version of the file, so that
+	// a file changed in the meantime is not resumed
+	FileSize int64     `json:"file_size"`
+	ModTime  time.Time `json:"mod_time"`
+
+	Status Status `json:"status"`
+	// Rows is the number of rows committed so far, and TotalRows the number of
+	// rows of the file if it's known upfront
+	Rows       int64     `json:"rows"`
+	TotalRows  int64     `json:"total_rows,omitempty"`
+	Commits    int       `json:"commits"`
+	LastCommit string    `json:"last_commit,omitempty"`
+	Err        string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// NewState validates an import of the file at path into table
+func NewState(id string, path string, table string, format Format, chunkSize int) (State, error) {
+	if !validName.MatchString(table) {
+		return State{}, fmt.Errorf("invalid table name '%s'", table)
+	}
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return State{}, fmt.Errorf("failed to read import file: %w", err)
+	}
+	if info.IsDir() {
+		return State{}, fmt.Errorf("import file '%s' is a directory", path)
+	}
+	return State{
+		ID:        id,
+		Path:      path,
+		Table:     table,
+		Format:    format,
+		ChunkSize: chunkSize,
+		FileSize:  info.Size(),
+		ModTime:   info.ModTime(),
+		Status:    StatusRunning,
+		StartedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}, nil
+}
+
+// CommitFunc executes a statement and commits it with the given message,
+// returning the commit hash
+type CommitFunc func(query string, commitMsg string) (string, error)
+
+// Run imports the rows of the file that were not committed yet, one chunk per
+// commit, and calls save with the progress after every chunk. Rows are written
+// with REPLACE, so a chunk committed right before a crash, and imported again
+// on resume, doesn't duplicate the rows of tables with a primary key.
+//
+// The import stops after the current chunk when ctx is done, and the state is
+// left running so that it can be resumed.
+func Run(ctx context.Context, state *State, commit CommitFunc, save func(State) error) error {
+	err := run(ctx, state, commit, save)
+	if err != nil && ctx.Err() == nil {
+		state.Status = StatusFailed
+		state.Err = err.Error()
+		state.UpdatedAt = time.Now()
+		if saveErr := save(*state); saveErr != nil {
+			return fmt.Errorf("%w (and failed to save the import state: %v)", err, saveErr)
+		}
+	}
+	return err
+}
+
+func run(ctx context.Context, state *State, commit CommitFunc, save func(State) error) error {
+	info, err := os.Stat(state.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read import file: %w", err)
+	}
+	if info.Size() != state.FileSize || !info.ModTime().Equal(state.ModTime) {
+		return fmt.Errorf("'%s' changed since the import started", state.Path)
+	}
+
+	src, err := Open(state.Path, state.Format)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if p, ok := src.(*parquetSource); ok {
+		state.TotalRows = p.r.GetNumRows()
+	}
+
+	// skip the rows committed before the import was interrupted
+	for skipped := int64(0); skipped < state.Rows; skipped++ {
+		if _, err := src.Next(); err != nil {
+			return fmt.Errorf("failed to skip the %d imported rows: %w", state.Rows, err)
+		}
+	}
+
+	state.Status = StatusRunning
+	state.Err = ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rows := make([]map[string]any, 0, state.ChunkSize)
+		for len(rows) < state.ChunkSize {
+			row, err := src.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read row %d: %w", state.Rows+int64(len(rows))+1, err)
+			}
+			rows = append(rows, row)
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		query, err := replaceStatement(state.Table, chunkColumns(src, rows), rows)
+		if err != nil {
+			return fmt.Errorf("failed to import row %d: %w", state.Rows+1, err)
+		}
+		msg := fmt.Sprintf("Import rows %d-%d of %s into %s", state.Rows+1, state.Rows+int64(len(rows)), filepath.Base(state.Path), state.Table)
+		hash, err := commit(query, msg)
+		if err != nil {
+			return fmt.Errorf("failed to commit rows %d-%d: %w", state.Rows+1, state.Rows+int64(len(rows)), err)
+		}
+		state.Rows += int64(len(rows))
+		state.Commits++
+		if hash != "" {
+			state.LastCommit = hash
+		}
+		state.UpdatedAt = time.Now()
+		if err := save(*state); err != nil {
+			return fmt.Errorf("failed to save the import state: %w", err)
+		}
+	}
+
+	state.Status = StatusDone
+	state.UpdatedAt = time.Now()
+	return save(*state)
+}
+
+// replaceStatement returns the statement writing the rows to the table.
+// Columns missing from a row are set to NULL.
+func replaceStatement(table string, columns []string, rows []map[string]any) (string, error) {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		if !validName.MatchString(column) {
+			return "", fmt.Errorf("invalid column name '%s'", column)
+		}
+		quoted[i] = "`" + column + "`"
+	}
+	values := make([]string, len(rows))
+	for i, row := range rows {
+		literals := make([]string, len(columns))
+		for j, column := range columns {
+			literal, err := sqlLiteral(row[column])
+			if err != nil {
+				return "", fmt.Errorf("column '%s': %w", column, err)
+			}
+			literals[j] = literal
+		}
+		values[i] = "(" + strings.Join(literals, ", ") + ")"
+	}
+	return fmt.Sprintf("REPLACE INTO `%s` (%s) VALUES %s;", table, strings.Join(quoted, ", "), strings.Join(values, ", ")), nil
+}
+
+// sqlLiteral renders a value read from a file as a SQL literal. Nested values
+// are written as JSON.
+func sqlLiteral(v any) (string, error) {
+	switch t := v.(type) {
+	case nil:
+		return "NULL", nil
+	case string:
+		return quote(t), nil
+	case []byte:
+		return quote(string(t)), nil
+	case bool:
+		if t {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case json.Number:
+		return t.String(), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(t), nil
+	case float32:
+		return strconv.FormatFloat(float64(t), 'g', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(t, 'g', -1, 64), nil
+	case time.Time:
+		return quote(t.UTC().Format("2006-01-02 15:04:05.999999")), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return "NULL", nil
+		}
+		return sqlLiteral(rv.Elem().Interface())
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return quote(string(encoded)), nil
+}
+
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `''`)
+	return "'" + s + "'"
+}
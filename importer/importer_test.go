@@ -0,0 +1,161 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+type recorder struct {
+	queries []string
+	msgs    []string
+	fail    int
+}
+
+func (r *recorder) commit(query string, msg string) (string, error) {
+	if r.fail > 0 && len(r.queries) == r.fail {
+		return "", fmt.Errorf("disk full")
+	}
+	r.queries = append(r.queries, query)
+	r.msgs = append(r.msgs, msg)
+	return fmt.Sprintf("c%d", len(r.queries)), nil
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestImportCSV(t *testing.T) {
+	path := writeFile(t, "people.csv", "id,name\n1,ann\n2,o'brien\n3,bob\n")
+	format, err := ParseFormat("", path)
+	if err != nil || format != FormatCSV {
+		t.Fatalf("expected the format to be detected, got %s %v", format, err)
+	}
+	state, err := NewState("i1", path, "people", format, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the second chunk fails, as if the node crashed
+	r := &recorder{fail: 1}
+	saved := []State{}
+	save := func(s State) error {
+		saved = append(saved, s)
+		return nil
+	}
+	if err := Run(context.Background(), &state, r.commit, save); err == nil {
+		t.Fatalf("expected the failed commit to be returned")
+	}
+	if state.Status != StatusFailed || state.Rows != 2 || state.Commits != 1 || state.LastCommit != "c1" {
+		t.Fatalf("unexpected state after failure %+v", state)
+	}
+	want := "REPLACE INTO `people` (`id`, `name`) VALUES ('1', 'ann'), ('2', 'o''brien');"
+	if r.queries[0] != want {
+		t.Errorf("got %q, want %q", r.queries[0], want)
+	}
+
+	// resuming only imports the rows that were not committed
+	r.fail = 0
+	if err := Run(context.Background(), &state, r.commit, save); err != nil {
+		t.Fatal(err)
+	}
+	if state.Status != StatusDone || state.Rows != 3 || state.Commits != 2 || len(r.queries) != 2 {
+		t.Fatalf("unexpected state after resume %+v", state)
+	}
+	if r.queries[1] != "REPLACE INTO `people` (`id`, `name`) VALUES ('3', 'bob');" || r.msgs[1] != "Import rows 3-3 of people.csv into people" {
+		t.Errorf("unexpected resumed chunk %q %q", r.queries[1], r.msgs[1])
+	}
+	if last := saved[len(saved)-1]; last.Status != StatusDone || last.Err != "" {
+		t.Errorf("expected the final state to be saved, got %+v", last)
+	}
+
+	// a file changed after the import started is not resumed
+	state.Status = StatusRunning
+	state.Rows = 1
+	os.WriteFile(path, []byte("id,name\n1,changed\n"), 0600)
+	if err := Run(context.Background(), &state, r.commit, save); err == nil || !strings.Contains(err.Error(), "changed") {
+		t.Errorf("expected an error for a changed file, got %v", err)
+	}
+}
+
+func TestImportJSON(t *testing.T) {
+	for _, content := range []string{
+		`[{"id": 1, "tags": ["a"]}, {"id": 2.5, "name": null, "ok": true}]`,
+		"{\"id\": 1, \"tags\": [\"a\"]}\n{\"id\": 2.5, \"name\": null, \"ok\": true}\n",
+	} {
+		path := writeFile(t, "rows.json", content)
+		state, err := NewState("i1", path, "t", FormatJSON, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &recorder{}
+		if err := Run(context.Background(), &state, r.commit, func(State) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+		want := "REPLACE INTO `t` (`id`, `name`, `ok`, `tags`) VALUES (1, NULL, NULL, '[\"a\"]'), (2.5, NULL, TRUE, NULL);"
+		if len(r.queries) != 1 || r.queries[0] != want {
+			t.Errorf("got %q, want %q", r.queries, want)
+		}
+	}
+
+	path := writeFile(t, "bad.json", `[{"bad column": 1}]`)
+	state, _ := NewState("i1", path, "t", FormatJSON, 10)
+	if err := Run(context.Background(), &state, (&recorder{}).commit, func(State) error { return nil }); err == nil {
+		t.Errorf("expected an error for an invalid column name")
+	}
+	if _, err := NewState("i1", path, "t; DROP TABLE t", FormatJSON, 10); err == nil {
+		t.Errorf("expected an error for an invalid table name")
+	}
+}
+
+type parquetRow struct {
+	ID   int64   `parquet:"name=id, type=INT64"`
+	Name *string `parquet:"name=name, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+}
+
+func TestImportParquet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rows.parquet")
+	f, err := local.NewLocalFileWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := writer.NewParquetWriter(f, new(parquetRow), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := "ann"
+	for _, row := range []parquetRow{{ID: 1, Name: &name}, {ID: 2}, {ID: 3}} {
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.WriteStop(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	state, err := NewState("i1", path, "t", FormatParquet, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &recorder{}
+	if err := Run(context.Background(), &state, r.commit, func(State) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if state.TotalRows != 3 || state.Rows != 3 || len(r.queries) != 2 {
+		t.Fatalf("unexpected state %+v", state)
+	}
+	if want := "REPLACE INTO `t` (`id`, `name`) VALUES (1, 'ann'), (2, NULL);"; r.queries[0] != want {
+		t.Errorf("got %q, want %q", r.queries[0], want)
+	}
+}
@@ -0,0 +1,249 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// parquetBatch is the number of rows decoded at once from a Parquet file
+const parquetBatch = 1000
+
+// Source reads the rows of a file
+type Source interface {
+	// Columns returns the columns of the rows, or nil if they can differ from
+	// row to row
+	Columns() []string
+	// Next returns the next row, or io.EOF after the last one
+	Next() (map[string]any, error)
+	Close() error
+}
+
+// Open opens a file for reading in the given format
+func Open(path string, format Format) (Source, error) {
+	switch format {
+	case FormatCSV:
+		return openCSV(path)
+	case FormatJSON:
+		return openJSON(path)
+	case FormatParquet:
+		return openParquet(path)
+	default:
+		return nil, fmt.Errorf("unknown import format '%s'", format)
+	}
+}
+
+// csvSource reads a CSV file with a header line. Values are read as strings.
+type csvSource struct {
+	f       *os.File
+	r       *csv.Reader
+	columns []string
+}
+
+func openCSV(path string) (*csvSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := csv.NewReader(bufio.NewReader(f))
+	r.ReuseRecord = true
+	header, err := r.Read()
+	if err != nil {
+		f.Close()
+		if err == io.EOF {
+			return nil, fmt.Errorf("'%s' has no header line", path)
+		}
+		return nil, fmt.Errorf("failed to read header of '%s': %w", path, err)
+	}
+	return &csvSource{f: f, r: r, columns: append([]string{}, header...)}, nil
+}
+
+func (s *csvSource) Columns() []string {
+	return s.columns
+}
+
+func (s *csvSource) Next() (map[string]any, error) {
+	record, err := s.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	row := make(map[string]any, len(s.columns))
+	for i, column := range s.columns {
+		row[column] = record[i]
+	}
+	return row, nil
+}
+
+func (s *csvSource) Close() error {
+	return s.f.Close()
+}
+
+// jsonSource reads a JSON array of objects, or a stream of objects like JSON
+// lines
+type jsonSource struct {
+	f     *os.File
+	dec   *json.Decoder
+	array bool
+}
+
+func openJSON(path string) (*jsonSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(f)
+	s := &jsonSource{f: f}
+	// skip the leading whitespace to find out if the rows are in an array
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if b == ' ' || b == '\t' || b == '\r' || b == '\n' {
+			continue
+		}
+		s.array = b == '['
+		br.UnreadByte()
+		break
+	}
+	s.dec = json.NewDecoder(br)
+	s.dec.UseNumber()
+	if s.array {
+		// consume the opening bracket so that the rows are decoded one by one
+		if _, err := s.dec.Token(); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *jsonSource) Columns() []string {
+	return nil
+}
+
+func (s *jsonSource) Next() (map[string]any, error) {
+	if s.array && !s.dec.More() {
+		return nil, io.EOF
+	}
+	row := map[string]any{}
+	err := s.dec.Decode(&row)
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("invalid JSON row: %w", err)
+	}
+	return row, nil
+}
+
+func (s *jsonSource) Close() error {
+	return s.f.Close()
+}
+
+// parquetSource reads the top level columns of a Parquet file. Nested columns
+// are imported as JSON.
+type parquetSource struct {
+	f       source.ParquetFile
+	r       *reader.ParquetReader
+	columns []string
+	// fields are the names of the columns in the decoded structs
+	fields  []string
+	pending []any
+	left    int64
+}
+
+func openParquet(path string) (*parquetSource, error) {
+	f, err := local.NewLocalFileReader(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := reader.NewParquetReader(f, nil, 1)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read '%s': %w", path, err)
+	}
+	s := &parquetSource{f: f, r: r, left: r.GetNumRows()}
+	sh := r.SchemaHandler
+	root := sh.GetRootInName()
+	for _, info := range sh.Infos[1:] {
+		idx := sh.MapIndex[common.PathToStr([]string{root, info.InName})]
+		if idx <= 0 || sh.Infos[idx] != info {
+			continue
+		}
+		s.columns = append(s.columns, info.ExName)
+		s.fields = append(s.fields, info.InName)
+	}
+	return s, nil
+}
+
+func (s *parquetSource) Columns() []string {
+	return s.columns
+}
+
+func (s *parquetSource) Next() (map[string]any, error) {
+	if len(s.pending) == 0 {
+		if s.left == 0 {
+			return nil, io.EOF
+		}
+		n := int64(parquetBatch)
+		if s.left < n {
+			n = s.left
+		}
+		rows, err := s.r.ReadByNumber(int(n))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Parquet rows: %w", err)
+		}
+		if len(rows) == 0 {
+			return nil, io.EOF
+		}
+		s.left -= int64(len(rows))
+		s.pending = rows
+	}
+	v := reflect.ValueOf(s.pending[0])
+	s.pending = s.pending[1:]
+	row := make(map[string]any, len(s.columns))
+	for i, column := range s.columns {
+		row[column] = v.FieldByName(s.fields[i]).Interface()
+	}
+	return row, nil
+}
+
+func (s *parquetSource) Close() error {
+	s.r.ReadStop()
+	return s.f.Close()
+}
+
+// chunkColumns returns the columns of a chunk of rows: the columns of the
+// source if they are fixed, or else every column of the chunk in sorted order
+func chunkColumns(src Source, rows []map[string]any) []string {
+	if columns := src.Columns(); columns != nil {
+		return columns
+	}
+	seen := map[string]bool{}
+	columns := []string{}
+	for _, row := range rows {
+		for column := range row {
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/importer"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	importsDir          = "imports"
+	importRequestPrefix = "import-request-"
+	importsInterval     = time.Second
+	importStartTimeout  = 10 * time.Second
+)
+
+// importRequest asks the running server to start a new import, or to resume
+// a failed one
+type importRequest struct {
+	State  *importer.State `json:"state,omitempty"`
+	Resume string          `json:"resume,omitempty"`
+}
+
+func importStatePath(id string) string {
+	return filepath.Join(workDir, importsDir, id+".json")
+}
+
+func readImportState(id string) (importer.State, error) {
+	state := importer.State{}
+	data, err := os.ReadFile(importStatePath(id))
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return state, fmt.Errorf("failed to parse import '%s': %w", id, err)
+	}
+	return state, nil
+}
+
+func listImports() ([]importer.State, error) {
+	paths, _ := filepath.Glob(filepath.Join(workDir, importsDir, "*.json"))
+	states := []importer.State{}
+	for _, path := range paths {
+		state, err := readImportState(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].StartedAt.Before(states[j].StartedAt) })
+	return states, nil
+}
+
+// importTracker runs the imports requested by the import command. Imports
+// interrupted by a restart are resumed when the server starts.
+type importTracker struct {
+	consistency p2pproto.Consistency
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	mtx     sync.Mutex
+	running map[string]bool
+}
+
+// startImportTracker resumes the interrupted imports and starts the ones
+// requested in the working directory
+func startImportTracker(consistency p2pproto.Consistency) func() error {
+	log.Info("Starting import tracker")
+	t := &importTracker{consistency: consistency, running: map[string]bool{}}
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+	err := os.MkdirAll(filepath.Join(workDir, importsDir), 0700)
+	if err != nil {
+		log.Errorf("Failed to create imports directory: %s", err.Error())
+	}
+
+	states, err := listImports()
+	if err != nil {
+		log.Errorf("Failed to list imports: %s", err.Error())
+	}
+	for _, state := range states {
+		if state.Status == importer.StatusRunning {
+			log.Infof("Resuming import %s of %s after %d rows", state.ID, state.Path, state.Rows)
+			t.start(state)
+		}
+	}
+
+	ticker := time.NewTicker(importsInterval)
+	stopSignal := make(chan struct{})
+	crashReporter.Go("import-tracker", func() {
+		for {
+			select {
+			case <-ticker.C:
+				t.processRequests()
+			case <-stopSignal:
+				return
+			}
+		}
+	})
+	return func() error {
+		log.Info("Stopping import tracker")
+		ticker.Stop()
+		close(stopSignal)
+		// running imports stop after their current chunk and resume on the
+		// next start
+		t.cancel()
+		t.wg.Wait()
+		return nil
+	}
+}
+
+func (t *importTracker) processRequests() {
+	paths, _ := filepath.Glob(filepath.Join(workDir, importRequestPrefix+"*.json"))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Errorf("Failed to read import request: %s", err.Error())
+			continue
+		}
+		os.Remove(path)
+
+		req := importRequest{}
+		err = json.Unmarshal(data, &req)
+		if err != nil {
+			log.Errorf("Failed to parse import request: %s", err.Error())
+			continue
+		}
+		state := importer.State{}
+		if req.Resume != "" {
+			state, err = readImportState(req.Resume)
+			if err != nil {
+				log.Errorf("Failed to resume import '%s': %s", req.Resume, err.Error())
+				continue
+			}
+			if state.Status == importer.StatusDone {
+				continue
+			}
+		} else if req.State != nil {
+			state = *req.State
+		} else {
+			log.Errorf("Ignoring empty import request")
+			continue
+		}
+		t.start(state)
+	}
+}
+
+func (t *importTracker) save(state importer.State) error {
+	return writeJSON(importStatePath(state.ID), state)
+}
+
+// start runs an import in the background unless it's already running
+func (t *importTracker) start(state importer.State) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.running[state.ID] {
+		return
+	}
+	state.Status = importer.StatusRunning
+	state.Err = ""
+	state.UpdatedAt = time.Now()
+	err := t.save(state)
+	if err != nil {
+		log.Errorf("Failed to save import '%s': %s", state.ID, err.Error())
+		return
+	}
+	t.running[state.ID] = true
+	t.wg.Add(1)
+
+	crashReporter.Go("import-"+state.ID, func() {
+		defer t.wg.Done()
+		defer func() {
+			t.mtx.Lock()
+			delete(t.running, state.ID)
+			t.mtx.Unlock()
+		}()
+
+		consistency := t.consistency
+		if state.PauseAnnouncements {
+			release := p2pmgr.HoldAnnouncements()
+			defer release()
+			// peers don't learn about the commits before the import is done,
+			// so they can't acknowledge them
+			consistency = p2pproto.Consistency_CONSISTENCY_LOCAL
+		}
+		commit := func(query string, commitMsg string) (string, error) {
+			return p2pmgr.ExecAndCommit(query, commitMsg, consistency)
+		}
+
+		log.Infof("Importing %s into %s", state.Path, state.Table)
+		err := importer.Run(t.ctx, &state, commit, t.save)
+		switch {
+		case err == nil:
+			log.Infof("Imported %d rows of %s into %s in %d commits", state.Rows, state.Path, state.Table, state.Commits)
+		case t.ctx.Err() != nil:
+			log.Infof("Import %s interrupted after %d rows", state.ID, state.Rows)
+		default:
+			log.Errorf("Import %s failed after %d rows: %s", state.ID, state.Rows, err.Error())
+		}
+	})
+}
+
+// requestImport asks the server running in the working directory to start or
+// resume an import and returns its ID
+func requestImport(req importRequest) (string, error) {
+	id := ksuid.New().String()
+	err := writeJSON(filepath.Join(workDir, importRequestPrefix+id+".json"), req)
+	if err != nil {
+		return "", err
+	}
+	if req.State != nil {
+		return req.State.ID, nil
+	}
+	return req.Resume, nil
+}
+
+// startImport asks the running server to import a file into a table
+func startImport(path string, table string, format string, chunkSize int, pauseAnnouncements bool, detach bool) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	parsed, err := importer.ParseFormat(format, path)
+	if err != nil {
+		return err
+	}
+	state, err := importer.NewState(ksuid.New().String(), path, table, parsed, chunkSize)
+	if err != nil {
+		return err
+	}
+	state.PauseAnnouncements = pauseAnnouncements
+	id, err := requestImport(importRequest{State: &state})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Import %s requested\n", id)
+	if detach {
+		return nil
+	}
+	return watchImport(id, time.Time{})
+}
+
+// resumeImport asks the running server to resume a failed import
+func resumeImport(id string, detach bool) error {
+	state, err := readImportState(id)
+	if err != nil {
+		return fmt.Errorf("failed to read import '%s': %w", id, err)
+	}
+	if state.Status == importer.StatusDone {
+		return fmt.Errorf("import '%s' is already done", id)
+	}
+	_, err = requestImport(importRequest{Resume: id})
+	if err != nil {
+		return err
+	}
+	if detach {
+		return nil
+	}
+	return watchImport(id, state.UpdatedAt)
+}
+
+// watchImport prints the progress of an import until it completes. The
+// server has to pick up the request within the start timeout, which is
+// noticed from an update of the import after since.
+func watchImport(id string, since time.Time) error {
+	deadline := time.Now().Add(importStartTimeout)
+	started := false
+	for {
+		time.Sleep(500 * time.Millisecond)
+		state, err := readImportState(id)
+		if err == nil && state.UpdatedAt.After(since) {
+			started = true
+		}
+		if !started {
+			if time.Now().After(deadline) {
+				return fmt.Errorf("import was not started within %s. Is the server running?", importStartTimeout)
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Println(formatImport(state))
+		switch state.Status {
+		case importer.StatusDone:
+			return nil
+		case importer.StatusFailed:
+			return fmt.Errorf("import failed: %s. Resume it with 'import resume %s'", state.Err, state.ID)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func formatImport(state importer.State) string {
+	progress := fmt.Sprintf("%d rows", state.Rows)
+	if state.TotalRows > 0 {
+		progress = fmt.Sprintf("%d/%d rows (%.1f%%)", state.Rows, state.TotalRows, float64(state.Rows)/float64(state.TotalRows)*100)
+	}
+	line := fmt.Sprintf("%s %s %s into %s: %s in %d commits", state.ID, state.Status, filepath.Base(state.Path), state.Table, progress, state.Commits)
+	if state.Err != "" {
+		line += ": " + state.Err
+	}
+	return line
+}
+
+// printImports prints the imports of the server running in the working
+// directory
+func printImports() error {
+	states, err := listImports()
+	if err != nil {
+		return err
+	}
+	if len(states) == 0 {
+		fmt.Println("No imports")
+		return nil
+	}
+	for _, state := range states {
+		fmt.Println(formatImport(state))
+	}
+	return nil
+}
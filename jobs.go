@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/scheduler"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	jobsInterval = 5 * time.Second
+	jobsFile     = "jobs.json"
+	// maxClaimHold is the longest lease a node can be granted for a run
+	maxClaimHold = 10 * time.Minute
+)
+
+// maintenanceTasks are the tasks that can be scheduled in the jobs file
+func maintenanceTasks() map[string]scheduler.Task {
+	return map[string]scheduler.Task{
+		"gc": func(ctx context.Context, args map[string]string) (string, error) {
+			_, err := dbi.ExecContext(ctx, "CALL DOLT_GC();")
+			return "", err
+		},
+		"anti-entropy": func(ctx context.Context, args map[string]string) (string, error) {
+			recovered := p2pmgr.AntiEntropy()
+			return fmt.Sprintf("recovered %d missed commits", recovered), nil
+		},
+		"backup": func(ctx context.Context, args map[string]string) (string, error) {
+			var err error
+			switch {
+			case args["url"] != "":
+				_, err = dbi.ExecContext(ctx, "CALL DOLT_BACKUP('sync-url', ?);", args["url"])
+			case args["name"] != "":
+				_, err = dbi.ExecContext(ctx, "CALL DOLT_BACKUP('sync', ?);", args["name"])
+			default:
+				return "", fmt.Errorf("backups require the url or the name of a backup")
+			}
+			if err != nil {
+				return "", err
+			}
+			return "backup synced", nil
+		},
+		"snapshot": func(ctx context.Context, args map[string]string) (string, error) {
+			if args["path"] == "" {
+				return "", fmt.Errorf("snapshots require the path of the archive")
+			}
+			size, err := writeSnapshot(storageBackend.Dir(), args["path"])
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("wrote snapshot of %d bytes", size), nil
+		},
+		"stats": func(ctx context.Context, args map[string]string) (string, error) {
+			tables, err := listTables(ctx)
+			if err != nil {
+				return "", err
+			}
+			if len(tables) == 0 {
+				return "no tables", nil
+			}
+			quoted := make([]string, len(tables))
+			for i, table := range tables {
+				quoted[i] = "`" + strings.ReplaceAll(table, "`", "``") + "`"
+			}
+			_, err = dbi.ExecContext(ctx, "ANALYZE TABLE "+strings.Join(quoted, ", ")+";")
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("analyzed %d tables", len(tables)), nil
+		},
+	}
+}
+
+func listTables(ctx context.Context) ([]string, error) {
+	rows, err := dbi.QueryContext(ctx, "SHOW TABLES;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tables := []string{}
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+// claimJobRun claims a run of a leader-only job with a lease named after the
+// job and the scheduled time, which only one node gets granted
+func claimJobRun(ctx context.Context, job string, slot time.Time, hold time.Duration) (bool, error) {
+	if hold > maxClaimHold {
+		hold = maxClaimHold
+	}
+	name := fmt.Sprintf("job/%s/%d", job, slot.Unix())
+	_, err := p2pmgr.AcquireLease(ctx, name, "scheduler", hold)
+	if status.Code(err) == codes.FailedPrecondition {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// startJobs runs the scheduled maintenance jobs and writes their status to the
+// working directory for the jobs command
+func startJobs(cfg *scheduler.Config) (func() error, error) {
+	s, err := scheduler.New(cfg, maintenanceTasks(), claimJobRun, log)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(workDir, jobsFile)
+	err = s.LoadHistory(path)
+	if err != nil {
+		log.Warnf("Failed to restore the job history: %s", err.Error())
+	}
+	schedulerStopper := s.Start()
+
+	ticker := time.NewTicker(jobsInterval)
+	stopSignal := make(chan struct{})
+	crashReporter.Go("jobs-tracker", func() {
+		for {
+			select {
+			case <-ticker.C:
+				err := writeJSON(path, s.Status())
+				if err != nil {
+					log.Errorf("Failed to write jobs status: %s", err.Error())
+				}
+			case <-stopSignal:
+				return
+			}
+		}
+	})
+	return func() error {
+		ticker.Stop()
+		close(stopSignal)
+		err := schedulerStopper()
+		if err := writeJSON(path, s.Status()); err != nil {
+			log.Errorf("Failed to write jobs status: %s", err.Error())
+		}
+		return err
+	}, nil
+}
+
+// printJobs prints the scheduled jobs of the server running in the working
+// directory and their recent runs
+func printJobs(history int) error {
+	data, err := os.ReadFile(filepath.Join(workDir, jobsFile))
+	if err != nil {
+		return fmt.Errorf("failed to read jobs status. Is the server running with jobs? %w", err)
+	}
+	jobs := []scheduler.JobStatus{}
+	err = json.Unmarshal(data, &jobs)
+	if err != nil {
+		return fmt.Errorf("failed to parse jobs status: %w", err)
+	}
+	if len(jobs) == 0 {
+		fmt.Println("No jobs")
+		return nil
+	}
+	for _, job := range jobs {
+		state := "next run " + job.Next.Format(time.RFC3339)
+		if job.Running {
+			state = "running"
+		}
+		scope := ""
+		if job.Job.LeaderOnly {
+			scope = ", leader-only"
+		}
+		fmt.Printf("%s (%s, %s%s): %s\n", job.Job.Name, job.Job.Task, job.Job.Schedule, scope, state)
+		runs := job.History
+		if len(runs) > history {
+			runs = runs[len(runs)-history:]
+		}
+		for _, run := range runs {
+			outcome := "ok"
+			switch {
+			case run.Skipped != "":
+				outcome = "skipped: " + run.Skipped
+			case run.Err != "":
+				outcome = "failed: " + run.Err
+			case run.Output != "":
+				outcome = "ok: " + run.Output
+			}
+			fmt.Printf("  %s %s %s\n", run.Started.Format(time.RFC3339), run.Duration.Round(time.Millisecond), outcome)
+		}
+	}
+	return nil
+}
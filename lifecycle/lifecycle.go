@@ -0,0 +1,324 @@
+// Package lifecycle starts and stops the subsystems of a node in order. It
+// keeps the health of every subsystem, retries the ones that fail to start
+// and reports the node as ready once all its required subsystems run.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultAttempts = 3
+	defaultBackoff  = time.Second
+	maxBackoff      = time.Minute
+)
+
+// State is the health state of a subsystem
+type State string
+
+const (
+	StatePending  State = "pending"
+	StateStarting State = "starting"
+	StateRunning  State = "running"
+	StateFailed   State = "failed"
+	StateStopped  State = "stopped"
+)
+
+// StartFunc starts a subsystem and returns the function stopping it
+type StartFunc func() (func() error, error)
+
+// Health is the state of a subsystem
+type Health struct {
+	Name     string
+	State    State
+	Required bool
+	// Attempts is the number of times the subsystem was started
+	Attempts int
+	Err      string
+	Since    time.Time
+}
+
+type subsystem struct {
+	name     string
+	start    StartFunc
+	required bool
+	stop     func() error
+	health   Health
+}
+
+// Option configures a subsystem
+type Option func(s *subsystem)
+
+// Optional lets the node become ready without the subsystem. An optional
+// subsystem that fails to start keeps being retried in the background.
+func Optional() Option {
+	return func(s *subsystem) {
+		s.required = false
+	}
+}
+
+// Manager starts the subsystems in the order they were added and stops them
+// in reverse order
+type Manager struct {
+	log      *logrus.Entry
+	attempts int
+	backoff  time.Duration
+
+	mtx        sync.Mutex
+	subsystems []*subsystem
+	started    bool
+	ready      chan struct{}
+	stopSignal chan struct{}
+	wg         sync.WaitGroup
+}
+
+// New creates a manager that tries every subsystem attempts times, waiting
+// backoff after the first failure and doubling it after every other one
+func New(logger *logrus.Entry, attempts int, backoff time.Duration) *Manager {
+	if attempts <= 0 {
+		attempts = defaultAttempts
+	}
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+	return &Manager{
+		log:        logger,
+		attempts:   attempts,
+		backoff:    backoff,
+		ready:      make(chan struct{}),
+		stopSignal: make(chan struct{}),
+	}
+}
+
+// Add registers a subsystem. Subsystems are required unless the Optional
+// option is given.
+func (m *Manager) Add(name string, start StartFunc, opts ...Option) {
+	s := &subsystem{name: name, start: start, required: true}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.health = Health{Name: name, State: StatePending, Required: s.required, Since: time.Now()}
+	m.mtx.Lock()
+	m.subsystems = append(m.subsystems, s)
+	m.mtx.Unlock()
+}
+
+func (m *Manager) setState(s *subsystem, state State, err error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	s.health.State = state
+	s.health.Since = time.Now()
+	s.health.Err = ""
+	if err != nil {
+		s.health.Err = err.Error()
+	}
+	if state == StateStarting {
+		s.health.Attempts++
+	}
+	m.checkReady()
+}
+
+// checkReady closes the ready channel once every required subsystem runs. It
+// has to be called with the lock held.
+func (m *Manager) checkReady() {
+	select {
+	case <-m.ready:
+		return
+	default:
+	}
+	if m.allRunning() {
+		close(m.ready)
+	}
+}
+
+// allRunning returns true if the manager was started and every required
+// subsystem runs. It has to be called with the lock held.
+func (m *Manager) allRunning() bool {
+	if !m.started {
+		return false
+	}
+	for _, s := range m.subsystems {
+		if s.required && s.health.State != StateRunning {
+			return false
+		}
+	}
+	return true
+}
+
+// try starts a subsystem once
+func (m *Manager) try(s *subsystem) error {
+	m.setState(s, StateStarting, nil)
+	stop, err := s.start()
+	if err != nil {
+		m.setState(s, StateFailed, err)
+		return err
+	}
+	m.mtx.Lock()
+	s.stop = stop
+	m.mtx.Unlock()
+	m.setState(s, StateRunning, nil)
+	return nil
+}
+
+// wait sleeps for the backoff of the given retry, and returns false if the
+// manager is stopped in the meantime
+func (m *Manager) wait(retry int) bool {
+	backoff := m.backoff << retry
+	if backoff > maxBackoff || backoff <= 0 {
+		backoff = maxBackoff
+	}
+	select {
+	case <-time.After(backoff):
+		return true
+	case <-m.stopSignal:
+		return false
+	}
+}
+
+// startWithRetries starts a subsystem, retrying up to the configured number
+// of attempts
+func (m *Manager) startWithRetries(s *subsystem) error {
+	var err error
+	for attempt := 0; attempt < m.attempts; attempt++ {
+		if attempt > 0 {
+			m.log.Warnf("Failed to start %s (attempt %d/%d): %v", s.name, attempt, m.attempts, err)
+			if !m.wait(attempt - 1) {
+				return err
+			}
+		}
+		if err = m.try(s); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// retryInBackground keeps starting an optional subsystem until it runs or the
+// manager is stopped
+func (m *Manager) retryInBackground(s *subsystem) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		for retry := m.attempts - 1; ; retry++ {
+			if !m.wait(retry) {
+				return
+			}
+			err := m.try(s)
+			if err == nil {
+				m.log.Infof("Started %s after retrying", s.name)
+				return
+			}
+			m.log.Debugf("Failed to start %s: %v", s.name, err)
+		}
+	}()
+}
+
+// Start starts every subsystem in order. If a required subsystem can't be
+// started, the subsystems started before it are stopped and the error is
+// returned.
+func (m *Manager) Start() error {
+	m.mtx.Lock()
+	subsystems := append([]*subsystem{}, m.subsystems...)
+	m.started = true
+	m.checkReady()
+	m.mtx.Unlock()
+
+	for _, s := range subsystems {
+		err := m.startWithRetries(s)
+		if err == nil {
+			continue
+		}
+		if !s.required {
+			m.log.Warnf("Optional subsystem %s failed to start, retrying in the background: %v", s.name, err)
+			m.retryInBackground(s)
+			continue
+		}
+		return errors.Join(fmt.Errorf("failed to start %s: %w", s.name, err), m.Stop())
+	}
+	return nil
+}
+
+// Stop stops the running subsystems in reverse order and returns their errors
+func (m *Manager) Stop() error {
+	select {
+	case <-m.stopSignal:
+	default:
+		close(m.stopSignal)
+	}
+	m.wg.Wait()
+
+	m.mtx.Lock()
+	subsystems := append([]*subsystem{}, m.subsystems...)
+	m.mtx.Unlock()
+
+	var errs error
+	for i := len(subsystems) - 1; i >= 0; i-- {
+		s := subsystems[i]
+		m.mtx.Lock()
+		stop := s.stop
+		s.stop = nil
+		m.mtx.Unlock()
+		if stop == nil {
+			continue
+		}
+		m.log.Debugf("Stopping %s", s.name)
+		err := stop()
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("failed to stop %s: %w", s.name, err))
+		}
+		m.setState(s, StateStopped, err)
+	}
+	return errs
+}
+
+// Fail marks a running subsystem as failed, e.g. when a background loop
+// exits with an error
+func (m *Manager) Fail(name string, err error) {
+	m.mtx.Lock()
+	var found *subsystem
+	for _, s := range m.subsystems {
+		if s.name == name {
+			found = s
+		}
+	}
+	m.mtx.Unlock()
+	if found != nil {
+		m.log.Errorf("Subsystem %s failed: %v", name, err)
+		m.setState(found, StateFailed, err)
+	}
+}
+
+// Health returns the health of every subsystem, in start order
+func (m *Manager) Health() []Health {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	res := []Health{}
+	for _, s := range m.subsystems {
+		res = append(res, s.health)
+	}
+	return res
+}
+
+// Ready returns true if every required subsystem is running
+func (m *Manager) Ready() bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.allRunning()
+}
+
+// WaitReady blocks until all the required subsystems started once, or until
+// the context expires
+func (m *Manager) WaitReady(ctx context.Context) error {
+	select {
+	case <-m.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
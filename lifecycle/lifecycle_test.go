@@ -0,0 +1,140 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type recorder struct {
+	mtx    sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(event string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) String() string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return strings.Join(r.events, ",")
+}
+
+func (r *recorder) subsystem(name string, failures int) StartFunc {
+	return func() (func() error, error) {
+		if failures > 0 {
+			failures--
+			r.add("fail " + name)
+			return nil, errors.New("transient")
+		}
+		r.add("start " + name)
+		return func() error {
+			r.add("stop " + name)
+			return nil
+		}, nil
+	}
+}
+
+func newTestManager() *Manager {
+	return New(logrus.NewEntry(logrus.New()), 3, time.Millisecond)
+}
+
+func TestStartStopOrder(t *testing.T) {
+	r := &recorder{}
+	m := newTestManager()
+	m.Add("a", r.subsystem("a", 0))
+	m.Add("b", r.subsystem("b", 2))
+	m.Add("c", r.subsystem("c", 0))
+
+	if m.Ready() {
+		t.Errorf("expected the manager not to be ready before starting")
+	}
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Ready() {
+		t.Errorf("expected the manager to be ready")
+	}
+	if err := m.WaitReady(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	health := m.Health()
+	if health[1].State != StateRunning || health[1].Attempts != 3 {
+		t.Errorf("expected b to run after 3 attempts, got %+v", health[1])
+	}
+
+	if err := m.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	expected := "start a,fail b,fail b,start b,start c,stop c,stop b,stop a"
+	if got := r.String(); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+	if m.Health()[0].State != StateStopped {
+		t.Errorf("expected a to be stopped")
+	}
+}
+
+func TestRequiredFailure(t *testing.T) {
+	r := &recorder{}
+	m := newTestManager()
+	m.Add("a", r.subsystem("a", 0))
+	m.Add("b", r.subsystem("b", 5))
+	m.Add("c", r.subsystem("c", 0))
+
+	err := m.Start()
+	if err == nil || !strings.Contains(err.Error(), "failed to start b") {
+		t.Fatalf("expected b to fail, got %v", err)
+	}
+	expected := "start a,fail b,fail b,fail b,stop a"
+	if got := r.String(); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+	if m.Ready() {
+		t.Errorf("expected the manager not to be ready")
+	}
+	if state := m.Health()[2].State; state != StatePending {
+		t.Errorf("expected c to never start, got %s", state)
+	}
+}
+
+func TestOptionalRetriedInBackground(t *testing.T) {
+	r := &recorder{}
+	m := newTestManager()
+	m.Add("a", r.subsystem("a", 0))
+	m.Add("b", r.subsystem("b", 4), Optional())
+
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Ready() {
+		t.Errorf("expected a failing optional subsystem not to block readiness")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Health()[1].State != StateRunning {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected b to eventually start, got %+v", m.Health()[1])
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	m.Fail("b", errors.New("crashed"))
+	if health := m.Health()[1]; health.State != StateFailed || health.Err != "crashed" {
+		t.Errorf("expected b to be failed, got %+v", health)
+	}
+	if err := m.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(r.String(), "stop b,stop a") {
+		t.Errorf("expected failed subsystems to be stopped too, got %s", r.String())
+	}
+}
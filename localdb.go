@@ -0,0 +1,76 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/localtables"
+	p2psrv "github.com/nustiueudinastea/doltswarmdemo/p2p/server"
+	"github.com/nustiueudinastea/doltswarmdemo/sqlstmt"
+)
+
+const localTablesRefresh = 5 * time.Second
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// localTablesDB wraps an ExternalDB and executes the writes to local-only
+// tables without committing them. The tables are ignored in dolt_ignore, so a
+// commit would be empty and their changes are never synced.
+type localTablesDB struct {
+	p2psrv.ExternalDB
+
+	execer  execer
+	matcher *localtables.Matcher
+}
+
+func newLocalTablesDB(db p2psrv.ExternalDB, execer execer, matcher *localtables.Matcher) *localTablesDB {
+	return &localTablesDB{
+		ExternalDB: db,
+		execer:     execer,
+		matcher:    matcher,
+	}
+}
+
+// ExecAndCommit only executes a query without committing it if every table it
+// writes is local-only. Queries writing local-only and replicated tables are
+// refused, since part of the write would be left uncommitted. Queries that
+// can't be parsed go through the commit path.
+func (db *localTablesDB) ExecAndCommit(query string, commitMsg string) (string, error) {
+	_, writes, err := sqlstmt.Access(query)
+	if err != nil || len(writes) == 0 {
+		return db.ExternalDB.ExecAndCommit(query, commitMsg)
+	}
+	local := []string{}
+	for _, table := range writes {
+		if isLocalTable(db.matcher, table) {
+			local = append(local, table)
+		}
+	}
+	switch len(local) {
+	case 0:
+		return db.ExternalDB.ExecAndCommit(query, commitMsg)
+	case len(writes):
+		_, err := db.execer.Exec(query)
+		return "", err
+	default:
+		return "", fmt.Errorf("statement writes local-only tables (%s) and replicated tables together", strings.Join(local, ", "))
+	}
+}
+
+// isLocalTable returns true if the table is local-only. Tables are replicated
+// if dolt_ignore can't be read.
+func isLocalTable(matcher *localtables.Matcher, table string) bool {
+	if table == "" {
+		return false
+	}
+	local, err := matcher.IsLocal(table)
+	if err != nil {
+		log.Errorf("Failed to read dolt_ignore: %s", err.Error())
+		return false
+	}
+	return local
+}
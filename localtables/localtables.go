@@ -0,0 +1,85 @@
+// Package localtables finds the tables that are kept out of replication.
+// They are configured with Dolt's dolt_ignore system table: ignored tables are
+// never staged, so their changes stay in the working set of the local node.
+package localtables
+
+import (
+	"database/sql"
+	"path"
+	"sync"
+	"time"
+)
+
+// Querier is the subset of the database used to read dolt_ignore
+type Querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// Matcher reports if a table is local-only. The patterns are cached for the
+// refresh interval.
+type Matcher struct {
+	db      Querier
+	refresh time.Duration
+
+	mtx      sync.Mutex
+	patterns []string
+	loadedAt time.Time
+}
+
+// New creates a matcher that reloads dolt_ignore after the refresh interval
+func New(db Querier, refresh time.Duration) *Matcher {
+	return &Matcher{db: db, refresh: refresh}
+}
+
+// IsLocal returns true if the table matches an ignored pattern of dolt_ignore
+func (m *Matcher) IsLocal(table string) (bool, error) {
+	patterns, err := m.load()
+	if err != nil {
+		return false, err
+	}
+	return Matches(patterns, table), nil
+}
+
+func (m *Matcher) load() ([]string, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if !m.loadedAt.IsZero() && time.Since(m.loadedAt) < m.refresh {
+		return m.patterns, nil
+	}
+
+	rows, err := m.db.Query("SELECT pattern FROM dolt_ignore WHERE ignored = 1;")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	patterns := []string{}
+	for rows.Next() {
+		var pattern string
+		err = rows.Scan(&pattern)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	m.patterns = patterns
+	m.loadedAt = time.Now()
+	return patterns, nil
+}
+
+// Matches returns true if the table matches one of the patterns. Patterns use
+// the dolt_ignore syntax, where * matches any sequence of characters and ?
+// matches a single character.
+func Matches(patterns []string, table string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, table); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,18 @@
+package localtables
+
+import "testing"
+
+func TestMatches(t *testing.T) {
+	patterns := []string{"cache_*", "session?"}
+	cases := map[string]bool{
+		"cache_users": true,
+		"session1":    true,
+		"sessions_v2": false,
+		"users":       false,
+	}
+	for table, expected := range cases {
+		if Matches(patterns, table) != expected {
+			t.Errorf("expected %s to match: %t", table, expected)
+		}
+	}
+}
@@ -1,17 +1,59 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/dolthub/dolt/go/libraries/utils/concurrentmap"
+	"github.com/google/uuid"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/nustiueudinastea/doltswarm"
+	"github.com/nustiueudinastea/doltswarmdemo/acl"
+	"github.com/nustiueudinastea/doltswarmdemo/admin"
+	"github.com/nustiueudinastea/doltswarmdemo/alerting"
+	"github.com/nustiueudinastea/doltswarmdemo/approvals"
+	"github.com/nustiueudinastea/doltswarmdemo/author"
+	"github.com/nustiueudinastea/doltswarmdemo/batch"
+	"github.com/nustiueudinastea/doltswarmdemo/bench"
+	"github.com/nustiueudinastea/doltswarmdemo/blobstore"
+	"github.com/nustiueudinastea/doltswarmdemo/branchpolicy"
+	"github.com/nustiueudinastea/doltswarmdemo/bridge"
+	"github.com/nustiueudinastea/doltswarmdemo/cdc"
+	"github.com/nustiueudinastea/doltswarmdemo/channels"
+	"github.com/nustiueudinastea/doltswarmdemo/conflicts"
+	"github.com/nustiueudinastea/doltswarmdemo/crash"
+	"github.com/nustiueudinastea/doltswarmdemo/exporter"
+	"github.com/nustiueudinastea/doltswarmdemo/feed"
+	"github.com/nustiueudinastea/doltswarmdemo/gateway"
+	"github.com/nustiueudinastea/doltswarmdemo/importer"
+	"github.com/nustiueudinastea/doltswarmdemo/localtables"
+	"github.com/nustiueudinastea/doltswarmdemo/matview"
+	"github.com/nustiueudinastea/doltswarmdemo/membership"
+	"github.com/nustiueudinastea/doltswarmdemo/namedqueries"
 	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+	"github.com/nustiueudinastea/doltswarmdemo/p2p/compression"
+	"github.com/nustiueudinastea/doltswarmdemo/p2p/middleware"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	p2psrv "github.com/nustiueudinastea/doltswarmdemo/p2p/server"
+	"github.com/nustiueudinastea/doltswarmdemo/plugins"
+	"github.com/nustiueudinastea/doltswarmdemo/quarantine"
+	"github.com/nustiueudinastea/doltswarmdemo/rollout"
+	"github.com/nustiueudinastea/doltswarmdemo/scheduler"
+	"github.com/nustiueudinastea/doltswarmdemo/sessions"
+	"github.com/nustiueudinastea/doltswarmdemo/simulate"
+	"github.com/nustiueudinastea/doltswarmdemo/sqlserver"
+	"github.com/nustiueudinastea/doltswarmdemo/storage"
+	"github.com/nustiueudinastea/doltswarmdemo/tablecrypt"
+	"github.com/nustiueudinastea/doltswarmdemo/tombstone"
+	"github.com/nustiueudinastea/doltswarmdemo/trailer"
+	"github.com/nustiueudinastea/doltswarmdemo/tsdb"
+	"github.com/nustiueudinastea/doltswarmdemo/validation"
 	"github.com/segmentio/ksuid"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
@@ -24,10 +66,31 @@ var workDir string
 var commitListChan = make(chan []doltswarm.Commit, 100)
 var peerListChan = make(chan peer.IDSlice, 1000)
 var p2pmgr *p2p.P2P
+var p2pKey *p2p.P2PKey
+var commitFeed *feed.Feed
+var aclEnforcer *acl.Enforcer
+var rpcWatchdog *middleware.Watchdog
+var crashReporter *crash.Reporter
+var branchPolicies branchpolicy.Policies
+var bridgeConfig *bridge.Config
+var matviewConfig *matview.Config
+var jobsConfig *scheduler.Config
+var conflictResolver *conflicts.Resolver
+var storageBackend storage.Backend
+var channelMgr *channels.Manager
+var metricsStore *tsdb.Store
+var sessionServer *sessions.Server
+var tombstones *tombstone.Policy
+var tableCrypt *tablecrypt.Policy
+var metricsChan = make(chan string, 100)
 var uiLog = &EventWriter{eventChan: make(chan []byte, 5000)}
 var dbName = "doltswarmdemo"
 var tableName = "testtable"
 
+const watchdogInterval = 10 * time.Second
+const membersRefresh = 5 * time.Second
+const namedQueriesRefresh = 5 * time.Second
+
 func catchSignals(sigs chan os.Signal, wg *sync.WaitGroup) {
 	sig := <-sigs
 	log.Infof("Received OS signal %s. Terminating", sig.String())
@@ -53,9 +116,16 @@ func (ew *EventWriter) Write(p []byte) (n int, err error) {
 	return len(logLine), nil
 }
 
-func p2pRun(noGUI bool, noCommits bool, commitInterval int) error {
+type cdcConfig struct {
+	sink        string
+	addr        string
+	tables      []string
+	topicPrefix string
+}
+
+func p2pRun(noGUI bool, noCommits bool, commitInterval int, consistency p2pproto.Consistency, batcher *batch.Writer, cdcCfg cdcConfig, sqlCfg sqlserver.Config, gatewayCfg gateway.Config, initPeer string) error {
 
-	if !dbi.Initialized() {
+	if !dbi.Initialized() && initPeer == "" {
 		return fmt.Errorf("db not initialized")
 	}
 
@@ -72,11 +142,128 @@ func p2pRun(noGUI bool, noCommits bool, commitInterval int) error {
 	}
 	stoppers.Set("p2p", p2pStopper)
 
-	updaterSopper := startCommitUpdater(noCommits, commitInterval)
+	if !dbi.Initialized() {
+		err = dbi.InitFromPeer(initPeer)
+		if err != nil {
+			return fmt.Errorf("error initialising from peer: %w", err)
+		}
+		if startupReport != nil && startupReport.Quarantined != "" {
+			startupReport.RefetchedFrom = initPeer
+			log.Infof("Fetched the damaged database again from %s", initPeer)
+		}
+	}
+
+	updaterSopper := startCommitUpdater(noCommits, commitInterval, consistency, batcher)
 	stoppers.Set("updater", updaterSopper)
 
+	stoppers.Set("feed", commitFeed.Start())
+	stoppers.Set("tracing", startCommitTracing())
+	stoppers.Set("readcache", startReadCacheInvalidator())
+	stoppers.Set("metrics", startMetricsCollector(metricsStore))
+	stoppers.Set("debug", startDebugHandler())
+	stoppers.Set("sync", startSyncProgress())
+	stoppers.Set("synclag", startSyncLagAlerts())
+	stoppers.Set("drift", startDriftAlerts())
+	if pluginRuntime != nil {
+		stoppers.Set("plugins", startPluginDistribution())
+	}
+	stoppers.Set("protodump", protoDumper.Close)
+	if alertDispatcher != nil {
+		stoppers.Set("alerts", startAlerts(alertDispatcher, alertConfig))
+	}
+	stoppers.Set("topology", startTopologyTracker())
+	stoppers.Set("conflicts", startConflictTracker(conflictResolver))
+	stoppers.Set("imports", startImportTracker(consistency))
+	stoppers.Set("exports", startExportTracker())
+	stoppers.Set("sessions", sessionServer.Start())
+	if tombstones != nil {
+		stoppers.Set("tombstones", startTombstoneCleanup(tombstones, consistency))
+	}
+	blobRefs.setConsistency(consistency)
+	if blobCacheBytes > 0 {
+		stoppers.Set("blobs", startBlobEviction(blobCacheBytes))
+	} else {
+		stoppers.Set("blobs", startBlobReplication())
+	}
+	stoppers.Set("watchdog", rpcWatchdog.Start(watchdogInterval))
+	if len(branchPolicies) > 0 {
+		stoppers.Set("branches", startBranchWatcher(branchPolicies))
+	}
+	if bridgeConfig != nil {
+		err = startBridges(bridgeConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	if matviewConfig != nil {
+		matviewStopper, err := startMaterializedViews(matviewConfig)
+		if err != nil {
+			return err
+		}
+		stoppers.Set("matviews", matviewStopper)
+	}
+
+	if jobsConfig != nil {
+		jobsStopper, err := startJobs(jobsConfig)
+		if err != nil {
+			return err
+		}
+		stoppers.Set("jobs", jobsStopper)
+	}
+
+	if cdcCfg.sink != "" {
+		sink, err := cdc.NewSink(cdcCfg.sink, cdcCfg.addr)
+		if err != nil {
+			return err
+		}
+		exporter, err := cdc.NewExporter(dbi, commitFeed, sink, log, cdcCfg.tables, cdcCfg.topicPrefix, workDir+"/cdc-checkpoint.json")
+		if err != nil {
+			return err
+		}
+		stoppers.Set("cdc", exporter.Start())
+	}
+
+	// a standby only starts its external listeners once it takes over from
+	// its primary
+	startListeners := func() error {
+		if sqlCfg.Addr != "" {
+			commit := func(query string, commitMsg string) (string, error) {
+				return p2pmgr.ExecAndCommit(query, commitMsg, consistency)
+			}
+			sqlStopper, err := sqlserver.Start(sqlCfg, dbi, commit, log)
+			if err != nil {
+				return err
+			}
+			stoppers.Set("sqlserver", sqlStopper)
+		}
+
+		if gatewayCfg.Addr != "" {
+			gatewayStopper, err := startGateway(gatewayCfg)
+			if err != nil {
+				return err
+			}
+			stoppers.Set("gateway", gatewayStopper)
+		}
+		return nil
+	}
+	if _, ok := p2pmgr.Standby(); ok {
+		stoppers.Set("standby", startStandbyTracker())
+		p2pmgr.OnPromote(func() {
+			err := startListeners()
+			if err != nil {
+				log.Errorf("Failed to start external listeners after promotion: %s", err.Error())
+			}
+		})
+	} else {
+		err = startListeners()
+		if err != nil {
+			return err
+		}
+	}
+
 	if !noGUI {
-		gui := createUI(peerListChan, commitListChan, uiLog.eventChan)
+		gui := createUI(peerListChan, commitListChan, uiLog.eventChan, metricsChan)
 		// the following blocks so we can close everything else once this returns
 		err = gui.Run()
 		if err != nil {
@@ -89,12 +276,14 @@ func p2pRun(noGUI bool, noCommits bool, commitInterval int) error {
 	return nil
 }
 
-func startCommitUpdater(noCommits bool, commitInterval int) func() error {
+// startCommitUpdater periodically inserts a row. If a batch writer is provided
+// the inserts are accumulated and committed together.
+func startCommitUpdater(noCommits bool, commitInterval int, consistency p2pproto.Consistency, batcher *batch.Writer) func() error {
 	log.Info("Starting commit updater")
 	updateTimer := time.NewTicker(1 * time.Second)
 	commitTimmer := time.NewTicker(time.Duration(commitInterval) * time.Second)
 	stopSignal := make(chan struct{})
-	go func() {
+	crashReporter.Go("commit-updater", func() {
 		for {
 			select {
 			case <-updateTimer.C:
@@ -115,7 +304,14 @@ func startCommitUpdater(noCommits bool, commitInterval int) func() error {
 					continue
 				}
 				queryString := fmt.Sprintf("INSERT INTO %s (id, name) VALUES ('%s', '%s');", tableName, uid.String(), p2pmgr.GetID()+" - "+timer.String())
-				commitHash, err := dbi.ExecAndCommit(queryString, "Periodic commit at "+timer.String())
+				if batcher != nil {
+					err = batcher.Add(queryString)
+					if err != nil {
+						log.Errorf("Failed to commit batch: %s", err.Error())
+					}
+					continue
+				}
+				commitHash, err := p2pmgr.ExecAndCommit(queryString, "Periodic commit at "+timer.String(), consistency)
 				if err != nil {
 					log.Errorf("Failed to insert time: %s", err.Error())
 					continue
@@ -123,10 +319,16 @@ func startCommitUpdater(noCommits bool, commitInterval int) func() error {
 				log.Infof("Inserted time '%s' into db with commit '%s'", timer.String(), commitHash)
 			case <-stopSignal:
 				log.Info("Stopping commit updater")
+				if batcher != nil {
+					err := batcher.Close()
+					if err != nil {
+						log.Errorf("Failed to commit batch: %s", err.Error())
+					}
+				}
 				return
 			}
 		}
-	}()
+	})
 	stopper := func() error {
 		stopSignal <- struct{}{}
 		return nil
@@ -154,7 +356,7 @@ func Init(localInit bool, peerInit string, port int) error {
 		_, err = dbi.ExecAndCommit(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s(
 			id varchar(256) PRIMARY KEY,
 			name varchar(512)
-		  );`, tableName), "Initialize doltswarmdemo")
+		  );`, tableName), trailer.Append("Initialize doltswarmdemo", databaseIDKey, uuid.NewString()))
 		if err != nil {
 			return fmt.Errorf("failed to create table: %w", err)
 		}
@@ -193,6 +395,98 @@ func main() {
 	var noGUI bool
 	var noCommits bool
 	var commitInterval int
+	var leaderMode bool
+	var leaseMode string
+	var consistency string
+	var vectorClocks bool
+	var hybridClocks bool
+	var diskGuardCfg p2p.DiskGuardConfig
+	var minFreeDiskMB uint64
+	var governorCfg p2p.GovernorConfig
+	var maxHeapMB uint64
+	var tuning string
+	var connLowWater int
+	var connHighWater int
+	var handlerQueueSize int
+	var clockSkewThreshold time.Duration
+	var addrBookTTL time.Duration
+	var cdcCfg cdcConfig
+	var cdcTables cli.StringSlice
+	var storageKind string
+	var storagePath string
+	var serverInitPeer string
+	var initSnapshot string
+	var initSnapshotSHA256 string
+	var maxMsgSize int
+	var metricsRetention time.Duration
+	var batchSize int
+	var batchDelay time.Duration
+	var discoveryKinds cli.StringSlice
+	var staticPeers cli.StringSlice
+	var k8sCfg p2p.KubernetesConfig
+	var listenIP string
+	var validationRules string
+	var pluginsEnabled bool
+	var mergeableColumnsFile string
+	var tableOwners string
+	var sqlCfg sqlserver.Config
+	var gatewayCfg gateway.Config
+	var authorName string
+	var authorEmail string
+	var peerExpiry time.Duration
+	var aclPolicy string
+	var caCert string
+	var branchPolicyFile string
+	var bridgeConfigFile string
+	var matviewsConfigFile string
+	var jobsConfigFile string
+	var sessionsCfg sessions.Config
+	var tombstoneTables cli.StringSlice
+	var tombstoneCfg tombstone.Config
+	var encryptedColumns cli.StringSlice
+	var tableKeys cli.StringSlice
+	var alertsConfigFile string
+	var certDir string
+	var adminPeers cli.StringSlice
+	var rpcRateLimit float64
+	var rpcBurst int
+	var rpcSlots int
+	var readCacheTTL time.Duration
+	var nodeRole string
+	var historyDepth int64
+	var blobCacheMB int64
+	var remoteReadBudget time.Duration
+	var remoteReadCacheTTL time.Duration
+	var zone p2p.Zone
+	var crossZoneDelay time.Duration
+	var rpcDeadline time.Duration
+	var streamIdleTimeout time.Duration
+	var resetStuckRPCs bool
+	var rpcCallTimeout time.Duration
+	var keepaliveInterval time.Duration
+	var keepaliveTimeout time.Duration
+	var offlineFirst bool
+	var panicPolicy string
+	var standbyCfg p2p.StandbyConfig
+	var syncLagThreshold int
+	var driftCheckInterval time.Duration
+	var compressors cli.StringSlice
+	var compressionThreshold int
+	var commitRate float64
+	var commitBurst int
+	var backpressureLag int64
+	var backpressureMaxDelay time.Duration
+	var crashDir string
+	var secretsIdentity string
+	var startRetries int
+	var startBackoff time.Duration
+	var announcementRetention time.Duration
+	var startupCheck string
+	var startupRepair bool
+	var protoDump bool
+	var protoDumpCfg middleware.DumpConfig
+	var protoDumpRedact cli.StringSlice
+	var protoDumpMethods cli.StringSlice
 
 	funcBefore := func(ctx *cli.Context) error {
 		var err error
@@ -203,6 +497,12 @@ func main() {
 		}
 
 		log.SetLevel(level)
+		log.AddHook(recentLogs)
+
+		err = applyProfile(ctx, tuning)
+		if err != nil {
+			return err
+		}
 
 		if ctx.Command.Name != "init" && !noGUI {
 			log.SetOutput(uiLog)
@@ -213,21 +513,435 @@ func main() {
 			return fmt.Errorf("failed to create working directory: %v", err)
 		}
 
-		p2pKey, err := p2p.NewKey(workDir)
+		policy, err := crash.ParsePolicy(panicPolicy)
+		if err != nil {
+			return err
+		}
+		if crashDir == "" {
+			crashDir = workDir + "/crashes"
+		}
+		crashReporter, err = crash.NewReporter(crashDir, policy, log)
+		if err != nil {
+			return err
+		}
+
+		// sensitive values can be references to secrets, which are resolved
+		// before anything uses them
+		resolver, err := newSecretsResolver(secretsIdentity)
+		if err != nil {
+			return err
+		}
+		err = resolver.ResolveAll(&storageKey, &sqlCfg.Password, &gatewayCfg.Token, &cdcCfg.addr)
+		if err != nil {
+			return err
+		}
+		if len(encryptedColumns.Value()) > 0 {
+			keys, err := parseTableKeys(tableKeys.Value(), resolver)
+			if err != nil {
+				return err
+			}
+			tableCrypt, err = tablecrypt.New(tablecrypt.Config{Columns: encryptedColumns.Value(), Keys: keys})
+			if err != nil {
+				return err
+			}
+			sqlCfg.Decrypt = tableCrypt.Decrypt
+		}
+
+		p2pKey, err = p2p.NewKey(workDir)
 		if err != nil {
 			return fmt.Errorf("failed to create key: %v", err)
 		}
 
-		dbi, err = doltswarm.Open(workDir, dbName, log.WithField("context", "db"), p2pKey)
+		if (storageKind == "disk" || storageKind == "encrypted") && storagePath == "" {
+			storagePath = workDir
+		}
+		storageBackend, err = storage.Open(storageKind, storagePath)
+		if err != nil {
+			return fmt.Errorf("failed to open storage: %v", err)
+		}
+
+		if initSnapshot != "" && ctx.Command.Name == "server" {
+			err = bootstrapFromSnapshot(storageBackend.Dir(), initSnapshot, initSnapshotSHA256)
+			if err != nil {
+				return err
+			}
+		}
+
+		// the server checks the database before it accepts traffic
+		checkStartup, deepCheck, err := parseStartupCheck(startupCheck)
+		if err != nil {
+			return err
+		}
+		checkStartup = checkStartup && ctx.Command.Name == "server"
+		if checkStartup {
+			err = checkStorageFiles(storageBackend.Dir(), startupRepair)
+			if err != nil {
+				return err
+			}
+		}
+
+		dbi, err = doltswarm.Open(storageBackend.Dir(), dbName, log.WithField("context", "db"), p2pKey)
 		if err != nil {
 			return fmt.Errorf("failed to create db: %v", err)
 		}
+		if checkStartup {
+			reopen, err := checkDatabase(storageBackend.Dir(), deepCheck, startupRepair)
+			if err != nil {
+				return err
+			}
+			if reopen {
+				dbi, err = doltswarm.Open(storageBackend.Dir(), dbName, log.WithField("context", "db"), p2pKey)
+				if err != nil {
+					return fmt.Errorf("failed to create db: %v", err)
+				}
+			}
+		}
+
+		addrBook, err := p2p.NewAddressBook(workDir+"/addrbook.json", addrBookTTL)
+		if err != nil {
+			return fmt.Errorf("failed to load address book: %v", err)
+		}
+		if startupReport != nil && startupReport.Quarantined != "" && serverInitPeer == "" {
+			serverInitPeer, err = repairPeer(addrBook)
+			if err != nil {
+				return err
+			}
+		}
+		bans, err := p2p.NewBanList(workDir + "/" + banListFile)
+		if err != nil {
+			return err
+		}
+
+		k8sCfg.Port = port
+		discoveries, err := parseDiscovery(discoveryKinds.Value(), staticPeers.Value(), k8sCfg)
+		if err != nil {
+			return err
+		}
+
+		p2pOpts := []p2p.Option{p2p.WithAddressBook(addrBook), p2p.WithBanList(bans), p2p.WithPriorityLanes(rpcSlots), p2p.WithMaxMessageSize(maxMsgSize), p2p.WithDiscovery(discoveries...), p2p.WithListenIP(listenIP), p2p.WithPeerExpiry(peerExpiry), p2p.WithKeepalive(keepaliveInterval, keepaliveTimeout), p2p.WithClockSkewThreshold(clockSkewThreshold), p2p.WithSyncLagThreshold(syncLagThreshold), p2p.WithDriftCheck(driftCheckInterval), p2p.WithStartRetries(startRetries, startBackoff), p2p.WithCommitRateLimit(commitRate, commitBurst), p2p.WithBackpressure(backpressureLag, backpressureMaxDelay), p2p.WithCallTimeout(rpcCallTimeout), p2p.WithConnLimits(connLowWater, connHighWater), p2p.WithHandlerQueue(handlerQueueSize)}
+		if diskGuardCfg.MinFreePercent > 0 || minFreeDiskMB > 0 {
+			diskGuardCfg.Dir = storageBackend.Dir()
+			diskGuardCfg.MinFreeBytes = minFreeDiskMB << 20
+			diskGuardCfg.OnChange = alertDiskGuard
+			diskGuard, err = p2p.NewDiskGuard(diskGuardCfg)
+			if err != nil {
+				return err
+			}
+			p2pOpts = append(p2pOpts, p2p.WithDiskGuard(diskGuard))
+		}
+		governorCfg.MaxHeapBytes = maxHeapMB << 20
+		if governorCfg.Enabled() {
+			governorCfg.OnChange = alertGovernor
+			governor, err := p2p.NewGovernor(governorCfg)
+			if err != nil {
+				return err
+			}
+			p2pOpts = append(p2pOpts, p2p.WithGovernor(governor))
+		}
+		p2pOpts = append(p2pOpts,
+			p2p.WithServerInterceptors(middleware.Recovery(crashReporter.HandlePanic)),
+			p2p.WithServerInterceptors(middleware.Logging(log)),
+		)
+		rpcWatchdog = middleware.NewWatchdog(log, rpcDeadline, streamIdleTimeout, resetStuckRPCs)
+		p2pOpts = append(p2pOpts, p2p.WithServerInterceptors(rpcWatchdog.Interceptors()))
+		protoDumpCfg.Burst = int(protoDumpCfg.Rate) + 1
+		protoDumpCfg.Redact = protoDumpRedact.Value()
+		protoDumpCfg.Methods = protoDumpMethods.Value()
+		protoDumpCfg.Ignore = []string{p2pproto.Admin_GetProtoDump_FullMethodName}
+		protoDumper = middleware.NewDumper(protoDumpCfg)
+		if protoDump {
+			err = protoDumper.SetEnabled(true)
+			if err != nil {
+				return err
+			}
+		}
+		p2pOpts = append(p2pOpts, p2p.WithServerInterceptors(protoDumper.Interceptors()), p2p.WithClientInterceptors(protoDumper.ClientInterceptors()))
+		if announcementRetention > 0 {
+			announced, err := p2p.NewAnnouncementLog(workDir+"/"+announcementsFile, announcementRetention)
+			if err != nil {
+				return err
+			}
+			p2pOpts = append(p2pOpts, p2p.WithAnnouncementLog(announced))
+		}
+		switch p2p.NodeRole(nodeRole) {
+		case p2p.RoleArchive:
+		case p2p.RoleLight:
+			if historyDepth <= 0 {
+				return fmt.Errorf("light nodes require a positive --history-depth")
+			}
+			// Dolt can't truncate the commit graph without rewriting every
+			// hash, so the depth is only advertised for now
+			log.Warnf("Light node: advertising a history depth of %d commits, but the full history is kept", historyDepth)
+			if blobCacheMB <= 0 {
+				return fmt.Errorf("light nodes require a positive --blob-cache-mb")
+			}
+			blobCacheBytes = blobCacheMB << 20
+			if remoteReadBudget > 0 {
+				p2pOpts = append(p2pOpts, p2p.WithRemoteReads(remoteReadBudget, remoteReadCacheTTL))
+			}
+		default:
+			return fmt.Errorf("unknown node role '%s'", nodeRole)
+		}
+		p2pOpts = append(p2pOpts, p2p.WithNodeRole(p2p.NodeRole(nodeRole), historyDepth))
+		p2pOpts = append(p2pOpts, p2p.WithZone(zone, crossZoneDelay))
+		p2pOpts = append(p2pOpts, p2p.WithDatabaseIdentity(databaseIdentity))
+
+		if offlineFirst {
+			p2pOpts = append(p2pOpts, p2p.WithOfflineMode())
+		}
+		if len(compressors.Value()) > 0 {
+			names, err := compression.Parse(compressors.Value())
+			if err != nil {
+				return err
+			}
+			p2pOpts = append(p2pOpts, p2p.WithCompression(names, compressionThreshold))
+		}
+		if standbyCfg.Primary != "" {
+			if _, err := peer.Decode(standbyCfg.Primary); err != nil {
+				return fmt.Errorf("invalid primary peer ID '%s': %w", standbyCfg.Primary, err)
+			}
+			p2pOpts = append(p2pOpts, p2p.WithStandby(standbyCfg))
+		}
+		if readCacheTTL > 0 {
+			p2pOpts = append(p2pOpts, p2p.WithReadCache(readCacheTTL))
+		}
+		if rpcRateLimit > 0 {
+			p2pOpts = append(p2pOpts, p2p.WithServerInterceptors(middleware.NewRateLimiter(rpcRateLimit, rpcBurst).Interceptors()))
+		}
+		if leaderMode {
+			p2pOpts = append(p2pOpts, p2p.WithLeaderElection())
+		}
+		parsedLeaseMode, err := p2p.ParseLeaseMode(leaseMode)
+		if err != nil {
+			return err
+		}
+		if parsedLeaseMode == p2p.LeaseModeLeader && !leaderMode {
+			return fmt.Errorf("leader leases require --leader")
+		}
+		p2pOpts = append(p2pOpts, p2p.WithLeaseMode(parsedLeaseMode))
+		if tableOwners != "" {
+			owners, err := p2p.LoadTableOwners(tableOwners)
+			if err != nil {
+				return err
+			}
+			p2pOpts = append(p2pOpts, p2p.WithTableOwners(owners))
+		}
+
+		if branchPolicyFile != "" {
+			branchPolicies, err = branchpolicy.Load(branchPolicyFile)
+			if err != nil {
+				return err
+			}
+		}
+
+		if bridgeConfigFile != "" {
+			bridgeConfig, err = bridge.LoadConfig(bridgeConfigFile)
+			if err != nil {
+				return err
+			}
+		}
+
+		if matviewsConfigFile != "" {
+			matviewConfig, err = matview.LoadConfig(matviewsConfigFile)
+			if err != nil {
+				return err
+			}
+		}
+
+		if jobsConfigFile != "" {
+			jobsConfig, err = scheduler.LoadConfig(jobsConfigFile)
+			if err != nil {
+				return err
+			}
+		}
+
+		if alertsConfigFile != "" {
+			alertConfig, err = loadAlertConfig(alertsConfigFile, resolver)
+			if err != nil {
+				return err
+			}
+			alertDispatcher, err = alerting.New(alertConfig, p2pKey.GetID(), log.WithField("context", "alerting"))
+			if err != nil {
+				return err
+			}
+		}
+
+		if certDir != "" && (aclPolicy == "" || caCert == "") {
+			return fmt.Errorf("certificate roles require an ACL policy and a CA certificate")
+		}
+		if aclPolicy != "" {
+			policy, err := acl.LoadPolicy(aclPolicy)
+			if err != nil {
+				return err
+			}
+			if certDir != "" {
+				peerRoles, err := acl.LoadCertificateRoles(caCert, certDir)
+				if err != nil {
+					return err
+				}
+				policy.AddRoles(peerRoles)
+			}
+			auditor, err := acl.NewAuditor(workDir + "/audit.log")
+			if err != nil {
+				return err
+			}
+			aclEnforcer = &acl.Enforcer{Policy: policy, Auditor: auditor}
+			p2pOpts = append(p2pOpts, p2p.WithAuthorizer(aclEnforcer))
+			p2pKey.AddCommitCheck(checkCommitACL(aclEnforcer))
+		}
+		admins, err := newAdminPolicy(adminPeers.Value(), aclEnforcer)
+		if err != nil {
+			return err
+		}
+		log.Infof("Admin service is open to the admin identity %s", admins.local)
+		p2pOpts = append(p2pOpts, p2p.WithAdmins(admins.allow))
+
+		quarantineStore, err = quarantine.NewStore(workDir+"/quarantine.json", alertQuarantined)
+		if err != nil {
+			return err
+		}
+		p2pOpts = append(p2pOpts, p2p.WithQuarantine(&quarantiner{store: quarantineStore}))
+		approvalStore, err = approvals.NewStore(workDir + "/approvals.json")
+		if err != nil {
+			return err
+		}
+		if len(branchPolicies.ApprovalTargets()) > 0 {
+			p2pKey.AddCommitCheck(checkApprovalsBeforeApply(branchPolicies))
+		}
+
+		localTables := localtables.New(dbi, localTablesRefresh)
+		p2pOpts = append(p2pOpts, p2p.WithLocalTables(func(table string) bool {
+			return isLocalTable(localTables, table)
+		}))
+
+		var externalDB p2psrv.ExternalDB = newLocalTablesDB(historyDB{dbi}, dbi, localTables)
+		if len(tombstoneTables.Value()) > 0 {
+			tombstoneCfg.Tables = tombstoneTables.Value()
+			tombstones = tombstone.New(tombstoneCfg)
+			externalDB = newTombstoneDB(externalDB, tombstones)
+		}
+		if tableCrypt != nil {
+			externalDB = newEncryptedDB(externalDB, tableCrypt)
+		}
+		if diskGuard != nil {
+			externalDB = newDiskGuardDB(externalDB, diskGuard)
+		}
+		if vectorClocks {
+			externalDB = newVClockDB(externalDB, p2pKey.GetID())
+		}
+		conflictOrder := conflicts.WallClock
+		if hybridClocks {
+			externalDB = newHLCDB(externalDB)
+			conflictOrder = conflicts.HybridClock
+		}
+		// approved writes were already reviewed, so they skip validation
+		approvedDB := externalDB
+		if validationRules != "" {
+			rules, err := validation.LoadRules(validationRules)
+			if err != nil {
+				return err
+			}
+			externalDB = newValidationDB(externalDB, dbi, rules)
+		}
+		var deployer admin.PluginDeployer
+		if pluginsEnabled {
+			err = openPluginRuntime(admins.allow)
+			if err != nil {
+				return err
+			}
+			externalDB = newPluginDB(externalDB, pluginRuntime)
+			p2pKey.AddCommitCheck(checkPluginCommit)
+			key, err := adminKey()
+			if err != nil {
+				return err
+			}
+			deployer = pluginDeployer{runtime: pluginRuntime, key: key.PrivateKey()}
+		}
+		defaultAuthor := author.Author{Name: authorName, Email: authorEmail}
+		if !defaultAuthor.IsZero() {
+			defaultAuthor, err = author.Parse(defaultAuthor.String())
+			if err != nil {
+				return err
+			}
+		}
+		externalDB = newAuthorDB(externalDB, defaultAuthor, p2pKey.GetID())
+		approvedDB = newAuthorDB(approvedDB, defaultAuthor, p2pKey.GetID())
+		// the tables the node manages are written with approvedDB
+		externalDB = newProtectedDB(externalDB, managedTables...)
+		blobRefs.setExec(approvedDB.ExecAndCommit)
+
+		// membership operations come from operators, so they skip validation
+		members := membership.New(dbi, approvedDB.ExecAndCommit, membersRefresh)
+		p2pOpts = append(p2pOpts, p2p.WithMembership(members))
+		// named queries are defined by operators too
+		namedQueries := namedqueries.New(dbi, approvedDB.ExecAndCommit, namedQueriesRefresh)
+		p2pOpts = append(p2pOpts, p2p.WithNamedQueries(namedQueries))
+		p2pOpts = append(p2pOpts, p2p.WithProcedures(dbi.DB))
+
+		var mergeableColumns conflicts.Columns
+		if mergeableColumnsFile != "" {
+			mergeableColumns, err = conflicts.LoadColumns(mergeableColumnsFile)
+			if err != nil {
+				return err
+			}
+		}
+		conflictResolver = conflicts.NewResolver(dbi, approvedDB.ExecAndCommit, conflictOrder, mergeableColumns)
 
-		p2pmgr, err = p2p.NewManager(p2pKey, port, peerListChan, log, dbi)
+		p2pmgr, err = p2p.NewManager(p2pKey, port, peerListChan, log, externalDB, p2pOpts...)
 		if err != nil {
 			return fmt.Errorf("failed to create p2p manager: %v", err)
 		}
 
+		commitFeed = feed.New(dbi, log)
+		err = p2pmgr.RegisterService(&p2pproto.Commits_ServiceDesc, &feed.Server{Feed: commitFeed})
+		if err != nil {
+			return err
+		}
+
+		channelMgr, err = channels.NewManager(p2pmgr, p2pKey.PrivateKey(), log)
+		if err != nil {
+			return fmt.Errorf("failed to create channel manager: %v", err)
+		}
+		err = p2pmgr.RegisterService(&p2pproto.Channels_ServiceDesc, channelMgr)
+		if err != nil {
+			return err
+		}
+
+		metricsStore = tsdb.New(metricsInterval, metricsRetention)
+		err = p2pmgr.RegisterService(&p2pproto.Admin_ServiceDesc, &admin.Server{Metrics: metricsStore, Sync: p2pmgr, Quarantine: quarantineStore, Resolver: &quarantineResolver{db: approvedDB, beginner: dbi}, Topology: p2pmgr, Members: members, Conflicts: conflictResolver, Standby: p2pmgr, Health: p2pmgr, Drain: p2pmgr, Restarter: processRestarter{}, Tracer: p2pmgr, Plugins: deployer, ProtoDump: protoDumper, Approver: &commitApprover{key: p2pKey.PrivateKey(), policies: branchPolicies}, NamedQueries: namedQueries})
+		if err != nil {
+			return err
+		}
+
+		err = p2pmgr.RegisterService(&p2pproto.Approvals_ServiceDesc, &approvals.Server{Store: approvalStore, Policies: branchPolicies, Approved: mergeIfApproved})
+		if err != nil {
+			return err
+		}
+
+		commitSession := func(query string, commitMsg string, consistency p2pproto.Consistency) (string, error) {
+			return p2pmgr.ExecAndCommit(query, commitMsg, consistency)
+		}
+		sessionServer = sessions.New(sessionsCfg, dbi, commitSession, p2pmgr.AuthorizeTables, log)
+		err = p2pmgr.RegisterService(&p2pproto.Sessions_ServiceDesc, sessionServer)
+		if err != nil {
+			return err
+		}
+
+		blobStore, err = openBlobStore()
+		if err != nil {
+			return err
+		}
+		err = p2pmgr.RegisterService(&p2pproto.Blobs_ServiceDesc, &blobstore.Server{Store: blobStore, Refs: blobRefs, Fetcher: blobFetcher{}, Authorize: p2pmgr.Authorize})
+		if err != nil {
+			return err
+		}
+		if pluginRuntime != nil {
+			err = p2pmgr.RegisterService(&p2pproto.Plugins_ServiceDesc, &plugins.Server{Runtime: pluginRuntime, Relay: relayPlugin, Log: log})
+			if err != nil {
+				return err
+			}
+		}
+
 		// grpc server needs to be added before opening the DB
 		dbi.AddGRPCServer(p2pmgr.GetGRPCServer())
 		dbi.EnableGRPCServers()
@@ -237,10 +951,14 @@ func main() {
 
 	funcAfter := func(ctx *cli.Context) error {
 		log.Info("Shutdown completed")
+		var err error
 		if dbi != nil {
-			return dbi.Close()
+			err = dbi.Close()
 		}
-		return nil
+		if storageBackend != nil {
+			err = errors.Join(err, storageBackend.Close())
+		}
+		return err
 	}
 
 	app := &cli.App{
@@ -252,12 +970,30 @@ func main() {
 				Usage:       "logging level",
 				Destination: &logLevel,
 			},
+			&cli.StringFlag{
+				Name:        "profile",
+				Value:       "default",
+				Usage:       "preset of the queue, cache, concurrency and connection limits (default, small). Flags set explicitly override the preset",
+				EnvVars:     []string{"DOLTSWARM_PROFILE"},
+				Destination: &tuning,
+			},
 			&cli.StringFlag{
 				Name:        "db",
 				Value:       "db",
 				Usage:       "db directory",
 				Destination: &workDir,
 			},
+			&cli.StringFlag{
+				Name:        "panic-policy",
+				Value:       string(crash.PolicyLog),
+				Usage:       "what to do when a subsystem panics (log, restart, crash)",
+				Destination: &panicPolicy,
+			},
+			&cli.StringFlag{
+				Name:        "crash-dir",
+				Usage:       "directory for crash reports (default <db>/crashes)",
+				Destination: &crashDir,
+			},
 			&cli.IntFlag{
 				Name:        "port",
 				Value:       10500,
@@ -282,30 +1018,689 @@ func main() {
 				Usage:       "interval between commits in seconds",
 				Destination: &commitInterval,
 			},
-		},
-		Commands: []*cli.Command{
-			{
-				Name:   "server",
-				Usage:  "starts p2p server",
-				Before: funcBefore,
-				After:  funcAfter,
-				Action: func(ctx *cli.Context) error {
-					return p2pRun(noGUI, noCommits, commitInterval)
-				},
+			&cli.BoolFlag{
+				Name:        "leader",
+				Value:       false,
+				Usage:       "elect a leader and forward all writes to it",
+				Destination: &leaderMode,
 			},
-			{
-				Name:  "init",
-				Usage: "initialises db",
-				Flags: []cli.Flag{
-					&cli.BoolFlag{
-						Name:        "local",
-						Value:       false,
-						Destination: &localInit,
-					},
-					&cli.StringFlag{
-						Name:        "peer",
-						Value:       "",
-						Destination: &peerInit,
+			&cli.StringFlag{
+				Name:        "lease-mode",
+				Value:       string(p2p.LeaseModeQuorum),
+				Usage:       "peers granting the leases acquired through the node: a majority of the peers (quorum) or the elected leader (leader)",
+				Destination: &leaseMode,
+			},
+			&cli.StringFlag{
+				Name:        "table-owners",
+				Usage:       "JSON file mapping tables to the peer ID of their single writer",
+				Destination: &tableOwners,
+			},
+			&cli.StringFlag{
+				Name:        "consistency",
+				Value:       "local",
+				Usage:       "write acknowledgment level for periodic commits (local, quorum, all)",
+				Destination: &consistency,
+			},
+			&cli.BoolFlag{
+				Name:        "vector-clocks",
+				Value:       false,
+				Usage:       "attach vector clocks to local commits",
+				Destination: &vectorClocks,
+			},
+			&cli.BoolFlag{
+				Name:        "hybrid-clocks",
+				Value:       false,
+				Usage:       "attach hybrid logical clock timestamps to local commits and use them instead of the commit dates to find the latest version of conflicting rows",
+				Destination: &hybridClocks,
+			},
+			&cli.StringFlag{
+				Name:        "mergeable-columns",
+				Usage:       "JSON file with the counter, set and last-writer-wins columns of each table, whose concurrent updates are merged instead of conflicting",
+				Destination: &mergeableColumnsFile,
+			},
+			&cli.Float64Flag{
+				Name:        "min-free-disk-percent",
+				Value:       5,
+				Usage:       "percentage of free space of the data directory below which the node refuses writes and pauses syncs. 0 disables the check",
+				Destination: &diskGuardCfg.MinFreePercent,
+			},
+			&cli.Uint64Flag{
+				Name:        "min-free-disk-mb",
+				Value:       0,
+				Usage:       "free space of the data directory, in MB, below which the node refuses writes and pauses syncs. 0 disables the check",
+				Destination: &minFreeDiskMB,
+			},
+			&cli.DurationFlag{
+				Name:        "disk-check-interval",
+				Value:       30 * time.Second,
+				Usage:       "how often the free space of the data directory is checked",
+				Destination: &diskGuardCfg.CheckInterval,
+			},
+			&cli.Uint64Flag{
+				Name:        "max-heap-mb",
+				Value:       0,
+				Usage:       "heap in use, in MB, above which the node refuses new calls and pauses syncs. 0 disables the budget",
+				Destination: &maxHeapMB,
+			},
+			&cli.IntFlag{
+				Name:        "max-goroutines",
+				Value:       0,
+				Usage:       "number of goroutines above which the node refuses new calls and pauses syncs. 0 disables the budget",
+				Destination: &governorCfg.MaxGoroutines,
+			},
+			&cli.IntFlag{
+				Name:        "max-streams",
+				Value:       0,
+				Usage:       "number of open libp2p streams above which the node refuses new calls and pauses syncs. 0 disables the budget",
+				Destination: &governorCfg.MaxStreams,
+			},
+			&cli.DurationFlag{
+				Name:        "resource-check-interval",
+				Value:       5 * time.Second,
+				Usage:       "how often the resource usage is checked against the budgets",
+				Destination: &governorCfg.CheckInterval,
+			},
+			&cli.DurationFlag{
+				Name:        "clock-skew-threshold",
+				Value:       time.Second,
+				Usage:       "clock offset of a peer, measured at every ping, above which a warning is logged. 0 disables the warnings",
+				Destination: &clockSkewThreshold,
+			},
+			&cli.StringFlag{
+				Name:        "acl",
+				Usage:       "JSON file with the tables each peer or role may read and write",
+				Destination: &aclPolicy,
+			},
+			&cli.StringFlag{
+				Name:        "branch-policies",
+				Usage:       "JSON file with the protected, auto-merge, manual-review and approval branches",
+				Destination: &branchPolicyFile,
+			},
+			&cli.StringFlag{
+				Name:        "bridge-config",
+				Usage:       "JSON file with the clusters this node forwards commits to, and the tables to forward",
+				Destination: &bridgeConfigFile,
+			},
+			&cli.StringFlag{
+				Name:        "matviews",
+				Usage:       "JSON file with the SQL views materialized into local-only tables and refreshed on commits touching their sources",
+				Destination: &matviewsConfigFile,
+			},
+			&cli.StringFlag{
+				Name:        "jobs",
+				Usage:       "JSON file with the maintenance jobs (gc, anti-entropy, backup, snapshot, stats) run on cron schedules",
+				Destination: &jobsConfigFile,
+			},
+			&cli.StringSliceFlag{
+				Name:        "tombstones",
+				Usage:       "tables whose deletes only set a tombstone in the tombstone column, kept for the retention window before the rows are purged. Reads have to skip the rows with a tombstone",
+				Destination: &tombstoneTables,
+			},
+			&cli.StringFlag{
+				Name:        "tombstone-column",
+				Value:       "deleted_at",
+				Usage:       "nullable DATETIME column holding the tombstones of the rows",
+				Destination: &tombstoneCfg.Column,
+			},
+			&cli.DurationFlag{
+				Name:        "tombstone-retention",
+				Value:       7 * 24 * time.Hour,
+				Usage:       "how long tombstones are kept before the rows are purged",
+				Destination: &tombstoneCfg.Retention,
+			},
+			&cli.StringSliceFlag{
+				Name:        "encrypt-column",
+				Usage:       "column encrypted before it's committed, as table.column. Nodes without the key of the table replicate the ciphertext but can't read or write the column",
+				Destination: &encryptedColumns,
+			},
+			&cli.StringSliceFlag{
+				Name:        "table-key",
+				Usage:       "key of a table with encrypted columns, as table=<key>. The key can be a secret reference",
+				Destination: &tableKeys,
+			},
+			&cli.IntFlag{
+				Name:        "sessions-max",
+				Value:       64,
+				Usage:       "number of SQL sessions remote clients can keep open on the node",
+				Destination: &sessionsCfg.MaxSessions,
+			},
+			&cli.IntFlag{
+				Name:        "sessions-per-peer",
+				Value:       8,
+				Usage:       "number of SQL sessions a single peer can keep open on the node",
+				Destination: &sessionsCfg.MaxPerPeer,
+			},
+			&cli.DurationFlag{
+				Name:        "session-idle-timeout",
+				Value:       5 * time.Minute,
+				Usage:       "how long a SQL session stays open without statements, unless the client asks for another timeout",
+				Destination: &sessionsCfg.IdleTimeout,
+			},
+			&cli.StringFlag{
+				Name:        "alerts",
+				Usage:       "JSON file with the Slack and SMTP notifiers, routing rules and thresholds of operational alerts. Webhook URLs and passwords can be secret references",
+				Destination: &alertsConfigFile,
+			},
+			&cli.StringFlag{
+				Name:        "ca-cert",
+				Usage:       "PEM file with the cluster CA certificate used to verify peer certificates",
+				Destination: &caCert,
+			},
+			&cli.StringFlag{
+				Name:        "cert-dir",
+				Usage:       "directory with PEM peer certificates. The common name is the peer ID and the organizational units are ACL roles",
+				Destination: &certDir,
+			},
+			&cli.StringSliceFlag{
+				Name:        "admin-peers",
+				Usage:       "peer IDs allowed to call the Admin service, in addition to the local admin identity and the peers with the admin ACL role",
+				Destination: &adminPeers,
+			},
+			&cli.StringFlag{
+				Name:        "author-name",
+				Usage:       "author name recorded in the commits of this node",
+				Destination: &authorName,
+			},
+			&cli.StringFlag{
+				Name:        "author-email",
+				Usage:       "author email recorded in the commits of this node",
+				Destination: &authorEmail,
+			},
+			&cli.StringFlag{
+				Name:        "validation-rules",
+				Usage:       "JSON file with the validation rules applied to every write before it's committed",
+				Destination: &validationRules,
+			},
+			&cli.BoolFlag{
+				Name:        "plugins",
+				Usage:       "runs the WASM plugins signed by an admin key on every write and synced commit",
+				Destination: &pluginsEnabled,
+			},
+			&cli.DurationFlag{
+				Name:        "addrbook-ttl",
+				Value:       24 * time.Hour,
+				Usage:       "how long peers are kept in the address book after they were last seen",
+				Destination: &addrBookTTL,
+			},
+			&cli.DurationFlag{
+				Name:        "peer-expiry",
+				Value:       time.Hour,
+				Usage:       "how long the runtime state of a disconnected peer is kept",
+				Destination: &peerExpiry,
+			},
+			&cli.DurationFlag{
+				Name:        "keepalive-interval",
+				Value:       15 * time.Second,
+				Usage:       "how often peers are pinged to detect dead connections (0 disables the pings)",
+				Destination: &keepaliveInterval,
+			},
+			&cli.DurationFlag{
+				Name:        "keepalive-timeout",
+				Value:       5 * time.Second,
+				Usage:       "time a peer has to answer a keepalive ping before it is disconnected and dialed again",
+				Destination: &keepaliveTimeout,
+			},
+			&cli.BoolFlag{
+				Name:        "offline-first",
+				Value:       false,
+				Usage:       "keep committing writes locally when no peer is reachable and publish them on reconnection",
+				Destination: &offlineFirst,
+			},
+			&cli.StringSliceFlag{
+				Name:        "compression",
+				Usage:       "compressors offered to peers in order of preference (zstd, snappy). Disabled if empty",
+				Destination: &compressors,
+			},
+			&cli.IntFlag{
+				Name:        "compression-threshold",
+				Value:       1024,
+				Usage:       "size in bytes under which messages are sent uncompressed",
+				Destination: &compressionThreshold,
+			},
+			&cli.Float64Flag{
+				Name:        "commit-rate",
+				Value:       0,
+				Usage:       "maximum number of local commits per second (0 for unlimited)",
+				Destination: &commitRate,
+			},
+			&cli.IntFlag{
+				Name:        "commit-burst",
+				Value:       10,
+				Usage:       "number of commits allowed in a burst above the commit rate",
+				Destination: &commitBurst,
+			},
+			&cli.Int64Flag{
+				Name:        "backpressure-lag",
+				Value:       0,
+				Usage:       "delay local commits while a peer reports being more than this many commits behind (0 to ignore lag reports)",
+				Destination: &backpressureLag,
+			},
+			&cli.DurationFlag{
+				Name:        "backpressure-max-delay",
+				Value:       5 * time.Second,
+				Usage:       "maximum time a commit waits for lagging peers",
+				Destination: &backpressureMaxDelay,
+			},
+			&cli.IntFlag{
+				Name:        "sync-lag-threshold",
+				Value:       100,
+				Usage:       "missing commits of a peer above which a sync lag event is sent (0 to disable)",
+				Destination: &syncLagThreshold,
+			},
+			&cli.DurationFlag{
+				Name:        "drift-check-interval",
+				Value:       10 * time.Minute,
+				Usage:       "interval at which table row counts and content hashes are compared with peers at the same head (0 to disable)",
+				Destination: &driftCheckInterval,
+			},
+			&cli.StringFlag{
+				Name:        "standby-of",
+				Usage:       "run as a hot standby of the primary with this peer ID",
+				Destination: &standbyCfg.Primary,
+			},
+			&cli.DurationFlag{
+				Name:        "standby-check-interval",
+				Value:       5 * time.Second,
+				Usage:       "how often a standby health-checks its primary",
+				Destination: &standbyCfg.CheckInterval,
+			},
+			&cli.IntFlag{
+				Name:        "standby-failover-after",
+				Value:       3,
+				Usage:       "failed health checks after which a standby promotes itself (0 for manual promotion only)",
+				Destination: &standbyCfg.FailoverAfter,
+			},
+			&cli.StringSliceFlag{
+				Name:        "discovery",
+				Value:       cli.NewStringSlice("mdns"),
+				Usage:       "peer discovery mechanisms (mdns, static, kubernetes)",
+				Destination: &discoveryKinds,
+			},
+			&cli.StringSliceFlag{
+				Name:        "static-peer",
+				Usage:       "address of a peer used by the static discovery, including its peer ID",
+				EnvVars:     []string{"DOLTSWARM_STATIC_PEERS"},
+				Destination: &staticPeers,
+			},
+			&cli.StringFlag{
+				Name:        "k8s-namespace",
+				Usage:       "namespace of the peer pods. Defaults to the namespace of the service account",
+				Destination: &k8sCfg.Namespace,
+			},
+			&cli.StringFlag{
+				Name:        "k8s-service",
+				Usage:       "service selecting the peer pods",
+				Destination: &k8sCfg.Service,
+			},
+			&cli.StringFlag{
+				Name:        "k8s-selector",
+				Usage:       "label selector of the peer pods",
+				Destination: &k8sCfg.Selector,
+			},
+			&cli.StringFlag{
+				Name:        "listen-ip",
+				Value:       "127.0.0.1",
+				Usage:       "IPv4 address to listen on. Use 0.0.0.0 when peers run on other hosts",
+				Destination: &listenIP,
+			},
+			&cli.StringFlag{
+				Name:        "cdc-sink",
+				Value:       "",
+				Usage:       "export row changes to a message broker (kafka, nats)",
+				Destination: &cdcCfg.sink,
+			},
+			&cli.StringFlag{
+				Name:        "cdc-addr",
+				Value:       "",
+				Usage:       "comma separated kafka brokers or NATS URL used by the CDC exporter, or a secret reference",
+				Destination: &cdcCfg.addr,
+			},
+			&cli.StringSliceFlag{
+				Name:        "cdc-table",
+				Usage:       "table whose changes are exported (can be repeated)",
+				Value:       cli.NewStringSlice(tableName),
+				Destination: &cdcTables,
+			},
+			&cli.StringFlag{
+				Name:        "cdc-topic-prefix",
+				Value:       dbName,
+				Usage:       "prefix of the topics CDC records are published to",
+				Destination: &cdcCfg.topicPrefix,
+			},
+			&cli.StringFlag{
+				Name:        "storage",
+				Value:       "disk",
+				Usage:       "storage backend for the database (" + strings.Join(storage.Backends(), ", ") + ")",
+				Destination: &storageKind,
+			},
+			&cli.StringFlag{
+				Name:        "storage-path",
+				Value:       "",
+				Usage:       "backend specific storage path. Defaults to the db directory for disk and encrypted storage",
+				Destination: &storagePath,
+			},
+			&cli.StringFlag{
+				Name:        "storage-key",
+				Usage:       "passphrase of the encrypted storage, or a secret reference",
+				EnvVars:     []string{"DOLTSWARM_STORAGE_KEY"},
+				Destination: &storageKey,
+			},
+			&cli.StringFlag{
+				Name:        "startup-check",
+				Value:       "quick",
+				Usage:       "integrity check of the database before the server accepts traffic: off, quick to check the chunk store files, refs and commit graph, or full to also read every table",
+				Destination: &startupCheck,
+			},
+			&cli.BoolFlag{
+				Name:        "startup-repair",
+				Value:       true,
+				Usage:       "repair the damage found by the startup check: torn journal tails are cut and damaged databases are fetched again from a peer. The server refuses to start on damage otherwise",
+				Destination: &startupRepair,
+			},
+			&cli.StringFlag{
+				Name:        "secrets-identity",
+				Usage:       "age identity file used to decrypt the age:// secret references. Secret references are env://VAR, vault://path#key (using VAULT_ADDR and VAULT_TOKEN) and age://file#key",
+				EnvVars:     []string{"DOLTSWARM_SECRETS_IDENTITY"},
+				Destination: &secretsIdentity,
+			},
+			&cli.StringFlag{
+				Name:        "storage-key-cmd",
+				Usage:       "shell command that prints the passphrase of the encrypted storage, e.g. to read it from the OS keychain",
+				Destination: &storageKeyCmd,
+			},
+			&cli.IntFlag{
+				Name:        "start-retries",
+				Value:       3,
+				Usage:       "number of times a subsystem is started before giving up. Optional subsystems, like discoveries, keep being retried in the background",
+				Destination: &startRetries,
+			},
+			&cli.DurationFlag{
+				Name:        "start-backoff",
+				Value:       time.Second,
+				Usage:       "wait after the first failed start of a subsystem, doubled after every other failure",
+				Destination: &startBackoff,
+			},
+			&cli.DurationFlag{
+				Name:        "announcement-retention",
+				Value:       0,
+				Usage:       "records the heads announced to and by peers for this long, to audit them and request missed ones again after a restart. 0 disables the log",
+				Destination: &announcementRetention,
+			},
+			&cli.IntFlag{
+				Name:        "max-msg-size",
+				Value:       4 * 1024 * 1024,
+				Usage:       "maximum size in bytes of RPC messages sent or received",
+				Destination: &maxMsgSize,
+			},
+			&cli.Float64Flag{
+				Name:        "rpc-rate-limit",
+				Value:       0,
+				Usage:       "maximum RPCs per second accepted from each peer (0 means unlimited)",
+				Destination: &rpcRateLimit,
+			},
+			&cli.IntFlag{
+				Name:        "rpc-burst",
+				Value:       50,
+				Usage:       "number of RPCs a peer can make in a burst above the rate limit",
+				Destination: &rpcBurst,
+			},
+			&cli.IntFlag{
+				Name:        "rpc-slots",
+				Value:       8,
+				Usage:       "maximum number of unary RPCs in flight to a peer. Waiting calls are prioritized: pings and announcements first, then queries and writes, then sync transfers. 0 disables the limit",
+				Destination: &rpcSlots,
+			},
+			&cli.IntFlag{
+				Name:        "conn-low-water",
+				Value:       100,
+				Usage:       "number of connections the connection manager trims down to once it has more than conn-high-water",
+				Destination: &connLowWater,
+			},
+			&cli.IntFlag{
+				Name:        "conn-high-water",
+				Value:       400,
+				Usage:       "number of connections above which the connection manager closes the least useful ones",
+				Destination: &connHighWater,
+			},
+			&cli.IntFlag{
+				Name:        "handler-queue",
+				Value:       100,
+				Usage:       "number of received messages queued for every message handler. Messages arriving while the queue is full are dropped",
+				Destination: &handlerQueueSize,
+			},
+			&cli.StringFlag{
+				Name:        "node-role",
+				Value:       string(p2p.RoleArchive),
+				Usage:       "role advertised to peers (archive, light)",
+				Destination: &nodeRole,
+			},
+			&cli.Int64Flag{
+				Name:        "history-depth",
+				Value:       0,
+				Usage:       "number of commits of history advertised by light nodes",
+				Destination: &historyDepth,
+			},
+			&cli.Int64Flag{
+				Name:        "blob-cache-mb",
+				Value:       1024,
+				Usage:       "size in MB of the blobs kept by light nodes, which fetch blobs when they are read. Pinned blobs are always kept",
+				Destination: &blobCacheMB,
+			},
+			&cli.DurationFlag{
+				Name:        "remote-read-budget",
+				Value:       5 * time.Second,
+				Usage:       "how long light nodes try archive peers for queries reading the history before serving them locally (0 serves them locally)",
+				Destination: &remoteReadBudget,
+			},
+			&cli.DurationFlag{
+				Name:        "remote-read-cache-ttl",
+				Value:       30 * time.Second,
+				Usage:       "how long light nodes cache the history reads served by archive peers. The cache is dropped on every new commit",
+				Destination: &remoteReadCacheTTL,
+			},
+			&cli.StringFlag{
+				Name:        "region",
+				Usage:       "region of the node. Heads from other regions are pulled by a single node of the region and relayed to the others",
+				Destination: &zone.Region,
+			},
+			&cli.StringFlag{
+				Name:        "zone",
+				Usage:       "zone of the node in its region. Heads from other zones are pulled by a single node of the zone and relayed to the others",
+				Destination: &zone.Zone,
+			},
+			&cli.DurationFlag{
+				Name:        "cross-zone-delay",
+				Value:       5 * time.Second,
+				Usage:       "how long nodes wait for a head to be relayed in their zone before pulling it from another zone",
+				Destination: &crossZoneDelay,
+			},
+			&cli.DurationFlag{
+				Name:        "rpc-deadline",
+				Value:       time.Minute,
+				Usage:       "time after which a running RPC handler or a blocked stream send is reported as stuck",
+				Destination: &rpcDeadline,
+			},
+			&cli.DurationFlag{
+				Name:        "stream-idle-timeout",
+				Value:       0,
+				Usage:       "time without traffic after which a stream is reported as stuck (0 disables the check)",
+				Destination: &streamIdleTimeout,
+			},
+			&cli.BoolFlag{
+				Name:        "reset-stuck-rpcs",
+				Value:       false,
+				Usage:       "cancel RPCs reported as stuck",
+				Destination: &resetStuckRPCs,
+			},
+			&cli.DurationFlag{
+				Name:        "rpc-call-timeout",
+				Value:       0,
+				Usage:       "deadline of the calls to peers made without one, sent along with the calls so that peers stop handling them once nobody waits (0 disables it)",
+				Destination: &rpcCallTimeout,
+			},
+			&cli.BoolFlag{
+				Name:        "proto-dump",
+				Usage:       "dump the decoded messages exchanged with the peers for protocol debugging. The dump can also be turned on and off at runtime with the protodump command",
+				Destination: &protoDump,
+			},
+			&cli.StringFlag{
+				Name:        "proto-dump-file",
+				Usage:       "also append the dumped messages to this file, as JSON lines",
+				Destination: &protoDumpCfg.File,
+			},
+			&cli.Int64Flag{
+				Name:        "proto-dump-max-file",
+				Value:       64 << 20,
+				Usage:       "size in bytes at which the dump file is rotated",
+				Destination: &protoDumpCfg.MaxFileBytes,
+			},
+			&cli.IntFlag{
+				Name:        "proto-dump-entries",
+				Value:       1000,
+				Usage:       "number of recent messages kept in memory",
+				Destination: &protoDumpCfg.Entries,
+			},
+			&cli.IntFlag{
+				Name:        "proto-dump-max-message",
+				Value:       4096,
+				Usage:       "size in bytes at which the dumped messages are truncated",
+				Destination: &protoDumpCfg.MaxMessageBytes,
+			},
+			&cli.Float64Flag{
+				Name:        "proto-dump-rate",
+				Value:       50,
+				Usage:       "messages dumped per second. Messages over the rate are dropped",
+				Destination: &protoDumpCfg.Rate,
+			},
+			&cli.StringSliceFlag{
+				Name:        "proto-dump-redact",
+				Usage:       "name of a message field whose value is not dumped, in addition to passwords, tokens and secrets",
+				Destination: &protoDumpRedact,
+			},
+			&cli.StringSliceFlag{
+				Name:        "proto-dump-method",
+				Usage:       "only dump the methods containing this string, e.g. AdvertiseHead",
+				Destination: &protoDumpMethods,
+			},
+			&cli.DurationFlag{
+				Name:        "read-cache-ttl",
+				Value:       2 * time.Second,
+				Usage:       "how long responses of remote reads like GetHead are cached (0 disables the cache)",
+				Destination: &readCacheTTL,
+			},
+			&cli.DurationFlag{
+				Name:        "metrics-retention",
+				Value:       6 * time.Hour,
+				Usage:       "how long metric history is kept in memory",
+				Destination: &metricsRetention,
+			},
+		},
+		Commands: []*cli.Command{
+			{
+				Name:  "server",
+				Usage: "starts p2p server",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:        "init-peer",
+						Value:       "",
+						Usage:       "initialise the db from this peer if it's empty (useful with --storage memory)",
+						Destination: &serverInitPeer,
+					},
+					&cli.StringFlag{
+						Name:        "init-snapshot",
+						Usage:       "bootstrap the db from the snapshot at this HTTP(S) URL if it's empty, e.g. the archive written by a snapshot job, and sync the newer commits from the peers",
+						Destination: &initSnapshot,
+					},
+					&cli.StringFlag{
+						Name:        "init-snapshot-sha256",
+						Usage:       "SHA-256 checksum the snapshot must have. The snapshot is not verified if empty",
+						Destination: &initSnapshotSHA256,
+					},
+					&cli.StringFlag{
+						Name:        "sql-addr",
+						Usage:       "serve MySQL clients on this address, e.g. 127.0.0.1:3306. Requires --sql-user and --sql-password",
+						Destination: &sqlCfg.Addr,
+					},
+					&cli.StringFlag{
+						Name:        "sql-user",
+						Usage:       "user required from MySQL clients",
+						Destination: &sqlCfg.User,
+					},
+					&cli.StringFlag{
+						Name:        "sql-password",
+						Usage:       "password of the MySQL user, or a secret reference",
+						EnvVars:     []string{"DOLTSWARM_SQL_PASSWORD"},
+						Destination: &sqlCfg.Password,
+					},
+					&cli.StringFlag{
+						Name:        "gateway-addr",
+						Usage:       "serve the gRPC services to non-libp2p clients on this TCP address, e.g. 127.0.0.1:9090. Requires --gateway-cert, --gateway-key and --gateway-token",
+						Destination: &gatewayCfg.Addr,
+					},
+					&cli.StringFlag{
+						Name:        "gateway-cert",
+						Usage:       "PEM certificate of the gRPC gateway",
+						Destination: &gatewayCfg.CertFile,
+					},
+					&cli.StringFlag{
+						Name:        "gateway-key",
+						Usage:       "PEM private key of the gRPC gateway certificate",
+						Destination: &gatewayCfg.KeyFile,
+					},
+					&cli.StringFlag{
+						Name:        "gateway-token",
+						Usage:       "bearer token required from gRPC gateway clients, or a secret reference",
+						EnvVars:     []string{"DOLTSWARM_GATEWAY_TOKEN"},
+						Destination: &gatewayCfg.Token,
+					},
+					&cli.IntFlag{
+						Name:        "batch-size",
+						Value:       1,
+						Usage:       "number of periodic inserts committed together",
+						Destination: &batchSize,
+					},
+					&cli.DurationFlag{
+						Name:        "batch-delay",
+						Value:       time.Minute,
+						Usage:       "maximum time an insert waits for its batch to be committed",
+						Destination: &batchDelay,
+					},
+				},
+				Before: funcBefore,
+				After:  funcAfter,
+				Action: func(ctx *cli.Context) error {
+					level, err := parseConsistency(consistency)
+					if err != nil {
+						return err
+					}
+					var batcher *batch.Writer
+					if batchSize > 1 {
+						commit := func(query string, commitMsg string) (string, error) {
+							return p2pmgr.ExecAndCommit(query, commitMsg, level)
+						}
+						batcher, err = batch.NewWriter(commit, batch.WithMaxStatements(batchSize), batch.WithMaxDelay(batchDelay))
+						if err != nil {
+							return err
+						}
+					}
+					cdcCfg.tables = cdcTables.Value()
+					debugConfig = collectConfig(ctx)
+					return p2pRun(noGUI, noCommits, commitInterval, level, batcher, cdcCfg, sqlCfg, gatewayCfg, serverInitPeer)
+				},
+			},
+			{
+				Name:  "init",
+				Usage: "initialises db",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:        "local",
+						Value:       false,
+						Destination: &localInit,
+					},
+					&cli.StringFlag{
+						Name:        "peer",
+						Value:       "",
+						Destination: &peerInit,
 					},
 				},
 				Before: funcBefore,
@@ -324,6 +1719,897 @@ func main() {
 					return nil
 				},
 			},
+			{
+				Name:  "jobs",
+				Usage: "shows the scheduled maintenance jobs of the running server and their recent runs",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "history",
+						Value: 5,
+						Usage: "number of recent runs shown per job",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					return printJobs(ctx.Int("history"))
+				},
+			},
+			{
+				Name:  "matviews",
+				Usage: "shows the materialized views of the running server and their last refresh",
+				Action: func(ctx *cli.Context) error {
+					return printMaterializedViews()
+				},
+			},
+			{
+				Name:  "announcements",
+				Usage: "shows the heads announced to and by peers, recorded with --announcement-retention",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "peer",
+						Usage: "only shows the announcements exchanged with this peer",
+					},
+					&cli.StringFlag{
+						Name:  "direction",
+						Usage: "only shows the sent or the received announcements",
+					},
+					&cli.DurationFlag{
+						Name:  "since",
+						Usage: "only shows the announcements of this last period",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					return printAnnouncements(ctx.String("peer"), ctx.String("direction"), ctx.Duration("since"))
+				},
+			},
+			{
+				Name:  "sync",
+				Usage: "shows the sync progress of the running server",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "watch",
+						Usage: "keep printing the progress until the sync completes",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					return printSyncProgress(ctx.Bool("watch"))
+				},
+			},
+			{
+				Name:      "trace-commit",
+				Usage:     "asks the running server and all its reachable peers if and when they applied a commit, and prints the propagation timeline",
+				ArgsUsage: "<hash>",
+				Flags: []cli.Flag{
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Value: 30 * time.Second,
+						Usage: "how long to wait for the trace",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					if ctx.NArg() != 1 {
+						return fmt.Errorf("expected a commit hash")
+					}
+					return traceCommit(ctx.Args().First(), ctx.Duration("timeout"))
+				},
+			},
+			{
+				Name:      "explain",
+				Usage:     "prints the plan of a read query on a node, and profiles the query with --profile",
+				ArgsUsage: "<query>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "node",
+						Usage:    "address of the node, including its peer ID",
+						Required: true,
+					},
+					&cli.BoolFlag{
+						Name:  "profile",
+						Usage: "run the query and print its execution stats",
+					},
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Value: time.Minute,
+						Usage: "how long to wait for the plan",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					if ctx.NArg() != 1 {
+						return fmt.Errorf("expected a query")
+					}
+					return explainQuery(ctx.String("node"), ctx.Args().First(), ctx.Bool("profile"), ctx.Duration("timeout"))
+				},
+			},
+			{
+				Name:  "profiles",
+				Usage: "lists the tuning profiles and the flags they set",
+				Action: func(ctx *cli.Context) error {
+					printProfiles()
+					return nil
+				},
+			},
+			{
+				Name:  "topology",
+				Usage: "prints the mesh topology known to the running server",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Value: "dot",
+						Usage: "output format (dot, json)",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					return printTopology(ctx.String("format"))
+				},
+			},
+			{
+				Name:  "conflicts",
+				Usage: "shows and resolves the merge conflicts of the running server",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "list",
+						Usage: "lists the tables with conflicts and shows the conflicting rows side by side",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "table",
+								Usage: "only show the conflicting rows of this table",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							return printConflicts(ctx.String("table"))
+						},
+					},
+					{
+						Name:      "resolve",
+						Usage:     "resolves conflicts and commits the resolution",
+						ArgsUsage: "<table>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "id",
+								Usage: "conflict to resolve. All the conflicts of the table are resolved if empty",
+							},
+							&cli.StringFlag{
+								Name:     "use",
+								Usage:    "version of the rows to keep (ours, theirs, latest), or merge to merge the mergeable columns",
+								Required: true,
+							},
+							&cli.DurationFlag{
+								Name:  "timeout",
+								Value: time.Minute,
+								Usage: "how long to wait for the resolution",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							if ctx.NArg() != 1 {
+								return fmt.Errorf("expected a table name")
+							}
+							req := conflictRequest{Table: ctx.Args().First(), ID: ctx.String("id"), Resolution: ctx.String("use")}
+							commit, err := resolveConflicts(req, ctx.Duration("timeout"))
+							if err != nil {
+								return err
+							}
+							fmt.Printf("Conflicts resolved in commit %s\n", commit)
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:  "queries",
+				Usage: "manages and runs the named queries replicated to every node",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "list",
+						Usage: "lists the named queries",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "node",
+								Usage:    "address of the node, including its peer ID",
+								Required: true,
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							return listNamedQueries(ctx.String("node"))
+						},
+					},
+					{
+						Name:      "define",
+						Usage:     "creates or replaces a named query. Parameters are written :name in the statement",
+						ArgsUsage: "<name> <statement>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "node",
+								Usage:    "address of the node, including its peer ID",
+								Required: true,
+							},
+							&cli.StringSliceFlag{
+								Name:  "param",
+								Usage: "parameter of the query, repeated for every parameter",
+							},
+							&cli.StringFlag{
+								Name:  "description",
+								Usage: "what the query does",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							if ctx.NArg() != 2 {
+								return fmt.Errorf("expected a name and a statement")
+							}
+							return defineNamedQuery(ctx.String("node"), &p2pproto.NamedQuery{
+								Name:        ctx.Args().Get(0),
+								Statement:   ctx.Args().Get(1),
+								Params:      ctx.StringSlice("param"),
+								Description: ctx.String("description"),
+							})
+						},
+					},
+					{
+						Name:      "drop",
+						Usage:     "removes a named query",
+						ArgsUsage: "<name>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "node",
+								Usage:    "address of the node, including its peer ID",
+								Required: true,
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							if ctx.NArg() != 1 {
+								return fmt.Errorf("expected a query name")
+							}
+							return dropNamedQuery(ctx.String("node"), ctx.Args().First())
+						},
+					},
+					{
+						Name:      "run",
+						Usage:     "runs a named query and prints its rows, or the commit of a write",
+						ArgsUsage: "<name> [<param>=<value>...]",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "node",
+								Usage:    "address of the node, including its peer ID",
+								Required: true,
+							},
+							&cli.DurationFlag{
+								Name:  "timeout",
+								Value: time.Minute,
+								Usage: "how long to wait for the query",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							if ctx.NArg() < 1 {
+								return fmt.Errorf("expected a query name")
+							}
+							return runNamedQuery(ctx.String("node"), ctx.Args().First(), ctx.Args().Tail(), ctx.Duration("timeout"))
+						},
+					},
+				},
+			},
+			{
+				Name:  "approvals",
+				Usage: "lists and approves the commits of the approval branches",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "list",
+						Usage: "lists the commits waiting for approval",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "node",
+								Usage:    "address of the node, including its peer ID",
+								Required: true,
+							},
+							&cli.BoolFlag{
+								Name:  "merged",
+								Usage: "also list the approved commits that were merged",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							return listApprovals(ctx.String("node"), ctx.Bool("merged"))
+						},
+					},
+					{
+						Name:      "approve",
+						Usage:     "signs an approval of a commit with the key of the node, which has to be an approver of the branch, and sends it to the peers",
+						ArgsUsage: "<branch> <commit>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "node",
+								Usage:    "address of the node, including its peer ID",
+								Required: true,
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							if ctx.NArg() != 2 {
+								return fmt.Errorf("expected a branch and a commit")
+							}
+							return approveCommit(ctx.String("node"), ctx.Args().Get(0), ctx.Args().Get(1))
+						},
+					},
+				},
+			},
+			{
+				Name:  "import",
+				Usage: "loads CSV, JSON and Parquet files into a table through the running server",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "start",
+						Usage:     "imports a file, committing its rows in chunks, and shows the progress",
+						ArgsUsage: "<file>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "table",
+								Usage:    "table the rows are written to. Rows with an existing primary key are replaced",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:  "format",
+								Usage: "format of the file (csv, json, parquet). Detected from the extension if empty",
+							},
+							&cli.IntFlag{
+								Name:  "chunk-size",
+								Value: importer.DefaultChunkSize,
+								Usage: "number of rows per commit",
+							},
+							&cli.BoolFlag{
+								Name:  "pause-announcements",
+								Usage: "don't announce the new commits to peers until the import completes",
+							},
+							&cli.BoolFlag{
+								Name:  "detach",
+								Usage: "return once the import is requested instead of showing its progress",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							if ctx.NArg() != 1 {
+								return fmt.Errorf("expected a file to import")
+							}
+							return startImport(ctx.Args().First(), ctx.String("table"), ctx.String("format"), ctx.Int("chunk-size"), ctx.Bool("pause-announcements"), ctx.Bool("detach"))
+						},
+					},
+					{
+						Name:  "status",
+						Usage: "lists the imports and their progress",
+						Action: func(ctx *cli.Context) error {
+							return printImports()
+						},
+					},
+					{
+						Name:      "resume",
+						Usage:     "resumes a failed import after the last committed row",
+						ArgsUsage: "<id>",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "detach",
+								Usage: "return once the import is requested instead of showing its progress",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							if ctx.NArg() != 1 {
+								return fmt.Errorf("expected an import ID")
+							}
+							return resumeImport(ctx.Args().First(), ctx.Bool("detach"))
+						},
+					},
+				},
+			},
+			{
+				Name:  "export",
+				Usage: "writes a table or the result of a query, at any commit, to CSV, JSON lines or Parquet through the running server",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "table",
+						Usage: "table to export",
+					},
+					&cli.StringFlag{
+						Name:  "query",
+						Usage: "query whose result is exported, instead of a table",
+					},
+					&cli.StringFlag{
+						Name:  "as-of",
+						Usage: "commit, branch or tag the rows are read at. Defaults to the working set",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "format of the output (csv, json, parquet). Detected from the extension of the output if empty",
+					},
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "file the rows are written to. The rows are written to stdout if empty or '-'",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					req := exporter.Request{Table: ctx.String("table"), Query: ctx.String("query"), AsOf: ctx.String("as-of")}
+					return export(req, ctx.String("format"), ctx.String("output"))
+				},
+			},
+			{
+				Name:  "selftest",
+				Usage: "runs a throwaway local cluster and checks that writes converge, also after a node is killed mid-sync",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "nodes",
+						Value: 3,
+						Usage: "number of nodes",
+					},
+					&cli.IntFlag{
+						Name:  "base-port",
+						Value: 20500,
+						Usage: "port of the first node. The following nodes use the next ports",
+					},
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Value: 2 * time.Minute,
+						Usage: "how long every step may take",
+					},
+					&cli.BoolFlag{
+						Name:  "keep",
+						Usage: "keep the node directories and logs even if the selftest passes",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					return runSelftest(selftestConfig{
+						Nodes:    ctx.Int("nodes"),
+						BasePort: ctx.Int("base-port"),
+						Timeout:  ctx.Duration("timeout"),
+						Keep:     ctx.Bool("keep"),
+					})
+				},
+			},
+			{
+				Name:  "bench",
+				Usage: "runs a reproducible write and read workload against a cluster and reports commit latency, convergence time and throughput",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:  "node",
+						Usage: "address of a node of the cluster to benchmark. A throwaway local cluster is started if no node is given",
+					},
+					&cli.IntFlag{
+						Name:  "nodes",
+						Value: 3,
+						Usage: "number of nodes of the throwaway cluster",
+					},
+					&cli.IntFlag{
+						Name:  "base-port",
+						Value: 20600,
+						Usage: "port of the first node of the throwaway cluster. The following nodes use the next ports",
+					},
+					&cli.DurationFlag{
+						Name:  "duration",
+						Value: time.Minute,
+						Usage: "how long the workload runs",
+					},
+					&cli.Float64Flag{
+						Name:  "write-rate",
+						Value: 10,
+						Usage: "rows written per second, over all the nodes",
+					},
+					&cli.IntFlag{
+						Name:  "rows-per-write",
+						Value: 1,
+						Usage: "rows inserted by every write, in a single commit",
+					},
+					&cli.Float64Flag{
+						Name:  "read-rate",
+						Value: 10,
+						Usage: "reads per second, over all the nodes",
+					},
+					&cli.IntFlag{
+						Name:  "payload-bytes",
+						Value: 64,
+						Usage: "size of the payload of every row",
+					},
+					&cli.Int64Flag{
+						Name:  "seed",
+						Value: 1,
+						Usage: "seed of the workload. Runs with the same seed and settings write the same rows on the same nodes",
+					},
+					&cli.DurationFlag{
+						Name:  "convergence-timeout",
+						Value: time.Minute,
+						Usage: "how long the nodes have to apply a commit before it counts as not converged",
+					},
+					&cli.IntFlag{
+						Name:  "max-in-flight",
+						Value: 64,
+						Usage: "maximum number of operations running at the same time",
+					},
+					&cli.StringFlag{
+						Name:  "output",
+						Usage: "file the JSON report is written to",
+					},
+					&cli.BoolFlag{
+						Name:  "keep",
+						Usage: "keep the node directories and logs of the throwaway cluster",
+					},
+					&cli.StringFlag{
+						Name:  "node-profile",
+						Value: "default",
+						Usage: "tuning profile of the nodes of the throwaway cluster, whose memory footprint is reported",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					if _, found := tuningProfiles[ctx.String("node-profile")]; !found {
+						return fmt.Errorf("unknown profile '%s', expected %s", ctx.String("node-profile"), strings.Join(profileNames(), ", "))
+					}
+					return runBench(benchConfig{
+						Workload: bench.Config{
+							Duration:           ctx.Duration("duration"),
+							WriteRate:          ctx.Float64("write-rate"),
+							RowsPerWrite:       ctx.Int("rows-per-write"),
+							ReadRate:           ctx.Float64("read-rate"),
+							PayloadBytes:       ctx.Int("payload-bytes"),
+							Seed:               ctx.Int64("seed"),
+							Table:              tableName,
+							ConvergenceTimeout: ctx.Duration("convergence-timeout"),
+							MaxInFlight:        ctx.Int("max-in-flight"),
+						},
+						Addrs:    ctx.StringSlice("node"),
+						Nodes:    ctx.Int("nodes"),
+						BasePort: ctx.Int("base-port"),
+						Output:   ctx.String("output"),
+						Keep:     ctx.Bool("keep"),
+						Profile:  ctx.String("node-profile"),
+					})
+				},
+			},
+			{
+				Name:  "simulate",
+				Usage: "simulates concurrent writes on in-memory replicas and reports the conflict rate and outcome of every conflict resolution strategy",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "nodes",
+						Value: 3,
+						Usage: "number of simulated nodes",
+					},
+					&cli.IntFlag{
+						Name:  "rounds",
+						Value: 50,
+						Usage: "number of write rounds",
+					},
+					&cli.IntFlag{
+						Name:  "writes",
+						Value: 5,
+						Usage: "number of cells written by every node in a round",
+					},
+					&cli.Float64Flag{
+						Name:  "sync-rate",
+						Value: 0.5,
+						Usage: "probability that a node pulls from a peer after a round",
+					},
+					&cli.IntFlag{
+						Name:  "keys",
+						Value: 100,
+						Usage: "number of shared rows, and of private rows of every node",
+					},
+					&cli.IntFlag{
+						Name:  "columns",
+						Value: 3,
+						Usage: "number of columns of every row",
+					},
+					&cli.Float64Flag{
+						Name:  "overlap",
+						Value: 0.2,
+						Usage: "probability that a write goes to a shared row",
+					},
+					&cli.Int64Flag{
+						Name:  "seed",
+						Value: 1,
+						Usage: "seed of the workload. The same seed always produces the same report",
+					},
+					&cli.StringSliceFlag{
+						Name:  "strategy",
+						Value: cli.NewStringSlice("ours", "theirs", "lww"),
+						Usage: "conflict resolution strategies to compare (ours, theirs, lww)",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					return runSimulation(simulate.Config{
+						Nodes:          ctx.Int("nodes"),
+						Rounds:         ctx.Int("rounds"),
+						WritesPerRound: ctx.Int("writes"),
+						SyncRate:       ctx.Float64("sync-rate"),
+						Keys:           ctx.Int("keys"),
+						Columns:        ctx.Int("columns"),
+						Overlap:        ctx.Float64("overlap"),
+						Seed:           ctx.Int64("seed"),
+					}, ctx.StringSlice("strategy"))
+				},
+			},
+			{
+				Name:  "standby",
+				Usage: "shows and promotes the standby running in the working directory",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "status",
+						Usage: "shows the primary and the sync state of the standby",
+						Action: func(ctx *cli.Context) error {
+							return printStandbyStatus()
+						},
+					},
+					{
+						Name:  "promote",
+						Usage: "makes the standby take over the role of its primary",
+						Flags: []cli.Flag{
+							&cli.DurationFlag{
+								Name:  "timeout",
+								Value: 30 * time.Second,
+								Usage: "how long to wait for the promotion",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							err := promoteStandby(ctx.Duration("timeout"))
+							if err != nil {
+								return err
+							}
+							fmt.Println("Standby promoted")
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:  "cluster",
+				Usage: "operates on the nodes of a cluster",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "restart",
+						Usage: "restarts the nodes one at a time: every node is drained, restarted once its peers route around it, and has to be back and synced before the next one is restarted",
+						Flags: []cli.Flag{
+							&cli.StringSliceFlag{
+								Name:     "node",
+								Usage:    "address of a node to restart, including its peer ID (can be repeated). Nodes are restarted in order",
+								Required: true,
+							},
+							&cli.DurationFlag{
+								Name:  "ack-timeout",
+								Value: 30 * time.Second,
+								Usage: "how long the peers of a node have to acknowledge its drain",
+							},
+							&cli.DurationFlag{
+								Name:  "restart-timeout",
+								Value: 2 * time.Minute,
+								Usage: "how long a node has to come back after a restart",
+							},
+							&cli.DurationFlag{
+								Name:  "sync-timeout",
+								Value: 5 * time.Minute,
+								Usage: "how long a node has to sync after a restart",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							return rollingRestart(ctx.StringSlice("node"), rollout.Config{
+								AckTimeout:     ctx.Duration("ack-timeout"),
+								RestartTimeout: ctx.Duration("restart-timeout"),
+								SyncTimeout:    ctx.Duration("sync-timeout"),
+							})
+						},
+					},
+				},
+			},
+			{
+				Name:  "protodump",
+				Usage: "turns the dump of the messages a node exchanges with its peers on and off, and shows the dumped messages",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "on",
+						Usage: "starts dumping the messages",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "node",
+								Usage:    "address of the node, including its peer ID",
+								Required: true,
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							return setProtoDump(ctx.String("node"), true)
+						},
+					},
+					{
+						Name:  "off",
+						Usage: "stops dumping the messages",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "node",
+								Usage:    "address of the node, including its peer ID",
+								Required: true,
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							return setProtoDump(ctx.String("node"), false)
+						},
+					},
+					{
+						Name:  "show",
+						Usage: "prints the most recently dumped messages",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "node",
+								Usage:    "address of the node, including its peer ID",
+								Required: true,
+							},
+							&cli.IntFlag{
+								Name:  "limit",
+								Value: 100,
+								Usage: "maximum number of messages, all the messages kept by the node if 0",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							return showProtoDump(ctx.String("node"), ctx.Int("limit"))
+						},
+					},
+				},
+			},
+			{
+				Name:  "plugins",
+				Usage: "manages the WASM plugins validating and transforming the writes of the cluster",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "deploy",
+						Usage:     "loads a plugin on a node, which publishes it to its peers. A plugin with the same name is replaced",
+						ArgsUsage: "<file.wasm>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "node",
+								Usage:    "address of the node, including its peer ID",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "name",
+								Usage:    "name of the plugin",
+								Required: true,
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							if ctx.NArg() != 1 {
+								return fmt.Errorf("expected the WASM file of the plugin")
+							}
+							return deployPlugin(ctx.String("node"), ctx.String("name"), ctx.Args().First())
+						},
+					},
+					{
+						Name:  "remove",
+						Usage: "unloads a plugin from all the nodes",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "node",
+								Usage:    "address of the node, including its peer ID",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "name",
+								Usage:    "name of the plugin",
+								Required: true,
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							return removePlugin(ctx.String("node"), ctx.String("name"))
+						},
+					},
+					{
+						Name:  "list",
+						Usage: "lists the plugins loaded by a node",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "node",
+								Usage:    "address of the node, including its peer ID",
+								Required: true,
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							return listPlugins(ctx.String("node"))
+						},
+					},
+				},
+			},
+			{
+				Name:  "debug",
+				Usage: "diagnostic tools",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "bundle",
+						Usage: "asks the running server to write a diagnostic bundle for bug reports",
+						Flags: []cli.Flag{
+							&cli.DurationFlag{
+								Name:  "timeout",
+								Value: 30 * time.Second,
+								Usage: "how long to wait for the bundle",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							path, err := requestDebugBundle(ctx.Duration("timeout"))
+							if err != nil {
+								return err
+							}
+							fmt.Printf("Debug bundle written to %s\n", path)
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:  "peers",
+				Usage: "manages known peers",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "add",
+						Usage:     "adds a static peer to the address book",
+						ArgsUsage: "<multiaddr>",
+						Action: func(ctx *cli.Context) error {
+							if ctx.NArg() != 1 {
+								return fmt.Errorf("expected a peer address")
+							}
+							err := ensureDir(workDir)
+							if err != nil {
+								return fmt.Errorf("failed to create working directory: %v", err)
+							}
+							addrBook, err := p2p.NewAddressBook(workDir+"/addrbook.json", addrBookTTL)
+							if err != nil {
+								return fmt.Errorf("failed to load address book: %v", err)
+							}
+							info, err := addrBook.AddStatic(ctx.Args().First())
+							if err != nil {
+								return err
+							}
+							fmt.Printf("Added static peer %s\n", info.ID.String())
+							return nil
+						},
+					},
+					{
+						Name:  "list",
+						Usage: "lists the peers in the address book",
+						Action: func(ctx *cli.Context) error {
+							addrBook, err := p2p.NewAddressBook(workDir+"/addrbook.json", addrBookTTL)
+							if err != nil {
+								return fmt.Errorf("failed to load address book: %v", err)
+							}
+							for _, entry := range addrBook.Entries() {
+								fmt.Printf("%s static=%t last_seen=%s %v\n", entry.ID, entry.Static, entry.LastSeen.Format(time.RFC3339), entry.Addrs)
+							}
+							return nil
+						},
+					},
+					{
+						Name:      "ban",
+						Usage:     "bans a peer, disconnecting it and refusing its connections. The ban persists across restarts",
+						ArgsUsage: "<peer id>",
+						Flags: []cli.Flag{
+							&cli.DurationFlag{
+								Name:  "duration",
+								Usage: "lifts the ban after this long. The ban is permanent if not set",
+							},
+							&cli.StringFlag{
+								Name:  "reason",
+								Usage: "why the peer is banned, shown when listing bans",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							if ctx.NArg() != 1 {
+								return fmt.Errorf("expected a peer ID")
+							}
+							return banPeer(ctx.Args().First(), ctx.String("reason"), ctx.Duration("duration"))
+						},
+					},
+					{
+						Name:      "unban",
+						Usage:     "lifts the ban of a peer",
+						ArgsUsage: "<peer id>",
+						Action: func(ctx *cli.Context) error {
+							if ctx.NArg() != 1 {
+								return fmt.Errorf("expected a peer ID")
+							}
+							return unbanPeer(ctx.Args().First())
+						},
+					},
+					{
+						Name:  "bans",
+						Usage: "lists the banned peers",
+						Action: func(ctx *cli.Context) error {
+							return printBans()
+						},
+					},
+				},
+			},
 		},
 	}
 
@@ -331,5 +2617,11 @@ func main() {
 		fmt.Println("error:", err)
 		os.Exit(1)
 	}
+	if restartRequested.Load() {
+		if err := reexec(); err != nil {
+			fmt.Println("error: failed to restart:", err)
+			os.Exit(1)
+		}
+	}
 
 }
@@ -0,0 +1,93 @@
+package matview
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+const tablePrefix = "mv_"
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// View is a SQL query materialized into a local-only table
+type View struct {
+	Name string `json:"name"`
+	// Query is the SELECT statement computing the rows of the view
+	Query string `json:"query"`
+	// Sources are the tables read by the query. The view is refreshed when a
+	// commit touches one of them.
+	Sources []string `json:"sources"`
+	// Table receiving the rows. Defaults to mv_<name>. It has to match a
+	// pattern of dolt_ignore so that it's never replicated.
+	Table string `json:"table,omitempty"`
+	// Key are the columns identifying a row of the view. With a key, only the
+	// rows that changed are written on refresh instead of the whole table.
+	Key []string `json:"key,omitempty"`
+}
+
+// Config holds the materialized views of a node
+type Config struct {
+	Views []View `json:"views"`
+}
+
+// LoadConfig reads the materialized views from a JSON file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read materialized views: %w", err)
+	}
+	cfg := &Config{}
+	err = json.Unmarshal(data, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse materialized views '%s': %w", path, err)
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate checks the views and sets the defaults
+func (cfg *Config) Validate() error {
+	names := map[string]bool{}
+	tables := map[string]bool{}
+	for i := range cfg.Views {
+		view := &cfg.Views[i]
+		if !validName.MatchString(view.Name) {
+			return fmt.Errorf("materialized views: invalid view name '%s'", view.Name)
+		}
+		if names[view.Name] {
+			return fmt.Errorf("materialized views: duplicate view '%s'", view.Name)
+		}
+		names[view.Name] = true
+		if view.Query == "" {
+			return fmt.Errorf("materialized views: missing query of view '%s'", view.Name)
+		}
+		if view.Table == "" {
+			view.Table = tablePrefix + view.Name
+		}
+		if !validName.MatchString(view.Table) {
+			return fmt.Errorf("materialized views: invalid table name '%s' for view '%s'", view.Table, view.Name)
+		}
+		if tables[view.Table] {
+			return fmt.Errorf("materialized views: table '%s' is used by more than one view", view.Table)
+		}
+		tables[view.Table] = true
+		if len(view.Sources) == 0 {
+			return fmt.Errorf("materialized views: no source tables for view '%s'", view.Name)
+		}
+		for _, source := range view.Sources {
+			if !validName.MatchString(source) {
+				return fmt.Errorf("materialized views: invalid source table '%s' for view '%s'", source, view.Name)
+			}
+			if source == view.Table {
+				return fmt.Errorf("materialized views: view '%s' can't read its own table", view.Name)
+			}
+		}
+		for _, column := range view.Key {
+			if !validName.MatchString(column) {
+				return fmt.Errorf("materialized views: invalid key column '%s' for view '%s'", column, view.Name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,420 @@
+// Package matview materializes SQL views into local-only tables and refreshes
+// them whenever a commit touches their source tables, so that dashboards can
+// read precomputed results from any replica.
+package matview
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/feed"
+	"github.com/sirupsen/logrus"
+)
+
+const retryInterval = 5 * time.Second
+
+// Refresh modes
+const (
+	ModeFull        = "full"
+	ModeIncremental = "incremental"
+)
+
+// DB is the subset of the database used to refresh the views
+type DB interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+	Exec(query string, args ...any) (sql.Result, error)
+	Begin() (*sql.Tx, error)
+}
+
+// Status describes the last refresh of a view
+type Status struct {
+	Name        string        `json:"name"`
+	Table       string        `json:"table"`
+	Mode        string        `json:"mode,omitempty"`
+	Rows        int64         `json:"rows"`
+	Written     int64         `json:"written"`
+	RefreshedAt time.Time     `json:"refreshed_at,omitempty"`
+	Duration    time.Duration `json:"duration"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// Materializer keeps the tables of the views up to date
+type Materializer struct {
+	db    DB
+	feed  *feed.Feed
+	log   *logrus.Logger
+	views []View
+
+	mtx    sync.Mutex
+	status map[string]Status
+}
+
+// New creates a materializer for the views. isLocal has to report every view
+// table as local-only, otherwise the materialized rows would be replicated.
+func New(db DB, commitFeed *feed.Feed, logger *logrus.Logger, cfg *Config, isLocal func(table string) bool) (*Materializer, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	status := map[string]Status{}
+	for _, view := range cfg.Views {
+		if !isLocal(view.Table) {
+			return nil, fmt.Errorf("table '%s' of materialized view '%s' is not local-only. Add it to dolt_ignore", view.Table, view.Name)
+		}
+		status[view.Name] = Status{Name: view.Name, Table: view.Table}
+	}
+	return &Materializer{
+		db:     db,
+		feed:   commitFeed,
+		log:    logger,
+		views:  cfg.Views,
+		status: status,
+	}, nil
+}
+
+// Status returns the status of every view, in configuration order
+func (m *Materializer) Status() []Status {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	res := []Status{}
+	for _, view := range m.views {
+		res = append(res, m.status[view.Name])
+	}
+	return res
+}
+
+// affected returns the views reading any of the tables
+func affected(views []View, tables []string) []View {
+	touched := map[string]bool{}
+	for _, table := range tables {
+		touched[table] = true
+	}
+	res := []View{}
+	for _, view := range views {
+		for _, source := range view.Sources {
+			if touched[source] {
+				res = append(res, view)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// Start refreshes every view and then follows the commit feed. Events arriving
+// during a refresh are coalesced, and failed refreshes are retried. The
+// returned function stops the materializer.
+func (m *Materializer) Start() func() error {
+	sources := []string{}
+	for _, view := range m.views {
+		sources = append(sources, view.Sources...)
+	}
+	events, cancel := m.feed.Subscribe(feed.Filter{Tables: sources, Branches: []string{"main"}})
+	stopSignal := make(chan struct{})
+	go func() {
+		m.log.Infof("Starting materialized views refresher for %d views", len(m.views))
+		retry := time.NewTicker(retryInterval)
+		defer retry.Stop()
+
+		pending := map[string]bool{}
+		for _, view := range m.views {
+			pending[view.Name] = true
+		}
+		for {
+			for _, view := range m.views {
+				if !pending[view.Name] {
+					continue
+				}
+				if err := m.Refresh(view); err != nil {
+					m.log.Errorf("Failed to refresh materialized view '%s': %v", view.Name, err)
+					continue
+				}
+				delete(pending, view.Name)
+			}
+
+			select {
+			case ev := <-events:
+				tables := ev.Tables
+			drain:
+				for {
+					select {
+					case ev := <-events:
+						tables = append(tables, ev.Tables...)
+					default:
+						break drain
+					}
+				}
+				for _, view := range affected(m.views, tables) {
+					pending[view.Name] = true
+				}
+			case <-retry.C:
+			case <-stopSignal:
+				m.log.Info("Stopping materialized views refresher")
+				return
+			}
+		}
+	}()
+	stopper := func() error {
+		stopSignal <- struct{}{}
+		cancel()
+		return nil
+	}
+	return stopper
+}
+
+// Refresh recomputes a view and records the outcome in its status
+func (m *Materializer) Refresh(view View) error {
+	start := time.Now()
+	status := Status{Name: view.Name, Table: view.Table, RefreshedAt: start}
+	var err error
+	status.Mode, status.Rows, status.Written, err = m.refresh(view)
+	status.Duration = time.Since(start)
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	m.mtx.Lock()
+	if err != nil {
+		// keep the stats of the last successful refresh
+		prev := m.status[view.Name]
+		status.Mode, status.Rows, status.RefreshedAt = prev.Mode, prev.Rows, prev.RefreshedAt
+	}
+	m.status[view.Name] = status
+	m.mtx.Unlock()
+	return err
+}
+
+func (m *Materializer) refresh(view View) (mode string, rows int64, written int64, err error) {
+	exists, err := m.tableExists(view.Table)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if !exists {
+		rows, err = m.create(view)
+		return ModeFull, rows, rows, err
+	}
+	if len(view.Key) == 0 {
+		rows, err = m.replaceAll(view)
+		return ModeFull, rows, rows, err
+	}
+	rows, written, err = m.merge(view)
+	if errors.Is(err, errSchemaChanged) {
+		m.log.Infof("Columns of materialized view '%s' changed. Rebuilding table '%s'", view.Name, view.Table)
+		if _, err = m.db.Exec(fmt.Sprintf("DROP TABLE %s;", view.Table)); err != nil {
+			return "", 0, 0, err
+		}
+		rows, err = m.create(view)
+		return ModeFull, rows, rows, err
+	}
+	return ModeIncremental, rows, written, err
+}
+
+func (m *Materializer) tableExists(table string) (bool, error) {
+	var count int
+	err := m.db.QueryRow("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?;", table).Scan(&count)
+	return count > 0, err
+}
+
+func (m *Materializer) count(table string) (int64, error) {
+	var count int64
+	err := m.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s;", table)).Scan(&count)
+	return count, err
+}
+
+// create builds the table of a view from its query
+func (m *Materializer) create(view View) (int64, error) {
+	if _, err := m.db.Exec(fmt.Sprintf("CREATE TABLE %s AS %s;", view.Table, trimQuery(view.Query))); err != nil {
+		return 0, err
+	}
+	if len(view.Key) > 0 {
+		if _, err := m.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s);", view.Table, strings.Join(view.Key, ", "))); err != nil {
+			return 0, fmt.Errorf("failed to add key to materialized view: %w", err)
+		}
+	}
+	return m.count(view.Table)
+}
+
+// replaceAll replaces the rows of a view without a key in a single
+// transaction
+func (m *Materializer) replaceAll(view View) (int64, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(fmt.Sprintf("DELETE FROM %s;", view.Table))
+	if err == nil {
+		_, err = tx.Exec(fmt.Sprintf("INSERT INTO %s %s;", view.Table, trimQuery(view.Query)))
+	}
+	if err != nil {
+		return 0, errors.Join(err, tx.Rollback())
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return m.count(view.Table)
+}
+
+var errSchemaChanged = errors.New("schema changed")
+
+// merge runs the query of a view with a key and only writes the rows that
+// differ from the table
+func (m *Materializer) merge(view View) (rows int64, written int64, err error) {
+	columns, desired, err := readRows(m.db, trimQuery(view.Query))
+	if err != nil {
+		return 0, 0, err
+	}
+	keyIdx, err := keyIndexes(columns, view.Key)
+	if err != nil {
+		return 0, 0, err
+	}
+	_, current, err := readRows(m.db, fmt.Sprintf("SELECT %s FROM %s;", strings.Join(columns, ", "), view.Table))
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %v", errSchemaChanged, err)
+	}
+
+	upserts, deletes := diffRows(keyIdx, current, desired)
+	if len(upserts) == 0 && len(deletes) == 0 {
+		return int64(len(desired)), 0, nil
+	}
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	conditions := []string{}
+	for _, idx := range keyIdx {
+		conditions = append(conditions, columns[idx]+" <=> ?")
+	}
+	deleteStmt := fmt.Sprintf("DELETE FROM %s WHERE %s;", view.Table, strings.Join(conditions, " AND "))
+	for _, row := range deletes {
+		args := []any{}
+		for _, idx := range keyIdx {
+			args = append(args, value(row[idx]))
+		}
+		if _, err = tx.Exec(deleteStmt, args...); err != nil {
+			return 0, 0, errors.Join(err, tx.Rollback())
+		}
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	replaceStmt := fmt.Sprintf("REPLACE INTO %s (%s) VALUES (%s);", view.Table, strings.Join(columns, ", "), placeholders)
+	for _, row := range upserts {
+		args := []any{}
+		for _, v := range row {
+			args = append(args, value(v))
+		}
+		if _, err = tx.Exec(replaceStmt, args...); err != nil {
+			return 0, 0, errors.Join(err, tx.Rollback())
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+	return int64(len(desired)), int64(len(upserts) + len(deletes)), nil
+}
+
+func trimQuery(query string) string {
+	return strings.TrimRight(strings.TrimSpace(query), ";")
+}
+
+func value(v sql.NullString) any {
+	if !v.Valid {
+		return nil
+	}
+	return v.String
+}
+
+func readRows(db DB, query string) ([]string, [][]sql.NullString, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	res := [][]sql.NullString{}
+	for rows.Next() {
+		row := make([]sql.NullString, len(columns))
+		dest := make([]any, len(columns))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, nil, err
+		}
+		res = append(res, row)
+	}
+	return columns, res, rows.Err()
+}
+
+// keyIndexes returns the positions of the key columns in the view columns
+func keyIndexes(columns []string, key []string) ([]int, error) {
+	idx := []int{}
+	for _, k := range key {
+		found := false
+		for i, column := range columns {
+			if strings.EqualFold(column, k) {
+				idx = append(idx, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("key column '%s' is not returned by the query", k)
+		}
+	}
+	return idx, nil
+}
+
+func rowKey(keyIdx []int, row []sql.NullString) string {
+	var sb strings.Builder
+	for _, idx := range keyIdx {
+		if !row[idx].Valid {
+			sb.WriteString("-1:")
+			continue
+		}
+		fmt.Fprintf(&sb, "%d:%s", len(row[idx].String), row[idx].String)
+	}
+	return sb.String()
+}
+
+func equalRows(a []sql.NullString, b []sql.NullString) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// diffRows returns the rows of desired that are new or changed compared to
+// current, and the rows of current whose key is no longer in desired
+func diffRows(keyIdx []int, current [][]sql.NullString, desired [][]sql.NullString) (upserts [][]sql.NullString, deletes [][]sql.NullString) {
+	existing := map[string][]sql.NullString{}
+	for _, row := range current {
+		existing[rowKey(keyIdx, row)] = row
+	}
+	wanted := map[string]bool{}
+	for _, row := range desired {
+		key := rowKey(keyIdx, row)
+		wanted[key] = true
+		if prev, found := existing[key]; !found || !equalRows(prev, row) {
+			upserts = append(upserts, row)
+		}
+	}
+	for _, row := range current {
+		if !wanted[rowKey(keyIdx, row)] {
+			deletes = append(deletes, row)
+		}
+	}
+	return upserts, deletes
+}
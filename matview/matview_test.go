@@ -0,0 +1,123 @@
+package matview
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func row(values ...string) []sql.NullString {
+	res := []sql.NullString{}
+	for _, v := range values {
+		if v == "NULL" {
+			res = append(res, sql.NullString{})
+			continue
+		}
+		res = append(res, sql.NullString{String: v, Valid: true})
+	}
+	return res
+}
+
+func firstColumns(rows [][]sql.NullString) []string {
+	res := []string{}
+	for _, r := range rows {
+		res = append(res, r[0].String)
+	}
+	return res
+}
+
+func TestDiffRows(t *testing.T) {
+	current := [][]sql.NullString{
+		row("a", "1"),
+		row("b", "2"),
+		row("c", "3"),
+	}
+	desired := [][]sql.NullString{
+		row("a", "1"),
+		row("b", "20"),
+		row("d", "NULL"),
+	}
+
+	upserts, deletes := diffRows([]int{0}, current, desired)
+	if got := strings.Join(firstColumns(upserts), ","); got != "b,d" {
+		t.Errorf("expected upserts b,d, got %s", got)
+	}
+	if got := strings.Join(firstColumns(deletes), ","); got != "c" {
+		t.Errorf("expected deletes c, got %s", got)
+	}
+
+	upserts, deletes = diffRows([]int{0}, desired, desired)
+	if len(upserts) != 0 || len(deletes) != 0 {
+		t.Errorf("expected no changes, got %d upserts and %d deletes", len(upserts), len(deletes))
+	}
+}
+
+func TestRowKey(t *testing.T) {
+	// values are length prefixed so that different keys never collide
+	if rowKey([]int{0, 1}, row("ab", "c")) == rowKey([]int{0, 1}, row("a", "bc")) {
+		t.Errorf("expected different keys")
+	}
+	if rowKey([]int{0}, row("NULL")) == rowKey([]int{0}, row("")) {
+		t.Errorf("expected NULL and empty keys to differ")
+	}
+}
+
+func TestKeyIndexes(t *testing.T) {
+	idx, err := keyIndexes([]string{"region", "Day", "total"}, []string{"day", "region"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx) != 2 || idx[0] != 1 || idx[1] != 0 {
+		t.Errorf("unexpected key indexes %v", idx)
+	}
+	if _, err := keyIndexes([]string{"total"}, []string{"day"}); err == nil {
+		t.Errorf("expected an error for a missing key column")
+	}
+}
+
+func TestAffected(t *testing.T) {
+	views := []View{
+		{Name: "a", Sources: []string{"orders"}},
+		{Name: "b", Sources: []string{"customers", "orders"}},
+		{Name: "c", Sources: []string{"products"}},
+	}
+	names := []string{}
+	for _, view := range affected(views, []string{"orders", "other"}) {
+		names = append(names, view.Name)
+	}
+	if got := strings.Join(names, ","); got != "a,b" {
+		t.Errorf("expected views a,b, got %s", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := &Config{Views: []View{{Name: "daily", Query: "SELECT 1", Sources: []string{"orders"}}}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Views[0].Table != "mv_daily" {
+		t.Errorf("expected default table mv_daily, got %s", cfg.Views[0].Table)
+	}
+
+	invalid := []View{
+		{Name: "bad name", Query: "SELECT 1", Sources: []string{"orders"}},
+		{Name: "noquery", Sources: []string{"orders"}},
+		{Name: "nosources", Query: "SELECT 1"},
+		{Name: "self", Query: "SELECT 1", Sources: []string{"mv_self"}},
+		{Name: "badkey", Query: "SELECT 1", Sources: []string{"orders"}, Key: []string{"a;b"}},
+	}
+	for _, view := range invalid {
+		cfg := &Config{Views: []View{view}}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected view '%s' to be invalid", view.Name)
+		}
+	}
+
+	dup := &Config{Views: []View{
+		{Name: "a", Query: "SELECT 1", Sources: []string{"orders"}, Table: "t"},
+		{Name: "b", Query: "SELECT 1", Sources: []string{"orders"}, Table: "t"},
+	}}
+	if err := dup.Validate(); err == nil {
+		t.Errorf("expected views sharing a table to be invalid")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/localtables"
+	"github.com/nustiueudinastea/doltswarmdemo/matview"
+)
+
+const (
+	matviewsInterval = 5 * time.Second
+	matviewsFile     = "matviews.json"
+)
+
+// startMaterializedViews refreshes the materialized views on every commit
+// touching their sources, and writes their status to the working directory
+// for the matviews command
+func startMaterializedViews(cfg *matview.Config) (func() error, error) {
+	matcher := localtables.New(dbi, localTablesRefresh)
+	materializer, err := matview.New(dbi, commitFeed, log, cfg, func(table string) bool {
+		return isLocalTable(matcher, table)
+	})
+	if err != nil {
+		return nil, err
+	}
+	refresherStopper := materializer.Start()
+
+	ticker := time.NewTicker(matviewsInterval)
+	stopSignal := make(chan struct{})
+	crashReporter.Go("matviews-tracker", func() {
+		for {
+			select {
+			case <-ticker.C:
+				err := writeJSON(filepath.Join(workDir, matviewsFile), materializer.Status())
+				if err != nil {
+					log.Errorf("Failed to write materialized views status: %s", err.Error())
+				}
+			case <-stopSignal:
+				return
+			}
+		}
+	})
+	return func() error {
+		ticker.Stop()
+		close(stopSignal)
+		return refresherStopper()
+	}, nil
+}
+
+// printMaterializedViews prints the status of the materialized views of the
+// server running in the working directory
+func printMaterializedViews() error {
+	data, err := os.ReadFile(filepath.Join(workDir, matviewsFile))
+	if err != nil {
+		return fmt.Errorf("failed to read materialized views status. Is the server running with materialized views? %w", err)
+	}
+	views := []matview.Status{}
+	err = json.Unmarshal(data, &views)
+	if err != nil {
+		return fmt.Errorf("failed to parse materialized views status: %w", err)
+	}
+	for _, view := range views {
+		refreshed := "never"
+		if !view.RefreshedAt.IsZero() {
+			refreshed = fmt.Sprintf("%s (%s, %s, %d rows written)", view.RefreshedAt.Format(time.RFC3339), view.Mode, view.Duration.Round(time.Millisecond), view.Written)
+		}
+		fmt.Printf("%s -> %s: %d rows, refreshed %s\n", view.Name, view.Table, view.Rows, refreshed)
+		if view.Error != "" {
+			fmt.Printf("  last refresh failed: %s\n", view.Error)
+		}
+	}
+	return nil
+}
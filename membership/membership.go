@@ -0,0 +1,254 @@
+// Package membership keeps the authoritative member set of the cluster in a
+// replicated table. Nodes are added, retired and removed explicitly, so the
+// features that need a quorum don't infer the cluster size from whoever
+// happens to be connected.
+package membership
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Table holds the members. It is created by the first membership operation
+const Table = "swarm_members"
+
+var validPeerID = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
+// State is the membership state of a node
+type State string
+
+const (
+	// StateActive members count towards quorums
+	StateActive State = "active"
+	// StateRetiring members still sync, but no longer count towards quorums
+	StateRetiring State = "retiring"
+	// StateRemoved nodes are no longer part of the cluster
+	StateRemoved State = "removed"
+)
+
+// Op is a membership operation
+type Op string
+
+const (
+	// OpAdd makes a node an active member
+	OpAdd Op = "add"
+	// OpRetire stops counting an active member towards quorums
+	OpRetire Op = "retire"
+	// OpRemove removes a retired member from the cluster
+	OpRemove Op = "remove"
+)
+
+// Member is a node of the cluster
+type Member struct {
+	PeerID    string
+	State     State
+	UpdatedAt time.Time
+}
+
+// Set is the member set, ordered by peer ID
+type Set []Member
+
+// Managed returns true if membership operations were made. Without them the
+// member set is inferred from the connected peers.
+func (s Set) Managed() bool {
+	return len(s) > 0
+}
+
+// Get returns the member with the given peer ID
+func (s Set) Get(peerID string) (Member, bool) {
+	for _, member := range s {
+		if member.PeerID == peerID {
+			return member, true
+		}
+	}
+	return Member{}, false
+}
+
+// Voters returns the peer IDs of the active members
+func (s Set) Voters() []string {
+	voters := []string{}
+	for _, member := range s {
+		if member.State == StateActive {
+			voters = append(voters, member.PeerID)
+		}
+	}
+	return voters
+}
+
+// IsMember returns true if the node is active or retiring. Every node is a
+// member when membership is not managed.
+func (s Set) IsMember(peerID string) bool {
+	if !s.Managed() {
+		return true
+	}
+	member, found := s.Get(peerID)
+	return found && member.State != StateRemoved
+}
+
+// Transition returns the state of a node after the operation, or an error if
+// the operation is not safe. Nodes must be retired before they are removed, and
+// the last active member can't leave.
+func (s Set) Transition(op Op, peerID string) (State, error) {
+	if !validPeerID.MatchString(peerID) {
+		return "", fmt.Errorf("invalid peer ID '%s'", peerID)
+	}
+	member, found := s.Get(peerID)
+	switch op {
+	case OpAdd:
+		if found && member.State == StateActive {
+			return "", fmt.Errorf("node '%s' is already an active member", peerID)
+		}
+		return StateActive, nil
+	case OpRetire:
+		if !found || member.State != StateActive {
+			return "", fmt.Errorf("node '%s' is not an active member", peerID)
+		}
+		if len(s.Voters()) == 1 {
+			return "", fmt.Errorf("node '%s' is the last active member", peerID)
+		}
+		return StateRetiring, nil
+	case OpRemove:
+		if !found || member.State == StateRemoved {
+			return "", fmt.Errorf("node '%s' is not a member", peerID)
+		}
+		if member.State != StateRetiring {
+			return "", fmt.Errorf("node '%s' must be retired before it is removed", peerID)
+		}
+		return StateRemoved, nil
+	default:
+		return "", fmt.Errorf("unknown membership operation '%s'", op)
+	}
+}
+
+// Querier runs read queries
+type Querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// CommitFunc executes a statement and commits it, so that it is replicated to
+// every node
+type CommitFunc func(query string, commitMsg string) (string, error)
+
+// Registry reads the member set. It is cached for the refresh interval.
+type Registry struct {
+	db      Querier
+	commit  CommitFunc
+	refresh time.Duration
+
+	mtx      sync.Mutex
+	members  Set
+	loadedAt time.Time
+}
+
+// New creates a registry that reloads the member set after the refresh
+// interval. Operations are committed using the commit function.
+func New(db Querier, commit CommitFunc, refresh time.Duration) *Registry {
+	return &Registry{db: db, commit: commit, refresh: refresh}
+}
+
+// Members returns the member set
+func (r *Registry) Members() (Set, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if !r.loadedAt.IsZero() && time.Since(r.loadedAt) < r.refresh {
+		return r.members, nil
+	}
+	members, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	r.members = members
+	r.loadedAt = time.Now()
+	return members, nil
+}
+
+// Apply runs a membership operation and returns the updated member
+func (r *Registry) Apply(op Op, peerID string) (Member, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	members, err := r.load()
+	if err != nil {
+		return Member{}, err
+	}
+	state, err := members.Transition(op, peerID)
+	if err != nil {
+		return Member{}, err
+	}
+
+	member := Member{PeerID: peerID, State: state, UpdatedAt: time.Now().UTC()}
+	query := fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (peer_id VARCHAR(128) PRIMARY KEY, state VARCHAR(16) NOT NULL, updated_at DATETIME NOT NULL);\n"+
+			"REPLACE INTO %s (peer_id, state, updated_at) VALUES ('%s', '%s', '%s');",
+		Table, Table, member.PeerID, member.State, member.UpdatedAt.Format("2006-01-02 15:04:05"),
+	)
+	_, err = r.commit(query, fmt.Sprintf("Membership: %s node %s", op, peerID))
+	if err != nil {
+		return Member{}, err
+	}
+	// reload on the next read
+	r.loadedAt = time.Time{}
+	return member, nil
+}
+
+func (r *Registry) load() (Set, error) {
+	rows, err := r.db.Query(fmt.Sprintf("SELECT table_name FROM information_schema.tables WHERE table_schema = database() AND table_name = '%s';", Table))
+	if err != nil {
+		return nil, err
+	}
+	exists := rows.Next()
+	rows.Close()
+	if !exists {
+		return Set{}, nil
+	}
+
+	rows, err = r.db.Query(fmt.Sprintf("SELECT peer_id, state, updated_at FROM %s;", Table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := Set{}
+	for rows.Next() {
+		member := Member{}
+		var updatedAt any
+		err = rows.Scan(&member.PeerID, &member.State, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+		member.UpdatedAt = asTime(updatedAt)
+		members = append(members, member)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].PeerID < members[j].PeerID })
+	return members, nil
+}
+
+func asTime(v any) time.Time {
+	switch t := v.(type) {
+	case time.Time:
+		return t
+	case []byte:
+		return parseTime(string(t))
+	case string:
+		return parseTime(t)
+	default:
+		return time.Time{}
+	}
+}
+
+func parseTime(s string) time.Time {
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999", time.RFC3339Nano} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,70 @@
+package membership
+
+import "testing"
+
+func TestTransition(t *testing.T) {
+	set := Set{
+		{PeerID: "a", State: StateActive},
+		{PeerID: "b", State: StateActive},
+		{PeerID: "c", State: StateRetiring},
+		{PeerID: "d", State: StateRemoved},
+	}
+
+	tests := []struct {
+		op     Op
+		peerID string
+		want   State
+		fails  bool
+	}{
+		{OpAdd, "e", StateActive, false},
+		{OpAdd, "d", StateActive, false},
+		{OpAdd, "c", StateActive, false},
+		{OpAdd, "a", "", true},
+		{OpRetire, "a", StateRetiring, false},
+		{OpRetire, "c", "", true},
+		{OpRetire, "e", "", true},
+		{OpRemove, "c", StateRemoved, false},
+		{OpRemove, "a", "", true},
+		{OpRemove, "d", "", true},
+		{OpAdd, "a'b", "", true},
+		{Op("promote"), "a", "", true},
+	}
+
+	for _, test := range tests {
+		state, err := set.Transition(test.op, test.peerID)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s %s: expected an error", test.op, test.peerID)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %s: %v", test.op, test.peerID, err)
+			continue
+		}
+		if state != test.want {
+			t.Errorf("%s %s: got state %s, want %s", test.op, test.peerID, state, test.want)
+		}
+	}
+
+	if _, err := (Set{{PeerID: "a", State: StateActive}}).Transition(OpRetire, "a"); err == nil {
+		t.Error("expected an error when retiring the last active member")
+	}
+}
+
+func TestMembers(t *testing.T) {
+	set := Set{
+		{PeerID: "a", State: StateActive},
+		{PeerID: "b", State: StateRetiring},
+		{PeerID: "c", State: StateRemoved},
+	}
+	if voters := set.Voters(); len(voters) != 1 || voters[0] != "a" {
+		t.Errorf("unexpected voters %v", voters)
+	}
+	if !set.IsMember("a") || !set.IsMember("b") || set.IsMember("c") || set.IsMember("d") {
+		t.Error("unexpected membership")
+	}
+	if !(Set{}).IsMember("d") {
+		t.Error("every node is a member when membership is not managed")
+	}
+}
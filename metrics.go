@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"github.com/nustiueudinastea/doltswarmdemo/tsdb"
+)
+
+const metricsInterval = 10 * time.Second
+
+var metricNames = []string{"peers", "peers_out_of_sync", "commits_per_min", "peer_evictions", "quarantined", "stalled_rpcs", "dead_connections", "buffered_commits", "crashes", "backfilled_commits", "throttled_commits", "drifted_peers"}
+
+func startMetricsCollector(store *tsdb.Store) func() error {
+	log.Info("Starting metrics collector")
+	ticker := time.NewTicker(metricsInterval)
+	stopSignal := make(chan struct{})
+	crashReporter.Go("metrics-collector", func() {
+		lastCommits := -1
+		for {
+			select {
+			case <-ticker.C:
+				clients := p2pmgr.GetClients()
+				store.Record("peers", float64(len(clients)))
+				store.Record("peer_evictions", float64(p2pmgr.Evictions()))
+				store.Record("quarantined", float64(quarantineStore.Len()))
+				store.Record("stalled_rpcs", float64(rpcWatchdog.Stalls()))
+				store.Record("dead_connections", float64(p2pmgr.DeadConnections()))
+				store.Record("buffered_commits", float64(p2pmgr.BufferedCommits()))
+				store.Record("crashes", float64(crashReporter.Crashes()))
+				store.Record("backfilled_commits", float64(p2pmgr.BackfilledCommits()))
+				store.Record("throttled_commits", float64(p2pmgr.ThrottledCommits()))
+				store.Record("drifted_peers", float64(len(p2pmgr.DriftedPeers())))
+
+				commits, err := dbi.GetAllCommits()
+				if err != nil {
+					log.Errorf("failed to retrieve all commits: %s", err.Error())
+					continue
+				}
+				if lastCommits >= 0 {
+					store.Record("commits_per_min", float64(len(commits)-lastCommits)/metricsInterval.Minutes())
+				}
+				lastCommits = len(commits)
+
+				head, err := dbi.GetLastCommit("main")
+				if err != nil {
+					log.Errorf("failed to retrieve head: %s", err.Error())
+					continue
+				}
+				outOfSync := 0
+				for _, client := range clients {
+					ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+					resp, err := client.GetHead(ctx, &p2pproto.GetHeadRequest{})
+					cancel()
+					if err != nil || resp.Commit != head.Hash {
+						outOfSync++
+					}
+				}
+				store.Record("peers_out_of_sync", float64(outOfSync))
+
+				select {
+				case metricsChan <- renderMetrics(store):
+				default:
+				}
+			case <-stopSignal:
+				ticker.Stop()
+				log.Info("Stopping metrics collector")
+				return
+			}
+		}
+	})
+	stopper := func() error {
+		stopSignal <- struct{}{}
+		return nil
+	}
+	return stopper
+}
+
+// renderMetrics returns the latest value and recent trend of every metric
+func renderMetrics(store *tsdb.Store) string {
+	var sb strings.Builder
+	for _, name := range metricNames {
+		samples := store.Last(name, 30)
+		if len(samples) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "%-18s %8.2f %s\n", name, samples[len(samples)-1].Value, sparkline(samples))
+	}
+	return sb.String()
+}
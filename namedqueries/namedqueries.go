@@ -0,0 +1,355 @@
+// Package namedqueries keeps a registry of named, parameterized queries in a
+// replicated table. Clients run them by name with the values of their
+// parameters, like stored procedures, instead of sending SQL over the wire.
+package namedqueries
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/sqlstmt"
+)
+
+// Table holds the named queries. It is created by the first definition
+const Table = "swarm_named_queries"
+
+// ErrNotFound is returned when dropping a query that doesn't exist
+var ErrNotFound = errors.New("named query not found")
+
+var validName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// Query is a named query. Its parameters are written :name in the statement
+// and replaced by the quoted values given when the query is run.
+type Query struct {
+	Name        string
+	Statement   string
+	Params      []string
+	Description string
+	UpdatedAt   time.Time
+}
+
+// ReadOnly returns true if the parsed query is a SELECT without side effects.
+// A WITH clause can also start a write.
+func (q Query) ReadOnly() bool {
+	return sqlstmt.IsRead(q.Statement)
+}
+
+// Validate checks the name of the query and that it is a single statement
+// using all its parameters and no other
+func (q Query) Validate() error {
+	if !validName.MatchString(q.Name) {
+		return fmt.Errorf("invalid query name '%s'", q.Name)
+	}
+	if strings.TrimSpace(q.Statement) == "" {
+		return fmt.Errorf("query '%s' has no statement", q.Name)
+	}
+	used, err := placeholders(q.Statement)
+	if err != nil {
+		return fmt.Errorf("query '%s': %w", q.Name, err)
+	}
+	if _, err := sqlstmt.Classify(q.Statement); err != nil {
+		return fmt.Errorf("query '%s' can't be parsed: %w", q.Name, err)
+	}
+	declared := map[string]bool{}
+	for _, param := range q.Params {
+		if !validName.MatchString(param) {
+			return fmt.Errorf("query '%s' has an invalid parameter name '%s'", q.Name, param)
+		}
+		if declared[param] {
+			return fmt.Errorf("query '%s' declares parameter '%s' twice", q.Name, param)
+		}
+		declared[param] = true
+	}
+	isUsed := map[string]bool{}
+	for _, p := range used {
+		if !declared[p.name] {
+			return fmt.Errorf("query '%s' uses the undeclared parameter '%s'", q.Name, p.name)
+		}
+		isUsed[p.name] = true
+	}
+	for _, param := range q.Params {
+		if !isUsed[param] {
+			return fmt.Errorf("query '%s' doesn't use its parameter '%s'", q.Name, param)
+		}
+	}
+	return nil
+}
+
+// Bind returns the statement with the parameters replaced by the quoted
+// values. Every parameter needs a value, and unknown values are refused.
+func (q Query) Bind(values map[string]string) (string, error) {
+	declared := map[string]bool{}
+	for _, param := range q.Params {
+		declared[param] = true
+		if _, found := values[param]; !found {
+			return "", fmt.Errorf("missing value for parameter '%s'", param)
+		}
+	}
+	for name := range values {
+		if !declared[name] {
+			return "", fmt.Errorf("query '%s' has no parameter '%s'", q.Name, name)
+		}
+	}
+	used, err := placeholders(q.Statement)
+	if err != nil {
+		return "", err
+	}
+	b := strings.Builder{}
+	last := 0
+	for _, p := range used {
+		b.WriteString(q.Statement[last:p.start])
+		b.WriteString(quote(values[p.name]))
+		last = p.end
+	}
+	b.WriteString(q.Statement[last:])
+	return b.String(), nil
+}
+
+func quote(value string) string {
+	s := strings.ReplaceAll(value, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `''`)
+	return "'" + s + "'"
+}
+
+type placeholder struct {
+	name       string
+	start, end int
+}
+
+// placeholders returns the :name parameters of a statement, outside of
+// quoted strings, identifiers and comments. A statement can only end with a
+// semicolon, so that a query can't hide a second statement, and MySQL
+// executable comments are refused, since their content is run.
+func placeholders(statement string) ([]placeholder, error) {
+	found := []placeholder{}
+	var quote byte
+	for i := 0; i < len(statement); i++ {
+		c := statement[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '#' || (c == '-' && strings.HasPrefix(statement[i:], "--") && (i+2 == len(statement) || isSpace(statement[i+2]))):
+			end := strings.IndexByte(statement[i:], '\n')
+			if end < 0 {
+				return found, nil
+			}
+			i += end
+		case c == '/' && strings.HasPrefix(statement[i:], "/*"):
+			if strings.HasPrefix(statement[i:], "/*!") {
+				return nil, fmt.Errorf("executable comments are not allowed")
+			}
+			end := strings.Index(statement[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += end + 3
+		case c == ';':
+			if strings.TrimSpace(statement[i+1:]) != "" {
+				return nil, fmt.Errorf("only a single statement is allowed")
+			}
+		case c == ':' && i+1 < len(statement) && (i == 0 || statement[i-1] != ':'):
+			end := i + 1
+			for end < len(statement) && isNameByte(statement[end], end == i+1) {
+				end++
+			}
+			if end > i+1 {
+				found = append(found, placeholder{name: statement[i+1 : end], start: i, end: end})
+				i = end - 1
+			}
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote %c", quote)
+	}
+	return found, nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func isNameByte(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
+
+// Querier runs read queries
+type Querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// CommitFunc executes a statement and commits it, so that it is replicated to
+// every node
+type CommitFunc func(query string, commitMsg string) (string, error)
+
+// Registry reads the named queries. They are cached for the refresh interval.
+type Registry struct {
+	db      Querier
+	commit  CommitFunc
+	refresh time.Duration
+
+	mtx      sync.Mutex
+	queries  map[string]Query
+	loadedAt time.Time
+}
+
+// New creates a registry that reloads the queries after the refresh interval.
+// Definitions are committed using the commit function.
+func New(db Querier, commit CommitFunc, refresh time.Duration) *Registry {
+	return &Registry{db: db, commit: commit, refresh: refresh}
+}
+
+func (r *Registry) cached() (map[string]Query, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if !r.loadedAt.IsZero() && time.Since(r.loadedAt) < r.refresh {
+		return r.queries, nil
+	}
+	queries, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	r.queries = queries
+	r.loadedAt = time.Now()
+	return queries, nil
+}
+
+// Get returns the query with the given name
+func (r *Registry) Get(name string) (Query, bool, error) {
+	queries, err := r.cached()
+	if err != nil {
+		return Query{}, false, err
+	}
+	q, found := queries[name]
+	return q, found, nil
+}
+
+// List returns the queries, ordered by name
+func (r *Registry) List() ([]Query, error) {
+	queries, err := r.cached()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Query, 0, len(queries))
+	for _, q := range queries {
+		list = append(list, q)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Define creates or replaces a query
+func (r *Registry) Define(q Query) (Query, error) {
+	if q.Params == nil {
+		q.Params = []string{}
+	}
+	if err := q.Validate(); err != nil {
+		return Query{}, err
+	}
+	q.UpdatedAt = time.Now().UTC()
+	// marshalling a slice of strings can't fail
+	params, _ := json.Marshal(q.Params)
+	query := fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (name VARCHAR(64) PRIMARY KEY, statement TEXT NOT NULL, params TEXT NOT NULL, description TEXT NOT NULL, updated_at DATETIME NOT NULL);\n"+
+			"REPLACE INTO %s (name, statement, params, description, updated_at) VALUES (%s, %s, %s, %s, '%s');",
+		Table, Table, quote(q.Name), quote(q.Statement), quote(string(params)), quote(q.Description), q.UpdatedAt.Format("2006-01-02 15:04:05"),
+	)
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	_, err := r.commit(query, fmt.Sprintf("Named queries: define %s", q.Name))
+	if err != nil {
+		return Query{}, err
+	}
+	// reload on the next read
+	r.loadedAt = time.Time{}
+	return q, nil
+}
+
+// Drop removes a query
+func (r *Registry) Drop(name string) error {
+	_, found, err := r.Get(name)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	_, err = r.commit(fmt.Sprintf("DELETE FROM %s WHERE name = %s;", Table, quote(name)), fmt.Sprintf("Named queries: drop %s", name))
+	if err != nil {
+		return err
+	}
+	r.loadedAt = time.Time{}
+	return nil
+}
+
+func (r *Registry) load() (map[string]Query, error) {
+	rows, err := r.db.Query(fmt.Sprintf("SELECT table_name FROM information_schema.tables WHERE table_schema = database() AND table_name = '%s';", Table))
+	if err != nil {
+		return nil, err
+	}
+	exists := rows.Next()
+	rows.Close()
+	if !exists {
+		return map[string]Query{}, nil
+	}
+
+	rows, err = r.db.Query(fmt.Sprintf("SELECT name, statement, params, description, updated_at FROM %s;", Table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	queries := map[string]Query{}
+	for rows.Next() {
+		q := Query{}
+		var params string
+		var updatedAt any
+		err = rows.Scan(&q.Name, &q.Statement, &params, &q.Description, &updatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal([]byte(params), &q.Params); err != nil {
+			return nil, fmt.Errorf("invalid parameters of named query '%s': %w", q.Name, err)
+		}
+		q.UpdatedAt = asTime(updatedAt)
+		queries[q.Name] = q
+	}
+	return queries, rows.Err()
+}
+
+func asTime(v any) time.Time {
+	switch t := v.(type) {
+	case time.Time:
+		return t
+	case []byte:
+		return parseTime(string(t))
+	case string:
+		return parseTime(t)
+	default:
+		return time.Time{}
+	}
+}
+
+func parseTime(s string) time.Time {
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999", time.RFC3339Nano} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
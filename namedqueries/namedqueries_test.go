@@ -0,0 +1,158 @@
+package namedqueries
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		q     Query
+		fails bool
+	}{
+		{Query{Name: "orders_by_user", Statement: "SELECT * FROM orders WHERE user = :user AND created > :since", Params: []string{"user", "since"}}, false},
+		{Query{Name: "same_twice", Statement: "SELECT * FROM t WHERE a = :v OR b = :v;", Params: []string{"v"}}, false},
+		{Query{Name: "quoted", Statement: "SELECT ':not_a_param', `a:b` FROM t"}, false},
+		{Query{Name: "undeclared", Statement: "SELECT * FROM t WHERE a = :a"}, true},
+		{Query{Name: "unused", Statement: "SELECT * FROM t", Params: []string{"a"}}, true},
+		{Query{Name: "two_statements", Statement: "SELECT 1; DROP TABLE t"}, true},
+		{Query{Name: "bad name", Statement: "SELECT 1"}, true},
+		{Query{Name: "unterminated", Statement: "SELECT 'abc"}, true},
+		{Query{Name: "comments", Statement: "SELECT * FROM t -- not :a; param\nWHERE b = :b # nor :c\n/* :d; */", Params: []string{"b"}}, false},
+		{Query{Name: "executable_comment", Statement: "SELECT 1 /*!50000 ; DROP TABLE t */"}, true},
+		{Query{Name: "unterminated_comment", Statement: "SELECT 1 /* x"}, true},
+		{Query{Name: "unparsable", Statement: "SELEC * FROM t"}, true},
+	}
+	for _, test := range tests {
+		err := test.q.Validate()
+		if (err != nil) != test.fails {
+			t.Errorf("%s: expected failure %t, got %v", test.q.Name, test.fails, err)
+		}
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	reads := []string{"SELECT * FROM t WHERE a = :a", "WITH x AS (SELECT 1) SELECT * FROM x", "SELECT 1 UNION SELECT 2"}
+	for _, statement := range reads {
+		if !(Query{Statement: statement}).ReadOnly() {
+			t.Errorf("expected '%s' to be read-only", statement)
+		}
+	}
+	writes := []string{"WITH x AS (SELECT 1) DELETE FROM t", "SELECT * FROM t INTO OUTFILE '/tmp/t'", "SELECT DOLT_COMMIT('-am', 'x')", "DELETE FROM t"}
+	for _, statement := range writes {
+		if (Query{Statement: statement}).ReadOnly() {
+			t.Errorf("expected '%s' not to be read-only", statement)
+		}
+	}
+}
+
+func TestBind(t *testing.T) {
+	q := Query{Name: "by_user", Statement: "UPDATE users SET name = :name WHERE id = :id AND note <> ':id'", Params: []string{"id", "name"}}
+	if q.ReadOnly() {
+		t.Error("expected an update not to be read-only")
+	}
+	statement, err := q.Bind(map[string]string{"id": "7", "name": `O'Brien \ co`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `UPDATE users SET name = 'O''Brien \\ co' WHERE id = '7' AND note <> ':id'`
+	if statement != want {
+		t.Errorf("got %q, want %q", statement, want)
+	}
+	if _, err := q.Bind(map[string]string{"id": "7"}); err == nil {
+		t.Error("expected an error for a missing value")
+	}
+	if _, err := q.Bind(map[string]string{"id": "7", "name": "a", "admin": "1"}); err == nil {
+		t.Error("expected an error for an unknown parameter")
+	}
+}
+
+// fakeDriver serves the rows of the named queries table
+type fakeDriver struct {
+	exists bool
+	rows   [][]driver.Value
+}
+
+func (d *fakeDriver) Connect(ctx context.Context) (driver.Conn, error) { return &fakeConn{d}, nil }
+func (d *fakeDriver) Driver() driver.Driver                            { return nil }
+
+type fakeConn struct {
+	driver *fakeDriver
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if strings.Contains(query, "information_schema") {
+		if !c.driver.exists {
+			return &fakeRows{columns: []string{"table_name"}}, nil
+		}
+		return &fakeRows{columns: []string{"table_name"}, values: [][]driver.Value{{Table}}}, nil
+	}
+	return &fakeRows{columns: []string{"name", "statement", "params", "description", "updated_at"}, values: c.driver.rows}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestRegistryLoad(t *testing.T) {
+	fake := &fakeDriver{}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+	r := New(db, nil, time.Hour)
+
+	// the table is created by the first definition
+	list, err := r.List()
+	if err != nil || len(list) != 0 {
+		t.Fatalf("expected no queries without the table, got %v (%v)", list, err)
+	}
+
+	fake.exists = true
+	fake.rows = [][]driver.Value{
+		{"by_user", "SELECT * FROM t WHERE user = :user", `["user"]`, "orders of a user", "2024-03-01 10:00:00"},
+		{"all", "SELECT * FROM t", `[]`, "", []byte("2024-03-02 11:30:00")},
+	}
+	r = New(db, nil, time.Hour)
+	q, found, err := r.Get("by_user")
+	if err != nil || !found {
+		t.Fatalf("expected the query to be loaded, got %v (%v)", found, err)
+	}
+	if len(q.Params) != 1 || q.Params[0] != "user" || q.Description != "orders of a user" || !q.ReadOnly() {
+		t.Errorf("unexpected query %+v", q)
+	}
+	if want := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC); !q.UpdatedAt.Equal(want) {
+		t.Errorf("expected the update time %s, got %s", want, q.UpdatedAt)
+	}
+	list, err = r.List()
+	if err != nil || len(list) != 2 || list[0].Name != "all" {
+		t.Errorf("expected the queries ordered by name, got %v (%v)", list, err)
+	}
+
+	fake.rows = [][]driver.Value{{"broken", "SELECT 1", "not json", "", "2024-03-01 10:00:00"}}
+	if _, err := New(db, nil, time.Hour).List(); err == nil {
+		t.Error("expected an error for invalid parameters")
+	}
+}
@@ -0,0 +1,215 @@
+package p2p
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// AddrBookEntry holds everything we know about a peer we've been connected to
+type AddrBookEntry struct {
+	ID        string    `json:"id"`
+	Addrs     []string  `json:"addrs"`
+	PublicKey string    `json:"public_key,omitempty"`
+	LastSeen  time.Time `json:"last_seen"`
+	Static    bool      `json:"static"`
+}
+
+// AddrInfo returns the libp2p address info of the entry
+func (e *AddrBookEntry) AddrInfo() (peer.AddrInfo, error) {
+	id, err := peer.Decode(e.ID)
+	if err != nil {
+		return peer.AddrInfo{}, fmt.Errorf("invalid peer ID '%s': %w", e.ID, err)
+	}
+
+	info := peer.AddrInfo{ID: id}
+	for _, addr := range e.Addrs {
+		ai, err := peer.AddrInfoFromString(addr + "/p2p/" + e.ID)
+		if err != nil {
+			return peer.AddrInfo{}, fmt.Errorf("invalid address '%s' for peer '%s': %w", addr, e.ID, err)
+		}
+		info.Addrs = append(info.Addrs, ai.Addrs...)
+	}
+	return info, nil
+}
+
+// AddressBook is a file backed store of known peers. Entries that haven't been
+// seen within the TTL are expired, unless they were added as static peers.
+type AddressBook struct {
+	mtx     sync.RWMutex
+	path    string
+	ttl     time.Duration
+	entries map[string]*AddrBookEntry
+}
+
+// NewAddressBook loads the address book stored at path, creating it if needed
+func NewAddressBook(path string, ttl time.Duration) (*AddressBook, error) {
+	ab := &AddressBook{
+		path:    path,
+		ttl:     ttl,
+		entries: map[string]*AddrBookEntry{},
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ab, nil
+		}
+		return nil, fmt.Errorf("failed to read address book: %w", err)
+	}
+
+	entries := []*AddrBookEntry{}
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse address book '%s': %w", path, err)
+	}
+	for _, entry := range entries {
+		ab.entries[entry.ID] = entry
+	}
+	ab.expire()
+
+	return ab, nil
+}
+
+// expire removes all the non static entries that are older than the TTL. The
+// caller must hold the lock or have exclusive access.
+func (ab *AddressBook) expire() {
+	if ab.ttl <= 0 {
+		return
+	}
+	for id, entry := range ab.entries {
+		if !entry.Static && time.Since(entry.LastSeen) > ab.ttl {
+			delete(ab.entries, id)
+		}
+	}
+}
+
+// Prune removes the expired entries and returns how many were removed
+func (ab *AddressBook) Prune() (int, error) {
+	ab.mtx.Lock()
+	before := len(ab.entries)
+	ab.expire()
+	expired := before - len(ab.entries)
+	ab.mtx.Unlock()
+
+	if expired == 0 {
+		return 0, nil
+	}
+	return expired, ab.Save()
+}
+
+// TTL returns the remaining time to live for the entry
+func (ab *AddressBook) TTL(entry *AddrBookEntry) time.Duration {
+	if entry.Static || ab.ttl <= 0 {
+		return time.Duration(1<<63 - 1)
+	}
+	return ab.ttl - time.Since(entry.LastSeen)
+}
+
+// Entries returns a copy of all the valid entries
+func (ab *AddressBook) Entries() []AddrBookEntry {
+	ab.mtx.Lock()
+	defer ab.mtx.Unlock()
+
+	ab.expire()
+	entries := make([]AddrBookEntry, 0, len(ab.entries))
+	for _, entry := range ab.entries {
+		entries = append(entries, *entry)
+	}
+	return entries
+}
+
+// Seen records the addresses and public key of a connected peer
+func (ab *AddressBook) Seen(info peer.AddrInfo, pubKey crypto.PubKey) error {
+	ab.mtx.Lock()
+	entry, found := ab.entries[info.ID.String()]
+	if !found {
+		entry = &AddrBookEntry{ID: info.ID.String()}
+		ab.entries[entry.ID] = entry
+	}
+	entry.LastSeen = time.Now()
+	if len(info.Addrs) > 0 {
+		entry.Addrs = entry.Addrs[:0]
+		for _, addr := range info.Addrs {
+			entry.Addrs = append(entry.Addrs, addr.String())
+		}
+	}
+	if pubKey != nil {
+		mPubKey, err := crypto.MarshalPublicKey(pubKey)
+		if err == nil {
+			entry.PublicKey = base64.StdEncoding.EncodeToString(mPubKey)
+		}
+	}
+	ab.mtx.Unlock()
+
+	return ab.Save()
+}
+
+// AddStatic adds a peer that never expires. The address must include the
+// peer ID, e.g. /ip4/127.0.0.1/udp/10500/quic-v1/p2p/<id>
+func (ab *AddressBook) AddStatic(addr string) (peer.AddrInfo, error) {
+	info, err := peer.AddrInfoFromString(addr)
+	if err != nil {
+		return peer.AddrInfo{}, fmt.Errorf("invalid peer address '%s': %w", addr, err)
+	}
+
+	ab.mtx.Lock()
+	entry, found := ab.entries[info.ID.String()]
+	if !found {
+		entry = &AddrBookEntry{ID: info.ID.String(), LastSeen: time.Now()}
+		ab.entries[entry.ID] = entry
+	}
+	entry.Static = true
+	for _, a := range info.Addrs {
+		entry.Addrs = appendUnique(entry.Addrs, a.String())
+	}
+	ab.mtx.Unlock()
+
+	return *info, ab.Save()
+}
+
+// Remove deletes a peer from the address book
+func (ab *AddressBook) Remove(id string) error {
+	ab.mtx.Lock()
+	delete(ab.entries, id)
+	ab.mtx.Unlock()
+	return ab.Save()
+}
+
+// Save writes the address book to disk
+func (ab *AddressBook) Save() error {
+	ab.mtx.Lock()
+	defer ab.mtx.Unlock()
+
+	ab.expire()
+	entries := make([]*AddrBookEntry, 0, len(ab.entries))
+	for _, entry := range ab.entries {
+		entries = append(entries, entry)
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode address book: %w", err)
+	}
+
+	tmpFile := ab.path + ".tmp"
+	err = os.WriteFile(tmpFile, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write address book: %w", err)
+	}
+	return os.Rename(tmpFile, ab.path)
+}
+
+func appendUnique(list []string, item string) []string {
+	for _, existing := range list {
+		if existing == item {
+			return list
+		}
+	}
+	return append(list, item)
+}
@@ -0,0 +1,67 @@
+package p2p
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func newTestPeerID(t *testing.T) peer.ID {
+	prvKey, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(prvKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestAddressBookPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "addrbook.json")
+	addrBook, err := NewAddressBook(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	staticID := newTestPeerID(t)
+	_, err = addrBook.AddStatic("/ip4/127.0.0.1/udp/10501/quic-v1/p2p/" + staticID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiredID := newTestPeerID(t)
+	err = addrBook.Seen(peer.AddrInfo{ID: expiredID}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrBook.entries[expiredID.String()].LastSeen = time.Now().Add(-2 * time.Hour)
+	err = addrBook.Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewAddressBook(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := reloaded.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	if entries[0].ID != staticID.String() || !entries[0].Static {
+		t.Errorf("expected static entry for %s, got %+v", staticID, entries[0])
+	}
+
+	info, err := entries[0].AddrInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Addrs) != 1 || info.Addrs[0].String() != "/ip4/127.0.0.1/udp/10501/quic-v1" {
+		t.Errorf("unexpected addresses: %v", info.Addrs)
+	}
+}
@@ -0,0 +1,16 @@
+package p2p
+
+import "strings"
+
+// adminServicePrefix is the prefix of the methods of the Admin service
+const adminServicePrefix = "/proto.Admin/"
+
+// allowAdmin only lets the admins call the Admin service, which can restart
+// the node, deploy plugins or change the membership. The other services are
+// authorized by their own checks.
+func (p2p *P2P) allowAdmin(peerID string, method string) bool {
+	if !strings.HasPrefix(method, adminServicePrefix) {
+		return true
+	}
+	return peerID != "" && p2p.admins != nil && p2p.admins(peerID)
+}
@@ -0,0 +1,21 @@
+package p2p
+
+import "testing"
+
+func TestAllowAdmin(t *testing.T) {
+	p2p := &P2P{}
+	if !p2p.allowAdmin("peer", "/proto.Tester/Query") {
+		t.Fatal("expected the other services to be left to their own checks")
+	}
+	if p2p.allowAdmin("peer", "/proto.Admin/Restart") {
+		t.Fatal("expected the Admin service to be refused without admins")
+	}
+
+	p2p.admins = func(peerID string) bool { return peerID == "admin" }
+	if !p2p.allowAdmin("admin", "/proto.Admin/Restart") {
+		t.Fatal("expected the admin to call the Admin service")
+	}
+	if p2p.allowAdmin("peer", "/proto.Admin/DeployPlugin") || p2p.allowAdmin("", "/proto.Admin/DeployPlugin") {
+		t.Fatal("expected the other peers to be refused")
+	}
+}
@@ -0,0 +1,317 @@
+package p2p
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	swarmproto "github.com/nustiueudinastea/doltswarm/proto"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"google.golang.org/grpc"
+)
+
+const (
+	AnnouncementSent     = "sent"
+	AnnouncementReceived = "received"
+
+	announcementRecoveryInterval = 30 * time.Second
+	announcementRecoveryTimeout  = time.Minute
+)
+
+// Announcement is a head announced to or by a peer
+type Announcement struct {
+	Time time.Time `json:"time"`
+	// Direction is either sent or received
+	Direction string `json:"direction"`
+	Peer      string `json:"peer"`
+	Head      string `json:"head"`
+	// Err is set if the announcement failed to be delivered or handled
+	Err string `json:"error,omitempty"`
+}
+
+// AnnouncementLog is a file backed history of the heads announced to and by
+// peers. Announcements older than the retention are pruned.
+type AnnouncementLog struct {
+	mtx           sync.Mutex
+	path          string
+	retention     time.Duration
+	file          *os.File
+	announcements []Announcement
+}
+
+// ReadAnnouncements returns the announcements recorded in the file at path
+func ReadAnnouncements(path string) ([]Announcement, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	announcements := []Announcement{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		a := Announcement{}
+		// a line can be truncated if the node crashed while writing it
+		if json.Unmarshal(scanner.Bytes(), &a) != nil {
+			continue
+		}
+		announcements = append(announcements, a)
+	}
+	return announcements, scanner.Err()
+}
+
+// NewAnnouncementLog loads the announcement log stored at path, creating it if
+// needed
+func NewAnnouncementLog(path string, retention time.Duration) (*AnnouncementLog, error) {
+	announcements, err := ReadAnnouncements(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read announcement log: %w", err)
+	}
+	l := &AnnouncementLog{path: path, retention: retention, announcements: announcements}
+	_, err = l.Prune()
+	if err != nil {
+		return nil, err
+	}
+	if l.file == nil {
+		l.file, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open announcement log: %w", err)
+		}
+	}
+	return l, nil
+}
+
+// Record appends an announcement to the log
+func (l *AnnouncementLog) Record(a Announcement) error {
+	if a.Time.IsZero() {
+		a.Time = time.Now()
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.announcements = append(l.announcements, a)
+	_, err = l.file.Write(append(data, '\n'))
+	return err
+}
+
+// Prune removes the announcements older than the retention and returns how
+// many were removed
+func (l *AnnouncementLog) Prune() (int, error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	cutoff := time.Now().Add(-l.retention)
+	kept := []Announcement{}
+	for _, a := range l.announcements {
+		if a.Time.After(cutoff) {
+			kept = append(kept, a)
+		}
+	}
+	pruned := len(l.announcements) - len(kept)
+	if pruned == 0 {
+		return 0, nil
+	}
+	l.announcements = kept
+
+	// the kept announcements are written to a new file which replaces the log
+	tmp := l.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune announcement log: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	for _, a := range kept {
+		data, err := json.Marshal(a)
+		if err != nil {
+			f.Close()
+			return 0, err
+		}
+		w.Write(append(data, '\n'))
+	}
+	err = w.Flush()
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune announcement log: %w", err)
+	}
+	err = os.Rename(tmp, l.path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune announcement log: %w", err)
+	}
+
+	if l.file != nil {
+		l.file.Close()
+	}
+	l.file, err = os.OpenFile(l.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reopen announcement log: %w", err)
+	}
+	return pruned, nil
+}
+
+// Announcements returns the recorded announcements, oldest first
+func (l *AnnouncementLog) Announcements() []Announcement {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return append([]Announcement{}, l.announcements...)
+}
+
+// Close closes the log file
+func (l *AnnouncementLog) Close() error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.file.Close()
+}
+
+func (p2p *P2P) recordAnnouncement(direction string, peerID string, req any, err error) {
+	advertise, ok := req.(*swarmproto.AdvertiseHeadRequest)
+	if !ok {
+		return
+	}
+	a := Announcement{Direction: direction, Peer: peerID, Head: advertise.Head}
+	if err != nil {
+		a.Err = err.Error()
+	}
+	if recordErr := p2p.announced.Record(a); recordErr != nil {
+		p2p.log.Errorf("Failed to record announcement of head %s: %v", advertise.Head, recordErr)
+	}
+}
+
+// announcementServerInterceptor records the heads announced by peers
+func (p2p *P2P) announcementServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	resp, err := handler(ctx, req)
+	p2p.recordAnnouncement(AnnouncementReceived, remotePeerID(ctx), req, err)
+	return resp, err
+}
+
+// announcementClientInterceptor records the heads announced to a peer
+func (p2p *P2P) announcementClientInterceptor(id peer.ID) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		p2p.recordAnnouncement(AnnouncementSent, id.String(), req, err)
+		return err
+	}
+}
+
+// pendingAnnouncements returns the last received announcement of every head
+// that is not in the local history
+func pendingAnnouncements(announcements []Announcement, known map[string]bool) []Announcement {
+	pending := []Announcement{}
+	seen := map[string]bool{}
+	for i := len(announcements) - 1; i >= 0; i-- {
+		a := announcements[i]
+		if a.Direction != AnnouncementReceived || known[a.Head] || seen[a.Head] {
+			continue
+		}
+		seen[a.Head] = true
+		pending = append(pending, a)
+	}
+	return pending
+}
+
+// recoverAnnouncement asks a peer to announce its head again, preferably the
+// peer the head was announced by, and waits until the head is applied
+func (p2p *P2P) recoverAnnouncement(a Announcement) error {
+	clients := []*P2PClient{}
+	if c, found := p2p.clients.Get(a.Peer); found {
+		clients = append(clients, c.(*P2PClient))
+	}
+	for _, c := range p2p.clients.Items() {
+		if client := c.(*P2PClient); client.GetID() != a.Peer {
+			clients = append(clients, client)
+		}
+	}
+
+	head, err := p2p.externalDB.GetLastCommit("main")
+	if err != nil {
+		return err
+	}
+	for _, client := range clients {
+		if !client.Supports(p2pproto.Tester_Missed_FullMethodName) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), announcementRecoveryTimeout)
+		resp, err := client.Missed(ctx, &p2pproto.MissedRequest{
+			Frontier:  []string{head.Hash},
+			SinceUnix: head.Date.Unix(),
+			Replay:    true,
+		})
+		if err == nil && len(resp.Commits) == 0 {
+			err = fmt.Errorf("no missed commits")
+		}
+		if err == nil {
+			err = p2p.waitForCommit(ctx, a.Head)
+		}
+		cancel()
+		if err == nil {
+			p2p.log.Infof("Recovered head %s announced by %s from %s", a.Head, a.Peer, client.GetID())
+			return nil
+		}
+	}
+	return fmt.Errorf("no connected peer could announce head %s again", a.Head)
+}
+
+// recoverAnnouncements retries the heads that were announced to us but never
+// applied, e.g. because the node restarted while pulling them, until they are
+// all applied or expire from the log
+func (p2p *P2P) recoverAnnouncements() func() error {
+	stopSignal := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(announcementRecoveryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-stopSignal:
+				return
+			}
+			if p2p.syncPaused() {
+				continue
+			}
+
+			commits, err := p2p.externalDB.GetAllCommits()
+			if err != nil {
+				p2p.log.Warnf("Failed to read commits to recover announcements: %v", err)
+				continue
+			}
+			known := map[string]bool{}
+			for _, commit := range commits {
+				known[commit.Hash] = true
+			}
+			pending := pendingAnnouncements(p2p.announced.Announcements(), known)
+			if len(pending) == 0 {
+				return
+			}
+			if len(p2p.clients.Items()) == 0 {
+				continue
+			}
+			// applying the most recent head usually applies the older ones too,
+			// so they are checked again at the next tick
+			err = p2p.recoverAnnouncement(pending[0])
+			if err != nil {
+				p2p.log.Debugf("Failed to recover announced head %s: %v", pending[0].Head, err)
+			}
+		}
+	}()
+	return func() error {
+		select {
+		case <-stopSignal:
+		default:
+			close(stopSignal)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,71 @@
+package p2p
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAnnouncementLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "announcements.jsonl")
+	l, err := NewAnnouncementLog(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := Announcement{Time: time.Now().Add(-2 * time.Hour), Direction: AnnouncementReceived, Peer: "a", Head: "h1"}
+	recent := Announcement{Direction: AnnouncementSent, Peer: "b", Head: "h2", Err: "unavailable"}
+	for _, a := range []Announcement{old, recent} {
+		if err := l.Record(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a line truncated by a crash is skipped
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"time": "2024`)
+	f.Close()
+
+	l, err = NewAnnouncementLog(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	announcements := l.Announcements()
+	if len(announcements) != 1 || announcements[0].Head != "h2" || announcements[0].Err != "unavailable" {
+		t.Fatalf("expected only the recent announcement to be kept, got %+v", announcements)
+	}
+	if err := l.Record(Announcement{Direction: AnnouncementReceived, Peer: "c", Head: "h3"}); err != nil {
+		t.Fatal(err)
+	}
+	onDisk, err := ReadAnnouncements(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(onDisk) != 2 || onDisk[1].Head != "h3" {
+		t.Errorf("expected the pruned log to be rewritten and appended to, got %+v", onDisk)
+	}
+}
+
+func TestPendingAnnouncements(t *testing.T) {
+	announcements := []Announcement{
+		{Direction: AnnouncementReceived, Peer: "a", Head: "h1"},
+		{Direction: AnnouncementReceived, Peer: "b", Head: "h2"},
+		{Direction: AnnouncementSent, Peer: "b", Head: "h3"},
+		{Direction: AnnouncementReceived, Peer: "c", Head: "h2"},
+		{Direction: AnnouncementReceived, Peer: "a", Head: "h4"},
+	}
+	pending := pendingAnnouncements(announcements, map[string]bool{"h1": true})
+	if len(pending) != 2 {
+		t.Fatalf("expected 2 pending heads, got %+v", pending)
+	}
+	if pending[0].Head != "h4" || pending[1].Head != "h2" || pending[1].Peer != "c" {
+		t.Errorf("expected the latest announcement of every missing head, newest first, got %+v", pending)
+	}
+}
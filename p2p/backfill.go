@@ -0,0 +1,85 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	swarmproto "github.com/nustiueudinastea/doltswarm/proto"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+const backfillTimeout = time.Minute
+
+// Announce announces a head to a connected peer through its DB syncer
+func (p2p *P2P) Announce(ctx context.Context, peerID string, head string) error {
+	c, found := p2p.clients.Get(peerID)
+	if !found {
+		return fmt.Errorf("peer '%s' is not connected", peerID)
+	}
+	_, err := c.(*P2PClient).syncer.AdvertiseHead(ctx, &swarmproto.AdvertiseHeadRequest{Head: head})
+	return err
+}
+
+// BackfilledCommits returns the number of missed commits recovered from peers
+// after a reconnection
+func (p2p *P2P) BackfilledCommits() int64 {
+	return p2p.backfilled.Load()
+}
+
+// backfill asks a peer that just connected for the commits announced while we
+// were not connected. The peer announces its head again, which goes through
+// the normal announcement handler, and we wait until the missed commits are
+// applied locally.
+func (p2p *P2P) backfill(client *P2PClient) {
+	if !client.Supports(p2pproto.Tester_Missed_FullMethodName) || p2p.syncPaused() {
+		return
+	}
+	head, err := p2p.externalDB.GetLastCommit("main")
+	if err != nil {
+		p2p.log.Warnf("Failed to read head before backfilling from %s: %v", client.GetID(), err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), backfillTimeout)
+	defer cancel()
+	resp, err := client.Missed(ctx, &p2pproto.MissedRequest{
+		Frontier:  []string{head.Hash},
+		SinceUnix: head.Date.Unix(),
+		Replay:    true,
+	})
+	if err != nil {
+		p2p.log.Warnf("Failed to backfill missed commits from %s: %v", client.GetID(), err)
+		return
+	}
+	if len(resp.Commits) == 0 {
+		return
+	}
+	if resp.Truncated {
+		p2p.log.Warnf("Peer %s only returned the %d most recent missed commits", client.GetID(), len(resp.Commits))
+	}
+
+	last := resp.Commits[len(resp.Commits)-1].Hash
+	err = p2p.waitForCommit(ctx, last)
+	if err != nil {
+		p2p.log.Warnf("Missed commits announced again by %s were not applied: %v", client.GetID(), err)
+		return
+	}
+	p2p.backfilled.Add(int64(len(resp.Commits)))
+	p2p.log.Infof("Backfilled %d missed commits from %s", len(resp.Commits), client.GetID())
+}
+
+// AntiEntropy recovers the commits missed from every connected peer, and
+// compares our tables with theirs when drift checks are enabled, on top of the
+// recovery done when a peer reconnects. It returns the number of recovered
+// commits.
+func (p2p *P2P) AntiEntropy() int64 {
+	before := p2p.backfilled.Load()
+	for _, client := range p2p.GetClients() {
+		p2p.backfill(client)
+	}
+	if p2p.drift != nil {
+		p2p.drift.check()
+	}
+	return p2p.backfilled.Load() - before
+}
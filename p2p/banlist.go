@@ -0,0 +1,246 @@
+package p2p
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/control"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const banReloadInterval = 2 * time.Second
+
+// BanEntry is a peer that is not allowed to connect
+type BanEntry struct {
+	ID     string    `json:"id"`
+	Reason string    `json:"reason,omitempty"`
+	Since  time.Time `json:"since"`
+	// Until is the end of the ban. Zero means the ban is permanent.
+	Until time.Time `json:"until,omitempty"`
+}
+
+// Active returns true if the ban has not expired
+func (e BanEntry) Active() bool {
+	return e.Until.IsZero() || time.Now().Before(e.Until)
+}
+
+// BanList is a file backed list of banned peers. The file can be changed by
+// another process, e.g. the peers ban command, and is reloaded when it is.
+type BanList struct {
+	mtx     sync.RWMutex
+	path    string
+	modTime time.Time
+	entries map[string]BanEntry
+}
+
+// NewBanList loads the ban list stored at path, creating it if needed
+func NewBanList(path string) (*BanList, error) {
+	bl := &BanList{path: path, entries: map[string]BanEntry{}}
+	_, err := bl.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return bl, nil
+}
+
+// Reload reads the file again if it changed since it was last read, and
+// returns true if it did
+func (bl *BanList) Reload() (bool, error) {
+	info, err := os.Stat(bl.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to read ban list: %w", err)
+	}
+
+	bl.mtx.Lock()
+	defer bl.mtx.Unlock()
+	if info.ModTime().Equal(bl.modTime) {
+		return false, nil
+	}
+	data, err := os.ReadFile(bl.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read ban list: %w", err)
+	}
+	entries := []BanEntry{}
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse ban list '%s': %w", bl.path, err)
+	}
+	bl.entries = map[string]BanEntry{}
+	for _, entry := range entries {
+		bl.entries[entry.ID] = entry
+	}
+	bl.modTime = info.ModTime()
+	return true, nil
+}
+
+// save writes the active entries to the file. The caller must hold the lock.
+func (bl *BanList) save() error {
+	entries := []BanEntry{}
+	for _, entry := range bl.entries {
+		if entry.Active() {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(bl.path+".tmp", data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to save ban list: %w", err)
+	}
+	err = os.Rename(bl.path+".tmp", bl.path)
+	if err != nil {
+		return fmt.Errorf("failed to save ban list: %w", err)
+	}
+	if info, err := os.Stat(bl.path); err == nil {
+		bl.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// Ban bans a peer for the given duration, or permanently if it's 0
+func (bl *BanList) Ban(id string, reason string, duration time.Duration) (BanEntry, error) {
+	if _, err := peer.Decode(id); err != nil {
+		return BanEntry{}, fmt.Errorf("invalid peer ID '%s': %w", id, err)
+	}
+	if duration < 0 {
+		return BanEntry{}, fmt.Errorf("ban duration can't be negative")
+	}
+	entry := BanEntry{ID: id, Reason: reason, Since: time.Now()}
+	if duration > 0 {
+		entry.Until = entry.Since.Add(duration)
+	}
+
+	bl.mtx.Lock()
+	defer bl.mtx.Unlock()
+	bl.entries[id] = entry
+	return entry, bl.save()
+}
+
+// Unban lifts the ban of a peer and returns false if it was not banned
+func (bl *BanList) Unban(id string) (bool, error) {
+	bl.mtx.Lock()
+	defer bl.mtx.Unlock()
+	entry, found := bl.entries[id]
+	if !found {
+		return false, nil
+	}
+	delete(bl.entries, id)
+	return entry.Active(), bl.save()
+}
+
+// Banned returns true if the peer has an active ban
+func (bl *BanList) Banned(id string) bool {
+	bl.mtx.RLock()
+	defer bl.mtx.RUnlock()
+	entry, found := bl.entries[id]
+	return found && entry.Active()
+}
+
+// Entries returns the active bans
+func (bl *BanList) Entries() []BanEntry {
+	bl.mtx.RLock()
+	defer bl.mtx.RUnlock()
+	entries := []BanEntry{}
+	for _, entry := range bl.entries {
+		if entry.Active() {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries
+}
+
+// banGater refuses the connections of banned peers. Incoming connections are
+// refused as soon as the handshake reveals the identity of the peer.
+type banGater struct {
+	bans *BanList
+}
+
+func (g *banGater) InterceptPeerDial(p peer.ID) bool {
+	return !g.bans.Banned(p.String())
+}
+
+func (g *banGater) InterceptAddrDial(p peer.ID, _ ma.Multiaddr) bool {
+	return !g.bans.Banned(p.String())
+}
+
+func (g *banGater) InterceptAccept(network.ConnMultiaddrs) bool {
+	return true
+}
+
+func (g *banGater) InterceptSecured(_ network.Direction, p peer.ID, _ network.ConnMultiaddrs) bool {
+	return !g.bans.Banned(p.String())
+}
+
+func (g *banGater) InterceptUpgraded(conn network.Conn) (bool, control.DisconnectReason) {
+	return !g.bans.Banned(conn.RemotePeer().String()), 0
+}
+
+// banInterceptors reject the calls of banned peers that are still connected
+func (p2p *P2P) banInterceptors() (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	unary := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if p2p.bans.Banned(remotePeerID(ctx)) {
+			return nil, status.Errorf(codes.PermissionDenied, "peer is banned")
+		}
+		return handler(ctx, req)
+	}
+	stream := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if p2p.bans.Banned(remotePeerID(ss.Context())) {
+			return status.Errorf(codes.PermissionDenied, "peer is banned")
+		}
+		return handler(srv, ss)
+	}
+	return unary, stream
+}
+
+// enforceBans reloads the ban list when it changes and disconnects the
+// connected peers that were banned
+func (p2p *P2P) enforceBans() func() error {
+	stopSignal := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(banReloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-stopSignal:
+				return
+			}
+			_, err := p2p.bans.Reload()
+			if err != nil {
+				p2p.log.Errorf("Failed to reload ban list: %v", err)
+				continue
+			}
+			for _, id := range p2p.host.Network().Peers() {
+				if !p2p.bans.Banned(id.String()) {
+					continue
+				}
+				p2p.log.Warnf("Disconnecting banned peer %s", id.String())
+				err := p2p.host.Network().ClosePeer(id)
+				if err != nil {
+					p2p.log.Errorf("Failed to disconnect banned peer %s: %v", id.String(), err)
+				}
+			}
+		}
+	}()
+	return func() error {
+		close(stopSignal)
+		return nil
+	}
+}
@@ -0,0 +1,70 @@
+package p2p
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBanList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "banlist.json")
+	bans, err := NewBanList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	permanent := newTestPeerID(t)
+	temporary := newTestPeerID(t)
+	expired := newTestPeerID(t)
+	if _, err := bans.Ban(permanent.String(), "spam", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bans.Ban(temporary.String(), "", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bans.Ban(expired.String(), "", time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bans.Ban("not-a-peer", "", 0); err == nil {
+		t.Errorf("expected an error for an invalid peer ID")
+	}
+	time.Sleep(time.Millisecond)
+
+	gater := &banGater{bans: bans}
+	if gater.InterceptPeerDial(permanent) || gater.InterceptPeerDial(temporary) {
+		t.Errorf("expected dials to banned peers to be refused")
+	}
+	if !gater.InterceptPeerDial(expired) {
+		t.Errorf("expected expired bans to be lifted")
+	}
+
+	// the list is shared with other processes through the file
+	other, err := NewBanList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(other.Entries()) != 2 || !other.Banned(permanent.String()) {
+		t.Fatalf("expected the active bans to be persisted, got %+v", other.Entries())
+	}
+	found, err := other.Unban(permanent.String())
+	if err != nil || !found {
+		t.Fatalf("expected the peer to be unbanned, got %t %v", found, err)
+	}
+
+	// make sure the modification time changes on coarse filesystems
+	future := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := bans.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || bans.Banned(permanent.String()) || !bans.Banned(temporary.String()) {
+		t.Errorf("expected the reloaded list to only ban %s", temporary)
+	}
+	if changed, _ := bans.Reload(); changed {
+		t.Errorf("expected an unchanged file not to be reloaded")
+	}
+}
@@ -0,0 +1,66 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	p2pgrpc "github.com/birros/go-libp2p-grpc"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/libp2p/go-libp2p/p2p/security/noise"
+	quic "github.com/libp2p/go-libp2p/p2p/transport/quic"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// DialCluster connects to a peer of another cluster, e.g. for a federation
+// bridge. A dedicated libp2p host is used so that the remote peer never joins
+// the local cluster: its database is not synced with ours and it can't reach
+// the local peers. The host uses the node identity, so the remote cluster can
+// authorize the bridge like any other peer. The returned function closes the
+// connection.
+func (p2p *P2P) DialCluster(addr string) (p2pproto.TesterClient, func() error, error) {
+	info, err := peer.AddrInfoFromString(addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid remote address '%s': %w", addr, err)
+	}
+
+	h, err := libp2p.New(
+		libp2p.Identity(p2p.prvKey),
+		libp2p.NoListenAddrs,
+		libp2p.Security(noise.ID, noise.New),
+		libp2p.Transport(quic.NewTransport),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to setup bridge host: %w", err)
+	}
+
+	// the peer is dialed on the first RPC, and dialed again if the connection
+	// is lost
+	h.Peerstore().AddAddrs(info.ID, info.Addrs, peerstore.PermanentAddrTTL)
+
+	conn, err := grpc.Dial(
+		info.ID.String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			stream, err := h.NewStream(ctx, info.ID, supportedProtocols...)
+			if err != nil {
+				return nil, err
+			}
+			return &p2pgrpc.Conn{Stream: stream}, nil
+		}),
+	)
+	if err != nil {
+		h.Close()
+		return nil, nil, err
+	}
+
+	closer := func() error {
+		conn.Close()
+		return h.Close()
+	}
+	return p2pproto.NewTesterClient(conn), closer, nil
+}
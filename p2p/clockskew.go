@@ -0,0 +1,113 @@
+package p2p
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+const defaultClockSkewThreshold = time.Second
+
+// ClockSkew is the last clock offset measured with a peer
+type ClockSkew struct {
+	// Offset is how far the clock of the peer is ahead of ours. It is negative
+	// if the peer is behind.
+	Offset time.Duration `json:"offset_ns"`
+	// RTT is the round trip time of the ping. The offset is only accurate to
+	// half of it.
+	RTT        time.Duration `json:"rtt_ns"`
+	MeasuredAt time.Time     `json:"measured_at"`
+}
+
+// Exceeds returns true if the offset is above the threshold, after accounting
+// for the uncertainty of the measurement
+func (s ClockSkew) Exceeds(threshold time.Duration) bool {
+	offset := s.Offset
+	if offset < 0 {
+		offset = -offset
+	}
+	return offset-s.RTT/2 > threshold
+}
+
+// measureSkew estimates the clock offset of a peer from a ping sent and
+// answered at the given local times, assuming the answer was sent half way
+// through. It returns false if the peer didn't send its time.
+func measureSkew(sent time.Time, received time.Time, remoteUnixNano int64) (ClockSkew, bool) {
+	if remoteUnixNano == 0 {
+		return ClockSkew{}, false
+	}
+	rtt := received.Sub(sent)
+	midpoint := sent.Add(rtt / 2)
+	return ClockSkew{Offset: time.Unix(0, remoteUnixNano).Sub(midpoint), RTT: rtt, MeasuredAt: received}, true
+}
+
+// clockSkews keeps the clock skew of every peer. Commits are dated with the
+// clock of the node that makes them, so a skewed peer makes its writes look
+// newer or older than they are.
+type clockSkews struct {
+	p2p *P2P
+	// threshold above which a peer is reported. 0 disables the reports.
+	threshold time.Duration
+
+	mtx    sync.Mutex
+	peers  map[string]ClockSkew
+	skewed map[string]bool
+}
+
+func newClockSkews(p2p *P2P, threshold time.Duration) *clockSkews {
+	return &clockSkews{p2p: p2p, threshold: threshold, peers: map[string]ClockSkew{}, skewed: map[string]bool{}}
+}
+
+// record saves a measurement and reports the peers whose skew goes over or
+// back under the threshold
+func (c *clockSkews) record(id string, skew ClockSkew) {
+	c.mtx.Lock()
+	c.peers[id] = skew
+	wasSkewed := c.skewed[id]
+	isSkewed := c.threshold > 0 && skew.Exceeds(c.threshold)
+	c.skewed[id] = isSkewed
+	c.mtx.Unlock()
+
+	switch {
+	case isSkewed && !wasSkewed:
+		c.p2p.log.Warnf("Clock of peer %s is off by %s (threshold %s). Its commit times are unreliable", id, skew.Offset, c.threshold)
+		c.p2p.events.publish(Event{Type: EventClockSkewExceeded, PeerID: id, Skew: skew.Offset})
+	case !isSkewed && wasSkewed:
+		c.p2p.log.Infof("Clock of peer %s is back within %s", id, c.threshold)
+		c.p2p.events.publish(Event{Type: EventClockSkewResolved, PeerID: id, Skew: skew.Offset})
+	}
+}
+
+func (c *clockSkews) forget(id string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	delete(c.peers, id)
+	delete(c.skewed, id)
+}
+
+// ping pings a peer and records its clock skew
+func (p2p *P2P) ping(ctx context.Context, client *P2PClient, req *p2pproto.PingRequest) (*p2pproto.PingResponse, error) {
+	sent := time.Now()
+	req.TimeUnixNano = sent.UnixNano()
+	resp, err := client.Ping(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if skew, ok := measureSkew(sent, time.Now(), resp.TimeUnixNano); ok {
+		p2p.skews.record(client.GetID(), skew)
+	}
+	return resp, nil
+}
+
+// ClockSkews returns the last clock skew measured with every connected peer
+func (p2p *P2P) ClockSkews() map[string]ClockSkew {
+	p2p.skews.mtx.Lock()
+	defer p2p.skews.mtx.Unlock()
+	res := map[string]ClockSkew{}
+	for id, skew := range p2p.skews.peers {
+		res[id] = skew
+	}
+	return res
+}
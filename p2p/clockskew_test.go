@@ -0,0 +1,28 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMeasureSkew(t *testing.T) {
+	sent := time.Now()
+	received := sent.Add(100 * time.Millisecond)
+
+	skew, ok := measureSkew(sent, received, sent.Add(2*time.Second).UnixNano())
+	if !ok || skew.Offset != 1950*time.Millisecond || skew.RTT != 100*time.Millisecond {
+		t.Fatalf("unexpected skew %+v", skew)
+	}
+	if !skew.Exceeds(time.Second) || skew.Exceeds(1900*time.Millisecond) {
+		t.Errorf("expected the threshold to account for half the round trip")
+	}
+
+	skew, _ = measureSkew(sent, received, sent.Add(-2*time.Second).UnixNano())
+	if skew.Offset != -2050*time.Millisecond || !skew.Exceeds(time.Second) {
+		t.Errorf("expected a peer behind us to have a negative offset, got %+v", skew)
+	}
+
+	if _, ok := measureSkew(sent, received, 0); ok {
+		t.Errorf("expected no measurement from peers that don't send their time")
+	}
+}
@@ -0,0 +1,205 @@
+package p2p
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+const (
+	// appliedRetention is how long the time a commit was applied is kept for
+	// traces
+	appliedRetention = 24 * time.Hour
+	traceTimeout     = 10 * time.Second
+)
+
+// CommitTrace tells if and when a node applied a commit
+type CommitTrace struct {
+	Node      string `json:"node"`
+	Local     bool   `json:"local,omitempty"`
+	HasCommit bool   `json:"has_commit"`
+	// Head is the head of main on the node
+	Head string `json:"head,omitempty"`
+	// AppliedAt is zero if unknown, e.g. because the commit was applied
+	// before the node started
+	AppliedAt time.Time `json:"applied_at,omitempty"`
+	// Announcements of the commit as a head, recorded if the node keeps an
+	// announcement log
+	Announcements []Announcement `json:"announcements,omitempty"`
+	// Err is set if the node could not be traced
+	Err string `json:"error,omitempty"`
+}
+
+// Proto converts the trace for the Trace and Admin services
+func (t CommitTrace) Proto() *p2pproto.CommitTrace {
+	res := &p2pproto.CommitTrace{Node: t.Node, HasCommit: t.HasCommit, Head: t.Head, Error: t.Err}
+	if !t.AppliedAt.IsZero() {
+		res.AppliedUnixMs = t.AppliedAt.UnixMilli()
+	}
+	for _, a := range t.Announcements {
+		res.Announcements = append(res.Announcements, &p2pproto.TracedAnnouncement{
+			TimeUnixMs: a.Time.UnixMilli(),
+			Direction:  a.Direction,
+			Peer:       a.Peer,
+			Error:      a.Err,
+		})
+	}
+	return res
+}
+
+func commitTraceFromProto(res *p2pproto.CommitTrace) CommitTrace {
+	t := CommitTrace{Node: res.Node, HasCommit: res.HasCommit, Head: res.Head, Err: res.Error}
+	if res.AppliedUnixMs != 0 {
+		t.AppliedAt = time.UnixMilli(res.AppliedUnixMs)
+	}
+	for _, a := range res.Announcements {
+		t.Announcements = append(t.Announcements, Announcement{
+			Time:      time.UnixMilli(a.TimeUnixMs),
+			Direction: a.Direction,
+			Peer:      a.Peer,
+			Err:       a.Error,
+		})
+	}
+	return t
+}
+
+// appliedCommits keeps when the commits of the last retention period were
+// first seen in the local history
+type appliedCommits struct {
+	mtx     sync.Mutex
+	applied map[string]time.Time
+}
+
+func (a *appliedCommits) record(hash string, at time.Time) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if a.applied == nil {
+		a.applied = map[string]time.Time{}
+	}
+	if _, found := a.applied[hash]; found {
+		return
+	}
+	a.applied[hash] = at
+	cutoff := at.Add(-appliedRetention)
+	for h, t := range a.applied {
+		if t.Before(cutoff) {
+			delete(a.applied, h)
+		}
+	}
+}
+
+func (a *appliedCommits) get(hash string) time.Time {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	return a.applied[hash]
+}
+
+// RecordApplied records when a commit was first seen in the local history, so
+// that traces can tell when it was applied
+func (p2p *P2P) RecordApplied(hash string, at time.Time) {
+	p2p.applied.record(hash, at)
+}
+
+// localTrace returns if and when the node applied a commit
+func (p2p *P2P) localTrace(hash string) CommitTrace {
+	trace := CommitTrace{Node: p2p.GetID(), Local: true}
+	commits, err := p2p.externalDB.GetAllCommits()
+	if err != nil {
+		trace.Err = err.Error()
+		return trace
+	}
+	for _, commit := range commits {
+		if commit.Hash == hash {
+			trace.HasCommit = true
+			break
+		}
+	}
+	if head, err := p2p.externalDB.GetLastCommit("main"); err == nil {
+		trace.Head = head.Hash
+	}
+	if trace.HasCommit {
+		trace.AppliedAt = p2p.applied.get(hash)
+	}
+	if p2p.announced != nil {
+		for _, a := range p2p.announced.Announcements() {
+			if a.Head == hash {
+				trace.Announcements = append(trace.Announcements, a)
+			}
+		}
+	}
+	return trace
+}
+
+// TraceCommit asks the node and all its peers if and when they applied a
+// commit. The traces are sorted by the time the commit was applied, followed
+// by the nodes that don't have it and the ones that could not be traced.
+func (p2p *P2P) TraceCommit(ctx context.Context, hash string) []CommitTrace {
+	traces := []CommitTrace{p2p.localTrace(hash)}
+	mtx := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for _, client := range p2p.GetClients() {
+		wg.Add(1)
+		go func(client *P2PClient) {
+			defer wg.Done()
+			trace := CommitTrace{Node: client.GetID()}
+			if client.Supports(p2pproto.Trace_GetCommitTrace_FullMethodName) {
+				traceCtx, cancel := context.WithTimeout(ctx, traceTimeout)
+				res, err := client.GetCommitTrace(traceCtx, &p2pproto.TraceCommitRequest{Commit: hash})
+				cancel()
+				if err == nil {
+					trace = commitTraceFromProto(res)
+				} else {
+					trace.Err = err.Error()
+				}
+			} else {
+				trace.Err = "peer doesn't support commit traces"
+			}
+			mtx.Lock()
+			traces = append(traces, trace)
+			mtx.Unlock()
+		}(client)
+	}
+	wg.Wait()
+	sortTraces(traces)
+	return traces
+}
+
+func traceRank(t CommitTrace) int {
+	switch {
+	case t.Err != "":
+		return 3
+	case !t.HasCommit:
+		return 2
+	case t.AppliedAt.IsZero():
+		return 1
+	default:
+		return 0
+	}
+}
+
+// sortTraces orders the traces into a propagation timeline
+func sortTraces(traces []CommitTrace) {
+	sort.SliceStable(traces, func(i, j int) bool {
+		ri, rj := traceRank(traces[i]), traceRank(traces[j])
+		if ri != rj {
+			return ri < rj
+		}
+		if ri == 0 && !traces[i].AppliedAt.Equal(traces[j].AppliedAt) {
+			return traces[i].AppliedAt.Before(traces[j].AppliedAt)
+		}
+		return traces[i].Node < traces[j].Node
+	})
+}
+
+// traceServer serves the Trace service
+type traceServer struct {
+	p2pproto.UnimplementedTraceServer
+	p2p *P2P
+}
+
+func (s *traceServer) GetCommitTrace(ctx context.Context, req *p2pproto.TraceCommitRequest) (*p2pproto.CommitTrace, error) {
+	return s.p2p.localTrace(req.Commit).Proto(), nil
+}
@@ -0,0 +1,51 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSortTraces(t *testing.T) {
+	now := time.Now()
+	traces := []CommitTrace{
+		{Node: "unreachable", Err: "timeout"},
+		{Node: "missing"},
+		{Node: "late", HasCommit: true, AppliedAt: now.Add(time.Second)},
+		{Node: "unknown", HasCommit: true},
+		{Node: "first", HasCommit: true, AppliedAt: now},
+	}
+	sortTraces(traces)
+	expected := []string{"first", "late", "unknown", "missing", "unreachable"}
+	for i, node := range expected {
+		if traces[i].Node != node {
+			t.Fatalf("expected %v, got %+v", expected, traces)
+		}
+	}
+
+	// traces survive the round trip through the Trace service
+	trace := CommitTrace{Node: "a", HasCommit: true, Head: "h", AppliedAt: time.UnixMilli(now.UnixMilli()), Announcements: []Announcement{
+		{Time: time.UnixMilli(now.UnixMilli()), Direction: AnnouncementReceived, Peer: "b"},
+	}}
+	got := commitTraceFromProto(trace.Proto())
+	if !got.AppliedAt.Equal(trace.AppliedAt) || len(got.Announcements) != 1 || got.Announcements[0].Peer != "b" {
+		t.Errorf("unexpected trace %+v", got)
+	}
+	if !commitTraceFromProto((CommitTrace{Node: "a"}).Proto()).AppliedAt.IsZero() {
+		t.Error("expected an unknown time to stay unknown")
+	}
+}
+
+func TestAppliedCommits(t *testing.T) {
+	a := &appliedCommits{}
+	start := time.Now()
+	a.record("c1", start)
+	// the first time a commit was seen is kept
+	a.record("c1", start.Add(time.Minute))
+	if !a.get("c1").Equal(start) {
+		t.Errorf("expected the first time to be kept, got %s", a.get("c1"))
+	}
+	a.record("c2", start.Add(appliedRetention+time.Minute))
+	if !a.get("c1").IsZero() || a.get("c2").IsZero() {
+		t.Error("expected commits older than the retention to be forgotten")
+	}
+}
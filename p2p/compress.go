@@ -0,0 +1,79 @@
+package p2p
+
+import (
+	"context"
+	"sync"
+
+	p2pgrpc "github.com/birros/go-libp2p-grpc"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/nustiueudinastea/doltswarmdemo/p2p/compression"
+	"google.golang.org/grpc"
+)
+
+// compressionState keeps the compressor negotiated with every peer
+type compressionState struct {
+	enabled   []string
+	threshold int
+
+	mtx   sync.RWMutex
+	peers map[string]string
+}
+
+func (c *compressionState) set(peerID string, name string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if name == "" {
+		delete(c.peers, peerID)
+		return
+	}
+	c.peers[peerID] = name
+}
+
+func (c *compressionState) get(peerID string) string {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.peers[peerID]
+}
+
+// compressors returns the compressors offered to peers during the handshake
+func (p2p *P2P) compressors() []string {
+	if p2p.compression == nil {
+		return nil
+	}
+	return p2p.compression.enabled
+}
+
+// Compressor returns the compressor negotiated with a peer, or an empty string
+// if the messages exchanged with the peer are not compressed
+func (p2p *P2P) Compressor(peerID string) string {
+	if p2p.compression == nil {
+		return ""
+	}
+	return p2p.compression.get(peerID)
+}
+
+// NegotiateCompression implements p2psrv.CompressionNegotiator. It picks the
+// first compressor offered by the peer that is enabled locally.
+func (p2p *P2P) NegotiateCompression(peerID string, offered []string) string {
+	if p2p.compression == nil {
+		return ""
+	}
+	name := compression.Negotiate(offered, p2p.compression.enabled)
+	p2p.compression.set(peerID, name)
+	return name
+}
+
+// compressionInterceptors returns the client interceptors compressing the
+// calls to a peer, which also carry the chunks fetched by the DB syncer
+func (p2p *P2P) compressionInterceptors(id peer.ID) (grpc.UnaryClientInterceptor, grpc.StreamClientInterceptor) {
+	return compression.UnaryClientInterceptor(id.String(), p2p.Compressor, p2p.compression.threshold),
+		compression.StreamClientInterceptor(id.String(), p2p.Compressor)
+}
+
+func remotePeerID(ctx context.Context) string {
+	id, ok := p2pgrpc.RemotePeerFromContext(ctx)
+	if !ok {
+		return ""
+	}
+	return id.String()
+}
@@ -0,0 +1,124 @@
+// Package compression registers the gRPC compressors negotiated between peers
+// and provides the interceptors that apply them. Messages under a size
+// threshold are sent uncompressed, since compressing them costs more CPU than
+// it saves bandwidth.
+package compression
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/encoding"
+)
+
+const (
+	// Zstd compresses better and is suited to slow WAN links
+	Zstd = "zstd"
+	// Snappy is faster but compresses less
+	Snappy = "snappy"
+)
+
+// Supported lists the available compressors, in order of preference
+var Supported = []string{Zstd, Snappy}
+
+func init() {
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		panic(err)
+	}
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		panic(err)
+	}
+	encoding.RegisterCompressor(&zstdCompressor{encoder: encoder, decoder: decoder})
+	encoding.RegisterCompressor(snappyCompressor{})
+}
+
+// Parse validates a list of compressor names
+func Parse(names []string) ([]string, error) {
+	for _, name := range names {
+		if !contains(Supported, name) {
+			return nil, fmt.Errorf("unknown compressor '%s', expected one of %v", name, Supported)
+		}
+	}
+	return names, nil
+}
+
+// Negotiate returns the first compressor offered by the caller that is also
+// enabled locally, or an empty string if there is none
+func Negotiate(offered []string, enabled []string) string {
+	for _, name := range offered {
+		if contains(enabled, name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// zstdCompressor buffers the message and compresses it in one go with shared
+// encoders, which are safe for concurrent use with EncodeAll and DecodeAll
+type zstdCompressor struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func (c *zstdCompressor) Name() string {
+	return Zstd
+}
+
+func (c *zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return &zstdWriter{w: w, encoder: c.encoder}, nil
+}
+
+func (c *zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	out, err := c.decoder.DecodeAll(data, nil)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(out), nil
+}
+
+type zstdWriter struct {
+	w       io.Writer
+	encoder *zstd.Encoder
+	buf     bytes.Buffer
+}
+
+func (zw *zstdWriter) Write(p []byte) (int, error) {
+	return zw.buf.Write(p)
+}
+
+func (zw *zstdWriter) Close() error {
+	_, err := zw.w.Write(zw.encoder.EncodeAll(zw.buf.Bytes(), nil))
+	return err
+}
+
+type snappyCompressor struct{}
+
+func (snappyCompressor) Name() string {
+	return Snappy
+}
+
+func (snappyCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return snappy.NewBufferedWriter(w), nil
+}
+
+func (snappyCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return snappy.NewReader(r), nil
+}
+
+func contains(list []string, item string) bool {
+	for _, i := range list {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package compression
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/encoding"
+)
+
+func TestRoundTrip(t *testing.T) {
+	msg := []byte(strings.Repeat("doltswarm ", 1000))
+	for _, name := range Supported {
+		c := encoding.GetCompressor(name)
+		if c == nil {
+			t.Fatalf("%s is not registered", name)
+		}
+
+		var buf bytes.Buffer
+		w, err := c.Compress(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() >= len(msg) {
+			t.Errorf("%s: expected the message to shrink, got %d bytes", name, buf.Len())
+		}
+
+		r, err := c.Decompress(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(out, msg) {
+			t.Errorf("%s: round trip changed the message", name)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	if got := Negotiate([]string{Snappy, Zstd}, []string{Zstd, Snappy}); got != Snappy {
+		t.Errorf("expected the caller's preference, got '%s'", got)
+	}
+	if got := Negotiate([]string{Zstd}, []string{Snappy}); got != "" {
+		t.Errorf("expected no compressor, got '%s'", got)
+	}
+	if got := Negotiate(nil, Supported); got != "" {
+		t.Errorf("expected no compressor for peers that predate compression, got '%s'", got)
+	}
+	if _, err := Parse([]string{"gzip2"}); err == nil {
+		t.Error("expected an error for an unknown compressor")
+	}
+}
@@ -0,0 +1,63 @@
+package compression
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// Lookup returns the compressor negotiated with a peer, or an empty string if
+// messages to the peer aren't compressed
+type Lookup func(peerID string) string
+
+func size(msg any) int {
+	if m, ok := msg.(proto.Message); ok {
+		return proto.Size(m)
+	}
+	return 0
+}
+
+// UnaryClientInterceptor compresses the requests to a peer that are at least
+// threshold bytes long
+func UnaryClientInterceptor(peerID string, lookup Lookup, threshold int) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if name := lookup(peerID); name != "" && size(req) >= threshold {
+			opts = append(opts, grpc.UseCompressor(name))
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor compresses all the messages of the streams opened to
+// a peer. Streams carry bulk transfers, so the size of the individual messages
+// isn't checked.
+func StreamClientInterceptor(peerID string, lookup Lookup) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if name := lookup(peerID); name != "" {
+			opts = append(opts, grpc.UseCompressor(name))
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// ServerInterceptors compress the responses sent to the peers that negotiated
+// a compressor. remotePeer returns the ID of the calling peer.
+func ServerInterceptors(remotePeer func(ctx context.Context) string, lookup Lookup, threshold int) (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	unary := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		resp, err := handler(ctx, req)
+		if err == nil {
+			if name := lookup(remotePeer(ctx)); name != "" && size(resp) >= threshold {
+				_ = grpc.SetSendCompressor(ctx, name)
+			}
+		}
+		return resp, err
+	}
+	stream := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if name := lookup(remotePeer(ss.Context())); name != "" {
+			_ = grpc.SetSendCompressor(ss.Context(), name)
+		}
+		return handler(srv, ss)
+	}
+	return unary, stream
+}
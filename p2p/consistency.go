@@ -0,0 +1,92 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/membership"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const defaultAckTimeout = 30 * time.Second
+
+// requiredAcks returns how many peers, out of nrPeers, need to acknowledge a
+// commit for the given consistency level.
+func requiredAcks(consistency p2pproto.Consistency, nrPeers int) int {
+	switch consistency {
+	case p2pproto.Consistency_CONSISTENCY_QUORUM:
+		return (nrPeers + 1) / 2
+	case p2pproto.Consistency_CONSISTENCY_ALL:
+		return nrPeers
+	default:
+		return 0
+	}
+}
+
+// WaitForAcks implements p2psrv.Replicator. It blocks until enough peers have
+// applied the commit to satisfy the consistency level, or until the context
+// expires.
+func (p2p *P2P) WaitForAcks(ctx context.Context, commit string, consistency p2pproto.Consistency) error {
+	// writes to local-only tables don't create a commit
+	if commit == "" {
+		return nil
+	}
+	// peers running an older version can't acknowledge commits
+	members := p2p.members()
+	clients := []*P2PClient{}
+	for _, client := range p2p.GetClients() {
+		if members.Managed() {
+			if member, _ := members.Get(client.GetID()); member.State != membership.StateActive {
+				continue
+			}
+		}
+		if client.Supports(p2pproto.Tester_AckCommit_FullMethodName) {
+			clients = append(clients, client)
+		}
+	}
+	// with managed membership, the quorum is computed over the active members
+	// even if some of them are not connected
+	nrPeers := len(clients)
+	if members.Managed() {
+		nrPeers = p2p.voters(members)
+	}
+	required := requiredAcks(consistency, nrPeers)
+	if required == 0 {
+		return nil
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultAckTimeout)
+		defer cancel()
+	}
+
+	acks := make(chan error, len(clients))
+	for _, client := range clients {
+		go func(client *P2PClient) {
+			resp, err := client.AckCommit(ctx, &p2pproto.AckCommitRequest{Commit: commit})
+			if err == nil && !resp.Applied {
+				err = fmt.Errorf("commit not applied before deadline")
+			}
+			if err != nil {
+				p2p.log.Debugf("Peer '%s' did not acknowledge commit '%s': %v", client.GetID(), commit, err)
+			}
+			acks <- err
+		}(client)
+	}
+
+	received := 0
+	for i := 0; i < len(clients); i++ {
+		if err := <-acks; err == nil {
+			received++
+		}
+		if received >= required {
+			return nil
+		}
+	}
+
+	return status.Errorf(codes.DeadlineExceeded, "commit %s acknowledged by %d peers, %s requires %d", commit, received, consistency, required)
+}
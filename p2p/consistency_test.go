@@ -0,0 +1,29 @@
+package p2p
+
+import (
+	"testing"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+func TestRequiredAcks(t *testing.T) {
+	tests := []struct {
+		consistency p2pproto.Consistency
+		nrPeers     int
+		expected    int
+	}{
+		{p2pproto.Consistency_CONSISTENCY_LOCAL, 4, 0},
+		{p2pproto.Consistency_CONSISTENCY_QUORUM, 0, 0},
+		{p2pproto.Consistency_CONSISTENCY_QUORUM, 1, 1},
+		{p2pproto.Consistency_CONSISTENCY_QUORUM, 4, 2},
+		{p2pproto.Consistency_CONSISTENCY_QUORUM, 5, 3},
+		{p2pproto.Consistency_CONSISTENCY_ALL, 5, 5},
+	}
+
+	for _, test := range tests {
+		required := requiredAcks(test.consistency, test.nrPeers)
+		if required != test.expected {
+			t.Errorf("%s with %d peers: expected %d acks, got %d", test.consistency, test.nrPeers, test.expected, required)
+		}
+	}
+}
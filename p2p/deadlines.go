@@ -0,0 +1,91 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DeadlineStats counts the calls served after their caller stopped waiting.
+// gRPC sends the remaining time of the caller with every call, and the
+// context of the handler is cancelled once it's over.
+type DeadlineStats struct {
+	// CallTimeout is the deadline of the calls made without one, if any
+	CallTimeout time.Duration `json:"call_timeout"`
+	// Expired calls arrived after their deadline and were not handled
+	Expired int64 `json:"expired"`
+	// Abandoned calls were handled past their deadline, and their response
+	// was discarded
+	Abandoned int64 `json:"abandoned"`
+}
+
+type deadlines struct {
+	callTimeout time.Duration
+	expired     atomic.Int64
+	abandoned   atomic.Int64
+}
+
+// DeadlineStats returns the counts of the calls served past their deadline
+func (p2p *P2P) DeadlineStats() DeadlineStats {
+	return DeadlineStats{
+		CallTimeout: p2p.deadlines.callTimeout,
+		Expired:     p2p.deadlines.expired.Load(),
+		Abandoned:   p2p.deadlines.abandoned.Load(),
+	}
+}
+
+// checkExpired returns an error if the deadline of the call passed before it's
+// handled
+func (d *deadlines) checkExpired(ctx context.Context) error {
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Now().Before(deadline) {
+		return nil
+	}
+	d.expired.Add(1)
+	return status.Error(codes.DeadlineExceeded, "the deadline of the call passed before it was handled")
+}
+
+func (d *deadlines) checkAbandoned(ctx context.Context) {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		d.abandoned.Add(1)
+	}
+}
+
+// deadlineInterceptors refuse the calls whose deadline passed before they
+// are handled, e.g. while they were queued, and count the calls whose handler
+// outlived their deadline
+func (p2p *P2P) deadlineInterceptors() (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	unary := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := p2p.deadlines.checkExpired(ctx); err != nil {
+			return nil, err
+		}
+		resp, err := handler(ctx, req)
+		p2p.deadlines.checkAbandoned(ctx)
+		return resp, err
+	}
+	stream := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := p2p.deadlines.checkExpired(ss.Context()); err != nil {
+			return err
+		}
+		err := handler(srv, ss)
+		p2p.deadlines.checkAbandoned(ss.Context())
+		return err
+	}
+	return unary, stream
+}
+
+// callTimeoutInterceptor gives the unary calls made without a deadline the
+// default one, which is sent to the peer along with the call
+func (p2p *P2P) callTimeoutInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if _, ok := ctx.Deadline(); ok || p2p.deadlines.callTimeout <= 0 {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	ctx, cancel := context.WithTimeout(ctx, p2p.deadlines.callTimeout)
+	defer cancel()
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
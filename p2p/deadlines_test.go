@@ -0,0 +1,63 @@
+package p2p
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDeadlineInterceptors(t *testing.T) {
+	p2p := &P2P{deadlines: &deadlines{}}
+	unary, _ := p2p.deadlineInterceptors()
+	info := &grpc.UnaryServerInfo{FullMethod: "/test"}
+
+	handled := 0
+	handler := func(ctx context.Context, req any) (any, error) {
+		handled++
+		<-ctx.Done()
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+
+	// calls that arrive after their deadline are not handled
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if _, err := unary(expired, nil, info, handler); status.Code(err) != codes.DeadlineExceeded || handled != 0 {
+		t.Errorf("expected the expired call to be refused, got %v", err)
+	}
+
+	// handlers see the deadline of the caller
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := unary(ctx, nil, info, handler); status.Code(err) != codes.DeadlineExceeded || handled != 1 {
+		t.Errorf("expected the handler to be cancelled, got %v", err)
+	}
+	if stats := p2p.DeadlineStats(); stats.Expired != 1 || stats.Abandoned != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCallTimeoutInterceptor(t *testing.T) {
+	p2p := &P2P{deadlines: &deadlines{callTimeout: time.Minute}}
+	var deadline time.Time
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		deadline, _ = ctx.Deadline()
+		return nil
+	}
+
+	p2p.callTimeoutInterceptor(context.Background(), "/test", nil, nil, nil, invoker)
+	if remaining := time.Until(deadline); remaining <= 0 || remaining > time.Minute {
+		t.Errorf("expected the default deadline, got %s", remaining)
+	}
+
+	// the deadline of the caller is kept
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	p2p.callTimeoutInterceptor(ctx, "/test", nil, nil, nil, invoker)
+	if remaining := time.Until(deadline); remaining < time.Minute {
+		t.Errorf("expected the deadline of the caller, got %s", remaining)
+	}
+}
@@ -0,0 +1,95 @@
+package p2p
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
+)
+
+const (
+	mdnsServiceName      = "protos"
+	staticRedialInterval = 30 * time.Second
+)
+
+// Discovery finds peers and reports them using the found callback. Start
+// returns a function that stops the discovery.
+type Discovery interface {
+	Name() string
+	Start(h host.Host, found func(peer.AddrInfo)) (func() error, error)
+}
+
+type notifee func(peer.AddrInfo)
+
+func (n notifee) HandlePeerFound(pi peer.AddrInfo) {
+	n(pi)
+}
+
+// MDNSDiscovery finds peers on the local network using multicast DNS
+type MDNSDiscovery struct{}
+
+func (d *MDNSDiscovery) Name() string {
+	return "mdns"
+}
+
+func (d *MDNSDiscovery) Start(h host.Host, found func(peer.AddrInfo)) (func() error, error) {
+	service := mdns.NewMdnsService(h, mdnsServiceName, notifee(found))
+	if err := service.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start mdns: %w", err)
+	}
+	return service.Close, nil
+}
+
+// StaticDiscovery connects to a fixed list of peers. Addresses have to include
+// the peer ID and can use DNS names, e.g.
+// /dns4/node-0.doltswarm/udp/10500/quic-v1/p2p/<id>. Peers that are not
+// connected are periodically dialed again, so restarted peers are picked up.
+type StaticDiscovery struct {
+	peers []peer.AddrInfo
+}
+
+// NewStaticDiscovery parses the peer addresses
+func NewStaticDiscovery(addrs []string) (*StaticDiscovery, error) {
+	d := &StaticDiscovery{}
+	for _, addr := range addrs {
+		info, err := peer.AddrInfoFromString(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid static peer '%s': %w", addr, err)
+		}
+		d.peers = append(d.peers, *info)
+	}
+	return d, nil
+}
+
+func (d *StaticDiscovery) Name() string {
+	return "static"
+}
+
+func (d *StaticDiscovery) Start(h host.Host, found func(peer.AddrInfo)) (func() error, error) {
+	stopSignal := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(staticRedialInterval)
+		defer ticker.Stop()
+		for {
+			for _, info := range d.peers {
+				if info.ID == h.ID() || h.Network().Connectedness(info.ID) == network.Connected {
+					continue
+				}
+				found(info)
+			}
+			select {
+			case <-ticker.C:
+			case <-stopSignal:
+				return
+			}
+		}
+	}()
+	stopper := func() error {
+		close(stopSignal)
+		return nil
+	}
+	return stopper, nil
+}
@@ -0,0 +1,266 @@
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// PeerIDAnnotation is set by every node on its own pod so that other nodes
+	// can dial it
+	PeerIDAnnotation = "doltswarm.io/peer-id"
+
+	k8sServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	k8sPollInterval      = 10 * time.Second
+	k8sRequestTimeout    = 10 * time.Second
+)
+
+// KubernetesConfig selects the pods that run the other nodes. Either a
+// Service, whose selector is used, or a label selector has to be set.
+type KubernetesConfig struct {
+	Namespace string
+	Service   string
+	Selector  string
+	// Port is the UDP port the nodes listen on
+	Port int
+}
+
+// KubernetesDiscovery finds peers by listing the ready pods selected by a
+// Service or a label selector, using the in-cluster service account. Every
+// node publishes its peer ID as an annotation on its own pod, which requires
+// the get, list and patch permissions on pods. POD_NAME has to be set using
+// the downward API.
+type KubernetesDiscovery struct {
+	cfg     KubernetesConfig
+	baseURL string
+	token   string
+	client  *http.Client
+	podName string
+	log     *logrus.Logger
+}
+
+type k8sPod struct {
+	Metadata struct {
+		Name        string            `json:"name"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	Status struct {
+		PodIP      string `json:"podIP"`
+		Conditions []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+func (p *k8sPod) ready() bool {
+	for _, condition := range p.Status.Conditions {
+		if condition.Type == "Ready" {
+			return condition.Status == "True"
+		}
+	}
+	return false
+}
+
+// NewKubernetesDiscovery loads the in-cluster configuration
+func NewKubernetesDiscovery(cfg KubernetesConfig, logger *logrus.Logger) (*KubernetesDiscovery, error) {
+	if cfg.Service == "" && cfg.Selector == "" {
+		return nil, fmt.Errorf("kubernetes discovery requires a service or a label selector")
+	}
+
+	apiHost, apiPort := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if apiHost == "" || apiPort == "" {
+		return nil, fmt.Errorf("kubernetes discovery only works inside a cluster")
+	}
+	token, err := os.ReadFile(k8sServiceAccountDir + "/token")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token: %w", err)
+	}
+	caCert, err := os.ReadFile(k8sServiceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cluster CA: %w", err)
+	}
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("invalid cluster CA")
+	}
+	if cfg.Namespace == "" {
+		namespace, err := os.ReadFile(k8sServiceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read namespace: %w", err)
+		}
+		cfg.Namespace = strings.TrimSpace(string(namespace))
+	}
+
+	return &KubernetesDiscovery{
+		cfg:     cfg,
+		baseURL: "https://" + apiHost + ":" + apiPort,
+		token:   strings.TrimSpace(string(token)),
+		client: &http.Client{
+			Timeout:   k8sRequestTimeout,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: caPool}},
+		},
+		podName: os.Getenv("POD_NAME"),
+		log:     logger,
+	}, nil
+}
+
+func (d *KubernetesDiscovery) Name() string {
+	return "kubernetes"
+}
+
+func (d *KubernetesDiscovery) request(ctx context.Context, method string, path string, contentType string, body []byte, result any) error {
+	req, err := http.NewRequestWithContext(ctx, method, d.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+d.token)
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s failed with %s: %s", method, path, resp.Status, string(msg))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// publishPeerID annotates our own pod with the peer ID
+func (d *KubernetesDiscovery) publishPeerID(ctx context.Context, id peer.ID) error {
+	if d.podName == "" {
+		return fmt.Errorf("POD_NAME is not set")
+	}
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]string{PeerIDAnnotation: id.String()},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s", url.PathEscape(d.cfg.Namespace), url.PathEscape(d.podName))
+	return d.request(ctx, http.MethodPatch, path, "application/merge-patch+json", patch, nil)
+}
+
+// selector returns the label selector of the pods, resolving the service
+// selector if needed
+func (d *KubernetesDiscovery) selector(ctx context.Context) (string, error) {
+	if d.cfg.Selector != "" {
+		return d.cfg.Selector, nil
+	}
+
+	service := struct {
+		Spec struct {
+			Selector map[string]string `json:"selector"`
+		} `json:"spec"`
+	}{}
+	path := fmt.Sprintf("/api/v1/namespaces/%s/services/%s", url.PathEscape(d.cfg.Namespace), url.PathEscape(d.cfg.Service))
+	err := d.request(ctx, http.MethodGet, path, "", nil, &service)
+	if err != nil {
+		return "", err
+	}
+	if len(service.Spec.Selector) == 0 {
+		return "", fmt.Errorf("service '%s' has no selector", d.cfg.Service)
+	}
+	labels := []string{}
+	for k, v := range service.Spec.Selector {
+		labels = append(labels, k+"="+v)
+	}
+	return strings.Join(labels, ","), nil
+}
+
+// peers returns the address info of all the ready pods that published a peer ID
+func (d *KubernetesDiscovery) peers(ctx context.Context) ([]peer.AddrInfo, error) {
+	selector, err := d.selector(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pods := struct {
+		Items []k8sPod `json:"items"`
+	}{}
+	path := fmt.Sprintf("/api/v1/namespaces/%s/pods?labelSelector=%s", url.PathEscape(d.cfg.Namespace), url.QueryEscape(selector))
+	err = d.request(ctx, http.MethodGet, path, "", nil, &pods)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := []peer.AddrInfo{}
+	for _, pod := range pods.Items {
+		peerID := pod.Metadata.Annotations[PeerIDAnnotation]
+		if peerID == "" || pod.Status.PodIP == "" || !pod.ready() {
+			continue
+		}
+		info, err := peer.AddrInfoFromString(fmt.Sprintf("/ip4/%s/udp/%d/quic-v1/p2p/%s", pod.Status.PodIP, d.cfg.Port, peerID))
+		if err != nil {
+			d.log.Warnf("Ignoring pod '%s' with invalid peer address: %v", pod.Metadata.Name, err)
+			continue
+		}
+		infos = append(infos, *info)
+	}
+	return infos, nil
+}
+
+func (d *KubernetesDiscovery) Start(h host.Host, found func(peer.AddrInfo)) (func() error, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	err := d.publishPeerID(ctx, h.ID())
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to publish peer ID: %w", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(k8sPollInterval)
+		defer ticker.Stop()
+		for {
+			infos, err := d.peers(ctx)
+			if err != nil {
+				d.log.Errorf("Failed to list peer pods: %v", err)
+			} else {
+				for _, info := range infos {
+					if info.ID == h.ID() || h.Network().Connectedness(info.ID) == network.Connected {
+						continue
+					}
+					// pods get a new IP when they are rescheduled
+					h.Peerstore().ClearAddrs(info.ID)
+					found(info)
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	stopper := func() error {
+		cancel()
+		return nil
+	}
+	return stopper, nil
+}
@@ -0,0 +1,190 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const defaultDiskCheckInterval = 30 * time.Second
+
+// ErrDiskFull is returned for the writes refused while the data directory is
+// low on free space
+var ErrDiskFull = status.Error(codes.ResourceExhausted, "not enough free disk space, the node is read-only")
+
+// DiskGuardConfig sets the free space of the data directory below which the
+// node becomes read-only. A threshold of 0 is ignored.
+type DiskGuardConfig struct {
+	Dir            string
+	MinFreePercent float64
+	MinFreeBytes   uint64
+	CheckInterval  time.Duration
+	// OnChange is optional. It is called when the node becomes read-only and
+	// when it accepts writes again.
+	OnChange func(readOnly bool, usage DiskUsage)
+}
+
+// DiskUsage is the free space of the data directory at the last check
+type DiskUsage struct {
+	FreeBytes   uint64    `json:"free_bytes"`
+	FreePercent float64   `json:"free_percent"`
+	ReadOnly    bool      `json:"read_only"`
+	CheckedAt   time.Time `json:"checked_at"`
+}
+
+// DiskGuard watches the free space of the data directory. Running out of disk
+// in the middle of a write can corrupt the chunk store, so while the space is
+// low the node refuses writes and stops applying the heads announced by peers.
+// Reads keep working.
+type DiskGuard struct {
+	cfg   DiskGuardConfig
+	usage func(dir string) (uint64, float64, error)
+
+	readOnly atomic.Bool
+	mtx      sync.Mutex
+	last     DiskUsage
+}
+
+// NewDiskGuard creates a guard for the data directory. The free space is only
+// checked once the guard is started.
+func NewDiskGuard(cfg DiskGuardConfig) (*DiskGuard, error) {
+	if cfg.MinFreePercent < 0 || cfg.MinFreePercent > 100 {
+		return nil, fmt.Errorf("minimum free disk percent has to be between 0 and 100")
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = defaultDiskCheckInterval
+	}
+	return &DiskGuard{cfg: cfg, usage: diskUsage}, nil
+}
+
+// diskUsage returns the free space of the disk holding dir, in bytes and in
+// percent, as available to unprivileged users
+func diskUsage(dir string) (uint64, float64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(dir, &stat)
+	if err != nil {
+		return 0, 0, err
+	}
+	if stat.Blocks == 0 {
+		return 0, 100, nil
+	}
+	return stat.Bavail * uint64(stat.Bsize), float64(stat.Bavail) / float64(stat.Blocks) * 100, nil
+}
+
+// ReadOnly returns true while the free space is below the thresholds
+func (g *DiskGuard) ReadOnly() bool {
+	return g.readOnly.Load()
+}
+
+// Usage returns the result of the last check
+func (g *DiskGuard) Usage() DiskUsage {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return g.last
+}
+
+func (g *DiskGuard) low(freeBytes uint64, freePercent float64) bool {
+	return (g.cfg.MinFreePercent > 0 && freePercent < g.cfg.MinFreePercent) ||
+		(g.cfg.MinFreeBytes > 0 && freeBytes < g.cfg.MinFreeBytes)
+}
+
+// Check measures the free space and switches the node to read-only, or back,
+// when it crosses the thresholds. It returns true if the mode changed.
+func (g *DiskGuard) Check() (bool, error) {
+	freeBytes, freePercent, err := g.usage(g.cfg.Dir)
+	if err != nil {
+		return false, fmt.Errorf("failed to check free disk space: %w", err)
+	}
+	usage := DiskUsage{FreeBytes: freeBytes, FreePercent: freePercent, ReadOnly: g.low(freeBytes, freePercent), CheckedAt: time.Now()}
+	g.mtx.Lock()
+	g.last = usage
+	g.mtx.Unlock()
+
+	if g.readOnly.Swap(usage.ReadOnly) == usage.ReadOnly {
+		return false, nil
+	}
+	if g.cfg.OnChange != nil {
+		g.cfg.OnChange(usage.ReadOnly, usage)
+	}
+	return true, nil
+}
+
+// guardDisk checks the free space at every interval. The first check is done
+// before returning so that a node started on a full disk never writes.
+func (p2p *P2P) guardDisk() (func() error, error) {
+	logChange := func() {
+		usage := p2p.disk.Usage()
+		if usage.ReadOnly {
+			p2p.log.Warnf("Only %.1f%% (%d bytes) of disk space left in %s. Refusing writes and pausing syncs", usage.FreePercent, usage.FreeBytes, p2p.disk.cfg.Dir)
+		} else {
+			p2p.log.Infof("Disk space is back to %.1f%% in %s. Accepting writes and resuming syncs", usage.FreePercent, p2p.disk.cfg.Dir)
+		}
+	}
+	changed, err := p2p.disk.Check()
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		logChange()
+	}
+
+	stopSignal := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(p2p.disk.cfg.CheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-stopSignal:
+				return
+			}
+			changed, err := p2p.disk.Check()
+			if err != nil {
+				p2p.log.Error(err)
+				continue
+			}
+			if changed {
+				logChange()
+			}
+		}
+	}()
+	return func() error {
+		close(stopSignal)
+		return nil
+	}, nil
+}
+
+// syncPaused returns true if the history must not grow because the disk is
+// nearly full, or if the node is shedding load
+func (p2p *P2P) syncPaused() bool {
+	return (p2p.disk != nil && p2p.disk.ReadOnly()) || (p2p.governor != nil && p2p.governor.Overloaded())
+}
+
+// diskInterceptor refuses the head announcements of peers while the disk is
+// nearly full, since applying them pulls their chunks. Peers see the
+// announcement fail and the head is recovered once space is freed.
+func (p2p *P2P) diskInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if strings.HasSuffix(info.FullMethod, "/AdvertiseHead") && p2p.disk.ReadOnly() {
+			return nil, ErrDiskFull
+		}
+		return handler(ctx, req)
+	}
+}
+
+// DiskUsage returns the free space of the data directory at the last check,
+// and false if the disk is not guarded
+func (p2p *P2P) DiskUsage() (DiskUsage, bool) {
+	if p2p.disk == nil {
+		return DiskUsage{}, false
+	}
+	return p2p.disk.Usage(), true
+}
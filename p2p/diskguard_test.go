@@ -0,0 +1,48 @@
+package p2p
+
+import (
+	"testing"
+)
+
+func TestDiskGuard(t *testing.T) {
+	changes := []bool{}
+	guard, err := NewDiskGuard(DiskGuardConfig{
+		MinFreePercent: 10,
+		MinFreeBytes:   1 << 20,
+		OnChange:       func(readOnly bool, usage DiskUsage) { changes = append(changes, readOnly) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	freeBytes, freePercent := uint64(1<<30), 50.0
+	guard.usage = func(string) (uint64, float64, error) { return freeBytes, freePercent, nil }
+
+	steps := []struct {
+		freeBytes   uint64
+		freePercent float64
+		readOnly    bool
+	}{
+		{1 << 30, 50, false},
+		{1 << 30, 5, true},
+		{1 << 30, 4, true},
+		{1 << 30, 20, false},
+		{1 << 10, 20, true},
+		{1 << 30, 20, false},
+	}
+	for _, step := range steps {
+		freeBytes, freePercent = step.freeBytes, step.freePercent
+		if _, err := guard.Check(); err != nil {
+			t.Fatal(err)
+		}
+		if guard.ReadOnly() != step.readOnly || guard.Usage().ReadOnly != step.readOnly {
+			t.Errorf("expected read-only to be %t with %d bytes and %.0f%% free", step.readOnly, step.freeBytes, step.freePercent)
+		}
+	}
+	if len(changes) != 4 || !changes[0] || changes[1] || !changes[2] || changes[3] {
+		t.Errorf("expected to be notified of every change, got %v", changes)
+	}
+
+	if _, err := NewDiskGuard(DiskGuardConfig{MinFreePercent: 120}); err == nil {
+		t.Errorf("expected an error for an invalid percentage")
+	}
+}
@@ -0,0 +1,170 @@
+package p2p
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+const drainNoticeTimeout = 5 * time.Second
+
+// DrainStatus describes the drain of a node, which its peers acknowledge by
+// routing around it
+type DrainStatus struct {
+	Draining bool `json:"draining"`
+	// Acknowledged are the peers that were notified of the current state, and
+	// Pending the connected peers that weren't yet
+	Acknowledged []string  `json:"acknowledged"`
+	Pending      []string  `json:"pending"`
+	StartedAt    time.Time `json:"started_at"`
+}
+
+// Proto converts the status for the Admin service
+func (s DrainStatus) Proto() *p2pproto.DrainStatus {
+	return &p2pproto.DrainStatus{
+		Draining:      s.Draining,
+		Acknowledged:  s.Acknowledged,
+		Pending:       s.Pending,
+		StartedUnixMs: s.StartedAt.UnixMilli(),
+	}
+}
+
+// drainState tracks the peers notified of the drain state of the node
+type drainState struct {
+	mtx      sync.Mutex
+	draining bool
+	acked    map[string]bool
+}
+
+// set changes the state, which has to be notified again to every peer. It
+// returns false if the state didn't change.
+func (d *drainState) set(draining bool) bool {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if d.draining == draining && d.acked != nil {
+		return false
+	}
+	d.draining = draining
+	d.acked = map[string]bool{}
+	return true
+}
+
+// ack records that a peer was notified of the state, unless it changed since
+func (d *drainState) ack(peerID string, draining bool) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if d.draining == draining && d.acked != nil {
+		d.acked[peerID] = true
+	}
+}
+
+func (d *drainState) isDraining() bool {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.draining
+}
+
+// status splits the connected peers into the ones that acknowledged the
+// state and the ones that didn't
+func (d *drainState) status(connected []string) DrainStatus {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	status := DrainStatus{Draining: d.draining, Acknowledged: []string{}, Pending: []string{}}
+	if d.acked == nil {
+		// the state never changed, so there is nothing to acknowledge
+		return status
+	}
+	for id := range d.acked {
+		status.Acknowledged = append(status.Acknowledged, id)
+	}
+	for _, id := range connected {
+		if !d.acked[id] {
+			status.Pending = append(status.Pending, id)
+		}
+	}
+	sort.Strings(status.Acknowledged)
+	sort.Strings(status.Pending)
+	return status
+}
+
+// Draining returns true if the peer notified that it's draining
+func (c *P2PClient) Draining() bool {
+	return c.draining.Load()
+}
+
+// Draining returns true if the node is draining
+func (p2p *P2P) Draining() bool {
+	return p2p.drain.isDraining()
+}
+
+// SetDraining marks the node draining, or not draining anymore, and notifies
+// its peers. Peers connecting later are notified when they connect.
+func (p2p *P2P) SetDraining(ctx context.Context, draining bool) DrainStatus {
+	if p2p.drain.set(draining) {
+		if draining {
+			p2p.log.Info("Draining: notifying peers")
+		} else {
+			p2p.log.Info("Not draining anymore: notifying peers")
+		}
+		wg := sync.WaitGroup{}
+		for _, client := range p2p.GetClients() {
+			wg.Add(1)
+			go func(client *P2PClient) {
+				defer wg.Done()
+				p2p.notifyDrain(ctx, client, draining)
+			}(client)
+		}
+		wg.Wait()
+	}
+	return p2p.DrainStatus()
+}
+
+// DrainStatus returns the drain state of the node and the peers that
+// acknowledged it
+func (p2p *P2P) DrainStatus() DrainStatus {
+	connected := []string{}
+	for _, client := range p2p.GetClients() {
+		connected = append(connected, client.GetID())
+	}
+	status := p2p.drain.status(connected)
+	status.StartedAt = p2p.started
+	return status
+}
+
+func (p2p *P2P) notifyDrain(ctx context.Context, client *P2PClient, draining bool) {
+	if !client.Supports(p2pproto.Drain_NotifyDrain_FullMethodName) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, drainNoticeTimeout)
+	defer cancel()
+	_, err := client.NotifyDrain(ctx, &p2pproto.DrainNotice{Draining: draining})
+	if err != nil {
+		p2p.log.Warnf("Failed to notify %s of the drain: %v", client.GetID(), err)
+		return
+	}
+	p2p.drain.ack(client.GetID(), draining)
+}
+
+// drainServer serves the Drain service, called by the peers that start or
+// stop draining
+type drainServer struct {
+	p2pproto.UnimplementedDrainServer
+	p2p *P2P
+}
+
+func (s *drainServer) NotifyDrain(ctx context.Context, req *p2pproto.DrainNotice) (*p2pproto.DrainAck, error) {
+	id := remotePeerID(ctx)
+	c, found := s.p2p.clients.Get(id)
+	if found {
+		c.(*P2PClient).draining.Store(req.Draining)
+	}
+	if req.Draining {
+		s.p2p.log.Infof("Peer %s is draining, routing around it", id)
+	} else {
+		s.p2p.log.Infof("Peer %s is not draining anymore", id)
+	}
+	return &p2pproto.DrainAck{}, nil
+}
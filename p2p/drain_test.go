@@ -0,0 +1,30 @@
+package p2p
+
+import "testing"
+
+func TestDrainState(t *testing.T) {
+	d := &drainState{}
+	if status := d.status([]string{"a", "b"}); status.Draining || len(status.Pending) != 0 {
+		t.Fatalf("expected nothing to acknowledge before a drain, got %+v", status)
+	}
+
+	if !d.set(true) || d.set(true) {
+		t.Fatal("expected only the first drain to change the state")
+	}
+	d.ack("b", true)
+	// acknowledgments of a previous state are ignored
+	d.ack("a", false)
+	status := d.status([]string{"a", "b", "c"})
+	if !status.Draining || len(status.Acknowledged) != 1 || status.Acknowledged[0] != "b" {
+		t.Fatalf("unexpected acknowledgments %+v", status)
+	}
+	if len(status.Pending) != 2 || status.Pending[0] != "a" || status.Pending[1] != "c" {
+		t.Fatalf("unexpected pending peers %+v", status)
+	}
+
+	// the end of the drain is acknowledged again
+	d.set(false)
+	if status := d.status([]string{"b"}); status.Draining || len(status.Pending) != 1 {
+		t.Fatalf("expected the end of the drain to be pending, got %+v", status)
+	}
+}
@@ -0,0 +1,157 @@
+package p2p
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/drift"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+const driftCheckTimeout = 5 * time.Minute
+
+// driftChecker periodically compares the table stats of peers that are at the
+// same head as us
+type driftChecker struct {
+	p2p      *P2P
+	interval time.Duration
+
+	mtx sync.Mutex
+	// commit and stats are the local stats of the last checked head
+	commit string
+	stats  []drift.TableStats
+	// drifted holds the mismatching tables of every peer that diverged
+	drifted map[string][]drift.Mismatch
+}
+
+// localStats returns the stats of a commit, reusing the previous ones if the
+// head didn't change
+func (d *driftChecker) localStats(commit string) ([]drift.TableStats, error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if d.commit == commit {
+		return d.stats, nil
+	}
+	stats, err := drift.Collect(d.p2p.externalDB, commit)
+	if err != nil {
+		return nil, err
+	}
+	d.commit = commit
+	d.stats = stats
+	return stats, nil
+}
+
+func (d *driftChecker) record(peerID string, mismatches []drift.Mismatch) (changed bool) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	_, wasDrifted := d.drifted[peerID]
+	if len(mismatches) == 0 {
+		delete(d.drifted, peerID)
+		return wasDrifted
+	}
+	d.drifted[peerID] = mismatches
+	return !wasDrifted
+}
+
+func (d *driftChecker) forget(peerID string) {
+	d.mtx.Lock()
+	delete(d.drifted, peerID)
+	d.mtx.Unlock()
+}
+
+// checkPeer compares the stats of a peer with ours if it's at the same head
+func (d *driftChecker) checkPeer(ctx context.Context, client *P2PClient, head string) {
+	peerHead, err := client.GetHead(ctx, &p2pproto.GetHeadRequest{})
+	if err != nil {
+		d.p2p.log.Debugf("Failed to get head of '%s' for drift check: %v", client.GetID(), err)
+		return
+	}
+	if peerHead.Commit != head {
+		return
+	}
+	local, err := d.localStats(head)
+	if err != nil {
+		d.p2p.log.Warnf("Failed to collect table stats for drift check: %v", err)
+		return
+	}
+	resp, err := client.TableStats(ctx, &p2pproto.TableStatsRequest{Commit: head})
+	if err != nil {
+		d.p2p.log.Debugf("Failed to get table stats of '%s': %v", client.GetID(), err)
+		return
+	}
+	remote := []drift.TableStats{}
+	for _, ts := range resp.Tables {
+		remote = append(remote, drift.TableStats{Table: ts.Table, Rows: ts.Rows, Hash: ts.Hash})
+	}
+
+	mismatches := drift.Compare(local, remote)
+	// both nodes have the same tables at the same commit, so the tables
+	// missing on the peer are the ones its ACL doesn't let this node read
+	compared := []drift.Mismatch{}
+	for _, m := range mismatches {
+		if m.RemoteHash != "" {
+			compared = append(compared, m)
+		}
+	}
+	mismatches = compared
+	if !d.record(client.GetID(), mismatches) {
+		return
+	}
+	if len(mismatches) > 0 {
+		d.p2p.events.publish(Event{Type: EventDriftDetected, PeerID: client.GetID(), Commit: head, Drift: mismatches})
+	} else {
+		d.p2p.events.publish(Event{Type: EventDriftResolved, PeerID: client.GetID(), Commit: head})
+	}
+}
+
+func (d *driftChecker) check() {
+	head, err := d.p2p.externalDB.GetLastCommit("main")
+	if err != nil {
+		d.p2p.log.Warnf("Failed to read head for drift check: %v", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), driftCheckTimeout)
+	defer cancel()
+	for _, client := range d.p2p.GetClients() {
+		if client.Supports(p2pproto.Tester_TableStats_FullMethodName) {
+			d.checkPeer(ctx, client, head.Hash)
+		}
+	}
+}
+
+func (d *driftChecker) start() func() error {
+	stopSignal := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.check()
+			case <-stopSignal:
+				return
+			}
+		}
+	}()
+	stopper := func() error {
+		stopSignal <- struct{}{}
+		return nil
+	}
+	return stopper
+}
+
+// DriftedPeers returns the mismatching tables of the peers whose data diverged
+// from ours at the same head, as of the last drift check
+func (p2p *P2P) DriftedPeers() map[string][]drift.Mismatch {
+	drifted := map[string][]drift.Mismatch{}
+	if p2p.drift == nil {
+		return drifted
+	}
+	p2p.drift.mtx.Lock()
+	defer p2p.drift.mtx.Unlock()
+	for peerID, mismatches := range p2p.drift.drifted {
+		drifted[peerID] = mismatches
+	}
+	return drifted
+}
@@ -0,0 +1,34 @@
+package p2p
+
+import (
+	"testing"
+
+	"github.com/nustiueudinastea/doltswarmdemo/drift"
+)
+
+func TestDriftRecord(t *testing.T) {
+	d := &driftChecker{drifted: map[string][]drift.Mismatch{}}
+	mismatches := []drift.Mismatch{{Table: "t", LocalRows: 1, RemoteRows: 2}}
+
+	if d.record("a", nil) {
+		t.Errorf("expected a matching peer not to change the drift state")
+	}
+	if !d.record("a", mismatches) {
+		t.Errorf("expected the first mismatch to change the drift state")
+	}
+	if d.record("a", mismatches) {
+		t.Errorf("expected a repeated mismatch not to change the drift state")
+	}
+	if !d.record("a", nil) {
+		t.Errorf("expected a drifted peer matching again to change the drift state")
+	}
+	if len(d.drifted) != 0 {
+		t.Errorf("expected no drifted peers, got %v", d.drifted)
+	}
+
+	d.record("b", mismatches)
+	d.forget("b")
+	if len(d.drifted) != 0 {
+		t.Errorf("expected disconnected peers to be forgotten, got %v", d.drifted)
+	}
+}
@@ -0,0 +1,202 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	p2pgrpc "github.com/birros/go-libp2p-grpc"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+const (
+	electionRPCTimeout     = 2 * time.Second
+	electionCoordinatorTTL = 5 * time.Second
+	electionCheckInterval  = 10 * time.Second
+)
+
+var _ p2pproto.ElectionServer = (*elector)(nil)
+
+// elector implements a bully election over the gRPC layer: the reachable peer
+// with the highest ID becomes the leader and announces itself to everyone else.
+type elector struct {
+	p2p *P2P
+
+	mtx         sync.RWMutex
+	leader      string
+	electing    bool
+	coordinated chan struct{}
+}
+
+func newElector(p2p *P2P) *elector {
+	return &elector{
+		p2p:         p2p,
+		coordinated: make(chan struct{}, 1),
+	}
+}
+
+// Leader returns the ID of the current leader, or an empty string if no leader
+// has been elected yet.
+func (e *elector) Leader() string {
+	e.mtx.RLock()
+	defer e.mtx.RUnlock()
+	return e.leader
+}
+
+func (e *elector) setLeader(id string) {
+	e.mtx.Lock()
+	changed := e.leader != id
+	e.leader = id
+	e.mtx.Unlock()
+	if changed {
+		e.p2p.log.Infof("Peer '%s' is now the leader", id)
+	}
+}
+
+// Elect is called by lower ID peers that are running an election. We answer
+// that we're taking over and start our own election.
+func (e *elector) Elect(ctx context.Context, req *p2pproto.ElectRequest) (*p2pproto.ElectResponse, error) {
+	if _, ok := p2pgrpc.RemotePeerFromContext(ctx); !ok {
+		return nil, errors.New("no AuthInfo in context")
+	}
+	go e.startElection()
+	return &p2pproto.ElectResponse{Ok: true}, nil
+}
+
+// Coordinator is called by the peer that won an election.
+func (e *elector) Coordinator(ctx context.Context, req *p2pproto.CoordinatorRequest) (*p2pproto.CoordinatorResponse, error) {
+	remotePeer, ok := p2pgrpc.RemotePeerFromContext(ctx)
+	if !ok {
+		return nil, errors.New("no AuthInfo in context")
+	}
+
+	if remotePeer.String() < e.p2p.GetID() {
+		// a lower peer can't be the leader while we're alive
+		go e.startElection()
+		return &p2pproto.CoordinatorResponse{}, nil
+	}
+
+	e.setLeader(remotePeer.String())
+	select {
+	case e.coordinated <- struct{}{}:
+	default:
+	}
+	return &p2pproto.CoordinatorResponse{}, nil
+}
+
+func (e *elector) startElection() {
+	e.mtx.Lock()
+	if e.electing {
+		e.mtx.Unlock()
+		return
+	}
+	e.electing = true
+	e.mtx.Unlock()
+
+	defer func() {
+		e.mtx.Lock()
+		e.electing = false
+		e.mtx.Unlock()
+	}()
+
+	for {
+		// drain stale coordinator notifications
+		select {
+		case <-e.coordinated:
+		default:
+		}
+
+		if !e.challengeHigherPeers() {
+			e.becomeLeader()
+			return
+		}
+
+		select {
+		case <-e.coordinated:
+			return
+		case <-time.After(electionCoordinatorTTL):
+			e.p2p.log.Warn("No coordinator announcement received. Restarting election")
+		}
+	}
+}
+
+// challengeHigherPeers sends an election message to all peers with a higher ID
+// and returns true if any of them took over the election.
+func (e *elector) challengeHigherPeers() bool {
+	selfID := e.p2p.GetID()
+	tookOver := false
+	for _, client := range e.p2p.GetClients() {
+		if client.GetID() <= selfID || !client.Supports(p2pproto.Election_Elect_FullMethodName) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), electionRPCTimeout)
+		resp, err := client.Elect(ctx, &p2pproto.ElectRequest{})
+		cancel()
+		if err != nil {
+			e.p2p.log.Debugf("Election message to '%s' failed: %v", client.GetID(), err)
+			continue
+		}
+		if resp.Ok {
+			tookOver = true
+		}
+	}
+	return tookOver
+}
+
+func (e *elector) becomeLeader() {
+	e.setLeader(e.p2p.GetID())
+	for _, client := range e.p2p.GetClients() {
+		if !client.Supports(p2pproto.Election_Coordinator_FullMethodName) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), electionRPCTimeout)
+		_, err := client.Coordinator(ctx, &p2pproto.CoordinatorRequest{})
+		cancel()
+		if err != nil {
+			e.p2p.log.Errorf("Failed to announce leadership to '%s': %v", client.GetID(), err)
+		}
+	}
+}
+
+// peerConnected starts a new election if the new peer outranks the current leader.
+func (e *elector) peerConnected(peerID string) {
+	if peerID > e.Leader() {
+		go e.startElection()
+	}
+}
+
+// peerDisconnected starts a new election if the leader went away.
+func (e *elector) peerDisconnected(peerID string) {
+	if peerID == e.Leader() {
+		e.setLeader("")
+		go e.startElection()
+	}
+}
+
+func (e *elector) monitor() func() error {
+	stopSignal := make(chan struct{})
+	go func() {
+		e.p2p.log.Info("Starting leader election monitor")
+		e.startElection()
+		ticker := time.NewTicker(electionCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				leader := e.Leader()
+				if leader == "" || (leader != e.p2p.GetID() && !e.p2p.hasClient(leader)) {
+					e.startElection()
+				}
+			case <-stopSignal:
+				e.p2p.log.Info("Stopping leader election monitor")
+				return
+			}
+		}
+	}()
+	stopper := func() error {
+		stopSignal <- struct{}{}
+		return nil
+	}
+	return stopper
+}
@@ -0,0 +1,238 @@
+package p2p
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	p2pgrpc "github.com/birros/go-libp2p-grpc"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	cmap "github.com/orcaman/concurrent-map"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcpeer "google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// idHost is a host that only knows its ID
+type idHost struct {
+	host.Host
+	id peer.ID
+}
+
+func (h idHost) ID() peer.ID {
+	return h.id
+}
+
+// remoteConn is a connection that only knows its remote peer
+type remoteConn struct {
+	network.Conn
+	remote peer.ID
+}
+
+func (c remoteConn) RemotePeer() peer.ID {
+	return c.remote
+}
+
+// remoteStream is a stream over a remoteConn
+type remoteStream struct {
+	network.Stream
+	conn remoteConn
+}
+
+func (s remoteStream) Conn() network.Conn {
+	return s.conn
+}
+
+// fromPeer returns a context of a call made by a peer
+func fromPeer(id peer.ID) context.Context {
+	return grpcpeer.NewContext(context.Background(), &grpcpeer.Peer{AuthInfo: p2pgrpc.AuthInfo{Stream: remoteStream{conn: remoteConn{remote: id}}}})
+}
+
+// fakeElectionPeer records the election messages it receives. A peer that
+// takes over an election announces itself to the elector.
+type fakeElectionPeer struct {
+	p2pproto.ElectionClient
+
+	id       peer.ID
+	takeOver *elector
+
+	mtx         sync.Mutex
+	elections   int
+	coordinated int
+}
+
+func (f *fakeElectionPeer) Elect(ctx context.Context, req *p2pproto.ElectRequest, opts ...grpc.CallOption) (*p2pproto.ElectResponse, error) {
+	f.mtx.Lock()
+	f.elections++
+	f.mtx.Unlock()
+	if f.takeOver == nil {
+		return &p2pproto.ElectResponse{}, nil
+	}
+	go f.takeOver.Coordinator(fromPeer(f.id), &p2pproto.CoordinatorRequest{})
+	return &p2pproto.ElectResponse{Ok: true}, nil
+}
+
+func (f *fakeElectionPeer) Coordinator(ctx context.Context, req *p2pproto.CoordinatorRequest, opts ...grpc.CallOption) (*p2pproto.CoordinatorResponse, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.coordinated++
+	return &p2pproto.CoordinatorResponse{}, nil
+}
+
+func (f *fakeElectionPeer) counts() (int, int) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	return f.elections, f.coordinated
+}
+
+// sortedPeerIDs returns new peer IDs in the order used by the election
+func sortedPeerIDs(t *testing.T, n int) []peer.ID {
+	ids := []peer.ID{}
+	for i := 0; i < n; i++ {
+		prvKey, _, err := crypto.GenerateKeyPair(crypto.Ed25519, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, err := peer.IDFromPrivateKey(prvKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+	return ids
+}
+
+// newTestElector returns the elector of a node connected to the given peers
+func newTestElector(self peer.ID, peers ...*fakeElectionPeer) *elector {
+	p2p := &P2P{log: logrus.New(), host: idHost{id: self}, clients: cmap.New()}
+	for _, fake := range peers {
+		p2p.clients.Set(fake.id.String(), &P2PClient{ElectionClient: fake, id: fake.id.String(), apiVersion: ProtocolVersion})
+	}
+	p2p.elector = newElector(p2p)
+	return p2p.elector
+}
+
+// waitForLeader waits until the elector agrees on a leader
+func waitForLeader(t *testing.T, e *elector, leader string) {
+	deadline := time.Now().Add(time.Second)
+	for e.Leader() != leader {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected leader '%s', got '%s'", leader, e.Leader())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestElection(t *testing.T) {
+	ids := sortedPeerIDs(t, 3)
+	low, mid, high := ids[0], ids[1], ids[2]
+
+	// the peer with the highest ID wins and announces itself to the others
+	lower := []*fakeElectionPeer{{id: low}, {id: mid}}
+	e := newTestElector(high, lower...)
+	e.startElection()
+	if e.Leader() != high.String() {
+		t.Fatalf("expected the highest peer to be the leader, got '%s'", e.Leader())
+	}
+	for _, fake := range lower {
+		if elections, coordinated := fake.counts(); elections != 0 || coordinated != 1 {
+			t.Errorf("expected lower peer '%s' to only be announced the leader, got %d elections and %d announcements", fake.id, elections, coordinated)
+		}
+	}
+
+	// a higher peer takes over the election of a lower one
+	higher := &fakeElectionPeer{id: high}
+	e = newTestElector(mid, &fakeElectionPeer{id: low}, higher)
+	higher.takeOver = e
+	e.startElection()
+	if e.Leader() != high.String() {
+		t.Errorf("expected the higher peer to take over, got '%s'", e.Leader())
+	}
+	if elections, _ := higher.counts(); elections != 1 {
+		t.Errorf("expected a single election message to the higher peer, got %d", elections)
+	}
+}
+
+func TestElectionStepDown(t *testing.T) {
+	ids := sortedPeerIDs(t, 3)
+	low, mid, high := ids[0], ids[1], ids[2]
+
+	lower := &fakeElectionPeer{id: low}
+	e := newTestElector(mid, lower)
+	e.startElection()
+	if e.Leader() != mid.String() {
+		t.Fatalf("expected the node to be the leader, got '%s'", e.Leader())
+	}
+
+	// the leader steps down for the announcement of any higher peer
+	_, err := e.Coordinator(fromPeer(high), &p2pproto.CoordinatorRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Leader() != high.String() {
+		t.Errorf("expected the higher peer to be the leader, got '%s'", e.Leader())
+	}
+
+	// the announcement of a lower peer is not accepted and starts an
+	// election, which the node wins again
+	_, err = e.Coordinator(fromPeer(low), &p2pproto.CoordinatorRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForLeader(t, e, mid.String())
+	deadline := time.Now().Add(time.Second)
+	for _, coordinated := lower.counts(); coordinated != 2; _, coordinated = lower.counts() {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the lower peer to be announced the leader twice, got %d", coordinated)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := e.Coordinator(context.Background(), &p2pproto.CoordinatorRequest{}); err == nil {
+		t.Error("expected an error for an announcement without a peer")
+	}
+}
+
+func TestMissingLeader(t *testing.T) {
+	ids := sortedPeerIDs(t, 2)
+	self, leader := ids[0], ids[1]
+
+	e := newTestElector(self)
+	p2p := e.p2p
+	query := "INSERT INTO t VALUES (1)"
+
+	// writes fail until a leader is elected
+	if _, _, err := p2p.Route(query); status.Code(err) != codes.Unavailable {
+		t.Errorf("expected writes to be unavailable without a leader, got %v", err)
+	}
+
+	// or while the leader is not connected
+	e.setLeader(leader.String())
+	if _, _, err := p2p.Route(query); status.Code(err) != codes.Unavailable {
+		t.Errorf("expected writes to be unavailable while the leader is not connected, got %v", err)
+	}
+
+	fake := &fakeElectionPeer{id: leader}
+	p2p.clients.Set(leader.String(), &P2PClient{ElectionClient: fake, id: leader.String(), apiVersion: ProtocolVersion})
+	client, forward, err := p2p.Route(query)
+	if err != nil || !forward || client.(*P2PClient).GetID() != leader.String() {
+		t.Errorf("expected writes to be forwarded to the leader, got %v (%v)", forward, err)
+	}
+
+	// the node takes over once the leader is gone
+	p2p.clients.Remove(leader.String())
+	e.peerDisconnected(leader.String())
+	waitForLeader(t, e, self.String())
+	if _, forward, err := p2p.Route(query); err != nil || forward {
+		t.Errorf("expected the leader to commit writes locally, got %v (%v)", forward, err)
+	}
+}
@@ -0,0 +1,164 @@
+package p2p
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/drift"
+)
+
+const (
+	eventBuffer             = 100
+	defaultSyncLagThreshold = 100
+)
+
+// EventType is the type of a peer event
+type EventType string
+
+const (
+	// EventPeerConnected is sent when a peer connects and its API version is
+	// negotiated
+	EventPeerConnected EventType = "peer_connected"
+	// EventPeerDisconnected is sent when the connection to a peer is closed
+	EventPeerDisconnected EventType = "peer_disconnected"
+	// EventPeerSynced is sent when we have all the commits of a peer, after
+	// missing some or when first checking it
+	EventPeerSynced EventType = "peer_synced"
+	// EventSyncLagExceeded is sent when the number of commits of a peer that
+	// we are missing goes over the sync lag threshold
+	EventSyncLagExceeded EventType = "sync_lag_exceeded"
+	// EventDriftDetected is sent when the tables of a peer at the same head as
+	// us stop matching ours
+	EventDriftDetected EventType = "drift_detected"
+	// EventDriftResolved is sent when the tables of a drifted peer match ours
+	// again
+	EventDriftResolved EventType = "drift_resolved"
+	// EventClockSkewExceeded is sent when the clock of a peer drifts from ours
+	// by more than the clock skew threshold
+	EventClockSkewExceeded EventType = "clock_skew_exceeded"
+	// EventClockSkewResolved is sent when the clock of a skewed peer is back
+	// within the threshold
+	EventClockSkewResolved EventType = "clock_skew_resolved"
+)
+
+// Event describes a change in the presence or sync state of a peer
+type Event struct {
+	Type   EventType
+	PeerID string
+	Time   time.Time
+	// Lag is the number of commits of the peer missing locally. It is only set
+	// for the sync events.
+	Lag int
+	// Commit is the head shared with the peer and Drift the tables that
+	// differ. They are only set for the drift events.
+	Commit string
+	Drift  []drift.Mismatch
+	// Skew is the clock offset of the peer. It is only set for the clock skew
+	// events.
+	Skew time.Duration
+}
+
+type eventSubscription struct {
+	types  map[EventType]bool
+	events chan Event
+}
+
+// eventBus delivers peer events to any number of subscribers
+type eventBus struct {
+	p2p *P2P
+
+	mtx    sync.Mutex
+	subs   map[int]*eventSubscription
+	nextID int
+	// lags is the last known lag of every peer
+	lags         map[string]int
+	lagThreshold int
+}
+
+func newEventBus(p2p *P2P) *eventBus {
+	return &eventBus{
+		p2p:          p2p,
+		subs:         map[int]*eventSubscription{},
+		lags:         map[string]int{},
+		lagThreshold: defaultSyncLagThreshold,
+	}
+}
+
+func (b *eventBus) publish(ev Event) {
+	ev.Time = time.Now()
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	for _, sub := range b.subs {
+		if len(sub.types) > 0 && !sub.types[ev.Type] {
+			continue
+		}
+		select {
+		case sub.events <- ev:
+		default:
+			b.p2p.log.Warnf("Peer event subscriber is too slow. Dropping %s event for '%s'", ev.Type, ev.PeerID)
+		}
+	}
+}
+
+// syncEvents returns the sync events caused by a change of the lag of a peer.
+// prev is -1 if the peer wasn't checked before.
+func syncEvents(prev int, cur int, threshold int) []EventType {
+	events := []EventType{}
+	if cur == 0 && prev != 0 {
+		events = append(events, EventPeerSynced)
+	}
+	if threshold > 0 && cur > threshold && prev <= threshold {
+		events = append(events, EventSyncLagExceeded)
+	}
+	return events
+}
+
+// updateLag records the lag of a peer and publishes the resulting sync events
+func (b *eventBus) updateLag(peerID string, lag int) {
+	b.mtx.Lock()
+	prev, found := b.lags[peerID]
+	if !found {
+		prev = -1
+	}
+	b.lags[peerID] = lag
+	threshold := b.lagThreshold
+	b.mtx.Unlock()
+
+	for _, typ := range syncEvents(prev, lag, threshold) {
+		b.publish(Event{Type: typ, PeerID: peerID, Lag: lag})
+	}
+}
+
+func (b *eventBus) forget(peerID string) {
+	b.mtx.Lock()
+	delete(b.lags, peerID)
+	b.mtx.Unlock()
+}
+
+// SubscribeEvents returns a channel receiving the future peer events of the
+// given types, or of all types if none are given, and a function that cancels
+// the subscription. The sync events are only sent while the sync progress is
+// tracked with TrackSyncProgress.
+func (p2p *P2P) SubscribeEvents(types ...EventType) (<-chan Event, func()) {
+	b := p2p.events
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	sub := &eventSubscription{types: map[EventType]bool{}, events: make(chan Event, eventBuffer)}
+	for _, typ := range types {
+		sub.types[typ] = true
+	}
+	b.subs[id] = sub
+
+	cancel := func() {
+		b.mtx.Lock()
+		defer b.mtx.Unlock()
+		if _, found := b.subs[id]; found {
+			delete(b.subs, id)
+			close(sub.events)
+		}
+	}
+	return sub.events, cancel
+}
@@ -0,0 +1,63 @@
+package p2p
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestSyncEvents(t *testing.T) {
+	tests := []struct {
+		name string
+		prev int
+		cur  int
+		want []EventType
+	}{
+		{"first check in sync", -1, 0, []EventType{EventPeerSynced}},
+		{"caught up", 5, 0, []EventType{EventPeerSynced}},
+		{"still in sync", 0, 0, []EventType{}},
+		{"small lag", 0, 5, []EventType{}},
+		{"lag exceeded", 5, 11, []EventType{EventSyncLagExceeded}},
+		{"still lagging", 11, 20, []EventType{}},
+		{"first check lagging", -1, 20, []EventType{EventSyncLagExceeded}},
+	}
+	for _, tt := range tests {
+		got := syncEvents(tt.prev, tt.cur, 10)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+			}
+		}
+	}
+}
+
+func TestEventBus(t *testing.T) {
+	p2p := &P2P{log: logrus.New()}
+	p2p.events = newEventBus(p2p)
+
+	all, cancelAll := p2p.SubscribeEvents()
+	defer cancelAll()
+	synced, cancelSynced := p2p.SubscribeEvents(EventPeerSynced)
+
+	p2p.events.publish(Event{Type: EventPeerConnected, PeerID: "a"})
+	p2p.events.updateLag("a", 0)
+
+	if ev := <-all; ev.Type != EventPeerConnected || ev.PeerID != "a" {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	if ev := <-all; ev.Type != EventPeerSynced {
+		t.Errorf("unexpected event %+v", ev)
+	}
+	if ev := <-synced; ev.Type != EventPeerSynced {
+		t.Errorf("unexpected event %+v", ev)
+	}
+
+	cancelSynced()
+	if _, ok := <-synced; ok {
+		t.Error("expected the cancelled subscription to be closed")
+	}
+}
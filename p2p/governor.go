@@ -0,0 +1,234 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultGovernorInterval = 5 * time.Second
+	// governorResumeRatio is the share of the budgets the usage has to drop
+	// under before the load is accepted again, so that a node hovering around
+	// a budget doesn't flap
+	governorResumeRatio = 0.9
+)
+
+// ErrOverloaded is returned for the calls refused while the node is over its
+// resource budgets
+var ErrOverloaded = status.Error(codes.ResourceExhausted, "node is over its resource budgets, try again later")
+
+// GovernorConfig sets the resource budgets of the node. A budget of 0 is
+// ignored.
+type GovernorConfig struct {
+	MaxHeapBytes  uint64
+	MaxGoroutines int
+	MaxStreams    int
+	CheckInterval time.Duration
+	// OnChange is optional. It is called when the node starts and stops
+	// shedding load.
+	OnChange func(overloaded bool, usage ResourceUsage)
+}
+
+// Enabled returns true if any budget is set
+func (c GovernorConfig) Enabled() bool {
+	return c.MaxHeapBytes > 0 || c.MaxGoroutines > 0 || c.MaxStreams > 0
+}
+
+// ResourceUsage is the resource usage of the node at the last check
+type ResourceUsage struct {
+	HeapBytes  uint64 `json:"heap_bytes"`
+	Goroutines int    `json:"goroutines"`
+	Streams    int    `json:"streams"`
+	Overloaded bool   `json:"overloaded"`
+	// Exceeded are the budgets that made the node shed load
+	Exceeded  []string  `json:"exceeded,omitempty"`
+	Rejected  int64     `json:"rejected"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Governor keeps the node within its memory, goroutine and stream budgets,
+// which matters on small edge devices where running out of memory kills the
+// process. While a budget is exceeded, the node refuses new calls from peers
+// and users, and pauses the syncs with its peers. Pings, head queries and the
+// Admin service keep working so that the node stays reachable and can be
+// inspected.
+type Governor struct {
+	cfg     GovernorConfig
+	measure func() (uint64, int)
+	// streams counts the streams open on the host, and is set by the P2P
+	// instance using the governor
+	streams func() int
+
+	overloaded atomic.Bool
+	rejected   atomic.Int64
+	mtx        sync.Mutex
+	last       ResourceUsage
+}
+
+// NewGovernor creates a governor with the given budgets. The usage is only
+// checked once the governor is started.
+func NewGovernor(cfg GovernorConfig) (*Governor, error) {
+	if cfg.MaxGoroutines < 0 || cfg.MaxStreams < 0 {
+		return nil, fmt.Errorf("resource budgets can't be negative")
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = defaultGovernorInterval
+	}
+	return &Governor{cfg: cfg, measure: measureRuntime, streams: func() int { return 0 }}, nil
+}
+
+// measureRuntime returns the heap in use and the number of goroutines
+func measureRuntime() (uint64, int) {
+	stats := runtime.MemStats{}
+	runtime.ReadMemStats(&stats)
+	return stats.HeapInuse, runtime.NumGoroutine()
+}
+
+// Overloaded returns true while the node sheds load
+func (g *Governor) Overloaded() bool {
+	return g.overloaded.Load()
+}
+
+// Usage returns the result of the last check
+func (g *Governor) Usage() ResourceUsage {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	usage := g.last
+	usage.Rejected = g.rejected.Load()
+	return usage
+}
+
+// exceeded returns the budgets the usage is over. Once overloaded, the usage
+// has to drop under a share of the budgets to count as back within them.
+func (g *Governor) exceeded(usage ResourceUsage, overloaded bool) []string {
+	ratio := 1.0
+	if overloaded {
+		ratio = governorResumeRatio
+	}
+	exceeded := []string{}
+	if g.cfg.MaxHeapBytes > 0 && float64(usage.HeapBytes) >= float64(g.cfg.MaxHeapBytes)*ratio {
+		exceeded = append(exceeded, "heap")
+	}
+	if g.cfg.MaxGoroutines > 0 && float64(usage.Goroutines) >= float64(g.cfg.MaxGoroutines)*ratio {
+		exceeded = append(exceeded, "goroutines")
+	}
+	if g.cfg.MaxStreams > 0 && float64(usage.Streams) >= float64(g.cfg.MaxStreams)*ratio {
+		exceeded = append(exceeded, "streams")
+	}
+	return exceeded
+}
+
+// Check measures the resource usage and starts or stops shedding load when it
+// crosses the budgets. It returns true if the state changed.
+func (g *Governor) Check() bool {
+	heap, goroutines := g.measure()
+	usage := ResourceUsage{HeapBytes: heap, Goroutines: goroutines, Streams: g.streams(), CheckedAt: time.Now()}
+	usage.Exceeded = g.exceeded(usage, g.Overloaded())
+	usage.Overloaded = len(usage.Exceeded) > 0
+	g.mtx.Lock()
+	g.last = usage
+	g.mtx.Unlock()
+
+	if g.overloaded.Swap(usage.Overloaded) == usage.Overloaded {
+		return false
+	}
+	if g.cfg.OnChange != nil {
+		g.cfg.OnChange(usage.Overloaded, usage)
+	}
+	return true
+}
+
+// admits returns true if a call to method is served while the node is
+// overloaded
+func (g *Governor) admits(method string) bool {
+	if !g.Overloaded() {
+		return true
+	}
+	if strings.HasPrefix(method, "/proto.Admin/") || (methodLane(method) == LaneControl && !strings.HasSuffix(method, "/AdvertiseHead")) {
+		return true
+	}
+	g.rejected.Add(1)
+	return false
+}
+
+// Interceptors returns the server interceptors refusing new calls while the
+// node is overloaded
+func (g *Governor) Interceptors() (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	unary := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !g.admits(info.FullMethod) {
+			return nil, ErrOverloaded
+		}
+		return handler(ctx, req)
+	}
+	stream := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !g.admits(info.FullMethod) {
+			return ErrOverloaded
+		}
+		return handler(srv, ss)
+	}
+	return unary, stream
+}
+
+// governResources checks the resource usage at every interval
+func (p2p *P2P) governResources() (func() error, error) {
+	p2p.governor.streams = p2p.openStreams
+	logChange := func() {
+		usage := p2p.governor.Usage()
+		if usage.Overloaded {
+			p2p.log.Warnf("Node is over its %s budget (heap %d bytes, %d goroutines, %d streams). Refusing new calls and pausing syncs", strings.Join(usage.Exceeded, ", "), usage.HeapBytes, usage.Goroutines, usage.Streams)
+		} else {
+			p2p.log.Infof("Node is back within its resource budgets (heap %d bytes, %d goroutines, %d streams). Accepting calls and resuming syncs", usage.HeapBytes, usage.Goroutines, usage.Streams)
+		}
+	}
+	if p2p.governor.Check() {
+		logChange()
+	}
+
+	stopSignal := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(p2p.governor.cfg.CheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-stopSignal:
+				return
+			}
+			if p2p.governor.Check() {
+				logChange()
+			}
+		}
+	}()
+	return func() error {
+		close(stopSignal)
+		return nil
+	}, nil
+}
+
+// openStreams returns the number of streams open on all the connections of
+// the host
+func (p2p *P2P) openStreams() int {
+	streams := 0
+	for _, conn := range p2p.host.Network().Conns() {
+		streams += len(conn.GetStreams())
+	}
+	return streams
+}
+
+// ResourceUsage returns the resource usage at the last check, and false if
+// the node has no resource budgets
+func (p2p *P2P) ResourceUsage() (ResourceUsage, bool) {
+	if p2p.governor == nil {
+		return ResourceUsage{}, false
+	}
+	return p2p.governor.Usage(), true
+}
@@ -0,0 +1,73 @@
+package p2p
+
+import (
+	"context"
+	"testing"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"google.golang.org/grpc"
+)
+
+func TestGovernor(t *testing.T) {
+	changes := []bool{}
+	governor, err := NewGovernor(GovernorConfig{
+		MaxHeapBytes:  100,
+		MaxGoroutines: 10,
+		OnChange:      func(overloaded bool, usage ResourceUsage) { changes = append(changes, overloaded) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	heap, goroutines := uint64(50), 5
+	governor.measure = func() (uint64, int) { return heap, goroutines }
+
+	steps := []struct {
+		heap       uint64
+		goroutines int
+		overloaded bool
+	}{
+		{50, 5, false},
+		{120, 5, true},
+		// the usage has to drop under 90% of the budgets to recover
+		{95, 5, true},
+		{85, 5, false},
+		{50, 10, true},
+		{50, 5, false},
+	}
+	for _, step := range steps {
+		heap, goroutines = step.heap, step.goroutines
+		governor.Check()
+		if governor.Overloaded() != step.overloaded || governor.Usage().Overloaded != step.overloaded {
+			t.Errorf("expected overloaded to be %t with %d bytes of heap and %d goroutines", step.overloaded, step.heap, step.goroutines)
+		}
+	}
+	if len(changes) != 4 || !changes[0] || changes[1] || !changes[2] || changes[3] {
+		t.Errorf("expected to be notified of every change, got %v", changes)
+	}
+
+	// while overloaded, only control calls and the Admin service are served
+	heap = 200
+	governor.Check()
+	unary, _ := governor.Interceptors()
+	handler := func(ctx context.Context, req any) (any, error) { return "ok", nil }
+	methods := map[string]bool{
+		p2pproto.Pinger_Ping_FullMethodName:           true,
+		p2pproto.Admin_GetSyncProgress_FullMethodName: true,
+		p2pproto.Tester_Query_FullMethodName:          false,
+		"/proto.DBSyncer/AdvertiseHead":               false,
+		p2pproto.Tester_GetAllCommits_FullMethodName:  false,
+	}
+	for method, served := range methods {
+		_, err := unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		if (err == nil) != served {
+			t.Errorf("expected %s to be served: %t, got %v", method, served, err)
+		}
+	}
+	if governor.Usage().Rejected != 3 {
+		t.Errorf("expected 3 rejected calls, got %d", governor.Usage().Rejected)
+	}
+
+	if _, err := NewGovernor(GovernorConfig{MaxStreams: -1}); err == nil {
+		t.Errorf("expected an error for a negative budget")
+	}
+}
@@ -0,0 +1,204 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+const handlerQueue = 100
+
+// MessageHandler observes a message received from a peer. Handlers run
+// independently of the service the message is for and of each other: they
+// get the message after it was received, and their errors and panics are
+// only counted and logged. The message must not be modified.
+type MessageHandler func(ctx context.Context, peerID string, msg proto.Message) error
+
+// HandlerStats counts the messages of a handler
+type HandlerStats struct {
+	Name string `json:"name"`
+	// Type is the full name of the handled message type
+	Type     string `json:"type"`
+	Handled  int64  `json:"handled"`
+	Failed   int64  `json:"failed"`
+	Panicked int64  `json:"panicked"`
+	// Dropped messages arrived while the queue of the handler was full
+	Dropped   int64   `json:"dropped"`
+	Queued    int     `json:"queued"`
+	MeanMs    float64 `json:"mean_ms"`
+	LastError string  `json:"last_error,omitempty"`
+}
+
+type receivedMessage struct {
+	peerID string
+	msg    proto.Message
+}
+
+// messageHandler runs a handler on its own goroutine, through a queue, so
+// that a slow handler doesn't delay the others
+type messageHandler struct {
+	name  string
+	typ   string
+	fn    MessageHandler
+	queue chan receivedMessage
+	done  chan struct{}
+
+	handled  atomic.Int64
+	failed   atomic.Int64
+	panicked atomic.Int64
+	dropped  atomic.Int64
+	duration atomic.Int64
+
+	mtx     sync.Mutex
+	lastErr string
+}
+
+func (h *messageHandler) run(p2p *P2P) {
+	for m := range h.queue {
+		start := time.Now()
+		err := h.call(m)
+		h.duration.Add(int64(time.Since(start)))
+		h.handled.Add(1)
+		if err == nil {
+			continue
+		}
+		h.failed.Add(1)
+		h.mtx.Lock()
+		h.lastErr = err.Error()
+		h.mtx.Unlock()
+		p2p.log.Warnf("Handler %s failed on %s from %s: %v", h.name, h.typ, m.peerID, err)
+	}
+	close(h.done)
+}
+
+// call runs the handler, turning a panic into an error
+func (h *messageHandler) call(m receivedMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			h.panicked.Add(1)
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return h.fn(context.Background(), m.peerID, m.msg)
+}
+
+func (h *messageHandler) stats() HandlerStats {
+	stats := HandlerStats{
+		Name:     h.name,
+		Type:     h.typ,
+		Handled:  h.handled.Load(),
+		Failed:   h.failed.Load(),
+		Panicked: h.panicked.Load(),
+		Dropped:  h.dropped.Load(),
+		Queued:   len(h.queue),
+	}
+	if stats.Handled > 0 {
+		stats.MeanMs = float64(h.duration.Load()) / float64(stats.Handled) / float64(time.Millisecond)
+	}
+	h.mtx.Lock()
+	stats.LastError = h.lastErr
+	h.mtx.Unlock()
+	return stats
+}
+
+// messageHandlers fans the messages received from peers out to the handlers
+// of their type
+type messageHandlers struct {
+	mtx    sync.RWMutex
+	byType map[string][]*messageHandler
+	// queue is the number of messages queued for every handler
+	queue int
+}
+
+func newMessageHandlers() *messageHandlers {
+	return &messageHandlers{byType: map[string][]*messageHandler{}, queue: handlerQueue}
+}
+
+// AddMessageHandler registers a handler observing every message of the same
+// type as msg received from peers, in addition to the service the message is
+// for and the other handlers of the type. It returns a function removing the
+// handler, which returns once the handler is done with its queued messages.
+func (p2p *P2P) AddMessageHandler(name string, msg proto.Message, fn MessageHandler) func() {
+	h := &messageHandler{
+		name:  name,
+		typ:   string(proto.MessageName(msg)),
+		fn:    fn,
+		queue: make(chan receivedMessage, p2p.handlers.queue),
+		done:  make(chan struct{}),
+	}
+	go h.run(p2p)
+
+	hs := p2p.handlers
+	hs.mtx.Lock()
+	hs.byType[h.typ] = append(hs.byType[h.typ], h)
+	hs.mtx.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			hs.mtx.Lock()
+			handlers := hs.byType[h.typ]
+			for i, registered := range handlers {
+				if registered == h {
+					hs.byType[h.typ] = append(handlers[:i:i], handlers[i+1:]...)
+					break
+				}
+			}
+			close(h.queue)
+			hs.mtx.Unlock()
+			<-h.done
+		})
+	}
+}
+
+// MessageHandlerStats returns the counts of every registered handler, sorted
+// by type and name
+func (p2p *P2P) MessageHandlerStats() []HandlerStats {
+	p2p.handlers.mtx.RLock()
+	defer p2p.handlers.mtx.RUnlock()
+	stats := []HandlerStats{}
+	for _, handlers := range p2p.handlers.byType {
+		for _, h := range handlers {
+			stats = append(stats, h.stats())
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Type != stats[j].Type {
+			return stats[i].Type < stats[j].Type
+		}
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+// dispatch queues a received message for the handlers of its type
+func (hs *messageHandlers) dispatch(peerID string, req any) {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return
+	}
+	hs.mtx.RLock()
+	defer hs.mtx.RUnlock()
+	handlers := hs.byType[string(proto.MessageName(msg))]
+	for _, h := range handlers {
+		select {
+		case h.queue <- receivedMessage{peerID: peerID, msg: msg}:
+		default:
+			h.dropped.Add(1)
+		}
+	}
+}
+
+// handlerInterceptor fans the requests received by the server out to the
+// message handlers. It runs first, so that the handlers see every request,
+// also the ones answered by the other interceptors.
+func (p2p *P2P) handlerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	p2p.handlers.dispatch(remotePeerID(ctx), req)
+	return handler(ctx, req)
+}
@@ -0,0 +1,92 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMessageHandlers(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	p2p := &P2P{log: logger, handlers: newMessageHandlers()}
+
+	statements := make(chan string, 10)
+	removeApp := p2p.AddMessageHandler("app", &p2pproto.QueryRequest{}, func(ctx context.Context, peerID string, msg proto.Message) error {
+		statements <- msg.(*p2pproto.QueryRequest).Statement
+		return nil
+	})
+	removeFailing := p2p.AddMessageHandler("failing", &p2pproto.QueryRequest{}, func(ctx context.Context, peerID string, msg proto.Message) error {
+		if msg.(*p2pproto.QueryRequest).Statement == "h1" {
+			panic("boom")
+		}
+		return errors.New("refused")
+	})
+
+	served := 0
+	handler := func(ctx context.Context, req any) (any, error) {
+		served++
+		return nil, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/test"}
+	for _, head := range []string{"h1", "h2"} {
+		if _, err := p2p.handlerInterceptor(context.Background(), &p2pproto.QueryRequest{Statement: head}, info, handler); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// other types are not handled
+	p2p.handlerInterceptor(context.Background(), &p2pproto.QueryResponse{}, info, handler)
+	if served != 3 {
+		t.Errorf("expected the service to get every request, got %d", served)
+	}
+
+	// the panic and error of a handler don't affect the others
+	for _, expected := range []string{"h1", "h2"} {
+		if statement := <-statements; statement != expected {
+			t.Errorf("expected statement %s, got %s", expected, statement)
+		}
+	}
+	removeApp()
+	removeFailing()
+
+	stats := p2p.MessageHandlerStats()
+	if len(stats) != 0 {
+		t.Errorf("expected the handlers to be removed, got %+v", stats)
+	}
+}
+
+func TestMessageHandlerStats(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	p2p := &P2P{log: logger, handlers: newMessageHandlers()}
+
+	release := make(chan struct{})
+	remove := p2p.AddMessageHandler("slow", &p2pproto.QueryRequest{}, func(ctx context.Context, peerID string, msg proto.Message) error {
+		<-release
+		if msg.(*p2pproto.QueryRequest).Statement == "panic" {
+			panic("boom")
+		}
+		return errors.New("refused")
+	})
+	p2p.handlers.dispatch("a", &p2pproto.QueryRequest{Statement: "panic"})
+	for i := 0; i < handlerQueue+5; i++ {
+		p2p.handlers.dispatch("a", &p2pproto.QueryRequest{Statement: "h"})
+	}
+	h := p2p.handlers.byType["proto.QueryRequest"][0]
+	close(release)
+	// removing waits for the queued messages
+	remove()
+	stats := h.stats()
+	if stats.Dropped < 5 || stats.Handled+stats.Dropped != handlerQueue+6 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if stats.Panicked != 1 || stats.Failed != stats.Handled || stats.LastError != "refused" {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
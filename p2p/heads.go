@@ -0,0 +1,26 @@
+package p2p
+
+import (
+	"fmt"
+
+	p2psrv "github.com/nustiueudinastea/doltswarmdemo/p2p/server"
+)
+
+// ExecIfHead implements p2psrv.HeadGuard. Local writes are serialized, so no
+// other write of the node can move the head between the check and exec.
+// Commits pulled from peers are merged independently, and a merge racing with
+// the write isn't detected.
+func (p2p *P2P) ExecIfHead(expected string, exec func() (string, error)) (string, error) {
+	p2p.writeMtx.Lock()
+	defer p2p.writeMtx.Unlock()
+	if expected != "" {
+		head, err := p2p.externalDB.GetLastCommit("main")
+		if err != nil {
+			return "", fmt.Errorf("failed to read the head: %w", err)
+		}
+		if head.Hash != expected {
+			return "", p2psrv.HeadConflictError(expected, head.Hash)
+		}
+	}
+	return exec()
+}
@@ -0,0 +1,51 @@
+package p2p
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nustiueudinastea/doltswarm"
+	p2psrv "github.com/nustiueudinastea/doltswarmdemo/p2p/server"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type headDB struct {
+	p2psrv.ExternalDB
+	head string
+}
+
+func (db *headDB) GetLastCommit(branch string) (doltswarm.Commit, error) {
+	return doltswarm.Commit{Hash: db.head}, nil
+}
+
+func TestExecIfHead(t *testing.T) {
+	db := &headDB{head: "a"}
+	p := &P2P{externalDB: db}
+	write := func() (string, error) {
+		db.head = "b"
+		return "b", nil
+	}
+
+	commit, err := p.ExecIfHead("a", write)
+	if err != nil || commit != "b" {
+		t.Fatalf("expected the write to be applied, got %q (%v)", commit, err)
+	}
+
+	// the head moved since the client read it
+	_, err = p.ExecIfHead("a", write)
+	if status.Code(err) != codes.Aborted {
+		t.Fatalf("expected the write to be aborted, got %v", err)
+	}
+	if head, ok := p2psrv.ConflictingHead(fmt.Errorf("failed to forward write: %w", err)); !ok || head != "b" {
+		t.Errorf("expected the current head to be returned, got %q", head)
+	}
+	if _, ok := p2psrv.ConflictingHead(status.Error(codes.Aborted, "other")); ok {
+		t.Error("expected other errors not to be head conflicts")
+	}
+
+	// writes without an expected head are applied
+	if _, err := p.ExecIfHead("", write); err != nil {
+		t.Error(err)
+	}
+}
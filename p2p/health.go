@@ -0,0 +1,23 @@
+package p2p
+
+import (
+	"context"
+
+	"github.com/nustiueudinastea/doltswarmdemo/lifecycle"
+)
+
+// Health returns the health of the subsystems started by StartServer
+func (p2p *P2P) Health() []lifecycle.Health {
+	return p2p.lifecycle.Health()
+}
+
+// Ready returns true if all the required subsystems are running
+func (p2p *P2P) Ready() bool {
+	return p2p.lifecycle.Ready()
+}
+
+// WaitReady blocks until all the required subsystems started, or until the
+// context expires
+func (p2p *P2P) WaitReady(ctx context.Context) error {
+	return p2p.lifecycle.WaitReady(ctx)
+}
@@ -0,0 +1,56 @@
+package p2p
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+const heldAnnouncementTimeout = 10 * time.Second
+
+// HoldAnnouncements stops announcing new heads to peers until the returned
+// function is called, e.g. while a large import commits chunk after chunk, so
+// that peers pull the result once instead of chasing every intermediate head.
+// The held announcements are dropped and the head is announced to every
+// connected peer when the last hold is released. Writes waiting for the acks
+// of peers don't complete while announcements are held.
+func (p2p *P2P) HoldAnnouncements() func() {
+	p2p.held.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if p2p.held.Add(-1) == 0 {
+				go p2p.announceHead()
+			}
+		})
+	}
+}
+
+// announceHead announces the local head to every connected peer
+func (p2p *P2P) announceHead() {
+	head, err := p2p.externalDB.GetLastCommit("main")
+	if err != nil {
+		p2p.log.Errorf("Failed to read head to announce: %v", err)
+		return
+	}
+	for _, client := range p2p.GetClients() {
+		ctx, cancel := context.WithTimeout(context.Background(), heldAnnouncementTimeout)
+		err := p2p.Announce(ctx, client.GetID(), head.Hash)
+		cancel()
+		if err != nil {
+			p2p.log.Warnf("Failed to announce head %s to %s: %v", head.Hash, client.GetID(), err)
+		}
+	}
+}
+
+// holdInterceptor drops the head announcements of the DB syncer while they are
+// held
+func (p2p *P2P) holdInterceptor(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if p2p.held.Load() > 0 && strings.HasSuffix(method, "/AdvertiseHead") {
+		return nil
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
@@ -0,0 +1,101 @@
+package p2p
+
+import (
+	"fmt"
+	"sync"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+// DatabaseIdentity tells if two nodes replicate the same database
+type DatabaseIdentity struct {
+	Name string `json:"name"`
+	// ID is generated when the database is created and inherited by the nodes
+	// initialized from a peer
+	ID string `json:"id"`
+	// Genesis is the hash of the first commit of the database
+	Genesis string `json:"genesis"`
+}
+
+// IsComplete returns true once all the fields are known. They don't change
+// afterwards.
+func (id DatabaseIdentity) IsComplete() bool {
+	return id.Name != "" && id.ID != "" && id.Genesis != ""
+}
+
+func (id DatabaseIdentity) proto() *p2pproto.DatabaseIdentity {
+	return &p2pproto.DatabaseIdentity{Name: id.Name, Id: id.ID, Genesis: id.Genesis}
+}
+
+func identityFromProto(id *p2pproto.DatabaseIdentity) DatabaseIdentity {
+	if id == nil {
+		return DatabaseIdentity{}
+	}
+	return DatabaseIdentity{Name: id.Name, ID: id.Id, Genesis: id.Genesis}
+}
+
+// checkIdentity returns an error if the databases of two nodes have different
+// lineages. Fields unknown to either node are not compared, so that peers that
+// predate the check or are not initialized yet can connect.
+func checkIdentity(local DatabaseIdentity, remote DatabaseIdentity) error {
+	fields := []struct {
+		name          string
+		local, remote string
+	}{
+		{"name", local.Name, remote.Name},
+		{"id", local.ID, remote.ID},
+		{"genesis commit", local.Genesis, remote.Genesis},
+	}
+	for _, f := range fields {
+		if f.local != "" && f.remote != "" && f.local != f.remote {
+			return fmt.Errorf("database %s '%s' differs from the local '%s'", f.name, f.remote, f.local)
+		}
+	}
+	return nil
+}
+
+// identitySource loads the identity of the local database until it's
+// complete, and caches it afterwards
+type identitySource struct {
+	load func() (DatabaseIdentity, error)
+
+	mtx      sync.Mutex
+	identity DatabaseIdentity
+}
+
+func (s *identitySource) get() (DatabaseIdentity, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.identity.IsComplete() {
+		return s.identity, nil
+	}
+	identity, err := s.load()
+	if err != nil {
+		return s.identity, err
+	}
+	s.identity = identity
+	return identity, nil
+}
+
+// DatabaseIdentity returns the identity of the local database, which is empty
+// if the node wasn't configured with one
+func (p2p *P2P) DatabaseIdentity() DatabaseIdentity {
+	if p2p.identity == nil {
+		return DatabaseIdentity{}
+	}
+	identity, err := p2p.identity.get()
+	if err != nil {
+		p2p.log.Warnf("Failed to load the database identity: %v", err)
+	}
+	return identity
+}
+
+// CheckIdentity implements server.IdentityChecker
+func (p2p *P2P) CheckIdentity(peerID string, remote *p2pproto.DatabaseIdentity) (*p2pproto.DatabaseIdentity, error) {
+	local := p2p.DatabaseIdentity()
+	if err := checkIdentity(local, identityFromProto(remote)); err != nil {
+		p2p.log.Errorf("Refusing peer %s: %v", peerID, err)
+		return nil, err
+	}
+	return local.proto(), nil
+}
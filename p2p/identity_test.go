@@ -0,0 +1,60 @@
+package p2p
+
+import (
+	"testing"
+)
+
+func TestCheckIdentity(t *testing.T) {
+	local := DatabaseIdentity{Name: "db", ID: "id1", Genesis: "g1"}
+	if err := checkIdentity(local, local); err != nil {
+		t.Errorf("expected identical databases to be compatible, got %v", err)
+	}
+	for _, remote := range []DatabaseIdentity{
+		{Name: "other", ID: "id1", Genesis: "g1"},
+		{Name: "db", ID: "id2", Genesis: "g1"},
+		{Name: "db", ID: "id1", Genesis: "g2"},
+	} {
+		if err := checkIdentity(local, remote); err == nil {
+			t.Errorf("expected %+v to be refused", remote)
+		}
+	}
+
+	// unknown fields are not compared
+	for _, remote := range []DatabaseIdentity{
+		{},
+		{Name: "db"},
+		{Name: "db", Genesis: "g1"},
+	} {
+		if err := checkIdentity(local, remote); err != nil {
+			t.Errorf("expected %+v to be compatible, got %v", remote, err)
+		}
+		if err := checkIdentity(remote, local); err != nil {
+			t.Errorf("expected %+v to accept the database, got %v", remote, err)
+		}
+	}
+	if identityFromProto(nil) != (DatabaseIdentity{}) {
+		t.Error("expected peers without identity to have an empty one")
+	}
+}
+
+func TestIdentitySource(t *testing.T) {
+	loads := 0
+	identity := DatabaseIdentity{Name: "db"}
+	source := &identitySource{load: func() (DatabaseIdentity, error) {
+		loads++
+		return identity, nil
+	}}
+
+	// incomplete identities are reloaded
+	source.get()
+	identity = DatabaseIdentity{Name: "db", ID: "id1", Genesis: "g1"}
+	got, err := source.get()
+	if err != nil || got != identity {
+		t.Fatalf("unexpected identity %+v (%v)", got, err)
+	}
+	// complete ones are cached
+	source.get()
+	if loads != 2 {
+		t.Errorf("expected 2 loads, got %d", loads)
+	}
+}
@@ -0,0 +1,106 @@
+package p2p
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	defaultPeerExpiry = 1 * time.Hour
+	janitorInterval   = 1 * time.Minute
+)
+
+// janitor removes the state kept for peers that have not been seen for a while
+type janitor struct {
+	p2p       *P2P
+	expiry    time.Duration
+	evictions atomic.Int64
+}
+
+// Evictions returns the number of peer state entries removed by the janitor
+func (p2p *P2P) Evictions() int64 {
+	return p2p.janitor.evictions.Load()
+}
+
+func (j *janitor) sweep() {
+	evicted := 0
+
+	// the bandwidth counter keeps stats for every peer we ever talked to
+	before := len(j.p2p.bwCounter.GetBandwidthByPeer())
+	j.p2p.bwCounter.TrimIdle(time.Now().Add(-j.expiry))
+	evicted += before - len(j.p2p.bwCounter.GetBandwidthByPeer())
+
+	for _, id := range j.p2p.versions.peers() {
+		if !j.p2p.hasClient(id) {
+			j.p2p.versions.remove(id)
+			evicted++
+		}
+	}
+
+	for id := range j.p2p.InFlight() {
+		if !j.p2p.hasClient(id) && !j.connected(id) {
+			j.p2p.inFlight.clear(id)
+			evicted++
+		}
+	}
+
+	if j.p2p.readCache != nil {
+		evicted += j.p2p.readCache.expire()
+	}
+	if j.p2p.remote != nil {
+		evicted += j.p2p.remote.cache.expire()
+	}
+
+	if j.p2p.addrBook != nil {
+		expired, err := j.p2p.addrBook.Prune()
+		if err != nil {
+			j.p2p.log.Errorf("Failed to prune address book: %v", err)
+		}
+		evicted += expired
+	}
+
+	if j.p2p.announced != nil {
+		pruned, err := j.p2p.announced.Prune()
+		if err != nil {
+			j.p2p.log.Errorf("Failed to prune announcement log: %v", err)
+		}
+		evicted += pruned
+	}
+
+	if evicted > 0 {
+		j.evictions.Add(int64(evicted))
+		j.p2p.log.Debugf("Janitor evicted state of %d stale peer entries", evicted)
+	}
+}
+
+func (j *janitor) connected(id string) bool {
+	peerID, err := peer.Decode(id)
+	if err != nil {
+		return false
+	}
+	return j.p2p.host.Network().Connectedness(peerID) == network.Connected
+}
+
+func (j *janitor) start() func() error {
+	stopSignal := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(janitorInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				j.sweep()
+			case <-stopSignal:
+				return
+			}
+		}
+	}()
+	stopper := func() error {
+		stopSignal <- struct{}{}
+		return nil
+	}
+	return stopper
+}
@@ -0,0 +1,96 @@
+package p2p
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+const (
+	defaultKeepaliveInterval = 15 * time.Second
+	defaultKeepaliveTimeout  = 5 * time.Second
+)
+
+// keepalive pings idle peers over the RPC protocol. Half-open connections, like
+// the ones left behind when a NAT mapping expires, don't fail until something
+// is sent, so a peer that doesn't answer in time is disconnected and dialed
+// again.
+type keepalive struct {
+	p2p      *P2P
+	interval time.Duration
+	timeout  time.Duration
+	dead     atomic.Int64
+}
+
+// DeadConnections returns the number of connections torn down because the
+// peer stopped answering keepalive pings
+func (p2p *P2P) DeadConnections() int64 {
+	if p2p.keepalive == nil {
+		return 0
+	}
+	return p2p.keepalive.dead.Load()
+}
+
+func (k *keepalive) probe() {
+	wg := sync.WaitGroup{}
+	for _, client := range k.p2p.GetClients() {
+		wg.Add(1)
+		go func(client *P2PClient) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), k.timeout)
+			defer cancel()
+			_, err := k.p2p.ping(ctx, client, &p2pproto.PingRequest{Ping: "keepalive", Version: ProtocolVersion})
+			if err == nil {
+				return
+			}
+			k.p2p.log.Warnf("Peer %s did not answer keepalive ping: %v", client.GetID(), err)
+			k.dead.Add(1)
+			k.reconnect(client.GetID())
+		}(client)
+	}
+	wg.Wait()
+}
+
+// reconnect closes the connection to a peer, which removes its client, and
+// queues the peer to be dialed again on its known addresses
+func (k *keepalive) reconnect(id string) {
+	peerID, err := peer.Decode(id)
+	if err != nil {
+		return
+	}
+	if err := k.p2p.host.Network().ClosePeer(peerID); err != nil {
+		k.p2p.log.Errorf("Failed to close connection to '%s': %v", id, err)
+	}
+	info := k.p2p.host.Peerstore().PeerInfo(peerID)
+	if len(info.Addrs) == 0 {
+		return
+	}
+	go func() {
+		k.p2p.PeerChan <- info
+	}()
+}
+
+func (k *keepalive) start() func() error {
+	stopSignal := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(k.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				k.probe()
+			case <-stopSignal:
+				return
+			}
+		}
+	}()
+	stopper := func() error {
+		stopSignal <- struct{}{}
+		return nil
+	}
+	return stopper
+}
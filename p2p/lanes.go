@@ -0,0 +1,284 @@
+package p2p
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"google.golang.org/grpc"
+)
+
+// Lane is the priority class of an RPC
+type Lane int
+
+const (
+	// LaneControl carries small latency sensitive messages, like pings and
+	// head announcements
+	LaneControl Lane = iota
+	// LaneInteractive carries the queries and writes of users
+	LaneInteractive
+	// LaneBulk carries the sync transfers
+	LaneBulk
+)
+
+var laneNames = [...]string{"control", "interactive", "bulk"}
+
+// laneWeights is the share of the free slots given to every lane when calls
+// of several lanes are waiting
+var laneWeights = [...]int{8, 4, 1}
+
+func (l Lane) String() string {
+	return laneNames[l]
+}
+
+// controlMethods are the methods of the control lane. The head announcements
+// of the DB syncer are matched by name since they are not in our protos.
+var controlMethods = map[string]bool{
+	p2pproto.Pinger_Ping_FullMethodName:          true,
+	p2pproto.Tester_GetHead_FullMethodName:       true,
+	p2pproto.Tester_ReportLag_FullMethodName:     true,
+	p2pproto.Election_Elect_FullMethodName:       true,
+	p2pproto.Election_Coordinator_FullMethodName: true,
+}
+
+var interactiveMethods = map[string]bool{
+	p2pproto.Tester_ExecSQL_FullMethodName:        true,
+	p2pproto.Tester_Query_FullMethodName:          true,
+	p2pproto.Tester_CallProcedure_FullMethodName:  true,
+	p2pproto.Tester_AckCommit_FullMethodName:      true,
+	p2pproto.Tester_CompareCommits_FullMethodName: true,
+	p2pproto.Channels_Invite_FullMethodName:       true,
+	p2pproto.Channels_Deliver_FullMethodName:      true,
+}
+
+// methodLane returns the lane of an RPC. Everything that is not known to be
+// small or interactive is treated as bulk.
+func methodLane(method string) Lane {
+	switch {
+	case controlMethods[method], strings.HasSuffix(method, "/AdvertiseHead"), strings.HasSuffix(method, "/RequestHead"):
+		return LaneControl
+	case interactiveMethods[method], strings.HasPrefix(method, "/proto.Admin/"):
+		return LaneInteractive
+	}
+	return LaneBulk
+}
+
+// LaneStats are the scheduling stats of a lane, summed over all peers
+type LaneStats struct {
+	InFlight int `json:"in_flight"`
+	Queued   int `json:"queued"`
+	// Delayed is the number of calls that had to wait for a slot, and Wait
+	// their total waiting time
+	Delayed int64         `json:"delayed"`
+	Wait    time.Duration `json:"wait_ns"`
+}
+
+// laneScheduler limits the unary calls in flight to a peer. When all the
+// slots are taken, the waiting calls get the freed slots with a weighted round
+// robin over the lanes, and bulk calls never take the last slot, so that a
+// ping or an announcement is never queued behind a full set of transfers.
+type laneScheduler struct {
+	mtx      sync.Mutex
+	slots    int
+	inFlight [len(laneNames)]int
+	waiting  [len(laneNames)][]chan struct{}
+	// current is the state of the smooth weighted round robin
+	current [len(laneNames)]int
+	delayed [len(laneNames)]int64
+	wait    [len(laneNames)]time.Duration
+}
+
+func newLaneScheduler(slots int) *laneScheduler {
+	return &laneScheduler{slots: slots}
+}
+
+func (s *laneScheduler) total() int {
+	total := 0
+	for _, nr := range s.inFlight {
+		total += nr
+	}
+	return total
+}
+
+// canRun returns true if a call of the lane can take a slot. The caller must
+// hold the lock.
+func (s *laneScheduler) canRun(lane Lane) bool {
+	if s.total() >= s.slots {
+		return false
+	}
+	if lane == LaneBulk && s.slots > 1 && s.inFlight[LaneBulk] >= s.slots-1 {
+		return false
+	}
+	return true
+}
+
+// next picks the lane receiving the next free slot among the lanes with
+// waiting calls, or returns false if none can run. The caller must hold the
+// lock.
+func (s *laneScheduler) next() (Lane, bool) {
+	best := -1
+	total := 0
+	for i := range s.waiting {
+		if len(s.waiting[i]) == 0 || !s.canRun(Lane(i)) {
+			continue
+		}
+		s.current[i] += laneWeights[i]
+		total += laneWeights[i]
+		if best < 0 || s.current[i] > s.current[best] {
+			best = i
+		}
+	}
+	if best < 0 {
+		return 0, false
+	}
+	s.current[best] -= total
+	return Lane(best), true
+}
+
+// dispatch hands the free slots to the waiting calls. The caller must hold
+// the lock.
+func (s *laneScheduler) dispatch() {
+	for {
+		lane, ok := s.next()
+		if !ok {
+			return
+		}
+		ch := s.waiting[lane][0]
+		s.waiting[lane] = s.waiting[lane][1:]
+		s.inFlight[lane]++
+		close(ch)
+	}
+}
+
+// acquire waits for a slot for a call of the lane and returns the function
+// releasing it
+func (s *laneScheduler) acquire(ctx context.Context, lane Lane) (func(), error) {
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			s.mtx.Lock()
+			defer s.mtx.Unlock()
+			s.inFlight[lane]--
+			s.dispatch()
+		})
+	}
+
+	s.mtx.Lock()
+	queued := false
+	for _, waiting := range s.waiting {
+		queued = queued || len(waiting) > 0
+	}
+	if !queued && s.canRun(lane) {
+		s.inFlight[lane]++
+		s.mtx.Unlock()
+		return release, nil
+	}
+	ch := make(chan struct{})
+	s.waiting[lane] = append(s.waiting[lane], ch)
+	s.dispatch()
+	s.mtx.Unlock()
+
+	start := time.Now()
+	select {
+	case <-ch:
+		s.mtx.Lock()
+		s.delayed[lane]++
+		s.wait[lane] += time.Since(start)
+		s.mtx.Unlock()
+		return release, nil
+	case <-ctx.Done():
+		s.mtx.Lock()
+		for i, waiting := range s.waiting[lane] {
+			if waiting == ch {
+				s.waiting[lane] = append(s.waiting[lane][:i], s.waiting[lane][i+1:]...)
+				s.mtx.Unlock()
+				return nil, ctx.Err()
+			}
+		}
+		s.mtx.Unlock()
+		// the slot was granted while the context expired
+		release()
+		return nil, ctx.Err()
+	}
+}
+
+func (s *laneScheduler) stats() [len(laneNames)]LaneStats {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	stats := [len(laneNames)]LaneStats{}
+	for i := range stats {
+		stats[i] = LaneStats{InFlight: s.inFlight[i], Queued: len(s.waiting[i]), Delayed: s.delayed[i], Wait: s.wait[i]}
+	}
+	return stats
+}
+
+// rpcLanes holds the lane scheduler of every peer
+type rpcLanes struct {
+	slots int
+
+	mtx        sync.Mutex
+	schedulers map[string]*laneScheduler
+}
+
+func (l *rpcLanes) scheduler(id string) *laneScheduler {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	s, found := l.schedulers[id]
+	if !found {
+		s = newLaneScheduler(l.slots)
+		l.schedulers[id] = s
+	}
+	return s
+}
+
+func (l *rpcLanes) forget(id string) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	delete(l.schedulers, id)
+}
+
+// laneInterceptor schedules the unary calls to a peer through its lanes.
+// Streams are not scheduled since some of them, like commit subscriptions,
+// stay open for the lifetime of the connection.
+func (p2p *P2P) laneInterceptor(id peer.ID) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		release, err := p2p.lanes.scheduler(id.String()).acquire(ctx, methodLane(method))
+		if err != nil {
+			return err
+		}
+		defer release()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// RPCLanes returns the scheduling stats of every lane, summed over all
+// connected peers
+func (p2p *P2P) RPCLanes() map[string]LaneStats {
+	res := map[string]LaneStats{}
+	if p2p.lanes == nil {
+		return res
+	}
+	p2p.lanes.mtx.Lock()
+	schedulers := []*laneScheduler{}
+	for _, s := range p2p.lanes.schedulers {
+		schedulers = append(schedulers, s)
+	}
+	p2p.lanes.mtx.Unlock()
+
+	totals := [len(laneNames)]LaneStats{}
+	for _, s := range schedulers {
+		for i, stats := range s.stats() {
+			totals[i].InFlight += stats.InFlight
+			totals[i].Queued += stats.Queued
+			totals[i].Delayed += stats.Delayed
+			totals[i].Wait += stats.Wait
+		}
+	}
+	for i, stats := range totals {
+		res[laneNames[i]] = stats
+	}
+	return res
+}
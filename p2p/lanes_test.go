@@ -0,0 +1,110 @@
+package p2p
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+func TestMethodLane(t *testing.T) {
+	tests := []struct {
+		method   string
+		expected Lane
+	}{
+		{p2pproto.Pinger_Ping_FullMethodName, LaneControl},
+		{"/proto.DBSyncer/AdvertiseHead", LaneControl},
+		{p2pproto.Tester_ExecSQL_FullMethodName, LaneInteractive},
+		{p2pproto.Admin_GetHealth_FullMethodName, LaneInteractive},
+		{p2pproto.Tester_GetAllCommits_FullMethodName, LaneBulk},
+		{"/dolt.services.remotesapi.v1alpha1.ChunkStoreService/GetDownloadLocations", LaneBulk},
+	}
+	for _, test := range tests {
+		if got := methodLane(test.method); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.method, test.expected, got)
+		}
+	}
+}
+
+func TestLaneScheduler(t *testing.T) {
+	s := newLaneScheduler(2)
+	ctx := context.Background()
+
+	// bulk calls never take the last slot
+	releaseBulk, err := s.acquire(ctx, LaneBulk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := s.acquire(timeoutCtx, LaneBulk); err == nil {
+		t.Fatalf("expected a second bulk call to wait")
+	}
+	releasePing, err := s.acquire(ctx, LaneControl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// with all slots taken, the waiting calls are granted by weight
+	granted := make(chan Lane, 10)
+	wait := func(lane Lane) {
+		go func() {
+			release, err := s.acquire(ctx, lane)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			granted <- lane
+			release()
+		}()
+	}
+	wait(LaneBulk)
+	for s.stats()[LaneBulk].Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	wait(LaneInteractive)
+	for s.stats()[LaneInteractive].Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	releaseBulk()
+	if lane := <-granted; lane != LaneInteractive {
+		t.Errorf("expected the interactive call to be granted first, got %s", lane)
+	}
+	if lane := <-granted; lane != LaneBulk {
+		t.Errorf("expected the bulk call to be granted next, got %s", lane)
+	}
+	releasePing()
+
+	stats := s.stats()
+	if stats[LaneBulk].Delayed != 1 || stats[LaneInteractive].Delayed != 1 || stats[LaneControl].Delayed != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	for _, lane := range stats {
+		if lane.InFlight != 0 || lane.Queued != 0 {
+			t.Errorf("expected all the slots to be released, got %+v", stats)
+		}
+	}
+}
+
+func TestLaneWeights(t *testing.T) {
+	s := newLaneScheduler(1)
+	for i := 0; i < 13; i++ {
+		for lane := range s.waiting {
+			s.waiting[lane] = append(s.waiting[lane], make(chan struct{}))
+		}
+	}
+	counts := map[Lane]int{}
+	for i := 0; i < 13; i++ {
+		lane, ok := s.next()
+		if !ok {
+			t.Fatal("expected a lane to be picked")
+		}
+		counts[lane]++
+		s.waiting[lane] = s.waiting[lane][1:]
+	}
+	if counts[LaneControl] != 8 || counts[LaneInteractive] != 4 || counts[LaneBulk] != 1 {
+		t.Errorf("expected slots to be shared 8/4/1, got %v", counts)
+	}
+}
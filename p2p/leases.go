@@ -0,0 +1,351 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	p2pgrpc "github.com/birros/go-libp2p-grpc"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"github.com/segmentio/ksuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	leaseRPCTimeout = 2 * time.Second
+	maxLeaseTTL     = 10 * time.Minute
+)
+
+// LeaseMode selects the peers that grant leases
+type LeaseMode string
+
+const (
+	// LeaseModeQuorum gets leases granted by a majority of the peers, or of
+	// the voting members when membership is managed. Without managed
+	// membership the majority is over the connected peers, so both sides of a
+	// partition can grant the same lease.
+	LeaseModeQuorum LeaseMode = "quorum"
+	// LeaseModeLeader gets leases granted by the elected leader. It requires
+	// leader election.
+	LeaseModeLeader LeaseMode = "leader"
+)
+
+// ParseLeaseMode parses the name of a lease mode
+func ParseLeaseMode(s string) (LeaseMode, error) {
+	switch LeaseMode(s) {
+	case LeaseModeQuorum, LeaseModeLeader:
+		return LeaseMode(s), nil
+	default:
+		return "", fmt.Errorf("unknown lease mode '%s', expected quorum or leader", s)
+	}
+}
+
+// Lease is a named lock held until it expires or is released
+type Lease struct {
+	Name string `json:"name"`
+	// Token identifies the holder and is required to renew or release the
+	// lease
+	Token string `json:"token"`
+	Owner string `json:"owner"`
+	// Node is the peer that acquired the lease on behalf of the owner
+	Node    string    `json:"node"`
+	Expires time.Time `json:"expires"`
+}
+
+func leaseFromProto(l *p2pproto.Lease) Lease {
+	if l == nil {
+		return Lease{}
+	}
+	return Lease{Name: l.Name, Token: l.Token, Owner: l.Owner, Node: l.Node, Expires: time.Unix(0, l.ExpiresUnixNano)}
+}
+
+func (l Lease) proto() *p2pproto.Lease {
+	return &p2pproto.Lease{Name: l.Name, Token: l.Token, Owner: l.Owner, Node: l.Node, ExpiresUnixNano: l.Expires.UnixNano()}
+}
+
+// leaseTable holds the leases granted by this node. Expiry is measured with
+// the local clock from the moment a grant is received, so the skew between
+// the clocks of the peers doesn't matter.
+type leaseTable struct {
+	mtx    sync.Mutex
+	now    func() time.Time
+	leases map[string]Lease
+}
+
+func newLeaseTable() *leaseTable {
+	return &leaseTable{now: time.Now, leases: map[string]Lease{}}
+}
+
+// grant gives the lease to the requester if it's free, expired, or already
+// held with the same token, in which case it is renewed. It returns the
+// current holder otherwise.
+func (t *leaseTable) grant(req Lease, ttl time.Duration) (Lease, bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	now := t.now()
+	for name, lease := range t.leases {
+		if !lease.Expires.After(now) {
+			delete(t.leases, name)
+		}
+	}
+	current, found := t.leases[req.Name]
+	if found && current.Token != req.Token {
+		return current, false
+	}
+	if found && req.Owner == "" {
+		// renewals don't repeat the owner
+		req.Owner = current.Owner
+	}
+	req.Expires = now.Add(ttl)
+	t.leases[req.Name] = req
+	return req, true
+}
+
+// revoke releases the lease if it's held with the token
+func (t *leaseTable) revoke(name string, token string) bool {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if current, found := t.leases[name]; found && current.Token == token {
+		delete(t.leases, name)
+		return true
+	}
+	return false
+}
+
+func (t *leaseTable) list() []Lease {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	now := t.now()
+	leases := []Lease{}
+	for _, lease := range t.leases {
+		if lease.Expires.After(now) {
+			leases = append(leases, lease)
+		}
+	}
+	return leases
+}
+
+// leaseServer serves the Leases service. Applications acquire leases through
+// any node, which gets them granted by the leader or by a quorum of peers.
+type leaseServer struct {
+	p2pproto.UnimplementedLeasesServer
+	p2p *P2P
+}
+
+func leaseTTL(ttlMs int64) (time.Duration, error) {
+	ttl := time.Duration(ttlMs) * time.Millisecond
+	if ttl <= 0 || ttl > maxLeaseTTL {
+		return 0, status.Errorf(codes.InvalidArgument, "lease TTL has to be between 1ms and %s", maxLeaseTTL)
+	}
+	return ttl, nil
+}
+
+func (s *leaseServer) Acquire(ctx context.Context, req *p2pproto.AcquireLeaseRequest) (*p2pproto.Lease, error) {
+	ttl, err := leaseTTL(req.TtlMs)
+	if err != nil {
+		return nil, err
+	}
+	lease, err := s.p2p.AcquireLease(ctx, req.Name, req.Owner, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return lease.proto(), nil
+}
+
+func (s *leaseServer) Renew(ctx context.Context, req *p2pproto.RenewLeaseRequest) (*p2pproto.Lease, error) {
+	ttl, err := leaseTTL(req.TtlMs)
+	if err != nil {
+		return nil, err
+	}
+	lease, err := s.p2p.RenewLease(ctx, Lease{Name: req.Name, Token: req.Token}, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return lease.proto(), nil
+}
+
+func (s *leaseServer) Release(ctx context.Context, req *p2pproto.ReleaseLeaseRequest) (*p2pproto.ReleaseLeaseResponse, error) {
+	return &p2pproto.ReleaseLeaseResponse{}, s.p2p.ReleaseLease(ctx, Lease{Name: req.Name, Token: req.Token})
+}
+
+// Grant is called by the peer acquiring or renewing a lease
+func (s *leaseServer) Grant(ctx context.Context, req *p2pproto.GrantLeaseRequest) (*p2pproto.GrantLeaseResponse, error) {
+	remotePeer, ok := p2pgrpc.RemotePeerFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "no AuthInfo in context")
+	}
+	ttl, err := leaseTTL(req.TtlMs)
+	if err != nil {
+		return nil, err
+	}
+	holder, granted := s.p2p.leases.grant(Lease{Name: req.Name, Token: req.Token, Owner: req.Owner, Node: remotePeer.String()}, ttl)
+	return &p2pproto.GrantLeaseResponse{Granted: granted, Holder: holder.proto()}, nil
+}
+
+// Revoke is called by the peer releasing a lease
+func (s *leaseServer) Revoke(ctx context.Context, req *p2pproto.ReleaseLeaseRequest) (*p2pproto.ReleaseLeaseResponse, error) {
+	s.p2p.leases.revoke(req.Name, req.Token)
+	return &p2pproto.ReleaseLeaseResponse{}, nil
+}
+
+// leaseGranters returns the peers asked to grant leases, and the number of
+// grants required, ourselves included
+func (p2p *P2P) leaseGranters() ([]*P2PClient, int, bool, error) {
+	if p2p.leaseMode == LeaseModeLeader {
+		leader := p2p.Leader()
+		switch {
+		case p2p.elector == nil:
+			return nil, 0, false, status.Error(codes.FailedPrecondition, "leader leases require leader election")
+		case leader == "":
+			return nil, 0, false, status.Error(codes.Unavailable, "no leader elected")
+		case leader == p2p.GetID():
+			return nil, 1, true, nil
+		}
+		client, found := p2p.clients.Get(leader)
+		if !found {
+			return nil, 0, false, status.Errorf(codes.Unavailable, "leader '%s' is not connected", leader)
+		}
+		return []*P2PClient{client.(*P2PClient)}, 1, false, nil
+	}
+
+	clients := []*P2PClient{}
+	for _, client := range p2p.GetClients() {
+		if client.Supports(p2pproto.Leases_Grant_FullMethodName) {
+			clients = append(clients, client)
+		}
+	}
+	// with managed membership, the majority is computed over the voting
+	// members even if some of them are not connected
+	nrPeers := len(clients)
+	if members := p2p.members(); members.Managed() {
+		nrPeers = p2p.voters(members)
+	}
+	return clients, (nrPeers+1)/2 + 1, true, nil
+}
+
+// grantLease gets the lease granted by the leader or by a quorum. The lease
+// expires for the holder after the TTL measured from the moment the grants
+// were requested, which is never later than on the granting peers.
+func (p2p *P2P) grantLease(ctx context.Context, lease Lease, ttl time.Duration) (Lease, error) {
+	clients, required, local, err := p2p.leaseGranters()
+	if err != nil {
+		return Lease{}, err
+	}
+
+	start := time.Now()
+	granted := 0
+	var holder Lease
+	grantedBy := []*P2PClient{}
+	if local {
+		current, ok := p2p.leases.grant(lease, ttl)
+		if ok {
+			granted++
+			lease.Owner = current.Owner
+		} else {
+			holder = current
+		}
+	}
+
+	type grant struct {
+		client *P2PClient
+		resp   *p2pproto.GrantLeaseResponse
+		err    error
+	}
+	grants := make(chan grant, len(clients))
+	for _, client := range clients {
+		go func(client *P2PClient) {
+			rctx, cancel := context.WithTimeout(ctx, leaseRPCTimeout)
+			defer cancel()
+			resp, err := client.Grant(rctx, &p2pproto.GrantLeaseRequest{Name: lease.Name, Token: lease.Token, Owner: lease.Owner, TtlMs: ttl.Milliseconds()})
+			grants <- grant{client: client, resp: resp, err: err}
+		}(client)
+	}
+	for range clients {
+		g := <-grants
+		switch {
+		case g.err != nil:
+			p2p.log.Debugf("Peer '%s' did not grant lease '%s': %v", g.client.GetID(), lease.Name, g.err)
+		case g.resp.Granted:
+			granted++
+			grantedBy = append(grantedBy, g.client)
+			if lease.Owner == "" && g.resp.Holder != nil {
+				lease.Owner = g.resp.Holder.Owner
+			}
+		default:
+			holder = leaseFromProto(g.resp.Holder)
+		}
+	}
+
+	if granted < required {
+		// give back the partial grants so that they don't block other
+		// acquirers until they expire
+		if local {
+			p2p.leases.revoke(lease.Name, lease.Token)
+		}
+		p2p.revokeLease(grantedBy, lease)
+		if holder.Token != "" {
+			return Lease{}, status.Errorf(codes.FailedPrecondition, "lease '%s' is held by '%s' on '%s'", lease.Name, holder.Owner, holder.Node)
+		}
+		return Lease{}, status.Errorf(codes.Unavailable, "lease '%s' was granted by %d peers, %d required", lease.Name, granted, required)
+	}
+	lease.Expires = start.Add(ttl)
+	return lease, nil
+}
+
+func (p2p *P2P) revokeLease(clients []*P2PClient, lease Lease) {
+	for _, client := range clients {
+		ctx, cancel := context.WithTimeout(context.Background(), leaseRPCTimeout)
+		_, err := client.Revoke(ctx, &p2pproto.ReleaseLeaseRequest{Name: lease.Name, Token: lease.Token})
+		cancel()
+		if err != nil {
+			p2p.log.Debugf("Failed to revoke lease '%s' on '%s': %v", lease.Name, client.GetID(), err)
+		}
+	}
+}
+
+// AcquireLease acquires a named lease for the owner, e.g. to run a migration
+// or a singleton job on one node at a time. It fails with FailedPrecondition
+// if another holder has it. The lease has to be renewed before it expires,
+// using the returned token.
+func (p2p *P2P) AcquireLease(ctx context.Context, name string, owner string, ttl time.Duration) (Lease, error) {
+	if name == "" {
+		return Lease{}, status.Error(codes.InvalidArgument, "lease name is required")
+	}
+	lease := Lease{Name: name, Token: ksuid.New().String(), Owner: owner, Node: p2p.GetID()}
+	return p2p.grantLease(ctx, lease, ttl)
+}
+
+// RenewLease extends a lease held with the token. It fails if the lease
+// expired and was acquired by another holder in the meantime.
+func (p2p *P2P) RenewLease(ctx context.Context, lease Lease, ttl time.Duration) (Lease, error) {
+	if lease.Name == "" || lease.Token == "" {
+		return Lease{}, status.Error(codes.InvalidArgument, "lease name and token are required")
+	}
+	if lease.Node == "" {
+		lease.Node = p2p.GetID()
+	}
+	return p2p.grantLease(ctx, lease, ttl)
+}
+
+// ReleaseLease gives up a lease held with the token
+func (p2p *P2P) ReleaseLease(ctx context.Context, lease Lease) error {
+	if lease.Name == "" || lease.Token == "" {
+		return status.Error(codes.InvalidArgument, "lease name and token are required")
+	}
+	clients, _, local, err := p2p.leaseGranters()
+	if err != nil {
+		return err
+	}
+	if local {
+		p2p.leases.revoke(lease.Name, lease.Token)
+	}
+	p2p.revokeLease(clients, lease)
+	return nil
+}
+
+// Leases returns the unexpired leases granted by this node
+func (p2p *P2P) Leases() []Lease {
+	return p2p.leases.list()
+}
@@ -0,0 +1,48 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLeaseTable(t *testing.T) {
+	now := time.Now()
+	table := newLeaseTable()
+	table.now = func() time.Time { return now }
+
+	a := Lease{Name: "migration", Token: "a", Owner: "job-a", Node: "peer-a"}
+	b := Lease{Name: "migration", Token: "b", Owner: "job-b", Node: "peer-b"}
+	if _, ok := table.grant(a, time.Minute); !ok {
+		t.Fatal("expected a free lease to be granted")
+	}
+	holder, ok := table.grant(b, time.Minute)
+	if ok || holder.Owner != "job-a" {
+		t.Fatalf("expected the lease to be held by job-a, got %+v", holder)
+	}
+
+	// renewals are granted with the token of the holder, and keep the owner
+	now = now.Add(30 * time.Second)
+	renewed, ok := table.grant(Lease{Name: "migration", Token: "a", Node: "peer-a"}, time.Minute)
+	if !ok || renewed.Owner != "job-a" || !renewed.Expires.Equal(now.Add(time.Minute)) {
+		t.Fatalf("unexpected renewal %+v", renewed)
+	}
+
+	if table.revoke("migration", "b") {
+		t.Error("expected a release with the wrong token to be refused")
+	}
+
+	// expired leases can be acquired by someone else
+	now = now.Add(2 * time.Minute)
+	if len(table.list()) != 0 {
+		t.Error("expected expired leases not to be listed")
+	}
+	if _, ok := table.grant(b, time.Minute); !ok {
+		t.Fatal("expected an expired lease to be granted")
+	}
+	if !table.revoke("migration", "b") {
+		t.Error("expected the holder to release the lease")
+	}
+	if _, ok := table.grant(a, time.Minute); !ok {
+		t.Error("expected a released lease to be granted")
+	}
+}
@@ -0,0 +1,42 @@
+package p2p
+
+import (
+	"github.com/nustiueudinastea/doltswarmdemo/membership"
+)
+
+// MemberSource returns the authoritative member set of the cluster
+type MemberSource interface {
+	Members() (membership.Set, error)
+}
+
+// members returns the member set. It is empty if membership is not managed,
+// in which case the connected peers are the members.
+func (p2p *P2P) members() membership.Set {
+	if p2p.membership == nil {
+		return membership.Set{}
+	}
+	members, err := p2p.membership.Members()
+	if err != nil {
+		p2p.log.Errorf("Failed to read cluster members: %v", err)
+		return membership.Set{}
+	}
+	return members
+}
+
+// isRemoved returns true if the peer was removed from the cluster
+func isRemoved(members membership.Set, id string) bool {
+	member, found := members.Get(id)
+	return found && member.State == membership.StateRemoved
+}
+
+// voters returns the number of peers, other than us, whose acknowledgement
+// counts towards a quorum
+func (p2p *P2P) voters(members membership.Set) int {
+	nr := 0
+	for _, id := range members.Voters() {
+		if id != p2p.GetID() {
+			nr++
+		}
+	}
+	return nr
+}
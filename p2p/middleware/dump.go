@@ -0,0 +1,413 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const redacted = "[redacted]"
+
+// Directions of the dumped messages
+const (
+	DumpIn  = "in"
+	DumpOut = "out"
+)
+
+// Kinds of the dumped messages
+const (
+	DumpRequest  = "request"
+	DumpResponse = "response"
+	DumpError    = "error"
+)
+
+// defaultRedacted are the fields whose values are never dumped
+var defaultRedacted = []string{"password", "passphrase", "token", "session_token", "secret", "private_key"}
+
+// DumpConfig configures the protocol dump
+type DumpConfig struct {
+	// Entries is the size of the ring buffer holding the recent messages
+	Entries int
+	// File is where the messages are also appended as JSON lines, if set
+	File string
+	// MaxFileBytes caps the file, which is rotated to <file>.1 when it's
+	// reached
+	MaxFileBytes int64
+	// MaxMessageBytes truncates the decoded messages
+	MaxMessageBytes int
+	// Rate is the number of messages dumped per second, with bursts of Burst
+	// messages. The others are dropped.
+	Rate  float64
+	Burst int
+	// Redact are the names of the fields whose values are replaced, in
+	// addition to passwords, tokens and secrets
+	Redact []string
+	// Methods restricts the dump to the methods containing any of the
+	// substrings
+	Methods []string
+	// Ignore are the full names of the methods never dumped
+	Ignore []string
+}
+
+// DumpEntry is a decoded message
+type DumpEntry struct {
+	Time      time.Time `json:"time"`
+	Peer      string    `json:"peer"`
+	Method    string    `json:"method"`
+	Direction string    `json:"direction"`
+	Kind      string    `json:"kind"`
+	// Message is the message in JSON, or the status of errors
+	Message   string `json:"message"`
+	Size      int    `json:"size"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// DumpStatus reports the state of the protocol dump
+type DumpStatus struct {
+	Enabled  bool   `json:"enabled"`
+	Recorded int64  `json:"recorded"`
+	Dropped  int64  `json:"dropped"`
+	File     string `json:"file,omitempty"`
+}
+
+// Dumper records the messages of the calls served and made by the node, in a
+// ring buffer and optionally a file. It's meant for protocol debugging: it
+// can be turned on and off at runtime, and costs nothing while it's off.
+type Dumper struct {
+	cfg     DumpConfig
+	redact  map[string]bool
+	ignore  map[string]bool
+	limiter *rate.Limiter
+
+	enabled  atomic.Bool
+	recorded atomic.Int64
+	dropped  atomic.Int64
+
+	mtx      sync.Mutex
+	ring     []DumpEntry
+	next     int
+	file     *os.File
+	fileSize int64
+}
+
+// NewDumper creates a disabled dumper
+func NewDumper(cfg DumpConfig) *Dumper {
+	if cfg.Entries <= 0 {
+		cfg.Entries = 1000
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = 1
+	}
+	d := &Dumper{
+		cfg:     cfg,
+		redact:  map[string]bool{},
+		ignore:  map[string]bool{},
+		limiter: rate.NewLimiter(rate.Limit(cfg.Rate), cfg.Burst),
+		ring:    make([]DumpEntry, 0, cfg.Entries),
+	}
+	if cfg.Rate <= 0 {
+		d.limiter.SetLimit(rate.Inf)
+	}
+	for _, field := range append(defaultRedacted, cfg.Redact...) {
+		d.redact[strings.ToLower(field)] = true
+	}
+	for _, method := range cfg.Ignore {
+		d.ignore[method] = true
+	}
+	return d
+}
+
+// SetEnabled turns the dump on or off. The file is opened when the dump is
+// turned on and closed when it's turned off.
+func (d *Dumper) SetEnabled(enabled bool) error {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if enabled == d.enabled.Load() {
+		return nil
+	}
+	if !enabled {
+		d.enabled.Store(false)
+		return d.closeFile()
+	}
+	if d.cfg.File != "" {
+		f, err := os.OpenFile(d.cfg.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to open the protocol dump file: %w", err)
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		d.file = f
+		d.fileSize = info.Size()
+	}
+	d.enabled.Store(true)
+	return nil
+}
+
+// Status returns the state of the dump
+func (d *Dumper) Status() DumpStatus {
+	return DumpStatus{
+		Enabled:  d.enabled.Load(),
+		Recorded: d.recorded.Load(),
+		Dropped:  d.dropped.Load(),
+		File:     d.cfg.File,
+	}
+}
+
+// Entries returns the most recent messages, oldest first. A zero limit
+// returns all the messages of the ring buffer.
+func (d *Dumper) Entries(limit int) []DumpEntry {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	entries := make([]DumpEntry, 0, len(d.ring))
+	if len(d.ring) == cap(d.ring) {
+		entries = append(entries, d.ring[d.next:]...)
+	}
+	entries = append(entries, d.ring[:d.next]...)
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries
+}
+
+// Close turns the dump off
+func (d *Dumper) Close() error {
+	return d.SetEnabled(false)
+}
+
+func (d *Dumper) closeFile() error {
+	if d.file == nil {
+		return nil
+	}
+	err := d.file.Close()
+	d.file = nil
+	return err
+}
+
+// dumps returns true if the messages of the method are dumped
+func (d *Dumper) dumps(method string) bool {
+	if !d.enabled.Load() || d.ignore[method] {
+		return false
+	}
+	if len(d.cfg.Methods) == 0 {
+		return true
+	}
+	for _, filter := range d.cfg.Methods {
+		if strings.Contains(method, filter) {
+			return true
+		}
+	}
+	return false
+}
+
+// record dumps a message, or an error if err isn't nil
+func (d *Dumper) record(peerID string, method string, direction string, kind string, msg any, err error) {
+	if !d.limiter.Allow() {
+		d.dropped.Add(1)
+		return
+	}
+	entry := DumpEntry{Time: time.Now(), Peer: peerID, Method: method, Direction: direction, Kind: kind}
+	if err != nil {
+		entry.Kind = DumpError
+		entry.Message = status.Convert(err).String()
+	} else {
+		entry.Message, entry.Size = d.decode(msg)
+	}
+	if d.cfg.MaxMessageBytes > 0 && len(entry.Message) > d.cfg.MaxMessageBytes {
+		entry.Message = entry.Message[:d.cfg.MaxMessageBytes]
+		entry.Truncated = true
+	}
+	d.recorded.Add(1)
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if len(d.ring) < cap(d.ring) {
+		d.ring = append(d.ring, entry)
+	} else {
+		d.ring[d.next] = entry
+	}
+	d.next = (d.next + 1) % cap(d.ring)
+	if d.file != nil {
+		d.write(entry)
+	}
+}
+
+// write appends an entry to the file, rotating it first if it's full
+func (d *Dumper) write(entry DumpEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+	if d.cfg.MaxFileBytes > 0 && d.fileSize+int64(len(line)) > d.cfg.MaxFileBytes {
+		d.closeFile()
+		os.Rename(d.cfg.File, d.cfg.File+".1")
+		f, err := os.OpenFile(d.cfg.File, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return
+		}
+		d.file = f
+		d.fileSize = 0
+	}
+	n, _ := d.file.Write(line)
+	d.fileSize += int64(n)
+}
+
+// decode returns a redacted copy of a message in JSON and the size of the
+// message on the wire
+func (d *Dumper) decode(msg any) (string, int) {
+	m, ok := msg.(proto.Message)
+	if !ok {
+		return fmt.Sprintf("%T", msg), 0
+	}
+	size := proto.Size(m)
+	m = proto.Clone(m)
+	d.redactMessage(m.ProtoReflect())
+	data, err := protojson.Marshal(m)
+	if err != nil {
+		return fmt.Sprintf("%T: %v", msg, err), size
+	}
+	return string(data), size
+}
+
+// redactMessage replaces the values of the redacted fields, in the message and
+// the messages it holds
+func (d *Dumper) redactMessage(m protoreflect.Message) {
+	fields := []protoreflect.FieldDescriptor{}
+	m.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fields = append(fields, fd)
+		return true
+	})
+	for _, fd := range fields {
+		isMessage := fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind
+		switch {
+		case d.redact[strings.ToLower(string(fd.Name()))]:
+			switch {
+			case fd.IsList() || fd.IsMap() || isMessage:
+				m.Clear(fd)
+			case fd.Kind() == protoreflect.StringKind:
+				m.Set(fd, protoreflect.ValueOfString(redacted))
+			case fd.Kind() == protoreflect.BytesKind:
+				m.Set(fd, protoreflect.ValueOfBytes([]byte(redacted)))
+			default:
+				m.Clear(fd)
+			}
+		case fd.IsList() && isMessage:
+			list := m.Mutable(fd).List()
+			for i := 0; i < list.Len(); i++ {
+				d.redactMessage(list.Get(i).Message())
+			}
+		case fd.IsMap():
+			if kind := fd.MapValue().Kind(); kind == protoreflect.MessageKind || kind == protoreflect.GroupKind {
+				m.Mutable(fd).Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+					d.redactMessage(v.Message())
+					return true
+				})
+			}
+		case isMessage:
+			d.redactMessage(m.Mutable(fd).Message())
+		}
+	}
+}
+
+// Interceptors dump the messages received and sent by the server
+func (d *Dumper) Interceptors() (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	unary := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !d.dumps(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		peerID := remotePeer(ctx)
+		d.record(peerID, info.FullMethod, DumpIn, DumpRequest, req, nil)
+		resp, err := handler(ctx, req)
+		d.record(peerID, info.FullMethod, DumpOut, DumpResponse, resp, err)
+		return resp, err
+	}
+	stream := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !d.dumps(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		dumped := &dumpedServerStream{ServerStream: ss, dumper: d, peer: remotePeer(ss.Context()), method: info.FullMethod}
+		err := handler(srv, dumped)
+		if err != nil {
+			d.record(dumped.peer, info.FullMethod, DumpOut, DumpError, nil, err)
+		}
+		return err
+	}
+	return unary, stream
+}
+
+// ClientInterceptors dump the messages sent and received by the node when it
+// calls its peers
+func (d *Dumper) ClientInterceptors() (grpc.UnaryClientInterceptor, grpc.StreamClientInterceptor) {
+	unary := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if !d.dumps(method) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		d.record(cc.Target(), method, DumpOut, DumpRequest, req, nil)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		d.record(cc.Target(), method, DumpIn, DumpResponse, reply, err)
+		return err
+	}
+	stream := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil || !d.dumps(method) {
+			return cs, err
+		}
+		return &dumpedClientStream{ClientStream: cs, dumper: d, peer: cc.Target(), method: method}, nil
+	}
+	return unary, stream
+}
+
+type dumpedServerStream struct {
+	grpc.ServerStream
+	dumper *Dumper
+	peer   string
+	method string
+}
+
+func (s *dumpedServerStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.dumper.record(s.peer, s.method, DumpIn, DumpRequest, m, nil)
+	}
+	return err
+}
+
+func (s *dumpedServerStream) SendMsg(m any) error {
+	s.dumper.record(s.peer, s.method, DumpOut, DumpResponse, m, nil)
+	return s.ServerStream.SendMsg(m)
+}
+
+type dumpedClientStream struct {
+	grpc.ClientStream
+	dumper *Dumper
+	peer   string
+	method string
+}
+
+func (s *dumpedClientStream) SendMsg(m any) error {
+	s.dumper.record(s.peer, s.method, DumpOut, DumpRequest, m, nil)
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *dumpedClientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		s.dumper.record(s.peer, s.method, DumpIn, DumpResponse, m, nil)
+	}
+	return err
+}
@@ -0,0 +1,178 @@
+// Package middleware provides gRPC interceptors for the p2p server and clients
+package middleware
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	p2pgrpc "github.com/birros/go-libp2p-grpc"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// remotePeer returns the ID of the calling peer, or an empty string if the
+// call doesn't come over libp2p
+func remotePeer(ctx context.Context) string {
+	id, ok := p2pgrpc.RemotePeerFromContext(ctx)
+	if !ok {
+		return ""
+	}
+	return id.String()
+}
+
+// PanicHandler is called with the method, the recovered value and the stack
+// trace of a panic in a handler
+type PanicHandler func(method string, recovered any, stack []byte)
+
+// Recovery turns panics in handlers into Internal errors after passing them to
+// the handler, which decides whether the node keeps running
+func Recovery(handle PanicHandler) (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	recovered := func(method string, r any) error {
+		handle(method, r, debug.Stack())
+		return status.Errorf(codes.Internal, "panic in %s", method)
+	}
+	unary := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(info.FullMethod, r)
+			}
+		}()
+		return handler(ctx, req)
+	}
+	stream := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recovered(info.FullMethod, r)
+			}
+		}()
+		return handler(srv, ss)
+	}
+	return unary, stream
+}
+
+// Logging logs every call with its peer, duration and status code at trace
+// level
+func Logging(logger *logrus.Logger) (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	log := func(ctx context.Context, method string, start time.Time, err error) {
+		logger.WithFields(logrus.Fields{
+			"peer":     remotePeer(ctx),
+			"method":   method,
+			"code":     status.Code(err).String(),
+			"duration": time.Since(start),
+		}).Trace("rpc")
+	}
+	unary := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		log(ctx, info.FullMethod, start, err)
+		return resp, err
+	}
+	stream := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		log(ss.Context(), info.FullMethod, start, err)
+		return err
+	}
+	return unary, stream
+}
+
+// Observer is notified of every completed call
+type Observer func(peerID string, method string, code codes.Code, duration time.Duration)
+
+// Metrics reports every call to the observer
+func Metrics(observe Observer) (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	unary := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		observe(remotePeer(ctx), info.FullMethod, status.Code(err), time.Since(start))
+		return resp, err
+	}
+	stream := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		observe(remotePeer(ss.Context()), info.FullMethod, status.Code(err), time.Since(start))
+		return err
+	}
+	return unary, stream
+}
+
+// Auth rejects the calls the allow function doesn't accept with a
+// PermissionDenied status
+func Auth(allow func(peerID string, method string) bool) (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	unary := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		peerID := remotePeer(ctx)
+		if !allow(peerID, info.FullMethod) {
+			return nil, status.Errorf(codes.PermissionDenied, "peer '%s' is not allowed to call %s", peerID, info.FullMethod)
+		}
+		return handler(ctx, req)
+	}
+	stream := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		peerID := remotePeer(ss.Context())
+		if !allow(peerID, info.FullMethod) {
+			return status.Errorf(codes.PermissionDenied, "peer '%s' is not allowed to call %s", peerID, info.FullMethod)
+		}
+		return handler(srv, ss)
+	}
+	return unary, stream
+}
+
+// RateLimiter limits the rate of calls of every peer with a token bucket
+type RateLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mtx      sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+// NewRateLimiter allows every peer to make perSecond calls per second, with
+// bursts of up to burst calls
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		limit:    rate.Limit(perSecond),
+		burst:    burst,
+		limiters: map[string]*rate.Limiter{},
+	}
+}
+
+// Allow returns true if the peer can make another call
+func (rl *RateLimiter) Allow(peerID string) bool {
+	rl.mtx.Lock()
+	limiter, found := rl.limiters[peerID]
+	if !found {
+		limiter = rate.NewLimiter(rl.limit, rl.burst)
+		rl.limiters[peerID] = limiter
+	}
+	rl.mtx.Unlock()
+	return limiter.Allow()
+}
+
+// Forget drops the state of a peer, e.g. when it disconnects
+func (rl *RateLimiter) Forget(peerID string) {
+	rl.mtx.Lock()
+	delete(rl.limiters, peerID)
+	rl.mtx.Unlock()
+}
+
+// Interceptors returns interceptors that reject calls over the limit with a
+// ResourceExhausted status
+func (rl *RateLimiter) Interceptors() (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	unary := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !rl.Allow(remotePeer(ctx)) {
+			return nil, status.Errorf(codes.ResourceExhausted, "rate limit exceeded for %s", info.FullMethod)
+		}
+		return handler(ctx, req)
+	}
+	stream := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !rl.Allow(remotePeer(ss.Context())) {
+			return status.Errorf(codes.ResourceExhausted, "rate limit exceeded for %s", info.FullMethod)
+		}
+		return handler(srv, ss)
+	}
+	return unary, stream
+}
@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRecovery(t *testing.T) {
+	handled := ""
+	unary, _ := Recovery(func(method string, recovered any, stack []byte) {
+		handled = method
+	})
+	_, err := unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/test"}, func(ctx context.Context, req any) (any, error) {
+		panic("boom")
+	})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("expected Internal, got %v", err)
+	}
+	if handled != "/test" {
+		t.Errorf("expected the panic to be handled, got '%s'", handled)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	rl := NewRateLimiter(0.001, 2)
+	if !rl.Allow("a") || !rl.Allow("a") {
+		t.Fatal("expected the burst to be allowed")
+	}
+	if rl.Allow("a") {
+		t.Error("expected the call over the burst to be rejected")
+	}
+	if !rl.Allow("b") {
+		t.Error("expected peers to have separate limits")
+	}
+	rl.Forget("a")
+	if !rl.Allow("a") {
+		t.Error("expected a forgotten peer to start with a full bucket")
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	w := NewWatchdog(logrus.New(), 10*time.Millisecond, 0, true)
+	unary, _ := w.Interceptors()
+
+	started := make(chan struct{})
+	result := make(chan error)
+	go func() {
+		_, err := unary(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/test"}, func(ctx context.Context, req any) (any, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		result <- err
+	}()
+	<-started
+
+	if stalls := w.Check(); len(stalls) != 0 {
+		t.Fatalf("expected no stalls before the deadline, got %v", stalls)
+	}
+	time.Sleep(20 * time.Millisecond)
+	stalls := w.Check()
+	if len(stalls) != 1 || stalls[0].Kind != StallHandler || stalls[0].Method != "/test" {
+		t.Fatalf("expected a stuck handler, got %v", stalls)
+	}
+	if err := <-result; err != context.Canceled {
+		t.Errorf("expected the handler to be reset, got %v", err)
+	}
+	if len(w.Check()) != 0 || w.Stalls() != 1 {
+		t.Error("expected the stall to be reported once")
+	}
+}
+
+func TestDumper(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "dump.jsonl")
+	d := NewDumper(DumpConfig{Entries: 3, File: file, MaxMessageBytes: 64, Rate: 0.001, Burst: 4, Redact: []string{"values"}, Ignore: []string{"/ignored"}})
+	unary, _ := d.Interceptors()
+	call := func(method string, req *p2pproto.QueryRequest) {
+		unary(context.Background(), req, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req any) (any, error) {
+			return &p2pproto.QueryResponse{Columns: []string{"id"}, Rows: []*p2pproto.Row{{Values: []string{"secret row"}}}}, nil
+		})
+	}
+
+	call("/test", &p2pproto.QueryRequest{Statement: "SELECT 1"})
+	if len(d.Entries(0)) != 0 {
+		t.Fatal("expected nothing to be dumped while the dump is off")
+	}
+	if err := d.SetEnabled(true); err != nil {
+		t.Fatal(err)
+	}
+	call("/ignored", &p2pproto.QueryRequest{Statement: "SELECT 1"})
+	call("/test", &p2pproto.QueryRequest{Statement: "SELECT 1", SessionToken: "hunter2"})
+	entries := d.Entries(0)
+	if len(entries) != 2 || entries[0].Kind != DumpRequest || entries[1].Direction != DumpOut {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	if strings.Contains(entries[0].Message, "hunter2") || !strings.Contains(entries[0].Message, redacted) {
+		t.Errorf("expected the session token to be redacted, got %s", entries[0].Message)
+	}
+	if strings.Contains(entries[1].Message, "secret row") {
+		t.Errorf("expected the nested values to be redacted, got %s", entries[1].Message)
+	}
+
+	// the ring buffer keeps the most recent messages, and the rate limit drops
+	// the messages over the burst
+	call("/test", &p2pproto.QueryRequest{Statement: "SELECT '" + strings.Repeat("x", 100) + "'"})
+	call("/test", &p2pproto.QueryRequest{Statement: "SELECT 3"})
+	entries = d.Entries(0)
+	if len(entries) != 3 || !entries[1].Truncated || len(entries[1].Message) != 64 {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+	if status := d.Status(); status.Recorded != 4 || status.Dropped != 2 {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 4 {
+		t.Errorf("expected 4 dumped lines, got %d", lines)
+	}
+}
@@ -0,0 +1,202 @@
+package middleware
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+)
+
+// Stall kinds reported by the watchdog
+const (
+	StallHandler = "handler"
+	StallWriter  = "writer"
+	StallReader  = "reader"
+)
+
+// Stall is a call the watchdog found stuck
+type Stall struct {
+	Peer     string
+	Method   string
+	Kind     string
+	Duration time.Duration
+}
+
+type watchedCall struct {
+	peer   string
+	method string
+	stream bool
+	start  time.Time
+	cancel context.CancelFunc
+
+	// unix nanoseconds of the last message, and of the start of the send in
+	// progress, or 0 if there is none
+	lastActivity atomic.Int64
+	sendingSince atomic.Int64
+	reported     bool
+}
+
+// Watchdog detects unary handlers running past a deadline, streams blocked on
+// sending a message, and streams without any traffic. It logs every stall
+// and can cancel the context of the stuck call to reset it.
+type Watchdog struct {
+	log      *logrus.Logger
+	deadline time.Duration
+	idle     time.Duration
+	reset    bool
+	stalls   atomic.Int64
+
+	mtx    sync.Mutex
+	calls  map[uint64]*watchedCall
+	nextID uint64
+}
+
+// NewWatchdog creates a watchdog. Handlers and sends are stuck after the
+// deadline, and streams are stuck after being idle for the idle timeout. A
+// zero idle timeout disables the idle check.
+func NewWatchdog(logger *logrus.Logger, deadline time.Duration, idle time.Duration, reset bool) *Watchdog {
+	return &Watchdog{
+		log:      logger,
+		deadline: deadline,
+		idle:     idle,
+		reset:    reset,
+		calls:    map[uint64]*watchedCall{},
+	}
+}
+
+// Stalls returns the number of stalls detected so far
+func (w *Watchdog) Stalls() int64 {
+	return w.stalls.Load()
+}
+
+func (w *Watchdog) track(ctx context.Context, method string, stream bool) (context.Context, func(), *watchedCall) {
+	ctx, cancel := context.WithCancel(ctx)
+	call := &watchedCall{peer: remotePeer(ctx), method: method, stream: stream, start: time.Now(), cancel: cancel}
+	call.lastActivity.Store(call.start.UnixNano())
+
+	w.mtx.Lock()
+	id := w.nextID
+	w.nextID++
+	w.calls[id] = call
+	w.mtx.Unlock()
+
+	done := func() {
+		w.mtx.Lock()
+		delete(w.calls, id)
+		w.mtx.Unlock()
+		cancel()
+	}
+	return ctx, done, call
+}
+
+// Interceptors returns the interceptors that register calls with the watchdog
+func (w *Watchdog) Interceptors() (grpc.UnaryServerInterceptor, grpc.StreamServerInterceptor) {
+	unary := func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, done, _ := w.track(ctx, info.FullMethod, false)
+		defer done()
+		return handler(ctx, req)
+	}
+	stream := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, done, call := w.track(ss.Context(), info.FullMethod, true)
+		defer done()
+		return handler(srv, &watchedStream{ServerStream: ss, ctx: ctx, call: call})
+	}
+	return unary, stream
+}
+
+// Check returns the calls that got stuck since the last check, logging them
+// and resetting them if enabled
+func (w *Watchdog) Check() []Stall {
+	now := time.Now()
+	stalls := []Stall{}
+
+	w.mtx.Lock()
+	for _, call := range w.calls {
+		if call.reported {
+			continue
+		}
+		stall := Stall{Peer: call.peer, Method: call.method}
+		sendingSince := call.sendingSince.Load()
+		lastActivity := time.Unix(0, call.lastActivity.Load())
+		switch {
+		case !call.stream && now.Sub(call.start) > w.deadline:
+			stall.Kind, stall.Duration = StallHandler, now.Sub(call.start)
+		case sendingSince > 0 && now.Sub(time.Unix(0, sendingSince)) > w.deadline:
+			stall.Kind, stall.Duration = StallWriter, now.Sub(time.Unix(0, sendingSince))
+		case call.stream && w.idle > 0 && now.Sub(lastActivity) > w.idle:
+			stall.Kind, stall.Duration = StallReader, now.Sub(lastActivity)
+		default:
+			continue
+		}
+		call.reported = true
+		if w.reset {
+			call.cancel()
+		}
+		stalls = append(stalls, stall)
+	}
+	w.mtx.Unlock()
+
+	for _, stall := range stalls {
+		w.stalls.Add(1)
+		w.log.WithFields(logrus.Fields{
+			"peer":       stall.Peer,
+			"method":     stall.Method,
+			"kind":       stall.Kind,
+			"duration":   stall.Duration,
+			"goroutines": runtime.NumGoroutine(),
+			"reset":      w.reset,
+		}).Warn("Stuck RPC detected")
+	}
+	return stalls
+}
+
+// Start checks the calls periodically
+func (w *Watchdog) Start(interval time.Duration) func() error {
+	stopSignal := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.Check()
+			case <-stopSignal:
+				return
+			}
+		}
+	}()
+	return func() error {
+		close(stopSignal)
+		return nil
+	}
+}
+
+// watchedStream records the traffic of a stream and replaces its context with
+// one the watchdog can cancel
+type watchedStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	call *watchedCall
+}
+
+func (s *watchedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *watchedStream) SendMsg(m any) error {
+	s.call.sendingSince.Store(time.Now().UnixNano())
+	err := s.ServerStream.SendMsg(m)
+	s.call.sendingSince.Store(0)
+	s.call.lastActivity.Store(time.Now().UnixNano())
+	return err
+}
+
+func (s *watchedStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	s.call.lastActivity.Store(time.Now().UnixNano())
+	return err
+}
@@ -0,0 +1,135 @@
+package p2p
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+const (
+	offlineSyncTimeout     = time.Minute
+	offlineAnnounceTimeout = time.Minute
+)
+
+// offlineBuffer keeps the commits made while no peer was reachable, until
+// they are published to a peer
+type offlineBuffer struct {
+	mtx       sync.Mutex
+	commits   []string
+	published atomic.Int64
+}
+
+func (b *offlineBuffer) add(commit string) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.commits = append(b.commits, commit)
+}
+
+func (b *offlineBuffer) take() []string {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	commits := b.commits
+	b.commits = nil
+	return commits
+}
+
+// requeue puts back commits that could not be published, before the commits
+// buffered in the meantime
+func (b *offlineBuffer) requeue(commits []string) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.commits = append(commits, b.commits...)
+}
+
+func (b *offlineBuffer) len() int {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	return len(b.commits)
+}
+
+// BufferedCommits returns the number of commits made while offline that were
+// not published yet
+func (p2p *P2P) BufferedCommits() int {
+	if p2p.offline == nil {
+		return 0
+	}
+	return p2p.offline.len()
+}
+
+// PublishedCommits returns the number of buffered commits published after a
+// reconnection
+func (p2p *P2P) PublishedCommits() int64 {
+	if p2p.offline == nil {
+		return 0
+	}
+	return p2p.offline.published.Load()
+}
+
+// isOffline returns true if offline mode is enabled and no peer is reachable
+func (p2p *P2P) isOffline() bool {
+	return p2p.offline != nil && len(p2p.GetClients()) == 0
+}
+
+// publishBuffered syncs with a peer that just connected and then announces
+// the commits buffered while offline, waiting until the peer applied them.
+// Syncing first makes sure the buffered commits are merged with the changes
+// the cluster made in the meantime before they are announced.
+func (p2p *P2P) publishBuffered(client *P2PClient) {
+	commits := p2p.offline.take()
+	if len(commits) == 0 {
+		return
+	}
+	if !client.Supports(p2pproto.Tester_AckCommit_FullMethodName) {
+		p2p.offline.requeue(commits)
+		return
+	}
+
+	syncCtx, cancel := context.WithTimeout(context.Background(), offlineSyncTimeout)
+	defer cancel()
+	head, err := client.GetHead(syncCtx, &p2pproto.GetHeadRequest{})
+	if err == nil {
+		err = p2p.waitForCommit(syncCtx, head.Commit)
+	}
+	if err != nil {
+		p2p.log.Warnf("Failed to sync with %s before publishing buffered commits: %v", client.GetID(), err)
+	}
+
+	// a peer that applied the last commit applied all its ancestors
+	ctx, cancel := context.WithTimeout(context.Background(), offlineAnnounceTimeout)
+	defer cancel()
+	last := commits[len(commits)-1]
+	resp, err := client.AckCommit(ctx, &p2pproto.AckCommitRequest{Commit: last})
+	if err != nil || !resp.Applied {
+		p2p.log.Warnf("Peer %s did not apply the %d commits buffered while offline: %v", client.GetID(), len(commits), err)
+		p2p.offline.requeue(commits)
+		return
+	}
+	p2p.offline.published.Add(int64(len(commits)))
+	p2p.log.Infof("Published %d commits buffered while offline to %s", len(commits), client.GetID())
+}
+
+// waitForCommit polls the local history until the commit is present
+func (p2p *P2P) waitForCommit(ctx context.Context, hash string) error {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		commits, err := p2p.externalDB.GetAllCommits()
+		if err != nil {
+			return err
+		}
+		for _, commit := range commits {
+			if commit.Hash == hash {
+				return nil
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
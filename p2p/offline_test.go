@@ -0,0 +1,27 @@
+package p2p
+
+import "testing"
+
+func TestOfflineBuffer(t *testing.T) {
+	b := &offlineBuffer{}
+	b.add("a")
+	b.add("b")
+
+	commits := b.take()
+	if len(commits) != 2 || b.len() != 0 {
+		t.Fatalf("unexpected commits %v", commits)
+	}
+
+	b.add("c")
+	b.requeue(commits)
+	got := b.take()
+	want := []string{"a", "b", "c"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,430 @@
+package p2p
+
+import (
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/commitmeta"
+	"github.com/nustiueudinastea/doltswarmdemo/drift"
+	"github.com/nustiueudinastea/doltswarmdemo/lifecycle"
+	"github.com/nustiueudinastea/doltswarmdemo/p2p/compression"
+	p2psrv "github.com/nustiueudinastea/doltswarmdemo/p2p/server"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+)
+
+// Option configures optional behaviour of the p2p manager
+type Option func(p2p *P2P)
+
+type commitOptions struct {
+	metadata     commitmeta.Metadata
+	expectedHead string
+}
+
+// CommitOption configures a single ExecAndCommit call
+type CommitOption func(opts *commitOptions)
+
+// WithCommitMetadata stores machine readable metadata with the commit
+func WithCommitMetadata(md commitmeta.Metadata) CommitOption {
+	return func(opts *commitOptions) {
+		opts.metadata = md
+	}
+}
+
+// WithExpectedHead only applies the write if the head of the main branch is
+// still the given commit, giving compare-and-swap semantics. Otherwise the
+// write fails with an ABORTED status carrying the current head, see
+// p2psrv.ConflictingHead.
+func WithExpectedHead(head string) CommitOption {
+	return func(opts *commitOptions) {
+		opts.expectedHead = head
+	}
+}
+
+// WithLeaderElection enables leader mode: peers elect a leader and followers
+// forward their writes to it instead of committing locally.
+func WithLeaderElection() Option {
+	return func(p2p *P2P) {
+		p2p.elector = newElector(p2p)
+	}
+}
+
+// WithMaxMessageSize limits the size of the gRPC messages sent and received by
+// the node. Oversized messages fail with a ResourceExhausted status.
+func WithMaxMessageSize(size int) Option {
+	return func(p2p *P2P) {
+		p2p.maxMsgSize = size
+	}
+}
+
+// WithConnLimits sets the watermarks of the connection manager: once the node
+// has more than high connections, it trims them down to low
+func WithConnLimits(low int, high int) Option {
+	return func(p2p *P2P) {
+		if low > 0 && high >= low {
+			p2p.connLow = low
+			p2p.connHigh = high
+		}
+	}
+}
+
+// WithHandlerQueue sets the number of received messages queued for every
+// message handler. Messages arriving while the queue is full are dropped.
+func WithHandlerQueue(size int) Option {
+	return func(p2p *P2P) {
+		if size > 0 {
+			p2p.handlers.queue = size
+		}
+	}
+}
+
+// WithDiscovery sets the mechanisms used to find peers. mDNS is used if no
+// discovery is configured.
+func WithDiscovery(discoveries ...Discovery) Option {
+	return func(p2p *P2P) {
+		p2p.discoveries = append(p2p.discoveries, discoveries...)
+	}
+}
+
+// WithListenIP sets the IPv4 address the node listens on. Defaults to the
+// loopback address.
+func WithListenIP(ip string) Option {
+	return func(p2p *P2P) {
+		p2p.listenIP = ip
+	}
+}
+
+// WithTableOwners designates a single writer for some tables. Writes to tables
+// owned by other peers are forwarded to their owner, so they can't conflict.
+// Reads are still served locally from the replicated data.
+func WithTableOwners(owners map[string]string) Option {
+	return func(p2p *P2P) {
+		p2p.tableOwners = owners
+	}
+}
+
+// WithPeerExpiry sets how long the state kept for a disconnected peer, like
+// its bandwidth stats, is retained
+func WithPeerExpiry(expiry time.Duration) Option {
+	return func(p2p *P2P) {
+		p2p.janitor.expiry = expiry
+	}
+}
+
+// WithKeepalive sets how often idle peers are pinged and how long they have to
+// answer before the connection is considered dead and dialed again. An interval
+// of 0 disables the keepalive pings.
+func WithKeepalive(interval time.Duration, timeout time.Duration) Option {
+	return func(p2p *P2P) {
+		if interval <= 0 {
+			p2p.keepalive = nil
+			return
+		}
+		p2p.keepalive = &keepalive{p2p: p2p, interval: interval, timeout: timeout}
+	}
+}
+
+// WithMembership uses an authoritative member set for quorums and sync
+// progress instead of the connected peers. Removed nodes are not dialed.
+func WithMembership(members MemberSource) Option {
+	return func(p2p *P2P) {
+		p2p.membership = members
+	}
+}
+
+// WithOfflineMode keeps accepting writes when no peer is reachable, whatever
+// the consistency level. The commits are buffered and published to the first
+// peer that connects, after syncing with it.
+func WithOfflineMode() Option {
+	return func(p2p *P2P) {
+		p2p.offline = &offlineBuffer{}
+	}
+}
+
+// WithStandby runs the node as a hot standby of a primary. Writes are
+// forwarded to the primary until the standby is promoted, manually or after
+// cfg.FailoverAfter failed health checks.
+func WithStandby(cfg StandbyConfig) Option {
+	return func(p2p *P2P) {
+		if cfg.CheckInterval <= 0 {
+			cfg.CheckInterval = defaultStandbyCheckInterval
+		}
+		p2p.standby = &standby{p2p: p2p, cfg: cfg, status: StandbyStatus{Primary: cfg.Primary}}
+	}
+}
+
+// WithSyncLagThreshold sets the number of missing commits of a peer above
+// which a SyncLagExceeded event is sent. 0 disables the event.
+func WithSyncLagThreshold(commits int) Option {
+	return func(p2p *P2P) {
+		p2p.events.lagThreshold = commits
+	}
+}
+
+// WithDriftCheck compares the row counts and content hashes of our tables with
+// the ones of peers at the same head at every interval. 0 disables the check.
+func WithDriftCheck(interval time.Duration) Option {
+	return func(p2p *P2P) {
+		if interval <= 0 {
+			p2p.drift = nil
+			return
+		}
+		p2p.drift = &driftChecker{p2p: p2p, interval: interval, drifted: map[string][]drift.Mismatch{}}
+	}
+}
+
+// WithCompression offers the compressors to peers, in order of preference.
+// Unary messages smaller than threshold bytes are sent uncompressed.
+func WithCompression(compressors []string, threshold int) Option {
+	return func(p2p *P2P) {
+		if len(compressors) == 0 {
+			p2p.compression = nil
+			return
+		}
+		p2p.compression = &compressionState{enabled: compressors, threshold: threshold, peers: map[string]string{}}
+		unary, stream := compression.ServerInterceptors(remotePeerID, p2p.Compressor, threshold)
+		p2p.unaryServerInterceptors = append(p2p.unaryServerInterceptors, unary)
+		p2p.streamServerInterceptors = append(p2p.streamServerInterceptors, stream)
+	}
+}
+
+// WithCommitRateLimit limits the local commits to perSecond commits per
+// second, with bursts of up to burst commits
+func WithCommitRateLimit(perSecond float64, burst int) Option {
+	return func(p2p *P2P) {
+		if perSecond > 0 {
+			p2p.throttle.limiter = rate.NewLimiter(rate.Limit(perSecond), burst)
+		}
+	}
+}
+
+// WithBackpressure delays local commits, by up to maxDelay, while a peer
+// reports being more than maxLag commits behind
+func WithBackpressure(maxLag int64, maxDelay time.Duration) Option {
+	return func(p2p *P2P) {
+		p2p.throttle.maxLag = maxLag
+		p2p.throttle.maxDelay = maxDelay
+	}
+}
+
+// WithAuthorizer checks the writes and queries received from peers
+func WithAuthorizer(authorizer p2psrv.Authorizer) Option {
+	return func(p2p *P2P) {
+		p2p.authorizer = authorizer
+	}
+}
+
+// WithQuarantine keeps the writes from peers that were rejected by the
+// authorizer or by validation for review
+func WithQuarantine(quarantiner p2psrv.Quarantiner) Option {
+	return func(p2p *P2P) {
+		p2p.quarantiner = quarantiner
+	}
+}
+
+// WithNamedQueries lets peers and clients run the queries of the store by
+// name with RunNamedQuery
+func WithNamedQueries(store p2psrv.NamedQueryStore) Option {
+	return func(p2p *P2P) {
+		p2p.namedQueries = store
+	}
+}
+
+// WithProcedures lets peers and clients call the allowed Dolt procedures with
+// CallProcedure, on connections opened by opener
+func WithProcedures(opener p2psrv.ConnOpener) Option {
+	return func(p2p *P2P) {
+		p2p.procedures = opener
+	}
+}
+
+// WithReadCache caches the responses of idempotent remote reads, like GetHead
+// and GetAllCommits, for the given time. InvalidateReadCache drops them early.
+func WithReadCache(ttl time.Duration) Option {
+	return func(p2p *P2P) {
+		p2p.readCache = newReadCache(ttl)
+	}
+}
+
+// WithRemoteReads lets a light node serve the queries reading the history from
+// archive peers. A query tries them for up to budget before it's served
+// locally, and their responses are cached for ttl. InvalidateReadCache drops
+// them early.
+func WithRemoteReads(budget time.Duration, ttl time.Duration) Option {
+	return func(p2p *P2P) {
+		p2p.remote = &remoteReads{budget: budget, cache: newReadCache(ttl)}
+	}
+}
+
+// WithLocalTables sets the function that reports local-only tables. Writes to
+// them are always executed locally, even if leader mode or table owners are
+// configured.
+func WithLocalTables(isLocal func(table string) bool) Option {
+	return func(p2p *P2P) {
+		p2p.localTables = isLocal
+	}
+}
+
+// WithNodeRole sets the role advertised to peers. Light nodes advertise the
+// number of commits of history they keep.
+func WithNodeRole(role NodeRole, historyDepth int64) Option {
+	return func(p2p *P2P) {
+		p2p.role = role
+		if role == RoleLight {
+			p2p.historyDepth = historyDepth
+		}
+	}
+}
+
+// WithServerInterceptors adds middleware to the gRPC server. Interceptors run
+// in the order they are added, across all the calls of this option.
+func WithServerInterceptors(unary grpc.UnaryServerInterceptor, stream grpc.StreamServerInterceptor) Option {
+	return func(p2p *P2P) {
+		if unary != nil {
+			p2p.unaryServerInterceptors = append(p2p.unaryServerInterceptors, unary)
+		}
+		if stream != nil {
+			p2p.streamServerInterceptors = append(p2p.streamServerInterceptors, stream)
+		}
+	}
+}
+
+// WithAdmins lets the peers accepted by allow call the Admin service. The
+// Admin service is refused to every peer if it's not set.
+func WithAdmins(allow func(peerID string) bool) Option {
+	return func(p2p *P2P) {
+		p2p.admins = allow
+	}
+}
+
+// WithClientInterceptors adds middleware to the gRPC clients used to call
+// peers. They run after the internal interceptors.
+func WithClientInterceptors(unary grpc.UnaryClientInterceptor, stream grpc.StreamClientInterceptor) Option {
+	return func(p2p *P2P) {
+		if unary != nil {
+			p2p.unaryClientInterceptors = append(p2p.unaryClientInterceptors, unary)
+		}
+		if stream != nil {
+			p2p.streamClientInterceptors = append(p2p.streamClientInterceptors, stream)
+		}
+	}
+}
+
+// WithAddressBook persists the addresses of connected peers in the address book
+// and dials all the known peers on startup.
+func WithAddressBook(addrBook *AddressBook) Option {
+	return func(p2p *P2P) {
+		p2p.addrBook = addrBook
+	}
+}
+
+// WithAnnouncementLog records the heads announced to and by peers in the log.
+// Heads announced to us but never applied, e.g. because the node restarted,
+// are requested again from the connected peers.
+func WithAnnouncementLog(announcements *AnnouncementLog) Option {
+	return func(p2p *P2P) {
+		p2p.announced = announcements
+		p2p.unaryServerInterceptors = append(p2p.unaryServerInterceptors, p2p.announcementServerInterceptor)
+	}
+}
+
+// WithZone labels the node with its location. Heads announced by peers in
+// other zones are pulled by a single node of the zone, or of the region for
+// peers in other regions, and relayed to the others, which only pull them from
+// the farther peer if they're not relayed within delay.
+func WithZone(zone Zone, delay time.Duration) Option {
+	return func(p2p *P2P) {
+		if zone.IsZero() {
+			return
+		}
+		p2p.zones = &zonePolicy{zone: zone, delay: delay}
+		p2p.unaryServerInterceptors = append(p2p.unaryServerInterceptors, p2p.zoneInterceptor)
+	}
+}
+
+// WithDatabaseIdentity refuses to sync with peers replicating a database with
+// a different name, ID or genesis commit. load is called on every handshake
+// until all the fields of the identity are known.
+func WithDatabaseIdentity(load func() (DatabaseIdentity, error)) Option {
+	return func(p2p *P2P) {
+		p2p.identity = &identitySource{load: load}
+	}
+}
+
+// WithBanList refuses the connections and calls of the peers banned in the
+// list, and disconnects peers as soon as they are banned
+func WithBanList(bans *BanList) Option {
+	return func(p2p *P2P) {
+		p2p.bans = bans
+		unary, stream := p2p.banInterceptors()
+		p2p.unaryServerInterceptors = append(p2p.unaryServerInterceptors, unary)
+		p2p.streamServerInterceptors = append(p2p.streamServerInterceptors, stream)
+	}
+}
+
+// WithPriorityLanes limits the unary calls in flight to every peer to slots.
+// Waiting calls are scheduled by priority lane, so that pings and
+// announcements are not delayed by sync transfers. 0 disables the limit.
+func WithPriorityLanes(slots int) Option {
+	return func(p2p *P2P) {
+		if slots <= 0 {
+			p2p.lanes = nil
+			return
+		}
+		p2p.lanes = &rpcLanes{slots: slots, schedulers: map[string]*laneScheduler{}}
+	}
+}
+
+// WithClockSkewThreshold sets the clock offset of a peer above which it is
+// reported. The offset is measured at every ping. 0 disables the reports.
+func WithClockSkewThreshold(threshold time.Duration) Option {
+	return func(p2p *P2P) {
+		p2p.skews.threshold = threshold
+	}
+}
+
+// WithDiskGuard pauses the syncs with peers while the guard reports the data
+// directory as nearly full. Writes have to be refused by the DB, with
+// ErrDiskFull, while the guard is read-only.
+func WithDiskGuard(guard *DiskGuard) Option {
+	return func(p2p *P2P) {
+		p2p.disk = guard
+		p2p.unaryServerInterceptors = append(p2p.unaryServerInterceptors, p2p.diskInterceptor())
+	}
+}
+
+// WithGovernor sheds load while the node is over the resource budgets of the
+// governor: new calls are refused and the syncs with peers are paused
+func WithGovernor(governor *Governor) Option {
+	return func(p2p *P2P) {
+		p2p.governor = governor
+		unary, stream := governor.Interceptors()
+		p2p.unaryServerInterceptors = append(p2p.unaryServerInterceptors, unary)
+		p2p.streamServerInterceptors = append(p2p.streamServerInterceptors, stream)
+	}
+}
+
+// WithStartRetries sets how many times a subsystem is started before giving
+// up, and the backoff after the first failure, which doubles after every
+// other one
+func WithStartRetries(attempts int, backoff time.Duration) Option {
+	return func(p2p *P2P) {
+		p2p.lifecycle = lifecycle.New(p2p.log.WithField("context", "lifecycle"), attempts, backoff)
+	}
+}
+
+// WithLeaseMode selects the peers that grant the leases acquired through the
+// node. Leases are granted by a quorum by default.
+func WithLeaseMode(mode LeaseMode) Option {
+	return func(p2p *P2P) {
+		p2p.leaseMode = mode
+	}
+}
+
+// WithCallTimeout gives the calls to peers made without a deadline a default
+// one. Peers stop handling the calls once their deadline passes, instead of
+// computing responses nobody waits for.
+func WithCallTimeout(timeout time.Duration) Option {
+	return func(p2p *P2P) {
+		p2p.deadlines.callTimeout = timeout
+	}
+}
@@ -0,0 +1,98 @@
+package p2p
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/nustiueudinastea/doltswarmdemo/sqlstmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// LoadTableOwners reads a JSON file mapping table names to the ID of the peer
+// that owns them
+func LoadTableOwners(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table owners: %w", err)
+	}
+	parsed := map[string]string{}
+	err = json.Unmarshal(data, &parsed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse table owners '%s': %w", path, err)
+	}
+	// the tables of statements are matched lower cased
+	owners := make(map[string]string, len(parsed))
+	for table, owner := range parsed {
+		if _, err := peer.Decode(owner); err != nil {
+			return nil, fmt.Errorf("invalid owner '%s' for table '%s': %w", owner, table, err)
+		}
+		owners[strings.ToLower(table)] = owner
+	}
+	return owners, nil
+}
+
+// tableOwner returns the ID of the peer that owns the table, or an empty string
+// if the table has no designated owner.
+func (p2p *P2P) tableOwner(table string) string {
+	if table == "" || p2p.tableOwners == nil {
+		return ""
+	}
+	return p2p.standbyOwner(p2p.tableOwners[table])
+}
+
+// writeOwner returns the owner of the tables written by a query, ignoring
+// local-only tables, or an empty string if none of them has one. The tables
+// are found by parsing the query, so that comments, qualified names or several
+// statements can't escape their owner. Queries writing tables of different
+// owners, or owned and unowned tables, are refused, as are queries that can't
+// be parsed once table owners are configured.
+func (p2p *P2P) writeOwner(query string) (string, []string, error) {
+	if len(p2p.tableOwners) == 0 {
+		return "", nil, nil
+	}
+	_, writes, err := sqlstmt.Access(query)
+	if err != nil {
+		return "", nil, status.Errorf(codes.InvalidArgument, "failed to parse the tables written by the statement: %v", err)
+	}
+	owner := ""
+	owned := []string{}
+	unowned := false
+	for _, table := range writes {
+		if p2p.localTables != nil && p2p.localTables(table) {
+			continue
+		}
+		tableOwner := p2p.tableOwner(table)
+		switch {
+		case tableOwner == "":
+			unowned = true
+		case owner == "" || owner == tableOwner:
+			owner = tableOwner
+			owned = append(owned, table)
+		default:
+			return "", nil, status.Errorf(codes.InvalidArgument, "statement writes tables owned by '%s' and '%s'", owner, tableOwner)
+		}
+	}
+	if owner != "" && unowned {
+		return "", nil, status.Errorf(codes.InvalidArgument, "statement writes tables owned by '%s' and tables without an owner", owner)
+	}
+	return owner, owned, nil
+}
+
+// writesOnlyLocalTables returns true if every table written by a query is a
+// local-only table
+func (p2p *P2P) writesOnlyLocalTables(query string) bool {
+	_, writes, err := sqlstmt.Access(query)
+	if err != nil || len(writes) == 0 {
+		return false
+	}
+	for _, table := range writes {
+		if !p2p.localTables(table) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,34 @@
+package p2p
+
+import "testing"
+
+func TestWriteOwner(t *testing.T) {
+	p2p := &P2P{
+		tableOwners: map[string]string{"orders": "peerA", "users": "peerB"},
+		localTables: func(table string) bool { return table == "scratch" },
+	}
+	cases := []struct {
+		query string
+		owner string
+		fails bool
+	}{
+		{"INSERT INTO orders VALUES (1)", "peerA", false},
+		{"/* note */ INSERT INTO orders VALUES (1)", "peerA", false},
+		{"INSERT INTO db.Orders VALUES (1)", "peerA", false},
+		{"INSERT INTO other VALUES (1); DELETE FROM orders", "", true},
+		{"INSERT INTO orders VALUES (1); DELETE FROM users", "", true},
+		{"INSERT INTO orders SELECT * FROM users", "peerA", false},
+		{"INSERT INTO scratch VALUES (1); DELETE FROM orders", "peerA", false},
+		{"INSERT INTO other VALUES (1)", "", false},
+		{"INSERT INTO", "", true},
+	}
+	for _, c := range cases {
+		owner, _, err := p2p.writeOwner(c.query)
+		if (err != nil) != c.fails || owner != c.owner {
+			t.Errorf("expected owner '%s' (fails=%t) for '%s', got '%s' (%v)", c.owner, c.fails, c.query, owner, err)
+		}
+	}
+	if !p2p.writesOnlyLocalTables("DELETE FROM scratch") || p2p.writesOnlyLocalTables("DELETE FROM scratch; DELETE FROM orders") {
+		t.Error("expected only writes of local tables to stay local")
+	}
+}
@@ -5,37 +5,68 @@ import (
 	"encoding/base64"
 	"fmt"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	p2pgrpc "github.com/birros/go-libp2p-grpc"
 	"github.com/libp2p/go-libp2p"
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/metrics"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/protocol"
-	"github.com/libp2p/go-libp2p/p2p/discovery/mdns"
 	connmgr "github.com/libp2p/go-libp2p/p2p/net/connmgr"
 	"github.com/libp2p/go-libp2p/p2p/security/noise"
 	quic "github.com/libp2p/go-libp2p/p2p/transport/quic"
 	"github.com/martinlindhe/base36"
+	swarmproto "github.com/nustiueudinastea/doltswarm/proto"
+	"github.com/nustiueudinastea/doltswarmdemo/commitmeta"
+	"github.com/nustiueudinastea/doltswarmdemo/lifecycle"
+	"github.com/nustiueudinastea/doltswarmdemo/p2p/middleware"
 	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
 	p2psrv "github.com/nustiueudinastea/doltswarmdemo/p2p/server"
 	cmap "github.com/orcaman/concurrent-map"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
 const (
-	protosRPCProtocol = protocol.ID("/protos/rpc/0.0.1")
+	// defaultConnLow and defaultConnHigh are the default watermarks of the
+	// connection manager
+	defaultConnLow  = 100
+	defaultConnHigh = 400
+	// idempotencyTokenTTL is how long the tokens of writes are kept in
+	// memory. Older tokens are looked up in the commit history.
+	idempotencyTokenTTL = time.Hour
 )
 
 type P2PClient struct {
 	p2pproto.PingerClient
 	p2pproto.TesterClient
-
-	id string
+	p2pproto.ElectionClient
+	p2pproto.CommitsClient
+	p2pproto.ChannelsClient
+	p2pproto.LeasesClient
+	p2pproto.AdminClient
+	p2pproto.DrainClient
+	p2pproto.TraceClient
+	p2pproto.BlobsClient
+	p2pproto.PluginsClient
+	p2pproto.ApprovalsClient
+
+	syncer       swarmproto.DBSyncerClient
+	id           string
+	apiVersion   string
+	role         NodeRole
+	historyDepth int64
+	zone         Zone
+	draining     atomic.Bool
 }
 
 func (c *P2PClient) GetID() string {
@@ -51,10 +82,68 @@ type P2P struct {
 	clients      cmap.ConcurrentMap
 	externalDB   p2psrv.ExternalDB
 	prvKey       crypto.PrivKey
+	elector      *elector
+	addrBook     *AddressBook
+	announced    *AnnouncementLog
+	bans         *BanList
+	lanes        *rpcLanes
+	protocols    *ProtocolRegistry
+	maxMsgSize   int
+	bwCounter    *metrics.BandwidthCounter
+	inFlight     *inFlight
+	versions     *peerVersions
+	discoveries  []Discovery
+	listenIP     string
+	port         int
+	tableOwners  map[string]string
+	progress     progressTracker
+	janitor      *janitor
+	keepalive    *keepalive
+	membership   MemberSource
+	offline      *offlineBuffer
+	standby      *standby
+	events       *eventBus
+	compression  *compressionState
+	throttle     *throttle
+	drift        *driftChecker
+	skews        *clockSkews
+	disk         *DiskGuard
+	governor     *Governor
+	leases       *leaseTable
+	leaseMode    LeaseMode
+	lifecycle    *lifecycle.Manager
+	backfilled   atomic.Int64
+	held         atomic.Int32
+	authorizer   p2psrv.Authorizer
+	quarantiner  p2psrv.Quarantiner
+	namedQueries p2psrv.NamedQueryStore
+	procedures   p2psrv.ConnOpener
+	admins       func(peerID string) bool
+	readCache    *readCache
+	localTables  func(table string) bool
+	role         NodeRole
+	historyDepth int64
+	zones        *zonePolicy
+	writeMtx     sync.Mutex
+	identity     *identitySource
+	drain        drainState
+	started      time.Time
+	applied      appliedCommits
+	remote       *remoteReads
+	handlers     *messageHandlers
+	deadlines    *deadlines
+	connLow      int
+	connHigh     int
+
+	unaryServerInterceptors  []grpc.UnaryServerInterceptor
+	streamServerInterceptors []grpc.StreamServerInterceptor
+	unaryClientInterceptors  []grpc.UnaryClientInterceptor
+	streamClientInterceptors []grpc.StreamClientInterceptor
 }
 
 type P2PKey struct {
-	prvKey crypto.PrivKey
+	prvKey  crypto.PrivKey
+	signers commitSigners
 }
 
 func (p2p *P2PKey) Sign(commit string) (string, error) {
@@ -63,6 +152,7 @@ func (p2p *P2PKey) Sign(commit string) (string, error) {
 		return "", fmt.Errorf("failed to create signature: %w", err)
 	}
 
+	p2p.signers.record(commit, p2p.GetID(), time.Now())
 	return base36.EncodeBytes(sig), nil
 }
 
@@ -92,7 +182,12 @@ func (p2p *P2PKey) Verify(commit string, signature string, publicKey string) err
 		return fmt.Errorf("verification failed for public key %s commit %s signature %s ", publicKey, commit, signature)
 	}
 
-	return nil
+	signer, err := peer.IDFromPublicKey(pubKey)
+	if err != nil {
+		return fmt.Errorf("failed to derive peer ID of public key %s: %w", publicKey, err)
+	}
+	p2p.signers.record(commit, signer.String(), time.Now())
+	return p2p.signers.check(commit, signer.String())
 }
 
 func (p2p *P2PKey) PublicKey() string {
@@ -131,6 +226,113 @@ func (p2p *P2P) GetClients() []*P2PClient {
 	return clients
 }
 
+func (p2p *P2P) hasClient(id string) bool {
+	return p2p.clients.Has(id)
+}
+
+// Leader returns the ID of the elected leader. It returns an empty string if
+// leader mode is disabled or no leader has been elected yet.
+func (p2p *P2P) Leader() string {
+	if p2p.elector == nil {
+		return ""
+	}
+	return p2p.elector.Leader()
+}
+
+// Route implements p2psrv.Router. Writes to a table owned by another peer are
+// forwarded to the owner, and fail if the owner is not connected. Otherwise
+// writes are forwarded to the primary if this node is a standby, or to the
+// leader if leader mode is enabled and this node is a follower. Writes fail
+// with codes.Unavailable while no leader is elected or the leader is not
+// connected. Writes to local-only tables are never forwarded.
+func (p2p *P2P) Route(query string) (p2pproto.TesterClient, bool, error) {
+	if p2p.localTables != nil && p2p.writesOnlyLocalTables(query) {
+		return nil, false, nil
+	}
+	owner, tables, err := p2p.writeOwner(query)
+	if err != nil {
+		return nil, false, err
+	}
+	if owner != "" {
+		if owner == p2p.GetID() {
+			return nil, false, nil
+		}
+		client, found := p2p.clients.Get(owner)
+		if !found {
+			return nil, false, status.Errorf(codes.Unavailable, "owner '%s' of table '%s' is not connected", owner, strings.Join(tables, ", "))
+		}
+		return client.(*P2PClient), true, nil
+	}
+
+	if p2p.IsStandby() {
+		client, found := p2p.clients.Get(p2p.standby.cfg.Primary)
+		if !found {
+			return nil, false, status.Errorf(codes.Unavailable, "primary '%s' is not connected", p2p.standby.cfg.Primary)
+		}
+		return client.(*P2PClient), true, nil
+	}
+
+	if p2p.elector == nil {
+		return nil, false, nil
+	}
+	leader := p2p.elector.Leader()
+	if leader == "" {
+		return nil, false, status.Error(codes.Unavailable, "no leader is elected")
+	}
+	if leader == p2p.GetID() {
+		return nil, false, nil
+	}
+	client, found := p2p.clients.Get(leader)
+	if !found {
+		return nil, false, status.Errorf(codes.Unavailable, "leader '%s' is not connected", leader)
+	}
+	return client.(*P2PClient), true, nil
+}
+
+// ExecAndCommit executes the query on the node responsible for the write
+// (locally, on the owner of the table, or on the leader when running in leader
+// mode as a follower) and
+// waits for peers to apply it according to the consistency level.
+func (p2p *P2P) ExecAndCommit(query string, commitMsg string, consistency p2pproto.Consistency, opts ...CommitOption) (string, error) {
+	options := commitOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	commitMsg = commitmeta.Annotate(commitMsg, options.metadata)
+
+	ctx := context.Background()
+	client, forward, err := p2p.Route(query)
+	if err != nil {
+		return "", err
+	}
+	if forward {
+		resp, err := client.ExecSQL(ctx, &p2pproto.ExecSQLRequest{Statement: query, Msg: commitMsg, Forwarded: true, Consistency: consistency, ExpectedHead: options.expectedHead})
+		if err != nil {
+			return "", fmt.Errorf("failed to forward write: %w", err)
+		}
+		return resp.Commit, nil
+	}
+
+	err = p2p.throttle.wait(ctx)
+	if err != nil {
+		return "", err
+	}
+	offline := p2p.isOffline()
+	commit, err := p2p.ExecIfHead(options.expectedHead, func() (string, error) {
+		return p2p.externalDB.ExecAndCommit(query, commitMsg)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if offline && commit != "" {
+		p2p.offline.add(commit)
+		p2p.log.Debugf("No peers reachable, buffered commit '%s'", commit)
+		return commit, nil
+	}
+	return commit, p2p.WaitForAcks(ctx, commit, consistency)
+}
+
 func (p2p *P2P) peerDiscoveryProcessor() func() error {
 	stopSignal := make(chan struct{})
 	go func() {
@@ -138,6 +340,14 @@ func (p2p *P2P) peerDiscoveryProcessor() func() error {
 		for {
 			select {
 			case peer := <-p2p.PeerChan:
+				if isRemoved(p2p.members(), peer.ID.String()) {
+					p2p.log.Infof("Ignoring peer %s, which was removed from the cluster", peer)
+					continue
+				}
+				if p2p.bans != nil && p2p.bans.Banned(peer.ID.String()) {
+					p2p.log.Infof("Ignoring banned peer %s", peer)
+					continue
+				}
 				p2p.log.Infof("New peer. Connecting: %s", peer)
 				ctx := context.Background()
 				if err := p2p.host.Connect(ctx, peer); err != nil {
@@ -169,8 +379,7 @@ func (p2p *P2P) peerDiscoveryProcessor() func() error {
 				// grpc conn
 				conn, err := grpc.Dial(
 					peer.ID.String(),
-					grpc.WithTransportCredentials(insecure.NewCredentials()),
-					p2pgrpc.WithP2PDialer(p2p.host, protosRPCProtocol),
+					p2p.dialOptions(peer.ID)...,
 				)
 				if err != nil {
 					p2p.log.Error("Grpc conn failed: ", err)
@@ -179,22 +388,66 @@ func (p2p *P2P) peerDiscoveryProcessor() func() error {
 
 				// client
 				client := &P2PClient{
-					PingerClient: p2pproto.NewPingerClient(conn),
-					TesterClient: p2pproto.NewTesterClient(conn),
-					id:           peer.ID.String(),
+					PingerClient:    p2pproto.NewPingerClient(conn),
+					TesterClient:    p2pproto.NewTesterClient(conn),
+					ElectionClient:  p2pproto.NewElectionClient(conn),
+					CommitsClient:   p2pproto.NewCommitsClient(conn),
+					ChannelsClient:  p2pproto.NewChannelsClient(conn),
+					LeasesClient:    p2pproto.NewLeasesClient(conn),
+					AdminClient:     p2pproto.NewAdminClient(conn),
+					DrainClient:     p2pproto.NewDrainClient(conn),
+					TraceClient:     p2pproto.NewTraceClient(conn),
+					BlobsClient:     p2pproto.NewBlobsClient(conn),
+					PluginsClient:   p2pproto.NewPluginsClient(conn),
+					ApprovalsClient: p2pproto.NewApprovalsClient(conn),
+					syncer:          swarmproto.NewDBSyncerClient(conn),
+					id:              peer.ID.String(),
 				}
 
-				// test connectivity with a ping
-				_, err = client.Ping(ctx, &p2pproto.PingRequest{
-					Ping: "pong",
-				})
+				// test connectivity with a ping, negotiate the API version and
+				// check that the peer replicates the same database
+				pingReq := &p2pproto.PingRequest{
+					Ping:        "pong",
+					Version:     ProtocolVersion,
+					Compressors: p2p.compressors(),
+				}
+				if p2p.identity != nil {
+					pingReq.Identity = p2p.DatabaseIdentity().proto()
+				}
+				pingResp, err := p2p.ping(ctx, client, pingReq)
 				if err != nil {
 					p2p.log.Error("Ping failed: ", err)
 					continue
 				}
+				if p2p.identity != nil {
+					if _, err := p2p.CheckIdentity(peer.ID.String(), pingResp.Identity); err != nil {
+						conn.Close()
+						continue
+					}
+				}
+				client.apiVersion, err = negotiateVersion(ProtocolVersion, pingResp.Version)
+				if err != nil {
+					p2p.log.Errorf("Peer %s is incompatible: %v", peer.ID.String(), err)
+					conn.Close()
+					continue
+				}
+				p2p.versions.setAPI(peer.ID.String(), client.apiVersion)
+				client.role, client.historyDepth = parseNodeRole(pingResp.Role), pingResp.HistoryDepth
+				client.zone = Zone{Region: pingResp.Region, Zone: pingResp.Zone}
+				if p2p.compression != nil {
+					p2p.compression.set(peer.ID.String(), pingResp.Compressor)
+				}
 
-				p2p.log.Infof("Connected to %s", peer.ID.String())
+				p2p.log.Infof("Connected to %s using version %s", peer.ID.String(), client.apiVersion)
 				p2p.clients.Set(peer.ID.String(), client)
+				if p2p.addrBook != nil {
+					seenInfo := peer
+					seenInfo.Addrs = p2p.host.Peerstore().Addrs(peer.ID)
+					err = p2p.addrBook.Seen(seenInfo, p2p.host.Peerstore().PubKey(peer.ID))
+					if err != nil {
+						p2p.log.Errorf("Failed to update address book for '%s': %v", peer.ID.String(), err)
+					}
+				}
 				if p2p.externalDB != nil {
 					err = p2p.externalDB.AddPeer(peer.ID.String(), conn)
 					if err != nil {
@@ -202,6 +455,19 @@ func (p2p *P2P) peerDiscoveryProcessor() func() error {
 					}
 				}
 				p2p.peerListChan <- p2p.host.Network().Peers()
+				p2p.events.publish(Event{Type: EventPeerConnected, PeerID: peer.ID.String()})
+				if p2p.elector != nil {
+					p2p.elector.peerConnected(peer.ID.String())
+				}
+				if p2p.offline != nil {
+					go p2p.publishBuffered(client)
+				}
+				if p2p.externalDB != nil {
+					go p2p.backfill(client)
+				}
+				if p2p.Draining() {
+					go p2p.notifyDrain(context.Background(), client, true)
+				}
 
 			case <-stopSignal:
 				p2p.log.Info("Stopping peer discovery processor")
@@ -216,24 +482,135 @@ func (p2p *P2P) peerDiscoveryProcessor() func() error {
 	return stopper
 }
 
+// dialAddressBook tries to connect to all the peers in the address book
+func (p2p *P2P) dialAddressBook() {
+	for _, entry := range p2p.addrBook.Entries() {
+		if entry.ID == p2p.GetID() {
+			continue
+		}
+		info, err := entry.AddrInfo()
+		if err != nil {
+			p2p.log.Errorf("Skipping address book entry: %v", err)
+			continue
+		}
+		p2p.host.Peerstore().AddAddrs(info.ID, info.Addrs, p2p.addrBook.TTL(&entry))
+		p2p.PeerChan <- info
+	}
+}
+
+// AddStaticPeer adds a peer that never expires to the address book and
+// connects to it. The address must include the peer ID.
+func (p2p *P2P) AddStaticPeer(addr string) error {
+	if p2p.addrBook == nil {
+		return fmt.Errorf("address book is not enabled")
+	}
+	info, err := p2p.addrBook.AddStatic(addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		p2p.PeerChan <- info
+	}()
+	return nil
+}
+
 func (p2p *P2P) closeConnectionHandler(netw network.Network, conn network.Conn) {
 	p2p.log.Infof("Disconnected from %s", conn.RemotePeer().String())
 	p2p.peerListChan <- p2p.host.Network().Peers()
 	if err := conn.Close(); err != nil {
 		p2p.log.Errorf("Error while disconnecting from peer '%s': %v", conn.RemotePeer().String(), err)
 	}
-	p2p.clients.Remove(conn.RemotePeer().String())
+	if p2p.clients.Has(conn.RemotePeer().String()) {
+		p2p.clients.Remove(conn.RemotePeer().String())
+		p2p.events.forget(conn.RemotePeer().String())
+		p2p.skews.forget(conn.RemotePeer().String())
+		if p2p.drift != nil {
+			p2p.drift.forget(conn.RemotePeer().String())
+		}
+		p2p.events.publish(Event{Type: EventPeerDisconnected, PeerID: conn.RemotePeer().String()})
+	}
+	p2p.versions.remove(conn.RemotePeer().String())
+	if p2p.lanes != nil {
+		p2p.lanes.forget(conn.RemotePeer().String())
+	}
+	if p2p.compression != nil {
+		p2p.compression.set(conn.RemotePeer().String(), "")
+	}
 	if p2p.externalDB != nil {
 		if err := p2p.externalDB.RemovePeer(conn.RemotePeer().String()); err != nil {
 			p2p.log.Errorf("Failed to remove DB peer for '%s': %v", conn.RemotePeer().String(), err)
 		}
 	}
+	if p2p.elector != nil {
+		p2p.elector.peerDisconnected(conn.RemotePeer().String())
+	}
+}
+
+func (p2p *P2P) dialOptions(id peer.ID) []grpc.DialOption {
+	// cached reads are answered before they count as in flight
+	unary := []grpc.UnaryClientInterceptor{}
+	if p2p.deadlines.callTimeout > 0 {
+		unary = append(unary, p2p.callTimeoutInterceptor)
+	}
+	if p2p.readCache != nil {
+		unary = append(unary, p2p.cacheInterceptor(id))
+	}
+	unary = append(unary, p2p.holdInterceptor)
+	if p2p.lanes != nil {
+		unary = append(unary, p2p.laneInterceptor(id))
+	}
+	unary = append(unary, p2p.replayInterceptor(id))
+	if p2p.announced != nil {
+		unary = append(unary, p2p.announcementClientInterceptor(id))
+	}
+	unary = append(unary, p2p.unaryClientInterceptors...)
+	stream := p2p.streamClientInterceptors
+	if p2p.compression != nil {
+		unaryCompression, streamCompression := p2p.compressionInterceptors(id)
+		unary = append(unary, unaryCompression)
+		stream = append([]grpc.StreamClientInterceptor{streamCompression}, stream...)
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		p2p.versionedDialer(),
+		grpc.WithChainUnaryInterceptor(unary...),
+		grpc.WithChainStreamInterceptor(stream...),
+	}
+	if p2p.maxMsgSize > 0 {
+		opts = append(opts, grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(p2p.maxMsgSize),
+			grpc.MaxCallSendMsgSize(p2p.maxMsgSize),
+		))
+	}
+	return opts
+}
+
+// Bandwidth returns the traffic totals and rates for every peer we exchanged
+// data with.
+func (p2p *P2P) Bandwidth() map[peer.ID]metrics.Stats {
+	return p2p.bwCounter.GetBandwidthByPeer()
+}
+
+// TotalBandwidth returns the traffic totals and rates for the node
+func (p2p *P2P) TotalBandwidth() metrics.Stats {
+	return p2p.bwCounter.GetBandwidthTotals()
 }
 
 func (p2p *P2P) GetGRPCServer() *grpc.Server {
 	return p2p.grpcServer
 }
 
+// LocalAddr returns the multiaddr other processes on this machine use to dial
+// the node, including its peer ID
+func (p2p *P2P) LocalAddr() string {
+	ip := p2p.listenIP
+	if ip == "0.0.0.0" {
+		ip = "127.0.0.1"
+	}
+	return fmt.Sprintf("/ip4/%s/udp/%d/quic-v1/p2p/%s", ip, p2p.port, p2p.host.ID())
+}
+
 func (p2p *P2P) GetID() string {
 	return p2p.host.ID().String()
 }
@@ -243,44 +620,139 @@ func (p2p *P2P) StartServer() (func() error, error) {
 
 	p2p.log.Infof("Starting p2p server using id %s", p2p.host.ID())
 	ctx := context.TODO()
+	p2p.started = time.Now()
 
 	// register internal grpc servers
-	srv := &p2psrv.Server{DB: p2p.externalDB}
-	p2pproto.RegisterPingerServer(p2p.grpcServer, srv)
-	p2pproto.RegisterTesterServer(p2p.grpcServer, srv)
+	srv := &p2psrv.Server{DB: p2p.externalDB, Router: p2p, Replicator: p2p, Version: ProtocolVersion, Role: string(p2p.role), HistoryDepth: p2p.historyDepth, Region: p2p.zone().Region, Zone: p2p.zone().Zone, Authorizer: p2p.authorizer, Quarantiner: p2p.quarantiner, Announcer: p2p, Compression: p2p, Lags: p2p, Writes: p2p, ID: p2p.GetID(), Tokens: p2psrv.NewTokenIndex(idempotencyTokenTTL)}
+	if p2p.identity != nil {
+		srv.Identity = p2p
+	}
+	if p2p.remote != nil {
+		srv.Remote = p2p
+	}
+	if p2p.namedQueries != nil {
+		srv.NamedQueries = p2p.namedQueries
+	}
+	if p2p.procedures != nil {
+		srv.Procedures = p2p.procedures
+	}
+	services := []service{
+		{desc: &p2pproto.Pinger_ServiceDesc, impl: srv},
+		{desc: &p2pproto.Tester_ServiceDesc, impl: srv},
+		{desc: &p2pproto.Leases_ServiceDesc, impl: &leaseServer{p2p: p2p}},
+		{desc: &p2pproto.Drain_ServiceDesc, impl: &drainServer{p2p: p2p}},
+		{desc: &p2pproto.Trace_ServiceDesc, impl: &traceServer{p2p: p2p}},
+	}
+	if p2p.elector != nil {
+		services = append(services, service{desc: &p2pproto.Election_ServiceDesc, impl: p2p.elector})
+	}
+	for _, svc := range services {
+		if err := p2p.RegisterService(svc.desc, svc.impl); err != nil {
+			return nil, err
+		}
+	}
 
-	// serve grpc server over libp2p host
-	grpcListener := p2pgrpc.NewListener(ctx, p2p.host, protosRPCProtocol)
-	go func() {
-		err := p2p.grpcServer.Serve(grpcListener)
-		if err != nil {
-			p2p.log.Error("grpc serve error: ", err)
-			panic(err)
+	// subsystems are started in the order they are added and stopped in
+	// reverse order
+	lc := p2p.lifecycle
+	if p2p.disk != nil {
+		lc.Add("disk-guard", p2p.guardDisk)
+	}
+	if p2p.governor != nil {
+		lc.Add("governor", p2p.governResources)
+	}
+	lc.Add("network", func() (func() error, error) {
+		if err := p2p.host.Network().Listen(); err != nil {
+			return nil, fmt.Errorf("failed to listen: %w", err)
 		}
-	}()
+		return p2p.host.Close, nil
+	})
+	lc.Add("grpc", func() (func() error, error) {
+		// serve the grpc servers over the libp2p host, on every registered
+		// protocol version
+		p2p.protocols.start(ctx, p2p.host, func(id protocol.ID, err error) {
+			lc.Fail("grpc", fmt.Errorf("failed to serve %s: %w", id, err))
+		})
+		return func() error {
+			p2p.protocols.stop()
+			return nil
+		}, nil
+	})
+	lc.Add("peer-discovery", func() (func() error, error) {
+		return p2p.peerDiscoveryProcessor(), nil
+	})
+	if p2p.addrBook != nil {
+		lc.Add("address-book", func() (func() error, error) {
+			go p2p.dialAddressBook()
+			return nil, nil
+		}, lifecycle.Optional())
+	}
 
-	err := p2p.host.Network().Listen()
-	if err != nil {
-		return func() error { return nil }, fmt.Errorf("failed to listen: %w", err)
+	discoveries := p2p.discoveries
+	if len(discoveries) == 0 {
+		discoveries = []Discovery{&MDNSDiscovery{}}
+	}
+	for _, discovery := range discoveries {
+		discovery := discovery
+		// peers can still be found by the other discoveries, so a failing
+		// discovery keeps being retried in the background
+		lc.Add(discovery.Name()+"-discovery", func() (func() error, error) {
+			stopper, err := discovery.Start(p2p.host, p2p.HandlePeerFound)
+			if err != nil {
+				return nil, err
+			}
+			p2p.log.Infof("Started %s discovery", discovery.Name())
+			return stopper, nil
+		}, lifecycle.Optional())
 	}
 
-	peerDiscoveryStopper := p2p.peerDiscoveryProcessor()
+	if p2p.bans != nil {
+		lc.Add("ban-enforcer", func() (func() error, error) {
+			return p2p.enforceBans(), nil
+		})
+	}
+	lc.Add("janitor", func() (func() error, error) {
+		return p2p.janitor.start(), nil
+	})
+	if p2p.keepalive != nil {
+		lc.Add("keepalive", func() (func() error, error) {
+			return p2p.keepalive.start(), nil
+		})
+	}
+	lc.Add("lag-reporter", func() (func() error, error) {
+		return p2p.reportLag(), nil
+	})
+	if p2p.announced != nil {
+		lc.Add("announcement-recovery", func() (func() error, error) {
+			return p2p.recoverAnnouncements(), nil
+		})
+	}
+	if p2p.drift != nil {
+		lc.Add("drift-checker", func() (func() error, error) {
+			return p2p.drift.start(), nil
+		})
+	}
+	if p2p.standby != nil {
+		lc.Add("standby", func() (func() error, error) {
+			return p2p.standby.monitor(), nil
+		})
+	}
+	if p2p.elector != nil {
+		lc.Add("election", func() (func() error, error) {
+			return p2p.elector.monitor(), nil
+		})
+	}
 
-	mdnsService := mdns.NewMdnsService(p2p.host, "protos", p2p)
-	if err := mdnsService.Start(); err != nil {
-		panic(err)
+	if err := lc.Start(); err != nil {
+		return func() error { return nil }, err
 	}
 
 	stopper := func() error {
 		p2p.log.Debug("Stopping p2p server")
-		peerDiscoveryStopper()
-		mdnsService.Close()
-		p2p.grpcServer.GracefulStop()
-		return p2p.host.Close()
+		return lc.Stop()
 	}
 
 	return stopper, nil
-
 }
 
 func NewKey(workdir string) (*P2PKey, error) {
@@ -337,31 +809,74 @@ func NewKey(workdir string) (*P2PKey, error) {
 }
 
 // NewManager creates and returns a new p2p manager
-func NewManager(p2pkey *P2PKey, port int, peerListChan chan peer.IDSlice, logger *logrus.Logger, externalDB p2psrv.ExternalDB) (*P2P, error) {
+func NewManager(p2pkey *P2PKey, port int, peerListChan chan peer.IDSlice, logger *logrus.Logger, externalDB p2psrv.ExternalDB, opts ...Option) (*P2P, error) {
 	p2p := &P2P{
 		PeerChan:     make(chan peer.AddrInfo),
 		peerListChan: peerListChan,
 		clients:      cmap.New(),
 		log:          logger,
-		grpcServer:   grpc.NewServer(p2pgrpc.WithP2PCredentials()),
 		externalDB:   externalDB,
 		prvKey:       p2pkey.PrivateKey(),
+		bwCounter:    metrics.NewBandwidthCounter(),
+		inFlight:     &inFlight{requests: map[string]int{}},
+		versions:     &peerVersions{versions: map[string]PeerVersion{}},
+		listenIP:     "127.0.0.1",
+		port:         port,
+		role:         RoleArchive,
+		connLow:      defaultConnLow,
+		connHigh:     defaultConnHigh,
+	}
+	p2p.janitor = &janitor{p2p: p2p, expiry: defaultPeerExpiry}
+	p2p.keepalive = &keepalive{p2p: p2p, interval: defaultKeepaliveInterval, timeout: defaultKeepaliveTimeout}
+	p2p.events = newEventBus(p2p)
+	p2p.throttle = newThrottle()
+	p2p.skews = newClockSkews(p2p, defaultClockSkewThreshold)
+	p2p.leases = newLeaseTable()
+	p2p.leaseMode = LeaseModeQuorum
+	p2p.lifecycle = lifecycle.New(logger.WithField("context", "lifecycle"), 0, 0)
+	p2p.handlers = newMessageHandlers()
+	p2p.deadlines = &deadlines{}
+	unaryDeadline, streamDeadline := p2p.deadlineInterceptors()
+	p2p.unaryServerInterceptors = []grpc.UnaryServerInterceptor{p2p.handlerInterceptor, unaryDeadline}
+	p2p.streamServerInterceptors = []grpc.StreamServerInterceptor{streamDeadline}
+	for _, opt := range opts {
+		opt(p2p)
+	}
+	// the Admin service is gated before any other interceptor sees the call
+	unaryAdmin, streamAdmin := middleware.Auth(p2p.allowAdmin)
+	p2p.unaryServerInterceptors = append([]grpc.UnaryServerInterceptor{unaryAdmin}, p2p.unaryServerInterceptors...)
+	p2p.streamServerInterceptors = append([]grpc.StreamServerInterceptor{streamAdmin}, p2p.streamServerInterceptors...)
+
+	serverOpts := []grpc.ServerOption{p2pgrpc.WithP2PCredentials()}
+	if p2p.maxMsgSize > 0 {
+		serverOpts = append(serverOpts, grpc.MaxRecvMsgSize(p2p.maxMsgSize), grpc.MaxSendMsgSize(p2p.maxMsgSize))
 	}
+	serverOpts = append(serverOpts,
+		grpc.ChainUnaryInterceptor(p2p.unaryServerInterceptors...),
+		grpc.ChainStreamInterceptor(p2p.streamServerInterceptors...),
+	)
+	p2p.grpcServer = grpc.NewServer(serverOpts...)
+	p2p.protocols = newProtocolRegistry(p2p.grpcServer)
 
-	con, err := connmgr.NewConnManager(100, 400)
+	con, err := connmgr.NewConnManager(p2p.connLow, p2p.connHigh)
 	if err != nil {
 		return nil, err
 	}
 
-	host, err := libp2p.New(
+	hostOpts := []libp2p.Option{
 		libp2p.Identity(p2p.prvKey),
 		libp2p.ListenAddrStrings(
-			fmt.Sprintf("/ip4/127.0.0.1/udp/%d/quic-v1", port),
+			fmt.Sprintf("/ip4/%s/udp/%d/quic-v1", p2p.listenIP, port),
 		),
 		libp2p.Security(noise.ID, noise.New),
 		libp2p.Transport(quic.NewTransport),
 		libp2p.ConnectionManager(con),
-	)
+		libp2p.BandwidthReporter(p2p.bwCounter),
+	}
+	if p2p.bans != nil {
+		hostOpts = append(hostOpts, libp2p.ConnectionGater(&banGater{bans: p2p.bans}))
+	}
+	host, err := libp2p.New(hostOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to setup p2p host: %w", err)
 	}
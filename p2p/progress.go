@@ -0,0 +1,164 @@
+package p2p
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+// progressSmoothing is the weight of the latest sample in the moving average
+// of the commit rate
+const progressSmoothing = 0.3
+
+// SyncProgress describes how far the local database is behind its peers
+type SyncProgress struct {
+	LocalCommits int
+	// TotalCommits is the number of distinct commits known by us and our peers
+	TotalCommits int
+	BytesIn      int64
+	// RateIn is the inbound traffic in bytes per second
+	RateIn float64
+	// CommitRate is the number of commits fetched per second
+	CommitRate float64
+	// ETA is the estimated time until all commits are fetched, or -1 if unknown
+	ETA       time.Duration
+	UpdatedAt time.Time
+}
+
+// Missing returns the number of commits that still need to be fetched
+func (sp SyncProgress) Missing() int {
+	if sp.TotalCommits < sp.LocalCommits {
+		return 0
+	}
+	return sp.TotalCommits - sp.LocalCommits
+}
+
+// Proto converts the progress to its protobuf representation
+func (sp SyncProgress) Proto() *p2pproto.SyncProgress {
+	eta := int64(-1)
+	if sp.ETA >= 0 {
+		eta = sp.ETA.Milliseconds()
+	}
+	return &p2pproto.SyncProgress{
+		LocalCommits:  int64(sp.LocalCommits),
+		TotalCommits:  int64(sp.TotalCommits),
+		BytesIn:       sp.BytesIn,
+		RateIn:        sp.RateIn,
+		CommitRate:    sp.CommitRate,
+		EtaMs:         eta,
+		UpdatedUnixMs: sp.UpdatedAt.UnixMilli(),
+	}
+}
+
+// nextProgress computes the commit rate and ETA of the current sample, based
+// on the previous one
+func nextProgress(prev SyncProgress, cur SyncProgress) SyncProgress {
+	cur.ETA = -1
+	elapsed := cur.UpdatedAt.Sub(prev.UpdatedAt).Seconds()
+	if !prev.UpdatedAt.IsZero() && elapsed > 0 {
+		rate := float64(cur.LocalCommits-prev.LocalCommits) / elapsed
+		if rate < 0 {
+			rate = 0
+		}
+		cur.CommitRate = progressSmoothing*rate + (1-progressSmoothing)*prev.CommitRate
+	}
+
+	switch {
+	case cur.Missing() == 0:
+		cur.ETA = 0
+	case cur.CommitRate > 0:
+		cur.ETA = time.Duration(float64(cur.Missing()) / cur.CommitRate * float64(time.Second))
+	}
+	return cur
+}
+
+type progressTracker struct {
+	mtx      sync.RWMutex
+	progress SyncProgress
+}
+
+// SyncProgress returns the latest sync progress
+func (p2p *P2P) SyncProgress() SyncProgress {
+	p2p.progress.mtx.RLock()
+	defer p2p.progress.mtx.RUnlock()
+	return p2p.progress.progress
+}
+
+func (p2p *P2P) sampleSyncProgress() (SyncProgress, error) {
+	commits, err := p2p.externalDB.GetAllCommits()
+	if err != nil {
+		return SyncProgress{}, err
+	}
+
+	known := map[string]bool{}
+	localCommits := map[string]bool{}
+	for _, commit := range commits {
+		known[commit.Hash] = true
+		localCommits[commit.Hash] = true
+	}
+	local := len(known)
+	members := p2p.members()
+	for _, client := range p2p.GetClients() {
+		if !members.IsMember(client.GetID()) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		resp, err := client.GetAllCommits(ctx, &p2pproto.GetAllCommitsRequest{})
+		cancel()
+		if err != nil {
+			p2p.log.Debugf("Failed to retrieve commits of '%s': %v", client.GetID(), err)
+			continue
+		}
+		lag := 0
+		for _, commit := range resp.Commits {
+			if !localCommits[commit] {
+				lag++
+			}
+			known[commit] = true
+		}
+		p2p.events.updateLag(client.GetID(), lag)
+	}
+
+	bw := p2p.TotalBandwidth()
+	return SyncProgress{
+		LocalCommits: local,
+		TotalCommits: len(known),
+		BytesIn:      bw.TotalIn,
+		RateIn:       bw.RateIn,
+		UpdatedAt:    time.Now(),
+	}, nil
+}
+
+// TrackSyncProgress periodically compares the local commits with the commits
+// of all peers and calls onUpdate with the new progress.
+func (p2p *P2P) TrackSyncProgress(interval time.Duration, onUpdate func(SyncProgress)) func() error {
+	stopSignal := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				sample, err := p2p.sampleSyncProgress()
+				if err != nil {
+					p2p.log.Errorf("Failed to sample sync progress: %v", err)
+					continue
+				}
+				p2p.progress.mtx.Lock()
+				progress := nextProgress(p2p.progress.progress, sample)
+				p2p.progress.progress = progress
+				p2p.progress.mtx.Unlock()
+				onUpdate(progress)
+			case <-stopSignal:
+				return
+			}
+		}
+	}()
+	stopper := func() error {
+		stopSignal <- struct{}{}
+		return nil
+	}
+	return stopper
+}
@@ -0,0 +1,27 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextProgress(t *testing.T) {
+	start := time.Now()
+	first := nextProgress(SyncProgress{}, SyncProgress{LocalCommits: 10, TotalCommits: 110, UpdatedAt: start})
+	if first.ETA != -1 {
+		t.Errorf("expected unknown ETA without a rate, got %s", first.ETA)
+	}
+
+	second := nextProgress(first, SyncProgress{LocalCommits: 20, TotalCommits: 110, UpdatedAt: start.Add(time.Second)})
+	if second.CommitRate != 3 {
+		t.Errorf("expected a smoothed rate of 3 commits/s, got %f", second.CommitRate)
+	}
+	if second.ETA != 30*time.Second {
+		t.Errorf("expected an ETA of 30s, got %s", second.ETA)
+	}
+
+	done := nextProgress(second, SyncProgress{LocalCommits: 110, TotalCommits: 110, UpdatedAt: start.Add(2 * time.Second)})
+	if done.Missing() != 0 || done.ETA != 0 {
+		t.Errorf("expected sync to be complete, got %+v", done)
+	}
+}
@@ -0,0 +1,1187 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: p2p/proto/admin.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Admin_QueryMetrics_FullMethodName       = "/proto.Admin/QueryMetrics"
+	Admin_GetSyncProgress_FullMethodName    = "/proto.Admin/GetSyncProgress"
+	Admin_ListQuarantine_FullMethodName     = "/proto.Admin/ListQuarantine"
+	Admin_ApproveQuarantined_FullMethodName = "/proto.Admin/ApproveQuarantined"
+	Admin_PurgeQuarantined_FullMethodName   = "/proto.Admin/PurgeQuarantined"
+	Admin_GetLinks_FullMethodName           = "/proto.Admin/GetLinks"
+	Admin_ListMembers_FullMethodName        = "/proto.Admin/ListMembers"
+	Admin_AddMember_FullMethodName          = "/proto.Admin/AddMember"
+	Admin_RetireMember_FullMethodName       = "/proto.Admin/RetireMember"
+	Admin_RemoveMember_FullMethodName       = "/proto.Admin/RemoveMember"
+	Admin_ListConflicts_FullMethodName      = "/proto.Admin/ListConflicts"
+	Admin_ResolveConflict_FullMethodName    = "/proto.Admin/ResolveConflict"
+	Admin_GetStandby_FullMethodName         = "/proto.Admin/GetStandby"
+	Admin_Promote_FullMethodName            = "/proto.Admin/Promote"
+	Admin_GetHealth_FullMethodName          = "/proto.Admin/GetHealth"
+	Admin_SetDraining_FullMethodName        = "/proto.Admin/SetDraining"
+	Admin_GetDrainStatus_FullMethodName     = "/proto.Admin/GetDrainStatus"
+	Admin_Restart_FullMethodName            = "/proto.Admin/Restart"
+	Admin_TraceCommit_FullMethodName        = "/proto.Admin/TraceCommit"
+	Admin_DeployPlugin_FullMethodName       = "/proto.Admin/DeployPlugin"
+	Admin_RemovePlugin_FullMethodName       = "/proto.Admin/RemovePlugin"
+	Admin_ListPlugins_FullMethodName        = "/proto.Admin/ListPlugins"
+	Admin_SetProtoDump_FullMethodName       = "/proto.Admin/SetProtoDump"
+	Admin_GetProtoDump_FullMethodName       = "/proto.Admin/GetProtoDump"
+	Admin_ApproveCommit_FullMethodName      = "/proto.Admin/ApproveCommit"
+	Admin_ListApprovals_FullMethodName      = "/proto.Admin/ListApprovals"
+	Admin_ListNamedQueries_FullMethodName   = "/proto.Admin/ListNamedQueries"
+	Admin_DefineNamedQuery_FullMethodName   = "/proto.Admin/DefineNamedQuery"
+	Admin_DropNamedQuery_FullMethodName     = "/proto.Admin/DropNamedQuery"
+)
+
+// AdminClient is the client API for Admin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AdminClient interface {
+	QueryMetrics(ctx context.Context, in *QueryMetricsRequest, opts ...grpc.CallOption) (*QueryMetricsResponse, error)
+	GetSyncProgress(ctx context.Context, in *GetSyncProgressRequest, opts ...grpc.CallOption) (*SyncProgress, error)
+	ListQuarantine(ctx context.Context, in *ListQuarantineRequest, opts ...grpc.CallOption) (*ListQuarantineResponse, error)
+	ApproveQuarantined(ctx context.Context, in *ResolveQuarantinedRequest, opts ...grpc.CallOption) (*QuarantinedEntry, error)
+	PurgeQuarantined(ctx context.Context, in *ResolveQuarantinedRequest, opts ...grpc.CallOption) (*QuarantinedEntry, error)
+	GetLinks(ctx context.Context, in *GetLinksRequest, opts ...grpc.CallOption) (*GetLinksResponse, error)
+	ListMembers(ctx context.Context, in *ListMembersRequest, opts ...grpc.CallOption) (*ListMembersResponse, error)
+	AddMember(ctx context.Context, in *MemberRequest, opts ...grpc.CallOption) (*Member, error)
+	// RetireMember stops counting an active member towards quorums. Members are
+	// retired before they are removed
+	RetireMember(ctx context.Context, in *MemberRequest, opts ...grpc.CallOption) (*Member, error)
+	RemoveMember(ctx context.Context, in *MemberRequest, opts ...grpc.CallOption) (*Member, error)
+	ListConflicts(ctx context.Context, in *ListConflictsRequest, opts ...grpc.CallOption) (*ListConflictsResponse, error)
+	// ResolveConflict commits the resolution of merge conflicts, which is then
+	// synced to the other peers
+	ResolveConflict(ctx context.Context, in *ResolveConflictRequest, opts ...grpc.CallOption) (*ResolveConflictResponse, error)
+	GetStandby(ctx context.Context, in *GetStandbyRequest, opts ...grpc.CallOption) (*StandbyStatus, error)
+	// Promote makes a standby take over the role of its primary
+	Promote(ctx context.Context, in *PromoteRequest, opts ...grpc.CallOption) (*StandbyStatus, error)
+	// GetHealth returns the state of every subsystem of the node and if it's
+	// ready to serve
+	GetHealth(ctx context.Context, in *GetHealthRequest, opts ...grpc.CallOption) (*Health, error)
+	// SetDraining marks the node draining, or not draining anymore, and
+	// notifies its peers. It returns once the peers were notified.
+	SetDraining(ctx context.Context, in *SetDrainingRequest, opts ...grpc.CallOption) (*DrainStatus, error)
+	GetDrainStatus(ctx context.Context, in *GetDrainStatusRequest, opts ...grpc.CallOption) (*DrainStatus, error)
+	// Restart stops the node and starts it again with the same arguments. The
+	// node answers before it stops.
+	Restart(ctx context.Context, in *RestartRequest, opts ...grpc.CallOption) (*RestartResponse, error)
+	// TraceCommit asks the node and all its reachable peers if and when they
+	// applied a commit
+	TraceCommit(ctx context.Context, in *TraceCommitRequest, opts ...grpc.CallOption) (*TraceCommitResponse, error)
+	// DeployPlugin loads a plugin on the node, replacing the plugin with the
+	// same name, and publishes it to the peers
+	DeployPlugin(ctx context.Context, in *DeployPluginRequest, opts ...grpc.CallOption) (*PluginInfo, error)
+	RemovePlugin(ctx context.Context, in *RemovePluginRequest, opts ...grpc.CallOption) (*RemovePluginResponse, error)
+	ListPlugins(ctx context.Context, in *ListPluginsRequest, opts ...grpc.CallOption) (*ListPluginsResponse, error)
+	// SetProtoDump turns the dump of the messages exchanged with the peers on
+	// or off
+	SetProtoDump(ctx context.Context, in *SetProtoDumpRequest, opts ...grpc.CallOption) (*ProtoDumpStatus, error)
+	// GetProtoDump returns the most recently dumped messages
+	GetProtoDump(ctx context.Context, in *GetProtoDumpRequest, opts ...grpc.CallOption) (*GetProtoDumpResponse, error)
+	// ApproveCommit signs an approval of a commit of an approval branch with
+	// the key of the node and sends it to the peers
+	ApproveCommit(ctx context.Context, in *ApproveCommitRequest, opts ...grpc.CallOption) (*PendingApproval, error)
+	ListApprovals(ctx context.Context, in *ListApprovalsRequest, opts ...grpc.CallOption) (*ListApprovalsResponse, error)
+	ListNamedQueries(ctx context.Context, in *ListNamedQueriesRequest, opts ...grpc.CallOption) (*ListNamedQueriesResponse, error)
+	// DefineNamedQuery creates or replaces a named query. The registry is
+	// replicated, so the query can be run on every node once synced
+	DefineNamedQuery(ctx context.Context, in *NamedQuery, opts ...grpc.CallOption) (*NamedQuery, error)
+	DropNamedQuery(ctx context.Context, in *DropNamedQueryRequest, opts ...grpc.CallOption) (*DropNamedQueryResponse, error)
+}
+
+type adminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminClient(cc grpc.ClientConnInterface) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) QueryMetrics(ctx context.Context, in *QueryMetricsRequest, opts ...grpc.CallOption) (*QueryMetricsResponse, error) {
+	out := new(QueryMetricsResponse)
+	err := c.cc.Invoke(ctx, Admin_QueryMetrics_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetSyncProgress(ctx context.Context, in *GetSyncProgressRequest, opts ...grpc.CallOption) (*SyncProgress, error) {
+	out := new(SyncProgress)
+	err := c.cc.Invoke(ctx, Admin_GetSyncProgress_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListQuarantine(ctx context.Context, in *ListQuarantineRequest, opts ...grpc.CallOption) (*ListQuarantineResponse, error) {
+	out := new(ListQuarantineResponse)
+	err := c.cc.Invoke(ctx, Admin_ListQuarantine_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ApproveQuarantined(ctx context.Context, in *ResolveQuarantinedRequest, opts ...grpc.CallOption) (*QuarantinedEntry, error) {
+	out := new(QuarantinedEntry)
+	err := c.cc.Invoke(ctx, Admin_ApproveQuarantined_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) PurgeQuarantined(ctx context.Context, in *ResolveQuarantinedRequest, opts ...grpc.CallOption) (*QuarantinedEntry, error) {
+	out := new(QuarantinedEntry)
+	err := c.cc.Invoke(ctx, Admin_PurgeQuarantined_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetLinks(ctx context.Context, in *GetLinksRequest, opts ...grpc.CallOption) (*GetLinksResponse, error) {
+	out := new(GetLinksResponse)
+	err := c.cc.Invoke(ctx, Admin_GetLinks_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListMembers(ctx context.Context, in *ListMembersRequest, opts ...grpc.CallOption) (*ListMembersResponse, error) {
+	out := new(ListMembersResponse)
+	err := c.cc.Invoke(ctx, Admin_ListMembers_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) AddMember(ctx context.Context, in *MemberRequest, opts ...grpc.CallOption) (*Member, error) {
+	out := new(Member)
+	err := c.cc.Invoke(ctx, Admin_AddMember_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) RetireMember(ctx context.Context, in *MemberRequest, opts ...grpc.CallOption) (*Member, error) {
+	out := new(Member)
+	err := c.cc.Invoke(ctx, Admin_RetireMember_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) RemoveMember(ctx context.Context, in *MemberRequest, opts ...grpc.CallOption) (*Member, error) {
+	out := new(Member)
+	err := c.cc.Invoke(ctx, Admin_RemoveMember_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListConflicts(ctx context.Context, in *ListConflictsRequest, opts ...grpc.CallOption) (*ListConflictsResponse, error) {
+	out := new(ListConflictsResponse)
+	err := c.cc.Invoke(ctx, Admin_ListConflicts_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ResolveConflict(ctx context.Context, in *ResolveConflictRequest, opts ...grpc.CallOption) (*ResolveConflictResponse, error) {
+	out := new(ResolveConflictResponse)
+	err := c.cc.Invoke(ctx, Admin_ResolveConflict_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetStandby(ctx context.Context, in *GetStandbyRequest, opts ...grpc.CallOption) (*StandbyStatus, error) {
+	out := new(StandbyStatus)
+	err := c.cc.Invoke(ctx, Admin_GetStandby_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Promote(ctx context.Context, in *PromoteRequest, opts ...grpc.CallOption) (*StandbyStatus, error) {
+	out := new(StandbyStatus)
+	err := c.cc.Invoke(ctx, Admin_Promote_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetHealth(ctx context.Context, in *GetHealthRequest, opts ...grpc.CallOption) (*Health, error) {
+	out := new(Health)
+	err := c.cc.Invoke(ctx, Admin_GetHealth_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) SetDraining(ctx context.Context, in *SetDrainingRequest, opts ...grpc.CallOption) (*DrainStatus, error) {
+	out := new(DrainStatus)
+	err := c.cc.Invoke(ctx, Admin_SetDraining_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetDrainStatus(ctx context.Context, in *GetDrainStatusRequest, opts ...grpc.CallOption) (*DrainStatus, error) {
+	out := new(DrainStatus)
+	err := c.cc.Invoke(ctx, Admin_GetDrainStatus_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) Restart(ctx context.Context, in *RestartRequest, opts ...grpc.CallOption) (*RestartResponse, error) {
+	out := new(RestartResponse)
+	err := c.cc.Invoke(ctx, Admin_Restart_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) TraceCommit(ctx context.Context, in *TraceCommitRequest, opts ...grpc.CallOption) (*TraceCommitResponse, error) {
+	out := new(TraceCommitResponse)
+	err := c.cc.Invoke(ctx, Admin_TraceCommit_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) DeployPlugin(ctx context.Context, in *DeployPluginRequest, opts ...grpc.CallOption) (*PluginInfo, error) {
+	out := new(PluginInfo)
+	err := c.cc.Invoke(ctx, Admin_DeployPlugin_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) RemovePlugin(ctx context.Context, in *RemovePluginRequest, opts ...grpc.CallOption) (*RemovePluginResponse, error) {
+	out := new(RemovePluginResponse)
+	err := c.cc.Invoke(ctx, Admin_RemovePlugin_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListPlugins(ctx context.Context, in *ListPluginsRequest, opts ...grpc.CallOption) (*ListPluginsResponse, error) {
+	out := new(ListPluginsResponse)
+	err := c.cc.Invoke(ctx, Admin_ListPlugins_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) SetProtoDump(ctx context.Context, in *SetProtoDumpRequest, opts ...grpc.CallOption) (*ProtoDumpStatus, error) {
+	out := new(ProtoDumpStatus)
+	err := c.cc.Invoke(ctx, Admin_SetProtoDump_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetProtoDump(ctx context.Context, in *GetProtoDumpRequest, opts ...grpc.CallOption) (*GetProtoDumpResponse, error) {
+	out := new(GetProtoDumpResponse)
+	err := c.cc.Invoke(ctx, Admin_GetProtoDump_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ApproveCommit(ctx context.Context, in *ApproveCommitRequest, opts ...grpc.CallOption) (*PendingApproval, error) {
+	out := new(PendingApproval)
+	err := c.cc.Invoke(ctx, Admin_ApproveCommit_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListApprovals(ctx context.Context, in *ListApprovalsRequest, opts ...grpc.CallOption) (*ListApprovalsResponse, error) {
+	out := new(ListApprovalsResponse)
+	err := c.cc.Invoke(ctx, Admin_ListApprovals_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ListNamedQueries(ctx context.Context, in *ListNamedQueriesRequest, opts ...grpc.CallOption) (*ListNamedQueriesResponse, error) {
+	out := new(ListNamedQueriesResponse)
+	err := c.cc.Invoke(ctx, Admin_ListNamedQueries_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) DefineNamedQuery(ctx context.Context, in *NamedQuery, opts ...grpc.CallOption) (*NamedQuery, error) {
+	out := new(NamedQuery)
+	err := c.cc.Invoke(ctx, Admin_DefineNamedQuery_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) DropNamedQuery(ctx context.Context, in *DropNamedQueryRequest, opts ...grpc.CallOption) (*DropNamedQueryResponse, error) {
+	out := new(DropNamedQueryResponse)
+	err := c.cc.Invoke(ctx, Admin_DropNamedQuery_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServer is the server API for Admin service.
+// All implementations should embed UnimplementedAdminServer
+// for forward compatibility
+type AdminServer interface {
+	QueryMetrics(context.Context, *QueryMetricsRequest) (*QueryMetricsResponse, error)
+	GetSyncProgress(context.Context, *GetSyncProgressRequest) (*SyncProgress, error)
+	ListQuarantine(context.Context, *ListQuarantineRequest) (*ListQuarantineResponse, error)
+	ApproveQuarantined(context.Context, *ResolveQuarantinedRequest) (*QuarantinedEntry, error)
+	PurgeQuarantined(context.Context, *ResolveQuarantinedRequest) (*QuarantinedEntry, error)
+	GetLinks(context.Context, *GetLinksRequest) (*GetLinksResponse, error)
+	ListMembers(context.Context, *ListMembersRequest) (*ListMembersResponse, error)
+	AddMember(context.Context, *MemberRequest) (*Member, error)
+	// RetireMember stops counting an active member towards quorums. Members are
+	// retired before they are removed
+	RetireMember(context.Context, *MemberRequest) (*Member, error)
+	RemoveMember(context.Context, *MemberRequest) (*Member, error)
+	ListConflicts(context.Context, *ListConflictsRequest) (*ListConflictsResponse, error)
+	// ResolveConflict commits the resolution of merge conflicts, which is then
+	// synced to the other peers
+	ResolveConflict(context.Context, *ResolveConflictRequest) (*ResolveConflictResponse, error)
+	GetStandby(context.Context, *GetStandbyRequest) (*StandbyStatus, error)
+	// Promote makes a standby take over the role of its primary
+	Promote(context.Context, *PromoteRequest) (*StandbyStatus, error)
+	// GetHealth returns the state of every subsystem of the node and if it's
+	// ready to serve
+	GetHealth(context.Context, *GetHealthRequest) (*Health, error)
+	// SetDraining marks the node draining, or not draining anymore, and
+	// notifies its peers. It returns once the peers were notified.
+	SetDraining(context.Context, *SetDrainingRequest) (*DrainStatus, error)
+	GetDrainStatus(context.Context, *GetDrainStatusRequest) (*DrainStatus, error)
+	// Restart stops the node and starts it again with the same arguments. The
+	// node answers before it stops.
+	Restart(context.Context, *RestartRequest) (*RestartResponse, error)
+	// TraceCommit asks the node and all its reachable peers if and when they
+	// applied a commit
+	TraceCommit(context.Context, *TraceCommitRequest) (*TraceCommitResponse, error)
+	// DeployPlugin loads a plugin on the node, replacing the plugin with the
+	// same name, and publishes it to the peers
+	DeployPlugin(context.Context, *DeployPluginRequest) (*PluginInfo, error)
+	RemovePlugin(context.Context, *RemovePluginRequest) (*RemovePluginResponse, error)
+	ListPlugins(context.Context, *ListPluginsRequest) (*ListPluginsResponse, error)
+	// SetProtoDump turns the dump of the messages exchanged with the peers on
+	// or off
+	SetProtoDump(context.Context, *SetProtoDumpRequest) (*ProtoDumpStatus, error)
+	// GetProtoDump returns the most recently dumped messages
+	GetProtoDump(context.Context, *GetProtoDumpRequest) (*GetProtoDumpResponse, error)
+	// ApproveCommit signs an approval of a commit of an approval branch with
+	// the key of the node and sends it to the peers
+	ApproveCommit(context.Context, *ApproveCommitRequest) (*PendingApproval, error)
+	ListApprovals(context.Context, *ListApprovalsRequest) (*ListApprovalsResponse, error)
+	ListNamedQueries(context.Context, *ListNamedQueriesRequest) (*ListNamedQueriesResponse, error)
+	// DefineNamedQuery creates or replaces a named query. The registry is
+	// replicated, so the query can be run on every node once synced
+	DefineNamedQuery(context.Context, *NamedQuery) (*NamedQuery, error)
+	DropNamedQuery(context.Context, *DropNamedQueryRequest) (*DropNamedQueryResponse, error)
+}
+
+// UnimplementedAdminServer should be embedded to have forward compatible implementations.
+type UnimplementedAdminServer struct {
+}
+
+func (UnimplementedAdminServer) QueryMetrics(context.Context, *QueryMetricsRequest) (*QueryMetricsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryMetrics not implemented")
+}
+func (UnimplementedAdminServer) GetSyncProgress(context.Context, *GetSyncProgressRequest) (*SyncProgress, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSyncProgress not implemented")
+}
+func (UnimplementedAdminServer) ListQuarantine(context.Context, *ListQuarantineRequest) (*ListQuarantineResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListQuarantine not implemented")
+}
+func (UnimplementedAdminServer) ApproveQuarantined(context.Context, *ResolveQuarantinedRequest) (*QuarantinedEntry, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ApproveQuarantined not implemented")
+}
+func (UnimplementedAdminServer) PurgeQuarantined(context.Context, *ResolveQuarantinedRequest) (*QuarantinedEntry, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PurgeQuarantined not implemented")
+}
+func (UnimplementedAdminServer) GetLinks(context.Context, *GetLinksRequest) (*GetLinksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLinks not implemented")
+}
+func (UnimplementedAdminServer) ListMembers(context.Context, *ListMembersRequest) (*ListMembersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListMembers not implemented")
+}
+func (UnimplementedAdminServer) AddMember(context.Context, *MemberRequest) (*Member, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddMember not implemented")
+}
+func (UnimplementedAdminServer) RetireMember(context.Context, *MemberRequest) (*Member, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RetireMember not implemented")
+}
+func (UnimplementedAdminServer) RemoveMember(context.Context, *MemberRequest) (*Member, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveMember not implemented")
+}
+func (UnimplementedAdminServer) ListConflicts(context.Context, *ListConflictsRequest) (*ListConflictsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListConflicts not implemented")
+}
+func (UnimplementedAdminServer) ResolveConflict(context.Context, *ResolveConflictRequest) (*ResolveConflictResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResolveConflict not implemented")
+}
+func (UnimplementedAdminServer) GetStandby(context.Context, *GetStandbyRequest) (*StandbyStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStandby not implemented")
+}
+func (UnimplementedAdminServer) Promote(context.Context, *PromoteRequest) (*StandbyStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Promote not implemented")
+}
+func (UnimplementedAdminServer) GetHealth(context.Context, *GetHealthRequest) (*Health, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetHealth not implemented")
+}
+func (UnimplementedAdminServer) SetDraining(context.Context, *SetDrainingRequest) (*DrainStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetDraining not implemented")
+}
+func (UnimplementedAdminServer) GetDrainStatus(context.Context, *GetDrainStatusRequest) (*DrainStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDrainStatus not implemented")
+}
+func (UnimplementedAdminServer) Restart(context.Context, *RestartRequest) (*RestartResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Restart not implemented")
+}
+func (UnimplementedAdminServer) TraceCommit(context.Context, *TraceCommitRequest) (*TraceCommitResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TraceCommit not implemented")
+}
+func (UnimplementedAdminServer) DeployPlugin(context.Context, *DeployPluginRequest) (*PluginInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeployPlugin not implemented")
+}
+func (UnimplementedAdminServer) RemovePlugin(context.Context, *RemovePluginRequest) (*RemovePluginResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemovePlugin not implemented")
+}
+func (UnimplementedAdminServer) ListPlugins(context.Context, *ListPluginsRequest) (*ListPluginsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPlugins not implemented")
+}
+func (UnimplementedAdminServer) SetProtoDump(context.Context, *SetProtoDumpRequest) (*ProtoDumpStatus, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetProtoDump not implemented")
+}
+func (UnimplementedAdminServer) GetProtoDump(context.Context, *GetProtoDumpRequest) (*GetProtoDumpResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetProtoDump not implemented")
+}
+func (UnimplementedAdminServer) ApproveCommit(context.Context, *ApproveCommitRequest) (*PendingApproval, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ApproveCommit not implemented")
+}
+func (UnimplementedAdminServer) ListApprovals(context.Context, *ListApprovalsRequest) (*ListApprovalsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListApprovals not implemented")
+}
+func (UnimplementedAdminServer) ListNamedQueries(context.Context, *ListNamedQueriesRequest) (*ListNamedQueriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListNamedQueries not implemented")
+}
+func (UnimplementedAdminServer) DefineNamedQuery(context.Context, *NamedQuery) (*NamedQuery, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DefineNamedQuery not implemented")
+}
+func (UnimplementedAdminServer) DropNamedQuery(context.Context, *DropNamedQueryRequest) (*DropNamedQueryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DropNamedQuery not implemented")
+}
+
+// UnsafeAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminServer will
+// result in compilation errors.
+type UnsafeAdminServer interface {
+	mustEmbedUnimplementedAdminServer()
+}
+
+func RegisterAdminServer(s grpc.ServiceRegistrar, srv AdminServer) {
+	s.RegisterService(&Admin_ServiceDesc, srv)
+}
+
+func _Admin_QueryMetrics_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryMetricsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).QueryMetrics(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_QueryMetrics_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).QueryMetrics(ctx, req.(*QueryMetricsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetSyncProgress_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSyncProgressRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetSyncProgress(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_GetSyncProgress_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetSyncProgress(ctx, req.(*GetSyncProgressRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListQuarantine_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListQuarantineRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListQuarantine(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ListQuarantine_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListQuarantine(ctx, req.(*ListQuarantineRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ApproveQuarantined_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResolveQuarantinedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ApproveQuarantined(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ApproveQuarantined_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ApproveQuarantined(ctx, req.(*ResolveQuarantinedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_PurgeQuarantined_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResolveQuarantinedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).PurgeQuarantined(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_PurgeQuarantined_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).PurgeQuarantined(ctx, req.(*ResolveQuarantinedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetLinks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLinksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetLinks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_GetLinks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetLinks(ctx, req.(*GetLinksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListMembers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListMembersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListMembers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ListMembers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListMembers(ctx, req.(*ListMembersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_AddMember_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MemberRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).AddMember(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_AddMember_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).AddMember(ctx, req.(*MemberRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_RetireMember_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MemberRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).RetireMember(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_RetireMember_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).RetireMember(ctx, req.(*MemberRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_RemoveMember_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MemberRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).RemoveMember(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_RemoveMember_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).RemoveMember(ctx, req.(*MemberRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListConflicts_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListConflictsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListConflicts(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ListConflicts_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListConflicts(ctx, req.(*ListConflictsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ResolveConflict_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResolveConflictRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ResolveConflict(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ResolveConflict_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ResolveConflict(ctx, req.(*ResolveConflictRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetStandby_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStandbyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetStandby(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_GetStandby_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetStandby(ctx, req.(*GetStandbyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Promote_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PromoteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Promote(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_Promote_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Promote(ctx, req.(*PromoteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetHealth_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetHealthRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetHealth(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_GetHealth_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetHealth(ctx, req.(*GetHealthRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_SetDraining_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetDrainingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).SetDraining(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_SetDraining_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).SetDraining(ctx, req.(*SetDrainingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetDrainStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDrainStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetDrainStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_GetDrainStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetDrainStatus(ctx, req.(*GetDrainStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_Restart_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestartRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).Restart(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_Restart_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).Restart(ctx, req.(*RestartRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_TraceCommit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TraceCommitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).TraceCommit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_TraceCommit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).TraceCommit(ctx, req.(*TraceCommitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_DeployPlugin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeployPluginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).DeployPlugin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_DeployPlugin_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).DeployPlugin(ctx, req.(*DeployPluginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_RemovePlugin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemovePluginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).RemovePlugin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_RemovePlugin_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).RemovePlugin(ctx, req.(*RemovePluginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListPlugins_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPluginsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListPlugins(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ListPlugins_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListPlugins(ctx, req.(*ListPluginsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_SetProtoDump_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetProtoDumpRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).SetProtoDump(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_SetProtoDump_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).SetProtoDump(ctx, req.(*SetProtoDumpRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetProtoDump_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetProtoDumpRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetProtoDump(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_GetProtoDump_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetProtoDump(ctx, req.(*GetProtoDumpRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ApproveCommit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ApproveCommitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ApproveCommit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ApproveCommit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ApproveCommit(ctx, req.(*ApproveCommitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListApprovals_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListApprovalsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListApprovals(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ListApprovals_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListApprovals(ctx, req.(*ListApprovalsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ListNamedQueries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListNamedQueriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ListNamedQueries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ListNamedQueries_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ListNamedQueries(ctx, req.(*ListNamedQueriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_DefineNamedQuery_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(NamedQuery)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).DefineNamedQuery(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_DefineNamedQuery_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).DefineNamedQuery(ctx, req.(*NamedQuery))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_DropNamedQuery_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DropNamedQueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).DropNamedQuery(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_DropNamedQuery_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).DropNamedQuery(ctx, req.(*DropNamedQueryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Admin_ServiceDesc is the grpc.ServiceDesc for Admin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Admin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Admin",
+	HandlerType: (*AdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "QueryMetrics",
+			Handler:    _Admin_QueryMetrics_Handler,
+		},
+		{
+			MethodName: "GetSyncProgress",
+			Handler:    _Admin_GetSyncProgress_Handler,
+		},
+		{
+			MethodName: "ListQuarantine",
+			Handler:    _Admin_ListQuarantine_Handler,
+		},
+		{
+			MethodName: "ApproveQuarantined",
+			Handler:    _Admin_ApproveQuarantined_Handler,
+		},
+		{
+			MethodName: "PurgeQuarantined",
+			Handler:    _Admin_PurgeQuarantined_Handler,
+		},
+		{
+			MethodName: "GetLinks",
+			Handler:    _Admin_GetLinks_Handler,
+		},
+		{
+			MethodName: "ListMembers",
+			Handler:    _Admin_ListMembers_Handler,
+		},
+		{
+			MethodName: "AddMember",
+			Handler:    _Admin_AddMember_Handler,
+		},
+		{
+			MethodName: "RetireMember",
+			Handler:    _Admin_RetireMember_Handler,
+		},
+		{
+			MethodName: "RemoveMember",
+			Handler:    _Admin_RemoveMember_Handler,
+		},
+		{
+			MethodName: "ListConflicts",
+			Handler:    _Admin_ListConflicts_Handler,
+		},
+		{
+			MethodName: "ResolveConflict",
+			Handler:    _Admin_ResolveConflict_Handler,
+		},
+		{
+			MethodName: "GetStandby",
+			Handler:    _Admin_GetStandby_Handler,
+		},
+		{
+			MethodName: "Promote",
+			Handler:    _Admin_Promote_Handler,
+		},
+		{
+			MethodName: "GetHealth",
+			Handler:    _Admin_GetHealth_Handler,
+		},
+		{
+			MethodName: "SetDraining",
+			Handler:    _Admin_SetDraining_Handler,
+		},
+		{
+			MethodName: "GetDrainStatus",
+			Handler:    _Admin_GetDrainStatus_Handler,
+		},
+		{
+			MethodName: "Restart",
+			Handler:    _Admin_Restart_Handler,
+		},
+		{
+			MethodName: "TraceCommit",
+			Handler:    _Admin_TraceCommit_Handler,
+		},
+		{
+			MethodName: "DeployPlugin",
+			Handler:    _Admin_DeployPlugin_Handler,
+		},
+		{
+			MethodName: "RemovePlugin",
+			Handler:    _Admin_RemovePlugin_Handler,
+		},
+		{
+			MethodName: "ListPlugins",
+			Handler:    _Admin_ListPlugins_Handler,
+		},
+		{
+			MethodName: "SetProtoDump",
+			Handler:    _Admin_SetProtoDump_Handler,
+		},
+		{
+			MethodName: "GetProtoDump",
+			Handler:    _Admin_GetProtoDump_Handler,
+		},
+		{
+			MethodName: "ApproveCommit",
+			Handler:    _Admin_ApproveCommit_Handler,
+		},
+		{
+			MethodName: "ListApprovals",
+			Handler:    _Admin_ListApprovals_Handler,
+		},
+		{
+			MethodName: "ListNamedQueries",
+			Handler:    _Admin_ListNamedQueries_Handler,
+		},
+		{
+			MethodName: "DefineNamedQuery",
+			Handler:    _Admin_DefineNamedQuery_Handler,
+		},
+		{
+			MethodName: "DropNamedQuery",
+			Handler:    _Admin_DropNamedQuery_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "p2p/proto/admin.proto",
+}
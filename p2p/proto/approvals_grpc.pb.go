@@ -0,0 +1,113 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: p2p/proto/approvals.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Approvals_SubmitApproval_FullMethodName = "/proto.Approvals/SubmitApproval"
+)
+
+// ApprovalsClient is the client API for Approvals service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ApprovalsClient interface {
+	// SubmitApproval hands a signed approval of a commit to a peer. Approvals are
+	// checked against the signature of the approver and the branch policies of
+	// the receiving peer, so they can be relayed by any peer.
+	SubmitApproval(ctx context.Context, in *CommitApproval, opts ...grpc.CallOption) (*SubmitApprovalResponse, error)
+}
+
+type approvalsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewApprovalsClient(cc grpc.ClientConnInterface) ApprovalsClient {
+	return &approvalsClient{cc}
+}
+
+func (c *approvalsClient) SubmitApproval(ctx context.Context, in *CommitApproval, opts ...grpc.CallOption) (*SubmitApprovalResponse, error) {
+	out := new(SubmitApprovalResponse)
+	err := c.cc.Invoke(ctx, Approvals_SubmitApproval_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ApprovalsServer is the server API for Approvals service.
+// All implementations should embed UnimplementedApprovalsServer
+// for forward compatibility
+type ApprovalsServer interface {
+	// SubmitApproval hands a signed approval of a commit to a peer. Approvals are
+	// checked against the signature of the approver and the branch policies of
+	// the receiving peer, so they can be relayed by any peer.
+	SubmitApproval(context.Context, *CommitApproval) (*SubmitApprovalResponse, error)
+}
+
+// UnimplementedApprovalsServer should be embedded to have forward compatible implementations.
+type UnimplementedApprovalsServer struct {
+}
+
+func (UnimplementedApprovalsServer) SubmitApproval(context.Context, *CommitApproval) (*SubmitApprovalResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitApproval not implemented")
+}
+
+// UnsafeApprovalsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ApprovalsServer will
+// result in compilation errors.
+type UnsafeApprovalsServer interface {
+	mustEmbedUnimplementedApprovalsServer()
+}
+
+func RegisterApprovalsServer(s grpc.ServiceRegistrar, srv ApprovalsServer) {
+	s.RegisterService(&Approvals_ServiceDesc, srv)
+}
+
+func _Approvals_SubmitApproval_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CommitApproval)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ApprovalsServer).SubmitApproval(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Approvals_SubmitApproval_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ApprovalsServer).SubmitApproval(ctx, req.(*CommitApproval))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Approvals_ServiceDesc is the grpc.ServiceDesc for Approvals service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Approvals_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Approvals",
+	HandlerType: (*ApprovalsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SubmitApproval",
+			Handler:    _Approvals_SubmitApproval_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "p2p/proto/approvals.proto",
+}
@@ -0,0 +1,329 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: p2p/proto/blobs.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Blobs_PutBlob_FullMethodName   = "/proto.Blobs/PutBlob"
+	Blobs_GetBlob_FullMethodName   = "/proto.Blobs/GetBlob"
+	Blobs_StatBlob_FullMethodName  = "/proto.Blobs/StatBlob"
+	Blobs_PinBlob_FullMethodName   = "/proto.Blobs/PinBlob"
+	Blobs_UnpinBlob_FullMethodName = "/proto.Blobs/UnpinBlob"
+)
+
+// BlobsClient is the client API for Blobs service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type BlobsClient interface {
+	// PutBlob stores a blob sent in chunks and references it in the blobs
+	// table. The name and content type are read from the first chunk.
+	PutBlob(ctx context.Context, opts ...grpc.CallOption) (Blobs_PutBlobClient, error)
+	// GetBlob streams a blob, fetching it from a peer first if the node
+	// doesn't have it
+	GetBlob(ctx context.Context, in *GetBlobRequest, opts ...grpc.CallOption) (Blobs_GetBlobClient, error)
+	StatBlob(ctx context.Context, in *BlobRequest, opts ...grpc.CallOption) (*BlobInfo, error)
+	// PinBlob keeps a blob on the node, fetching it first if needed. Unpinned
+	// blobs can be evicted by light nodes.
+	PinBlob(ctx context.Context, in *BlobRequest, opts ...grpc.CallOption) (*BlobInfo, error)
+	UnpinBlob(ctx context.Context, in *BlobRequest, opts ...grpc.CallOption) (*BlobInfo, error)
+}
+
+type blobsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBlobsClient(cc grpc.ClientConnInterface) BlobsClient {
+	return &blobsClient{cc}
+}
+
+func (c *blobsClient) PutBlob(ctx context.Context, opts ...grpc.CallOption) (Blobs_PutBlobClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Blobs_ServiceDesc.Streams[0], Blobs_PutBlob_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &blobsPutBlobClient{stream}
+	return x, nil
+}
+
+type Blobs_PutBlobClient interface {
+	Send(*PutBlobRequest) error
+	CloseAndRecv() (*BlobInfo, error)
+	grpc.ClientStream
+}
+
+type blobsPutBlobClient struct {
+	grpc.ClientStream
+}
+
+func (x *blobsPutBlobClient) Send(m *PutBlobRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *blobsPutBlobClient) CloseAndRecv() (*BlobInfo, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(BlobInfo)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *blobsClient) GetBlob(ctx context.Context, in *GetBlobRequest, opts ...grpc.CallOption) (Blobs_GetBlobClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Blobs_ServiceDesc.Streams[1], Blobs_GetBlob_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &blobsGetBlobClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Blobs_GetBlobClient interface {
+	Recv() (*BlobChunk, error)
+	grpc.ClientStream
+}
+
+type blobsGetBlobClient struct {
+	grpc.ClientStream
+}
+
+func (x *blobsGetBlobClient) Recv() (*BlobChunk, error) {
+	m := new(BlobChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *blobsClient) StatBlob(ctx context.Context, in *BlobRequest, opts ...grpc.CallOption) (*BlobInfo, error) {
+	out := new(BlobInfo)
+	err := c.cc.Invoke(ctx, Blobs_StatBlob_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blobsClient) PinBlob(ctx context.Context, in *BlobRequest, opts ...grpc.CallOption) (*BlobInfo, error) {
+	out := new(BlobInfo)
+	err := c.cc.Invoke(ctx, Blobs_PinBlob_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blobsClient) UnpinBlob(ctx context.Context, in *BlobRequest, opts ...grpc.CallOption) (*BlobInfo, error) {
+	out := new(BlobInfo)
+	err := c.cc.Invoke(ctx, Blobs_UnpinBlob_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// BlobsServer is the server API for Blobs service.
+// All implementations should embed UnimplementedBlobsServer
+// for forward compatibility
+type BlobsServer interface {
+	// PutBlob stores a blob sent in chunks and references it in the blobs
+	// table. The name and content type are read from the first chunk.
+	PutBlob(Blobs_PutBlobServer) error
+	// GetBlob streams a blob, fetching it from a peer first if the node
+	// doesn't have it
+	GetBlob(*GetBlobRequest, Blobs_GetBlobServer) error
+	StatBlob(context.Context, *BlobRequest) (*BlobInfo, error)
+	// PinBlob keeps a blob on the node, fetching it first if needed. Unpinned
+	// blobs can be evicted by light nodes.
+	PinBlob(context.Context, *BlobRequest) (*BlobInfo, error)
+	UnpinBlob(context.Context, *BlobRequest) (*BlobInfo, error)
+}
+
+// UnimplementedBlobsServer should be embedded to have forward compatible implementations.
+type UnimplementedBlobsServer struct {
+}
+
+func (UnimplementedBlobsServer) PutBlob(Blobs_PutBlobServer) error {
+	return status.Errorf(codes.Unimplemented, "method PutBlob not implemented")
+}
+func (UnimplementedBlobsServer) GetBlob(*GetBlobRequest, Blobs_GetBlobServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetBlob not implemented")
+}
+func (UnimplementedBlobsServer) StatBlob(context.Context, *BlobRequest) (*BlobInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StatBlob not implemented")
+}
+func (UnimplementedBlobsServer) PinBlob(context.Context, *BlobRequest) (*BlobInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PinBlob not implemented")
+}
+func (UnimplementedBlobsServer) UnpinBlob(context.Context, *BlobRequest) (*BlobInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnpinBlob not implemented")
+}
+
+// UnsafeBlobsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BlobsServer will
+// result in compilation errors.
+type UnsafeBlobsServer interface {
+	mustEmbedUnimplementedBlobsServer()
+}
+
+func RegisterBlobsServer(s grpc.ServiceRegistrar, srv BlobsServer) {
+	s.RegisterService(&Blobs_ServiceDesc, srv)
+}
+
+func _Blobs_PutBlob_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(BlobsServer).PutBlob(&blobsPutBlobServer{stream})
+}
+
+type Blobs_PutBlobServer interface {
+	SendAndClose(*BlobInfo) error
+	Recv() (*PutBlobRequest, error)
+	grpc.ServerStream
+}
+
+type blobsPutBlobServer struct {
+	grpc.ServerStream
+}
+
+func (x *blobsPutBlobServer) SendAndClose(m *BlobInfo) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *blobsPutBlobServer) Recv() (*PutBlobRequest, error) {
+	m := new(PutBlobRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Blobs_GetBlob_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetBlobRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BlobsServer).GetBlob(m, &blobsGetBlobServer{stream})
+}
+
+type Blobs_GetBlobServer interface {
+	Send(*BlobChunk) error
+	grpc.ServerStream
+}
+
+type blobsGetBlobServer struct {
+	grpc.ServerStream
+}
+
+func (x *blobsGetBlobServer) Send(m *BlobChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Blobs_StatBlob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BlobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlobsServer).StatBlob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Blobs_StatBlob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlobsServer).StatBlob(ctx, req.(*BlobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Blobs_PinBlob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BlobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlobsServer).PinBlob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Blobs_PinBlob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlobsServer).PinBlob(ctx, req.(*BlobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Blobs_UnpinBlob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BlobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlobsServer).UnpinBlob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Blobs_UnpinBlob_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlobsServer).UnpinBlob(ctx, req.(*BlobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Blobs_ServiceDesc is the grpc.ServiceDesc for Blobs service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Blobs_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Blobs",
+	HandlerType: (*BlobsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "StatBlob",
+			Handler:    _Blobs_StatBlob_Handler,
+		},
+		{
+			MethodName: "PinBlob",
+			Handler:    _Blobs_PinBlob_Handler,
+		},
+		{
+			MethodName: "UnpinBlob",
+			Handler:    _Blobs_UnpinBlob_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "PutBlob",
+			Handler:       _Blobs_PutBlob_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "GetBlob",
+			Handler:       _Blobs_GetBlob_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "p2p/proto/blobs.proto",
+}
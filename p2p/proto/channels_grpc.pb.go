@@ -0,0 +1,144 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: p2p/proto/channels.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Channels_Invite_FullMethodName  = "/proto.Channels/Invite"
+	Channels_Deliver_FullMethodName = "/proto.Channels/Deliver"
+)
+
+// ChannelsClient is the client API for Channels service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ChannelsClient interface {
+	Invite(ctx context.Context, in *InviteRequest, opts ...grpc.CallOption) (*InviteResponse, error)
+	Deliver(ctx context.Context, in *ChannelMessage, opts ...grpc.CallOption) (*DeliverResponse, error)
+}
+
+type channelsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewChannelsClient(cc grpc.ClientConnInterface) ChannelsClient {
+	return &channelsClient{cc}
+}
+
+func (c *channelsClient) Invite(ctx context.Context, in *InviteRequest, opts ...grpc.CallOption) (*InviteResponse, error) {
+	out := new(InviteResponse)
+	err := c.cc.Invoke(ctx, Channels_Invite_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *channelsClient) Deliver(ctx context.Context, in *ChannelMessage, opts ...grpc.CallOption) (*DeliverResponse, error) {
+	out := new(DeliverResponse)
+	err := c.cc.Invoke(ctx, Channels_Deliver_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ChannelsServer is the server API for Channels service.
+// All implementations should embed UnimplementedChannelsServer
+// for forward compatibility
+type ChannelsServer interface {
+	Invite(context.Context, *InviteRequest) (*InviteResponse, error)
+	Deliver(context.Context, *ChannelMessage) (*DeliverResponse, error)
+}
+
+// UnimplementedChannelsServer should be embedded to have forward compatible implementations.
+type UnimplementedChannelsServer struct {
+}
+
+func (UnimplementedChannelsServer) Invite(context.Context, *InviteRequest) (*InviteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Invite not implemented")
+}
+func (UnimplementedChannelsServer) Deliver(context.Context, *ChannelMessage) (*DeliverResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Deliver not implemented")
+}
+
+// UnsafeChannelsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ChannelsServer will
+// result in compilation errors.
+type UnsafeChannelsServer interface {
+	mustEmbedUnimplementedChannelsServer()
+}
+
+func RegisterChannelsServer(s grpc.ServiceRegistrar, srv ChannelsServer) {
+	s.RegisterService(&Channels_ServiceDesc, srv)
+}
+
+func _Channels_Invite_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InviteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChannelsServer).Invite(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Channels_Invite_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChannelsServer).Invite(ctx, req.(*InviteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Channels_Deliver_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChannelMessage)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChannelsServer).Deliver(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Channels_Deliver_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChannelsServer).Deliver(ctx, req.(*ChannelMessage))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Channels_ServiceDesc is the grpc.ServiceDesc for Channels service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Channels_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Channels",
+	HandlerType: (*ChannelsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Invite",
+			Handler:    _Channels_Invite_Handler,
+		},
+		{
+			MethodName: "Deliver",
+			Handler:    _Channels_Deliver_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "p2p/proto/channels.proto",
+}
@@ -0,0 +1,134 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: p2p/proto/commits.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Commits_Subscribe_FullMethodName = "/proto.Commits/Subscribe"
+)
+
+// CommitsClient is the client API for Commits service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CommitsClient interface {
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Commits_SubscribeClient, error)
+}
+
+type commitsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCommitsClient(cc grpc.ClientConnInterface) CommitsClient {
+	return &commitsClient{cc}
+}
+
+func (c *commitsClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Commits_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Commits_ServiceDesc.Streams[0], Commits_Subscribe_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &commitsSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Commits_SubscribeClient interface {
+	Recv() (*CommitEvent, error)
+	grpc.ClientStream
+}
+
+type commitsSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *commitsSubscribeClient) Recv() (*CommitEvent, error) {
+	m := new(CommitEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// CommitsServer is the server API for Commits service.
+// All implementations should embed UnimplementedCommitsServer
+// for forward compatibility
+type CommitsServer interface {
+	Subscribe(*SubscribeRequest, Commits_SubscribeServer) error
+}
+
+// UnimplementedCommitsServer should be embedded to have forward compatible implementations.
+type UnimplementedCommitsServer struct {
+}
+
+func (UnimplementedCommitsServer) Subscribe(*SubscribeRequest, Commits_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+
+// UnsafeCommitsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CommitsServer will
+// result in compilation errors.
+type UnsafeCommitsServer interface {
+	mustEmbedUnimplementedCommitsServer()
+}
+
+func RegisterCommitsServer(s grpc.ServiceRegistrar, srv CommitsServer) {
+	s.RegisterService(&Commits_ServiceDesc, srv)
+}
+
+func _Commits_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CommitsServer).Subscribe(m, &commitsSubscribeServer{stream})
+}
+
+type Commits_SubscribeServer interface {
+	Send(*CommitEvent) error
+	grpc.ServerStream
+}
+
+type commitsSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *commitsSubscribeServer) Send(m *CommitEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Commits_ServiceDesc is the grpc.ServiceDesc for Commits service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Commits_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Commits",
+	HandlerType: (*CommitsServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _Commits_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "p2p/proto/commits.proto",
+}
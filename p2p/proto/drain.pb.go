@@ -0,0 +1,200 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.31.0
+// 	protoc        (unknown)
+// source: p2p/proto/drain.proto
+
+package proto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type DrainNotice struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Draining bool `protobuf:"varint,1,opt,name=draining,proto3" json:"draining,omitempty"`
+}
+
+func (x *DrainNotice) Reset() {
+	*x = DrainNotice{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_p2p_proto_drain_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DrainNotice) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DrainNotice) ProtoMessage() {}
+
+func (x *DrainNotice) ProtoReflect() protoreflect.Message {
+	mi := &file_p2p_proto_drain_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DrainNotice.ProtoReflect.Descriptor instead.
+func (*DrainNotice) Descriptor() ([]byte, []int) {
+	return file_p2p_proto_drain_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *DrainNotice) GetDraining() bool {
+	if x != nil {
+		return x.Draining
+	}
+	return false
+}
+
+type DrainAck struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *DrainAck) Reset() {
+	*x = DrainAck{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_p2p_proto_drain_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DrainAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DrainAck) ProtoMessage() {}
+
+func (x *DrainAck) ProtoReflect() protoreflect.Message {
+	mi := &file_p2p_proto_drain_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DrainAck.ProtoReflect.Descriptor instead.
+func (*DrainAck) Descriptor() ([]byte, []int) {
+	return file_p2p_proto_drain_proto_rawDescGZIP(), []int{1}
+}
+
+var File_p2p_proto_drain_proto protoreflect.FileDescriptor
+
+var file_p2p_proto_drain_proto_rawDesc = []byte{
+	0x0a, 0x15, 0x70, 0x32, 0x70, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x64, 0x72, 0x61, 0x69,
+	0x6e, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x05, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x29,
+	0x0a, 0x0b, 0x44, 0x72, 0x61, 0x69, 0x6e, 0x4e, 0x6f, 0x74, 0x69, 0x63, 0x65, 0x12, 0x1a, 0x0a,
+	0x08, 0x64, 0x72, 0x61, 0x69, 0x6e, 0x69, 0x6e, 0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x08, 0x64, 0x72, 0x61, 0x69, 0x6e, 0x69, 0x6e, 0x67, 0x22, 0x0a, 0x0a, 0x08, 0x44, 0x72, 0x61,
+	0x69, 0x6e, 0x41, 0x63, 0x6b, 0x32, 0x3d, 0x0a, 0x05, 0x44, 0x72, 0x61, 0x69, 0x6e, 0x12, 0x34,
+	0x0a, 0x0b, 0x4e, 0x6f, 0x74, 0x69, 0x66, 0x79, 0x44, 0x72, 0x61, 0x69, 0x6e, 0x12, 0x12, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x44, 0x72, 0x61, 0x69, 0x6e, 0x4e, 0x6f, 0x74, 0x69, 0x63,
+	0x65, 0x1a, 0x0f, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x44, 0x72, 0x61, 0x69, 0x6e, 0x41,
+	0x63, 0x6b, 0x22, 0x00, 0x42, 0x09, 0x5a, 0x07, 0x2e, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62,
+	0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_p2p_proto_drain_proto_rawDescOnce sync.Once
+	file_p2p_proto_drain_proto_rawDescData = file_p2p_proto_drain_proto_rawDesc
+)
+
+func file_p2p_proto_drain_proto_rawDescGZIP() []byte {
+	file_p2p_proto_drain_proto_rawDescOnce.Do(func() {
+		file_p2p_proto_drain_proto_rawDescData = protoimpl.X.CompressGZIP(file_p2p_proto_drain_proto_rawDescData)
+	})
+	return file_p2p_proto_drain_proto_rawDescData
+}
+
+var file_p2p_proto_drain_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_p2p_proto_drain_proto_goTypes = []interface{}{
+	(*DrainNotice)(nil), // 0: proto.DrainNotice
+	(*DrainAck)(nil),    // 1: proto.DrainAck
+}
+var file_p2p_proto_drain_proto_depIdxs = []int32{
+	0, // 0: proto.Drain.NotifyDrain:input_type -> proto.DrainNotice
+	1, // 1: proto.Drain.NotifyDrain:output_type -> proto.DrainAck
+	1, // [1:2] is the sub-list for method output_type
+	0, // [0:1] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_p2p_proto_drain_proto_init() }
+func file_p2p_proto_drain_proto_init() {
+	if File_p2p_proto_drain_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_p2p_proto_drain_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DrainNotice); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_p2p_proto_drain_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DrainAck); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_p2p_proto_drain_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_p2p_proto_drain_proto_goTypes,
+		DependencyIndexes: file_p2p_proto_drain_proto_depIdxs,
+		MessageInfos:      file_p2p_proto_drain_proto_msgTypes,
+	}.Build()
+	File_p2p_proto_drain_proto = out.File
+	file_p2p_proto_drain_proto_rawDesc = nil
+	file_p2p_proto_drain_proto_goTypes = nil
+	file_p2p_proto_drain_proto_depIdxs = nil
+}
@@ -0,0 +1,111 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: p2p/proto/drain.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Drain_NotifyDrain_FullMethodName = "/proto.Drain/NotifyDrain"
+)
+
+// DrainClient is the client API for Drain service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type DrainClient interface {
+	// NotifyDrain is called by a node that starts or stops draining, e.g.
+	// before a restart, so that its peers route around it until it's back
+	NotifyDrain(ctx context.Context, in *DrainNotice, opts ...grpc.CallOption) (*DrainAck, error)
+}
+
+type drainClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDrainClient(cc grpc.ClientConnInterface) DrainClient {
+	return &drainClient{cc}
+}
+
+func (c *drainClient) NotifyDrain(ctx context.Context, in *DrainNotice, opts ...grpc.CallOption) (*DrainAck, error) {
+	out := new(DrainAck)
+	err := c.cc.Invoke(ctx, Drain_NotifyDrain_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DrainServer is the server API for Drain service.
+// All implementations should embed UnimplementedDrainServer
+// for forward compatibility
+type DrainServer interface {
+	// NotifyDrain is called by a node that starts or stops draining, e.g.
+	// before a restart, so that its peers route around it until it's back
+	NotifyDrain(context.Context, *DrainNotice) (*DrainAck, error)
+}
+
+// UnimplementedDrainServer should be embedded to have forward compatible implementations.
+type UnimplementedDrainServer struct {
+}
+
+func (UnimplementedDrainServer) NotifyDrain(context.Context, *DrainNotice) (*DrainAck, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method NotifyDrain not implemented")
+}
+
+// UnsafeDrainServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DrainServer will
+// result in compilation errors.
+type UnsafeDrainServer interface {
+	mustEmbedUnimplementedDrainServer()
+}
+
+func RegisterDrainServer(s grpc.ServiceRegistrar, srv DrainServer) {
+	s.RegisterService(&Drain_ServiceDesc, srv)
+}
+
+func _Drain_NotifyDrain_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DrainNotice)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DrainServer).NotifyDrain(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Drain_NotifyDrain_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DrainServer).NotifyDrain(ctx, req.(*DrainNotice))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Drain_ServiceDesc is the grpc.ServiceDesc for Drain service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Drain_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Drain",
+	HandlerType: (*DrainServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "NotifyDrain",
+			Handler:    _Drain_NotifyDrain_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "p2p/proto/drain.proto",
+}
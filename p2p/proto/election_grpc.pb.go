@@ -0,0 +1,144 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: p2p/proto/election.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Election_Elect_FullMethodName       = "/proto.Election/Elect"
+	Election_Coordinator_FullMethodName = "/proto.Election/Coordinator"
+)
+
+// ElectionClient is the client API for Election service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ElectionClient interface {
+	Elect(ctx context.Context, in *ElectRequest, opts ...grpc.CallOption) (*ElectResponse, error)
+	Coordinator(ctx context.Context, in *CoordinatorRequest, opts ...grpc.CallOption) (*CoordinatorResponse, error)
+}
+
+type electionClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewElectionClient(cc grpc.ClientConnInterface) ElectionClient {
+	return &electionClient{cc}
+}
+
+func (c *electionClient) Elect(ctx context.Context, in *ElectRequest, opts ...grpc.CallOption) (*ElectResponse, error) {
+	out := new(ElectResponse)
+	err := c.cc.Invoke(ctx, Election_Elect_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *electionClient) Coordinator(ctx context.Context, in *CoordinatorRequest, opts ...grpc.CallOption) (*CoordinatorResponse, error) {
+	out := new(CoordinatorResponse)
+	err := c.cc.Invoke(ctx, Election_Coordinator_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ElectionServer is the server API for Election service.
+// All implementations should embed UnimplementedElectionServer
+// for forward compatibility
+type ElectionServer interface {
+	Elect(context.Context, *ElectRequest) (*ElectResponse, error)
+	Coordinator(context.Context, *CoordinatorRequest) (*CoordinatorResponse, error)
+}
+
+// UnimplementedElectionServer should be embedded to have forward compatible implementations.
+type UnimplementedElectionServer struct {
+}
+
+func (UnimplementedElectionServer) Elect(context.Context, *ElectRequest) (*ElectResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Elect not implemented")
+}
+func (UnimplementedElectionServer) Coordinator(context.Context, *CoordinatorRequest) (*CoordinatorResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Coordinator not implemented")
+}
+
+// UnsafeElectionServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ElectionServer will
+// result in compilation errors.
+type UnsafeElectionServer interface {
+	mustEmbedUnimplementedElectionServer()
+}
+
+func RegisterElectionServer(s grpc.ServiceRegistrar, srv ElectionServer) {
+	s.RegisterService(&Election_ServiceDesc, srv)
+}
+
+func _Election_Elect_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ElectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ElectionServer).Elect(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Election_Elect_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ElectionServer).Elect(ctx, req.(*ElectRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Election_Coordinator_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CoordinatorRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ElectionServer).Coordinator(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Election_Coordinator_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ElectionServer).Coordinator(ctx, req.(*CoordinatorRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Election_ServiceDesc is the grpc.ServiceDesc for Election service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Election_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Election",
+	HandlerType: (*ElectionServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Elect",
+			Handler:    _Election_Elect_Handler,
+		},
+		{
+			MethodName: "Coordinator",
+			Handler:    _Election_Coordinator_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "p2p/proto/election.proto",
+}
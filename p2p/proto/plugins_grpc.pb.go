@@ -0,0 +1,115 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: p2p/proto/plugins.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Plugins_PublishPlugin_FullMethodName = "/proto.Plugins/PublishPlugin"
+)
+
+// PluginsClient is the client API for Plugins service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type PluginsClient interface {
+	// PublishPlugin is called by a node that deploys, removes or relays a
+	// plugin, and by the peers of a node that connects, with every plugin they
+	// know. The highest version of every plugin wins. Versions that are not
+	// signed by an admin key are refused.
+	PublishPlugin(ctx context.Context, in *Plugin, opts ...grpc.CallOption) (*PublishPluginResponse, error)
+}
+
+type pluginsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPluginsClient(cc grpc.ClientConnInterface) PluginsClient {
+	return &pluginsClient{cc}
+}
+
+func (c *pluginsClient) PublishPlugin(ctx context.Context, in *Plugin, opts ...grpc.CallOption) (*PublishPluginResponse, error) {
+	out := new(PublishPluginResponse)
+	err := c.cc.Invoke(ctx, Plugins_PublishPlugin_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PluginsServer is the server API for Plugins service.
+// All implementations should embed UnimplementedPluginsServer
+// for forward compatibility
+type PluginsServer interface {
+	// PublishPlugin is called by a node that deploys, removes or relays a
+	// plugin, and by the peers of a node that connects, with every plugin they
+	// know. The highest version of every plugin wins. Versions that are not
+	// signed by an admin key are refused.
+	PublishPlugin(context.Context, *Plugin) (*PublishPluginResponse, error)
+}
+
+// UnimplementedPluginsServer should be embedded to have forward compatible implementations.
+type UnimplementedPluginsServer struct {
+}
+
+func (UnimplementedPluginsServer) PublishPlugin(context.Context, *Plugin) (*PublishPluginResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PublishPlugin not implemented")
+}
+
+// UnsafePluginsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PluginsServer will
+// result in compilation errors.
+type UnsafePluginsServer interface {
+	mustEmbedUnimplementedPluginsServer()
+}
+
+func RegisterPluginsServer(s grpc.ServiceRegistrar, srv PluginsServer) {
+	s.RegisterService(&Plugins_ServiceDesc, srv)
+}
+
+func _Plugins_PublishPlugin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Plugin)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PluginsServer).PublishPlugin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Plugins_PublishPlugin_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PluginsServer).PublishPlugin(ctx, req.(*Plugin))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Plugins_ServiceDesc is the grpc.ServiceDesc for Plugins service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Plugins_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Plugins",
+	HandlerType: (*PluginsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "PublishPlugin",
+			Handler:    _Plugins_PublishPlugin_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "p2p/proto/plugins.proto",
+}
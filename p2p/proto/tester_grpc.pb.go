@@ -19,9 +19,19 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	Tester_ExecSQL_FullMethodName       = "/proto.Tester/ExecSQL"
-	Tester_GetAllCommits_FullMethodName = "/proto.Tester/GetAllCommits"
-	Tester_GetHead_FullMethodName       = "/proto.Tester/GetHead"
+	Tester_ExecSQL_FullMethodName        = "/proto.Tester/ExecSQL"
+	Tester_GetAllCommits_FullMethodName  = "/proto.Tester/GetAllCommits"
+	Tester_StreamCommits_FullMethodName  = "/proto.Tester/StreamCommits"
+	Tester_GetHead_FullMethodName        = "/proto.Tester/GetHead"
+	Tester_AckCommit_FullMethodName      = "/proto.Tester/AckCommit"
+	Tester_CompareCommits_FullMethodName = "/proto.Tester/CompareCommits"
+	Tester_Query_FullMethodName          = "/proto.Tester/Query"
+	Tester_CallProcedure_FullMethodName  = "/proto.Tester/CallProcedure"
+	Tester_Missed_FullMethodName         = "/proto.Tester/Missed"
+	Tester_ReportLag_FullMethodName      = "/proto.Tester/ReportLag"
+	Tester_TableStats_FullMethodName     = "/proto.Tester/TableStats"
+	Tester_Explain_FullMethodName        = "/proto.Tester/Explain"
+	Tester_RunNamedQuery_FullMethodName  = "/proto.Tester/RunNamedQuery"
 )
 
 // TesterClient is the client API for Tester service.
@@ -30,7 +40,28 @@ const (
 type TesterClient interface {
 	ExecSQL(ctx context.Context, in *ExecSQLRequest, opts ...grpc.CallOption) (*ExecSQLResponse, error)
 	GetAllCommits(ctx context.Context, in *GetAllCommitsRequest, opts ...grpc.CallOption) (*GetAllCommitsResponse, error)
+	// StreamCommits sends the commits of a branch in pages of limit commits
+	StreamCommits(ctx context.Context, in *GetAllCommitsRequest, opts ...grpc.CallOption) (Tester_StreamCommitsClient, error)
 	GetHead(ctx context.Context, in *GetHeadRequest, opts ...grpc.CallOption) (*GetHeadResponse, error)
+	AckCommit(ctx context.Context, in *AckCommitRequest, opts ...grpc.CallOption) (*AckCommitResponse, error)
+	CompareCommits(ctx context.Context, in *CompareCommitsRequest, opts ...grpc.CallOption) (*CompareCommitsResponse, error)
+	Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (*QueryResponse, error)
+	CallProcedure(ctx context.Context, in *CallProcedureRequest, opts ...grpc.CallOption) (*QueryResponse, error)
+	// Missed returns the commits announced after the caller's frontier, so that
+	// a node can catch up on the announcements it missed while disconnected
+	Missed(ctx context.Context, in *MissedRequest, opts ...grpc.CallOption) (*MissedResponse, error)
+	// ReportLag tells a peer how many commits the caller is behind, so that
+	// writers can slow down for slow replicas
+	ReportLag(ctx context.Context, in *ReportLagRequest, opts ...grpc.CallOption) (*ReportLagResponse, error)
+	// TableStats returns the row count and content hash of every table at a
+	// commit, to detect replicas that diverged despite having the same head
+	TableStats(ctx context.Context, in *TableStatsRequest, opts ...grpc.CallOption) (*TableStatsResponse, error)
+	// Explain returns the plan of a read query on the node serving it, and
+	// runs the query to profile its execution if asked to
+	Explain(ctx context.Context, in *ExplainRequest, opts ...grpc.CallOption) (*ExplainResponse, error)
+	// RunNamedQuery runs a query of the named query registry with the values
+	// of its parameters. Read queries return rows, writes return their commit
+	RunNamedQuery(ctx context.Context, in *RunNamedQueryRequest, opts ...grpc.CallOption) (*RunNamedQueryResponse, error)
 }
 
 type testerClient struct {
@@ -59,6 +90,38 @@ func (c *testerClient) GetAllCommits(ctx context.Context, in *GetAllCommitsReque
 	return out, nil
 }
 
+func (c *testerClient) StreamCommits(ctx context.Context, in *GetAllCommitsRequest, opts ...grpc.CallOption) (Tester_StreamCommitsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Tester_ServiceDesc.Streams[0], Tester_StreamCommits_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &testerStreamCommitsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Tester_StreamCommitsClient interface {
+	Recv() (*GetAllCommitsResponse, error)
+	grpc.ClientStream
+}
+
+type testerStreamCommitsClient struct {
+	grpc.ClientStream
+}
+
+func (x *testerStreamCommitsClient) Recv() (*GetAllCommitsResponse, error) {
+	m := new(GetAllCommitsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *testerClient) GetHead(ctx context.Context, in *GetHeadRequest, opts ...grpc.CallOption) (*GetHeadResponse, error) {
 	out := new(GetHeadResponse)
 	err := c.cc.Invoke(ctx, Tester_GetHead_FullMethodName, in, out, opts...)
@@ -68,13 +131,115 @@ func (c *testerClient) GetHead(ctx context.Context, in *GetHeadRequest, opts ...
 	return out, nil
 }
 
+func (c *testerClient) AckCommit(ctx context.Context, in *AckCommitRequest, opts ...grpc.CallOption) (*AckCommitResponse, error) {
+	out := new(AckCommitResponse)
+	err := c.cc.Invoke(ctx, Tester_AckCommit_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *testerClient) CompareCommits(ctx context.Context, in *CompareCommitsRequest, opts ...grpc.CallOption) (*CompareCommitsResponse, error) {
+	out := new(CompareCommitsResponse)
+	err := c.cc.Invoke(ctx, Tester_CompareCommits_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *testerClient) Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (*QueryResponse, error) {
+	out := new(QueryResponse)
+	err := c.cc.Invoke(ctx, Tester_Query_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *testerClient) CallProcedure(ctx context.Context, in *CallProcedureRequest, opts ...grpc.CallOption) (*QueryResponse, error) {
+	out := new(QueryResponse)
+	err := c.cc.Invoke(ctx, Tester_CallProcedure_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *testerClient) Missed(ctx context.Context, in *MissedRequest, opts ...grpc.CallOption) (*MissedResponse, error) {
+	out := new(MissedResponse)
+	err := c.cc.Invoke(ctx, Tester_Missed_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *testerClient) ReportLag(ctx context.Context, in *ReportLagRequest, opts ...grpc.CallOption) (*ReportLagResponse, error) {
+	out := new(ReportLagResponse)
+	err := c.cc.Invoke(ctx, Tester_ReportLag_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *testerClient) TableStats(ctx context.Context, in *TableStatsRequest, opts ...grpc.CallOption) (*TableStatsResponse, error) {
+	out := new(TableStatsResponse)
+	err := c.cc.Invoke(ctx, Tester_TableStats_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *testerClient) Explain(ctx context.Context, in *ExplainRequest, opts ...grpc.CallOption) (*ExplainResponse, error) {
+	out := new(ExplainResponse)
+	err := c.cc.Invoke(ctx, Tester_Explain_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *testerClient) RunNamedQuery(ctx context.Context, in *RunNamedQueryRequest, opts ...grpc.CallOption) (*RunNamedQueryResponse, error) {
+	out := new(RunNamedQueryResponse)
+	err := c.cc.Invoke(ctx, Tester_RunNamedQuery_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // TesterServer is the server API for Tester service.
 // All implementations should embed UnimplementedTesterServer
 // for forward compatibility
 type TesterServer interface {
 	ExecSQL(context.Context, *ExecSQLRequest) (*ExecSQLResponse, error)
 	GetAllCommits(context.Context, *GetAllCommitsRequest) (*GetAllCommitsResponse, error)
+	// StreamCommits sends the commits of a branch in pages of limit commits
+	StreamCommits(*GetAllCommitsRequest, Tester_StreamCommitsServer) error
 	GetHead(context.Context, *GetHeadRequest) (*GetHeadResponse, error)
+	AckCommit(context.Context, *AckCommitRequest) (*AckCommitResponse, error)
+	CompareCommits(context.Context, *CompareCommitsRequest) (*CompareCommitsResponse, error)
+	Query(context.Context, *QueryRequest) (*QueryResponse, error)
+	CallProcedure(context.Context, *CallProcedureRequest) (*QueryResponse, error)
+	// Missed returns the commits announced after the caller's frontier, so that
+	// a node can catch up on the announcements it missed while disconnected
+	Missed(context.Context, *MissedRequest) (*MissedResponse, error)
+	// ReportLag tells a peer how many commits the caller is behind, so that
+	// writers can slow down for slow replicas
+	ReportLag(context.Context, *ReportLagRequest) (*ReportLagResponse, error)
+	// TableStats returns the row count and content hash of every table at a
+	// commit, to detect replicas that diverged despite having the same head
+	TableStats(context.Context, *TableStatsRequest) (*TableStatsResponse, error)
+	// Explain returns the plan of a read query on the node serving it, and
+	// runs the query to profile its execution if asked to
+	Explain(context.Context, *ExplainRequest) (*ExplainResponse, error)
+	// RunNamedQuery runs a query of the named query registry with the values
+	// of its parameters. Read queries return rows, writes return their commit
+	RunNamedQuery(context.Context, *RunNamedQueryRequest) (*RunNamedQueryResponse, error)
 }
 
 // UnimplementedTesterServer should be embedded to have forward compatible implementations.
@@ -87,9 +252,39 @@ func (UnimplementedTesterServer) ExecSQL(context.Context, *ExecSQLRequest) (*Exe
 func (UnimplementedTesterServer) GetAllCommits(context.Context, *GetAllCommitsRequest) (*GetAllCommitsResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetAllCommits not implemented")
 }
+func (UnimplementedTesterServer) StreamCommits(*GetAllCommitsRequest, Tester_StreamCommitsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamCommits not implemented")
+}
 func (UnimplementedTesterServer) GetHead(context.Context, *GetHeadRequest) (*GetHeadResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetHead not implemented")
 }
+func (UnimplementedTesterServer) AckCommit(context.Context, *AckCommitRequest) (*AckCommitResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AckCommit not implemented")
+}
+func (UnimplementedTesterServer) CompareCommits(context.Context, *CompareCommitsRequest) (*CompareCommitsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CompareCommits not implemented")
+}
+func (UnimplementedTesterServer) Query(context.Context, *QueryRequest) (*QueryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Query not implemented")
+}
+func (UnimplementedTesterServer) CallProcedure(context.Context, *CallProcedureRequest) (*QueryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CallProcedure not implemented")
+}
+func (UnimplementedTesterServer) Missed(context.Context, *MissedRequest) (*MissedResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Missed not implemented")
+}
+func (UnimplementedTesterServer) ReportLag(context.Context, *ReportLagRequest) (*ReportLagResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReportLag not implemented")
+}
+func (UnimplementedTesterServer) TableStats(context.Context, *TableStatsRequest) (*TableStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TableStats not implemented")
+}
+func (UnimplementedTesterServer) Explain(context.Context, *ExplainRequest) (*ExplainResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Explain not implemented")
+}
+func (UnimplementedTesterServer) RunNamedQuery(context.Context, *RunNamedQueryRequest) (*RunNamedQueryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RunNamedQuery not implemented")
+}
 
 // UnsafeTesterServer may be embedded to opt out of forward compatibility for this service.
 // Use of this interface is not recommended, as added methods to TesterServer will
@@ -138,6 +333,27 @@ func _Tester_GetAllCommits_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Tester_StreamCommits_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetAllCommitsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TesterServer).StreamCommits(m, &testerStreamCommitsServer{stream})
+}
+
+type Tester_StreamCommitsServer interface {
+	Send(*GetAllCommitsResponse) error
+	grpc.ServerStream
+}
+
+type testerStreamCommitsServer struct {
+	grpc.ServerStream
+}
+
+func (x *testerStreamCommitsServer) Send(m *GetAllCommitsResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 func _Tester_GetHead_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(GetHeadRequest)
 	if err := dec(in); err != nil {
@@ -156,6 +372,168 @@ func _Tester_GetHead_Handler(srv interface{}, ctx context.Context, dec func(inte
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Tester_AckCommit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AckCommitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TesterServer).AckCommit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tester_AckCommit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TesterServer).AckCommit(ctx, req.(*AckCommitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tester_CompareCommits_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CompareCommitsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TesterServer).CompareCommits(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tester_CompareCommits_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TesterServer).CompareCommits(ctx, req.(*CompareCommitsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tester_Query_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TesterServer).Query(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tester_Query_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TesterServer).Query(ctx, req.(*QueryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tester_CallProcedure_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CallProcedureRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TesterServer).CallProcedure(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tester_CallProcedure_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TesterServer).CallProcedure(ctx, req.(*CallProcedureRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tester_Missed_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MissedRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TesterServer).Missed(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tester_Missed_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TesterServer).Missed(ctx, req.(*MissedRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tester_ReportLag_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReportLagRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TesterServer).ReportLag(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tester_ReportLag_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TesterServer).ReportLag(ctx, req.(*ReportLagRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tester_TableStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TableStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TesterServer).TableStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tester_TableStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TesterServer).TableStats(ctx, req.(*TableStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tester_Explain_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExplainRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TesterServer).Explain(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tester_Explain_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TesterServer).Explain(ctx, req.(*ExplainRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tester_RunNamedQuery_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RunNamedQueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TesterServer).RunNamedQuery(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tester_RunNamedQuery_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TesterServer).RunNamedQuery(ctx, req.(*RunNamedQueryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Tester_ServiceDesc is the grpc.ServiceDesc for Tester service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -175,7 +553,49 @@ var Tester_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetHead",
 			Handler:    _Tester_GetHead_Handler,
 		},
+		{
+			MethodName: "AckCommit",
+			Handler:    _Tester_AckCommit_Handler,
+		},
+		{
+			MethodName: "CompareCommits",
+			Handler:    _Tester_CompareCommits_Handler,
+		},
+		{
+			MethodName: "Query",
+			Handler:    _Tester_Query_Handler,
+		},
+		{
+			MethodName: "CallProcedure",
+			Handler:    _Tester_CallProcedure_Handler,
+		},
+		{
+			MethodName: "Missed",
+			Handler:    _Tester_Missed_Handler,
+		},
+		{
+			MethodName: "ReportLag",
+			Handler:    _Tester_ReportLag_Handler,
+		},
+		{
+			MethodName: "TableStats",
+			Handler:    _Tester_TableStats_Handler,
+		},
+		{
+			MethodName: "Explain",
+			Handler:    _Tester_Explain_Handler,
+		},
+		{
+			MethodName: "RunNamedQuery",
+			Handler:    _Tester_RunNamedQuery_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamCommits",
+			Handler:       _Tester_StreamCommits_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "p2p/proto/tester.proto",
 }
@@ -0,0 +1,109 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: p2p/proto/trace.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Trace_GetCommitTrace_FullMethodName = "/proto.Trace/GetCommitTrace"
+)
+
+// TraceClient is the client API for Trace service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type TraceClient interface {
+	// GetCommitTrace returns if and when the node applied a commit
+	GetCommitTrace(ctx context.Context, in *TraceCommitRequest, opts ...grpc.CallOption) (*CommitTrace, error)
+}
+
+type traceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTraceClient(cc grpc.ClientConnInterface) TraceClient {
+	return &traceClient{cc}
+}
+
+func (c *traceClient) GetCommitTrace(ctx context.Context, in *TraceCommitRequest, opts ...grpc.CallOption) (*CommitTrace, error) {
+	out := new(CommitTrace)
+	err := c.cc.Invoke(ctx, Trace_GetCommitTrace_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TraceServer is the server API for Trace service.
+// All implementations should embed UnimplementedTraceServer
+// for forward compatibility
+type TraceServer interface {
+	// GetCommitTrace returns if and when the node applied a commit
+	GetCommitTrace(context.Context, *TraceCommitRequest) (*CommitTrace, error)
+}
+
+// UnimplementedTraceServer should be embedded to have forward compatible implementations.
+type UnimplementedTraceServer struct {
+}
+
+func (UnimplementedTraceServer) GetCommitTrace(context.Context, *TraceCommitRequest) (*CommitTrace, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCommitTrace not implemented")
+}
+
+// UnsafeTraceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TraceServer will
+// result in compilation errors.
+type UnsafeTraceServer interface {
+	mustEmbedUnimplementedTraceServer()
+}
+
+func RegisterTraceServer(s grpc.ServiceRegistrar, srv TraceServer) {
+	s.RegisterService(&Trace_ServiceDesc, srv)
+}
+
+func _Trace_GetCommitTrace_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TraceCommitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TraceServer).GetCommitTrace(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Trace_GetCommitTrace_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TraceServer).GetCommitTrace(ctx, req.(*TraceCommitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Trace_ServiceDesc is the grpc.ServiceDesc for Trace service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Trace_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Trace",
+	HandlerType: (*TraceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetCommitTrace",
+			Handler:    _Trace_GetCommitTrace_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "p2p/proto/trace.proto",
+}
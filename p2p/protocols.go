@@ -0,0 +1,287 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+
+	p2pgrpc "github.com/birros/go-libp2p-grpc"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"google.golang.org/grpc"
+)
+
+// ProtocolStage says which peers a protocol is offered to when dialing. Every
+// registered protocol is always served to incoming streams.
+type ProtocolStage string
+
+const (
+	// StageStable protocols are offered to every peer
+	StageStable ProtocolStage = "stable"
+	// StageTesting protocols are only offered to their test peers
+	StageTesting ProtocolStage = "testing"
+)
+
+// ProtocolInfo describes a registered protocol
+type ProtocolInfo struct {
+	ID    protocol.ID   `json:"id"`
+	Stage ProtocolStage `json:"stage"`
+	// Peers are the peers a testing protocol is offered to
+	Peers []string `json:"peers,omitempty"`
+	// Default is true if the protocol is served by the main gRPC server
+	Default bool `json:"default"`
+	Serving bool `json:"serving"`
+}
+
+type registeredProtocol struct {
+	id       protocol.ID
+	server   *grpc.Server
+	stage    ProtocolStage
+	peers    map[string]bool
+	listener net.Listener
+}
+
+// ProtocolRegistry holds the RPC protocols of the node. Several protocol
+// versions can be served at the same time, each one by its own gRPC server,
+// so that a new revision can be introduced, tried with a few peers and
+// promoted without dropping the peers that only speak the old ones.
+//
+// The protocol of a connection is chosen when dialing it, so connections that
+// are already open keep their protocol until they are established again.
+type ProtocolRegistry struct {
+	mtx sync.RWMutex
+	// protocols are kept in order of preference
+	protocols []*registeredProtocol
+	main      *grpc.Server
+	// services are added to the servers of new protocols
+	services []service
+
+	host    host.Host
+	ctx     context.Context
+	serving bool
+	onFail  func(id protocol.ID, err error)
+}
+
+func newProtocolRegistry(main *grpc.Server) *ProtocolRegistry {
+	r := &ProtocolRegistry{main: main}
+	for _, id := range supportedProtocols {
+		r.protocols = append(r.protocols, &registeredProtocol{id: id, server: main, stage: StageStable, peers: map[string]bool{}})
+	}
+	return r
+}
+
+func (r *ProtocolRegistry) find(id protocol.ID) (int, *registeredProtocol) {
+	for i, p := range r.protocols {
+		if p.id == id {
+			return i, p
+		}
+	}
+	return -1, nil
+}
+
+// Register adds a protocol served by server, or by the main gRPC server if
+// server is nil. The services of the node missing from the server are added
+// to it. Stable protocols are preferred over the ones registered before them.
+// The protocol is served right away if the node is running.
+func (r *ProtocolRegistry) Register(id protocol.ID, server *grpc.Server, stage ProtocolStage) error {
+	if stage != StageStable && stage != StageTesting {
+		return fmt.Errorf("unknown protocol stage '%s'", stage)
+	}
+	if server == nil {
+		server = r.main
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if _, found := r.find(id); found != nil {
+		return fmt.Errorf("protocol '%s' is already registered", id)
+	}
+	shared := false
+	for _, other := range r.protocols {
+		shared = shared || (other.server == server && other.listener != nil)
+	}
+	// services can't be added to a server that is already serving
+	if !shared {
+		addServices(server, r.services...)
+	}
+	p := &registeredProtocol{id: id, server: server, stage: stage, peers: map[string]bool{}}
+	r.protocols = append([]*registeredProtocol{p}, r.protocols...)
+	if r.serving {
+		r.serve(p)
+	}
+	return nil
+}
+
+// TestWith offers a testing protocol to the given peers, in addition to the
+// ones it is already offered to
+func (r *ProtocolRegistry) TestWith(id protocol.ID, peers ...string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	_, p := r.find(id)
+	if p == nil {
+		return fmt.Errorf("protocol '%s' is not registered", id)
+	}
+	if p.stage != StageTesting {
+		return fmt.Errorf("protocol '%s' is already offered to every peer", id)
+	}
+	for _, peerID := range peers {
+		p.peers[peerID] = true
+	}
+	return nil
+}
+
+// Promote offers a protocol to every peer, in preference to all the others
+func (r *ProtocolRegistry) Promote(id protocol.ID) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	i, p := r.find(id)
+	if p == nil {
+		return fmt.Errorf("protocol '%s' is not registered", id)
+	}
+	p.stage = StageStable
+	p.peers = map[string]bool{}
+	r.protocols = append(r.protocols[:i], r.protocols[i+1:]...)
+	r.protocols = append([]*registeredProtocol{p}, r.protocols...)
+	return nil
+}
+
+// Retire stops serving a protocol. The last stable protocol can't be retired.
+func (r *ProtocolRegistry) Retire(id protocol.ID) error {
+	r.mtx.Lock()
+	i, p := r.find(id)
+	if p == nil {
+		r.mtx.Unlock()
+		return fmt.Errorf("protocol '%s' is not registered", id)
+	}
+	if p.stage == StageStable {
+		stable := 0
+		for _, other := range r.protocols {
+			if other.stage == StageStable {
+				stable++
+			}
+		}
+		if stable == 1 {
+			r.mtx.Unlock()
+			return fmt.Errorf("protocol '%s' is the last stable protocol", id)
+		}
+	}
+	r.protocols = append(r.protocols[:i], r.protocols[i+1:]...)
+	unused := r.unserve(p)
+	r.mtx.Unlock()
+
+	// in flight calls are finished before the server stops
+	if unused != nil {
+		unused.GracefulStop()
+	}
+	return nil
+}
+
+// Protocols returns the registered protocols in order of preference
+func (r *ProtocolRegistry) Protocols() []ProtocolInfo {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	infos := []ProtocolInfo{}
+	for _, p := range r.protocols {
+		info := ProtocolInfo{ID: p.id, Stage: p.stage, Default: p.server == r.main, Serving: p.listener != nil}
+		for peerID := range p.peers {
+			info.Peers = append(info.Peers, peerID)
+		}
+		sort.Strings(info.Peers)
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// dialProtocols returns the protocols offered to a peer, in order of
+// preference: the testing protocols of the peer first, then the stable ones
+func (r *ProtocolRegistry) dialProtocols(peerID string) []protocol.ID {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	ids := []protocol.ID{}
+	for _, p := range r.protocols {
+		if p.stage == StageTesting && p.peers[peerID] {
+			ids = append(ids, p.id)
+		}
+	}
+	for _, p := range r.protocols {
+		if p.stage == StageStable {
+			ids = append(ids, p.id)
+		}
+	}
+	return ids
+}
+
+// serve starts serving a protocol. The caller must hold the lock.
+func (r *ProtocolRegistry) serve(p *registeredProtocol) {
+	listener := p2pgrpc.NewListener(r.ctx, r.host, p.id)
+	p.listener = listener
+	go func() {
+		err := p.server.Serve(listener)
+		r.mtx.RLock()
+		// the listener of a retired protocol is closed on purpose
+		retired := p.listener != listener
+		r.mtx.RUnlock()
+		if err != nil && !retired && r.onFail != nil {
+			r.onFail(p.id, err)
+		}
+	}()
+}
+
+// unserve stops serving a protocol and returns its server if it doesn't
+// serve any other protocol. The caller must hold the lock.
+func (r *ProtocolRegistry) unserve(p *registeredProtocol) *grpc.Server {
+	if p.listener == nil {
+		return nil
+	}
+	r.host.RemoveStreamHandler(p.id)
+	listener := p.listener
+	p.listener = nil
+	listener.Close()
+	if p.server == r.main {
+		return nil
+	}
+	for _, other := range r.protocols {
+		if other.server == p.server && other.listener != nil {
+			return nil
+		}
+	}
+	return p.server
+}
+
+// start serves every registered protocol on the host
+func (r *ProtocolRegistry) start(ctx context.Context, h host.Host, onFail func(id protocol.ID, err error)) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.ctx = ctx
+	r.host = h
+	r.onFail = onFail
+	r.serving = true
+	for _, p := range r.protocols {
+		r.serve(p)
+	}
+}
+
+// stop stops serving every protocol and the gRPC servers behind them
+func (r *ProtocolRegistry) stop() {
+	r.mtx.Lock()
+	r.serving = false
+	servers := map[*grpc.Server]bool{}
+	for _, p := range r.protocols {
+		servers[p.server] = true
+		if p.listener != nil {
+			r.host.RemoveStreamHandler(p.id)
+			p.listener = nil
+		}
+	}
+	r.mtx.Unlock()
+	for server := range servers {
+		server.GracefulStop()
+	}
+}
+
+// Protocols returns the registry of the RPC protocols served by the node
+func (p2p *P2P) Protocols() *ProtocolRegistry {
+	return p2p.protocols
+}
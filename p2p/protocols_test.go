@@ -0,0 +1,94 @@
+package p2p
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/protocol"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"google.golang.org/grpc"
+)
+
+func TestProtocolRegistry(t *testing.T) {
+	main := grpc.NewServer()
+	r := newProtocolRegistry(main)
+	current, legacy := supportedProtocols[0], supportedProtocols[1]
+	next := protocol.ID(protocolPrefix + "0.2.0")
+
+	if err := r.Register(next, grpc.NewServer(), StageTesting); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(next, nil, StageStable); err == nil {
+		t.Errorf("expected an error when registering a protocol twice")
+	}
+	if err := r.TestWith(next, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := r.dialProtocols("a"); !reflect.DeepEqual(got, []protocol.ID{next, current, legacy}) {
+		t.Errorf("expected the test peer to be offered the new protocol first, got %v", got)
+	}
+	if got := r.dialProtocols("b"); !reflect.DeepEqual(got, []protocol.ID{current, legacy}) {
+		t.Errorf("expected other peers to only be offered the stable protocols, got %v", got)
+	}
+
+	if err := r.Promote(next); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.dialProtocols("b"); !reflect.DeepEqual(got, []protocol.ID{next, current, legacy}) {
+		t.Errorf("expected the promoted protocol to be offered to every peer first, got %v", got)
+	}
+	if err := r.TestWith(next, "c"); err == nil {
+		t.Errorf("expected an error when testing a stable protocol")
+	}
+
+	if err := r.Retire(legacy); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Retire(current); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Retire(next); err == nil {
+		t.Errorf("expected an error when retiring the last stable protocol")
+	}
+	infos := r.Protocols()
+	if len(infos) != 1 || infos[0].ID != next || infos[0].Default || infos[0].Stage != StageStable {
+		t.Errorf("unexpected protocols %+v", infos)
+	}
+}
+
+func TestRegisterService(t *testing.T) {
+	main := grpc.NewServer()
+	r := newProtocolRegistry(main)
+	testServer := grpc.NewServer()
+	if err := r.Register(protocol.ID(protocolPrefix+"0.2.0"), testServer, StageTesting); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.registerService(&p2pproto.Pinger_ServiceDesc, p2pproto.UnimplementedPingerServer{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.registerService(&p2pproto.Pinger_ServiceDesc, p2pproto.UnimplementedPingerServer{}); err == nil {
+		t.Error("expected an error when registering a service twice")
+	}
+	if _, found := testServer.GetServiceInfo()[p2pproto.Pinger_ServiceDesc.ServiceName]; !found {
+		t.Error("expected the service to be added to the servers of the other protocols")
+	}
+
+	// protocols registered later get the services too
+	later := grpc.NewServer()
+	if err := r.Register(protocol.ID(protocolPrefix+"0.3.0"), later, StageTesting); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := later.GetServiceInfo()[p2pproto.Pinger_ServiceDesc.ServiceName]; !found {
+		t.Error("expected the service to be added to the server of a new protocol")
+	}
+	if services := r.Services(); !reflect.DeepEqual(services, []string{p2pproto.Pinger_ServiceDesc.ServiceName}) {
+		t.Errorf("unexpected services %v", services)
+	}
+
+	r.serving = true
+	if err := r.registerService(&p2pproto.Tester_ServiceDesc, p2pproto.UnimplementedTesterServer{}); err == nil {
+		t.Error("expected an error when registering a service on a running node")
+	}
+}
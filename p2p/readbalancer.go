@@ -0,0 +1,139 @@
+package p2p
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	p2psrv "github.com/nustiueudinastea/doltswarmdemo/p2p/server"
+)
+
+// ReadPolicy decides which node serves a read query
+type ReadPolicy int
+
+const (
+	// PreferLocal reads locally unless the node lags too far behind
+	PreferLocal ReadPolicy = iota
+	// PreferFreshest reads from the node with the most commits, and the lowest
+	// latency among those
+	PreferFreshest
+	// RoundRobin spreads reads over all the nodes that are fresh enough
+	RoundRobin
+)
+
+const readProbeTimeout = 2 * time.Second
+
+// readCandidate is a node that can serve a read
+type readCandidate struct {
+	id      string
+	local   bool
+	commits int
+	latency time.Duration
+	client  *P2PClient
+}
+
+// ReadBalancer distributes read queries over the local node and its healthy
+// peers, for applications that embed the node
+type ReadBalancer struct {
+	p2p    *P2P
+	policy ReadPolicy
+	// maxLag is the number of commits a node can be behind the freshest node
+	// and still serve reads
+	maxLag int
+	next   atomic.Uint64
+}
+
+// NewReadBalancer creates a read balancer with the given policy. Nodes that
+// are more than maxLag commits behind the freshest node don't serve reads.
+func (p2p *P2P) NewReadBalancer(policy ReadPolicy, maxLag int) *ReadBalancer {
+	return &ReadBalancer{p2p: p2p, policy: policy, maxLag: maxLag}
+}
+
+// Query runs a read query on the node picked by the policy. If a peer fails to
+// answer, the query runs locally.
+func (b *ReadBalancer) Query(ctx context.Context, query string) (*p2pproto.QueryResponse, error) {
+	target := b.pick(b.candidates(ctx))
+	if !target.local {
+		resp, err := target.client.Query(ctx, &p2pproto.QueryRequest{Statement: query})
+		if err == nil {
+			return resp, nil
+		}
+		b.p2p.log.Debugf("Read from '%s' failed, falling back to local: %v", target.id, err)
+	}
+
+	rows, err := b.p2p.externalDB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return p2psrv.RowsToResponse(rows)
+}
+
+// candidates returns the local node and all the peers that answered, with
+// their number of commits and latency. Draining peers are skipped.
+func (b *ReadBalancer) candidates(ctx context.Context) []readCandidate {
+	candidates := []readCandidate{{id: b.p2p.GetID(), local: true}}
+	if commits, err := b.p2p.externalDB.GetAllCommits(); err == nil {
+		candidates[0].commits = len(commits)
+	}
+
+	for _, client := range b.p2p.GetClients() {
+		if !client.Supports(p2pproto.Tester_Query_FullMethodName) || client.Draining() {
+			continue
+		}
+		probeCtx, cancel := context.WithTimeout(ctx, readProbeTimeout)
+		resp, err := client.GetAllCommits(probeCtx, &p2pproto.GetAllCommitsRequest{})
+		cancel()
+		if err != nil {
+			continue
+		}
+		candidate := readCandidate{id: client.GetID(), commits: len(resp.Commits), client: client}
+		if id, err := peer.Decode(client.GetID()); err == nil {
+			candidate.latency = b.p2p.host.Peerstore().LatencyEWMA(id)
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates
+}
+
+// pick returns the candidate that should serve the read. The first candidate
+// must be the local node.
+func (b *ReadBalancer) pick(candidates []readCandidate) readCandidate {
+	freshest := 0
+	for _, c := range candidates {
+		if c.commits > freshest {
+			freshest = c.commits
+		}
+	}
+	fresh := []readCandidate{}
+	for _, c := range candidates {
+		if freshest-c.commits <= b.maxLag {
+			fresh = append(fresh, c)
+		}
+	}
+	sort.SliceStable(fresh, func(i, j int) bool {
+		if fresh[i].commits != fresh[j].commits {
+			return fresh[i].commits > fresh[j].commits
+		}
+		return fresh[i].latency < fresh[j].latency
+	})
+
+	switch b.policy {
+	case PreferLocal:
+		if candidates[0].local && freshest-candidates[0].commits <= b.maxLag {
+			return candidates[0]
+		}
+		return fresh[0]
+	case RoundRobin:
+		// keep a stable order so the rotation visits every node
+		sort.SliceStable(fresh, func(i, j int) bool {
+			return fresh[i].id < fresh[j].id
+		})
+		return fresh[b.next.Add(1)%uint64(len(fresh))]
+	default:
+		return fresh[0]
+	}
+}
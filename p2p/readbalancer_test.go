@@ -0,0 +1,38 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReadBalancerPick(t *testing.T) {
+	candidates := []readCandidate{
+		{id: "local", local: true, commits: 8},
+		{id: "far", commits: 10, latency: 50 * time.Millisecond},
+		{id: "near", commits: 10, latency: 5 * time.Millisecond},
+		{id: "stale", commits: 2, latency: time.Millisecond},
+	}
+
+	local := &ReadBalancer{policy: PreferLocal, maxLag: 2}
+	if c := local.pick(candidates); c.id != "local" {
+		t.Errorf("expected the local node, got %s", c.id)
+	}
+	local.maxLag = 1
+	if c := local.pick(candidates); c.id != "near" {
+		t.Errorf("expected the freshest peer when the local node lags, got %s", c.id)
+	}
+
+	freshest := &ReadBalancer{policy: PreferFreshest, maxLag: 2}
+	if c := freshest.pick(candidates); c.id != "near" {
+		t.Errorf("expected the freshest peer with the lowest latency, got %s", c.id)
+	}
+
+	roundRobin := &ReadBalancer{policy: RoundRobin, maxLag: 2}
+	seen := map[string]int{}
+	for i := 0; i < 6; i++ {
+		seen[roundRobin.pick(candidates).id]++
+	}
+	if len(seen) != 3 || seen["stale"] != 0 {
+		t.Errorf("expected reads spread over the fresh nodes, got %v", seen)
+	}
+}
@@ -0,0 +1,125 @@
+package p2p
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// cachedMethods are the read RPCs whose responses only change when a commit
+// is made, so they can be served from the read cache
+var cachedMethods = map[string]bool{
+	p2pproto.Tester_GetHead_FullMethodName:       true,
+	p2pproto.Tester_GetAllCommits_FullMethodName: true,
+}
+
+type cacheEntry struct {
+	reply   proto.Message
+	expires time.Time
+}
+
+// readCache keeps the responses of remote reads for a short time, keyed by
+// peer, method and request
+type readCache struct {
+	ttl time.Duration
+
+	mtx     sync.Mutex
+	entries map[string]cacheEntry
+}
+
+func newReadCache(ttl time.Duration) *readCache {
+	return &readCache{
+		ttl:     ttl,
+		entries: map[string]cacheEntry{},
+	}
+}
+
+func cacheKey(peerID string, method string, req proto.Message) (string, error) {
+	params, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	return peerID + "\x00" + method + "\x00" + string(params), nil
+}
+
+func (c *readCache) get(key string) (proto.Message, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	entry, found := c.entries[key]
+	if !found || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.reply, true
+}
+
+func (c *readCache) set(key string, reply proto.Message) {
+	c.mtx.Lock()
+	c.entries[key] = cacheEntry{reply: proto.Clone(reply), expires: time.Now().Add(c.ttl)}
+	c.mtx.Unlock()
+}
+
+// invalidate drops all the cached responses
+func (c *readCache) invalidate() {
+	c.mtx.Lock()
+	c.entries = map[string]cacheEntry{}
+	c.mtx.Unlock()
+}
+
+// expire removes the expired entries and returns how many were removed
+func (c *readCache) expire() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	expired := 0
+	now := time.Now()
+	for key, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, key)
+			expired++
+		}
+	}
+	return expired
+}
+
+// InvalidateReadCache drops the cached responses of remote reads. It should be
+// called when a new commit is seen, since it changes the heads of the peers.
+func (p2p *P2P) InvalidateReadCache() {
+	if p2p.readCache != nil {
+		p2p.readCache.invalidate()
+	}
+	if p2p.remote != nil {
+		p2p.remote.cache.invalidate()
+	}
+}
+
+// cacheInterceptor serves the cacheable reads to a peer from the read cache
+func (p2p *P2P) cacheInterceptor(id peer.ID) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		reqMsg, reqOk := req.(proto.Message)
+		replyMsg, replyOk := reply.(proto.Message)
+		if !cachedMethods[method] || !reqOk || !replyOk {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		key, err := cacheKey(id.String(), method, reqMsg)
+		if err != nil {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		if cached, found := p2p.readCache.get(key); found {
+			proto.Merge(replyMsg, cached)
+			return nil
+		}
+
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		if err == nil {
+			p2p.readCache.set(key, replyMsg)
+		}
+		return err
+	}
+}
@@ -0,0 +1,50 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestReadCache(t *testing.T) {
+	cache := newReadCache(time.Minute)
+	method := p2pproto.Tester_GetHead_FullMethodName
+
+	keyA, err := cacheKey("peerA", method, &p2pproto.GetHeadRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyB, _ := cacheKey("peerB", method, &p2pproto.GetHeadRequest{})
+	if keyA == keyB {
+		t.Fatal("expected different peers to have different keys")
+	}
+
+	reply := &p2pproto.GetHeadResponse{Commit: "abc"}
+	cache.set(keyA, reply)
+	reply.Commit = "changed"
+
+	cached, found := cache.get(keyA)
+	if !found || cached.(*p2pproto.GetHeadResponse).Commit != "abc" {
+		t.Fatalf("expected a copy of the cached reply, got %v", cached)
+	}
+	if _, found := cache.get(keyB); found {
+		t.Error("expected no reply for peerB")
+	}
+
+	cache.invalidate()
+	if _, found := cache.get(keyA); found {
+		t.Error("expected the cache to be empty after invalidation")
+	}
+
+	expiring := newReadCache(time.Nanosecond)
+	expiring.set(keyA, proto.Clone(reply))
+	time.Sleep(time.Millisecond)
+	if _, found := expiring.get(keyA); found {
+		t.Error("expected the entry to expire")
+	}
+	if expiring.expire() != 1 {
+		t.Error("expected one expired entry to be removed")
+	}
+}
@@ -0,0 +1,146 @@
+package p2p
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"github.com/nustiueudinastea/doltswarmdemo/sqlstmt"
+)
+
+// remoteReads proxies the history reads of a light node to archive peers, so
+// that applications see the full history whichever node they query
+type remoteReads struct {
+	// budget is how long a query can spend on archive peers before it's
+	// served locally
+	budget time.Duration
+	cache  *readCache
+
+	proxied  atomic.Int64
+	cached   atomic.Int64
+	fellBack atomic.Int64
+	failed   atomic.Int64
+}
+
+// RemoteReadStats counts the history reads of a light node
+type RemoteReadStats struct {
+	// Proxied reads were served by an archive peer
+	Proxied int64 `json:"proxied"`
+	// Cached reads were served from the responses of earlier proxied reads
+	Cached int64 `json:"cached"`
+	// FellBack reads were served locally because no archive peer answered
+	// within the budget
+	FellBack int64 `json:"fell_back"`
+	// Failed attempts on archive peers
+	Failed int64 `json:"failed"`
+}
+
+// RemoteReadStats returns the history reads proxied to archive peers
+func (p2p *P2P) RemoteReadStats() RemoteReadStats {
+	if p2p.remote == nil {
+		return RemoteReadStats{}
+	}
+	return RemoteReadStats{
+		Proxied:  p2p.remote.proxied.Load(),
+		Cached:   p2p.remote.cached.Load(),
+		FellBack: p2p.remote.fellBack.Load(),
+		Failed:   p2p.remote.failed.Load(),
+	}
+}
+
+// historyPeers returns the archive peers that can serve queries, the closest
+// first
+func (p2p *P2P) historyPeers() []*P2PClient {
+	peers := []*P2PClient{}
+	for _, client := range p2p.ArchivePeers() {
+		if client.Supports(p2pproto.Tester_Query_FullMethodName) && !client.Draining() {
+			peers = append(peers, client)
+		}
+	}
+	latency := func(client *P2PClient) time.Duration {
+		id, err := peer.Decode(client.GetID())
+		if err != nil {
+			return 0
+		}
+		return p2p.host.Peerstore().LatencyEWMA(id)
+	}
+	sort.SliceStable(peers, func(i, j int) bool {
+		return latency(peers[i]) < latency(peers[j])
+	})
+	return peers
+}
+
+// RemoteQuery serves the queries of a light node that read the history from
+// an archive peer. The peers are tried in turn within the latency budget, and
+// the query is served locally if none answers.
+func (p2p *P2P) RemoteQuery(ctx context.Context, req *p2pproto.QueryRequest) (*p2pproto.QueryResponse, bool, error) {
+	if p2p.remote == nil || p2p.role != RoleLight || !sqlstmt.ReadsHistory(req.Statement) {
+		return nil, false, nil
+	}
+
+	key, err := cacheKey("", p2pproto.Tester_Query_FullMethodName, req)
+	if err == nil {
+		if cached, found := p2p.remote.cache.get(key); found {
+			p2p.remote.cached.Add(1)
+			return cached.(*p2pproto.QueryResponse), true, nil
+		}
+	}
+
+	budgetCtx, cancel := context.WithTimeout(ctx, p2p.remote.budget)
+	defer cancel()
+	for _, client := range p2p.historyPeers() {
+		resp, err := client.Query(budgetCtx, req)
+		if err == nil {
+			p2p.remote.proxied.Add(1)
+			if key != "" {
+				p2p.remote.cache.set(key, resp)
+			}
+			return resp, true, nil
+		}
+		p2p.remote.failed.Add(1)
+		p2p.log.Debugf("History read from archive peer '%s' failed: %v", client.GetID(), err)
+		if budgetCtx.Err() != nil {
+			break
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil, true, ctx.Err()
+	}
+	p2p.remote.fellBack.Add(1)
+	p2p.log.Debugf("No archive peer served the history read within %s, serving it locally", p2p.remote.budget)
+	return nil, false, nil
+}
+
+// RemoteExplain plans the history reads of a light node on the archive peer
+// that would serve them, so that the plan and profile match the proxied read.
+// Plans aren't cached, and are made locally if no archive peer answers.
+func (p2p *P2P) RemoteExplain(ctx context.Context, req *p2pproto.ExplainRequest) (*p2pproto.ExplainResponse, bool, error) {
+	if p2p.remote == nil || p2p.role != RoleLight || !sqlstmt.ReadsHistory(req.Statement) {
+		return nil, false, nil
+	}
+
+	budgetCtx, cancel := context.WithTimeout(ctx, p2p.remote.budget)
+	defer cancel()
+	for _, client := range p2p.historyPeers() {
+		if !client.Supports(p2pproto.Tester_Explain_FullMethodName) {
+			continue
+		}
+		resp, err := client.Explain(budgetCtx, req)
+		if err == nil {
+			return resp, true, nil
+		}
+		p2p.log.Debugf("History read plan from archive peer '%s' failed: %v", client.GetID(), err)
+		if budgetCtx.Err() != nil {
+			break
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil, true, ctx.Err()
+	}
+	return nil, false, nil
+}
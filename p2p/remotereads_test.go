@@ -0,0 +1,63 @@
+package p2p
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	cmap "github.com/orcaman/concurrent-map"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRemoteQuery(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	p := &P2P{log: logger, clients: cmap.New(), role: RoleLight, remote: &remoteReads{budget: time.Second, cache: newReadCache(time.Minute)}}
+	ctx := context.Background()
+
+	// current data is always served locally
+	if _, remote, err := p.RemoteQuery(ctx, &p2pproto.QueryRequest{Statement: "SELECT * FROM testtable"}); remote || err != nil {
+		t.Fatalf("expected the query to be served locally, got %t (%v)", remote, err)
+	}
+
+	history := &p2pproto.QueryRequest{Statement: "SELECT * FROM dolt_log"}
+	// cached responses of archive peers are served until the next commit
+	key, err := cacheKey("", p2pproto.Tester_Query_FullMethodName, history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.remote.cache.set(key, &p2pproto.QueryResponse{Columns: []string{"commit_hash"}})
+	resp, remote, err := p.RemoteQuery(ctx, history)
+	if !remote || err != nil || len(resp.Columns) != 1 {
+		t.Fatalf("expected the cached response, got %v, %t (%v)", resp, remote, err)
+	}
+
+	// without archive peers, history reads fall back to the local node
+	p.InvalidateReadCache()
+	if _, remote, err := p.RemoteQuery(ctx, history); remote || err != nil {
+		t.Fatalf("expected the query to fall back locally, got %t (%v)", remote, err)
+	}
+	if stats := p.RemoteReadStats(); stats.Cached != 1 || stats.FellBack != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestRemoteExplain(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	p := &P2P{log: logger, clients: cmap.New(), role: RoleLight, remote: &remoteReads{budget: time.Second, cache: newReadCache(time.Minute)}}
+	ctx := context.Background()
+
+	// current data and history reads without archive peers are planned
+	// locally
+	for _, statement := range []string{"SELECT * FROM testtable", "SELECT * FROM dolt_log"} {
+		if _, remote, err := p.RemoteExplain(ctx, &p2pproto.ExplainRequest{Statement: statement, Profile: true}); remote || err != nil {
+			t.Errorf("expected '%s' to be planned locally, got %t (%v)", statement, remote, err)
+		}
+	}
+	if stats := p.RemoteReadStats(); stats.FellBack != 0 {
+		t.Errorf("expected plans to leave the read stats alone, got %+v", stats)
+	}
+}
@@ -0,0 +1,128 @@
+package p2p
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	replayAttempts = 3
+	replayBackoff  = 200 * time.Millisecond
+)
+
+// idempotentMethods can be safely re-sent after a stream reset
+var idempotentMethods = map[string]bool{
+	p2pproto.Pinger_Ping_FullMethodName:              true,
+	p2pproto.Tester_GetAllCommits_FullMethodName:     true,
+	p2pproto.Tester_GetHead_FullMethodName:           true,
+	p2pproto.Tester_AckCommit_FullMethodName:         true,
+	p2pproto.Tester_CompareCommits_FullMethodName:    true,
+	p2pproto.Tester_Query_FullMethodName:             true,
+	p2pproto.Tester_Missed_FullMethodName:            true,
+	p2pproto.Tester_TableStats_FullMethodName:        true,
+	p2pproto.Tester_Explain_FullMethodName:           true,
+	p2pproto.Election_Elect_FullMethodName:           true,
+	p2pproto.Election_Coordinator_FullMethodName:     true,
+	p2pproto.Channels_Invite_FullMethodName:          true,
+	p2pproto.Leases_Renew_FullMethodName:             true,
+	p2pproto.Leases_Release_FullMethodName:           true,
+	p2pproto.Leases_Grant_FullMethodName:             true,
+	p2pproto.Leases_Revoke_FullMethodName:            true,
+	p2pproto.Sessions_Close_FullMethodName:           true,
+	p2pproto.Drain_NotifyDrain_FullMethodName:        true,
+	p2pproto.Trace_GetCommitTrace_FullMethodName:     true,
+	p2pproto.Blobs_StatBlob_FullMethodName:           true,
+	p2pproto.Blobs_PinBlob_FullMethodName:            true,
+	p2pproto.Blobs_UnpinBlob_FullMethodName:          true,
+	p2pproto.Plugins_PublishPlugin_FullMethodName:    true,
+	p2pproto.Approvals_SubmitApproval_FullMethodName: true,
+}
+
+// hasIdempotencyToken returns true for the writes carrying an idempotency
+// token, which the peer applies only once however many times they are sent
+func hasIdempotencyToken(req any) bool {
+	switch r := req.(type) {
+	case *p2pproto.ExecSQLRequest:
+		return r.IdempotencyToken != ""
+	case *p2pproto.RunNamedQueryRequest:
+		return r.IdempotencyToken != ""
+	default:
+		return false
+	}
+}
+
+// inFlight tracks the number of outstanding requests per peer
+type inFlight struct {
+	mtx      sync.Mutex
+	requests map[string]int
+}
+
+func (f *inFlight) add(id string, delta int) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.requests[id] += delta
+	if f.requests[id] <= 0 {
+		delete(f.requests, id)
+	}
+}
+
+func (f *inFlight) clear(id string) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	delete(f.requests, id)
+}
+
+// InFlight returns the number of outstanding requests for every peer
+func (p2p *P2P) InFlight() map[string]int {
+	p2p.inFlight.mtx.Lock()
+	defer p2p.inFlight.mtx.Unlock()
+	requests := make(map[string]int, len(p2p.inFlight.requests))
+	for id, nr := range p2p.inFlight.requests {
+		requests[id] = nr
+	}
+	return requests
+}
+
+// replayInterceptor tracks the requests in flight to a peer. If the stream of
+// an idempotent request is reset, it re-establishes the connection and sends
+// the request again instead of surfacing the failure to the caller.
+func (p2p *P2P) replayInterceptor(id peer.ID) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		p2p.inFlight.add(id.String(), 1)
+		defer p2p.inFlight.add(id.String(), -1)
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if !idempotentMethods[method] && !hasIdempotencyToken(req) {
+			return err
+		}
+
+		backoff := replayBackoff
+		for attempt := 0; attempt < replayAttempts && status.Code(err) == codes.Unavailable; attempt++ {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return err
+			}
+			backoff *= 2
+
+			if p2p.host.Network().Connectedness(id) != network.Connected {
+				connectErr := p2p.host.Connect(ctx, peer.AddrInfo{ID: id})
+				if connectErr != nil {
+					p2p.log.Debugf("Reconnect to '%s' failed: %v", id.String(), connectErr)
+					continue
+				}
+			}
+			p2p.log.Debugf("Replaying '%s' to '%s' after stream failure: %v", method, id.String(), err)
+			err = invoker(ctx, method, req, reply, cc, opts...)
+		}
+		return err
+	}
+}
@@ -0,0 +1,42 @@
+package p2p
+
+// NodeRole describes how much history a node keeps
+type NodeRole string
+
+const (
+	// RoleArchive nodes keep the full history and serve deep history reads
+	RoleArchive NodeRole = "archive"
+	// RoleLight nodes only keep the latest commits of the history
+	RoleLight NodeRole = "light"
+)
+
+// parseNodeRole returns the role advertised by a peer. Peers that don't
+// advertise a role keep the full history.
+func parseNodeRole(role string) NodeRole {
+	if NodeRole(role) == RoleLight {
+		return RoleLight
+	}
+	return RoleArchive
+}
+
+// Role returns the role advertised by the peer
+func (c *P2PClient) Role() NodeRole {
+	return c.role
+}
+
+// HistoryDepth returns the number of commits of history kept by the peer, or
+// 0 if it keeps the full history
+func (c *P2PClient) HistoryDepth() int64 {
+	return c.historyDepth
+}
+
+// ArchivePeers returns the connected peers that keep the full history
+func (p2p *P2P) ArchivePeers() []*P2PClient {
+	archives := []*P2PClient{}
+	for _, client := range p2p.GetClients() {
+		if client.role == RoleArchive {
+			archives = append(archives, client)
+		}
+	}
+	return archives
+}
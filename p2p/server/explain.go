@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"github.com/nustiueudinastea/doltswarmdemo/sqlstmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Explain returns the plan of a read query, and runs the query to profile it
+// if asked to. The query is planned where Query would run it, so that slow
+// reads can be debugged on the node that serves them.
+func (s *Server) Explain(ctx context.Context, req *proto.ExplainRequest) (*proto.ExplainResponse, error) {
+	// profiling runs the query outside ExecSQL, so it must not have side
+	// effects
+	if !sqlstmt.IsRead(req.Statement) {
+		return nil, status.Error(codes.InvalidArgument, "only a single SELECT statement without side effects can be explained")
+	}
+	if err := s.authorize(ctx, req.Statement, false); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	if err := s.waitForSession(ctx, req.SessionToken, req.TimeoutMs); err != nil {
+		return nil, err
+	}
+	sessionWait := time.Since(start)
+
+	if s.Remote != nil {
+		resp, remote, err := s.Remote.RemoteExplain(ctx, req)
+		if remote || err != nil {
+			return resp, err
+		}
+	}
+
+	res := &proto.ExplainResponse{Node: s.ID}
+	plan, err := s.plan(ctx, req.Statement)
+	if err != nil {
+		return nil, err
+	}
+	res.Plan = plan
+	if head, err := s.DB.GetLastCommit("main"); err == nil {
+		res.Head = head.Hash
+	}
+	if !req.Profile {
+		return res, nil
+	}
+	res.Profile, err = s.profile(ctx, req.Statement)
+	if err != nil {
+		return nil, err
+	}
+	res.Profile.SessionWaitMs = sessionWait.Milliseconds()
+	return res, nil
+}
+
+// plan returns the lines of the plan of a query
+func (s *Server) plan(ctx context.Context, statement string) ([]string, error) {
+	rows, err := s.DB.QueryContext(ctx, "EXPLAIN "+strings.TrimRight(strings.TrimSpace(statement), ";"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	resp, err := RowsToResponse(rows)
+	if err != nil {
+		return nil, err
+	}
+	plan := make([]string, 0, len(resp.Rows))
+	for _, row := range resp.Rows {
+		plan = append(plan, strings.Join(row.Values, " "))
+	}
+	return plan, nil
+}
+
+// profile runs a query and measures how long it takes to return its first
+// and all its rows, and how much it returns
+func (s *Server) profile(ctx context.Context, statement string) (*proto.QueryProfile, error) {
+	start := time.Now()
+	rows, err := s.DB.QueryContext(ctx, statement)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &proto.QueryProfile{}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if profile.Rows == 0 {
+			profile.FirstRowMs = time.Since(start).Milliseconds()
+		}
+		err = rows.Scan(dest...)
+		if err != nil {
+			return nil, err
+		}
+		profile.Rows++
+		for _, value := range values {
+			profile.Bytes += int64(len(value))
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	profile.ElapsedMs = time.Since(start).Milliseconds()
+	return profile, nil
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// HeadGuard serializes the writes of the node, so that a write can be applied
+// only if the head of the main branch didn't move since the client read it
+type HeadGuard interface {
+	// ExecIfHead runs exec if expected is empty or is the head of the main
+	// branch, and fails with HeadConflictError otherwise
+	ExecIfHead(expected string, exec func() (string, error)) (string, error)
+}
+
+// HeadConflictError is returned when a write expected another head. The status
+// carries the current head, which clients read with ConflictingHead.
+func HeadConflictError(expected string, current string) error {
+	st := status.Newf(codes.Aborted, "head of main is '%s', expected '%s'", current, expected)
+	detailed, err := st.WithDetails(&proto.HeadConflict{ExpectedHead: expected, CurrentHead: current})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// ConflictingHead returns the current head carried by a HeadConflictError, and
+// false for other errors
+func ConflictingHead(err error) (string, bool) {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.Aborted {
+		return "", false
+	}
+	for _, detail := range st.Details() {
+		if conflict, ok := detail.(*proto.HeadConflict); ok {
+			return conflict.CurrentHead, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/trailer"
+)
+
+const (
+	idempotencyKey = "Idempotency-Token"
+	// maxTokenLength keeps tokens small enough for a commit trailer
+	maxTokenLength = 128
+)
+
+// AnnotateToken records the idempotency token of a write in its commit
+// message, so that the token travels with the commit to every peer and
+// survives restarts
+func AnnotateToken(msg string, token string) string {
+	return trailer.Append(msg, idempotencyKey, token)
+}
+
+// TokenFromMessage returns the idempotency token recorded in a commit message
+func TokenFromMessage(msg string) (string, bool) {
+	return trailer.Get(msg, idempotencyKey)
+}
+
+func validateToken(token string) error {
+	if len(token) > maxTokenLength {
+		return fmt.Errorf("idempotency token is longer than %d bytes", maxTokenLength)
+	}
+	if strings.ContainsAny(token, "\r\n") || strings.TrimSpace(token) != token {
+		return fmt.Errorf("idempotency token can't contain line breaks or surrounding spaces")
+	}
+	return nil
+}
+
+// TokenIndex remembers the commits of the recent writes with an idempotency
+// token, and serializes the attempts of a write with the same token so that
+// concurrent retries don't both apply it. Older tokens are found in the
+// commit history.
+type TokenIndex struct {
+	ttl     time.Duration
+	mtx     sync.Mutex
+	commits map[string]tokenCommit
+	// locks are the tokens with an attempt in progress. The channel is closed
+	// when the attempt is done.
+	locks map[string]chan struct{}
+}
+
+type tokenCommit struct {
+	commit string
+	at     time.Time
+}
+
+// NewTokenIndex creates an index remembering the tokens for ttl
+func NewTokenIndex(ttl time.Duration) *TokenIndex {
+	return &TokenIndex{ttl: ttl, commits: map[string]tokenCommit{}, locks: map[string]chan struct{}{}}
+}
+
+// lock waits for the other attempts with the same token to be done. The
+// returned function releases the token.
+func (t *TokenIndex) lock(ctx context.Context, token string) (func(), error) {
+	for {
+		t.mtx.Lock()
+		done, busy := t.locks[token]
+		if !busy {
+			done = make(chan struct{})
+			t.locks[token] = done
+			t.mtx.Unlock()
+			return func() {
+				t.mtx.Lock()
+				delete(t.locks, token)
+				t.mtx.Unlock()
+				close(done)
+			}, nil
+		}
+		t.mtx.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// get returns the commit of a token seen within the ttl
+func (t *TokenIndex) get(token string) (string, bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	entry, found := t.commits[token]
+	if !found || time.Since(entry.at) > t.ttl {
+		return "", false
+	}
+	return entry.commit, true
+}
+
+// record remembers the commit of a token, and forgets the expired ones
+func (t *TokenIndex) record(token string, commit string) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	now := time.Now()
+	for old, entry := range t.commits {
+		if now.Sub(entry.at) > t.ttl {
+			delete(t.commits, old)
+		}
+	}
+	t.commits[token] = tokenCommit{commit: commit, at: now}
+}
+
+// Len returns the number of tokens remembered
+func (t *TokenIndex) Len() int {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return len(t.commits)
+}
+
+// committedToken returns the commit that applied the write with the token,
+// looking in the index and then in the commit history
+func (s *Server) committedToken(token string) (string, bool, error) {
+	if s.Tokens != nil {
+		if commit, found := s.Tokens.get(token); found {
+			return commit, true, nil
+		}
+	}
+	commits, err := s.DB.GetAllCommits()
+	if err != nil {
+		return "", false, err
+	}
+	for _, commit := range commits {
+		if recorded, found := TokenFromMessage(commit.Message); found && recorded == token {
+			if s.Tokens != nil {
+				s.Tokens.record(token, commit.Hash)
+			}
+			return commit.Hash, true, nil
+		}
+	}
+	return "", false, nil
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarm"
+	"github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+// fakeDB commits writes to an in-memory history
+type fakeDB struct {
+	ExternalDB
+
+	mtx     sync.Mutex
+	commits []doltswarm.Commit
+}
+
+func (db *fakeDB) GetAllCommits() ([]doltswarm.Commit, error) {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	return append([]doltswarm.Commit{}, db.commits...), nil
+}
+
+func (db *fakeDB) ExecAndCommit(query string, commitMsg string) (string, error) {
+	// a slow write lets concurrent retries overlap
+	time.Sleep(10 * time.Millisecond)
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+	hash := fmt.Sprintf("c%d", len(db.commits)+1)
+	db.commits = append(db.commits, doltswarm.Commit{Hash: hash, Message: commitMsg})
+	return hash, nil
+}
+
+func TestIdempotencyTokens(t *testing.T) {
+	db := &fakeDB{}
+	s := &Server{DB: db, Tokens: NewTokenIndex(time.Hour)}
+	ctx := context.Background()
+	req := func() *proto.ExecSQLRequest {
+		return &proto.ExecSQLRequest{Statement: "INSERT INTO t VALUES (1)", Msg: "insert", IdempotencyToken: "write-1"}
+	}
+
+	// concurrent retries are applied once
+	responses := make([]*proto.ExecSQLResponse, 3)
+	wg := sync.WaitGroup{}
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := s.ExecSQL(ctx, req())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			responses[i] = resp
+		}(i)
+	}
+	wg.Wait()
+	if len(db.commits) != 1 {
+		t.Fatalf("expected a single commit, got %d", len(db.commits))
+	}
+	replayed := 0
+	for _, resp := range responses {
+		if resp == nil || resp.Commit != "c1" {
+			t.Fatalf("expected every attempt to return the first commit, got %v", resp)
+		}
+		if resp.Replayed {
+			replayed++
+		}
+	}
+	if replayed != 2 {
+		t.Errorf("expected 2 replayed attempts, got %d", replayed)
+	}
+	if token, found := TokenFromMessage(db.commits[0].Message); !found || token != "write-1" {
+		t.Errorf("expected the token in the commit message, got %q", db.commits[0].Message)
+	}
+
+	// tokens are found in the history once they left the index, e.g. after
+	// a restart
+	restarted := &Server{DB: db}
+	resp, err := restarted.ExecSQL(ctx, req())
+	if err != nil || resp.Commit != "c1" || !resp.Replayed {
+		t.Errorf("expected the write to be replayed from the history, got %v (%v)", resp, err)
+	}
+
+	other := req()
+	other.IdempotencyToken = "write-2"
+	if resp, err := s.ExecSQL(ctx, other); err != nil || resp.Commit != "c2" || resp.Replayed {
+		t.Errorf("expected a new token to be applied, got %v (%v)", resp, err)
+	}
+	invalid := req()
+	invalid.IdempotencyToken = "write\n3"
+	if _, err := s.ExecSQL(ctx, invalid); err == nil {
+		t.Error("expected an error for a token with a line break")
+	}
+}
@@ -0,0 +1,13 @@
+package server
+
+import (
+	"github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+// IdentityChecker compares the database of a peer with the local one, so that
+// nodes of unrelated clusters sharing a network don't sync with each other
+type IdentityChecker interface {
+	// CheckIdentity returns the identity of the local database, or an error if
+	// the database of the peer has a different lineage
+	CheckIdentity(peerID string, remote *proto.DatabaseIdentity) (*proto.DatabaseIdentity, error)
+}
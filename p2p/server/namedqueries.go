@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nustiueudinastea/doltswarmdemo/namedqueries"
+	"github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// NamedQueryStore returns the queries of the named query registry
+type NamedQueryStore interface {
+	Get(name string) (namedqueries.Query, bool, error)
+}
+
+// RunNamedQuery binds the parameters of a named query and runs it like a
+// query or a write sent by the caller, so that it goes through the same
+// authorization, routing and replication
+func (s *Server) RunNamedQuery(ctx context.Context, req *proto.RunNamedQueryRequest) (*proto.RunNamedQueryResponse, error) {
+	if s.NamedQueries == nil {
+		return nil, status.Error(codes.Unimplemented, "node doesn't serve named queries")
+	}
+	q, found, err := s.NamedQueries.Get(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, status.Errorf(codes.NotFound, "named query '%s' not found", req.Name)
+	}
+	statement, err := q.Bind(req.Params)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if q.ReadOnly() {
+		resp, err := s.Query(ctx, &proto.QueryRequest{Statement: statement, SessionToken: req.SessionToken, TimeoutMs: req.TimeoutMs})
+		if err != nil {
+			return nil, err
+		}
+		return &proto.RunNamedQueryResponse{Columns: resp.Columns, Rows: resp.Rows, SessionToken: req.SessionToken}, nil
+	}
+
+	resp, err := s.ExecSQL(ctx, &proto.ExecSQLRequest{
+		Statement:        statement,
+		Msg:              fmt.Sprintf("Run named query %s", q.Name),
+		Consistency:      req.Consistency,
+		SessionToken:     req.SessionToken,
+		IdempotencyToken: req.IdempotencyToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &proto.RunNamedQueryResponse{Commit: resp.Commit, SessionToken: resp.SessionToken, Replayed: resp.Replayed}, nil
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/nustiueudinastea/doltswarmdemo/namedqueries"
+	"github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeNamedQueries map[string]namedqueries.Query
+
+func (f fakeNamedQueries) Get(name string) (namedqueries.Query, bool, error) {
+	q, found := f[name]
+	return q, found, nil
+}
+
+var errQueried = errors.New("queried")
+
+// namedQueryDB records the statements it runs
+type namedQueryDB struct {
+	*fakeDB
+	statements []string
+}
+
+func (db *namedQueryDB) ExecAndCommit(query string, commitMsg string) (string, error) {
+	db.statements = append(db.statements, query)
+	return db.fakeDB.ExecAndCommit(query, commitMsg)
+}
+
+func (db *namedQueryDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	db.statements = append(db.statements, query)
+	return nil, errQueried
+}
+
+func TestRunNamedQuery(t *testing.T) {
+	db := &namedQueryDB{fakeDB: &fakeDB{}}
+	s := &Server{DB: db, NamedQueries: fakeNamedQueries{
+		"by_user":  {Name: "by_user", Statement: "SELECT * FROM orders WHERE user = :user", Params: []string{"user"}},
+		"rename":   {Name: "rename", Statement: "UPDATE users SET name = :name WHERE id = :id", Params: []string{"id", "name"}},
+		"with_del": {Name: "with_del", Statement: "WITH x AS (SELECT 1) DELETE FROM users WHERE id = :id", Params: []string{"id"}},
+	}}
+	ctx := context.Background()
+	run := func(name string, params map[string]string) (*proto.RunNamedQueryResponse, error) {
+		return s.RunNamedQuery(ctx, &proto.RunNamedQueryRequest{Name: name, Params: params})
+	}
+
+	if _, err := run("missing", nil); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for an unknown query, got %v", err)
+	}
+	if _, err := run("by_user", nil); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for a missing parameter, got %v", err)
+	}
+
+	// reads go through Query, with the values quoted
+	if _, err := run("by_user", map[string]string{"user": "x' OR '1'='1"}); !errors.Is(err, errQueried) {
+		t.Fatalf("expected the read to be queried, got %v", err)
+	}
+	if got, want := db.statements[len(db.statements)-1], `SELECT * FROM orders WHERE user = 'x'' OR ''1''=''1'`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// writes are committed
+	resp, err := run("rename", map[string]string{"id": "1", "name": "a"})
+	if err != nil || resp.Commit == "" {
+		t.Fatalf("expected the write to be committed, got %v (%v)", resp, err)
+	}
+	resp, err = run("with_del", map[string]string{"id": "1"})
+	if err != nil || resp.Commit == "" {
+		t.Fatalf("expected a write starting with WITH to be committed, got %v (%v)", resp, err)
+	}
+	if len(db.commits) != 2 {
+		t.Errorf("expected 2 commits, got %d", len(db.commits))
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+
+	"github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// procedureBranch is the branch procedures run on if the call doesn't name one
+const procedureBranch = "main"
+
+// allowedProcedures are the Dolt stored procedures peers are allowed to call
+var allowedProcedures = map[string]bool{
+	"dolt_branch":   true,
+	"dolt_checkout": true,
+	"dolt_merge":    true,
+	"dolt_reset":    true,
+	"dolt_tag":      true,
+}
+
+// ConnOpener opens the dedicated connections procedures run on
+type ConnOpener interface {
+	Conn(ctx context.Context) (*sql.Conn, error)
+}
+
+// CallProcedure invokes a Dolt stored procedure with the given arguments and
+// returns its result set. Every call runs on its own connection, with the
+// branch of the call checked out, and the connection is discarded afterwards,
+// so a checkout never changes the branch of the pooled connections of the
+// database.
+func (s *Server) CallProcedure(ctx context.Context, req *proto.CallProcedureRequest) (*proto.QueryResponse, error) {
+	procedure := strings.ToLower(req.Procedure)
+	if !allowedProcedures[procedure] {
+		return nil, status.Errorf(codes.PermissionDenied, "procedure '%s' is not allowed", req.Procedure)
+	}
+	branch := req.Branch
+	if branch == "" {
+		branch = procedureBranch
+	}
+	if err := checkProcedureBranch(procedure, branch, req.Args); err != nil {
+		return nil, err
+	}
+	if s.Procedures == nil {
+		return nil, status.Error(codes.Unimplemented, "procedures are not enabled on this node")
+	}
+	// procedures change the whole database, so they require write access to
+	// all tables
+	if err := s.authorize(ctx, "CALL "+procedure, true); err != nil {
+		return nil, err
+	}
+
+	placeholders := make([]string, len(req.Args))
+	args := make([]any, len(req.Args))
+	for i, arg := range req.Args {
+		placeholders[i] = "?"
+		args[i] = arg
+	}
+
+	conn, err := s.Procedures.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer discard(conn)
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := callInTx(ctx, tx, branch, "CALL "+procedure+"("+strings.Join(placeholders, ", ")+");", args...)
+	if err != nil {
+		return nil, errors.Join(err, tx.Rollback())
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// checkProcedureBranch refuses the calls that would change the working set of
+// main, whose commits are replicated to the cluster: resets, which can also
+// move its head, and checkouts that don't create a branch, which revert the
+// tables they name. They can run on any other branch.
+func checkProcedureBranch(procedure string, branch string, args []string) error {
+	if branch != procedureBranch {
+		return nil
+	}
+	switch {
+	case procedure == "dolt_reset":
+		return status.Errorf(codes.FailedPrecondition, "dolt_reset can't run on branch '%s'", branch)
+	case procedure == "dolt_checkout" && (len(args) == 0 || args[0] != "-b"):
+		return status.Errorf(codes.FailedPrecondition, "dolt_checkout can only create branches on branch '%s'", branch)
+	}
+	return nil
+}
+
+// callInTx checks out the branch and calls a procedure in the same
+// transaction, since the checkout only applies to the session
+func callInTx(ctx context.Context, tx *sql.Tx, branch string, call string, args ...any) (*proto.QueryResponse, error) {
+	if _, err := tx.ExecContext(ctx, "CALL DOLT_CHECKOUT(?);", branch); err != nil {
+		return nil, err
+	}
+	rows, err := tx.QueryContext(ctx, call, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return RowsToResponse(rows)
+}
+
+// discard closes a connection without returning it to the pool, so that the
+// session state left by a procedure, like its checked out branch, is dropped
+func discard(conn *sql.Conn) {
+	_ = conn.Raw(func(any) error {
+		return driver.ErrBadConn
+	})
+	_ = conn.Close()
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCallProcedure(t *testing.T) {
+	s := &Server{}
+	tests := []struct {
+		req  *proto.CallProcedureRequest
+		code codes.Code
+	}{
+		{&proto.CallProcedureRequest{Procedure: "dolt_gc"}, codes.PermissionDenied},
+		{&proto.CallProcedureRequest{Procedure: "dolt_push", Branch: "feature"}, codes.PermissionDenied},
+		{&proto.CallProcedureRequest{Procedure: "dolt_reset", Args: []string{"--hard"}}, codes.FailedPrecondition},
+		{&proto.CallProcedureRequest{Procedure: "DOLT_RESET", Args: []string{"--hard", "HEAD~1"}, Branch: "main"}, codes.FailedPrecondition},
+		{&proto.CallProcedureRequest{Procedure: "dolt_checkout", Args: []string{"testtable"}}, codes.FailedPrecondition},
+		{&proto.CallProcedureRequest{Procedure: "dolt_checkout", Args: []string{"-B", "main", "HEAD~1"}}, codes.FailedPrecondition},
+		{&proto.CallProcedureRequest{Procedure: "dolt_checkout"}, codes.FailedPrecondition},
+		// allowed calls reach the database, which is not set
+		{&proto.CallProcedureRequest{Procedure: "dolt_checkout", Args: []string{"-b", "feature"}}, codes.Unimplemented},
+		{&proto.CallProcedureRequest{Procedure: "dolt_checkout", Args: []string{"testtable"}, Branch: "feature"}, codes.Unimplemented},
+		{&proto.CallProcedureRequest{Procedure: "dolt_reset", Args: []string{"--hard"}, Branch: "feature"}, codes.Unimplemented},
+		{&proto.CallProcedureRequest{Procedure: "dolt_merge", Args: []string{"feature"}}, codes.Unimplemented},
+	}
+	for _, test := range tests {
+		_, err := s.CallProcedure(context.Background(), test.req)
+		if status.Code(err) != test.code {
+			t.Errorf("expected %s for %s(%v) on '%s', got %v", test.code, test.req.Procedure, test.req.Args, test.req.Branch, err)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestQueryRefusesWrites(t *testing.T) {
+	s := &Server{}
+	statements := []string{
+		"DELETE FROM testtable",
+		"WITH x AS (SELECT 1) DELETE FROM testtable",
+		"SELECT * FROM testtable INTO OUTFILE '/tmp/out'",
+		"SELECT DOLT_RESET('--hard')",
+		"SELECT 1; DROP TABLE testtable",
+		"DROP TABLE testtable",
+	}
+	for _, statement := range statements {
+		_, err := s.Query(context.Background(), &proto.QueryRequest{Statement: statement})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("expected '%s' to be refused, got %v", statement, err)
+		}
+	}
+}
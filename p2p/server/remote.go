@@ -0,0 +1,16 @@
+package server
+
+import (
+	"context"
+
+	"github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+// RemoteReader serves the queries that need data the node doesn't keep from
+// a peer that does
+type RemoteReader interface {
+	// RemoteQuery returns false if the query should be served locally
+	RemoteQuery(ctx context.Context, req *proto.QueryRequest) (*proto.QueryResponse, bool, error)
+	// RemoteExplain returns false if the query should be planned locally
+	RemoteExplain(ctx context.Context, req *proto.ExplainRequest) (*proto.ExplainResponse, bool, error)
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeRouter forwards every write to the peer it holds, or keeps them local
+// if it has none
+type fakeRouter struct {
+	peer *fakeTester
+}
+
+func (r *fakeRouter) Route(query string) (proto.TesterClient, bool, error) {
+	if r.peer == nil {
+		return nil, false, nil
+	}
+	return r.peer, true, nil
+}
+
+// fakeTester records the writes forwarded to it
+type fakeTester struct {
+	proto.TesterClient
+
+	forwarded []*proto.ExecSQLRequest
+}
+
+func (t *fakeTester) ExecSQL(ctx context.Context, req *proto.ExecSQLRequest, opts ...grpc.CallOption) (*proto.ExecSQLResponse, error) {
+	t.forwarded = append(t.forwarded, req)
+	return &proto.ExecSQLResponse{Commit: "owner"}, nil
+}
+
+func TestForwardedWrites(t *testing.T) {
+	ctx := context.Background()
+	owner := &fakeTester{}
+	db := &fakeDB{}
+	s := &Server{DB: db, Router: &fakeRouter{peer: owner}}
+
+	resp, err := s.ExecSQL(ctx, &proto.ExecSQLRequest{Statement: "INSERT INTO orders VALUES (1)"})
+	if err != nil || resp.Commit != "owner" {
+		t.Fatalf("expected the write to be forwarded to the owner, got %v (%v)", resp, err)
+	}
+	if len(owner.forwarded) != 1 || !owner.forwarded[0].Forwarded {
+		t.Fatalf("expected a single write marked as forwarded, got %v", owner.forwarded)
+	}
+
+	// a peer can't make a node commit a write it's not responsible for by
+	// marking it as forwarded
+	_, err = s.ExecSQL(ctx, &proto.ExecSQLRequest{Statement: "INSERT INTO orders VALUES (2)", Forwarded: true})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected a forged forwarded write to be refused, got %v", err)
+	}
+	if len(db.commits) != 0 || len(owner.forwarded) != 1 {
+		t.Errorf("expected the forged write to be neither committed nor forwarded again, got %d commits and %d forwards", len(db.commits), len(owner.forwarded))
+	}
+
+	// the node responsible for the write commits forwarded writes
+	local := &Server{DB: db, Router: &fakeRouter{}}
+	resp, err = local.ExecSQL(ctx, &proto.ExecSQLRequest{Statement: "INSERT INTO orders VALUES (3)", Forwarded: true})
+	if err != nil || resp.Commit != "c1" {
+		t.Errorf("expected the forwarded write to be committed, got %v (%v)", resp, err)
+	}
+}
@@ -2,12 +2,24 @@ package server
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	p2pgrpc "github.com/birros/go-libp2p-grpc"
 	"github.com/nustiueudinastea/doltswarm"
+	"github.com/nustiueudinastea/doltswarmdemo/author"
+	"github.com/nustiueudinastea/doltswarmdemo/commitlog"
+	"github.com/nustiueudinastea/doltswarmdemo/commitmeta"
+	"github.com/nustiueudinastea/doltswarmdemo/drift"
 	"github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"github.com/nustiueudinastea/doltswarmdemo/sqlstmt"
+	"github.com/nustiueudinastea/doltswarmdemo/vclock"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var _ proto.PingerServer = (*Server)(nil)
@@ -17,46 +29,331 @@ type ExternalDB interface {
 	AddPeer(peerID string, conn *grpc.ClientConn) error
 	RemovePeer(peerID string) error
 	GetAllCommits() ([]doltswarm.Commit, error)
+	ListCommits(opts commitlog.Options) (commitlog.Page, error)
 	ExecAndCommit(query string, commitMsg string) (string, error)
 	GetLastCommit(branch string) (doltswarm.Commit, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// Router decides if a write should be forwarded to another peer instead of
+// being committed locally. An error is returned if the peer responsible for
+// the write is not reachable.
+type Router interface {
+	Route(query string) (proto.TesterClient, bool, error)
+}
+
+// Replicator waits until enough peers acknowledge a commit to satisfy the
+// requested consistency level.
+type Replicator interface {
+	WaitForAcks(ctx context.Context, commit string, consistency proto.Consistency) error
+}
+
+// Announcer announces a head to a peer through the DB syncer, as if it was a
+// new commit
+type Announcer interface {
+	Announce(ctx context.Context, peerID string, head string) error
+}
+
+// CompressionNegotiator picks the compressor used with a peer from the ones it
+// offers in its ping
+type CompressionNegotiator interface {
+	NegotiateCompression(peerID string, offered []string) string
+}
+
+// LagRecorder keeps the number of commits every peer reports being behind
+type LagRecorder interface {
+	RecordLag(peerID string, behind int64)
+}
+
+// Authorizer decides if a peer is allowed to run a query, or to read and
+// write tables
+type Authorizer interface {
+	Authorize(peerID string, query string, write bool) error
+	AuthorizeTables(peerID string, reads []string, writes []string) error
+	// ReadableTables returns the tables the peer is allowed to read, without
+	// auditing the others
+	ReadableTables(peerID string, tables []string) []string
+}
+
+// Quarantiner holds back writes from peers that were rejected, so that they
+// can be reviewed instead of being lost
+type Quarantiner interface {
+	Quarantine(peerID string, statement string, msg string, reason error)
 }
 
 type Server struct {
-	DB ExternalDB
+	DB         ExternalDB
+	Router     Router
+	Replicator Replicator
+	// Authorizer is optional. All peers are trusted if it's not set
+	Authorizer Authorizer
+	// Quarantiner is optional. Rejected writes are dropped if it's not set
+	Quarantiner Quarantiner
+	// Version is the protocol version advertised to peers
+	Version string
+	// Role and HistoryDepth advertise how much history the node keeps
+	Role         string
+	HistoryDepth int64
+	// Region and Zone advertise the location of the node
+	Region string
+	Zone   string
+	// Announcer is optional. Missed commits are only listed if it's not set
+	Announcer Announcer
+	// Compression is optional. Messages are not compressed if it's not set
+	Compression CompressionNegotiator
+	// Lags is optional. Lag reports are ignored if it's not set
+	Lags LagRecorder
+	// Writes is optional. Writes with an expected head are refused if it's
+	// not set
+	Writes HeadGuard
+	// Identity is optional. Peers are not checked for the database they
+	// replicate if it's not set
+	Identity IdentityChecker
+	// Remote is optional. All queries are served locally if it's not set
+	Remote RemoteReader
+	// ID is the peer ID of the node, reported with the query plans
+	ID string
+	// Tokens is optional. If it's not set, retries of a write are only
+	// recognized once the first attempt is committed, so concurrent retries
+	// can both apply it
+	Tokens *TokenIndex
+	// NamedQueries is optional. Named queries are refused if it's not set
+	NamedQueries NamedQueryStore
+	// Procedures is optional. Procedure calls are refused if it's not set
+	Procedures ConnOpener
+}
+
+// authorize checks the query against the authorizer using the identity of the
+// calling peer
+func (s *Server) authorize(ctx context.Context, query string, write bool) error {
+	if s.Authorizer == nil {
+		return nil
+	}
+	remotePeer, ok := p2pgrpc.RemotePeerFromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "no AuthInfo in context")
+	}
+	return s.Authorizer.Authorize(remotePeer.String(), query, write)
+}
+
+// quarantine hands a rejected write to the quarantiner
+func (s *Server) quarantine(ctx context.Context, req *proto.ExecSQLRequest, reason error) {
+	if s.Quarantiner == nil {
+		return
+	}
+	peerID := ""
+	if remotePeer, ok := p2pgrpc.RemotePeerFromContext(ctx); ok {
+		peerID = remotePeer.String()
+	}
+	s.Quarantiner.Quarantine(peerID, req.Statement, req.Msg, reason)
 }
 
 func (s *Server) Ping(ctx context.Context, req *proto.PingRequest) (*proto.PingResponse, error) {
-	_, ok := p2pgrpc.RemotePeerFromContext(ctx)
+	remotePeer, ok := p2pgrpc.RemotePeerFromContext(ctx)
 	if !ok {
 		return nil, errors.New("no AuthInfo in context")
 	}
 
 	res := &proto.PingResponse{
-		Pong: "Ping: " + req.Ping + "!",
+		Pong:         "Ping: " + req.Ping + "!",
+		Version:      s.Version,
+		Role:         s.Role,
+		HistoryDepth: s.HistoryDepth,
+		TimeUnixNano: time.Now().UnixNano(),
+		Region:       s.Region,
+		Zone:         s.Zone,
+	}
+	if s.Identity != nil {
+		identity, err := s.Identity.CheckIdentity(remotePeer.String(), req.Identity)
+		if err != nil {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		res.Identity = identity
+	}
+	if s.Compression != nil {
+		res.Compressor = s.Compression.NegotiateCompression(remotePeer.String(), req.Compressors)
 	}
 	return res, nil
 }
 
 func (s *Server) ExecSQL(ctx context.Context, req *proto.ExecSQLRequest) (*proto.ExecSQLResponse, error) {
-	commit, err := s.DB.ExecAndCommit(req.Statement, req.Msg)
+	if err := s.authorize(ctx, req.Statement, true); err != nil {
+		s.quarantine(ctx, req, err)
+		return nil, err
+	}
+
+	if req.Author != "" {
+		a, err := author.Parse(req.Author)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		req.Msg = author.Annotate(req.Msg, a)
+		req.Author = ""
+	}
+	if len(req.Metadata) > 0 {
+		req.Msg = commitmeta.Annotate(req.Msg, req.Metadata)
+		req.Metadata = nil
+	}
+
+	if s.Router != nil {
+		// forwarded writes are routed too, since the flag comes from the
+		// sender: only the node responsible for the write commits it
+		client, forward, err := s.Router.Route(req.Statement)
+		if err != nil {
+			return nil, err
+		}
+		if forward && req.Forwarded {
+			return nil, status.Error(codes.FailedPrecondition, "write was forwarded to a node that is not responsible for it")
+		}
+		if forward {
+			req.Forwarded = true
+			return client.ExecSQL(ctx, req)
+		}
+	}
+
+	token, err := decodeSessionToken(req.SessionToken)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	history, err := s.commitSet()
 	if err != nil {
 		return nil, err
 	}
-	return &proto.ExecSQLResponse{Result: "", Commit: commit}, nil
+
+	if req.IdempotencyToken != "" {
+		if err := validateToken(req.IdempotencyToken); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if s.Tokens != nil {
+			unlock, err := s.Tokens.lock(ctx, req.IdempotencyToken)
+			if err != nil {
+				return nil, err
+			}
+			defer unlock()
+		}
+		commit, found, err := s.committedToken(req.IdempotencyToken)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			resp, err := s.execResponse(ctx, req, token, history, commit)
+			if resp != nil {
+				resp.Replayed = true
+			}
+			return resp, err
+		}
+		req.Msg = AnnotateToken(req.Msg, req.IdempotencyToken)
+	}
+
+	exec := func() (string, error) {
+		return s.DB.ExecAndCommit(req.Statement, req.Msg)
+	}
+	var commit string
+	switch {
+	case s.Writes != nil:
+		commit, err = s.Writes.ExecIfHead(req.ExpectedHead, exec)
+	case req.ExpectedHead != "":
+		return nil, status.Error(codes.Unimplemented, "node doesn't support writes with an expected head")
+	default:
+		commit, err = exec()
+	}
+	if err != nil {
+		if status.Code(err) == codes.FailedPrecondition {
+			s.quarantine(ctx, req, err)
+		}
+		return nil, err
+	}
+	if req.IdempotencyToken != "" && s.Tokens != nil {
+		s.Tokens.record(req.IdempotencyToken, commit)
+	}
+	return s.execResponse(ctx, req, token, history, commit)
 }
 
-func (s *Server) GetAllCommits(context.Context, *proto.GetAllCommitsRequest) (*proto.GetAllCommitsResponse, error) {
-	commits, err := s.DB.GetAllCommits()
+// execResponse waits for the acks the write asked for and returns the commit
+// with the advanced session token
+func (s *Server) execResponse(ctx context.Context, req *proto.ExecSQLRequest, token sessionToken, history map[string]bool, commit string) (*proto.ExecSQLResponse, error) {
+	sessionToken, err := token.advance(commit, history).encode()
 	if err != nil {
 		return nil, err
 	}
 
-	res := &proto.GetAllCommitsResponse{}
-	for _, commit := range commits {
-		res.Commits = append(res.Commits, commit.Hash)
+	if s.Replicator != nil {
+		err = s.Replicator.WaitForAcks(ctx, commit, req.Consistency)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return res, nil
+	return &proto.ExecSQLResponse{Result: "", Commit: commit, SessionToken: sessionToken}, nil
+}
+
+// GetAllCommits returns a page of commits, or every commit on main if no
+// paging options are set
+func (s *Server) GetAllCommits(ctx context.Context, req *proto.GetAllCommitsRequest) (*proto.GetAllCommitsResponse, error) {
+	if req.Cursor == "" && req.Limit == 0 && req.Branch == "" && req.Order == proto.CommitOrder_COMMIT_ORDER_NEWEST_FIRST {
+		commits, err := s.DB.GetAllCommits()
+		if err != nil {
+			return nil, err
+		}
+
+		res := &proto.GetAllCommitsResponse{}
+		for _, commit := range commits {
+			res.Commits = append(res.Commits, commit.Hash)
+		}
+		return res, nil
+	}
+
+	if req.Limit < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid limit %d", req.Limit)
+	}
+	page, err := s.DB.ListCommits(listOptions(req))
+	if err != nil {
+		return nil, err
+	}
+	return pageToResponse(page), nil
+}
+
+// StreamCommits sends the commits of a branch, one page at a time
+func (s *Server) StreamCommits(req *proto.GetAllCommitsRequest, stream proto.Tester_StreamCommitsServer) error {
+	if req.Limit < 0 {
+		return status.Errorf(codes.InvalidArgument, "invalid limit %d", req.Limit)
+	}
+	opts := listOptions(req)
+	for {
+		page, err := s.DB.ListCommits(opts)
+		if err != nil {
+			return err
+		}
+		err = stream.Send(pageToResponse(page))
+		if err != nil {
+			return err
+		}
+		if page.NextCursor == "" {
+			return nil
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+func listOptions(req *proto.GetAllCommitsRequest) commitlog.Options {
+	opts := commitlog.Options{
+		Branch: req.Branch,
+		Cursor: req.Cursor,
+		Limit:  int(req.Limit),
+	}
+	if req.Order == proto.CommitOrder_COMMIT_ORDER_OLDEST_FIRST {
+		opts.Order = commitlog.OldestFirst
+	}
+	return opts
+}
+
+func pageToResponse(page commitlog.Page) *proto.GetAllCommitsResponse {
+	res := &proto.GetAllCommitsResponse{NextCursor: page.NextCursor}
+	for _, commit := range page.Commits {
+		res.Commits = append(res.Commits, commit.Hash)
+	}
+	return res
 }
 
 func (s *Server) GetHead(context.Context, *proto.GetHeadRequest) (*proto.GetHeadResponse, error) {
@@ -66,3 +363,214 @@ func (s *Server) GetHead(context.Context, *proto.GetHeadRequest) (*proto.GetHead
 	}
 	return &proto.GetHeadResponse{Commit: commit.Hash}, nil
 }
+
+// Missed returns the commits on a branch that are newer than the caller's
+// frontier. With replay set, the head is announced again to the caller, which
+// handles it like any other announcement and pulls the missed commits.
+func (s *Server) Missed(ctx context.Context, req *proto.MissedRequest) (*proto.MissedResponse, error) {
+	if req.Limit < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid limit %d", req.Limit)
+	}
+	page, err := s.DB.ListCommits(commitlog.Options{Branch: req.Branch})
+	if err != nil {
+		return nil, err
+	}
+	var since time.Time
+	if req.SinceUnix > 0 {
+		since = time.Unix(req.SinceUnix, 0)
+	}
+	missed, truncated := commitlog.Missed(page.Commits, since, req.Frontier, int(req.Limit))
+
+	// the page only holds the most recent commits of very long histories
+	truncated = truncated || (page.NextCursor != "" && len(missed) == len(page.Commits))
+	res := &proto.MissedResponse{Truncated: truncated}
+	for _, commit := range missed {
+		res.Commits = append(res.Commits, &proto.MissedCommit{Hash: commit.Hash, DateUnix: commit.Date.Unix(), Message: commit.Message})
+	}
+
+	if req.Replay && len(missed) > 0 && s.Announcer != nil {
+		remotePeer, ok := p2pgrpc.RemotePeerFromContext(ctx)
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "no AuthInfo in context")
+		}
+		err = s.Announcer.Announce(ctx, remotePeer.String(), missed[len(missed)-1].Hash)
+		if err != nil {
+			return nil, status.Errorf(codes.Unavailable, "failed to announce head: %v", err)
+		}
+	}
+	return res, nil
+}
+
+// ReportLag records how many commits the calling peer is behind
+func (s *Server) ReportLag(ctx context.Context, req *proto.ReportLagRequest) (*proto.ReportLagResponse, error) {
+	remotePeer, ok := p2pgrpc.RemotePeerFromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "no AuthInfo in context")
+	}
+	if s.Lags != nil {
+		s.Lags.RecordLag(remotePeer.String(), req.Behind)
+	}
+	return &proto.ReportLagResponse{}, nil
+}
+
+// TableStats returns the row count and content hash of every table at a
+// commit
+func (s *Server) TableStats(ctx context.Context, req *proto.TableStatsRequest) (*proto.TableStatsResponse, error) {
+	if req.Commit == "" {
+		return nil, status.Error(codes.InvalidArgument, "no commit specified")
+	}
+	stats, err := drift.Collect(s.DB, req.Commit)
+	if err != nil {
+		return nil, err
+	}
+	// peers only get the stats of the tables they can read
+	readable := map[string]bool{}
+	if s.Authorizer != nil {
+		remotePeer, ok := p2pgrpc.RemotePeerFromContext(ctx)
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "no AuthInfo in context")
+		}
+		tables := make([]string, 0, len(stats))
+		for _, ts := range stats {
+			tables = append(tables, strings.ToLower(ts.Table))
+		}
+		for _, table := range s.Authorizer.ReadableTables(remotePeer.String(), tables) {
+			readable[table] = true
+		}
+	}
+	res := &proto.TableStatsResponse{}
+	for _, ts := range stats {
+		if s.Authorizer != nil && !readable[strings.ToLower(ts.Table)] {
+			continue
+		}
+		res.Tables = append(res.Tables, &proto.TableStat{Table: ts.Table, Rows: ts.Rows, Hash: ts.Hash})
+	}
+	return res, nil
+}
+
+func (s *Server) AckCommit(ctx context.Context, req *proto.AckCommitRequest) (*proto.AckCommitResponse, error) {
+	applied, err := s.waitForCommits(ctx, []string{req.Commit})
+	if err != nil {
+		return nil, err
+	}
+	return &proto.AckCommitResponse{Applied: applied}, nil
+}
+
+// CompareCommits returns the causal ordering of two commits based on the vector
+// clocks attached to them.
+func (s *Server) CompareCommits(ctx context.Context, req *proto.CompareCommitsRequest) (*proto.CompareCommitsResponse, error) {
+	commits, err := s.DB.GetAllCommits()
+	if err != nil {
+		return nil, err
+	}
+
+	var clockA, clockB vclock.VClock
+	for _, commit := range commits {
+		if commit.Hash == req.A {
+			clockA, _ = vclock.FromMessage(commit.Message)
+		}
+		if commit.Hash == req.B {
+			clockB, _ = vclock.FromMessage(commit.Message)
+		}
+	}
+	if clockA == nil {
+		return nil, fmt.Errorf("no vector clock found for commit '%s'", req.A)
+	}
+	if clockB == nil {
+		return nil, fmt.Errorf("no vector clock found for commit '%s'", req.B)
+	}
+
+	return &proto.CompareCommitsResponse{
+		Ordering: clockA.Compare(clockB).String(),
+		ClockA:   clockA,
+		ClockB:   clockB,
+	}, nil
+}
+
+// Query runs a read query. If the request carries a session token, the query
+// waits until the local history includes all the commits in the token.
+func (s *Server) Query(ctx context.Context, req *proto.QueryRequest) (*proto.QueryResponse, error) {
+	// the ACL authorizes queries as reads, so anything else goes through
+	// ExecSQL
+	if !sqlstmt.IsRead(req.Statement) {
+		return nil, status.Error(codes.InvalidArgument, "only a single SELECT statement without side effects can be queried")
+	}
+	if err := s.authorize(ctx, req.Statement, false); err != nil {
+		return nil, err
+	}
+
+	if err := s.waitForSession(ctx, req.SessionToken, req.TimeoutMs); err != nil {
+		return nil, err
+	}
+
+	if s.Remote != nil {
+		resp, remote, err := s.Remote.RemoteQuery(ctx, req)
+		if remote || err != nil {
+			return resp, err
+		}
+	}
+
+	// the query is cancelled once the caller stops waiting
+	rows, err := s.DB.QueryContext(ctx, req.Statement)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return RowsToResponse(rows)
+}
+
+// waitForSession waits until the local history includes all the commits in
+// the session token, if any
+func (s *Server) waitForSession(ctx context.Context, sessionToken string, timeoutMs int64) error {
+	token, err := decodeSessionToken(sessionToken)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if len(token.Frontier) == 0 {
+		return nil
+	}
+
+	timeout := defaultSessionTimeout
+	if timeoutMs > 0 {
+		timeout = time.Duration(timeoutMs) * time.Millisecond
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	synced, err := s.waitForCommits(waitCtx, token.Frontier)
+	cancel()
+	if err != nil {
+		return err
+	}
+	if !synced {
+		return status.Errorf(codes.DeadlineExceeded, "node did not sync past the session frontier within %s", timeout)
+	}
+	return nil
+}
+
+// RowsToResponse reads all the rows into a query response. NULL values are
+// returned as empty strings.
+func RowsToResponse(rows *sql.Rows) (*proto.QueryResponse, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &proto.QueryResponse{Columns: columns}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		err = rows.Scan(dest...)
+		if err != nil {
+			return nil, err
+		}
+		row := &proto.Row{Values: make([]string, len(columns))}
+		for i, value := range values {
+			row.Values[i] = value.String
+		}
+		res.Rows = append(res.Rows, row)
+	}
+	return res, rows.Err()
+}
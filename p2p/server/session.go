@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+const defaultSessionTimeout = 10 * time.Second
+
+// commitHash matches the hashes of Dolt commits
+var commitHash = regexp.MustCompile(`^[0-9a-v]{32}$`)
+
+// sessionToken captures the commit frontier of the writes made by a client, so
+// that reads served by other nodes can wait until they've synced past it.
+type sessionToken struct {
+	Frontier []string `json:"frontier"`
+}
+
+func decodeSessionToken(token string) (sessionToken, error) {
+	st := sessionToken{}
+	if token == "" {
+		return st, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return st, fmt.Errorf("failed to decode session token: %w", err)
+	}
+	err = json.Unmarshal(data, &st)
+	if err != nil {
+		return st, fmt.Errorf("failed to decode session token: %w", err)
+	}
+	// a tampered frontier would make reads wait for commits that never come
+	for _, commit := range st.Frontier {
+		if !commitHash.MatchString(commit) {
+			return sessionToken{}, fmt.Errorf("invalid commit '%s' in session token", commit)
+		}
+	}
+	return st, nil
+}
+
+func (st sessionToken) encode() (string, error) {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode session token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// advance returns a token that includes the new commit. Commits that are
+// already part of the local history are ancestors of the new commit, so they
+// are dropped from the frontier.
+func (st sessionToken) advance(commit string, history map[string]bool) sessionToken {
+	next := sessionToken{Frontier: []string{}}
+	// writes to local-only tables don't create a commit
+	if commit != "" {
+		next.Frontier = append(next.Frontier, commit)
+	}
+	for _, c := range st.Frontier {
+		if !history[c] {
+			next.Frontier = append(next.Frontier, c)
+		}
+	}
+	return next
+}
+
+func (s *Server) commitSet() (map[string]bool, error) {
+	commits, err := s.DB.GetAllCommits()
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[string]bool, len(commits))
+	for _, commit := range commits {
+		set[commit.Hash] = true
+	}
+	return set, nil
+}
+
+// waitForCommits polls the local history until all the commits are present or
+// the context expires. It returns false if the commits were not found in time.
+func (s *Server) waitForCommits(ctx context.Context, hashes []string) (bool, error) {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		history, err := s.commitSet()
+		if err != nil {
+			return false, err
+		}
+
+		found := true
+		for _, hash := range hashes {
+			if !history[hash] {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true, nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return false, nil
+		}
+	}
+}
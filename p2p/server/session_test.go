@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+const (
+	commitA = "0123456789abcdefghijklmnopqrstuv"
+	commitB = "vutsrqponmlkjihgfedcba9876543210"
+	commitC = "00000000000000000000000000000000"
+)
+
+func TestSessionTokenRoundTrip(t *testing.T) {
+	tests := []sessionToken{
+		{Frontier: []string{}},
+		{Frontier: []string{commitA}},
+		{Frontier: []string{commitA, commitB}},
+	}
+	for _, token := range tests {
+		encoded, err := token.encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := decodeSessionToken(encoded)
+		if err != nil {
+			t.Fatalf("failed to decode %v: %v", token, err)
+		}
+		if !reflect.DeepEqual(decoded, token) {
+			t.Errorf("expected %v, got %v", token, decoded)
+		}
+	}
+
+	decoded, err := decodeSessionToken("")
+	if err != nil || len(decoded.Frontier) != 0 {
+		t.Errorf("expected an empty frontier for an empty token, got %v (%v)", decoded, err)
+	}
+}
+
+func TestSessionTokenInvalid(t *testing.T) {
+	encoded, err := sessionToken{Frontier: []string{commitA}}.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+	tests := map[string]string{
+		"not base64":         "not a token!",
+		"padded base64":      base64.URLEncoding.EncodeToString([]byte(`{"frontier": []}`)),
+		"not JSON":           raw("frontier"),
+		"truncated":          encoded[:len(encoded)-4],
+		"wrong type":         raw(`{"frontier":"` + commitA + `"}`),
+		"tampered commit":    raw(`{"frontier":["` + commitA[:31] + `z"]}`),
+		"short commit":       raw(`{"frontier":["abc"]}`),
+		"empty commit":       raw(`{"frontier":[""]}`),
+		"one invalid commit": raw(`{"frontier":["` + commitA + `","HEAD"]}`),
+	}
+	for name, token := range tests {
+		if decoded, err := decodeSessionToken(token); err == nil {
+			t.Errorf("%s: expected an error, got %v", name, decoded)
+		}
+	}
+}
+
+func TestSessionTokenAdvance(t *testing.T) {
+	tests := []struct {
+		name     string
+		frontier []string
+		commit   string
+		history  map[string]bool
+		want     []string
+	}{
+		{"empty frontier", nil, commitA, map[string]bool{}, []string{commitA}},
+		{"synced ancestor", []string{commitA}, commitB, map[string]bool{commitA: true}, []string{commitB}},
+		{"unknown commit", []string{commitA}, commitB, map[string]bool{}, []string{commitB, commitA}},
+		{"partly synced", []string{commitA, commitC}, commitB, map[string]bool{commitC: true}, []string{commitB, commitA}},
+		{"local-only write", []string{commitA}, "", map[string]bool{}, []string{commitA}},
+		{"local-only write on empty frontier", nil, "", map[string]bool{}, []string{}},
+	}
+	for _, test := range tests {
+		next := sessionToken{Frontier: test.frontier}.advance(test.commit, test.history)
+		if !reflect.DeepEqual(next.Frontier, test.want) {
+			t.Errorf("%s: expected frontier %v, got %v", test.name, test.want, next.Frontier)
+		}
+		// the advanced token is accepted back
+		encoded, err := next.encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := decodeSessionToken(encoded); err != nil {
+			t.Errorf("%s: failed to decode the advanced token: %v", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	p2pgrpc "github.com/birros/go-libp2p-grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// service is a gRPC service served by the node
+type service struct {
+	desc *grpc.ServiceDesc
+	impl any
+}
+
+// registerService adds a service to the main gRPC server and to the servers
+// of the other registered protocols. Services can't be added once the
+// protocols are served.
+func (r *ProtocolRegistry) registerService(desc *grpc.ServiceDesc, impl any) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if r.serving {
+		return fmt.Errorf("service '%s' has to be registered before the node is started", desc.ServiceName)
+	}
+	if _, found := r.main.GetServiceInfo()[desc.ServiceName]; found {
+		return fmt.Errorf("service '%s' is already registered", desc.ServiceName)
+	}
+	svc := service{desc: desc, impl: impl}
+	r.services = append(r.services, svc)
+	r.main.RegisterService(desc, impl)
+	for _, p := range r.protocols {
+		addServices(p.server, svc)
+	}
+	return nil
+}
+
+// addServices registers the services the server doesn't have yet
+func addServices(server *grpc.Server, services ...service) {
+	info := server.GetServiceInfo()
+	for _, svc := range services {
+		if _, found := info[svc.desc.ServiceName]; !found {
+			server.RegisterService(svc.desc, svc.impl)
+		}
+	}
+}
+
+// Services returns the names of the gRPC services served by the node
+func (r *ProtocolRegistry) Services() []string {
+	names := []string{}
+	for name := range r.main.GetServiceInfo() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RegisterService attaches a gRPC service to the node, next to the built-in
+// ones. It is served on every RPC protocol, behind the interceptors of the
+// node, and can identify its callers with RemotePeer. Services have to be
+// registered before StartServer.
+func (p2p *P2P) RegisterService(desc *grpc.ServiceDesc, impl any) error {
+	return p2p.protocols.registerService(desc, impl)
+}
+
+// RemotePeer returns the ID of the peer calling a service, and false if the
+// call didn't come over libp2p
+func RemotePeer(ctx context.Context) (string, bool) {
+	id, ok := p2pgrpc.RemotePeerFromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	return id.String(), true
+}
+
+// Authorize checks a statement run by a service on behalf of its caller
+// against the access rules of the node, if any
+func (p2p *P2P) Authorize(ctx context.Context, query string, write bool) error {
+	if p2p.authorizer == nil {
+		return nil
+	}
+	peerID, ok := RemotePeer(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "no AuthInfo in context")
+	}
+	return p2p.authorizer.Authorize(peerID, query, write)
+}
+
+// AuthorizeTables checks that the caller in ctx can read and write the given
+// tables, for callers that parse their statements themselves
+func (p2p *P2P) AuthorizeTables(ctx context.Context, reads []string, writes []string) error {
+	if p2p.authorizer == nil {
+		return nil
+	}
+	peerID, ok := RemotePeer(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "no AuthInfo in context")
+	}
+	return p2p.authorizer.AuthorizeTables(peerID, reads, writes)
+}
@@ -0,0 +1,77 @@
+package p2p
+
+import (
+	"sync"
+	"time"
+)
+
+// signerRetention is how long the signers of the commits made or pulled by the
+// node are kept
+const signerRetention = 24 * time.Hour
+
+// CommitCheck is called with the commits pulled from peers once their
+// signature was verified, before they are applied. The signer is the peer ID
+// of the key that signed the commit. Returning an error rejects the commit.
+type CommitCheck func(commit string, signer string) error
+
+// commitSigners keeps the verified signers of the recent commits, and the
+// checks run before applying the commits of peers
+type commitSigners struct {
+	mtx     sync.Mutex
+	signers map[string]signedCommit
+	checks  []CommitCheck
+}
+
+type signedCommit struct {
+	signer string
+	at     time.Time
+}
+
+func (s *commitSigners) record(commit string, signer string, at time.Time) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.signers == nil {
+		s.signers = map[string]signedCommit{}
+	}
+	s.signers[commit] = signedCommit{signer: signer, at: at}
+	cutoff := at.Add(-signerRetention)
+	for hash, signed := range s.signers {
+		if signed.at.Before(cutoff) {
+			delete(s.signers, hash)
+		}
+	}
+}
+
+func (s *commitSigners) get(commit string) (string, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	signed, found := s.signers[commit]
+	return signed.signer, found
+}
+
+func (s *commitSigners) check(commit string, signer string) error {
+	s.mtx.Lock()
+	checks := append([]CommitCheck{}, s.checks...)
+	s.mtx.Unlock()
+	for _, check := range checks {
+		if err := check(commit, signer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddCommitCheck adds a check run on every commit pulled from a peer before
+// it's applied
+func (p2p *P2PKey) AddCommitCheck(check CommitCheck) {
+	p2p.signers.mtx.Lock()
+	defer p2p.signers.mtx.Unlock()
+	p2p.signers.checks = append(p2p.signers.checks, check)
+}
+
+// Signer returns the peer ID of the key that signed a commit, if the commit
+// was made or pulled by the node recently. Unlike the Peer-ID trailer of the
+// commit message, the signer can't be forged by the author.
+func (p2p *P2PKey) Signer(commit string) (string, bool) {
+	return p2p.signers.get(commit)
+}
@@ -0,0 +1,49 @@
+package p2p
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCommitSigners(t *testing.T) {
+	author, err := NewKey(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := NewKey(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig, err := author.Sign("commit1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer, found := author.Signer("commit1"); !found || signer != author.GetID() {
+		t.Fatalf("expected the author to record its own commit, got '%s'", signer)
+	}
+
+	if err := local.Verify("commit1", sig, author.PublicKey()); err != nil {
+		t.Fatal(err)
+	}
+	if signer, found := local.Signer("commit1"); !found || signer != author.GetID() {
+		t.Fatalf("expected the verified signer to be the author, got '%s'", signer)
+	}
+	if _, found := local.Signer("commit2"); found {
+		t.Fatal("expected no signer for an unknown commit")
+	}
+
+	rejected := errors.New("rejected")
+	local.AddCommitCheck(func(commit string, signer string) error {
+		if signer == author.GetID() {
+			return rejected
+		}
+		return nil
+	})
+	if err := local.Verify("commit1", sig, author.PublicKey()); !errors.Is(err, rejected) {
+		t.Fatalf("expected the check to reject the commit, got %v", err)
+	}
+	if err := local.Verify("commit2", sig, author.PublicKey()); err == nil {
+		t.Fatal("expected a signature of another commit to be refused")
+	}
+}
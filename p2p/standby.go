@@ -0,0 +1,225 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+const (
+	defaultStandbyCheckInterval = 5 * time.Second
+	standbyCheckTimeout         = 2 * time.Second
+)
+
+// StandbyConfig pairs the node with a primary it mirrors and can take over
+type StandbyConfig struct {
+	// Primary is the peer ID of the primary node
+	Primary string
+	// CheckInterval is how often the primary is health-checked
+	CheckInterval time.Duration
+	// FailoverAfter is the number of consecutive failed health checks after
+	// which the standby promotes itself. 0 only allows manual promotion.
+	FailoverAfter int
+}
+
+// StandbyStatus describes the state of a standby node
+type StandbyStatus struct {
+	Primary  string
+	Promoted bool
+	// PromotedAt and Reason are set once the standby was promoted
+	PromotedAt time.Time
+	Reason     string
+	// InSync is true if the standby has the head of the primary. SyncedAt is
+	// the last time it had it.
+	InSync   bool
+	SyncedAt time.Time
+	// Failures is the number of consecutive failed health checks
+	Failures int
+}
+
+// Proto converts the status to its protobuf representation
+func (s StandbyStatus) Proto() *p2pproto.StandbyStatus {
+	res := &p2pproto.StandbyStatus{
+		Primary:  s.Primary,
+		Promoted: s.Promoted,
+		Reason:   s.Reason,
+		InSync:   s.InSync,
+		Failures: int32(s.Failures),
+	}
+	if !s.PromotedAt.IsZero() {
+		res.PromotedUnixMs = s.PromotedAt.UnixMilli()
+	}
+	if !s.SyncedAt.IsZero() {
+		res.SyncedUnixMs = s.SyncedAt.UnixMilli()
+	}
+	return res
+}
+
+// standby mirrors a primary: writes are forwarded to it and its head is
+// checked to be present locally. Once promoted, the node takes over the tables
+// owned by the primary and starts the external listeners registered with
+// OnPromote.
+type standby struct {
+	p2p *P2P
+	cfg StandbyConfig
+
+	mtx       sync.Mutex
+	status    StandbyStatus
+	onPromote []func()
+}
+
+// check records the result of a health check of the primary and returns true
+// if the standby should promote itself
+func (s *standby) check(healthy bool, inSync bool) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.status.Promoted {
+		return false
+	}
+	if !healthy {
+		s.status.Failures++
+		return s.cfg.FailoverAfter > 0 && s.status.Failures >= s.cfg.FailoverAfter
+	}
+	s.status.Failures = 0
+	s.status.InSync = inSync
+	if inSync {
+		s.status.SyncedAt = time.Now()
+	}
+	return false
+}
+
+func (s *standby) promoted() bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.status.Promoted
+}
+
+// promote marks the standby as promoted and returns the hooks to run
+func (s *standby) promote(reason string) ([]func(), error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.status.Promoted {
+		return nil, fmt.Errorf("standby was already promoted")
+	}
+	s.status.Promoted = true
+	s.status.PromotedAt = time.Now()
+	s.status.Reason = reason
+	hooks := s.onPromote
+	s.onPromote = nil
+	return hooks, nil
+}
+
+// healthCheck asks the primary for its head and checks that it is applied
+// locally
+func (s *standby) healthCheck() (healthy bool, inSync bool) {
+	c, found := s.p2p.clients.Get(s.cfg.Primary)
+	if !found {
+		return false, false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), standbyCheckTimeout)
+	defer cancel()
+	head, err := c.(*P2PClient).GetHead(ctx, &p2pproto.GetHeadRequest{})
+	if err != nil {
+		return false, false
+	}
+	local, err := s.p2p.externalDB.GetLastCommit("main")
+	if err != nil {
+		return true, false
+	}
+	if local.Hash == head.Commit {
+		return true, true
+	}
+	return true, s.p2p.waitForCommit(ctx, head.Commit) == nil
+}
+
+func (s *standby) monitor() func() error {
+	stopSignal := make(chan struct{})
+	go func() {
+		s.p2p.log.Infof("Starting standby of primary %s", s.cfg.Primary)
+		ticker := time.NewTicker(s.cfg.CheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if s.promoted() {
+					continue
+				}
+				if s.check(s.healthCheck()) {
+					err := s.p2p.Promote(fmt.Sprintf("primary failed %d consecutive health checks", s.cfg.FailoverAfter))
+					if err != nil {
+						s.p2p.log.Errorf("Automatic promotion failed: %v", err)
+					}
+				}
+			case <-stopSignal:
+				s.p2p.log.Info("Stopping standby monitor")
+				return
+			}
+		}
+	}()
+	stopper := func() error {
+		stopSignal <- struct{}{}
+		return nil
+	}
+	return stopper
+}
+
+// IsStandby returns true if the node is a standby that was not promoted yet
+func (p2p *P2P) IsStandby() bool {
+	return p2p.standby != nil && !p2p.standby.promoted()
+}
+
+// Standby returns the status of the standby. ok is false if the node is not a
+// standby.
+func (p2p *P2P) Standby() (status StandbyStatus, ok bool) {
+	if p2p.standby == nil {
+		return StandbyStatus{}, false
+	}
+	p2p.standby.mtx.Lock()
+	defer p2p.standby.mtx.Unlock()
+	return p2p.standby.status, true
+}
+
+// OnPromote registers a function called when the standby is promoted. It is
+// called immediately if the node is not a standby or was already promoted.
+func (p2p *P2P) OnPromote(fn func()) {
+	if p2p.standby != nil {
+		p2p.standby.mtx.Lock()
+		if !p2p.standby.status.Promoted {
+			p2p.standby.onPromote = append(p2p.standby.onPromote, fn)
+			p2p.standby.mtx.Unlock()
+			return
+		}
+		p2p.standby.mtx.Unlock()
+	}
+	fn()
+}
+
+// Promote makes the standby take over the role of the primary: it stops
+// forwarding writes, becomes the owner of the tables owned by the primary and
+// runs the OnPromote hooks.
+func (p2p *P2P) Promote(reason string) error {
+	if p2p.standby == nil {
+		return fmt.Errorf("node is not a standby")
+	}
+	hooks, err := p2p.standby.promote(reason)
+	if err != nil {
+		return err
+	}
+	p2p.log.Warnf("Promoted standby to primary, taking over from %s: %s", p2p.standby.cfg.Primary, reason)
+	for _, hook := range hooks {
+		hook()
+	}
+	return nil
+}
+
+// standbyOwner returns the effective owner of a table: tables owned by the
+// primary belong to the standby once it is promoted
+func (p2p *P2P) standbyOwner(owner string) string {
+	if p2p.standby != nil && owner == p2p.standby.cfg.Primary && p2p.standby.promoted() {
+		return p2p.GetID()
+	}
+	return owner
+}
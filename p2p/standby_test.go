@@ -0,0 +1,40 @@
+package p2p
+
+import "testing"
+
+func TestStandbyFailover(t *testing.T) {
+	s := &standby{cfg: StandbyConfig{Primary: "primary", FailoverAfter: 2}}
+
+	if s.check(false, false) {
+		t.Fatal("expected no promotion after a single failure")
+	}
+	if s.check(true, true) || s.status.Failures != 0 || !s.status.InSync {
+		t.Fatalf("expected a healthy check to reset the failures, got %+v", s.status)
+	}
+	s.check(false, false)
+	if !s.check(false, false) {
+		t.Fatal("expected a promotion after two consecutive failures")
+	}
+
+	promoted := 0
+	s.onPromote = append(s.onPromote, func() { promoted++ })
+	hooks, err := s.promote("test")
+	if err != nil || len(hooks) != 1 {
+		t.Fatalf("unexpected promotion result %v, %v", hooks, err)
+	}
+	if _, err := s.promote("test"); err == nil {
+		t.Error("expected a second promotion to fail")
+	}
+	if s.check(false, false) {
+		t.Error("expected no promotion once promoted")
+	}
+}
+
+func TestStandbyManualOnly(t *testing.T) {
+	s := &standby{cfg: StandbyConfig{Primary: "primary"}}
+	for i := 0; i < 10; i++ {
+		if s.check(false, false) {
+			t.Fatal("expected no automatic promotion without FailoverAfter")
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package p2p
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"golang.org/x/time/rate"
+)
+
+const (
+	lagReportInterval = 5 * time.Second
+	// lagReportTTL is how long a lag report is honored. Peers that stop
+	// reporting, e.g. because they disconnected, don't slow writers forever.
+	lagReportTTL     = 3 * lagReportInterval
+	lagReportTimeout = 2 * time.Second
+	backpressurePoll = 100 * time.Millisecond
+)
+
+type lagReport struct {
+	behind int64
+	at     time.Time
+}
+
+// throttle bounds the rate of local commits and slows them down while peers
+// report being too far behind
+type throttle struct {
+	// limiter is nil if the commit rate is not limited
+	limiter *rate.Limiter
+	// maxLag is the lag above which commits wait for peers to catch up. 0
+	// ignores the lag reports.
+	maxLag   int64
+	maxDelay time.Duration
+
+	mtx       sync.Mutex
+	lags      map[string]lagReport
+	throttled atomic.Int64
+}
+
+func newThrottle() *throttle {
+	return &throttle{lags: map[string]lagReport{}}
+}
+
+func (t *throttle) record(peerID string, behind int64, now time.Time) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if behind <= 0 {
+		delete(t.lags, peerID)
+		return
+	}
+	t.lags[peerID] = lagReport{behind: behind, at: now}
+}
+
+// maxReportedLag returns the largest lag reported by a peer within the TTL
+func (t *throttle) maxReportedLag(now time.Time) int64 {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	max := int64(0)
+	for id, report := range t.lags {
+		if now.Sub(report.at) > lagReportTTL {
+			delete(t.lags, id)
+			continue
+		}
+		if report.behind > max {
+			max = report.behind
+		}
+	}
+	return max
+}
+
+// wait blocks until the commit is allowed by the rate limit and no peer is
+// more than maxLag commits behind, or until maxDelay passed
+func (t *throttle) wait(ctx context.Context) error {
+	waited := false
+	if t.limiter != nil {
+		if t.limiter.Tokens() < 1 {
+			waited = true
+		}
+		if err := t.limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	if t.maxLag > 0 {
+		deadline := time.Now().Add(t.maxDelay)
+		for t.maxReportedLag(time.Now()) > t.maxLag && time.Now().Before(deadline) {
+			waited = true
+			select {
+			case <-time.After(backpressurePoll):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	if waited {
+		t.throttled.Add(1)
+	}
+	return nil
+}
+
+// RecordLag implements p2psrv.LagRecorder
+func (p2p *P2P) RecordLag(peerID string, behind int64) {
+	p2p.throttle.record(peerID, behind, time.Now())
+}
+
+// ThrottledCommits returns the number of commits delayed by the commit rate
+// limit or by lagging peers
+func (p2p *P2P) ThrottledCommits() int64 {
+	return p2p.throttle.throttled.Load()
+}
+
+// reportLag periodically tells peers how many commits we are behind, based on
+// the sync progress. A lag of 0 is only sent once after catching up.
+func (p2p *P2P) reportLag() func() error {
+	stopSignal := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(lagReportInterval)
+		defer ticker.Stop()
+		last := int64(0)
+		for {
+			select {
+			case <-ticker.C:
+				behind := int64(p2p.SyncProgress().Missing())
+				if behind == 0 && last == 0 {
+					continue
+				}
+				last = behind
+				for _, client := range p2p.GetClients() {
+					if !client.Supports(p2pproto.Tester_ReportLag_FullMethodName) {
+						continue
+					}
+					ctx, cancel := context.WithTimeout(context.Background(), lagReportTimeout)
+					_, err := client.ReportLag(ctx, &p2pproto.ReportLagRequest{Behind: behind})
+					cancel()
+					if err != nil {
+						p2p.log.Debugf("Failed to report lag to '%s': %v", client.GetID(), err)
+					}
+				}
+			case <-stopSignal:
+				return
+			}
+		}
+	}()
+	stopper := func() error {
+		stopSignal <- struct{}{}
+		return nil
+	}
+	return stopper
+}
@@ -0,0 +1,55 @@
+package p2p
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestThrottleLagReports(t *testing.T) {
+	th := newThrottle()
+	now := time.Now()
+	th.record("a", 5, now)
+	th.record("b", 20, now.Add(-2*lagReportTTL))
+	th.record("c", 8, now)
+
+	if lag := th.maxReportedLag(now); lag != 8 {
+		t.Errorf("expected stale reports to be ignored, got a lag of %d", lag)
+	}
+	th.record("c", 0, now)
+	if lag := th.maxReportedLag(now); lag != 5 {
+		t.Errorf("expected caught up peers to be forgotten, got a lag of %d", lag)
+	}
+}
+
+func TestThrottleBackpressure(t *testing.T) {
+	th := newThrottle()
+	th.maxLag = 10
+	th.maxDelay = 300 * time.Millisecond
+
+	if err := th.wait(context.Background()); err != nil || th.throttled.Load() != 0 {
+		t.Fatalf("expected no delay without lagging peers, got %v", err)
+	}
+
+	th.record("a", 50, time.Now())
+	start := time.Now()
+	if err := th.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) < th.maxDelay || th.throttled.Load() != 1 {
+		t.Errorf("expected the commit to wait for the lagging peer")
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		th.record("a", 0, time.Now())
+	}()
+	th.maxDelay = 5 * time.Second
+	start = time.Now()
+	if err := th.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("expected the commit to proceed once the peer caught up")
+	}
+}
@@ -0,0 +1,170 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+	ma "github.com/multiformats/go-multiaddr"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+const linkPingTimeout = 2 * time.Second
+
+// Link is a connection between two peers
+type Link struct {
+	Peer string `json:"peer"`
+	// RTT is zero if the latency of the link is unknown
+	RTT       time.Duration `json:"rtt_ns"`
+	Transport string        `json:"transport"`
+	Addr      string        `json:"addr"`
+}
+
+// Node is a peer and the links it reported
+type Node struct {
+	ID    string `json:"id"`
+	Links []Link `json:"links"`
+}
+
+// Topology is the part of the mesh known to a node: its own links and the
+// links reported by its peers
+type Topology struct {
+	Nodes     []Node    `json:"nodes"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Links pings all the connected peers and returns the links to them
+func (p2p *P2P) Links(ctx context.Context) []Link {
+	links := []Link{}
+	for _, conn := range p2p.host.Network().Conns() {
+		id := conn.RemotePeer()
+		link := Link{
+			Peer:      id.String(),
+			Transport: transportName(conn.RemoteMultiaddr()),
+			Addr:      conn.RemoteMultiaddr().String(),
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, linkPingTimeout)
+		select {
+		case res := <-ping.Ping(pingCtx, p2p.host, id):
+			if res.Error == nil {
+				link.RTT = res.RTT
+			}
+		case <-pingCtx.Done():
+		}
+		cancel()
+		if link.RTT == 0 {
+			link.RTT = p2p.host.Peerstore().LatencyEWMA(id)
+		}
+
+		links = append(links, link)
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].Peer < links[j].Peer
+	})
+	return links
+}
+
+// Topology gathers the links of this node and of all its peers
+func (p2p *P2P) Topology(ctx context.Context) Topology {
+	topology := Topology{
+		Nodes:     []Node{{ID: p2p.GetID(), Links: p2p.Links(ctx)}},
+		UpdatedAt: time.Now(),
+	}
+	for _, client := range p2p.GetClients() {
+		if !client.Supports(p2pproto.Admin_GetLinks_FullMethodName) {
+			continue
+		}
+		reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		resp, err := client.GetLinks(reqCtx, &p2pproto.GetLinksRequest{})
+		cancel()
+		if err != nil {
+			p2p.log.Debugf("Failed to retrieve links of '%s': %v", client.GetID(), err)
+			continue
+		}
+		node := Node{ID: resp.PeerId}
+		for _, link := range resp.Links {
+			node.Links = append(node.Links, LinkFromProto(link))
+		}
+		topology.Nodes = append(topology.Nodes, node)
+	}
+	return topology
+}
+
+// transportName returns the name of the last protocol of an address, e.g.
+// quic-v1
+func transportName(addr ma.Multiaddr) string {
+	protocols := addr.Protocols()
+	if len(protocols) == 0 {
+		return ""
+	}
+	return protocols[len(protocols)-1].Name
+}
+
+// Proto converts the link to its protobuf representation
+func (l Link) Proto() *p2pproto.Link {
+	return &p2pproto.Link{PeerId: l.Peer, RttUs: l.RTT.Microseconds(), Transport: l.Transport, Addr: l.Addr}
+}
+
+// LinkFromProto converts a protobuf link
+func LinkFromProto(l *p2pproto.Link) Link {
+	return Link{Peer: l.PeerId, RTT: time.Duration(l.RttUs) * time.Microsecond, Transport: l.Transport, Addr: l.Addr}
+}
+
+// shortID returns the last characters of a peer ID, which are enough to tell
+// peers apart in a graph
+func shortID(id string) string {
+	if len(id) <= 8 {
+		return id
+	}
+	return id[len(id)-8:]
+}
+
+// DOT renders the topology as a Graphviz graph. Links reported by both peers
+// are drawn once.
+func (t Topology) DOT() string {
+	var b strings.Builder
+	b.WriteString("graph mesh {\n")
+
+	nodes := map[string]bool{}
+	for _, node := range t.Nodes {
+		nodes[node.ID] = true
+		for _, link := range node.Links {
+			nodes[link.Peer] = true
+		}
+	}
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Fprintf(&b, "  %q [label=%q];\n", id, shortID(id))
+	}
+
+	drawn := map[string]bool{}
+	for _, node := range t.Nodes {
+		for _, link := range node.Links {
+			a, z := node.ID, link.Peer
+			if z < a {
+				a, z = z, a
+			}
+			if drawn[a+z] {
+				continue
+			}
+			drawn[a+z] = true
+
+			label := link.Transport
+			if link.RTT > 0 {
+				label += " " + link.RTT.Round(time.Microsecond).String()
+			}
+			fmt.Fprintf(&b, "  %q -- %q [label=%q];\n", a, z, strings.TrimSpace(label))
+		}
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,35 @@
+package p2p
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestTransportName(t *testing.T) {
+	if name := transportName(ma.StringCast("/ip4/127.0.0.1/udp/10500/quic-v1")); name != "quic-v1" {
+		t.Errorf("expected quic-v1, got %s", name)
+	}
+}
+
+func TestTopologyDOT(t *testing.T) {
+	topology := Topology{Nodes: []Node{
+		{ID: "peerA", Links: []Link{{Peer: "peerB", RTT: 1500 * time.Microsecond, Transport: "quic-v1"}}},
+		{ID: "peerB", Links: []Link{{Peer: "peerA", Transport: "quic-v1"}, {Peer: "peerC", Transport: "quic-v1"}}},
+	}}
+
+	dot := topology.DOT()
+	if !strings.HasPrefix(dot, "graph mesh {") {
+		t.Errorf("expected a graph, got %s", dot)
+	}
+	if strings.Count(dot, "--") != 2 {
+		t.Errorf("expected links reported by both peers to be drawn once, got %s", dot)
+	}
+	for _, expected := range []string{`"peerC" [label="peerC"]`, `"peerA" -- "peerB" [label="quic-v1 1.5ms"]`} {
+		if !strings.Contains(dot, expected) {
+			t.Errorf("expected %s in %s", expected, dot)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package p2p
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	p2pgrpc "github.com/birros/go-libp2p-grpc"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"google.golang.org/grpc"
+)
+
+const (
+	// ProtocolVersion is the version of the RPC protocol and of the gRPC
+	// services implemented by this node
+	ProtocolVersion = "0.1.0"
+	// legacyVersion is assumed for peers that don't advertise a version
+	legacyVersion  = "0.0.1"
+	protocolPrefix = "/protos/rpc/"
+)
+
+// supportedProtocols lists the RPC protocols we speak, in order of preference.
+// The previous version is still served so that mixed version clusters keep
+// working during a rolling upgrade.
+var supportedProtocols = []protocol.ID{
+	protocol.ID(protocolPrefix + ProtocolVersion),
+	protocol.ID(protocolPrefix + legacyVersion),
+}
+
+// RPCProtocols returns the libp2p protocols the gRPC services are served on,
+// in order of preference
+func RPCProtocols() []protocol.ID {
+	return append([]protocol.ID{}, supportedProtocols...)
+}
+
+// methodVersions records the version that introduced each RPC. Methods that
+// are not listed are available in every version.
+var methodVersions = map[string]string{
+	p2pproto.Tester_AckCommit_FullMethodName:         "0.1.0",
+	p2pproto.Tester_CompareCommits_FullMethodName:    "0.1.0",
+	p2pproto.Tester_Query_FullMethodName:             "0.1.0",
+	p2pproto.Tester_CallProcedure_FullMethodName:     "0.1.0",
+	p2pproto.Tester_StreamCommits_FullMethodName:     "0.1.0",
+	p2pproto.Tester_ReportLag_FullMethodName:         "0.1.0",
+	p2pproto.Tester_TableStats_FullMethodName:        "0.1.0",
+	p2pproto.Tester_Explain_FullMethodName:           "0.1.0",
+	p2pproto.Tester_RunNamedQuery_FullMethodName:     "0.1.0",
+	p2pproto.Tester_Missed_FullMethodName:            "0.1.0",
+	p2pproto.Election_Elect_FullMethodName:           "0.1.0",
+	p2pproto.Election_Coordinator_FullMethodName:     "0.1.0",
+	p2pproto.Commits_Subscribe_FullMethodName:        "0.1.0",
+	p2pproto.Channels_Invite_FullMethodName:          "0.1.0",
+	p2pproto.Channels_Deliver_FullMethodName:         "0.1.0",
+	p2pproto.Admin_QueryMetrics_FullMethodName:       "0.1.0",
+	p2pproto.Admin_GetSyncProgress_FullMethodName:    "0.1.0",
+	p2pproto.Admin_ListQuarantine_FullMethodName:     "0.1.0",
+	p2pproto.Admin_ApproveQuarantined_FullMethodName: "0.1.0",
+	p2pproto.Admin_PurgeQuarantined_FullMethodName:   "0.1.0",
+	p2pproto.Admin_ListMembers_FullMethodName:        "0.1.0",
+	p2pproto.Admin_AddMember_FullMethodName:          "0.1.0",
+	p2pproto.Admin_RetireMember_FullMethodName:       "0.1.0",
+	p2pproto.Admin_RemoveMember_FullMethodName:       "0.1.0",
+	p2pproto.Admin_ListConflicts_FullMethodName:      "0.1.0",
+	p2pproto.Admin_ResolveConflict_FullMethodName:    "0.1.0",
+	p2pproto.Admin_GetStandby_FullMethodName:         "0.1.0",
+	p2pproto.Admin_Promote_FullMethodName:            "0.1.0",
+	p2pproto.Leases_Acquire_FullMethodName:           "0.1.0",
+	p2pproto.Leases_Renew_FullMethodName:             "0.1.0",
+	p2pproto.Leases_Release_FullMethodName:           "0.1.0",
+	p2pproto.Leases_Grant_FullMethodName:             "0.1.0",
+	p2pproto.Leases_Revoke_FullMethodName:            "0.1.0",
+	p2pproto.Sessions_Open_FullMethodName:            "0.1.0",
+	p2pproto.Sessions_Execute_FullMethodName:         "0.1.0",
+	p2pproto.Sessions_Close_FullMethodName:           "0.1.0",
+	p2pproto.Drain_NotifyDrain_FullMethodName:        "0.1.0",
+	p2pproto.Admin_SetDraining_FullMethodName:        "0.1.0",
+	p2pproto.Admin_GetDrainStatus_FullMethodName:     "0.1.0",
+	p2pproto.Admin_Restart_FullMethodName:            "0.1.0",
+	p2pproto.Admin_TraceCommit_FullMethodName:        "0.1.0",
+	p2pproto.Admin_DeployPlugin_FullMethodName:       "0.1.0",
+	p2pproto.Admin_RemovePlugin_FullMethodName:       "0.1.0",
+	p2pproto.Admin_ListPlugins_FullMethodName:        "0.1.0",
+	p2pproto.Admin_SetProtoDump_FullMethodName:       "0.1.0",
+	p2pproto.Admin_GetProtoDump_FullMethodName:       "0.1.0",
+	p2pproto.Admin_ApproveCommit_FullMethodName:      "0.1.0",
+	p2pproto.Admin_ListApprovals_FullMethodName:      "0.1.0",
+	p2pproto.Approvals_SubmitApproval_FullMethodName: "0.1.0",
+	p2pproto.Trace_GetCommitTrace_FullMethodName:     "0.1.0",
+	p2pproto.Blobs_PutBlob_FullMethodName:            "0.1.0",
+	p2pproto.Blobs_GetBlob_FullMethodName:            "0.1.0",
+	p2pproto.Blobs_StatBlob_FullMethodName:           "0.1.0",
+	p2pproto.Blobs_PinBlob_FullMethodName:            "0.1.0",
+	p2pproto.Blobs_UnpinBlob_FullMethodName:          "0.1.0",
+	p2pproto.Plugins_PublishPlugin_FullMethodName:    "0.1.0",
+}
+
+// PeerVersion holds the versions negotiated with a peer
+type PeerVersion struct {
+	// Protocol is the version of the libp2p stream protocol
+	Protocol string
+	// API is the version of the gRPC services
+	API string
+}
+
+type version [3]int
+
+func parseVersion(s string) (version, error) {
+	v := version{}
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("invalid version '%s'", s)
+	}
+	for i, part := range parts {
+		nr, err := strconv.Atoi(part)
+		if err != nil || nr < 0 {
+			return v, fmt.Errorf("invalid version '%s'", s)
+		}
+		v[i] = nr
+	}
+	return v, nil
+}
+
+func (v version) compare(other version) int {
+	for i := range v {
+		if v[i] != other[i] {
+			if v[i] < other[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// negotiateVersion returns the version used to talk to a peer: the lowest of
+// the two, as long as both versions are at most one minor version apart.
+func negotiateVersion(local string, remote string) (string, error) {
+	if remote == "" {
+		remote = legacyVersion
+	}
+	lv, err := parseVersion(local)
+	if err != nil {
+		return "", err
+	}
+	rv, err := parseVersion(remote)
+	if err != nil {
+		return "", err
+	}
+
+	minorDiff := lv[1] - rv[1]
+	if minorDiff < 0 {
+		minorDiff = -minorDiff
+	}
+	if lv[0] != rv[0] || minorDiff > 1 {
+		return "", fmt.Errorf("version %s is not compatible with %s", remote, local)
+	}
+
+	if lv.compare(rv) <= 0 {
+		return local, nil
+	}
+	return remote, nil
+}
+
+// supports returns true if the method is available in the given API version
+func supports(apiVersion string, method string) bool {
+	introduced, found := methodVersions[method]
+	if !found {
+		return true
+	}
+	av, err := parseVersion(apiVersion)
+	if err != nil {
+		return false
+	}
+	iv, err := parseVersion(introduced)
+	if err != nil {
+		return false
+	}
+	return av.compare(iv) >= 0
+}
+
+// Supports returns true if the peer implements the method
+func (c *P2PClient) Supports(method string) bool {
+	return supports(c.apiVersion, method)
+}
+
+// Version returns the API version negotiated with the peer
+func (c *P2PClient) Version() string {
+	return c.apiVersion
+}
+
+// peerVersions keeps track of the versions negotiated with every peer
+type peerVersions struct {
+	mtx      sync.RWMutex
+	versions map[string]PeerVersion
+}
+
+func (pv *peerVersions) setProtocol(id string, proto protocol.ID) {
+	pv.mtx.Lock()
+	defer pv.mtx.Unlock()
+	v := pv.versions[id]
+	v.Protocol = strings.TrimPrefix(string(proto), protocolPrefix)
+	pv.versions[id] = v
+}
+
+func (pv *peerVersions) setAPI(id string, api string) {
+	pv.mtx.Lock()
+	defer pv.mtx.Unlock()
+	v := pv.versions[id]
+	v.API = api
+	pv.versions[id] = v
+}
+
+func (pv *peerVersions) peers() []string {
+	pv.mtx.RLock()
+	defer pv.mtx.RUnlock()
+	ids := make([]string, 0, len(pv.versions))
+	for id := range pv.versions {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (pv *peerVersions) remove(id string) {
+	pv.mtx.Lock()
+	defer pv.mtx.Unlock()
+	delete(pv.versions, id)
+}
+
+// PeerVersions returns the versions negotiated with every connected peer
+func (p2p *P2P) PeerVersions() map[string]PeerVersion {
+	p2p.versions.mtx.RLock()
+	defer p2p.versions.mtx.RUnlock()
+	versions := make(map[string]PeerVersion, len(p2p.versions.versions))
+	for id, v := range p2p.versions.versions {
+		versions[id] = v
+	}
+	return versions
+}
+
+// versionedDialer opens gRPC connections over a libp2p stream, negotiating the
+// most preferred RPC protocol offered to the peer that it supports
+func (p2p *P2P) versionedDialer() grpc.DialOption {
+	return grpc.WithContextDialer(func(ctx context.Context, peerIDStr string) (net.Conn, error) {
+		peerID, err := peer.Decode(peerIDStr)
+		if err != nil {
+			return nil, err
+		}
+		if p2p.host.Network().Connectedness(peerID) != network.Connected {
+			return nil, errors.New("not connected to peer")
+		}
+
+		stream, err := p2p.host.NewStream(ctx, peerID, p2p.protocols.dialProtocols(peerIDStr)...)
+		if err != nil {
+			return nil, err
+		}
+		p2p.versions.setProtocol(peerIDStr, stream.Protocol())
+		return &p2pgrpc.Conn{Stream: stream}, nil
+	})
+}
@@ -0,0 +1,50 @@
+package p2p
+
+import (
+	"testing"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	cases := []struct {
+		local, remote, expected string
+		fail                    bool
+	}{
+		{"0.1.0", "0.1.0", "0.1.0", false},
+		{"0.1.0", "", "0.0.1", false},
+		{"0.1.0", "0.0.1", "0.0.1", false},
+		{"0.1.0", "0.2.3", "0.1.0", false},
+		{"0.1.0", "0.3.0", "", true},
+		{"0.1.0", "1.1.0", "", true},
+		{"0.1.0", "abc", "", true},
+	}
+	for _, c := range cases {
+		negotiated, err := negotiateVersion(c.local, c.remote)
+		if c.fail {
+			if err == nil {
+				t.Errorf("expected %s and %s to be incompatible", c.local, c.remote)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unexpected error negotiating %s and %s: %v", c.local, c.remote, err)
+			continue
+		}
+		if negotiated != c.expected {
+			t.Errorf("expected %s when negotiating %s and %s, got %s", c.expected, c.local, c.remote, negotiated)
+		}
+	}
+}
+
+func TestSupports(t *testing.T) {
+	if !supports(legacyVersion, p2pproto.Pinger_Ping_FullMethodName) {
+		t.Error("expected legacy peers to support Ping")
+	}
+	if supports(legacyVersion, p2pproto.Tester_AckCommit_FullMethodName) {
+		t.Error("expected legacy peers to not support AckCommit")
+	}
+	if !supports(ProtocolVersion, p2pproto.Tester_AckCommit_FullMethodName) {
+		t.Error("expected current peers to support AckCommit")
+	}
+}
@@ -0,0 +1,201 @@
+package p2p
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	swarmproto "github.com/nustiueudinastea/doltswarm/proto"
+	"google.golang.org/grpc"
+)
+
+const zoneRelayTimeout = 5 * time.Minute
+
+// Zone locates a node in a zone of a region
+type Zone struct {
+	Region string `json:"region"`
+	Zone   string `json:"zone"`
+}
+
+// IsZero returns true for nodes that are not labeled
+func (z Zone) IsZero() bool {
+	return z.Region == "" && z.Zone == ""
+}
+
+func (z Zone) String() string {
+	return z.Region + "/" + z.Zone
+}
+
+// Peer tiers, from the closest to the farthest
+const (
+	tierZone = iota
+	tierRegion
+	tierRemote
+)
+
+// tier returns how far a node in zone other is from a node in zone z.
+// Unlabeled nodes are treated as close to every node.
+func (z Zone) tier(other Zone) int {
+	switch {
+	case z.IsZero() || other.IsZero() || z == other:
+		return tierZone
+	case z.Region == other.Region:
+		return tierRegion
+	default:
+		return tierRemote
+	}
+}
+
+// ZoneStats counts how the heads announced by peers in other zones were
+// transferred
+type ZoneStats struct {
+	Zone Zone `json:"zone"`
+	// Peers are the zones of the connected peers
+	Peers map[string]Zone `json:"peers"`
+	// Relayed heads were pulled from another zone by this node and announced
+	// to its group
+	Relayed int64 `json:"relayed"`
+	// InZone heads were delivered by a closer peer
+	InZone int64 `json:"in_zone"`
+	// FellBack heads were pulled from another zone after waiting for a closer
+	// peer
+	FellBack int64 `json:"fell_back"`
+}
+
+// zonePolicy limits the transfers between zones: the heads announced by a
+// farther peer are pulled by a single node of the group of closer peers, the
+// relay, and announced to the group, which pulls them from the relay
+type zonePolicy struct {
+	zone Zone
+	// delay is how long the other nodes of the group wait for the relay
+	// before pulling from the farther peer themselves
+	delay time.Duration
+
+	relayed  atomic.Int64
+	inZone   atomic.Int64
+	fellBack atomic.Int64
+}
+
+// zone returns the zone of the node, which is zero if it isn't labeled
+func (p2p *P2P) zone() Zone {
+	if p2p.zones == nil {
+		return Zone{}
+	}
+	return p2p.zones.zone
+}
+
+// ZoneStats returns the zone transfers of the node
+func (p2p *P2P) ZoneStats() ZoneStats {
+	stats := ZoneStats{Peers: p2p.peerZones()}
+	if p2p.zones == nil {
+		return stats
+	}
+	stats.Zone = p2p.zones.zone
+	stats.Relayed = p2p.zones.relayed.Load()
+	stats.InZone = p2p.zones.inZone.Load()
+	stats.FellBack = p2p.zones.fellBack.Load()
+	return stats
+}
+
+// Zone returns the zone advertised by the peer
+func (c *P2PClient) Zone() Zone {
+	return c.zone
+}
+
+// zoneGroup returns the IDs of the labeled peers closer to zone than the
+// tier, sorted
+func zoneGroup(zone Zone, peers map[string]Zone, tier int) []string {
+	group := []string{}
+	for id, peerZone := range peers {
+		if !peerZone.IsZero() && zone.tier(peerZone) < tier {
+			group = append(group, id)
+		}
+	}
+	sort.Strings(group)
+	return group
+}
+
+// isZoneRelay returns true if the node pulls the heads announced by peers of
+// the tier for its group, which is the case of the node with the lowest ID
+func isZoneRelay(self string, group []string) bool {
+	return len(group) == 0 || self < group[0]
+}
+
+func (p2p *P2P) peerZones() map[string]Zone {
+	peers := map[string]Zone{}
+	for _, client := range p2p.GetClients() {
+		peers[client.GetID()] = client.zone
+	}
+	return peers
+}
+
+// peerTier returns the tier of a connected peer
+func (p2p *P2P) peerTier(peerID string) int {
+	c, found := p2p.clients.Get(peerID)
+	if !found {
+		return tierZone
+	}
+	return p2p.zones.zone.tier(c.(*P2PClient).zone)
+}
+
+// zoneInterceptor lets the relay of the group pull the heads announced by
+// farther peers. The other nodes acknowledge the announcement and wait for the
+// relay to deliver the head, or pull it themselves if it doesn't in time.
+func (p2p *P2P) zoneInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	advertise, ok := req.(*swarmproto.AdvertiseHeadRequest)
+	if !ok {
+		return handler(ctx, req)
+	}
+	tier := p2p.peerTier(remotePeerID(ctx))
+	if tier == tierZone {
+		return handler(ctx, req)
+	}
+
+	if isZoneRelay(p2p.GetID(), zoneGroup(p2p.zones.zone, p2p.peerZones(), tier)) {
+		resp, err := handler(ctx, req)
+		if err == nil {
+			go p2p.relayHead(advertise.Head, tier)
+		}
+		return resp, err
+	}
+
+	// the pull outlives the call of the announcing peer
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		waitCtx, cancel := context.WithTimeout(ctx, p2p.zones.delay)
+		err := p2p.waitForCommit(waitCtx, advertise.Head)
+		cancel()
+		if err == nil {
+			p2p.zones.inZone.Add(1)
+			return
+		}
+		p2p.zones.fellBack.Add(1)
+		p2p.log.Debugf("Head %s was not relayed within %s, pulling it from %s", advertise.Head, p2p.zones.delay, remotePeerID(ctx))
+		if _, err := handler(ctx, req); err != nil {
+			p2p.log.Warnf("Failed to pull head %s from %s: %v", advertise.Head, remotePeerID(ctx), err)
+		}
+	}()
+	return &swarmproto.AdvertiseHeadResponse{}, nil
+}
+
+// relayHead announces a head pulled from a farther peer to the group once it's
+// applied
+func (p2p *P2P) relayHead(head string, tier int) {
+	ctx, cancel := context.WithTimeout(context.Background(), zoneRelayTimeout)
+	defer cancel()
+	err := p2p.waitForCommit(ctx, head)
+	if err != nil {
+		p2p.log.Warnf("Head %s to relay was not applied: %v", head, err)
+		return
+	}
+	p2p.zones.relayed.Add(1)
+	for _, id := range zoneGroup(p2p.zones.zone, p2p.peerZones(), tier) {
+		announceCtx, cancel := context.WithTimeout(ctx, heldAnnouncementTimeout)
+		err := p2p.Announce(announceCtx, id, head)
+		cancel()
+		if err != nil {
+			p2p.log.Warnf("Failed to relay head %s to %s: %v", head, id, err)
+		}
+	}
+}
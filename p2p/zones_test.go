@@ -0,0 +1,41 @@
+package p2p
+
+import (
+	"testing"
+)
+
+func TestZoneGroups(t *testing.T) {
+	zone := Zone{Region: "eu", Zone: "eu-1"}
+	peers := map[string]Zone{
+		"a": {Region: "eu", Zone: "eu-1"},
+		"c": {Region: "eu", Zone: "eu-2"},
+		"d": {Region: "us", Zone: "us-1"},
+		"e": {},
+	}
+	if tier := zone.tier(peers["c"]); tier != tierRegion {
+		t.Errorf("expected zones of a region to be in the region tier, got %d", tier)
+	}
+	if tier := zone.tier(peers["e"]); tier != tierZone {
+		t.Errorf("expected unlabeled peers to be close, got %d", tier)
+	}
+
+	// heads from another zone are pulled by the lowest ID of the zone
+	group := zoneGroup(zone, peers, tierRegion)
+	if len(group) != 1 || group[0] != "a" {
+		t.Fatalf("unexpected zone group %v", group)
+	}
+	if !isZoneRelay("0", group) || isZoneRelay("b", group) {
+		t.Error("expected the lowest ID of the zone to relay")
+	}
+
+	// heads from another region by the lowest ID of the region
+	group = zoneGroup(zone, peers, tierRemote)
+	if len(group) != 2 || group[0] != "a" || group[1] != "c" {
+		t.Fatalf("unexpected region group %v", group)
+	}
+
+	// a node alone in its zone relays for itself
+	if !isZoneRelay("b", zoneGroup(Zone{Region: "ap", Zone: "ap-1"}, peers, tierRegion)) {
+		t.Error("expected a node alone in its zone to relay")
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dolthub/vitess/go/vt/sqlparser"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	p2psrv "github.com/nustiueudinastea/doltswarmdemo/p2p/server"
+	"github.com/nustiueudinastea/doltswarmdemo/plugins"
+	"github.com/nustiueudinastea/doltswarmdemo/sqlstmt"
+)
+
+const (
+	pluginsDir       = "plugins"
+	pluginCLITimeout = 30 * time.Second
+)
+
+var pluginRuntime *plugins.Runtime
+
+// openPluginRuntime loads the plugins deployed on the node that are signed by
+// a trusted admin key
+func openPluginRuntime(trusted plugins.TrustFunc) error {
+	var err error
+	pluginRuntime, err = plugins.Open(context.Background(), workDir+"/"+pluginsDir, log, trusted)
+	if err != nil {
+		return fmt.Errorf("failed to open plugins: %w", err)
+	}
+	return nil
+}
+
+// pluginDB wraps an ExternalDB and runs every write through the transform and
+// validate hooks of the plugins before it's committed
+type pluginDB struct {
+	p2psrv.ExternalDB
+
+	runtime *plugins.Runtime
+}
+
+func newPluginDB(db p2psrv.ExternalDB, runtime *plugins.Runtime) *pluginDB {
+	return &pluginDB{
+		ExternalDB: db,
+		runtime:    runtime,
+	}
+}
+
+// ExecAndCommit runs every statement of the query, like the writes of a batch,
+// through the plugins on its own, with the table it writes
+func (db *pluginDB) ExecAndCommit(query string, commitMsg string) (string, error) {
+	ctx := context.Background()
+	pieces, err := sqlparser.SplitStatementToPieces(query)
+	if err != nil {
+		return "", err
+	}
+	statements := []string{}
+	for _, piece := range pieces {
+		if strings.TrimSpace(piece) == "" {
+			continue
+		}
+		_, writes, err := sqlstmt.Access(piece)
+		if err != nil {
+			return "", err
+		}
+		if len(writes) > 1 {
+			return "", fmt.Errorf("plugins can only check statements writing a single table, not %s", strings.Join(writes, ", "))
+		}
+		w := plugins.Write{Statement: piece, Message: commitMsg}
+		if len(writes) == 1 {
+			w.Table = writes[0]
+		}
+		w, err = db.runtime.Transform(ctx, w)
+		if err != nil {
+			return "", err
+		}
+		err = db.runtime.Validate(ctx, w)
+		if err != nil {
+			return "", err
+		}
+		statements = append(statements, w.Statement)
+		commitMsg = w.Message
+	}
+	return db.ExternalDB.ExecAndCommit(strings.Join(statements, ";\n"), commitMsg)
+}
+
+// pluginPeers returns the connected peers that load published plugins
+func pluginPeers() []plugins.Peer {
+	peers := []plugins.Peer{}
+	for _, client := range p2pmgr.GetClients() {
+		if client.Supports(p2pproto.Plugins_PublishPlugin_FullMethodName) {
+			peers = append(peers, client)
+		}
+	}
+	return peers
+}
+
+// relayPlugin passes a version loaded from a peer on to the other peers, so
+// that it reaches the nodes that aren't connected to the deploying one. Peers
+// that already have it don't pass it on again.
+func relayPlugin(ctx context.Context, from string, plugin plugins.Plugin) {
+	peers := []plugins.Peer{}
+	for _, peer := range pluginPeers() {
+		if peer.GetID() != from {
+			peers = append(peers, peer)
+		}
+	}
+	go func() {
+		if err := plugins.Publish(ctx, peers, plugin); err != nil {
+			log.Warnf("Failed to relay plugin '%s' to every peer: %v", plugin.Name, err)
+		}
+	}()
+}
+
+// pluginDeployer deploys plugins through the admin API. Versions are signed
+// with the admin key of the node.
+type pluginDeployer struct {
+	runtime *plugins.Runtime
+	key     crypto.PrivKey
+}
+
+// DeployPlugin loads a new version of a plugin and publishes it to the peers.
+// Peers that miss it get it when they connect again.
+func (d pluginDeployer) DeployPlugin(ctx context.Context, name string, wasm []byte) (plugins.Plugin, error) {
+	plugin := plugins.New(name, wasm, d.runtime.NextVersion(name))
+	if err := plugin.Sign(d.key); err != nil {
+		return plugins.Plugin{}, err
+	}
+	if _, err := d.runtime.Apply(ctx, plugin); err != nil {
+		return plugins.Plugin{}, err
+	}
+	log.Infof("Deployed plugin '%s' (version %d, %s)", name, plugin.Version, plugin.Hash)
+	if err := plugins.Publish(ctx, pluginPeers(), plugin); err != nil {
+		log.Warnf("Failed to publish plugin '%s' to every peer: %v", name, err)
+	}
+	for _, loaded := range d.runtime.Plugins() {
+		if loaded.Name == name {
+			return loaded, nil
+		}
+	}
+	return plugin, nil
+}
+
+// RemovePlugin unloads a plugin and publishes the removal to the peers
+func (d pluginDeployer) RemovePlugin(ctx context.Context, name string) error {
+	found := false
+	for _, loaded := range d.runtime.Plugins() {
+		found = found || loaded.Name == name
+	}
+	if !found {
+		return fmt.Errorf("plugin '%s' not found", name)
+	}
+	removal := plugins.Removal(name, d.runtime.NextVersion(name))
+	if err := removal.Sign(d.key); err != nil {
+		return err
+	}
+	if _, err := d.runtime.Apply(ctx, removal); err != nil {
+		return err
+	}
+	log.Infof("Removed plugin '%s'", name)
+	if err := plugins.Publish(ctx, pluginPeers(), removal); err != nil {
+		log.Warnf("Failed to publish the removal of plugin '%s' to every peer: %v", name, err)
+	}
+	return nil
+}
+
+func (d pluginDeployer) Plugins() []plugins.Plugin {
+	return d.runtime.Plugins()
+}
+
+// startPluginDistribution publishes every plugin, and every removal, to the
+// peers that connect, so that peers that were away when a plugin was deployed
+// catch up. The most recent version wins on both sides.
+func startPluginDistribution() func() error {
+	events, cancel := p2pmgr.SubscribeEvents(p2p.EventPeerConnected)
+	crashReporter.Go("plugin-distribution", func() {
+		for ev := range events {
+			versions := pluginRuntime.Versions()
+			if len(versions) == 0 {
+				continue
+			}
+			for _, peer := range pluginPeers() {
+				if peer.GetID() != ev.PeerID {
+					continue
+				}
+				for _, plugin := range versions {
+					if err := plugins.Publish(context.Background(), []plugins.Peer{peer}, plugin); err != nil {
+						log.Warnf("Failed to publish plugin '%s': %v", plugin.Name, err)
+					}
+				}
+			}
+		}
+	})
+	return func() error {
+		cancel()
+		return nil
+	}
+}
+
+// checkPluginCommit runs the commits pulled from peers through the validate
+// hooks of the plugins, with their message and tables, and rejects the commits
+// a plugin rejects before they are applied. Commits signed by the node were
+// validated when they were written.
+func checkPluginCommit(commit string, signer string) error {
+	if signer == p2pKey.GetID() {
+		return nil
+	}
+	msg, tables, err := pulledCommit(commit)
+	if err != nil {
+		return err
+	}
+	if len(tables) == 0 {
+		tables = []string{""}
+	}
+	for _, table := range tables {
+		err := pluginRuntime.Validate(context.Background(), plugins.Write{Message: msg, Table: table, Commit: commit})
+		if err == nil {
+			continue
+		}
+		rejected := &plugins.RejectedError{}
+		if errors.As(err, &rejected) {
+			log.Warnf("Rejected commit '%s' from peer '%s': %s", commit, signer, rejected.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+// deployPlugin deploys the plugin in file through the node at addr
+func deployPlugin(addr string, name string, file string) error {
+	wasm, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	api, closer, err := adminClient(addr)
+	if err != nil {
+		return err
+	}
+	defer closer()
+	ctx, cancel := context.WithTimeout(context.Background(), pluginCLITimeout)
+	defer cancel()
+	info, err := api.DeployPlugin(ctx, &p2pproto.DeployPluginRequest{Name: name, Wasm: wasm})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Deployed plugin '%s' (%s) with hooks %s\n", info.Name, info.Hash, strings.Join(info.Hooks, ", "))
+	return nil
+}
+
+// removePlugin removes a plugin through the node at addr
+func removePlugin(addr string, name string) error {
+	api, closer, err := adminClient(addr)
+	if err != nil {
+		return err
+	}
+	defer closer()
+	ctx, cancel := context.WithTimeout(context.Background(), pluginCLITimeout)
+	defer cancel()
+	if _, err := api.RemovePlugin(ctx, &p2pproto.RemovePluginRequest{Name: name}); err != nil {
+		return err
+	}
+	fmt.Printf("Removed plugin '%s'\n", name)
+	return nil
+}
+
+// listPlugins prints the plugins loaded by the node at addr
+func listPlugins(addr string) error {
+	api, closer, err := adminClient(addr)
+	if err != nil {
+		return err
+	}
+	defer closer()
+	ctx, cancel := context.WithTimeout(context.Background(), pluginCLITimeout)
+	defer cancel()
+	res, err := api.ListPlugins(ctx, &p2pproto.ListPluginsRequest{})
+	if err != nil {
+		return err
+	}
+	if len(res.Plugins) == 0 {
+		fmt.Println("No plugins")
+		return nil
+	}
+	for _, info := range res.Plugins {
+		deployed := time.UnixMilli(info.DeployedUnixMs).Format(time.RFC3339)
+		fmt.Printf("%-20s v%-4d %s %8d bytes  %s  %s  %s\n", info.Name, info.Version, info.Hash[:12], info.Size, deployed, strings.Join(info.Hooks, ","), info.Signer)
+	}
+	return nil
+}
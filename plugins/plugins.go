@@ -0,0 +1,551 @@
+// Package plugins runs user-defined WebAssembly plugins that validate and
+// transform the writes of the node. Plugins are sandboxed: they run in a fresh
+// instance for every call, with WASI but no filesystem or network access, a
+// memory limit and a time limit.
+//
+// A plugin is a WASM module exporting its memory, an allocator and at least
+// one of the hooks:
+//
+//	alloc(size i32) i32
+//	validate(ptr i32, len i32) i64
+//	transform(ptr i32, len i32) i64
+//
+// The node allocates the input with alloc and writes the JSON of the Write to
+// it. Hooks return the location of their JSON output packed as ptr<<32 | len.
+// validate returns {"error": "reason"} to reject the write, or nothing to
+// accept it. transform returns the Write to commit instead, or nothing to keep
+// it unchanged. validate is also called for the commits synced from peers,
+// with their commit, message and table but without a statement.
+//
+// Every version of a plugin is signed by an admin key, and nodes only load
+// the versions signed by the admin keys they trust.
+package plugins
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"github.com/nustiueudinastea/doltswarmdemo/sqlstmt"
+	"github.com/sirupsen/logrus"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Hooks exported by plugins
+const (
+	HookValidate  = "validate"
+	HookTransform = "transform"
+)
+
+const (
+	manifestFile = "plugins.json"
+	callTimeout  = time.Second
+	// memoryLimitPages caps the memory of a plugin instance to 16MB
+	memoryLimitPages = 256
+)
+
+// Write is the payload handed to the hooks of plugins
+type Write struct {
+	Statement string `json:"statement"`
+	Message   string `json:"message"`
+	// Table targeted by the statement, if it can be determined
+	Table string `json:"table,omitempty"`
+	// Commit is only set for the commits synced from peers
+	Commit string `json:"commit,omitempty"`
+}
+
+// Plugin is a version of a plugin. Removed plugins are kept without their
+// code, so that the removal wins over the versions deployed before it.
+type Plugin struct {
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+	// Version is assigned by the node deploying the plugin, one more than the
+	// version it had, and covered by the signature
+	Version  int64     `json:"version"`
+	Deployed time.Time `json:"deployed"`
+	Removed  bool      `json:"removed,omitempty"`
+	Wasm     []byte    `json:"wasm,omitempty"`
+	Hooks    []string  `json:"hooks,omitempty"`
+	// Signer is the peer ID of the admin key that signed the version
+	Signer    string `json:"signer"`
+	Signature []byte `json:"signature"`
+}
+
+// newer returns true if the version p replaces the version other
+func (p Plugin) newer(other Plugin) bool {
+	if p.Version != other.Version {
+		return p.Version > other.Version
+	}
+	// concurrent deployments are ordered by their code, so that every node
+	// picks the same one
+	return p.Hash > other.Hash
+}
+
+// signed returns the fields covered by the signature
+func (p Plugin) signed() []byte {
+	return []byte(fmt.Sprintf("doltswarm-plugin\n%s\n%d\n%s\n%t", p.Name, p.Version, p.Hash, p.Removed))
+}
+
+// Sign signs the version with an admin key
+func (p *Plugin) Sign(key crypto.PrivKey) error {
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	signature, err := key.Sign(p.signed())
+	if err != nil {
+		return err
+	}
+	p.Signer = id.String()
+	p.Signature = signature
+	return nil
+}
+
+// verify checks the signature of the version against the key of its signer
+func (p Plugin) verify() error {
+	id, err := peer.Decode(p.Signer)
+	if err != nil {
+		return fmt.Errorf("plugin '%s' has an invalid signer: %w", p.Name, err)
+	}
+	pubKey, err := id.ExtractPublicKey()
+	if err != nil {
+		return fmt.Errorf("plugin '%s' has an invalid signer: %w", p.Name, err)
+	}
+	valid, err := pubKey.Verify(p.signed(), p.Signature)
+	if err != nil || !valid {
+		return fmt.Errorf("plugin '%s' has an invalid signature", p.Name)
+	}
+	return nil
+}
+
+// Proto returns the plugin as published to peers
+func (p Plugin) Proto() *p2pproto.Plugin {
+	return &p2pproto.Plugin{Name: p.Name, Wasm: p.Wasm, Hash: p.Hash, DeployedUnixMs: p.Deployed.UnixMilli(), Removed: p.Removed, Version: p.Version, Signer: p.Signer, Signature: p.Signature}
+}
+
+// Info describes the plugin without its code
+func (p Plugin) Info() *p2pproto.PluginInfo {
+	return &p2pproto.PluginInfo{Name: p.Name, Hash: p.Hash, Size: int64(len(p.Wasm)), DeployedUnixMs: p.Deployed.UnixMilli(), Hooks: p.Hooks, Version: p.Version, Signer: p.Signer}
+}
+
+// FromProto returns a plugin published by a peer
+func FromProto(p *p2pproto.Plugin) Plugin {
+	return Plugin{Name: p.Name, Wasm: p.Wasm, Hash: p.Hash, Deployed: time.UnixMilli(p.DeployedUnixMs), Removed: p.Removed, Version: p.Version, Signer: p.Signer, Signature: p.Signature}
+}
+
+// RejectedError is returned when a plugin rejects a write
+type RejectedError struct {
+	Plugin string
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("rejected by plugin '%s': %s", e.Plugin, e.Reason)
+}
+
+// GRPCStatus makes rejections reach remote callers as FailedPrecondition, so
+// that rejected writes of peers are quarantined
+func (e *RejectedError) GRPCStatus() *status.Status {
+	return status.New(codes.FailedPrecondition, e.Error())
+}
+
+type loaded struct {
+	plugin   Plugin
+	compiled wazero.CompiledModule
+
+	// inUse is held by the calls running the plugin, so that a replaced
+	// version is only closed once they are done
+	inUse  sync.RWMutex
+	closed bool
+}
+
+// close releases the compiled plugin once its calls are done
+func (l *loaded) close(ctx context.Context) {
+	l.inUse.Lock()
+	defer l.inUse.Unlock()
+	l.closed = true
+	l.compiled.Close(ctx)
+}
+
+// TrustFunc returns true if plugins signed by the key of the peer ID are
+// loaded, e.g. for the admin keys of the cluster
+type TrustFunc func(signer string) bool
+
+// Runtime holds the plugins of the node, compiled and ready to run. Plugins
+// are persisted in its directory, so that they survive restarts. Only the
+// plugins signed by a trusted key are loaded.
+type Runtime struct {
+	dir     string
+	runtime wazero.Runtime
+	log     *logrus.Logger
+	trusted TrustFunc
+
+	mtx      sync.RWMutex
+	versions map[string]Plugin
+	loaded   map[string]*loaded
+}
+
+// Open creates the runtime and loads the plugins persisted in dir that are
+// signed by a trusted key
+func Open(ctx context.Context, dir string, logger *logrus.Logger, trusted TrustFunc) (*Runtime, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	cfg := wazero.NewRuntimeConfig().WithMemoryLimitPages(memoryLimitPages).WithCloseOnContextDone(true)
+	r := &Runtime{
+		dir:      dir,
+		runtime:  wazero.NewRuntimeWithConfig(ctx, cfg),
+		log:      logger,
+		trusted:  trusted,
+		versions: map[string]Plugin{},
+		loaded:   map[string]*loaded{},
+	}
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r.runtime); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	plugins := []Plugin{}
+	if err := json.Unmarshal(data, &plugins); err != nil {
+		return nil, fmt.Errorf("failed to parse plugins: %w", err)
+	}
+	for _, plugin := range plugins {
+		if err := r.checkSigner(plugin); err != nil {
+			logger.Errorf("Ignoring plugin '%s': %v", plugin.Name, err)
+			continue
+		}
+		r.versions[plugin.Name] = plugin
+		if plugin.Removed {
+			continue
+		}
+		compiled, _, err := r.compile(ctx, plugin.Wasm)
+		if err != nil {
+			logger.Errorf("Failed to load plugin '%s': %v", plugin.Name, err)
+			continue
+		}
+		r.loaded[plugin.Name] = &loaded{plugin: plugin, compiled: compiled}
+	}
+	return r, nil
+}
+
+// Close releases the compiled plugins
+func (r *Runtime) Close(ctx context.Context) error {
+	return r.runtime.Close(ctx)
+}
+
+// compile compiles a plugin and returns its hooks
+func (r *Runtime) compile(ctx context.Context, wasm []byte) (wazero.CompiledModule, []string, error) {
+	compiled, err := r.runtime.CompileModule(ctx, wasm)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid plugin: %w", err)
+	}
+	exports := compiled.ExportedFunctions()
+	if _, found := compiled.ExportedMemories()["memory"]; !found {
+		compiled.Close(ctx)
+		return nil, nil, fmt.Errorf("plugins have to export their memory")
+	}
+	if _, found := exports["alloc"]; !found {
+		compiled.Close(ctx)
+		return nil, nil, fmt.Errorf("plugins have to export alloc")
+	}
+	hooks := []string{}
+	for _, hook := range []string{HookTransform, HookValidate} {
+		if _, found := exports[hook]; found {
+			hooks = append(hooks, hook)
+		}
+	}
+	if len(hooks) == 0 {
+		compiled.Close(ctx)
+		return nil, nil, fmt.Errorf("plugins have to export validate or transform")
+	}
+	return compiled, hooks, nil
+}
+
+// checkSigner checks that the version is signed by a trusted key
+func (r *Runtime) checkSigner(plugin Plugin) error {
+	if err := plugin.verify(); err != nil {
+		return err
+	}
+	if r.trusted == nil || !r.trusted(plugin.Signer) {
+		return fmt.Errorf("plugin '%s' is signed by '%s', which is not an admin key", plugin.Name, plugin.Signer)
+	}
+	return nil
+}
+
+// NextVersion returns the version of the next deployment or removal of a
+// plugin
+func (r *Runtime) NextVersion(name string) int64 {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.versions[name].Version + 1
+}
+
+// New returns a version of a plugin, deployed now. It has to be signed
+// before it's applied.
+func New(name string, wasm []byte, version int64) Plugin {
+	hash := sha256.Sum256(wasm)
+	return Plugin{Name: name, Hash: hex.EncodeToString(hash[:]), Version: version, Deployed: time.Now(), Wasm: wasm}
+}
+
+// Removal returns the version of a plugin removing it. It has to be signed
+// before it's applied.
+func Removal(name string, version int64) Plugin {
+	return Plugin{Name: name, Version: version, Deployed: time.Now(), Removed: true}
+}
+
+// Apply loads a version of a plugin, unless the runtime has a newer one. It
+// returns false if the version was ignored. Versions that are not signed by a
+// trusted key are refused.
+func (r *Runtime) Apply(ctx context.Context, plugin Plugin) (bool, error) {
+	if plugin.Name == "" {
+		return false, fmt.Errorf("plugins need a name")
+	}
+	if plugin.Removed && (plugin.Hash != "" || len(plugin.Wasm) > 0) {
+		return false, fmt.Errorf("removal of plugin '%s' can't have code", plugin.Name)
+	}
+	if err := r.checkSigner(plugin); err != nil {
+		return false, err
+	}
+	var entry *loaded
+	if !plugin.Removed {
+		hash := sha256.Sum256(plugin.Wasm)
+		if hex.EncodeToString(hash[:]) != plugin.Hash {
+			return false, fmt.Errorf("hash of plugin '%s' doesn't match its code", plugin.Name)
+		}
+		compiled, hooks, err := r.compile(ctx, plugin.Wasm)
+		if err != nil {
+			return false, err
+		}
+		plugin.Hooks = hooks
+		entry = &loaded{plugin: plugin, compiled: compiled}
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if current, found := r.versions[plugin.Name]; found && !plugin.newer(current) {
+		if entry != nil {
+			entry.compiled.Close(ctx)
+		}
+		return false, nil
+	}
+	previous := r.loaded[plugin.Name]
+	r.versions[plugin.Name] = plugin
+	if entry != nil {
+		r.loaded[plugin.Name] = entry
+	} else {
+		delete(r.loaded, plugin.Name)
+	}
+	if previous != nil {
+		go previous.close(context.WithoutCancel(ctx))
+	}
+	return true, r.save()
+}
+
+// save persists the versions of the plugins. The lock must be held.
+func (r *Runtime) save() error {
+	plugins := make([]Plugin, 0, len(r.versions))
+	for _, plugin := range r.versions {
+		plugins = append(plugins, plugin)
+	}
+	sort.Slice(plugins, func(i, j int) bool {
+		return plugins[i].Name < plugins[j].Name
+	})
+	data, err := json.Marshal(plugins)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(r.dir, manifestFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(r.dir, manifestFile))
+}
+
+// Plugins returns the loaded plugins, sorted by name
+func (r *Runtime) Plugins() []Plugin {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	plugins := make([]Plugin, 0, len(r.loaded))
+	for _, entry := range r.loaded {
+		plugins = append(plugins, entry.plugin)
+	}
+	sort.Slice(plugins, func(i, j int) bool {
+		return plugins[i].Name < plugins[j].Name
+	})
+	return plugins
+}
+
+// Versions returns the latest version of every plugin, including the removed
+// ones, e.g. to publish them to a new peer
+func (r *Runtime) Versions() []Plugin {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	plugins := make([]Plugin, 0, len(r.versions))
+	for _, plugin := range r.versions {
+		plugins = append(plugins, plugin)
+	}
+	sort.Slice(plugins, func(i, j int) bool {
+		return plugins[i].Name < plugins[j].Name
+	})
+	return plugins
+}
+
+// withHook returns the loaded plugins exporting the hook, sorted by name
+func (r *Runtime) withHook(hook string) []*loaded {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	entries := []*loaded{}
+	for _, entry := range r.loaded {
+		for _, h := range entry.plugin.Hooks {
+			if h == hook {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].plugin.Name < entries[j].plugin.Name
+	})
+	return entries
+}
+
+// Transform runs the write through the transform hooks of the plugins, in the
+// order of their names
+func (r *Runtime) Transform(ctx context.Context, w Write) (Write, error) {
+	for _, entry := range r.withHook(HookTransform) {
+		out, err := r.call(ctx, entry, HookTransform, w)
+		if err != nil {
+			return Write{}, err
+		}
+		if len(out) == 0 {
+			continue
+		}
+		transformed := Write{}
+		if err := json.Unmarshal(out, &transformed); err != nil {
+			return Write{}, fmt.Errorf("plugin '%s' returned an invalid write: %w", entry.plugin.Name, err)
+		}
+		if err := checkTransformed(w, transformed); err != nil {
+			return Write{}, fmt.Errorf("plugin '%s' returned an invalid write: %w", entry.plugin.Name, err)
+		}
+		w = transformed
+	}
+	return w, nil
+}
+
+// checkTransformed only lets plugins rewrite a write into a single write of
+// the same table, so that a plugin can't turn writes into arbitrary SQL
+func checkTransformed(original Write, transformed Write) error {
+	kind, err := sqlstmt.Classify(transformed.Statement)
+	if err != nil {
+		return err
+	}
+	if kind != sqlstmt.Write {
+		return fmt.Errorf("statement is not an INSERT, REPLACE, UPDATE or DELETE")
+	}
+	_, writes, err := sqlstmt.Access(transformed.Statement)
+	if err != nil {
+		return err
+	}
+	table := strings.Join(writes, ", ")
+	if table != original.Table || transformed.Table != original.Table {
+		return fmt.Errorf("statement writes '%s' instead of '%s'", table, original.Table)
+	}
+	return nil
+}
+
+// Validate runs the validate hooks of the plugins. The first plugin rejecting
+// the write returns a RejectedError.
+func (r *Runtime) Validate(ctx context.Context, w Write) error {
+	for _, entry := range r.withHook(HookValidate) {
+		out, err := r.call(ctx, entry, HookValidate, w)
+		if err != nil {
+			return err
+		}
+		if len(out) == 0 {
+			continue
+		}
+		result := struct {
+			Error string `json:"error"`
+		}{}
+		if err := json.Unmarshal(out, &result); err != nil {
+			return fmt.Errorf("plugin '%s' returned an invalid result: %w", entry.plugin.Name, err)
+		}
+		if result.Error != "" {
+			return &RejectedError{Plugin: entry.plugin.Name, Reason: result.Error}
+		}
+	}
+	return nil
+}
+
+// call runs a hook of a plugin in a fresh instance
+func (r *Runtime) call(ctx context.Context, entry *loaded, hook string, w Write) ([]byte, error) {
+	input, err := json.Marshal(w)
+	if err != nil {
+		return nil, err
+	}
+	entry.inUse.RLock()
+	defer entry.inUse.RUnlock()
+	if entry.closed {
+		return nil, fmt.Errorf("plugin '%s' was replaced during the call", entry.plugin.Name)
+	}
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	cfg := wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize")
+	mod, err := r.runtime.InstantiateModule(ctx, entry.compiled, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start plugin '%s': %w", entry.plugin.Name, err)
+	}
+	defer mod.Close(context.Background())
+
+	out, err := invoke(ctx, mod, hook, input)
+	if err != nil {
+		return nil, fmt.Errorf("plugin '%s' failed: %w", entry.plugin.Name, err)
+	}
+	return out, nil
+}
+
+func invoke(ctx context.Context, mod api.Module, hook string, input []byte) ([]byte, error) {
+	res, err := mod.ExportedFunction("alloc").Call(ctx, uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	ptr := uint32(res[0])
+	if !mod.Memory().Write(ptr, input) {
+		return nil, fmt.Errorf("input of %d bytes out of memory at %d", len(input), ptr)
+	}
+	res, err = mod.ExportedFunction(hook).Call(ctx, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return nil, err
+	}
+	outPtr, outLen := uint32(res[0]>>32), uint32(res[0])
+	if outLen == 0 {
+		return nil, nil
+	}
+	out, ok := mod.Memory().Read(outPtr, outLen)
+	if !ok {
+		return nil, fmt.Errorf("output of %d bytes out of memory at %d", outLen, outPtr)
+	}
+	return append([]byte{}, out...), nil
+}
@@ -0,0 +1,206 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/sirupsen/logrus"
+)
+
+func uleb(n int) []byte {
+	out := []byte{}
+	for {
+		b := byte(n & 0x7f)
+		n >>= 7
+		if n == 0 {
+			return append(out, b)
+		}
+		out = append(out, b|0x80)
+	}
+}
+
+func section(id byte, content ...byte) []byte {
+	return append(append([]byte{id}, uleb(len(content))...), content...)
+}
+
+func name(s string) []byte {
+	return append(uleb(len(s)), s...)
+}
+
+func concat(parts ...[]byte) []byte {
+	out := []byte{}
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
+
+// testPlugin returns a plugin whose transform returns its input unchanged.
+// Its validate hook rejects every write with the given reason, or accepts
+// them if it's empty.
+func testPlugin(reason string) []byte {
+	result := []byte{}
+	if reason != "" {
+		result = []byte(`{"error":"` + reason + `"}`)
+	}
+	validate := concat([]byte{0x00, 0x42}, uleb(len(result)), []byte{0x0b})
+	// (i64(ptr) << 32) | i64(len)
+	transform := []byte{0x00, 0x20, 0x00, 0xad, 0x42, 0x20, 0x86, 0x20, 0x01, 0xad, 0x84, 0x0b}
+	alloc := []byte{0x00, 0x41, 0x80, 0x08, 0x0b}
+	return concat(
+		[]byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00},
+		section(1, 0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f, 0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7e),
+		section(3, 0x03, 0x00, 0x01, 0x01),
+		section(5, 0x01, 0x00, 0x01),
+		section(7, concat(
+			[]byte{0x04},
+			name("memory"), []byte{0x02, 0x00},
+			name("alloc"), []byte{0x00, 0x00},
+			name("validate"), []byte{0x00, 0x01},
+			name("transform"), []byte{0x00, 0x02},
+		)...),
+		section(10, concat(
+			[]byte{0x03},
+			uleb(len(alloc)), alloc,
+			uleb(len(validate)), validate,
+			uleb(len(transform)), transform,
+		)...),
+		section(11, concat([]byte{0x01, 0x00, 0x41, 0x00, 0x0b}, name(string(result)))...),
+	)
+}
+
+// signed returns the version signed with the key
+func signed(t *testing.T, plugin Plugin, key crypto.PrivKey) Plugin {
+	t.Helper()
+	if err := plugin.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	return plugin
+}
+
+func TestRuntime(t *testing.T) {
+	ctx := context.Background()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	admin, _, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminID, err := peer.IDFromPrivateKey(admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted := func(signer string) bool { return signer == adminID.String() }
+
+	dir := t.TempDir()
+	r, err := Open(ctx, dir, logger, trusted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close(ctx)
+
+	w := Write{Statement: "INSERT INTO testtable VALUES (1)", Message: "insert", Table: "testtable"}
+	if err := r.Validate(ctx, w); err != nil {
+		t.Fatalf("expected writes to be accepted without plugins, got %v", err)
+	}
+
+	if _, err := r.Apply(ctx, signed(t, New("broken", []byte("not wasm"), 1), admin)); err == nil {
+		t.Error("expected invalid plugins to be refused")
+	}
+	if _, err := r.Apply(ctx, New("strict", testPlugin("no writes"), 1)); err == nil {
+		t.Error("expected unsigned plugins to be refused")
+	}
+	if _, err := r.Apply(ctx, signed(t, New("strict", testPlugin("no writes"), 1), other)); err == nil {
+		t.Error("expected plugins signed by other keys to be refused")
+	}
+	tampered := signed(t, New("strict", testPlugin("no writes"), 1), admin)
+	tampered.Version = 100
+	if _, err := r.Apply(ctx, tampered); err == nil {
+		t.Error("expected a version changed after signing to be refused")
+	}
+
+	if version := r.NextVersion("strict"); version != 1 {
+		t.Fatalf("expected the first version to be 1, got %d", version)
+	}
+	strict := signed(t, New("strict", testPlugin("no writes"), 1), admin)
+	if applied, err := r.Apply(ctx, strict); !applied || err != nil {
+		t.Fatalf("expected the plugin to be loaded, got %t (%v)", applied, err)
+	}
+	rejected := &RejectedError{}
+	if err := r.Validate(ctx, w); !errors.As(err, &rejected) || rejected.Reason != "no writes" {
+		t.Fatalf("expected the write to be rejected, got %v", err)
+	}
+	transformed, err := r.Transform(ctx, w)
+	if err != nil || transformed != w {
+		t.Fatalf("expected the write to be unchanged, got %+v (%v)", transformed, err)
+	}
+
+	// older versions are ignored, newer ones replace the plugin
+	if applied, _ := r.Apply(ctx, signed(t, New("strict", testPlugin(""), 0), admin)); applied {
+		t.Error("expected the older version to be ignored")
+	}
+	lenient := signed(t, New("strict", testPlugin(""), r.NextVersion("strict")), admin)
+	if applied, err := r.Apply(ctx, lenient); !applied || err != nil {
+		t.Fatalf("expected the newer version to be loaded, got %t (%v)", applied, err)
+	}
+	if err := r.Validate(ctx, w); err != nil {
+		t.Fatalf("expected the write to be accepted, got %v", err)
+	}
+
+	// plugins are persisted, removals too
+	reopened, err := Open(ctx, dir, logger, trusted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close(ctx)
+	if plugins := reopened.Plugins(); len(plugins) != 1 || plugins[0].Hash != lenient.Hash {
+		t.Fatalf("expected the plugin to be reloaded, got %+v", plugins)
+	}
+	removal := signed(t, Removal("strict", reopened.NextVersion("strict")), admin)
+	if applied, err := reopened.Apply(ctx, removal); !applied || err != nil {
+		t.Fatalf("expected the plugin to be removed, got %t (%v)", applied, err)
+	}
+	if len(reopened.Plugins()) != 0 || len(reopened.Versions()) != 1 {
+		t.Errorf("expected only the removal to be kept, got %+v", reopened.Versions())
+	}
+	if applied, _ := reopened.Apply(ctx, lenient); applied {
+		t.Error("expected the removal to win over the version it replaced")
+	}
+
+	// plugins signed by keys that are no longer trusted aren't reloaded
+	untrusted, err := Open(ctx, dir, logger, func(string) bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer untrusted.Close(ctx)
+	if len(untrusted.Versions()) != 0 {
+		t.Errorf("expected the plugins of untrusted keys to be ignored, got %+v", untrusted.Versions())
+	}
+}
+
+func TestCheckTransformed(t *testing.T) {
+	w := Write{Statement: "INSERT INTO testtable VALUES (1)", Table: "testtable"}
+	valid := Write{Statement: "INSERT INTO testtable VALUES (2)", Table: "testtable"}
+	if err := checkTransformed(w, valid); err != nil {
+		t.Errorf("expected a write of the same table to be accepted, got %v", err)
+	}
+	for _, statement := range []string{
+		"",
+		"INSERT INTO other VALUES (1)",
+		"DROP TABLE testtable",
+		"INSERT INTO testtable VALUES (1); DROP TABLE other",
+		"SELECT DOLT_RESET('--hard')",
+	} {
+		if err := checkTransformed(w, Write{Statement: statement, Table: "testtable"}); err == nil {
+			t.Errorf("expected %q to be refused", statement)
+		}
+	}
+}
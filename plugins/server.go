@@ -0,0 +1,72 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	p2pgrpc "github.com/birros/go-libp2p-grpc"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Peer is a peer that plugins are published to
+type Peer interface {
+	GetID() string
+	PublishPlugin(ctx context.Context, in *p2pproto.Plugin, opts ...grpc.CallOption) (*p2pproto.PublishPluginResponse, error)
+}
+
+// RelayFunc passes a version loaded from a peer on to the other peers
+type RelayFunc func(ctx context.Context, from string, plugin Plugin)
+
+// Server implements the Plugins gRPC service, loading the plugins published
+// by peers. Only the versions signed by a trusted key are loaded, whoever
+// publishes them.
+type Server struct {
+	p2pproto.UnimplementedPluginsServer
+
+	Runtime *Runtime
+	// Relay is optional. Versions are not passed on if it's not set
+	Relay RelayFunc
+	Log   *logrus.Logger
+}
+
+func (s *Server) PublishPlugin(ctx context.Context, req *p2pproto.Plugin) (*p2pproto.PublishPluginResponse, error) {
+	plugin := FromProto(req)
+	applied, err := s.Runtime.Apply(ctx, plugin)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if !applied {
+		return &p2pproto.PublishPluginResponse{}, nil
+	}
+	if plugin.Removed {
+		s.Log.Infof("Removed plugin '%s' (version %d) signed by %s", plugin.Name, plugin.Version, plugin.Signer)
+	} else {
+		s.Log.Infof("Loaded plugin '%s' (version %d, %s) signed by %s", plugin.Name, plugin.Version, plugin.Hash, plugin.Signer)
+	}
+	if s.Relay != nil {
+		from := ""
+		if id, ok := p2pgrpc.RemotePeerFromContext(ctx); ok {
+			from = id.String()
+		}
+		s.Relay(context.WithoutCancel(ctx), from, plugin)
+	}
+	return &p2pproto.PublishPluginResponse{}, nil
+}
+
+// Publish sends a version of a plugin to peers. Peers that fail to load it are
+// reported in the returned error.
+func Publish(ctx context.Context, peers []Peer, plugin Plugin) error {
+	msg := plugin.Proto()
+	var err error
+	for _, peer := range peers {
+		if _, publishErr := peer.PublishPlugin(ctx, msg); publishErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to publish to '%s': %w", peer.GetID(), publishErr))
+		}
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// tuningProfile presets the flags sizing the queues, caches and concurrency of
+// a node. Flags set on the command line or in the environment override the
+// profile.
+type tuningProfile struct {
+	Description string
+	Flags       map[string]string
+}
+
+var tuningProfiles = map[string]tuningProfile{
+	"default": {
+		Description: "sized for servers and desktops, every flag keeps its default",
+	},
+	"small": {
+		Description: "sized for Raspberry Pi class devices with 512MB to 1GB of memory",
+		Flags: map[string]string{
+			"rpc-slots":         "4",
+			"max-msg-size":      "2097152",
+			"blob-cache-mb":     "64",
+			"metrics-retention": "1h",
+			"conn-low-water":    "16",
+			"conn-high-water":   "32",
+			"handler-queue":     "16",
+			"max-heap-mb":       "192",
+			"max-goroutines":    "2000",
+		},
+	},
+}
+
+func profileNames() []string {
+	names := []string{}
+	for name := range tuningProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyProfile sets the flags of a profile that weren't set explicitly
+func applyProfile(ctx *cli.Context, name string) error {
+	profile, found := tuningProfiles[name]
+	if !found {
+		return fmt.Errorf("unknown profile '%s', expected %s", name, strings.Join(profileNames(), ", "))
+	}
+	flags := []string{}
+	for flag := range profile.Flags {
+		flags = append(flags, flag)
+	}
+	sort.Strings(flags)
+	for _, flag := range flags {
+		if ctx.IsSet(flag) {
+			continue
+		}
+		if err := ctx.Set(flag, profile.Flags[flag]); err != nil {
+			return fmt.Errorf("failed to apply profile '%s' to flag '%s': %w", name, flag, err)
+		}
+	}
+	return nil
+}
+
+// printProfiles prints the flags set by every profile
+func printProfiles() {
+	for _, name := range profileNames() {
+		profile := tuningProfiles[name]
+		fmt.Printf("%s: %s\n", name, profile.Description)
+		flags := []string{}
+		for flag := range profile.Flags {
+			flags = append(flags, flag)
+		}
+		sort.Strings(flags)
+		for _, flag := range flags {
+			fmt.Printf("  --%s %s\n", flag, profile.Flags[flag])
+		}
+	}
+}
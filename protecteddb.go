@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/nustiueudinastea/doltswarmdemo/blobstore"
+	"github.com/nustiueudinastea/doltswarmdemo/membership"
+	"github.com/nustiueudinastea/doltswarmdemo/namedqueries"
+	p2psrv "github.com/nustiueudinastea/doltswarmdemo/p2p/server"
+	"github.com/nustiueudinastea/doltswarmdemo/sqlstmt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// managedTables are the tables the node manages itself: the named queries and
+// the members of the cluster, which are only changed through the admin API, and
+// the blob references, which are only added through the blobs API
+var managedTables = []string{namedqueries.Table, membership.Table, blobstore.Table}
+
+// protectedDB wraps an ExternalDB and refuses the writes touching the tables
+// the node manages itself, which peers can only change through the APIs that
+// manage them
+type protectedDB struct {
+	p2psrv.ExternalDB
+
+	tables []string
+}
+
+func newProtectedDB(db p2psrv.ExternalDB, tables ...string) *protectedDB {
+	return &protectedDB{
+		ExternalDB: db,
+		tables:     tables,
+	}
+}
+
+func (db *protectedDB) ExecAndCommit(query string, commitMsg string) (string, error) {
+	if table, found := db.touches(query); found {
+		return "", status.Errorf(codes.PermissionDenied, "table '%s' is managed by the node and can't be written directly", table)
+	}
+	return db.ExternalDB.ExecAndCommit(query, commitMsg)
+}
+
+// touches returns the first protected table referenced by the query. Queries
+// that can't be parsed touch the protected tables they mention.
+func (db *protectedDB) touches(query string) (string, bool) {
+	tables, err := sqlstmt.Tables(query)
+	if err != nil {
+		lower := strings.ToLower(query)
+		for _, table := range db.tables {
+			if strings.Contains(lower, table) {
+				return table, true
+			}
+		}
+		return "", false
+	}
+	for _, table := range tables {
+		for _, protected := range db.tables {
+			if table == protected {
+				return table, true
+			}
+		}
+	}
+	return "", false
+}
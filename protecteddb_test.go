@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nustiueudinastea/doltswarm"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	p2psrv "github.com/nustiueudinastea/doltswarmdemo/p2p/server"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// committingDB commits every write
+type committingDB struct {
+	p2psrv.ExternalDB
+
+	writes []string
+}
+
+func (db *committingDB) GetAllCommits() ([]doltswarm.Commit, error) {
+	return []doltswarm.Commit{}, nil
+}
+
+func (db *committingDB) ExecAndCommit(query string, commitMsg string) (string, error) {
+	db.writes = append(db.writes, query)
+	return "commit", nil
+}
+
+func TestProtectedTables(t *testing.T) {
+	db := &committingDB{}
+	srv := &p2psrv.Server{DB: newProtectedDB(db, managedTables...)}
+	statements := []string{
+		"UPDATE swarm_members SET removed = 1",
+		"DELETE FROM swarm_members",
+		"INSERT INTO swarm_members (peer_id) VALUES ('peer')",
+		"DELETE FROM Swarm_Members",
+		"DELETE FROM swarm_named_queries",
+		"INSERT INTO doltswarm_blobs (hash, size, created_at) VALUES ('h', 1, NOW())",
+		"INSERT INTO other SELECT * FROM swarm_members WHERE",
+	}
+	for _, statement := range statements {
+		_, err := srv.ExecSQL(context.Background(), &p2pproto.ExecSQLRequest{Statement: statement})
+		if status.Code(err) != codes.PermissionDenied {
+			t.Errorf("expected '%s' to be refused, got %v", statement, err)
+		}
+	}
+	if len(db.writes) != 0 {
+		t.Fatalf("expected no write to be committed, got %v", db.writes)
+	}
+
+	if _, err := srv.ExecSQL(context.Background(), &p2pproto.ExecSQLRequest{Statement: "INSERT INTO other VALUES (1)"}); err != nil {
+		t.Errorf("expected writes to other tables to be committed, got %v", err)
+	}
+}
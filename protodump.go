@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/p2p/middleware"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+const protoDumpCLITimeout = 30 * time.Second
+
+// protoDumper records the messages exchanged with the peers while the
+// protocol dump is on
+var protoDumper *middleware.Dumper
+
+// setProtoDump turns the protocol dump of the node at addr on or off
+func setProtoDump(addr string, enabled bool) error {
+	api, closer, err := adminClient(addr)
+	if err != nil {
+		return err
+	}
+	defer closer()
+	ctx, cancel := context.WithTimeout(context.Background(), protoDumpCLITimeout)
+	defer cancel()
+	status, err := api.SetProtoDump(ctx, &p2pproto.SetProtoDumpRequest{Enabled: enabled})
+	if err != nil {
+		return err
+	}
+	printProtoDumpStatus(status)
+	return nil
+}
+
+// showProtoDump prints the messages most recently dumped by the node at addr
+func showProtoDump(addr string, limit int) error {
+	api, closer, err := adminClient(addr)
+	if err != nil {
+		return err
+	}
+	defer closer()
+	ctx, cancel := context.WithTimeout(context.Background(), protoDumpCLITimeout)
+	defer cancel()
+	res, err := api.GetProtoDump(ctx, &p2pproto.GetProtoDumpRequest{Limit: int32(limit)})
+	if err != nil {
+		return err
+	}
+	for _, entry := range res.Entries {
+		truncated := ""
+		if entry.Truncated {
+			truncated = " (truncated)"
+		}
+		fmt.Printf("%s %-3s %-8s %s %s %d bytes%s\n  %s\n", time.UnixMilli(entry.TimeUnixMs).Format("15:04:05.000"), entry.Direction, entry.Kind, entry.Peer, entry.Method, entry.Size, truncated, entry.Message)
+	}
+	printProtoDumpStatus(res.Status)
+	return nil
+}
+
+func printProtoDumpStatus(status *p2pproto.ProtoDumpStatus) {
+	state := "off"
+	if status.Enabled {
+		state = "on"
+	}
+	fmt.Printf("Protocol dump is %s: %d messages recorded, %d dropped by the rate limit", state, status.Recorded, status.Dropped)
+	if status.File != "" {
+		fmt.Printf(", written to %s", status.File)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	p2psrv "github.com/nustiueudinastea/doltswarmdemo/p2p/server"
+	"github.com/nustiueudinastea/doltswarmdemo/quarantine"
+	"github.com/nustiueudinastea/doltswarmdemo/sqlstmt"
+)
+
+var quarantineStore *quarantine.Store
+
+// alertQuarantined is called for every new quarantine entry
+func alertQuarantined(entry quarantine.Entry) {
+	alertQuarantinedEntry(entry)
+	if entry.MergeInto != "" {
+		log.Warnf("Commit '%s' on branch '%s' from peer '%s' is waiting for review to be merged into '%s' (%s)", entry.Commit, entry.Branch, entry.Peer, entry.MergeInto, entry.ID)
+		return
+	}
+	if entry.Commit != "" {
+		log.Warnf("Quarantined commit '%s' from peer '%s' (%s): %s", entry.Commit, entry.Peer, entry.ID, entry.Reason)
+		return
+	}
+	log.Warnf("Quarantined write from peer '%s' (%s): %s", entry.Peer, entry.ID, entry.Reason)
+}
+
+// quarantiner keeps the writes rejected by the p2p server
+type quarantiner struct {
+	store *quarantine.Store
+}
+
+func (q *quarantiner) Quarantine(peerID string, statement string, msg string, reason error) {
+	entry := quarantine.Entry{Peer: peerID, Reason: reason.Error(), Statement: statement, Message: msg}
+	if _, writes, err := sqlstmt.Access(statement); err == nil && len(writes) > 0 {
+		entry.Tables = writes
+	}
+	_, err := q.store.Add(entry)
+	if err != nil {
+		log.Errorf("Failed to quarantine write from peer '%s': %s", peerID, err.Error())
+	}
+}
+
+// quarantineResolver commits approved writes to a database that skips
+// validation, merges approved commits and reverts purged commits
+type quarantineResolver struct {
+	db       p2psrv.ExternalDB
+	beginner txBeginner
+}
+
+func (r *quarantineResolver) Apply(entry quarantine.Entry) error {
+	if entry.MergeInto != "" {
+		return mergeCommit(r.beginner, entry.Commit, entry.MergeInto)
+	}
+	// synced commits are already part of the history
+	if entry.Statement == "" {
+		return nil
+	}
+	_, err := r.db.ExecAndCommit(entry.Statement, entry.Message)
+	return err
+}
+
+func (r *quarantineResolver) Discard(entry quarantine.Entry) error {
+	// rejected writes were never committed, and reviewed commits were never
+	// merged
+	if entry.Commit == "" || entry.MergeInto != "" {
+		return nil
+	}
+	rows, err := r.db.Query("CALL DOLT_REVERT(?);", entry.Commit)
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
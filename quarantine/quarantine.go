@@ -0,0 +1,168 @@
+package quarantine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/segmentio/ksuid"
+)
+
+// Entry is a commit or write that was held back because it failed a check
+type Entry struct {
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	// Peer is the ID of the peer that sent the write or created the commit
+	Peer   string `json:"peer"`
+	Reason string `json:"reason"`
+	// Commit is set for commits that were synced from other peers
+	Commit string `json:"commit,omitempty"`
+	// Statement and Message are set for writes that were rejected before
+	// being committed
+	Statement string   `json:"statement,omitempty"`
+	Message   string   `json:"message,omitempty"`
+	Tables    []string `json:"tables,omitempty"`
+	// Branch is the branch of a synced commit. If MergeInto is set, the commit
+	// is waiting for approval to be merged into that branch.
+	Branch    string `json:"branch,omitempty"`
+	MergeInto string `json:"merge_into,omitempty"`
+}
+
+// Resolver applies or discards quarantined entries
+type Resolver interface {
+	// Apply commits a rejected write, merges a commit waiting for review, or
+	// accepts a synced commit
+	Apply(entry Entry) error
+	// Discard drops a rejected write or a commit waiting for review, or
+	// reverts a synced commit
+	Discard(entry Entry) error
+}
+
+// Store is a file backed queue of quarantined entries
+type Store struct {
+	mtx     sync.Mutex
+	path    string
+	entries map[string]Entry
+	alert   func(Entry)
+}
+
+// NewStore loads the quarantine stored at path, creating it if needed. The
+// alert function, if not nil, is called for every new entry.
+func NewStore(path string, alert func(Entry)) (*Store, error) {
+	s := &Store{
+		path:    path,
+		entries: map[string]Entry{},
+		alert:   alert,
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("failed to read quarantine: %w", err)
+	}
+
+	entries := []Entry{}
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse quarantine '%s': %w", path, err)
+	}
+	for _, entry := range entries {
+		s.entries[entry.ID] = entry
+	}
+	return s, nil
+}
+
+// Add quarantines an entry and returns it with its ID and time set
+func (s *Store) Add(entry Entry) (Entry, error) {
+	entry.ID = ksuid.New().String()
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+
+	s.mtx.Lock()
+	s.entries[entry.ID] = entry
+	err := s.save()
+	s.mtx.Unlock()
+	if err != nil {
+		return Entry{}, err
+	}
+
+	if s.alert != nil {
+		s.alert(entry)
+	}
+	return entry, nil
+}
+
+// List returns all the entries, oldest first
+func (s *Store) List() []Entry {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	entries := make([]Entry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+	return entries
+}
+
+// Len returns the number of quarantined entries
+func (s *Store) Len() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return len(s.entries)
+}
+
+// Approve applies an entry with the resolver and removes it from the quarantine
+func (s *Store) Approve(id string, resolver Resolver) (Entry, error) {
+	return s.resolve(id, resolver.Apply)
+}
+
+// Purge discards an entry with the resolver and removes it from the quarantine
+func (s *Store) Purge(id string, resolver Resolver) (Entry, error) {
+	return s.resolve(id, resolver.Discard)
+}
+
+// resolve holds the lock while the entry is resolved, so that it can't be
+// approved and purged at the same time
+func (s *Store) resolve(id string, fn func(Entry) error) (Entry, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	entry, found := s.entries[id]
+	if !found {
+		return Entry{}, fmt.Errorf("no quarantined entry with ID '%s'", id)
+	}
+	err := fn(entry)
+	if err != nil {
+		return Entry{}, err
+	}
+	delete(s.entries, id)
+	return entry, s.save()
+}
+
+// save writes the quarantine to disk. The caller must hold the lock.
+func (s *Store) save() error {
+	entries := make([]Entry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entries = append(entries, entry)
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode quarantine: %w", err)
+	}
+
+	tmpFile := s.path + ".tmp"
+	err = os.WriteFile(tmpFile, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write quarantine: %w", err)
+	}
+	return os.Rename(tmpFile, s.path)
+}
@@ -0,0 +1,69 @@
+package quarantine
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+type fakeResolver struct {
+	applied   []string
+	discarded []string
+	err       error
+}
+
+func (r *fakeResolver) Apply(entry Entry) error {
+	r.applied = append(r.applied, entry.ID)
+	return r.err
+}
+
+func (r *fakeResolver) Discard(entry Entry) error {
+	r.discarded = append(r.discarded, entry.ID)
+	return r.err
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quarantine.json")
+	alerts := 0
+	store, err := NewStore(path, func(Entry) { alerts++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := store.Add(Entry{Peer: "peerA", Reason: "denied", Statement: "INSERT INTO t VALUES (1)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := store.Add(Entry{Peer: "peerB", Reason: "denied", Commit: "abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alerts != 2 {
+		t.Errorf("expected 2 alerts, got %d", alerts)
+	}
+
+	resolver := &fakeResolver{err: errors.New("failed")}
+	if _, err := store.Approve(a.ID, resolver); err == nil {
+		t.Error("expected approve to fail")
+	}
+	if store.Len() != 2 {
+		t.Errorf("expected failed approvals to keep the entry")
+	}
+
+	resolver.err = nil
+	if _, err := store.Approve(a.ID, resolver); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Purge(a.ID, resolver); err == nil {
+		t.Error("expected purge of an approved entry to fail")
+	}
+
+	reloaded, err := NewStore(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := reloaded.List()
+	if len(entries) != 1 || entries[0].ID != b.ID || entries[0].Commit != "abc" {
+		t.Errorf("expected only %s after reload, got %v", b.ID, entries)
+	}
+}
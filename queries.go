@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/client"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+)
+
+const namedQueryCLITimeout = 30 * time.Second
+
+// listNamedQueries prints the named queries of the node at addr
+func listNamedQueries(addr string) error {
+	api, closer, err := adminClient(addr)
+	if err != nil {
+		return err
+	}
+	defer closer()
+	ctx, cancel := context.WithTimeout(context.Background(), namedQueryCLITimeout)
+	defer cancel()
+	res, err := api.ListNamedQueries(ctx, &p2pproto.ListNamedQueriesRequest{})
+	if err != nil {
+		return err
+	}
+	if len(res.Queries) == 0 {
+		fmt.Println("No named queries")
+	}
+	for _, q := range res.Queries {
+		printNamedQuery(q)
+	}
+	return nil
+}
+
+// defineNamedQuery creates or replaces a named query through the node at addr
+func defineNamedQuery(addr string, q *p2pproto.NamedQuery) error {
+	api, closer, err := adminClient(addr)
+	if err != nil {
+		return err
+	}
+	defer closer()
+	ctx, cancel := context.WithTimeout(context.Background(), namedQueryCLITimeout)
+	defer cancel()
+	defined, err := api.DefineNamedQuery(ctx, q)
+	if err != nil {
+		return err
+	}
+	printNamedQuery(defined)
+	return nil
+}
+
+// dropNamedQuery removes a named query through the node at addr
+func dropNamedQuery(addr string, name string) error {
+	api, closer, err := adminClient(addr)
+	if err != nil {
+		return err
+	}
+	defer closer()
+	ctx, cancel := context.WithTimeout(context.Background(), namedQueryCLITimeout)
+	defer cancel()
+	_, err = api.DropNamedQuery(ctx, &p2pproto.DropNamedQueryRequest{Name: name})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Dropped named query %s\n", name)
+	return nil
+}
+
+// runNamedQuery runs a named query on the node at addr with parameters given
+// as name=value, and prints its rows or its commit
+func runNamedQuery(addr string, name string, args []string, timeout time.Duration) error {
+	params := map[string]string{}
+	for _, arg := range args {
+		key, value, found := strings.Cut(arg, "=")
+		if !found {
+			return fmt.Errorf("invalid parameter '%s', expected name=value", arg)
+		}
+		params[key] = value
+	}
+
+	c, err := client.New()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	peer, err := c.Connect(addr)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	result, err := peer.RunNamedQuery(ctx, name, params, client.NamedQueryOptions{Timeout: timeout})
+	if err != nil {
+		return err
+	}
+
+	if result.Rows == nil {
+		fmt.Printf("Committed %s\n", result.Commit)
+		return nil
+	}
+	fmt.Println(strings.Join(result.Rows.Columns, "\t"))
+	for _, row := range result.Rows.Rows {
+		fmt.Println(strings.Join(row, "\t"))
+	}
+	return nil
+}
+
+func printNamedQuery(q *p2pproto.NamedQuery) {
+	kind := "write"
+	if q.ReadOnly {
+		kind = "read"
+	}
+	fmt.Printf("%s(%s) %s, updated %s\n", q.Name, strings.Join(q.Params, ", "), kind, time.UnixMilli(q.UpdatedUnixMs).UTC().Format(time.RFC3339))
+	if q.Description != "" {
+		fmt.Printf("  %s\n", q.Description)
+	}
+	fmt.Printf("  %s\n", q.Statement)
+}
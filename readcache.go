@@ -0,0 +1,28 @@
+package main
+
+import "github.com/nustiueudinastea/doltswarmdemo/feed"
+
+// startReadCacheInvalidator drops the cached remote reads whenever a commit
+// lands locally, since the heads of the peers are likely to change with it
+func startReadCacheInvalidator() func() error {
+	events, cancel := commitFeed.Subscribe(feed.Filter{})
+	stopSignal := make(chan struct{})
+	crashReporter.Go("read-cache-invalidator", func() {
+		for {
+			select {
+			case _, ok := <-events:
+				if !ok {
+					return
+				}
+				p2pmgr.InvalidateReadCache()
+			case <-stopSignal:
+				return
+			}
+		}
+	})
+	return func() error {
+		cancel()
+		close(stopSignal)
+		return nil
+	}
+}
@@ -0,0 +1,80 @@
+package recovery
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Querier runs the SQL checks on an open database
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// CheckDatabase checks that every branch resolves to a commit whose history
+// can be walked, which reads the refs and every commit of the commit graph.
+// Deep checks also read every row of every table at the head, and with them
+// every chunk of the current data.
+func CheckDatabase(ctx context.Context, db Querier, name string, deep bool) ([]Problem, error) {
+	problems := []Problem{}
+	unreadable := func(detail string, err error) {
+		problems = append(problems, Problem{Kind: Unreadable, Path: name, Detail: fmt.Sprintf("%s: %v", detail, err)})
+	}
+
+	branches, err := queryStrings(ctx, db, "SELECT name FROM dolt_branches;")
+	if err != nil {
+		unreadable("failed to read the branches", err)
+		return problems, nil
+	}
+	for _, branch := range branches {
+		if err := drain(ctx, db, fmt.Sprintf("SELECT commit_hash FROM dolt_log('%s');", strings.ReplaceAll(branch, "'", "''"))); err != nil {
+			unreadable(fmt.Sprintf("failed to walk the history of branch '%s'", branch), err)
+		}
+	}
+	if !deep || len(problems) > 0 {
+		return problems, nil
+	}
+
+	tables, err := queryStrings(ctx, db, "SHOW TABLES;")
+	if err != nil {
+		unreadable("failed to list the tables", err)
+		return problems, nil
+	}
+	for _, table := range tables {
+		if err := drain(ctx, db, "SELECT * FROM `"+strings.ReplaceAll(table, "`", "``")+"`;"); err != nil {
+			unreadable(fmt.Sprintf("failed to read table '%s'", table), err)
+		}
+	}
+	return problems, nil
+}
+
+// queryStrings returns the first column of every row of a query
+func queryStrings(ctx context.Context, db Querier, query string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	values := []string{}
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// drain reads every row of a query, discarding them
+func drain(ctx context.Context, db Querier, query string) error {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
@@ -0,0 +1,224 @@
+package recovery
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Layout of the files of a Dolt chunk store
+const (
+	manifestFile = "manifest"
+	// journalFile is the chunk journal, which holds the chunks written since
+	// the last table file was compacted
+	journalFile = "vvvvvvvvvvvvvvvvvvvvvvvvvvvvvvvv"
+	archiveExt  = ".darc"
+
+	tableNameLen = 32
+	tableMagic   = "\xff\xb5\xd8\xc2\x24\x63\xee\x50"
+	// tableFooterLen is the chunk count, the uncompressed size and the magic
+	tableFooterLen = 4 + 8 + len(tableMagic)
+
+	// journal records are the length, the tagged fields and a checksum
+	journalLenSize      = 4
+	journalChecksumSize = 4
+	// maxJournalRecord bounds the records read from a journal, far above the
+	// largest chunk
+	maxJournalRecord = 64 << 20
+)
+
+var journalCRC = crc32.MakeTable(crc32.Castagnoli)
+
+// tableSpec is a table file listed in the manifest
+type tableSpec struct {
+	name   string
+	chunks uint32
+}
+
+// parseManifest returns the table files listed in a manifest. Manifests are
+// colon separated: the version, the storage format, the lock, the root, the
+// garbage collection generation from version 5, and a name and chunk count per
+// table file.
+func parseManifest(data string) ([]tableSpec, error) {
+	fields := strings.Split(strings.TrimSpace(data), ":")
+	prefix := 0
+	switch fields[0] {
+	case "4":
+		prefix = 4
+	case "5":
+		prefix = 5
+	default:
+		return nil, fmt.Errorf("unknown manifest version '%s'", fields[0])
+	}
+	if len(fields) < prefix || (len(fields)-prefix)%2 != 0 {
+		return nil, fmt.Errorf("manifest has %d fields", len(fields))
+	}
+	specs := []tableSpec{}
+	for i := prefix; i < len(fields); i += 2 {
+		name := fields[i]
+		if len(name) != tableNameLen {
+			return nil, fmt.Errorf("invalid table file name '%s'", name)
+		}
+		chunks, err := strconv.ParseUint(fields[i+1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chunk count of table file %s: %w", name, err)
+		}
+		specs = append(specs, tableSpec{name: name, chunks: uint32(chunks)})
+	}
+	return specs, nil
+}
+
+// checkStore checks the manifest of a chunk store and every file it lists
+func checkStore(store string) ([]Problem, error) {
+	problems := []Problem{}
+	path := filepath.Join(store, manifestFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// a store without a manifest is empty, unless it has files
+		entries, err := os.ReadDir(store)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if len(entry.Name()) == tableNameLen {
+				problems = append(problems, Problem{Kind: BadManifest, Path: path, Detail: "the manifest is missing"})
+				break
+			}
+		}
+		return problems, nil
+	} else if err != nil {
+		return nil, err
+	}
+	specs, err := parseManifest(string(data))
+	if err != nil {
+		return append(problems, Problem{Kind: BadManifest, Path: path, Detail: err.Error()}), nil
+	}
+
+	for _, spec := range specs {
+		path := filepath.Join(store, spec.name)
+		var problem *Problem
+		switch {
+		case spec.name == journalFile:
+			problem, err = checkJournal(path)
+		case exists(path):
+			problem, err = checkTable(path, spec.chunks)
+		case exists(path + archiveExt):
+			problem, err = checkArchive(path + archiveExt)
+		default:
+			problem = &Problem{Kind: MissingFile, Path: path, Detail: "the table file listed in the manifest is missing"}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if problem != nil {
+			problems = append(problems, *problem)
+		}
+	}
+	return problems, nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// checkTable checks that a table file is complete: it ends with a footer
+// holding the chunk count listed in the manifest
+func checkTable(path string, chunks uint32) (*Problem, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < int64(tableFooterLen) {
+		return &Problem{Kind: TornTable, Path: path, Detail: fmt.Sprintf("the table file is only %d bytes", info.Size())}, nil
+	}
+	footer := make([]byte, tableFooterLen)
+	if _, err := f.ReadAt(footer, info.Size()-int64(tableFooterLen)); err != nil {
+		return nil, err
+	}
+	if string(footer[12:]) != tableMagic {
+		return &Problem{Kind: TornTable, Path: path, Detail: "the table file doesn't end with a footer"}, nil
+	}
+	if count := binary.BigEndian.Uint32(footer); count != chunks {
+		return &Problem{Kind: TornTable, Path: path, Detail: fmt.Sprintf("the table file has %d chunks, the manifest lists %d", count, chunks)}, nil
+	}
+	return nil, nil
+}
+
+// checkArchive checks that an archive isn't empty. Archives are only written
+// by compactions, which replace the table files once the archive is complete.
+func checkArchive(path string) (*Problem, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < int64(tableFooterLen) {
+		return &Problem{Kind: TornTable, Path: path, Detail: fmt.Sprintf("the archive is only %d bytes", info.Size())}, nil
+	}
+	return nil, nil
+}
+
+// checkJournal reads every record of a journal and returns a problem if it
+// ends with an incomplete or corrupted record
+func checkJournal(path string) (*Problem, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &Problem{Kind: MissingFile, Path: path, Detail: "the journal listed in the manifest is missing"}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(f)
+	offset := int64(0)
+	torn := func(detail string) *Problem {
+		return &Problem{Kind: TornJournal, Path: path, Offset: offset, Detail: fmt.Sprintf("%s at offset %d, %d bytes are lost", detail, offset, info.Size()-offset)}
+	}
+	for offset < info.Size() {
+		if info.Size()-offset < journalLenSize {
+			return torn("incomplete record length"), nil
+		}
+		header, err := r.Peek(journalLenSize)
+		if err != nil {
+			return nil, err
+		}
+		length := int64(binary.BigEndian.Uint32(header))
+		if length == 0 {
+			// crashes while the journal grows can leave its end zeroed
+			return torn("zeroed record"), nil
+		}
+		if length < journalLenSize+journalChecksumSize || length > maxJournalRecord {
+			return torn(fmt.Sprintf("invalid record length %d", length)), nil
+		}
+		if length > info.Size()-offset {
+			return torn("incomplete record"), nil
+		}
+		record := make([]byte, length)
+		if _, err := io.ReadFull(r, record); err != nil {
+			return nil, err
+		}
+		body := record[:length-journalChecksumSize]
+		if crc32.Checksum(body, journalCRC) != binary.BigEndian.Uint32(record[length-journalChecksumSize:]) {
+			return torn("corrupted record"), nil
+		}
+		offset += length
+	}
+	return nil, nil
+}
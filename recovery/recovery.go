@@ -0,0 +1,196 @@
+// Package recovery checks the integrity of the Dolt databases of a node at
+// startup, the equivalent of dolt fsck, and repairs them before the node
+// accepts traffic. The chunk store files are checked before the database is
+// opened: the manifest has to parse, every table file it lists has to exist
+// and be complete, and the chunk journal must not end with a torn record. The
+// refs and commit graph are then checked through SQL once the database is
+// open.
+//
+// Torn journal tails, left by crashes in the middle of a write, are truncated
+// to the last complete record, and the commits lost with them are fetched
+// again from peers by the regular sync. Any other damage can't be repaired in
+// place: the database is moved aside and fetched again from a peer.
+package recovery
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// damagedDir holds the damaged databases and torn journal tails moved out of
+// the storage, for inspection
+const damagedDir = ".damaged"
+
+// Kind classifies the problems found by the checks
+type Kind string
+
+const (
+	BadManifest Kind = "bad_manifest"
+	MissingFile Kind = "missing_file"
+	TornTable   Kind = "torn_table"
+	TornJournal Kind = "torn_journal"
+	Unreadable  Kind = "unreadable"
+)
+
+// Problem is a damage found by the checks
+type Problem struct {
+	Kind Kind `json:"kind"`
+	// Path is the damaged file, or the database for the SQL checks
+	Path   string `json:"path"`
+	Detail string `json:"detail"`
+	// Offset is where the torn tail of a journal starts
+	Offset int64 `json:"offset,omitempty"`
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s %s: %s", p.Kind, p.Path, p.Detail)
+}
+
+// Report is the outcome of the startup checks and repairs
+type Report struct {
+	Started   time.Time `json:"started"`
+	ElapsedMs int64     `json:"elapsed_ms"`
+	// Stores are the chunk stores that were checked
+	Stores   []string  `json:"stores"`
+	Problems []Problem `json:"problems"`
+	// Truncated are the journals whose torn tail was cut
+	Truncated []string `json:"truncated,omitempty"`
+	// Quarantined is where the damaged database was moved
+	Quarantined string `json:"quarantined,omitempty"`
+	// RefetchedFrom is the peer the database was fetched again from
+	RefetchedFrom string `json:"refetched_from,omitempty"`
+}
+
+// Damaged returns true if the checks found any problem
+func (r *Report) Damaged() bool {
+	return len(r.Problems) > 0
+}
+
+// NeedsRefetch returns true if the damage can't be repaired in place
+func (r *Report) NeedsRefetch() bool {
+	for _, p := range r.Problems {
+		if p.Kind != TornJournal {
+			return true
+		}
+	}
+	return false
+}
+
+// Stores returns the chunk stores of the databases kept in dir, or in its
+// subdirectories
+func Stores(dir string) ([]string, error) {
+	stores := []string{}
+	candidates := []string{dir}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			candidates = append(candidates, filepath.Join(dir, entry.Name()))
+		}
+	}
+	for _, candidate := range candidates {
+		noms := filepath.Join(candidate, ".dolt", "noms")
+		if info, err := os.Stat(noms); err == nil && info.IsDir() {
+			stores = append(stores, noms)
+		}
+	}
+	return stores, nil
+}
+
+// CheckFiles checks the chunk stores of the databases kept in dir. It has to
+// run before the databases are opened, since Dolt drops torn journal tails
+// silently when it opens them.
+func CheckFiles(dir string) (*Report, error) {
+	report := &Report{Started: time.Now(), Problems: []Problem{}}
+	stores, err := Stores(dir)
+	if err != nil {
+		return nil, err
+	}
+	report.Stores = stores
+	for _, store := range stores {
+		problems, err := checkStore(store)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check %s: %w", store, err)
+		}
+		report.Problems = append(report.Problems, problems...)
+	}
+	report.ElapsedMs = time.Since(report.Started).Milliseconds()
+	return report, nil
+}
+
+// TruncateJournals cuts the torn tails of the journals found by the checks.
+// Every tail is copied to the damaged directory of root before it's cut.
+func TruncateJournals(root string, report *Report) error {
+	for _, p := range report.Problems {
+		if p.Kind != TornJournal {
+			continue
+		}
+		if err := truncateJournal(root, p.Path, p.Offset); err != nil {
+			return fmt.Errorf("failed to truncate %s: %w", p.Path, err)
+		}
+		report.Truncated = append(report.Truncated, p.Path)
+	}
+	return nil
+}
+
+func truncateJournal(root string, path string, offset int64) error {
+	dest, err := damagedPath(damagedRun(root), root, path+".torn")
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if offset > int64(len(data)) {
+		return fmt.Errorf("offset %d is past the end of the journal", offset)
+	}
+	if err := os.WriteFile(dest, data[offset:], 0600); err != nil {
+		return err
+	}
+	return os.Truncate(path, offset)
+}
+
+// Quarantine moves the damaged databases out of root, so that they are
+// fetched again from a peer. It returns where they were moved.
+func Quarantine(root string, report *Report) (string, error) {
+	run := damagedRun(root)
+	for _, store := range report.Stores {
+		// the store is <database>/.dolt/noms and the whole .dolt directory
+		// goes, so that the database is no longer initialized
+		doltDir := filepath.Dir(store)
+		dest, err := damagedPath(run, root, doltDir)
+		if err != nil {
+			return "", err
+		}
+		if err := os.Rename(doltDir, dest); err != nil {
+			return "", fmt.Errorf("failed to move %s aside: %w", doltDir, err)
+		}
+	}
+	report.Quarantined = run
+	return run, nil
+}
+
+// damagedRun returns the directory of root holding what the current run moves
+// aside
+func damagedRun(root string) string {
+	return filepath.Join(root, damagedDir, time.Now().UTC().Format("20060102T150405Z"))
+}
+
+// damagedPath returns where a file of root is moved in the directory of a run
+func damagedPath(run string, root string, path string) (string, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%s is not in %s", path, root)
+	}
+	dest := filepath.Join(run, rel)
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
@@ -0,0 +1,146 @@
+package recovery
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testTable = "0123456789abcdefghijklmnopqrstuv"
+
+func tableFile(chunks uint32) []byte {
+	data := []byte("chunks and index")
+	footer := make([]byte, 12)
+	binary.BigEndian.PutUint32(footer, chunks)
+	return append(append(data, footer...), tableMagic...)
+}
+
+func journalRecord(payload string) []byte {
+	length := journalLenSize + len(payload) + journalChecksumSize
+	record := make([]byte, journalLenSize, length)
+	binary.BigEndian.PutUint32(record, uint32(length))
+	record = append(record, payload...)
+	return binary.BigEndian.AppendUint32(record, crc32.Checksum(record, journalCRC))
+}
+
+// testStore writes a chunk store with a table file and a journal
+func testStore(t *testing.T, root string, journal []byte) string {
+	store := filepath.Join(root, "db", ".dolt", "noms")
+	if err := os.MkdirAll(store, 0700); err != nil {
+		t.Fatal(err)
+	}
+	manifest := fmt.Sprintf("5:__DOLT__:lock:root:gen:%s:3:%s:2", testTable, journalFile)
+	files := map[string][]byte{
+		manifestFile: []byte(manifest),
+		testTable:    tableFile(3),
+		journalFile:  journal,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(store, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func TestCheckFiles(t *testing.T) {
+	root := t.TempDir()
+	journal := append(journalRecord("chunk 1"), journalRecord("root 1")...)
+	store := testStore(t, root, journal)
+
+	report, err := CheckFiles(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Stores) != 1 || report.Damaged() {
+		t.Fatalf("expected an intact store, got %+v", report)
+	}
+
+	// a crash in the middle of an append tears the last record
+	torn := append(append([]byte{}, journal...), journalRecord("chunk 2")[:6]...)
+	if err := os.WriteFile(filepath.Join(store, journalFile), torn, 0600); err != nil {
+		t.Fatal(err)
+	}
+	report, err = CheckFiles(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 1 || report.Problems[0].Kind != TornJournal || report.Problems[0].Offset != int64(len(journal)) {
+		t.Fatalf("expected a torn journal, got %+v", report.Problems)
+	}
+	if report.NeedsRefetch() {
+		t.Error("expected the torn journal to be repaired in place")
+	}
+	if err := TruncateJournals(root, report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Truncated) != 1 {
+		t.Errorf("expected the journal to be truncated, got %+v", report)
+	}
+	if report, _ := CheckFiles(root); report.Damaged() {
+		t.Errorf("expected the truncated store to be intact, got %+v", report.Problems)
+	}
+
+	// corrupted records are torn too
+	corrupted := append([]byte{}, journal...)
+	corrupted[6] ^= 0xff
+	if err := os.WriteFile(filepath.Join(store, journalFile), corrupted, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if report, _ := CheckFiles(root); len(report.Problems) != 1 || report.Problems[0].Offset != 0 {
+		t.Errorf("expected the first record to be corrupted, got %+v", report.Problems)
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	root := t.TempDir()
+	store := testStore(t, root, journalRecord("chunk 1"))
+	if err := os.WriteFile(filepath.Join(store, testTable), tableFile(3)[:10], 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := CheckFiles(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 1 || report.Problems[0].Kind != TornTable || !report.NeedsRefetch() {
+		t.Fatalf("expected a torn table file, got %+v", report.Problems)
+	}
+
+	moved, err := Quarantine(root, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(moved, "db", ".dolt", "noms", testTable)); err != nil {
+		t.Errorf("expected the damaged store to be kept: %v", err)
+	}
+	if stores, _ := Stores(root); len(stores) != 0 {
+		t.Errorf("expected the damaged store to be moved aside, got %v", stores)
+	}
+
+	if err := os.Remove(filepath.Join(moved, "db", ".dolt", "noms", testTable)); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := checkStore(filepath.Join(moved, "db", ".dolt", "noms"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Kind != MissingFile {
+		t.Errorf("expected a missing table file, got %+v", problems)
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	specs, err := parseManifest("4:__LD_1__:lock:root:" + testTable + ":12\n")
+	if err != nil || len(specs) != 1 || specs[0].chunks != 12 {
+		t.Errorf("unexpected specs %+v (%v)", specs, err)
+	}
+	for _, manifest := range []string{"", "6:a:b:c:d", "5:a:b:c:d:" + testTable, "5:a:b:c:d:short:1"} {
+		if _, err := parseManifest(manifest); err == nil {
+			t.Errorf("expected manifest '%s' to be refused", manifest)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/client"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"github.com/nustiueudinastea/doltswarmdemo/rollout"
+)
+
+const (
+	// restartDelay lets the restart request be answered before the server
+	// stops
+	restartDelay = time.Second
+	// rolloutCallTimeout bounds the calls to a node, which hang while it
+	// restarts
+	rolloutCallTimeout = 5 * time.Second
+)
+
+var restartRequested atomic.Bool
+
+// processRestarter restarts the server for the Admin service: the server
+// stops as if it received SIGTERM, and the process runs the same command again
+// once the db is closed
+type processRestarter struct{}
+
+func (processRestarter) Restart() error {
+	if !restartRequested.CompareAndSwap(false, true) {
+		return fmt.Errorf("a restart is already in progress")
+	}
+	log.Info("Restart requested. Stopping the server")
+	time.AfterFunc(restartDelay, func() {
+		err := syscall.Kill(os.Getpid(), syscall.SIGTERM)
+		if err != nil {
+			log.Errorf("Failed to stop the server for the restart: %s", err.Error())
+		}
+	})
+	return nil
+}
+
+// reexec replaces the process with the same command. The binary is looked up
+// again, so that an upgraded binary is started.
+func reexec() error {
+	binary, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(binary, os.Args, os.Environ())
+}
+
+// rolloutNode restarts a node through its Admin service
+type rolloutNode struct {
+	peer  *client.Peer
+	admin p2pproto.AdminClient
+}
+
+func (n *rolloutNode) Name() string {
+	return n.peer.ID().String()
+}
+
+func drainStatusFromProto(status *p2pproto.DrainStatus) rollout.DrainStatus {
+	return rollout.DrainStatus{
+		Draining:  status.Draining,
+		Pending:   status.Pending,
+		StartedAt: time.UnixMilli(status.StartedUnixMs),
+	}
+}
+
+func (n *rolloutNode) SetDraining(ctx context.Context, draining bool) (rollout.DrainStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, rolloutCallTimeout)
+	defer cancel()
+	status, err := n.admin.SetDraining(ctx, &p2pproto.SetDrainingRequest{Draining: draining})
+	if err != nil {
+		return rollout.DrainStatus{}, err
+	}
+	return drainStatusFromProto(status), nil
+}
+
+func (n *rolloutNode) DrainStatus(ctx context.Context) (rollout.DrainStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, rolloutCallTimeout)
+	defer cancel()
+	status, err := n.admin.GetDrainStatus(ctx, &p2pproto.GetDrainStatusRequest{})
+	if err != nil {
+		return rollout.DrainStatus{}, err
+	}
+	return drainStatusFromProto(status), nil
+}
+
+func (n *rolloutNode) Restart(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, rolloutCallTimeout)
+	defer cancel()
+	_, err := n.admin.Restart(ctx, &p2pproto.RestartRequest{})
+	return err
+}
+
+func (n *rolloutNode) Synced(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, rolloutCallTimeout)
+	defer cancel()
+	progress, err := n.admin.GetSyncProgress(ctx, &p2pproto.GetSyncProgressRequest{})
+	if err != nil {
+		return false, err
+	}
+	return progress.LocalCommits >= progress.TotalCommits, nil
+}
+
+// rollingRestart restarts the nodes at the given addresses one at a time,
+// printing the steps of every node
+func rollingRestart(addrs []string, cfg rollout.Config) error {
+	if len(addrs) == 0 {
+		return fmt.Errorf("expected the addresses of the nodes to restart")
+	}
+	// the other nodes have to trust the admin identity, with --admin-peers or
+	// the admin role
+	identity, err := adminIdentity()
+	if err != nil {
+		return err
+	}
+	c, err := client.New(identity)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	nodes := []rollout.Node{}
+	for _, addr := range addrs {
+		peer, err := c.Connect(addr)
+		if err != nil {
+			return err
+		}
+		nodes = append(nodes, &rolloutNode{peer: peer, admin: p2pproto.NewAdminClient(peer.Conn())})
+	}
+	err = rollout.Run(context.Background(), cfg, nodes, func(node string, step rollout.Step) {
+		fmt.Printf("%s %-8s %s\n", time.Now().Format(time.RFC3339), step, node)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restarted %d nodes\n", len(nodes))
+	return nil
+}
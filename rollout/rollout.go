@@ -0,0 +1,167 @@
+// Package rollout restarts the nodes of a cluster one at a time, e.g. to
+// upgrade them, so that the cluster never loses more than one node. Every node
+// is drained first, so that its peers route around it, and the next node is
+// only restarted once the previous one is back and synced.
+package rollout
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultAckTimeout     = 30 * time.Second
+	defaultRestartTimeout = 2 * time.Minute
+	defaultSyncTimeout    = 5 * time.Minute
+	defaultPollInterval   = time.Second
+)
+
+// DrainStatus is the drain state of a node
+type DrainStatus struct {
+	Draining bool
+	// Pending are the connected peers that didn't acknowledge the state yet
+	Pending []string
+	// StartedAt changes when the node restarts
+	StartedAt time.Time
+}
+
+// Node is a node restarted by the rollout
+type Node interface {
+	Name() string
+	// SetDraining marks the node draining, or not draining anymore, and
+	// notifies its peers
+	SetDraining(ctx context.Context, draining bool) (DrainStatus, error)
+	DrainStatus(ctx context.Context) (DrainStatus, error)
+	// Restart asks the node to restart. It returns before the node stops.
+	Restart(ctx context.Context) error
+	// Synced returns true once the node has all the commits of its peers
+	Synced(ctx context.Context) (bool, error)
+}
+
+// Config sets how long every step of the restart of a node may take
+type Config struct {
+	// AckTimeout is how long the peers have to acknowledge the drain.
+	// Defaults to 30s
+	AckTimeout time.Duration
+	// RestartTimeout is how long the node has to come back. Defaults to 2m
+	RestartTimeout time.Duration
+	// SyncTimeout is how long the node has to sync after the restart.
+	// Defaults to 5m
+	SyncTimeout time.Duration
+	// PollInterval is how often the node is checked. Defaults to 1s
+	PollInterval time.Duration
+}
+
+func (cfg *Config) setDefaults() {
+	if cfg.AckTimeout <= 0 {
+		cfg.AckTimeout = defaultAckTimeout
+	}
+	if cfg.RestartTimeout <= 0 {
+		cfg.RestartTimeout = defaultRestartTimeout
+	}
+	if cfg.SyncTimeout <= 0 {
+		cfg.SyncTimeout = defaultSyncTimeout
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+}
+
+// Step is a step of the restart of a node
+type Step string
+
+const (
+	StepDrain   Step = "drain"
+	StepRestart Step = "restart"
+	StepResync  Step = "resync"
+	StepDone    Step = "done"
+)
+
+// Progress is called when the restart of a node reaches a step
+type Progress func(node string, step Step)
+
+// Run restarts the nodes in order. It stops at the first node that fails a
+// step, leaving the following nodes untouched. A node whose peers don't
+// acknowledge the drain is not restarted, and stops draining.
+func Run(ctx context.Context, cfg Config, nodes []Node, progress Progress) error {
+	cfg.setDefaults()
+	if progress == nil {
+		progress = func(string, Step) {}
+	}
+	for _, node := range nodes {
+		if err := restart(ctx, cfg, node, progress); err != nil {
+			return fmt.Errorf("failed to restart %s: %w", node.Name(), err)
+		}
+	}
+	return nil
+}
+
+func restart(ctx context.Context, cfg Config, node Node, progress Progress) error {
+	progress(node.Name(), StepDrain)
+	status, err := node.SetDraining(ctx, true)
+	if err != nil {
+		return fmt.Errorf("failed to drain: %w", err)
+	}
+	started := status.StartedAt
+	err = poll(ctx, cfg.AckTimeout, cfg.PollInterval, func() (bool, error) {
+		if len(status.Pending) == 0 {
+			return true, nil
+		}
+		status, err = node.DrainStatus(ctx)
+		return err == nil && len(status.Pending) == 0, err
+	})
+	if err != nil {
+		if _, undrainErr := node.SetDraining(ctx, false); undrainErr != nil {
+			err = fmt.Errorf("%w (and failed to stop draining: %v)", err, undrainErr)
+		}
+		return fmt.Errorf("drain was not acknowledged by %v: %w", status.Pending, err)
+	}
+
+	progress(node.Name(), StepRestart)
+	if err := node.Restart(ctx); err != nil {
+		return err
+	}
+	// the node doesn't answer while it restarts
+	err = poll(ctx, cfg.RestartTimeout, cfg.PollInterval, func() (bool, error) {
+		status, err := node.DrainStatus(ctx)
+		return err == nil && !status.StartedAt.Equal(started), nil
+	})
+	if err != nil {
+		return fmt.Errorf("node did not come back: %w", err)
+	}
+
+	progress(node.Name(), StepResync)
+	err = poll(ctx, cfg.SyncTimeout, cfg.PollInterval, func() (bool, error) {
+		synced, err := node.Synced(ctx)
+		return err == nil && synced, nil
+	})
+	if err != nil {
+		return fmt.Errorf("node did not sync: %w", err)
+	}
+	progress(node.Name(), StepDone)
+	return nil
+}
+
+// poll calls done every interval until it returns true, it fails, or the
+// timeout expires
+func poll(ctx context.Context, timeout time.Duration, interval time.Duration, done func() (bool, error)) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ok, err := done()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
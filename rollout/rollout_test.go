@@ -0,0 +1,92 @@
+package rollout
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeNode restarts instantly, and has peers that acknowledge the drain after
+// acks polls
+type fakeNode struct {
+	name      string
+	acks      int
+	draining  bool
+	pending   []string
+	started   time.Time
+	restarts  int
+	down      int
+	synced    bool
+	undrained bool
+}
+
+func (n *fakeNode) Name() string { return n.name }
+
+func (n *fakeNode) SetDraining(ctx context.Context, draining bool) (DrainStatus, error) {
+	n.draining = draining
+	if !draining {
+		n.undrained = true
+	}
+	n.pending = []string{"peer"}
+	return n.DrainStatus(ctx)
+}
+
+func (n *fakeNode) DrainStatus(ctx context.Context) (DrainStatus, error) {
+	if n.down > 0 {
+		n.down--
+		return DrainStatus{}, errors.New("unavailable")
+	}
+	if n.acks == 0 {
+		n.pending = nil
+	}
+	n.acks--
+	return DrainStatus{Draining: n.draining, Pending: n.pending, StartedAt: n.started}, nil
+}
+
+func (n *fakeNode) Restart(ctx context.Context) error {
+	n.restarts++
+	n.draining = false
+	n.started = n.started.Add(time.Second)
+	n.down = 2
+	return nil
+}
+
+func (n *fakeNode) Synced(ctx context.Context) (bool, error) {
+	return n.synced, nil
+}
+
+func TestRun(t *testing.T) {
+	cfg := Config{AckTimeout: time.Second, RestartTimeout: time.Second, SyncTimeout: 100 * time.Millisecond, PollInterval: time.Millisecond}
+	a := &fakeNode{name: "a", acks: 2, synced: true}
+	b := &fakeNode{name: "b", acks: 1, synced: true}
+	steps := []Step{}
+	err := Run(context.Background(), cfg, []Node{a, b}, func(node string, step Step) {
+		steps = append(steps, step)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.restarts != 1 || b.restarts != 1 || len(steps) != 8 {
+		t.Errorf("expected both nodes to be restarted in 4 steps, got %v", steps)
+	}
+
+	// the rollout stops at a node that doesn't sync
+	c := &fakeNode{name: "c"}
+	d := &fakeNode{name: "d", synced: true}
+	if err := Run(context.Background(), cfg, []Node{c, d}, nil); err == nil {
+		t.Error("expected the rollout to fail")
+	}
+	if d.restarts != 0 {
+		t.Error("expected the rollout to stop at the node that failed")
+	}
+
+	// nodes whose drain isn't acknowledged are not restarted
+	e := &fakeNode{name: "e", acks: 1000, synced: true}
+	if err := Run(context.Background(), Config{AckTimeout: 10 * time.Millisecond, PollInterval: time.Millisecond}, []Node{e}, nil); err == nil {
+		t.Error("expected the drain to time out")
+	}
+	if e.restarts != 0 || !e.undrained {
+		t.Errorf("expected the node to stop draining without restarting, got %+v", e)
+	}
+}
@@ -0,0 +1,113 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	defaultTimeout     = 30 * time.Minute
+	defaultHistorySize = 20
+)
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Duration is a time.Duration written as a string like "5m" in the config
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return fmt.Errorf("durations have to be strings like \"5m\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Job runs a maintenance task on a schedule
+type Job struct {
+	Name string `json:"name"`
+	// Task is the name of the task run by the job, e.g. gc
+	Task string `json:"task"`
+	// Schedule is a cron expression with 5 fields, like "0 3 * * *", or a
+	// descriptor like "@hourly" or "@every 10m". Times are in UTC.
+	Schedule string `json:"schedule"`
+	// Jitter delays every run by a random duration up to its value, so that
+	// the nodes don't all run the job at the same time
+	Jitter Duration `json:"jitter,omitempty"`
+	// Timeout of a run. Defaults to 30m
+	Timeout Duration `json:"timeout,omitempty"`
+	// LeaderOnly jobs run on a single node of the cluster at every scheduled
+	// time
+	LeaderOnly bool `json:"leader_only,omitempty"`
+	// Args are passed to the task
+	Args map[string]string `json:"args,omitempty"`
+}
+
+// Config holds the jobs of a node
+type Config struct {
+	Jobs []Job `json:"jobs"`
+	// HistorySize is the number of runs kept per job. Defaults to 20
+	HistorySize int `json:"history_size,omitempty"`
+}
+
+// LoadConfig reads the jobs from a JSON file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jobs: %w", err)
+	}
+	cfg := &Config{}
+	err = json.Unmarshal(data, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse jobs '%s': %w", path, err)
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate checks the jobs and sets the defaults. The tasks are checked when
+// the scheduler is created.
+func (cfg *Config) Validate() error {
+	if cfg.HistorySize <= 0 {
+		cfg.HistorySize = defaultHistorySize
+	}
+	names := map[string]bool{}
+	for i := range cfg.Jobs {
+		job := &cfg.Jobs[i]
+		if !validName.MatchString(job.Name) {
+			return fmt.Errorf("jobs: invalid job name '%s'", job.Name)
+		}
+		if names[job.Name] {
+			return fmt.Errorf("jobs: duplicate job '%s'", job.Name)
+		}
+		names[job.Name] = true
+		if _, err := parseSchedule(job.Schedule); err != nil {
+			return fmt.Errorf("jobs: invalid schedule of job '%s': %w", job.Name, err)
+		}
+		if job.Jitter < 0 {
+			return fmt.Errorf("jobs: negative jitter of job '%s'", job.Name)
+		}
+		if job.Timeout <= 0 {
+			job.Timeout = Duration(defaultTimeout)
+		}
+	}
+	return nil
+}
+
+func parseSchedule(schedule string) (cron.Schedule, error) {
+	return cron.ParseStandard("TZ=UTC " + schedule)
+}
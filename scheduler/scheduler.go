@@ -0,0 +1,236 @@
+// Package scheduler runs cluster maintenance tasks, like garbage collection,
+// anti-entropy, backups or stats refreshes, on cron schedules. Runs are spread
+// with a random jitter, their outcome is kept in a per-job history, and
+// leader-only jobs run on a single node at every scheduled time.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+)
+
+// Task runs a maintenance task and returns a short summary of what it did
+type Task func(ctx context.Context, args map[string]string) (string, error)
+
+// ClaimFunc claims the run of a leader-only job at a scheduled time for this
+// node. Every node calls it for the same slot, and it must return true on only
+// one of them. hold is how long the claim has to be kept for late nodes.
+type ClaimFunc func(ctx context.Context, job string, slot time.Time, hold time.Duration) (bool, error)
+
+// Run is the outcome of a scheduled run
+type Run struct {
+	// Slot is the scheduled time, before the jitter
+	Slot     time.Time     `json:"slot"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	Output   string        `json:"output,omitempty"`
+	Err      string        `json:"error,omitempty"`
+	// Skipped is set when the run was left to another node
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// JobStatus describes a job and its recent runs, the latest last
+type JobStatus struct {
+	Job     Job       `json:"job"`
+	Next    time.Time `json:"next"`
+	Running bool      `json:"running"`
+	History []Run     `json:"history"`
+}
+
+type scheduledJob struct {
+	Job
+	schedule cron.Schedule
+	task     Task
+}
+
+// Scheduler runs the jobs of a node
+type Scheduler struct {
+	cfg   *Config
+	jobs  []*scheduledJob
+	claim ClaimFunc
+	log   *logrus.Logger
+	now   func() time.Time
+	// jitter returns the random delay of a run
+	jitter func(max time.Duration) time.Duration
+
+	mtx    sync.Mutex
+	status map[string]*JobStatus
+}
+
+// New creates a scheduler for the jobs. Every job must run one of the tasks.
+// claim is only required for leader-only jobs.
+func New(cfg *Config, tasks map[string]Task, claim ClaimFunc, logger *logrus.Logger) (*Scheduler, error) {
+	s := &Scheduler{
+		cfg:    cfg,
+		claim:  claim,
+		log:    logger,
+		now:    time.Now,
+		jitter: randomJitter,
+		status: map[string]*JobStatus{},
+	}
+	for _, job := range cfg.Jobs {
+		task, found := tasks[job.Task]
+		if !found {
+			return nil, fmt.Errorf("jobs: unknown task '%s' of job '%s'", job.Task, job.Name)
+		}
+		if job.LeaderOnly && claim == nil {
+			return nil, fmt.Errorf("jobs: leader-only job '%s' requires a way to claim runs", job.Name)
+		}
+		schedule, err := parseSchedule(job.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("jobs: invalid schedule of job '%s': %w", job.Name, err)
+		}
+		s.jobs = append(s.jobs, &scheduledJob{Job: job, schedule: schedule, task: task})
+		s.status[job.Name] = &JobStatus{Job: job, History: []Run{}}
+	}
+	return s, nil
+}
+
+func randomJitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// LoadHistory restores the history of the jobs from a JSON file holding the
+// result of Status, e.g. written before a restart. Jobs that are no longer
+// configured are ignored.
+func (s *Scheduler) LoadHistory(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	saved := []JobStatus{}
+	err = json.Unmarshal(data, &saved)
+	if err != nil {
+		return fmt.Errorf("failed to parse job history: %w", err)
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, js := range saved {
+		if status, found := s.status[js.Job.Name]; found {
+			status.History = trimHistory(js.History, s.cfg.HistorySize)
+		}
+	}
+	return nil
+}
+
+// Status returns the jobs sorted by name
+func (s *Scheduler) Status() []JobStatus {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	statuses := []JobStatus{}
+	for _, status := range s.status {
+		js := *status
+		js.History = append([]Run{}, status.History...)
+		statuses = append(statuses, js)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Job.Name < statuses[j].Job.Name })
+	return statuses
+}
+
+func trimHistory(history []Run, size int) []Run {
+	if len(history) > size {
+		history = history[len(history)-size:]
+	}
+	return history
+}
+
+func (s *Scheduler) update(name string, fn func(status *JobStatus)) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	fn(s.status[name])
+}
+
+// Start runs every job on its schedule until the returned stopper is called.
+// Running jobs are cancelled on stop.
+func (s *Scheduler) Start() func() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	for _, job := range s.jobs {
+		wg.Add(1)
+		go func(job *scheduledJob) {
+			defer wg.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+	return func() error {
+		cancel()
+		wg.Wait()
+		return nil
+	}
+}
+
+// loop runs a job at every scheduled time. A run that lasts past the next
+// scheduled times skips them instead of piling up.
+func (s *Scheduler) loop(ctx context.Context, job *scheduledJob) {
+	for {
+		slot := job.schedule.Next(s.now())
+		s.update(job.Name, func(status *JobStatus) { status.Next = slot })
+		timer := time.NewTimer(slot.Add(s.jitter(time.Duration(job.Jitter))).Sub(s.now()))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+		s.run(ctx, job, slot)
+	}
+}
+
+// run runs a job for a scheduled time and records the outcome
+func (s *Scheduler) run(ctx context.Context, job *scheduledJob, slot time.Time) {
+	run := Run{Slot: slot, Started: s.now()}
+	if job.LeaderOnly {
+		// the claim outlives the latest time another node can try to run
+		// the same slot
+		claimed, err := s.claim(ctx, job.Name, slot, time.Duration(job.Jitter)+time.Minute)
+		switch {
+		case err != nil:
+			run.Skipped = fmt.Sprintf("failed to claim the run: %s", err.Error())
+		case !claimed:
+			run.Skipped = "run claimed by another node"
+		}
+		if run.Skipped != "" {
+			s.log.Debugf("Skipping job '%s': %s", job.Name, run.Skipped)
+			s.record(job.Name, run)
+			return
+		}
+	}
+
+	s.update(job.Name, func(status *JobStatus) { status.Running = true })
+	s.log.Infof("Running job '%s'", job.Name)
+	runCtx, cancel := context.WithTimeout(ctx, time.Duration(job.Timeout))
+	output, err := job.task(runCtx, job.Args)
+	cancel()
+	run.Duration = s.now().Sub(run.Started)
+	run.Output = output
+	if err != nil {
+		run.Err = err.Error()
+		s.log.Errorf("Job '%s' failed after %s: %v", job.Name, run.Duration, err)
+	} else {
+		s.log.Infof("Job '%s' done in %s", job.Name, run.Duration)
+	}
+	s.record(job.Name, run)
+}
+
+func (s *Scheduler) record(name string, run Run) {
+	s.update(name, func(status *JobStatus) {
+		status.Running = false
+		status.History = trimHistory(append(status.History, run), s.cfg.HistorySize)
+	})
+}
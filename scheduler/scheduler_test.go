@@ -0,0 +1,116 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func TestConfig(t *testing.T) {
+	cfg := &Config{Jobs: []Job{{Name: "gc", Task: "gc", Schedule: "@every 1h"}, {Name: "stats", Task: "stats", Schedule: "30 2 * * *"}}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.HistorySize != defaultHistorySize || cfg.Jobs[0].Timeout != Duration(defaultTimeout) {
+		t.Errorf("expected the defaults to be set, got %+v", cfg)
+	}
+
+	invalid := []Config{
+		{Jobs: []Job{{Name: "gc", Task: "gc", Schedule: "every hour"}}},
+		{Jobs: []Job{{Name: "gc", Task: "gc", Schedule: "@daily"}, {Name: "gc", Task: "gc", Schedule: "@daily"}}},
+		{Jobs: []Job{{Name: "g c", Task: "gc", Schedule: "@daily"}}},
+	}
+	for _, cfg := range invalid {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", cfg.Jobs)
+		}
+	}
+
+	job := Job{}
+	if err := json.Unmarshal([]byte(`{"jitter": "5m"}`), &job); err != nil || job.Jitter != Duration(5*time.Minute) {
+		t.Errorf("unexpected jitter %v (%v)", time.Duration(job.Jitter), err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	cfg := &Config{HistorySize: 2, Jobs: []Job{
+		{Name: "backup", Task: "backup", Schedule: "@hourly", LeaderOnly: true},
+		{Name: "gc", Task: "gc", Schedule: "@hourly"},
+	}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	tasks := map[string]Task{
+		"backup": func(ctx context.Context, args map[string]string) (string, error) { return "synced", nil },
+		"gc":     func(ctx context.Context, args map[string]string) (string, error) { return "", errors.New("disk full") },
+	}
+	claims := map[time.Time]bool{}
+	claim := func(ctx context.Context, job string, slot time.Time, hold time.Duration) (bool, error) {
+		if claims[slot] {
+			return false, nil
+		}
+		claims[slot] = true
+		return true, nil
+	}
+	s, err := New(cfg, tasks, claim, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(cfg, map[string]Task{}, claim, testLogger()); err == nil {
+		t.Error("expected unknown tasks to be refused")
+	}
+
+	slot := time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)
+	backup, gc := s.jobs[0], s.jobs[1]
+	s.run(context.Background(), backup, slot)
+	// another node already ran the slot
+	claims[slot.Add(time.Hour)] = true
+	s.run(context.Background(), backup, slot.Add(time.Hour))
+	s.run(context.Background(), gc, slot)
+
+	status := s.Status()
+	if len(status) != 2 || status[0].Job.Name != "backup" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	history := status[0].History
+	if len(history) != 2 || history[0].Output != "synced" || history[1].Skipped == "" {
+		t.Errorf("unexpected backup history %+v", history)
+	}
+	if history := status[1].History; len(history) != 1 || history[0].Err != "disk full" {
+		t.Errorf("unexpected gc history %+v", history)
+	}
+
+	// the history is capped
+	s.run(context.Background(), gc, slot.Add(time.Hour))
+	s.run(context.Background(), gc, slot.Add(2*time.Hour))
+	if history := s.Status()[1].History; len(history) != 2 || !history[1].Slot.Equal(slot.Add(2*time.Hour)) {
+		t.Errorf("expected the 2 latest runs, got %+v", history)
+	}
+
+	// and restored after a restart
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	data, _ := json.Marshal(s.Status())
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	restarted, _ := New(cfg, tasks, claim, testLogger())
+	if err := restarted.LoadHistory(path); err != nil {
+		t.Fatal(err)
+	}
+	if history := restarted.Status()[0].History; len(history) != 2 || history[0].Output != "synced" {
+		t.Errorf("unexpected restored history %+v", history)
+	}
+}
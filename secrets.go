@@ -0,0 +1,21 @@
+package main
+
+import (
+	"github.com/nustiueudinastea/doltswarmdemo/secrets"
+)
+
+// newSecretsResolver returns a resolver for environment, Vault and, if an age
+// identity file is given, age encrypted secrets
+func newSecretsResolver(ageIdentityFile string) (*secrets.Resolver, error) {
+	resolver := secrets.NewResolver()
+	resolver.Register("env", secrets.Env{})
+	resolver.Register("vault", secrets.NewVaultFromEnv())
+	if ageIdentityFile != "" {
+		ageFile, err := secrets.NewAgeFile(ageIdentityFile)
+		if err != nil {
+			return nil, err
+		}
+		resolver.Register("age", ageFile)
+	}
+	return resolver, nil
+}
@@ -0,0 +1,172 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+)
+
+const vaultTimeout = 10 * time.Second
+
+// Env reads secrets from environment variables. The path is the name of the
+// variable.
+type Env struct{}
+
+func (Env) Resolve(path string, key string) (string, error) {
+	if key != "" {
+		return "", fmt.Errorf("environment secrets don't have keys")
+	}
+	value, found := os.LookupEnv(path)
+	if !found {
+		return "", fmt.Errorf("environment variable '%s' is not set", path)
+	}
+	return value, nil
+}
+
+// AgeFile reads secrets from files encrypted with age, e.g. with
+// `age -r <recipient> -o secrets.age secrets.json`. Without a key the whole
+// decrypted file is the secret. With a key the file has to hold a JSON object
+// and the secret is the value of the key.
+type AgeFile struct {
+	identities []age.Identity
+
+	mtx   sync.Mutex
+	files map[string][]byte
+}
+
+// NewAgeFile creates a provider decrypting files with the identities of an
+// age identity file
+func NewAgeFile(identityFile string) (*AgeFile, error) {
+	f, err := os.Open(identityFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open age identity file: %w", err)
+	}
+	defer f.Close()
+	identities, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse age identity file '%s': %w", identityFile, err)
+	}
+	return &AgeFile{identities: identities, files: map[string][]byte{}}, nil
+}
+
+func (a *AgeFile) decrypt(path string) ([]byte, error) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if data, found := a.files[path]; found {
+		return data, nil
+	}
+	ciphertext, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := age.Decrypt(bytes.NewReader(ciphertext), a.identities...)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	a.files[path] = data
+	return data, nil
+}
+
+func (a *AgeFile) Resolve(path string, key string) (string, error) {
+	data, err := a.decrypt(path)
+	if err != nil {
+		return "", err
+	}
+	if key == "" {
+		return strings.TrimSpace(string(data)), nil
+	}
+	values := map[string]string{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return "", fmt.Errorf("secrets file is not a JSON object of strings: %w", err)
+	}
+	value, found := values[key]
+	if !found {
+		return "", fmt.Errorf("key '%s' not found", key)
+	}
+	return value, nil
+}
+
+// Vault reads secrets from the HTTP API of HashiCorp Vault. The path is the
+// API path of the secret without the /v1/ prefix, e.g. secret/data/app for
+// the app secret of the KV version 2 engine mounted at secret.
+type Vault struct {
+	Addr   string
+	Token  string
+	Client *http.Client
+}
+
+// NewVaultFromEnv configures Vault with the standard VAULT_ADDR and
+// VAULT_TOKEN environment variables
+func NewVaultFromEnv() *Vault {
+	return &Vault{
+		Addr:   os.Getenv("VAULT_ADDR"),
+		Token:  os.Getenv("VAULT_TOKEN"),
+		Client: &http.Client{Timeout: vaultTimeout},
+	}
+}
+
+func (v *Vault) Resolve(path string, key string) (string, error) {
+	if v.Addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR is not set")
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(v.Addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned %s", resp.Status)
+	}
+
+	body := struct {
+		Data map[string]any `json:"data"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to parse vault response: %w", err)
+	}
+	return vaultField(body.Data, key)
+}
+
+// vaultField returns a field of the data of a secret. The KV version 2
+// engine nests the fields in a second data object, next to the metadata.
+func vaultField(data map[string]any, key string) (string, error) {
+	if inner, ok := data["data"].(map[string]any); ok {
+		if _, versioned := data["metadata"]; versioned {
+			data = inner
+		}
+	}
+	if key == "" {
+		if len(data) != 1 {
+			return "", fmt.Errorf("secret has %d fields, select one with #<key>", len(data))
+		}
+		for k := range data {
+			key = k
+		}
+	}
+	value, found := data[key]
+	if !found {
+		return "", fmt.Errorf("key '%s' not found", key)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("key '%s' is not a string", key)
+	}
+	return s, nil
+}
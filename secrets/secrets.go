@@ -0,0 +1,125 @@
+// Package secrets resolves references to sensitive configuration values, so
+// that tokens, passwords and keys don't have to be written in plaintext in
+// flags or config files. A reference has the form <provider>://<path>, with
+// an optional #<key> selecting a value inside the secret:
+//
+//	env://DOLTSWARM_GATEWAY_TOKEN
+//	age:///etc/doltswarm/secrets.age#gateway_token
+//	vault://secret/data/doltswarm#gateway_token
+//
+// Values that are not references are returned unchanged.
+package secrets
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Provider reads secrets from a backend
+type Provider interface {
+	// Resolve returns the secret at path. key selects a value of a secret
+	// holding several ones, and is empty otherwise.
+	Resolve(path string, key string) (string, error)
+}
+
+// Reference is a parsed secret reference
+type Reference struct {
+	Provider string
+	Path     string
+	Key      string
+}
+
+func (ref Reference) String() string {
+	s := ref.Provider + "://" + ref.Path
+	if ref.Key != "" {
+		s += "#" + ref.Key
+	}
+	return s
+}
+
+// Resolver resolves the references of its registered providers. Resolved
+// values are cached, so every secret is only read once.
+type Resolver struct {
+	mtx       sync.Mutex
+	providers map[string]Provider
+	cache     map[Reference]string
+}
+
+// NewResolver creates a resolver without providers
+func NewResolver() *Resolver {
+	return &Resolver{providers: map[string]Provider{}, cache: map[Reference]string{}}
+}
+
+// Register adds a provider for references starting with name://
+func (r *Resolver) Register(name string, provider Provider) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.providers[name] = provider
+}
+
+// Providers returns the names of the registered providers
+func (r *Resolver) Providers() []string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	names := []string{}
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Parse returns the reference held by value, if it starts with the name of a
+// registered provider
+func (r *Resolver) Parse(value string) (Reference, bool) {
+	name, rest, found := strings.Cut(value, "://")
+	if !found {
+		return Reference{}, false
+	}
+	r.mtx.Lock()
+	_, registered := r.providers[name]
+	r.mtx.Unlock()
+	if !registered {
+		return Reference{}, false
+	}
+	ref := Reference{Provider: name, Path: rest}
+	if i := strings.LastIndex(rest, "#"); i >= 0 {
+		ref.Path, ref.Key = rest[:i], rest[i+1:]
+	}
+	return ref, true
+}
+
+// Resolve returns the secret referenced by value, or value itself if it's not
+// a reference
+func (r *Resolver) Resolve(value string) (string, error) {
+	ref, ok := r.Parse(value)
+	if !ok {
+		return value, nil
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if secret, found := r.cache[ref]; found {
+		return secret, nil
+	}
+	secret, err := r.providers[ref.Provider].Resolve(ref.Path, ref.Key)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve secret '%s': %w", ref, err)
+	}
+	r.cache[ref] = secret
+	return secret, nil
+}
+
+// ResolveAll replaces every reference pointed to by values with its secret
+func (r *Resolver) ResolveAll(values ...*string) error {
+	for _, value := range values {
+		secret, err := r.Resolve(*value)
+		if err != nil {
+			return err
+		}
+		*value = secret
+	}
+	return nil
+}
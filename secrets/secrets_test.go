@@ -0,0 +1,173 @@
+package secrets
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+)
+
+type countingProvider struct {
+	calls int
+}
+
+func (p *countingProvider) Resolve(path string, key string) (string, error) {
+	p.calls++
+	return path + "|" + key, nil
+}
+
+func TestResolver(t *testing.T) {
+	r := NewResolver()
+	provider := &countingProvider{}
+	r.Register("test", provider)
+
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"plaintext", "plaintext"},
+		{"https://example.com/a#b", "https://example.com/a#b"},
+		{"test://some/path", "some/path|"},
+		{"test://some/path#key", "some/path|key"},
+		{"test://a#b#c", "a#b|c"},
+	}
+	for _, test := range tests {
+		got, err := r.Resolve(test.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.value, test.expected, got)
+		}
+	}
+
+	calls := provider.calls
+	if _, err := r.Resolve("test://some/path#key"); err != nil {
+		t.Fatal(err)
+	}
+	if provider.calls != calls {
+		t.Errorf("expected resolved secrets to be cached")
+	}
+
+	a, b := "test://x", "plain"
+	if err := r.ResolveAll(&a, &b); err != nil {
+		t.Fatal(err)
+	}
+	if a != "x|" || b != "plain" {
+		t.Errorf("unexpected resolved values %q and %q", a, b)
+	}
+}
+
+func TestEnv(t *testing.T) {
+	t.Setenv("SECRETS_TEST_VALUE", "s3cret")
+	r := NewResolver()
+	r.Register("env", Env{})
+	got, err := r.Resolve("env://SECRETS_TEST_VALUE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "s3cret" {
+		t.Errorf("expected s3cret, got %q", got)
+	}
+	if _, err := r.Resolve("env://SECRETS_TEST_MISSING"); err == nil {
+		t.Errorf("expected an error for an unset variable")
+	}
+}
+
+func TestAgeFile(t *testing.T) {
+	dir := t.TempDir()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityFile := filepath.Join(dir, "key.txt")
+	if err := os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	secretsFile := filepath.Join(dir, "secrets.age")
+	f, err := os.Create(secretsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := age.Encrypt(f, identity.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(`{"token": "abc", "password": "def"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	provider, err := NewAgeFile(identityFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewResolver()
+	r.Register("age", provider)
+	got, err := r.Resolve("age://" + secretsFile + "#password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "def" {
+		t.Errorf("expected def, got %q", got)
+	}
+	if _, err := r.Resolve("age://" + secretsFile + "#missing"); err == nil {
+		t.Errorf("expected an error for a missing key")
+	}
+}
+
+func TestVault(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch req.URL.Path {
+		case "/v1/secret/data/app":
+			w.Write([]byte(`{"data": {"data": {"token": "kv2"}, "metadata": {"version": 1}}}`))
+		case "/v1/kv/app":
+			w.Write([]byte(`{"data": {"token": "kv1", "other": "x"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	vault := &Vault{Addr: srv.URL, Token: "root", Client: srv.Client()}
+	tests := []struct {
+		path     string
+		key      string
+		expected string
+	}{
+		{"secret/data/app", "token", "kv2"},
+		{"secret/data/app", "", "kv2"},
+		{"kv/app", "token", "kv1"},
+	}
+	for _, test := range tests {
+		got, err := vault.Resolve(test.path, test.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.expected {
+			t.Errorf("%s#%s: expected %q, got %q", test.path, test.key, test.expected, got)
+		}
+	}
+
+	if _, err := vault.Resolve("kv/app", ""); err == nil {
+		t.Errorf("expected an error when a secret with several fields has no key")
+	}
+	if _, err := vault.Resolve("missing", "token"); err == nil {
+		t.Errorf("expected an error for a missing secret")
+	}
+	vault.Token = "wrong"
+	if _, err := vault.Resolve("kv/app", "token"); err == nil {
+		t.Errorf("expected an error with the wrong token")
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/client"
+	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	selftestInitTimeout = time.Minute
+	selftestStopTimeout = 30 * time.Second
+	selftestKilledNode  = 0
+)
+
+// selftestConfig configures the selftest command
+type selftestConfig struct {
+	Nodes    int
+	BasePort int
+	Timeout  time.Duration
+	Keep     bool
+	// Args are global flags added to the commands of every node
+	Args []string
+}
+
+// selftestNode is a node started by the selftest in its own process
+type selftestNode struct {
+	name string
+	dir  string
+	port int
+	id   string
+	cmd  *exec.Cmd
+	peer *client.Peer
+}
+
+func (n *selftestNode) addr() string {
+	return fmt.Sprintf("/ip4/127.0.0.1/udp/%d/quic-v1/p2p/%s", n.port, n.id)
+}
+
+// selftest runs a throwaway cluster from the current binary and checks that
+// writes converge, including after a node is killed mid-sync
+type selftest struct {
+	cfg    selftestConfig
+	binary string
+	dir    string
+	nodes  []*selftestNode
+	client *client.Client
+	// commits are the commits written so far, which every node must have
+	commits []string
+}
+
+// runSelftest runs every step of the selftest and prints a report. It returns
+// an error if any step failed.
+func runSelftest(cfg selftestConfig) error {
+	if cfg.Nodes < 2 {
+		return fmt.Errorf("the selftest needs at least 2 nodes")
+	}
+	binary, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "doltswarm-selftest-")
+	if err != nil {
+		return err
+	}
+	st := &selftest{cfg: cfg, binary: binary, dir: dir}
+	defer st.cleanup()
+
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"initialise nodes", st.initNodes},
+		{"start nodes", st.startNodes},
+		{"write on every node", st.writeOnEveryNode},
+		{"converge", st.converge},
+		{"kill a node mid-sync", st.killMidSync},
+		{"converge after restart", st.converge},
+	}
+
+	failed := false
+	for _, step := range steps {
+		if failed {
+			fmt.Printf("SKIP  %s\n", step.name)
+			continue
+		}
+		start := time.Now()
+		err := step.run()
+		elapsed := time.Since(start).Round(time.Millisecond)
+		if err != nil {
+			failed = true
+			fmt.Printf("FAIL  %s (%s): %v\n", step.name, elapsed, err)
+			continue
+		}
+		fmt.Printf("PASS  %s (%s)\n", step.name, elapsed)
+	}
+
+	if failed {
+		st.cfg.Keep = true
+		fmt.Printf("Node logs kept in %s\n", dir)
+		return fmt.Errorf("selftest failed")
+	}
+	fmt.Println("Selftest passed")
+	return nil
+}
+
+// command prepares the binary to run a node with the given command, logging
+// its output to the selftest directory
+func (st *selftest) command(node *selftestNode, args ...string) (*exec.Cmd, error) {
+	staticPeers := []string{}
+	for _, other := range st.nodes {
+		if other != node {
+			staticPeers = append(staticPeers, "--static-peer", other.addr())
+		}
+	}
+	global := []string{"--db", node.dir, "--port", strconv.Itoa(node.port), "--no-gui", "--no-commits", "--discovery", "static"}
+	global = append(global, staticPeers...)
+	global = append(global, st.cfg.Args...)
+
+	logFile, err := os.OpenFile(filepath.Join(st.dir, node.name+".log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(st.binary, append(global, args...)...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	return cmd, nil
+}
+
+func (st *selftest) runToCompletion(node *selftestNode, args ...string) error {
+	cmd, err := st.command(node, args...)
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("%s %v failed: %w", node.name, args, err)
+		}
+		return nil
+	case <-time.After(selftestInitTimeout):
+		cmd.Process.Kill()
+		return fmt.Errorf("%s %v timed out", node.name, args)
+	}
+}
+
+func (st *selftest) start(node *selftestNode) error {
+	cmd, err := st.command(node, "server")
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	node.cmd = cmd
+	return nil
+}
+
+// stop interrupts a node and waits for it to exit, killing it if it doesn't
+func (st *selftest) stop(node *selftestNode) error {
+	if node.cmd == nil {
+		return nil
+	}
+	cmd := node.cmd
+	node.cmd = nil
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	if err := cmd.Process.Signal(syscall.SIGINT); err != nil {
+		return err
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(selftestStopTimeout):
+		cmd.Process.Kill()
+		return fmt.Errorf("%s didn't stop within %s", node.name, selftestStopTimeout)
+	}
+}
+
+func (st *selftest) initNodes() error {
+	for i := 0; i < st.cfg.Nodes; i++ {
+		node := &selftestNode{
+			name: fmt.Sprintf("node%d", i+1),
+			dir:  filepath.Join(st.dir, fmt.Sprintf("node%d", i+1)),
+			port: st.cfg.BasePort + i,
+		}
+		if err := os.MkdirAll(node.dir, 0700); err != nil {
+			return err
+		}
+		key, err := p2p.NewKey(node.dir)
+		if err != nil {
+			return err
+		}
+		node.id = key.GetID()
+		st.nodes = append(st.nodes, node)
+	}
+
+	first := st.nodes[0]
+	if err := st.runToCompletion(first, "init", "--local"); err != nil {
+		return err
+	}
+	if err := st.start(first); err != nil {
+		return err
+	}
+	defer st.stop(first)
+	for _, node := range st.nodes[1:] {
+		if err := st.runToCompletion(node, "init", "--peer", first.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (st *selftest) startNodes() error {
+	c, err := client.New()
+	if err != nil {
+		return err
+	}
+	st.client = c
+
+	for _, node := range st.nodes {
+		if err := st.start(node); err != nil {
+			return err
+		}
+		node.peer, err = c.Connect(node.addr())
+		if err != nil {
+			return err
+		}
+	}
+	for _, node := range st.nodes {
+		if err := st.waitReachable(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (st *selftest) waitReachable(node *selftestNode) error {
+	deadline := time.Now().Add(st.cfg.Timeout)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		_, err := node.peer.Ping(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s is not reachable: %w", node.name, err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+func (st *selftest) write(node *selftestNode, label string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), st.cfg.Timeout)
+	defer cancel()
+	query := fmt.Sprintf("INSERT INTO %s (id, name) VALUES ('%s', 'selftest %s');", tableName, ksuid.New().String(), label)
+	res, err := node.peer.Exec(ctx, query, client.ExecOptions{Message: "selftest " + label})
+	if err != nil {
+		return fmt.Errorf("write on %s failed: %w", node.name, err)
+	}
+	st.commits = append(st.commits, res.Commit)
+	return nil
+}
+
+func (st *selftest) writeOnEveryNode() error {
+	for _, node := range st.nodes {
+		if err := st.write(node, node.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// converge checks that every node applied every commit written so far and
+// that all nodes ended up with the same head
+func (st *selftest) converge() error {
+	ctx, cancel := context.WithTimeout(context.Background(), st.cfg.Timeout)
+	defer cancel()
+
+	var err error
+	for _, node := range st.nodes {
+		for _, commit := range st.commits {
+			applied, ackErr := node.peer.WaitForCommit(ctx, commit)
+			if ackErr != nil {
+				err = errors.Join(err, fmt.Errorf("%s: %w", node.name, ackErr))
+				break
+			}
+			if !applied {
+				err = errors.Join(err, fmt.Errorf("%s is missing commit %s", node.name, commit))
+				break
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// the merges made while syncing take a moment to settle
+	for {
+		heads := map[string]bool{}
+		for _, node := range st.nodes {
+			head, err := node.peer.Head(ctx)
+			if err != nil {
+				return fmt.Errorf("%s: %w", node.name, err)
+			}
+			heads[head] = true
+		}
+		if len(heads) == 1 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("nodes ended up with %d different heads", len(heads))
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// killMidSync writes on one node and kills another one while the writes are
+// being synced, then restarts it
+func (st *selftest) killMidSync() error {
+	victim := st.nodes[selftestKilledNode]
+	writer := st.nodes[len(st.nodes)-1]
+
+	for i := 0; i < 5; i++ {
+		if err := st.write(writer, fmt.Sprintf("before kill %d", i)); err != nil {
+			return err
+		}
+	}
+	if err := victim.cmd.Process.Kill(); err != nil {
+		return err
+	}
+	victim.cmd.Wait()
+	victim.cmd = nil
+	for i := 0; i < 5; i++ {
+		if err := st.write(writer, fmt.Sprintf("after kill %d", i)); err != nil {
+			return err
+		}
+	}
+
+	if err := st.start(victim); err != nil {
+		return err
+	}
+	return st.waitReachable(victim)
+}
+
+func (st *selftest) cleanup() {
+	for _, node := range st.nodes {
+		if err := st.stop(node); err != nil {
+			fmt.Printf("Failed to stop %s: %v\n", node.name, err)
+		}
+	}
+	if st.client != nil {
+		st.client.Close()
+	}
+	if !st.cfg.Keep {
+		os.RemoveAll(st.dir)
+	}
+}
@@ -0,0 +1,571 @@
+// Package sessions serves SQL sessions to remote clients. A session pins a
+// connection to the local database, so that the statements of a client share
+// their temporary tables, user variables and transaction, like they would on
+// a MySQL connection. Writes to replicated tables are still committed through
+// the cluster, one statement at a time.
+package sessions
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"github.com/nustiueudinastea/doltswarmdemo/sqlstmt"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultMaxSessions      = 64
+	defaultMaxPerPeer       = 8
+	defaultIdleTimeout      = 5 * time.Minute
+	defaultMaxIdleTimeout   = time.Hour
+	defaultMaxRows          = 10000
+	defaultStatementTimeout = time.Minute
+	reapInterval            = 10 * time.Second
+)
+
+var _ p2pproto.SessionsServer = (*Server)(nil)
+
+// readStatements are read like SELECTs, which are recognized by parsing them
+var readStatements = map[string]bool{
+	"show":     true,
+	"describe": true,
+	"desc":     true,
+	"explain":  true,
+}
+
+// session statements only change the state of the pinned connection
+var sessionStatements = map[string]bool{
+	"set":      true,
+	"use":      true,
+	"begin":    true,
+	"start":    true,
+	"commit":   true,
+	"rollback": true,
+}
+
+var tempTableRegex = regexp.MustCompile("(?i)^\\s*(create|drop)\\s+temporary\\s+table\\s+(?:if\\s+(?:not\\s+)?exists\\s+)?`?([A-Za-z0-9_]+)`?")
+
+// DB opens the connections pinned by the sessions
+type DB interface {
+	Conn(ctx context.Context) (*sql.Conn, error)
+}
+
+// CommitFunc executes a write to a replicated table and commits it through the
+// cluster, returning the commit hash
+type CommitFunc func(query string, commitMsg string, consistency p2pproto.Consistency) (string, error)
+
+// AuthorizeFunc checks the tables a statement reads and writes against the
+// access rules of the node for the caller of the service
+type AuthorizeFunc func(ctx context.Context, reads []string, writes []string) error
+
+// Config limits the sessions served by the node
+type Config struct {
+	// MaxSessions is the number of sessions open at the same time. Defaults
+	// to 64
+	MaxSessions int
+	// MaxPerPeer is the number of sessions a single peer can keep open.
+	// Defaults to 8
+	MaxPerPeer int
+	// IdleTimeout closes the sessions clients didn't ask for a timeout.
+	// Defaults to 5m
+	IdleTimeout time.Duration
+	// MaxIdleTimeout caps the timeouts asked by clients. Defaults to 1h
+	MaxIdleTimeout time.Duration
+	// MaxRows is the number of rows a statement can return. Defaults to 10000
+	MaxRows int
+	// StatementTimeout defaults to 1m
+	StatementTimeout time.Duration
+}
+
+func (cfg Config) withDefaults() Config {
+	if cfg.MaxSessions <= 0 {
+		cfg.MaxSessions = defaultMaxSessions
+	}
+	if cfg.MaxPerPeer <= 0 {
+		cfg.MaxPerPeer = defaultMaxPerPeer
+	}
+	if cfg.IdleTimeout <= 0 {
+		cfg.IdleTimeout = defaultIdleTimeout
+	}
+	if cfg.MaxIdleTimeout <= 0 {
+		cfg.MaxIdleTimeout = defaultMaxIdleTimeout
+	}
+	if cfg.IdleTimeout > cfg.MaxIdleTimeout {
+		cfg.IdleTimeout = cfg.MaxIdleTimeout
+	}
+	if cfg.MaxRows <= 0 {
+		cfg.MaxRows = defaultMaxRows
+	}
+	if cfg.StatementTimeout <= 0 {
+		cfg.StatementTimeout = defaultStatementTimeout
+	}
+	return cfg
+}
+
+// Info describes an open session
+type Info struct {
+	ID          string        `json:"id"`
+	Owner       string        `json:"owner"`
+	Opened      time.Time     `json:"opened"`
+	LastUsed    time.Time     `json:"last_used"`
+	IdleTimeout time.Duration `json:"idle_timeout"`
+	InTx        bool          `json:"in_tx"`
+	TempTables  []string      `json:"temp_tables"`
+}
+
+type session struct {
+	id          string
+	owner       string
+	conn        *sql.Conn
+	opened      time.Time
+	idleTimeout time.Duration
+
+	// the fields below are guarded by the server mutex
+	lastUsed time.Time
+	busy     bool
+	closed   bool
+
+	// exec serializes the statements of the session, and guards the fields
+	// below
+	exec       sync.Mutex
+	inTx       bool
+	tempTables map[string]bool
+}
+
+// Server implements the Sessions gRPC service
+type Server struct {
+	cfg       Config
+	db        DB
+	commit    CommitFunc
+	authorize AuthorizeFunc
+	log       *logrus.Logger
+	now       func() time.Time
+
+	mtx      sync.Mutex
+	sessions map[string]*session
+}
+
+// New creates a session server. authorize is optional, all callers are trusted
+// if it's nil.
+func New(cfg Config, db DB, commit CommitFunc, authorize AuthorizeFunc, logger *logrus.Logger) *Server {
+	return &Server{
+		cfg:       cfg.withDefaults(),
+		db:        db,
+		commit:    commit,
+		authorize: authorize,
+		log:       logger,
+		now:       time.Now,
+		sessions:  map[string]*session{},
+	}
+}
+
+// Start closes the idle sessions until the returned stopper is called, which
+// closes all the sessions
+func (s *Server) Start() func() error {
+	ticker := time.NewTicker(reapInterval)
+	stopSignal := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				s.reap()
+			case <-stopSignal:
+				return
+			}
+		}
+	}()
+	return func() error {
+		ticker.Stop()
+		close(stopSignal)
+		s.mtx.Lock()
+		open := make([]*session, 0, len(s.sessions))
+		for _, sess := range s.sessions {
+			sess.closed = true
+			open = append(open, sess)
+		}
+		s.sessions = map[string]*session{}
+		s.mtx.Unlock()
+		for _, sess := range open {
+			s.discard(sess)
+		}
+		return nil
+	}
+}
+
+// Sessions returns the open sessions, the oldest first
+func (s *Server) Sessions() []Info {
+	s.mtx.Lock()
+	open := make([]*session, 0, len(s.sessions))
+	infos := make([]Info, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		open = append(open, sess)
+		infos = append(infos, Info{ID: sess.id, Owner: sess.owner, Opened: sess.opened, LastUsed: sess.lastUsed, IdleTimeout: sess.idleTimeout})
+	}
+	s.mtx.Unlock()
+	for i, sess := range open {
+		// a running statement holds the lock, so its state is reported once
+		// it's done
+		if sess.exec.TryLock() {
+			infos[i].InTx = sess.inTx
+			infos[i].TempTables = sortedKeys(sess.tempTables)
+			sess.exec.Unlock()
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Opened.Before(infos[j].Opened) })
+	return infos
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// caller returns the peer calling the service. Local calls have no peer.
+func caller(ctx context.Context) string {
+	peerID, _ := p2p.RemotePeer(ctx)
+	return peerID
+}
+
+func (s *Server) Open(ctx context.Context, req *p2pproto.OpenSessionRequest) (*p2pproto.OpenSessionResponse, error) {
+	owner := caller(ctx)
+	idleTimeout := s.cfg.IdleTimeout
+	if req.IdleTimeoutMs > 0 {
+		idleTimeout = time.Duration(req.IdleTimeoutMs) * time.Millisecond
+	}
+	if idleTimeout > s.cfg.MaxIdleTimeout {
+		idleTimeout = s.cfg.MaxIdleTimeout
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	now := s.now()
+	sess := &session{
+		id:          hex.EncodeToString(id),
+		owner:       owner,
+		opened:      now,
+		idleTimeout: idleTimeout,
+		lastUsed:    now,
+		tempTables:  map[string]bool{},
+	}
+
+	// the session is reserved before the connection is opened, so that
+	// concurrent opens can't go over the limits
+	s.mtx.Lock()
+	if len(s.sessions) >= s.cfg.MaxSessions {
+		s.mtx.Unlock()
+		return nil, status.Errorf(codes.ResourceExhausted, "node has reached its limit of %d sessions", s.cfg.MaxSessions)
+	}
+	perPeer := 0
+	for _, other := range s.sessions {
+		if other.owner == owner {
+			perPeer++
+		}
+	}
+	if perPeer >= s.cfg.MaxPerPeer {
+		s.mtx.Unlock()
+		return nil, status.Errorf(codes.ResourceExhausted, "peer has reached its limit of %d sessions", s.cfg.MaxPerPeer)
+	}
+	sess.busy = true
+	s.sessions[sess.id] = sess
+	s.mtx.Unlock()
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		s.mtx.Lock()
+		delete(s.sessions, sess.id)
+		s.mtx.Unlock()
+		return nil, fmt.Errorf("failed to open a connection: %w", err)
+	}
+	sess.exec.Lock()
+	sess.conn = conn
+	sess.exec.Unlock()
+	s.release(sess)
+	s.mtx.Lock()
+	closed := sess.closed
+	s.mtx.Unlock()
+	if closed {
+		// the server stopped while the connection was opened
+		s.discard(sess)
+		return nil, status.Error(codes.Unavailable, "sessions are shutting down")
+	}
+	s.log.Debugf("Opened SQL session %s for '%s'", sess.id, owner)
+	return &p2pproto.OpenSessionResponse{SessionId: sess.id, IdleTimeoutMs: idleTimeout.Milliseconds()}, nil
+}
+
+// acquire marks a session of the caller as busy, so that it's not closed for
+// being idle while it runs a statement
+func (s *Server) acquire(ctx context.Context, id string) (*session, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	sess, found := s.sessions[id]
+	// sessions of other peers are reported as missing, so that their IDs
+	// can't be probed
+	if !found || sess.owner != caller(ctx) {
+		return nil, status.Errorf(codes.NotFound, "session '%s' not found or expired", id)
+	}
+	sess.busy = true
+	return sess, nil
+}
+
+func (s *Server) release(sess *session) {
+	s.mtx.Lock()
+	sess.busy = false
+	sess.lastUsed = s.now()
+	s.mtx.Unlock()
+}
+
+func (s *Server) Execute(ctx context.Context, req *p2pproto.SessionStatementRequest) (*p2pproto.SessionStatementResponse, error) {
+	sess, err := s.acquire(ctx, req.SessionId)
+	if err != nil {
+		return nil, err
+	}
+	defer s.release(sess)
+
+	sess.exec.Lock()
+	defer sess.exec.Unlock()
+	s.mtx.Lock()
+	closed := sess.closed
+	s.mtx.Unlock()
+	if closed {
+		return nil, status.Errorf(codes.NotFound, "session '%s' not found or expired", req.SessionId)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.StatementTimeout)
+	defer cancel()
+
+	reads, writes, err := sqlstmt.Access(req.Statement)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "failed to parse statement: %v", err)
+	}
+	// temporary tables are private to the session
+	reads, writes = sess.replicated(reads), sess.replicated(writes)
+
+	keyword := sqlstmt.FirstKeyword(req.Statement)
+	switch {
+	case readStatements[keyword] || sqlstmt.IsRead(req.Statement):
+		if err := s.check(ctx, reads, nil); err != nil {
+			return nil, err
+		}
+		return s.query(ctx, sess, req.Statement)
+	case sessionStatements[keyword]:
+		if sqlstmt.SetsGlobal(req.Statement) {
+			return nil, status.Error(codes.PermissionDenied, "global variables can't be set from a session")
+		}
+		if err := s.checkLocal(ctx, req.Statement, reads, writes); err != nil {
+			return nil, err
+		}
+		res, err := s.exec(ctx, sess, req.Statement)
+		if err != nil {
+			return nil, err
+		}
+		switch keyword {
+		case "begin", "start":
+			sess.inTx = true
+		case "commit", "rollback":
+			sess.inTx = false
+		}
+		return res, nil
+	}
+
+	if matches := tempTableRegex.FindStringSubmatch(req.Statement); matches != nil {
+		// CREATE TEMPORARY TABLE ... SELECT reads the tables it selects from
+		table := strings.ToLower(matches[2])
+		if err := s.checkLocal(ctx, req.Statement, reads, without(writes, table)); err != nil {
+			return nil, err
+		}
+		res, err := s.exec(ctx, sess, req.Statement)
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(matches[1], "create") {
+			sess.tempTables[table] = true
+		} else {
+			delete(sess.tempTables, table)
+		}
+		return res, nil
+	}
+	if len(writes) == 0 && sess.tempTables[strings.ToLower(sqlstmt.TargetTable(req.Statement))] {
+		// writes to temporary tables can still read replicated tables
+		if err := s.check(ctx, reads, nil); err != nil {
+			return nil, err
+		}
+		return s.exec(ctx, sess, req.Statement)
+	}
+
+	// writes to replicated tables are committed on their own, outside of the
+	// connection of the session, so they can't be part of its transaction
+	if sess.inTx {
+		return nil, status.Error(codes.FailedPrecondition, "writes to replicated tables can't run in a transaction: commit or roll it back first")
+	}
+	if len(writes) == 0 {
+		// writes without a target table, like procedure calls, can change
+		// any table
+		writes = []string{"*"}
+	}
+	if err := s.check(ctx, reads, writes); err != nil {
+		return nil, err
+	}
+	msg := req.Msg
+	if msg == "" {
+		msg = "SQL session " + sess.id
+	}
+	commit, err := s.commit(req.Statement, msg, req.Consistency)
+	if err != nil {
+		return nil, err
+	}
+	return &p2pproto.SessionStatementResponse{Commit: commit}, nil
+}
+
+func (s *Server) check(ctx context.Context, reads []string, writes []string) error {
+	if s.authorize == nil {
+		return nil
+	}
+	return s.authorize(ctx, reads, writes)
+}
+
+// checkLocal checks a statement that runs on the connection of the session,
+// outside of the cluster. It must not write replicated tables or call
+// procedures, like SET @x = dolt_reset(...), which would change the database
+// without being committed through the cluster.
+func (s *Server) checkLocal(ctx context.Context, statement string, reads []string, writes []string) error {
+	if len(writes) > 0 || sqlstmt.CallsProcedure(statement) {
+		return status.Error(codes.PermissionDenied, "statements run in the session can't write replicated tables or call procedures")
+	}
+	return s.check(ctx, reads, nil)
+}
+
+// without returns the tables other than table
+func without(tables []string, table string) []string {
+	rest := []string{}
+	for _, t := range tables {
+		if t != table {
+			rest = append(rest, t)
+		}
+	}
+	return rest
+}
+
+// replicated returns the tables that aren't temporary tables of the session
+func (sess *session) replicated(tables []string) []string {
+	replicated := []string{}
+	for _, table := range tables {
+		if !sess.tempTables[table] {
+			replicated = append(replicated, table)
+		}
+	}
+	return replicated
+}
+
+// query runs a read on the connection of the session
+func (s *Server) query(ctx context.Context, sess *session, query string) (*p2pproto.SessionStatementResponse, error) {
+	rows, err := sess.conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	res := &p2pproto.SessionStatementResponse{Columns: columns}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if len(res.Rows) >= s.cfg.MaxRows {
+			return nil, status.Errorf(codes.ResourceExhausted, "statement returned more than %d rows", s.cfg.MaxRows)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := &p2pproto.Row{Values: make([]string, len(columns))}
+		for i, value := range values {
+			row.Values[i] = value.String
+		}
+		res.Rows = append(res.Rows, row)
+	}
+	return res, rows.Err()
+}
+
+// exec runs a statement that only changes the state of the session
+func (s *Server) exec(ctx context.Context, sess *session, statement string) (*p2pproto.SessionStatementResponse, error) {
+	result, err := sess.conn.ExecContext(ctx, statement)
+	if err != nil {
+		return nil, err
+	}
+	res := &p2pproto.SessionStatementResponse{}
+	if affected, err := result.RowsAffected(); err == nil {
+		res.RowsAffected = affected
+	}
+	return res, nil
+}
+
+func (s *Server) Close(ctx context.Context, req *p2pproto.CloseSessionRequest) (*p2pproto.CloseSessionResponse, error) {
+	s.mtx.Lock()
+	sess, found := s.sessions[req.SessionId]
+	if !found || sess.owner != caller(ctx) {
+		s.mtx.Unlock()
+		return nil, status.Errorf(codes.NotFound, "session '%s' not found or expired", req.SessionId)
+	}
+	delete(s.sessions, sess.id)
+	sess.closed = true
+	s.mtx.Unlock()
+
+	s.discard(sess)
+	s.log.Debugf("Closed SQL session %s", sess.id)
+	return &p2pproto.CloseSessionResponse{}, nil
+}
+
+// reap closes the sessions that stayed idle for longer than their timeout
+func (s *Server) reap() {
+	now := s.now()
+	expired := []*session{}
+	s.mtx.Lock()
+	for id, sess := range s.sessions {
+		if !sess.busy && now.Sub(sess.lastUsed) > sess.idleTimeout {
+			sess.closed = true
+			delete(s.sessions, id)
+			expired = append(expired, sess)
+		}
+	}
+	s.mtx.Unlock()
+	for _, sess := range expired {
+		s.log.Infof("Closing SQL session %s of '%s' after %s idle", sess.id, sess.owner, sess.idleTimeout)
+		s.discard(sess)
+	}
+}
+
+// discard closes the connection of a session once its running statement is
+// done. The connection holds the temporary tables, variables and transaction
+// of the session, so it's dropped instead of going back to the pool.
+func (s *Server) discard(sess *session) {
+	sess.exec.Lock()
+	defer sess.exec.Unlock()
+	if sess.conn == nil {
+		return
+	}
+	// returning ErrBadConn closes the connection instead of releasing it
+	sess.conn.Raw(func(any) error { return driver.ErrBadConn })
+}
@@ -0,0 +1,197 @@
+package sessions
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeDriver records the statements run on every connection. Queries return
+// the number of the connection they ran on.
+type fakeDriver struct {
+	mtx        sync.Mutex
+	opened     int
+	closed     int
+	statements map[int][]string
+}
+
+func (d *fakeDriver) Connect(ctx context.Context) (driver.Conn, error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.opened++
+	return &fakeConn{driver: d, id: d.opened}, nil
+}
+
+func (d *fakeDriver) Driver() driver.Driver { return nil }
+
+func (d *fakeDriver) record(id int, statement string) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	d.statements[id] = append(d.statements[id], statement)
+}
+
+type fakeConn struct {
+	driver *fakeDriver
+	id     int
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *fakeConn) Close() error {
+	c.driver.mtx.Lock()
+	defer c.driver.mtx.Unlock()
+	c.driver.closed++
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.driver.record(c.id, query)
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.driver.record(c.id, query)
+	return &fakeRows{values: []int64{int64(c.id)}}, nil
+}
+
+type fakeRows struct {
+	values []int64
+}
+
+func (r *fakeRows) Columns() []string { return []string{"conn"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0] = r.values[0]
+	r.values = r.values[1:]
+	return nil
+}
+
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func TestSessions(t *testing.T) {
+	fake := &fakeDriver{statements: map[int][]string{}}
+	db := sql.OpenDB(fake)
+	defer db.Close()
+	commits := []string{}
+	commit := func(query string, msg string, consistency p2pproto.Consistency) (string, error) {
+		commits = append(commits, query)
+		return "c1", nil
+	}
+	authorize := func(ctx context.Context, reads []string, writes []string) error {
+		for _, table := range append(reads, writes...) {
+			if table == "secret" {
+				return status.Error(codes.PermissionDenied, "denied")
+			}
+		}
+		return nil
+	}
+	s := New(Config{MaxSessions: 2, MaxPerPeer: 2, IdleTimeout: time.Minute}, db, commit, authorize, testLogger())
+	ctx := context.Background()
+
+	open, err := s.Open(ctx, &p2pproto.OpenSessionRequest{IdleTimeoutMs: (2 * time.Hour).Milliseconds()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if open.IdleTimeoutMs != defaultMaxIdleTimeout.Milliseconds() {
+		t.Errorf("expected the idle timeout to be capped, got %dms", open.IdleTimeoutMs)
+	}
+	exec := func(statement string) (*p2pproto.SessionStatementResponse, error) {
+		return s.Execute(ctx, &p2pproto.SessionStatementRequest{SessionId: open.SessionId, Statement: statement})
+	}
+
+	// session statements, temporary tables and reads share a connection
+	for _, statement := range []string{
+		"SET @x = 1",
+		"CREATE TEMPORARY TABLE tmp (id INT)",
+		"INSERT INTO tmp SELECT id FROM testtable",
+		"SELECT * FROM tmp",
+	} {
+		if _, err := exec(statement); err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+	res, err := exec("SELECT @x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.statements) != 1 || len(res.Rows) != 1 || res.Rows[0].Values[0] != "1" {
+		t.Errorf("expected all statements on connection 1, got %v", fake.statements)
+	}
+
+	// writes to replicated tables are committed through the cluster
+	res, err = exec("INSERT INTO testtable VALUES (1)")
+	if err != nil || res.Commit != "c1" || len(commits) != 1 {
+		t.Errorf("expected the write to be committed, got %v (%v)", res, err)
+	}
+	for _, statement := range []string{
+		"DELETE FROM secret",
+		"UPDATE testtable JOIN secret ON testtable.id = secret.id SET testtable.id = 2",
+		"CREATE TEMPORARY TABLE copy SELECT * FROM secret",
+		"SET @x = (SELECT id FROM secret)",
+		"SET GLOBAL max_connections = 1",
+		"SET @x = dolt_reset('--hard', 'HEAD~1')",
+		"CREATE TEMPORARY TABLE reset AS SELECT dolt_reset('--hard', 'HEAD~1')",
+		"SET @x = 1; DELETE FROM testtable",
+	} {
+		if _, err := exec(statement); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("expected '%s' to be denied, got %v", statement, err)
+		}
+	}
+	// a WITH clause doesn't make a write a read
+	res, err = exec("WITH ids AS (SELECT 1) DELETE FROM testtable")
+	if err != nil || res.Commit != "c1" || len(commits) != 2 {
+		t.Errorf("expected the write to be committed, got %v (%v)", res, err)
+	}
+	// but not in a transaction
+	if _, err := exec("BEGIN"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exec("INSERT INTO testtable VALUES (2)"); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected writes to be refused in a transaction, got %v", err)
+	}
+	if info := s.Sessions(); len(info) != 1 || !info[0].InTx || len(info[0].TempTables) != 1 {
+		t.Errorf("unexpected sessions %+v", info)
+	}
+
+	// limits
+	if _, err := s.Open(ctx, &p2pproto.OpenSessionRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Open(ctx, &p2pproto.OpenSessionRequest{}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected the session limit to be enforced, got %v", err)
+	}
+
+	// idle sessions are closed and their connections discarded
+	s.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	s.reap()
+	if len(s.Sessions()) != 0 {
+		t.Errorf("expected idle sessions to be closed, got %+v", s.Sessions())
+	}
+	if _, err := exec("SELECT 1"); status.Code(err) != codes.NotFound {
+		t.Errorf("expected the session to be gone, got %v", err)
+	}
+	if fake.closed != 2 {
+		t.Errorf("expected the 2 connections to be closed, got %d", fake.closed)
+	}
+}
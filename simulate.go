@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/nustiueudinastea/doltswarmdemo/simulate"
+)
+
+// runSimulation replays a simulated concurrent workload with the given
+// conflict resolution strategies and prints how each of them behaved
+func runSimulation(cfg simulate.Config, strategyNames []string) error {
+	strategies := []simulate.Strategy{}
+	for _, name := range strategyNames {
+		strategy, err := simulate.ParseStrategy(name)
+		if err != nil {
+			return err
+		}
+		strategies = append(strategies, strategy)
+	}
+	results, err := simulate.Run(cfg, strategies...)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d nodes, %d rounds of %d writes, %.0f%% overlap, %.0f%% sync rate, seed %d\n\n",
+		cfg.Nodes, cfg.Rounds, cfg.WritesPerRound, cfg.Overlap*100, cfg.SyncRate*100, cfg.Seed)
+	fmt.Printf("%-8s %8s %10s %13s %11s %10s\n", "STRATEGY", "WRITES", "CONFLICTS", "CONFLICT RATE", "STALE WINS", "CONVERGED")
+	for _, result := range results {
+		converged := "yes"
+		if !result.Converged {
+			converged = fmt.Sprintf("no (%d cells)", result.DivergentCells)
+		}
+		fmt.Printf("%-8s %8d %10d %12.1f%% %11d %10s\n",
+			result.Strategy, result.Writes, result.Conflicts, result.ConflictRate()*100, result.StaleWins, converged)
+	}
+	return nil
+}
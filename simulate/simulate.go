@@ -0,0 +1,316 @@
+// Package simulate replays concurrent write workloads on in-memory replicas to
+// measure how often they conflict and how each conflict resolution strategy
+// behaves. Changes are merged cell by cell like Dolt merges, using a vector
+// clock per cell to tell causally ordered writes from concurrent ones. The
+// workload only depends on the seed, so every run is reproducible.
+package simulate
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/nustiueudinastea/doltswarmdemo/vclock"
+)
+
+// settleRounds bounds the number of full syncs run after the workload to let
+// the replicas converge
+const settleRounds = 10
+
+// Strategy resolves the conflicts found while merging a peer's changes
+type Strategy string
+
+const (
+	// Ours keeps the local value
+	Ours Strategy = "ours"
+	// Theirs keeps the value of the merged peer
+	Theirs Strategy = "theirs"
+	// LastWriterWins keeps the most recent write, breaking ties with the
+	// writer ID
+	LastWriterWins Strategy = "lww"
+)
+
+// Strategies are all the strategies, in report order
+var Strategies = []Strategy{Ours, Theirs, LastWriterWins}
+
+// ParseStrategy parses the name of a strategy
+func ParseStrategy(s string) (Strategy, error) {
+	for _, strategy := range Strategies {
+		if string(strategy) == s {
+			return strategy, nil
+		}
+	}
+	return "", fmt.Errorf("unknown strategy '%s', expected ours, theirs or lww", s)
+}
+
+// Config describes the simulated workload
+type Config struct {
+	Nodes int
+	// Rounds of writes. Every node writes WritesPerRound cells per round and
+	// then pulls from each peer with probability SyncRate.
+	Rounds         int
+	WritesPerRound int
+	SyncRate       float64
+	// Keys is the number of rows shared by all nodes, and the number of
+	// private rows of every node
+	Keys    int
+	Columns int
+	// Overlap is the probability that a write goes to a shared row instead of
+	// a private one
+	Overlap float64
+	Seed    int64
+}
+
+// Validate checks that the workload can be generated
+func (cfg Config) Validate() error {
+	switch {
+	case cfg.Nodes < 2:
+		return fmt.Errorf("the simulation needs at least 2 nodes")
+	case cfg.Rounds < 1 || cfg.WritesPerRound < 1:
+		return fmt.Errorf("the simulation needs at least 1 round of 1 write")
+	case cfg.Keys < 1 || cfg.Columns < 1:
+		return fmt.Errorf("the simulation needs at least 1 key and 1 column")
+	case cfg.Overlap < 0 || cfg.Overlap > 1:
+		return fmt.Errorf("overlap must be between 0 and 1")
+	case cfg.SyncRate < 0 || cfg.SyncRate > 1:
+		return fmt.Errorf("sync rate must be between 0 and 1")
+	}
+	return nil
+}
+
+// Result is the outcome of a workload under one strategy
+type Result struct {
+	Strategy Strategy
+	Writes   int
+	// Conflicts is the number of cells that had to be resolved while merging.
+	// Every conflict drops one of the two values.
+	Conflicts int
+	// StaleWins is the number of conflicts resolved with the older write
+	StaleWins int
+	// Converged is true if all replicas ended up identical
+	Converged bool
+	// DivergentCells is the number of cells that still differ between replicas
+	DivergentCells int
+}
+
+// ConflictRate returns the number of conflicts per write
+func (r Result) ConflictRate() float64 {
+	if r.Writes == 0 {
+		return 0
+	}
+	return float64(r.Conflicts) / float64(r.Writes)
+}
+
+type write struct {
+	node   int
+	cell   string
+	value  string
+	time   int
+	writer string
+}
+
+type pull struct {
+	node int
+	peer int
+}
+
+// step is either a write or a sync of a node from a peer
+type step struct {
+	write *write
+	pull  *pull
+}
+
+type cell struct {
+	value  string
+	writer string
+	time   int
+	clock  vclock.VClock
+}
+
+type replica struct {
+	id    string
+	cells map[string]cell
+}
+
+// generate builds the workload of the config. It only depends on the seed.
+func generate(cfg Config) []step {
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	steps := []step{}
+	time := 0
+	for round := 0; round < cfg.Rounds; round++ {
+		for node := 0; node < cfg.Nodes; node++ {
+			for i := 0; i < cfg.WritesPerRound; i++ {
+				time++
+				row := fmt.Sprintf("n%d-%d", node, rng.Intn(cfg.Keys))
+				if rng.Float64() < cfg.Overlap {
+					row = fmt.Sprintf("shared-%d", rng.Intn(cfg.Keys))
+				}
+				steps = append(steps, step{write: &write{
+					node:   node,
+					cell:   fmt.Sprintf("%s/c%d", row, rng.Intn(cfg.Columns)),
+					value:  fmt.Sprintf("%s@%d", nodeID(node), time),
+					time:   time,
+					writer: nodeID(node),
+				}})
+			}
+		}
+		for node := 0; node < cfg.Nodes; node++ {
+			for peer := 0; peer < cfg.Nodes; peer++ {
+				if peer != node && rng.Float64() < cfg.SyncRate {
+					steps = append(steps, step{pull: &pull{node: node, peer: peer}})
+				}
+			}
+		}
+	}
+	return steps
+}
+
+func nodeID(node int) string {
+	return fmt.Sprintf("node%d", node+1)
+}
+
+// simulation runs a workload with one strategy
+type simulation struct {
+	strategy Strategy
+	replicas []*replica
+	result   Result
+}
+
+func (s *simulation) apply(w *write) {
+	r := s.replicas[w.node]
+	clock := vclock.VClock{}
+	if prev, found := r.cells[w.cell]; found {
+		clock = prev.clock.Copy()
+	}
+	clock.Increment(r.id)
+	r.cells[w.cell] = cell{value: w.value, writer: w.writer, time: w.time, clock: clock}
+	s.result.Writes++
+}
+
+// resolve picks the value kept for a conflicting cell
+func (s *simulation) resolve(ours cell, theirs cell) cell {
+	s.result.Conflicts++
+	kept := ours
+	switch s.strategy {
+	case Theirs:
+		kept = theirs
+	case LastWriterWins:
+		if theirs.time > ours.time || (theirs.time == ours.time && theirs.writer > ours.writer) {
+			kept = theirs
+		}
+	}
+	if kept.time < ours.time || kept.time < theirs.time {
+		s.result.StaleWins++
+	}
+	kept.clock = ours.clock.Copy()
+	kept.clock.Merge(theirs.clock)
+	return kept
+}
+
+// merge pulls the cells of a peer into a replica and returns true if the
+// replica changed
+func (s *simulation) merge(r *replica, peer *replica) bool {
+	changed := false
+	for key, theirs := range peer.cells {
+		ours, found := r.cells[key]
+		if !found {
+			r.cells[key] = theirs
+			changed = true
+			continue
+		}
+		var merged cell
+		switch ours.clock.Compare(theirs.clock) {
+		case vclock.Before:
+			merged = theirs
+		case vclock.After:
+			continue
+		default:
+			// concurrent writes, or equal histories resolved differently
+			if ours.value == theirs.value {
+				if ours.clock.Compare(theirs.clock) == vclock.Equal {
+					continue
+				}
+				merged = ours
+				merged.clock = ours.clock.Copy()
+				merged.clock.Merge(theirs.clock)
+			} else {
+				merged = s.resolve(ours, theirs)
+			}
+		}
+		if merged.value != ours.value || merged.clock.Compare(ours.clock) != vclock.Equal {
+			r.cells[key] = merged
+			changed = true
+		}
+	}
+	return changed
+}
+
+// divergentCells counts the cells whose value is not the same on every replica
+func divergentCells(replicas []*replica) int {
+	keys := map[string]bool{}
+	for _, r := range replicas {
+		for key := range r.cells {
+			keys[key] = true
+		}
+	}
+	divergent := 0
+	for key := range keys {
+		first, found := replicas[0].cells[key]
+		for _, r := range replicas[1:] {
+			c, ok := r.cells[key]
+			if ok != found || c.value != first.value {
+				divergent++
+				break
+			}
+		}
+	}
+	return divergent
+}
+
+func run(cfg Config, steps []step, strategy Strategy) Result {
+	s := &simulation{strategy: strategy, result: Result{Strategy: strategy}}
+	for node := 0; node < cfg.Nodes; node++ {
+		s.replicas = append(s.replicas, &replica{id: nodeID(node), cells: map[string]cell{}})
+	}
+	for _, st := range steps {
+		if st.write != nil {
+			s.apply(st.write)
+		} else {
+			s.merge(s.replicas[st.pull.node], s.replicas[st.pull.peer])
+		}
+	}
+
+	// let every replica pull from every peer until nothing changes
+	for i := 0; i < settleRounds; i++ {
+		changed := false
+		for _, r := range s.replicas {
+			for _, peer := range s.replicas {
+				if peer != r && s.merge(r, peer) {
+					changed = true
+				}
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	s.result.DivergentCells = divergentCells(s.replicas)
+	s.result.Converged = s.result.DivergentCells == 0
+	return s.result
+}
+
+// Run replays the workload of the config with every strategy
+func Run(cfg Config, strategies ...Strategy) ([]Result, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if len(strategies) == 0 {
+		strategies = Strategies
+	}
+	steps := generate(cfg)
+	results := []Result{}
+	for _, strategy := range strategies {
+		results = append(results, run(cfg, steps, strategy))
+	}
+	return results, nil
+}
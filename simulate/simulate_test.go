@@ -0,0 +1,95 @@
+package simulate
+
+import (
+	"testing"
+)
+
+func testConfig() Config {
+	return Config{Nodes: 3, Rounds: 20, WritesPerRound: 5, SyncRate: 0.5, Keys: 10, Columns: 2, Overlap: 0.5, Seed: 42}
+}
+
+func TestRunIsDeterministic(t *testing.T) {
+	first, err := Run(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Run(testConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range first {
+		if first[i] != second[i] {
+			t.Errorf("expected identical results for the same seed, got %+v and %+v", first[i], second[i])
+		}
+	}
+}
+
+func TestRunWithoutOverlap(t *testing.T) {
+	cfg := testConfig()
+	cfg.Overlap = 0
+	results, err := Run(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Conflicts != 0 || !result.Converged {
+			t.Errorf("%s: expected private writes to never conflict, got %+v", result.Strategy, result)
+		}
+		if result.Writes != cfg.Nodes*cfg.Rounds*cfg.WritesPerRound {
+			t.Errorf("%s: unexpected number of writes %d", result.Strategy, result.Writes)
+		}
+	}
+}
+
+func TestLastWriterWins(t *testing.T) {
+	cfg := testConfig()
+	cfg.Overlap = 1
+	results, err := Run(cfg, LastWriterWins, Ours)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Conflicts == 0 || results[0].StaleWins != 0 || !results[0].Converged {
+		t.Errorf("expected lww to resolve conflicts with the latest write and converge, got %+v", results[0])
+	}
+	if results[1].StaleWins == 0 {
+		t.Errorf("expected keeping our version to sometimes keep the older write, got %+v", results[1])
+	}
+}
+
+func TestMergeCausalWrites(t *testing.T) {
+	s := &simulation{strategy: Ours}
+	a := &replica{id: "a", cells: map[string]cell{}}
+	b := &replica{id: "b", cells: map[string]cell{}}
+	s.replicas = []*replica{a, b}
+
+	s.apply(&write{node: 0, cell: "x", value: "1", time: 1, writer: "a"})
+	s.merge(b, a)
+	s.apply(&write{node: 1, cell: "x", value: "2", time: 2, writer: "b"})
+	s.merge(a, b)
+	if a.cells["x"].value != "2" || s.result.Conflicts != 0 {
+		t.Errorf("expected the later causal write to win without conflict, got %q with %d conflicts", a.cells["x"].value, s.result.Conflicts)
+	}
+
+	s.apply(&write{node: 0, cell: "x", value: "3", time: 3, writer: "a"})
+	s.apply(&write{node: 1, cell: "x", value: "4", time: 4, writer: "b"})
+	s.merge(a, b)
+	if a.cells["x"].value != "3" || s.result.Conflicts != 1 {
+		t.Errorf("expected a conflict resolved with our value, got %q with %d conflicts", a.cells["x"].value, s.result.Conflicts)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := testConfig()
+	cfg.Nodes = 1
+	if _, err := Run(cfg); err == nil {
+		t.Errorf("expected an error with a single node")
+	}
+	cfg = testConfig()
+	cfg.Overlap = 2
+	if _, err := Run(cfg); err == nil {
+		t.Errorf("expected an error with an overlap above 1")
+	}
+	if _, err := ParseStrategy("random"); err == nil {
+		t.Errorf("expected an error for an unknown strategy")
+	}
+}
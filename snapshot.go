@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/snapshot"
+)
+
+const snapshotFetchTimeout = 2 * time.Hour
+
+// snapshotInfo describes the snapshot the node was bootstrapped from, if any
+var snapshotInfo *snapshot.Info
+
+// bootstrapFromSnapshot fetches the database of a new node from a published
+// snapshot. The commits made after the snapshot are synced from the peers once
+// the node starts. Nodes that already have a database ignore the snapshot.
+func bootstrapFromSnapshot(dir string, url string, checksum string) error {
+	has, err := snapshot.HasDatabase(dir)
+	if err != nil {
+		return err
+	}
+	if has {
+		log.Infof("Database already exists, not bootstrapping it from snapshot %s", url)
+		return nil
+	}
+
+	log.Infof("Bootstrapping the database from snapshot %s", url)
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotFetchTimeout)
+	defer cancel()
+	info, err := snapshot.Fetch(ctx, url, checksum, dir)
+	if err != nil {
+		return fmt.Errorf("failed to bootstrap from snapshot: %w", err)
+	}
+	if checksum == "" {
+		log.Warnf("Snapshot %s was not verified, its SHA-256 is %s", url, info.SHA256)
+	}
+	log.Infof("Fetched snapshot of %d bytes in %s, syncing the newer commits from the peers", info.Bytes, info.Elapsed.Round(time.Millisecond))
+	snapshotInfo = &info
+	return nil
+}
+
+// writeSnapshot archives the database of the node to path, next to a
+// path.sha256 file with its checksum, for new nodes to bootstrap from once
+// it's published
+func writeSnapshot(dir string, path string) (int64, error) {
+	tmpFile := path + ".tmp"
+	f, err := os.Create(tmpFile)
+	if err != nil {
+		return 0, err
+	}
+	hash := sha256.New()
+	err = snapshot.Write(dir, io.MultiWriter(f, hash))
+	err = errors.Join(err, f.Close())
+	if err != nil {
+		os.Remove(tmpFile)
+		return 0, err
+	}
+	info, err := os.Stat(tmpFile)
+	if err != nil {
+		return 0, err
+	}
+	err = os.WriteFile(path+".sha256", []byte(hex.EncodeToString(hash.Sum(nil))+"\n"), 0644)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), os.Rename(tmpFile, path)
+}
@@ -0,0 +1,256 @@
+// Package snapshot archives the databases of a node, and bootstraps new nodes
+// from an archive published on a URL, e.g. a nightly snapshot on S3 or any
+// HTTP server. A bootstrapped node only has to sync the commits made after the
+// snapshot from its peers, instead of the whole history.
+package snapshot
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// doltDir is the directory of a database. Only these directories are
+// archived, so that snapshots don't carry the keys or the state of the node.
+const doltDir = ".dolt"
+
+// Info describes a fetched snapshot
+type Info struct {
+	URL       string        `json:"url"`
+	Bytes     int64         `json:"bytes"`
+	SHA256    string        `json:"sha256"`
+	Elapsed   time.Duration `json:"elapsed"`
+	FetchedAt time.Time     `json:"fetched_at"`
+}
+
+// databases returns the database directories kept in dir or in its
+// subdirectories, relative to dir
+func databases(dir string) ([]string, error) {
+	found := []string{}
+	if info, err := os.Stat(filepath.Join(dir, doltDir)); err == nil && info.IsDir() {
+		found = append(found, doltDir)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		rel := filepath.Join(entry.Name(), doltDir)
+		if info, err := os.Stat(filepath.Join(dir, rel)); err == nil && info.IsDir() {
+			found = append(found, rel)
+		}
+	}
+	return found, nil
+}
+
+// HasDatabase returns true if dir already keeps a database
+func HasDatabase(dir string) (bool, error) {
+	found, err := databases(dir)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return len(found) > 0, err
+}
+
+// Write archives the databases kept in dir as a gzipped tar. The files of a
+// running database can change while they are archived: table files are
+// immutable, and a journal record torn by the copy is truncated by the startup
+// check of the node the snapshot is restored on.
+func Write(dir string, w io.Writer) error {
+	found, err := databases(dir)
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		return fmt.Errorf("no database in '%s'", dir)
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, db := range found {
+		err = filepath.Walk(filepath.Join(dir, db), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() && !info.IsDir() {
+				return nil
+			}
+			name, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			hdr, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			hdr.Name = filepath.ToSlash(name)
+			if err = tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			// files that grew since they were listed are archived at the
+			// size they had then
+			_, err = io.CopyN(tw, f, info.Size())
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Extract unpacks a snapshot written by Write into dir
+func Extract(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.FromSlash(hdr.Name)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("invalid path '%s' in snapshot", hdr.Name)
+		}
+		path := filepath.Join(dir, name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0700)
+		case tar.TypeReg:
+			err = writeFile(path, tr, os.FileMode(hdr.Mode).Perm())
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeFile(path string, r io.Reader, perm os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	return errors.Join(err, f.Close())
+}
+
+// Fetch downloads the snapshot at rawURL and extracts it into dir. If checksum
+// is set, the snapshot must have this SHA-256 hash. The snapshot is extracted
+// in a hidden directory of dir and moved in place once it's complete and
+// verified, so that a failed fetch leaves no partial database behind.
+func Fetch(ctx context.Context, rawURL string, checksum string, dir string) (Info, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Info{}, fmt.Errorf("invalid snapshot URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return Info{}, fmt.Errorf("unsupported snapshot URL '%s', expected http or https", rawURL)
+	}
+
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return Info{}, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Info{}, fmt.Errorf("failed to download snapshot: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Info{}, fmt.Errorf("failed to download snapshot: %s", resp.Status)
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return Info{}, err
+	}
+	tmpDir, err := os.MkdirTemp(dir, ".snapshot-")
+	if err != nil {
+		return Info{}, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	hash := sha256.New()
+	counter := &countingReader{r: io.TeeReader(resp.Body, hash)}
+	err = Extract(counter, tmpDir)
+	if err == nil {
+		// the padding after the end of the archive is part of the checksum
+		_, err = io.Copy(io.Discard, counter)
+	}
+	if err != nil {
+		return Info{}, fmt.Errorf("failed to extract snapshot: %w", err)
+	}
+	info := Info{URL: rawURL, Bytes: counter.n, SHA256: hex.EncodeToString(hash.Sum(nil)), FetchedAt: time.Now()}
+	if checksum != "" && !strings.EqualFold(checksum, info.SHA256) {
+		return Info{}, fmt.Errorf("snapshot checksum mismatch: expected %s, got %s", checksum, info.SHA256)
+	}
+
+	found, err := databases(tmpDir)
+	if err != nil {
+		return Info{}, err
+	}
+	if len(found) == 0 {
+		return Info{}, fmt.Errorf("snapshot '%s' has no database", rawURL)
+	}
+	for _, db := range found {
+		target := filepath.Join(dir, db)
+		if _, err := os.Stat(target); err == nil {
+			return Info{}, fmt.Errorf("database '%s' already exists", target)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return Info{}, err
+		}
+		if err := os.Rename(filepath.Join(tmpDir, db), target); err != nil {
+			return Info{}, err
+		}
+	}
+	info.Elapsed = time.Since(start)
+	return info, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
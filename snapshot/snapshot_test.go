@@ -0,0 +1,82 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	src := t.TempDir()
+	writeTestFile(t, filepath.Join(src, "doltswarmdemo", ".dolt", "noms", "manifest"), "manifest")
+	writeTestFile(t, filepath.Join(src, "doltswarmdemo", ".dolt", "noms", "journal"), "journal")
+	writeTestFile(t, filepath.Join(src, "key"), "private key")
+
+	archive := &bytes.Buffer{}
+	if err := Write(src, archive); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(archive.Bytes())
+	checksum := hex.EncodeToString(sum[:])
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/nightly.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(archive.Bytes())
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	// a snapshot that doesn't match its checksum leaves nothing behind
+	dst := t.TempDir()
+	if _, err := Fetch(ctx, srv.URL+"/nightly.tar.gz", "00", dst); err == nil {
+		t.Fatal("expected the checksum mismatch to fail the fetch")
+	}
+	if has, err := HasDatabase(dst); has || err != nil {
+		t.Fatalf("expected no database after a failed fetch, got %t (%v)", has, err)
+	}
+	if _, err := Fetch(ctx, srv.URL+"/missing.tar.gz", "", dst); err == nil {
+		t.Error("expected a missing snapshot to fail the fetch")
+	}
+
+	info, err := Fetch(ctx, srv.URL+"/nightly.tar.gz", checksum, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Bytes != int64(archive.Len()) || info.SHA256 != checksum {
+		t.Errorf("unexpected snapshot info %+v", info)
+	}
+	data, err := os.ReadFile(filepath.Join(dst, "doltswarmdemo", ".dolt", "noms", "journal"))
+	if err != nil || string(data) != "journal" {
+		t.Errorf("expected the journal to be restored, got %q (%v)", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "key")); !os.IsNotExist(err) {
+		t.Error("expected the files of the node to be left out of the snapshot")
+	}
+	entries, _ := os.ReadDir(dst)
+	if len(entries) != 1 {
+		t.Errorf("expected only the database in the directory, got %d entries", len(entries))
+	}
+
+	// existing databases are not overwritten
+	if _, err := Fetch(ctx, srv.URL+"/nightly.tar.gz", checksum, dst); err == nil {
+		t.Error("expected the fetch to refuse to overwrite the database")
+	}
+}
@@ -0,0 +1,314 @@
+package sqlserver
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dolthub/vitess/go/mysql"
+	"github.com/dolthub/vitess/go/sqltypes"
+	querypb "github.com/dolthub/vitess/go/vt/proto/query"
+	"github.com/dolthub/vitess/go/vt/sqlparser"
+	"github.com/nustiueudinastea/doltswarmdemo/author"
+	"github.com/nustiueudinastea/doltswarmdemo/sqlstmt"
+	"github.com/sirupsen/logrus"
+)
+
+const connTimeout = 10 * time.Minute
+
+// readStatements are read like SELECTs, which are recognized by parsing them,
+// so that SELECTs with side effects are committed like writes
+var readStatements = map[string]bool{
+	"show":     true,
+	"describe": true,
+	"desc":     true,
+	"explain":  true,
+}
+
+// session statements are accepted but have no effect: every write is
+// committed on its own and replicated to the cluster
+var sessionStatements = map[string]bool{
+	"set":      true,
+	"use":      true,
+	"begin":    true,
+	"start":    true,
+	"commit":   true,
+	"rollback": true,
+}
+
+// setAuthor matches the statement that sets the author of the session's writes
+var setAuthor = regexp.MustCompile(`(?i)^\s*set\s+@author\s*=\s*'([^']*)'\s*;?\s*$`)
+
+var _ mysql.Handler = (*Handler)(nil)
+
+// Querier runs read only queries
+type Querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// CommitFunc executes a write and commits it, returning the commit hash
+type CommitFunc func(query string, commitMsg string) (string, error)
+
+// Config configures the MySQL endpoint
+type Config struct {
+	Addr string
+	// User and Password are required from clients
+	User     string
+	Password string
+	// Decrypt is optional. It returns the plaintext of the encrypted values
+	// read by clients
+	Decrypt func(value string) string
+}
+
+// Handler serves MySQL clients: reads are executed on the local database and
+// writes are committed through the cluster, like any other write.
+// Clients can set the author of their writes with SET @author = 'Name <email>'.
+type Handler struct {
+	db      Querier
+	commit  CommitFunc
+	decrypt func(value string) string
+	log     *logrus.Logger
+
+	mtx     sync.Mutex
+	authors map[uint32]author.Author
+}
+
+// Start listens for MySQL clients on the configured address
+func Start(cfg Config, db Querier, commit CommitFunc, logger *logrus.Logger) (func() error, error) {
+	if cfg.User == "" || cfg.Password == "" {
+		return nil, errors.New("SQL server requires a user and a password")
+	}
+	users, err := json.Marshal(map[string][]*mysql.AuthServerStaticEntry{
+		cfg.User: {{Password: cfg.Password}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	authServer := mysql.NewAuthServerStatic("", string(users), 0)
+
+	handler := &Handler{db: db, commit: commit, decrypt: cfg.Decrypt, log: logger, authors: map[uint32]author.Author{}}
+	listener, err := mysql.NewListener("tcp", cfg.Addr, authServer, handler, connTimeout, connTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for SQL clients: %w", err)
+	}
+	go listener.Accept()
+	logger.Infof("Serving MySQL clients on %s", cfg.Addr)
+
+	stopper := func() error {
+		listener.Close()
+		return nil
+	}
+	return stopper, nil
+}
+
+func (h *Handler) NewConnection(c *mysql.Conn) {
+	h.log.Debugf("SQL client %d connected from %s", c.ConnectionID, c.RemoteAddr())
+}
+
+func (h *Handler) ConnectionClosed(c *mysql.Conn) {
+	h.mtx.Lock()
+	delete(h.authors, c.ConnectionID)
+	h.mtx.Unlock()
+	h.log.Debugf("SQL client %d disconnected", c.ConnectionID)
+}
+
+func (h *Handler) ComInitDB(c *mysql.Conn, schemaName string) error {
+	return nil
+}
+
+func (h *Handler) ComQuery(c *mysql.Conn, query string, callback mysql.ResultSpoolFn) error {
+	result, err := h.execute(c, query)
+	if err != nil {
+		return err
+	}
+	return callback(result, false)
+}
+
+// execute runs reads locally and commits writes through the cluster
+func (h *Handler) execute(c *mysql.Conn, query string) (*sqltypes.Result, error) {
+	keyword := sqlstmt.FirstKeyword(query)
+	switch {
+	case readStatements[keyword] || sqlstmt.IsRead(query):
+		return h.read(query)
+	case keyword == "set" && setAuthor.MatchString(query):
+		a, err := author.Parse(setAuthor.FindStringSubmatch(query)[1])
+		if err != nil {
+			return nil, err
+		}
+		h.mtx.Lock()
+		h.authors[c.ConnectionID] = a
+		h.mtx.Unlock()
+		return &sqltypes.Result{}, nil
+	case sessionStatements[keyword]:
+		return &sqltypes.Result{}, nil
+	default:
+		msg := fmt.Sprintf("SQL client %d: %s", c.ConnectionID, c.User)
+		h.mtx.Lock()
+		a, found := h.authors[c.ConnectionID]
+		h.mtx.Unlock()
+		if found {
+			msg = author.Annotate(msg, a)
+		}
+		commit, err := h.commit(query, msg)
+		if err != nil {
+			return nil, err
+		}
+		return &sqltypes.Result{Info: "commit " + commit}, nil
+	}
+}
+
+// ComMultiQuery executes the first statement and returns the remaining ones.
+// Every write statement is committed separately.
+func (h *Handler) ComMultiQuery(c *mysql.Conn, query string, callback mysql.ResultSpoolFn) (string, error) {
+	statement, remainder, err := sqlparser.SplitStatement(query)
+	if err != nil {
+		return "", err
+	}
+	return remainder, h.ComQuery(c, statement, callback)
+}
+
+// ComPrepare accepts the statement. The result columns are only reported when
+// the statement is executed.
+func (h *Handler) ComPrepare(c *mysql.Conn, query string, prepare *mysql.PrepareData) ([]*querypb.Field, error) {
+	return nil, nil
+}
+
+// ComStmtExecute binds the parameters into the statement and executes it like
+// a regular query, so writes are committed with their final values.
+func (h *Handler) ComStmtExecute(c *mysql.Conn, prepare *mysql.PrepareData, callback func(*sqltypes.Result) error) error {
+	query, err := bindParams(prepare)
+	if err != nil {
+		return err
+	}
+	result, err := h.execute(c, query)
+	if err != nil {
+		return err
+	}
+	return callback(result)
+}
+
+func (h *Handler) WarningCount(c *mysql.Conn) uint16 {
+	return 0
+}
+
+func (h *Handler) ComResetConnection(c *mysql.Conn) error {
+	return nil
+}
+
+func (h *Handler) ParserOptionsForConnection(c *mysql.Conn) (sqlparser.ParserOptions, error) {
+	return sqlparser.ParserOptions{}, nil
+}
+
+// read runs the query and returns all its columns as strings
+func (h *Handler) read(query string) (*sqltypes.Result, error) {
+	rows, err := h.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	result := &sqltypes.Result{}
+	for i, column := range columns {
+		fieldType := columnType(columnTypes[i].DatabaseTypeName())
+		result.Fields = append(result.Fields, &querypb.Field{Name: column, Type: fieldType, Charset: mysql.CharacterSetUtf8})
+	}
+
+	values := make([]sql.RawBytes, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		err = rows.Scan(ptrs...)
+		if err != nil {
+			return nil, err
+		}
+		row := make([]sqltypes.Value, len(columns))
+		for i, value := range values {
+			if value == nil {
+				row[i] = sqltypes.NULL
+				continue
+			}
+			if h.decrypt != nil {
+				row[i] = sqltypes.MakeTrusted(result.Fields[i].Type, []byte(h.decrypt(string(value))))
+				continue
+			}
+			row[i] = sqltypes.MakeTrusted(result.Fields[i].Type, append([]byte{}, value...))
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, rows.Err()
+}
+
+// bindParams returns the prepared statement with its parameters replaced by
+// the bound values
+func bindParams(prepare *mysql.PrepareData) (string, error) {
+	if prepare.ParamsCount == 0 {
+		return prepare.PrepareStmt, nil
+	}
+	statement, err := sqlparser.Parse(prepare.PrepareStmt)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse prepared statement: %w", err)
+	}
+	return sqlparser.NewParsedQuery(statement).GenerateQuery(prepare.BindVars, nil)
+}
+
+// columnType maps the database type of a column to its MySQL protocol type.
+// Unknown types are sent as strings.
+func columnType(dbType string) querypb.Type {
+	dbType = strings.ToUpper(dbType)
+	unsigned := strings.HasPrefix(dbType, "UNSIGNED ")
+	dbType = strings.TrimPrefix(dbType, "UNSIGNED ")
+	if t, found := intTypes[dbType]; found {
+		if unsigned {
+			return t[1]
+		}
+		return t[0]
+	}
+	if t, found := columnTypes[dbType]; found {
+		return t
+	}
+	return querypb.Type_VARCHAR
+}
+
+// intTypes maps integer types to their signed and unsigned protocol types
+var intTypes = map[string][2]querypb.Type{
+	"TINYINT":   {querypb.Type_INT8, querypb.Type_UINT8},
+	"SMALLINT":  {querypb.Type_INT16, querypb.Type_UINT16},
+	"MEDIUMINT": {querypb.Type_INT24, querypb.Type_UINT24},
+	"INT":       {querypb.Type_INT32, querypb.Type_UINT32},
+	"BIGINT":    {querypb.Type_INT64, querypb.Type_UINT64},
+}
+
+var columnTypes = map[string]querypb.Type{
+	"FLOAT":     querypb.Type_FLOAT32,
+	"DOUBLE":    querypb.Type_FLOAT64,
+	"DECIMAL":   querypb.Type_DECIMAL,
+	"DATE":      querypb.Type_DATE,
+	"DATETIME":  querypb.Type_DATETIME,
+	"TIMESTAMP": querypb.Type_TIMESTAMP,
+	"TIME":      querypb.Type_TIME,
+	"YEAR":      querypb.Type_YEAR,
+	"CHAR":      querypb.Type_CHAR,
+	"TEXT":      querypb.Type_TEXT,
+	"BLOB":      querypb.Type_BLOB,
+	"BINARY":    querypb.Type_BINARY,
+	"VARBINARY": querypb.Type_VARBINARY,
+	"BIT":       querypb.Type_BIT,
+	"JSON":      querypb.Type_JSON,
+	"ENUM":      querypb.Type_ENUM,
+	"SET":       querypb.Type_SET,
+}
@@ -0,0 +1,31 @@
+package sqlserver
+
+import (
+	"testing"
+
+	querypb "github.com/dolthub/vitess/go/vt/proto/query"
+	"github.com/sirupsen/logrus"
+)
+
+func TestColumnType(t *testing.T) {
+	cases := map[string]querypb.Type{
+		"BIGINT":          querypb.Type_INT64,
+		"unsigned bigint": querypb.Type_UINT64,
+		"DATETIME":        querypb.Type_DATETIME,
+		"VARCHAR":         querypb.Type_VARCHAR,
+		"GEOMETRY":        querypb.Type_VARCHAR,
+	}
+	for dbType, expected := range cases {
+		if fieldType := columnType(dbType); fieldType != expected {
+			t.Errorf("expected %s for %s, got %s", expected, dbType, fieldType)
+		}
+	}
+}
+
+func TestStartRequiresCredentials(t *testing.T) {
+	for _, cfg := range []Config{{Addr: "127.0.0.1:0"}, {Addr: "127.0.0.1:0", User: "app"}} {
+		if _, err := Start(cfg, nil, nil, logrus.New()); err == nil {
+			t.Errorf("expected %+v to be refused", cfg)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package sqlstmt
+
+import (
+	"strings"
+
+	"github.com/dolthub/vitess/go/vt/sqlparser"
+)
+
+// Kind is what a statement does
+type Kind int
+
+const (
+	// Other statements change the schema, the session or the server
+	Other Kind = iota
+	// Read statements are SELECT and UNION queries without side effects
+	Read
+	// Write statements are INSERT, REPLACE, UPDATE and DELETE
+	Write
+)
+
+// doltProcedures are the Dolt stored procedures that can also be called as
+// functions from a SELECT, and change the database
+var doltProcedures = map[string]bool{
+	"dolt_add":                true,
+	"dolt_backup":             true,
+	"dolt_branch":             true,
+	"dolt_checkout":           true,
+	"dolt_cherry_pick":        true,
+	"dolt_clean":              true,
+	"dolt_clone":              true,
+	"dolt_commit":             true,
+	"dolt_conflicts_resolve":  true,
+	"dolt_fetch":              true,
+	"dolt_gc":                 true,
+	"dolt_merge":              true,
+	"dolt_pull":               true,
+	"dolt_push":               true,
+	"dolt_rebase":             true,
+	"dolt_remote":             true,
+	"dolt_reset":              true,
+	"dolt_revert":             true,
+	"dolt_stash":              true,
+	"dolt_tag":                true,
+	"dolt_undrop":             true,
+	"dolt_verify_constraints": true,
+}
+
+// Classify parses a single statement and returns what it does. A WITH clause
+// doesn't make a statement a read, and SELECTs writing to files or variables,
+// or calling Dolt procedures, are not reads. Several statements, or
+// statements that can't be parsed, return an error.
+func Classify(statement string) (Kind, error) {
+	parsed, err := sqlparser.Parse(statement)
+	if err != nil {
+		return Other, err
+	}
+	switch s := parsed.(type) {
+	case sqlparser.SelectStatement:
+		if s.GetInto() != nil || callsProcedure(s) {
+			return Other, nil
+		}
+		return Read, nil
+	case *sqlparser.Insert, *sqlparser.Update, *sqlparser.Delete:
+		return Write, nil
+	default:
+		return Other, nil
+	}
+}
+
+// IsRead returns true if the statement is a single query without side effects
+func IsRead(statement string) bool {
+	kind, err := Classify(statement)
+	return err == nil && kind == Read
+}
+
+// CallsProcedure returns true if any statement of a query calls a procedure,
+// or calls a Dolt procedure as a function, like SET @x = dolt_reset(...).
+// Statements that can't be parsed are assumed to.
+func CallsProcedure(query string) bool {
+	pieces, err := sqlparser.SplitStatementToPieces(query)
+	if err != nil {
+		return true
+	}
+	for _, piece := range pieces {
+		if strings.TrimSpace(piece) == "" {
+			continue
+		}
+		parsed, err := sqlparser.Parse(piece)
+		if err != nil {
+			return true
+		}
+		if _, ok := parsed.(*sqlparser.Call); ok || callsProcedure(parsed) {
+			return true
+		}
+		if ddl, ok := parsed.(*sqlparser.DDL); ok {
+			for _, nested := range ddlStatements(ddl) {
+				if callsProcedure(nested) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func callsProcedure(node sqlparser.SQLNode) bool {
+	found := false
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if f, ok := node.(*sqlparser.FuncExpr); ok && doltProcedures[strings.ToLower(f.Name.String())] {
+			found = true
+		}
+		return !found, nil
+	}, node)
+	return found
+}
+
+// Tables parses the statements of a query, separated by semicolons, and
+// returns every table they reference, lower cased, whether they read or write
+// it. Table functions, like dolt_diff(), are returned by name, since they read
+// tables too, but common table expressions are not tables. Statements that
+// can't be parsed return an error.
+func Tables(query string) ([]string, error) {
+	pieces, err := sqlparser.SplitStatementToPieces(query)
+	if err != nil {
+		return nil, err
+	}
+	referenced := []string{}
+	seen := map[string]bool{}
+	ctes := map[string]bool{}
+	add := func(name string) {
+		name = strings.ToLower(name)
+		if name != "" && !seen[name] {
+			seen[name] = true
+			referenced = append(referenced, name)
+		}
+	}
+	var visit sqlparser.Visit
+	visit = func(node sqlparser.SQLNode) (bool, error) {
+		switch n := node.(type) {
+		case sqlparser.TableName:
+			add(n.Name.String())
+		case *sqlparser.TableFuncExpr:
+			add(n.Name)
+		case *sqlparser.CommonTableExpr:
+			if n.AliasedTableExpr != nil {
+				ctes[strings.ToLower(n.As.String())] = true
+			}
+		case *sqlparser.DDL:
+			// the walk of DDL statements stops at the tables they change
+			for _, sub := range ddlStatements(n) {
+				_ = sqlparser.Walk(visit, sub)
+			}
+		}
+		return true, nil
+	}
+	for _, piece := range pieces {
+		if strings.TrimSpace(piece) == "" {
+			continue
+		}
+		parsed, err := sqlparser.Parse(piece)
+		if err != nil {
+			return nil, err
+		}
+		_ = sqlparser.Walk(visit, parsed)
+	}
+	tables := []string{}
+	for _, name := range referenced {
+		if !ctes[name] {
+			tables = append(tables, name)
+		}
+	}
+	return tables, nil
+}
+
+// ddlStatements returns the statements nested in a DDL statement, like the
+// SELECT of CREATE TABLE ... SELECT or the body of a trigger
+func ddlStatements(ddl *sqlparser.DDL) []sqlparser.SQLNode {
+	nested := []sqlparser.SQLNode{}
+	if ddl.OptSelect != nil {
+		nested = append(nested, ddl.OptSelect.Select)
+	}
+	if ddl.ViewSpec != nil {
+		nested = append(nested, ddl.ViewSpec.ViewName)
+		if ddl.ViewSpec.ViewExpr != nil {
+			nested = append(nested, ddl.ViewSpec.ViewExpr)
+		}
+	}
+	if ddl.TriggerSpec != nil && ddl.TriggerSpec.Body != nil {
+		nested = append(nested, ddl.TriggerSpec.Body)
+	}
+	if ddl.ProcedureSpec != nil && ddl.ProcedureSpec.Body != nil {
+		nested = append(nested, ddl.ProcedureSpec.Body)
+	}
+	if ddl.EventSpec != nil && ddl.EventSpec.Body != nil {
+		nested = append(nested, ddl.EventSpec.Body)
+	}
+	return nested
+}
+
+// Access parses the statements of a query and returns the tables they read
+// and the tables they write, like the target of an INSERT, every table of a
+// multi-table UPDATE or the table created by CREATE TABLE ... SELECT. A table
+// that is written isn't also returned as read.
+func Access(query string) (reads []string, writes []string, err error) {
+	tables, err := Tables(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	pieces, err := sqlparser.SplitStatementToPieces(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	written := map[string]bool{}
+	for _, piece := range pieces {
+		if strings.TrimSpace(piece) == "" {
+			continue
+		}
+		parsed, err := sqlparser.Parse(piece)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, node := range writeTargets(parsed) {
+			_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+				if t, ok := node.(sqlparser.TableName); ok && !t.Name.IsEmpty() {
+					written[strings.ToLower(t.Name.String())] = true
+				}
+				return true, nil
+			}, node)
+		}
+	}
+	reads, writes = []string{}, []string{}
+	for _, table := range tables {
+		if written[table] {
+			writes = append(writes, table)
+		} else {
+			reads = append(reads, table)
+		}
+	}
+	return reads, writes, nil
+}
+
+// writeTargets returns the nodes of a statement naming the tables it writes
+func writeTargets(statement sqlparser.Statement) []sqlparser.SQLNode {
+	switch s := statement.(type) {
+	case *sqlparser.Insert:
+		return []sqlparser.SQLNode{s.Table}
+	case *sqlparser.Update:
+		return []sqlparser.SQLNode{s.TableExprs}
+	case *sqlparser.Delete:
+		if len(s.Targets) > 0 {
+			return []sqlparser.SQLNode{s.Targets}
+		}
+		return []sqlparser.SQLNode{s.TableExprs}
+	case *sqlparser.DDL:
+		targets := []sqlparser.SQLNode{}
+		for _, t := range s.AffectedTables() {
+			targets = append(targets, t)
+		}
+		if s.ViewSpec != nil {
+			targets = append(targets, s.ViewSpec.ViewName)
+		}
+		return targets
+	default:
+		return nil
+	}
+}
+
+// SetsGlobal returns true if the statement sets a global or persisted system
+// variable, which changes the server for every connection. Statements that
+// can't be parsed don't.
+func SetsGlobal(statement string) bool {
+	parsed, err := sqlparser.Parse(statement)
+	if err != nil {
+		return false
+	}
+	set, ok := parsed.(*sqlparser.Set)
+	if !ok {
+		return false
+	}
+	for _, expr := range set.Exprs {
+		switch expr.Scope {
+		case sqlparser.SetScope_Global, sqlparser.SetScope_Persist, sqlparser.SetScope_PersistOnly:
+			return true
+		}
+	}
+	return false
+}
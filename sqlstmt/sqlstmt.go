@@ -0,0 +1,154 @@
+package sqlstmt
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/dolthub/vitess/go/vt/sqlparser"
+)
+
+var tableRegex = regexp.MustCompile("(?i)^\\s*(?:insert\\s+(?:ignore\\s+)?into|replace\\s+into|update|delete\\s+from)\\s+`?([A-Za-z0-9_.]+)`?")
+
+// TargetTable returns the table targeted by a write statement, or an empty
+// string if it can't be determined
+func TargetTable(statement string) string {
+	matches := tableRegex.FindStringSubmatch(statement)
+	if len(matches) < 2 {
+		return ""
+	}
+	return matches[1]
+}
+
+// historyTablePrefixes are the prefixes of the Dolt system tables exposing the
+// history of every table
+var historyTablePrefixes = []string{"dolt_history_", "dolt_diff_", "dolt_commit_diff_"}
+
+// historyTables are the Dolt system tables and table functions reading the
+// commit graph
+var historyTables = map[string]bool{
+	"dolt_log":              true,
+	"dolt_commits":          true,
+	"dolt_commit_ancestors": true,
+	"dolt_diff":             true,
+	"dolt_diff_stat":        true,
+	"dolt_diff_summary":     true,
+	"dolt_patch":            true,
+	"dolt_schema_diff":      true,
+	"dolt_query_diff":       true,
+	"dolt_column_diff":      true,
+	"dolt_blame":            true,
+	"dolt_history":          true,
+	"dolt_merge_base":       true,
+	"dolt_reflog":           true,
+}
+
+func isHistoryTable(name string) bool {
+	name = strings.ToLower(name)
+	if historyTables[name] {
+		return true
+	}
+	for _, prefix := range historyTablePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadsHistory returns true if a query reads past commits, with AS OF or
+// through the Dolt system tables and table functions exposing the history.
+// Statements that can't be parsed don't.
+func ReadsHistory(query string) bool {
+	parsed, err := sqlparser.Parse(query)
+	if err != nil {
+		return false
+	}
+	history := false
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch n := node.(type) {
+		case *sqlparser.AliasedTableExpr:
+			if n.AsOf != nil {
+				history = true
+			}
+		case sqlparser.TableName:
+			if isHistoryTable(n.Name.String()) {
+				history = true
+			}
+		case *sqlparser.TableFuncExpr:
+			if isHistoryTable(n.Name) {
+				history = true
+			}
+		}
+		return !history, nil
+	}, parsed)
+	return history
+}
+
+// CountRows returns the number of value tuples of an INSERT or REPLACE
+// statement. Other statements count as a single row.
+func CountRows(statement string) int {
+	idx := strings.Index(strings.ToUpper(statement), "VALUES")
+	if idx < 0 {
+		return 1
+	}
+
+	rows := 0
+	depth := 0
+	var quote rune
+	escaped := false
+	for _, c := range statement[idx+len("VALUES"):] {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if c == '\\' {
+				escaped = true
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			if depth == 0 {
+				rows++
+			}
+			depth++
+		case c == ')':
+			depth--
+		}
+	}
+	if rows == 0 {
+		return 1
+	}
+	return rows
+}
+
+// FirstKeyword returns the lower case first word of a statement, skipping
+// leading comments
+func FirstKeyword(query string) string {
+	query = strings.TrimSpace(query)
+	for {
+		switch {
+		case strings.HasPrefix(query, "/*"):
+			end := strings.Index(query, "*/")
+			if end < 0 {
+				return ""
+			}
+			query = strings.TrimSpace(query[end+2:])
+		case strings.HasPrefix(query, "--") || strings.HasPrefix(query, "#"):
+			end := strings.Index(query, "\n")
+			if end < 0 {
+				return ""
+			}
+			query = strings.TrimSpace(query[end+1:])
+		default:
+			fields := strings.FieldsFunc(query, func(r rune) bool {
+				return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '(' || r == ';'
+			})
+			if len(fields) == 0 {
+				return ""
+			}
+			return strings.ToLower(fields[0])
+		}
+	}
+}
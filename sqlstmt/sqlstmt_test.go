@@ -0,0 +1,110 @@
+package sqlstmt
+
+import (
+	"testing"
+)
+
+func TestCountRows(t *testing.T) {
+	cases := map[string]int{
+		"INSERT INTO t (id, name) VALUES ('1', 'a')":                    1,
+		"INSERT INTO t (id, name) VALUES ('1', 'a'), ('2', 'b(c)')":     2,
+		"INSERT INTO t VALUES ('1', 'it''s'), ('2', 'x'), ('3', '\\'')": 3,
+		"UPDATE t SET name = 'a' WHERE id = '1'":                        1,
+	}
+	for stmt, expected := range cases {
+		if rows := CountRows(stmt); rows != expected {
+			t.Errorf("expected %d rows for %q, got %d", expected, stmt, rows)
+		}
+	}
+}
+
+func TestTableName(t *testing.T) {
+	cases := map[string]string{
+		"INSERT INTO testtable (id) VALUES (1)": "testtable",
+		"insert ignore into `other` VALUES (1)": "other",
+		"UPDATE db.t SET a = 1":                 "db.t",
+		"DELETE FROM t WHERE id = 1":            "t",
+		"SELECT 1":                              "",
+	}
+	for stmt, expected := range cases {
+		if table := TargetTable(stmt); table != expected {
+			t.Errorf("expected table %q for %q, got %q", expected, stmt, table)
+		}
+	}
+}
+
+func TestFirstKeyword(t *testing.T) {
+	cases := map[string]string{
+		"SELECT * FROM t":                      "select",
+		"  /* comment */ show tables":          "show",
+		"-- comment\nINSERT INTO t VALUES (1)": "insert",
+		"(SELECT 1)":                           "select",
+		"":                                     "",
+	}
+	for query, expected := range cases {
+		if keyword := FirstKeyword(query); keyword != expected {
+			t.Errorf("expected %q for %q, got %q", expected, query, keyword)
+		}
+	}
+}
+
+func TestReadsHistory(t *testing.T) {
+	cases := map[string]bool{
+		"SELECT * FROM testtable":                                      false,
+		"SELECT * FROM testtable AS OF 'HEAD~3'":                       true,
+		"SELECT * FROM dolt_log":                                       true,
+		"SELECT * FROM DOLT_HISTORY_testtable WHERE id = 1":            true,
+		"SELECT * FROM dolt_diff('HEAD~1', 'HEAD', 'testtable')":       true,
+		"SELECT t.id FROM testtable t JOIN dolt_commits c ON 1 = 1":    true,
+		"SELECT * FROM testtable WHERE id IN (SELECT 1 FROM dolt_log)": true,
+		"INSERT INTO testtable VALUES (1)":                             false,
+		"not sql":                                                      false,
+	}
+	for query, expected := range cases {
+		if ReadsHistory(query) != expected {
+			t.Errorf("expected ReadsHistory(%q) to be %t", query, expected)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	cases := map[string]Kind{
+		"SELECT * FROM testtable":                                 Read,
+		"WITH x AS (SELECT 1) SELECT * FROM x":                    Read,
+		"SELECT * FROM a UNION SELECT * FROM b":                   Read,
+		"WITH x AS (SELECT 1) DELETE FROM testtable WHERE id = 1": Write,
+		"INSERT INTO testtable SELECT * FROM other":               Write,
+		"UPDATE a JOIN b ON a.id = b.id SET b.v = 1":              Write,
+		"SELECT * INTO OUTFILE '/tmp/out' FROM testtable":         Other,
+		"SELECT DOLT_COMMIT('-am', 'sneaky')":                     Other,
+		"CREATE TEMPORARY TABLE tmp SELECT * FROM testtable":      Other,
+		"SET GLOBAL max_connections = 1":                          Other,
+	}
+	for statement, expected := range cases {
+		kind, err := Classify(statement)
+		if err != nil || kind != expected {
+			t.Errorf("expected %d for %q, got %d (%v)", expected, statement, kind, err)
+		}
+	}
+	if _, err := Classify("SELECT 1; DELETE FROM testtable"); err == nil {
+		t.Error("expected several statements to be refused")
+	}
+}
+
+func TestCallsProcedure(t *testing.T) {
+	cases := map[string]bool{
+		"SET @x = 1":                                                false,
+		"SET @x = (SELECT id FROM t)":                               false,
+		"CREATE TEMPORARY TABLE tmp (id INT)":                       false,
+		"SET @x = dolt_reset('--hard', 'HEAD~1')":                   true,
+		"CREATE TEMPORARY TABLE tmp AS SELECT dolt_reset('--hard')": true,
+		"CALL dolt_commit('-am', 'x')":                              true,
+		"SET @x = 1; SELECT dolt_commit('-am', 'x')":                true,
+		"SELEC 1": true,
+	}
+	for query, expected := range cases {
+		if CallsProcedure(query) != expected {
+			t.Errorf("expected CallsProcedure(%q) to be %t", query, expected)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+)
+
+const (
+	standbyInterval = 5 * time.Second
+	standbyFile     = "standby.json"
+)
+
+// startStandbyTracker writes the status of the standby to the working
+// directory for the standby command, and promotes the standby when the
+// process receives SIGUSR2
+func startStandbyTracker() func() error {
+	log.Info("Starting standby tracker")
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR2)
+	ticker := time.NewTicker(standbyInterval)
+	stopSignal := make(chan struct{})
+
+	write := func() {
+		status, _ := p2pmgr.Standby()
+		err := writeJSON(filepath.Join(workDir, standbyFile), status)
+		if err != nil {
+			log.Errorf("Failed to write standby status: %s", err.Error())
+		}
+	}
+	crashReporter.Go("standby-tracker", func() {
+		write()
+		for {
+			select {
+			case <-ticker.C:
+				write()
+			case <-sigs:
+				err := p2pmgr.Promote("promoted from the command line")
+				if err != nil {
+					log.Errorf("Failed to promote standby: %s", err.Error())
+				}
+				write()
+			case <-stopSignal:
+				return
+			}
+		}
+	})
+	return func() error {
+		log.Info("Stopping standby tracker")
+		signal.Stop(sigs)
+		ticker.Stop()
+		close(stopSignal)
+		return nil
+	}
+}
+
+func readStandbyStatus() (p2p.StandbyStatus, error) {
+	status := p2p.StandbyStatus{}
+	data, err := os.ReadFile(filepath.Join(workDir, standbyFile))
+	if err != nil {
+		return status, fmt.Errorf("failed to read standby status. Is a standby server running? %w", err)
+	}
+	err = json.Unmarshal(data, &status)
+	if err != nil {
+		return status, fmt.Errorf("failed to parse standby status: %w", err)
+	}
+	return status, nil
+}
+
+// printStandbyStatus prints the status of the standby running in the working
+// directory
+func printStandbyStatus() error {
+	status, err := readStandbyStatus()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("PRIMARY:   %s\n", status.Primary)
+	if status.Promoted {
+		fmt.Printf("PROMOTED:  %s (%s)\n", status.PromotedAt.Format(time.RFC3339), status.Reason)
+		return nil
+	}
+	synced := "never"
+	if !status.SyncedAt.IsZero() {
+		synced = status.SyncedAt.Format(time.RFC3339)
+	}
+	fmt.Printf("IN SYNC:   %t (last synced %s)\n", status.InSync, synced)
+	fmt.Printf("FAILURES:  %d\n", status.Failures)
+	return nil
+}
+
+// promoteStandby asks the standby running in the working directory to take
+// over from its primary and waits until it did
+func promoteStandby(timeout time.Duration) error {
+	status, err := readStandbyStatus()
+	if err != nil {
+		return err
+	}
+	if status.Promoted {
+		return fmt.Errorf("standby was already promoted")
+	}
+	process, err := serverProcess()
+	if err != nil {
+		return err
+	}
+	err = process.Signal(syscall.SIGUSR2)
+	if err != nil {
+		return fmt.Errorf("failed to signal server %d: %w", process.Pid, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(200 * time.Millisecond)
+		status, err = readStandbyStatus()
+		if err == nil && status.Promoted {
+			return nil
+		}
+	}
+	return fmt.Errorf("standby was not promoted within %s", timeout)
+}
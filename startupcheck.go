@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+	"github.com/nustiueudinastea/doltswarmdemo/recovery"
+)
+
+const startupCheckTimeout = 30 * time.Minute
+
+// startupReport is the outcome of the startup checks, if they ran
+var startupReport *recovery.Report
+
+// parseStartupCheck returns whether the startup checks run, and whether they
+// read every table
+func parseStartupCheck(mode string) (check bool, deep bool, err error) {
+	switch mode {
+	case "off":
+		return false, false, nil
+	case "quick":
+		return true, false, nil
+	case "full":
+		return true, true, nil
+	}
+	return false, false, fmt.Errorf("unknown startup check '%s'. Use off, quick or full", mode)
+}
+
+// checkStorageFiles checks the chunk stores in dir before the database is
+// opened. Torn journal tails are cut, and damaged stores are moved aside to be
+// fetched again from a peer.
+func checkStorageFiles(dir string, repair bool) error {
+	report, err := recovery.CheckFiles(dir)
+	if err != nil {
+		return fmt.Errorf("failed to check the storage: %w", err)
+	}
+	startupReport = report
+	if !report.Damaged() {
+		log.Infof("Checked %d chunk stores in %dms", len(report.Stores), report.ElapsedMs)
+		return nil
+	}
+	return repairStorage(dir, repair)
+}
+
+// checkDatabase checks the refs and commit graph of the open database. It
+// returns true if the database was moved aside and has to be opened again.
+func checkDatabase(dir string, deep bool, repair bool) (bool, error) {
+	if !dbi.Initialized() {
+		return false, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), startupCheckTimeout)
+	defer cancel()
+	start := time.Now()
+	problems, err := recovery.CheckDatabase(ctx, dbi, dbName, deep)
+	if err != nil {
+		return false, fmt.Errorf("failed to check the database: %w", err)
+	}
+	if len(problems) == 0 {
+		log.Infof("Checked the database in %s", time.Since(start).Round(time.Millisecond))
+		return false, nil
+	}
+	startupReport.Problems = append(startupReport.Problems, problems...)
+	if repair {
+		if err := dbi.Close(); err != nil {
+			return false, fmt.Errorf("failed to close the damaged database: %w", err)
+		}
+	}
+	return repair, repairStorage(dir, repair)
+}
+
+// repairStorage cuts the torn journal tails found by the checks, and moves the
+// database aside if the damage can't be repaired in place
+func repairStorage(dir string, repair bool) error {
+	for _, problem := range startupReport.Problems {
+		log.Errorf("Startup check: %s", problem)
+	}
+	if !repair {
+		return fmt.Errorf("the database is damaged (%d problems) and startup repairs are disabled", len(startupReport.Problems))
+	}
+	if !startupReport.NeedsRefetch() {
+		err := recovery.TruncateJournals(dir, startupReport)
+		if err != nil {
+			return err
+		}
+		for _, journal := range startupReport.Truncated {
+			log.Warnf("Cut the torn tail of %s. The commits lost with it are fetched again from peers", journal)
+		}
+		return nil
+	}
+	moved, err := recovery.Quarantine(dir, startupReport)
+	if err != nil {
+		return err
+	}
+	log.Warnf("Moved the damaged database to %s. It's fetched again from a peer before the node accepts traffic", moved)
+	return nil
+}
+
+// repairPeer returns the peer a damaged database is fetched again from, the
+// last peer seen
+func repairPeer(book *p2p.AddressBook) (string, error) {
+	entries := book.Entries()
+	if len(entries) == 0 {
+		return "", fmt.Errorf("the database was damaged and no peer is known to fetch it from. Restart with --init-peer")
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastSeen.After(entries[j].LastSeen)
+	})
+	return entries[0].ID, nil
+}
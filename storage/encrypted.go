@@ -0,0 +1,341 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	encryptedFile  = "db.enc"
+	encryptedMagic = "DSENC1"
+	saltSize       = 16
+	// flushInterval is how often the changes of the database are encrypted
+	// back to the file
+	flushInterval = 5 * time.Second
+	// manifestFile is the file of the chunk store listing its table files
+	manifestFile = "manifest"
+)
+
+// shmDir is the memory-backed directory the plaintext copy is kept in
+var shmDir = "/dev/shm"
+
+// encrypted keeps the database encrypted at rest in a single file. At startup
+// the file is decrypted into a directory on /dev/shm, so the plaintext never
+// touches the disk. The directory is encrypted back to the file, replaced
+// atomically, every few seconds when it changed and on close, so a crash only
+// loses the last few seconds of changes.
+type encrypted struct {
+	*memory
+	file string
+	key  []byte
+	salt []byte
+
+	mtx         sync.Mutex
+	fingerprint string
+	stop        chan struct{}
+	stopped     chan struct{}
+}
+
+// NewEncrypted opens the encrypted storage kept in the directory at path. The
+// AES-256 key is derived from the passphrase with scrypt. It fails if there is
+// no memory-backed directory to decrypt the database into.
+func NewEncrypted(path string, passphrase string) (Backend, error) {
+	if path == "" {
+		return nil, fmt.Errorf("encrypted storage requires a path")
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("encrypted storage requires a key")
+	}
+	if info, err := os.Stat(shmDir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("encrypted storage requires the memory-backed directory %s, so that the plaintext never touches the disk", shmDir)
+	}
+	err := os.MkdirAll(path, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	mem, err := newMemory(shmDir)
+	if err != nil {
+		return nil, err
+	}
+	e := &encrypted{memory: mem.(*memory), file: filepath.Join(path, encryptedFile), stop: make(chan struct{}), stopped: make(chan struct{})}
+
+	data, err := os.ReadFile(e.file)
+	switch {
+	case os.IsNotExist(err):
+		e.salt = make([]byte, saltSize)
+		if _, err = rand.Read(e.salt); err == nil {
+			e.key, err = deriveKey(passphrase, e.salt)
+		}
+	case err == nil:
+		err = e.decrypt(data, passphrase)
+	}
+	if err == nil {
+		e.fingerprint, err = fingerprint(e.dir)
+	}
+	if err != nil {
+		return nil, errors.Join(err, e.memory.Close())
+	}
+	go e.flushLoop()
+	return e, nil
+}
+
+func deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+}
+
+func (e *encrypted) decrypt(data []byte, passphrase string) error {
+	header := len(encryptedMagic) + saltSize
+	if len(data) < header || string(data[:len(encryptedMagic)]) != encryptedMagic {
+		return fmt.Errorf("'%s' is not an encrypted database", e.file)
+	}
+	e.salt = data[len(encryptedMagic):header]
+
+	var err error
+	e.key, err = deriveKey(passphrase, e.salt)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(e.key)
+	if err != nil {
+		return err
+	}
+	data = data[header:]
+	if len(data) < gcm.NonceSize() {
+		return fmt.Errorf("'%s' is truncated", e.file)
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(encryptedMagic))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt '%s'. Is the key correct? %w", e.file, err)
+	}
+	return untar(bytes.NewReader(plain), e.dir)
+}
+
+// flushLoop encrypts the database back to the file every flushInterval.
+// Failed flushes are retried on the next tick, and reported by Close if the
+// last one fails.
+func (e *encrypted) flushLoop() {
+	defer close(e.stopped)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = e.flush()
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// flush encrypts the database to the file if it changed since the last flush
+func (e *encrypted) flush() error {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	current, err := fingerprint(e.dir)
+	if err != nil {
+		return err
+	}
+	if current == e.fingerprint {
+		return nil
+	}
+	if err := e.encrypt(); err != nil {
+		return err
+	}
+	e.fingerprint = current
+	return nil
+}
+
+// Close encrypts the database back to the file and removes the plaintext copy
+func (e *encrypted) Close() error {
+	close(e.stop)
+	<-e.stopped
+	e.mtx.Lock()
+	err := e.encrypt()
+	e.mtx.Unlock()
+	return errors.Join(err, e.memory.Close())
+}
+
+func (e *encrypted) encrypt() error {
+	plain := &bytes.Buffer{}
+	err := tarDir(e.dir, plain)
+	if err != nil {
+		return fmt.Errorf("failed to archive database: %w", err)
+	}
+
+	gcm, err := newGCM(e.key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	data := append([]byte(encryptedMagic), e.salt...)
+	data = append(data, nonce...)
+	data = gcm.Seal(data, nonce, plain.Bytes(), []byte(encryptedMagic))
+
+	tmpFile := e.file + ".tmp"
+	f, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write encrypted database: %w", err)
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		// the new file has to be on disk before it replaces the old one
+		err = f.Sync()
+	}
+	if err = errors.Join(err, f.Close()); err != nil {
+		return fmt.Errorf("failed to write encrypted database: %w", err)
+	}
+	return os.Rename(tmpFile, e.file)
+}
+
+// fingerprint sums up the names, sizes and modification times of the files
+// under dir, to tell if the database changed
+func fingerprint(dir string) (string, error) {
+	h := sha256.New()
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return hex.EncodeToString(h.Sum(nil)), err
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// tarDir writes the regular files and directories under dir as a gzipped tar.
+// The manifests of the chunk store are read first: the table files they list
+// are written before them and kept until the manifest changes, so the archive
+// is consistent while the database is in use.
+func tarDir(dir string, w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	manifests := map[string][]byte{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() || info.Name() != manifestFile {
+			return err
+		}
+		manifests[path], err = os.ReadFile(path)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			return nil
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(name)
+		if manifest, found := manifests[path]; found {
+			hdr.Size = int64(len(manifest))
+			if err = tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			_, err = tw.Write(manifest)
+			return err
+		}
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		// files that grow while they are archived, like the chunk journal,
+		// are cut at the size they had
+		_, err = io.CopyN(tw, f, hdr.Size)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// untar extracts a gzipped tar written by tarDir into dir
+func untar(r io.Reader, dir string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !filepath.IsLocal(filepath.FromSlash(hdr.Name)) {
+			return fmt.Errorf("invalid path '%s' in archive", hdr.Name)
+		}
+		path := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0700)
+		case tar.TypeReg:
+			err = writeFile(path, tr, os.FileMode(hdr.Mode).Perm())
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeFile(path string, r io.Reader, perm os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	return errors.Join(err, f.Close())
+}
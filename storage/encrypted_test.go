@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncrypted(t *testing.T) {
+	path := t.TempDir()
+	backend, err := NewEncrypted(path, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(filepath.Join(backend.Dir(), ".dolt", "noms"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(backend.Dir(), ".dolt", "noms", "manifest"), []byte("plaintext data"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = backend.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(backend.Dir()); !os.IsNotExist(err) {
+		t.Error("expected the plaintext directory to be removed")
+	}
+
+	data, err := os.ReadFile(filepath.Join(path, encryptedFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) == 0 || string(data[:len(encryptedMagic)]) != encryptedMagic {
+		t.Fatal("expected an encrypted file")
+	}
+
+	if _, err := NewEncrypted(path, "wrong"); err == nil {
+		t.Fatal("expected the wrong key to be rejected")
+	}
+
+	reopened, err := NewEncrypted(path, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	content, err := os.ReadFile(filepath.Join(reopened.Dir(), ".dolt", "noms", "manifest"))
+	if err != nil || string(content) != "plaintext data" {
+		t.Errorf("expected the data to be restored, got %q %v", content, err)
+	}
+}
+
+func TestEncryptedFlush(t *testing.T) {
+	path := t.TempDir()
+	backend, err := NewEncrypted(path, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	err = os.WriteFile(filepath.Join(backend.Dir(), manifestFile), []byte("plaintext data"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the changes reach the file without closing the storage, like after a
+	// crash
+	if err = backend.(*encrypted).flush(); err != nil {
+		t.Fatal(err)
+	}
+	crashed := &memory{dir: t.TempDir()}
+	data, err := os.ReadFile(filepath.Join(path, encryptedFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := &encrypted{memory: crashed, file: filepath.Join(path, encryptedFile)}
+	if err = restored.decrypt(data, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(filepath.Join(crashed.dir, manifestFile))
+	if err != nil || string(content) != "plaintext data" {
+		t.Errorf("expected the flushed data, got %q %v", content, err)
+	}
+}
+
+func TestEncryptedRequiresMemory(t *testing.T) {
+	defer func(dir string) { shmDir = dir }(shmDir)
+	shmDir = filepath.Join(t.TempDir(), "missing")
+	if _, err := NewEncrypted(t.TempDir(), "secret"); err == nil {
+		t.Error("expected the storage to be refused without a memory-backed directory")
+	}
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Backend provides the directory the Dolt chunk store lives in
+type Backend interface {
+	// Dir returns the directory the database should be opened in
+	Dir() string
+	// Close releases the storage. Ephemeral backends delete their data.
+	Close() error
+}
+
+// Factory creates a backend. The path is backend specific and might be empty.
+type Factory func(path string) (Backend, error)
+
+var (
+	registryMtx sync.RWMutex
+	registry    = map[string]Factory{
+		"disk":   newDisk,
+		"memory": newMemory,
+	}
+)
+
+// Register makes a backend available under the given name
+func Register(name string, factory Factory) {
+	registryMtx.Lock()
+	defer registryMtx.Unlock()
+	registry[name] = factory
+}
+
+// Backends returns the names of all the registered backends
+func Backends() []string {
+	registryMtx.RLock()
+	defer registryMtx.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open creates the backend registered under name
+func Open(name string, path string) (Backend, error) {
+	registryMtx.RLock()
+	factory, found := registry[name]
+	registryMtx.RUnlock()
+	if !found {
+		return nil, fmt.Errorf("unknown storage backend '%s'. Available backends: %s", name, strings.Join(Backends(), ", "))
+	}
+	return factory(path)
+}
+
+// disk stores the database in a local directory
+type disk struct {
+	dir string
+}
+
+func newDisk(path string) (Backend, error) {
+	if path == "" {
+		return nil, fmt.Errorf("disk storage requires a path")
+	}
+	err := os.MkdirAll(path, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	return &disk{dir: path}, nil
+}
+
+func (d *disk) Dir() string {
+	return d.dir
+}
+
+func (d *disk) Close() error {
+	return nil
+}
+
+// memory stores the database in a temporary directory that is removed on
+// close. On Linux the directory is created on /dev/shm so the data never
+// touches the disk.
+type memory struct {
+	dir string
+}
+
+func newMemory(path string) (Backend, error) {
+	parent := path
+	if parent == "" {
+		if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+			parent = "/dev/shm"
+		}
+	}
+	dir, err := os.MkdirTemp(parent, "doltswarmdemo-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create in-memory storage: %w", err)
+	}
+	return &memory{dir: dir}, nil
+}
+
+func (m *memory) Dir() string {
+	return m.dir
+}
+
+func (m *memory) Close() error {
+	return os.RemoveAll(m.dir)
+}
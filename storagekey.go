@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/nustiueudinastea/doltswarmdemo/storage"
+)
+
+// storageKey and storageKeyCmd are set from the command line flags
+var storageKey string
+var storageKeyCmd string
+
+func init() {
+	storage.Register("encrypted", func(path string) (storage.Backend, error) {
+		key, err := resolveStorageKey()
+		if err != nil {
+			return nil, err
+		}
+		return storage.NewEncrypted(path, key)
+	})
+}
+
+// resolveStorageKey returns the key of the encrypted storage. A key given
+// directly or through the environment wins over the key command, which can be
+// used to read the key from the OS keychain.
+func resolveStorageKey() (string, error) {
+	if storageKey != "" {
+		return storageKey, nil
+	}
+	if storageKeyCmd == "" {
+		return "", fmt.Errorf("encrypted storage requires --storage-key or --storage-key-cmd")
+	}
+	out, err := exec.Command("sh", "-c", storageKeyCmd).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run storage key command: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"os"
@@ -15,6 +16,7 @@ import (
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/nustiueudinastea/doltswarm"
 	swarmproto "github.com/nustiueudinastea/doltswarm/proto"
+	"github.com/nustiueudinastea/doltswarmdemo/commitlog"
 	"github.com/nustiueudinastea/doltswarmdemo/p2p"
 	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
 	"github.com/segmentio/ksuid"
@@ -87,6 +89,10 @@ func (pr *testDB) GetAllCommits() ([]doltswarm.Commit, error) {
 	return []doltswarm.Commit{}, nil
 }
 
+func (pr *testDB) ListCommits(opts commitlog.Options) (commitlog.Page, error) {
+	return commitlog.Page{}, nil
+}
+
 func (pr *testDB) ExecAndCommit(query string, commitMsg string) (string, error) {
 	return "", nil
 }
@@ -95,6 +101,14 @@ func (pr *testDB) GetLastCommit(branch string) (doltswarm.Commit, error) {
 	return doltswarm.Commit{}, nil
 }
 
+func (pr *testDB) Query(query string, args ...any) (*sql.Rows, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (pr *testDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
 //
 // ServerSyncer is a mock syncer
 //
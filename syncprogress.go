@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+)
+
+const (
+	syncProgressInterval = 5 * time.Second
+	syncProgressFile     = "sync-progress.json"
+)
+
+// startSyncProgress tracks the sync progress, logs its events and writes it to
+// the working directory for the sync command
+func startSyncProgress() func() error {
+	log.Info("Starting sync progress tracker")
+	syncing := false
+	return p2pmgr.TrackSyncProgress(syncProgressInterval, func(progress p2p.SyncProgress) {
+		missing := progress.Missing()
+		switch {
+		case missing > 0 && !syncing:
+			syncing = true
+			log.Infof("Sync started: %d commits behind", missing)
+		case missing > 0:
+			log.Infof("Sync progress: %s", formatSyncProgress(progress))
+		case syncing:
+			syncing = false
+			log.Infof("Sync completed: %d commits", progress.LocalCommits)
+		}
+
+		data, err := json.Marshal(progress)
+		if err != nil {
+			log.Errorf("Failed to encode sync progress: %s", err.Error())
+			return
+		}
+		path := filepath.Join(workDir, syncProgressFile)
+		err = os.WriteFile(path+".tmp", data, 0600)
+		if err == nil {
+			err = os.Rename(path+".tmp", path)
+		}
+		if err != nil {
+			log.Errorf("Failed to write sync progress: %s", err.Error())
+		}
+	})
+}
+
+// startSyncLagAlerts logs a warning every time we fall too far behind a peer
+func startSyncLagAlerts() func() error {
+	events, cancel := p2pmgr.SubscribeEvents(p2p.EventSyncLagExceeded)
+	crashReporter.Go("sync-lag-alerts", func() {
+		for ev := range events {
+			log.Warnf("Missing %d commits of peer %s", ev.Lag, ev.PeerID)
+		}
+	})
+	return func() error {
+		cancel()
+		return nil
+	}
+}
+
+func formatSyncProgress(progress p2p.SyncProgress) string {
+	eta := "unknown"
+	if progress.ETA >= 0 {
+		eta = progress.ETA.Round(time.Second).String()
+	}
+	return fmt.Sprintf("%d/%d commits, %d bytes received (%.0f B/s), %.2f commits/s, ETA %s",
+		progress.LocalCommits, progress.TotalCommits, progress.BytesIn, progress.RateIn, progress.CommitRate, eta)
+}
+
+// printSyncProgress prints the progress reported by the server running in the
+// working directory. With watch enabled it keeps printing until the sync is done.
+func printSyncProgress(watch bool) error {
+	path := filepath.Join(workDir, syncProgressFile)
+	for {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read sync progress. Is the server running? %w", err)
+		}
+		progress := p2p.SyncProgress{}
+		err = json.Unmarshal(data, &progress)
+		if err != nil {
+			return fmt.Errorf("failed to parse sync progress: %w", err)
+		}
+		fmt.Printf("%s %s\n", progress.UpdatedAt.Format(time.RFC3339), formatSyncProgress(progress))
+
+		if !watch || (progress.Missing() == 0 && progress.TotalCommits > 0) {
+			return nil
+		}
+		time.Sleep(syncProgressInterval)
+	}
+}
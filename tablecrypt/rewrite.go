@@ -0,0 +1,196 @@
+package tablecrypt
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/dolthub/vitess/go/vt/sqlparser"
+)
+
+// Rewrite encrypts the values a write assigns to encrypted columns. Only
+// literal values can be encrypted, so inserts into tables with encrypted
+// columns need a column list and VALUES rows. The conditions of updates and
+// deletes can't reference encrypted columns either, since a ciphertext never
+// matches another one. Each statement of a query, like a batch of writes, is
+// rewritten on its own. Statements that can't be parsed are refused if they
+// mention a table with encrypted columns, and kept as they are otherwise.
+func (p *Policy) Rewrite(query string) (string, error) {
+	if len(p.columns) == 0 {
+		return query, nil
+	}
+	pieces, err := sqlparser.SplitStatementToPieces(query)
+	if err != nil {
+		if err := p.unparsed(query, err); err != nil {
+			return "", err
+		}
+		return query, nil
+	}
+
+	changed := false
+	rewritten := make([]string, 0, len(pieces))
+	for _, piece := range pieces {
+		if strings.TrimSpace(piece) == "" {
+			continue
+		}
+		statement, pieceChanged, err := p.rewriteStatement(piece)
+		if err != nil {
+			return "", err
+		}
+		changed = changed || pieceChanged
+		rewritten = append(rewritten, statement)
+	}
+	if !changed {
+		return query, nil
+	}
+	return strings.Join(rewritten, ";\n"), nil
+}
+
+// rewriteStatement rewrites a single statement, returning whether it changed
+func (p *Policy) rewriteStatement(statement string) (string, bool, error) {
+	parsed, err := sqlparser.Parse(statement)
+	if err != nil {
+		if err := p.unparsed(statement, err); err != nil {
+			return "", false, err
+		}
+		return statement, false, nil
+	}
+
+	changed := false
+	switch stmt := parsed.(type) {
+	case *sqlparser.Insert:
+		changed, err = p.rewriteInsert(stmt)
+	case *sqlparser.Update:
+		changed, err = p.rewriteUpdate(stmt)
+	case *sqlparser.Delete:
+		var table string
+		table, err = p.coveredTable(stmt.TableExprs)
+		if err == nil && table != "" && stmt.Where != nil {
+			err = p.checkCondition(table, stmt.Where.Expr)
+		}
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if !changed {
+		return statement, false, nil
+	}
+	return sqlparser.String(parsed), true, nil
+}
+
+// unparsed refuses a statement that can't be parsed if it mentions a table
+// with encrypted columns, since its values can't be encrypted. Others fail the
+// same way when they are executed.
+func (p *Policy) unparsed(statement string, err error) error {
+	words := strings.FieldsFunc(strings.ToLower(statement), func(r rune) bool {
+		return !(r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r))
+	})
+	for _, word := range words {
+		if p.columns[word] != nil {
+			return fmt.Errorf("failed to parse a statement writing table '%s', which has encrypted columns: %w", word, err)
+		}
+	}
+	return nil
+}
+
+func (p *Policy) rewriteInsert(ins *sqlparser.Insert) (bool, error) {
+	table := strings.ToLower(ins.Table.Name.String())
+	columns := p.columns[table]
+	if columns == nil {
+		return false, nil
+	}
+	if len(ins.Columns) == 0 {
+		return false, fmt.Errorf("inserts into table '%s' need a column list, since it has encrypted columns", table)
+	}
+	rows, ok := ins.Rows.(sqlparser.Values)
+	if !ok {
+		return false, fmt.Errorf("inserts into table '%s' need VALUES rows, since it has encrypted columns", table)
+	}
+	for _, row := range rows {
+		for i, column := range ins.Columns {
+			if i >= len(row) || !columns[column.Lowered()] {
+				continue
+			}
+			encrypted, err := p.encryptExpr(table, column.Lowered(), row[i])
+			if err != nil {
+				return false, err
+			}
+			row[i] = encrypted
+		}
+	}
+	return true, p.encryptAssignments(table, sqlparser.AssignmentExprs(ins.OnDup))
+}
+
+func (p *Policy) rewriteUpdate(upd *sqlparser.Update) (bool, error) {
+	table, err := p.coveredTable(upd.TableExprs)
+	if err != nil || table == "" {
+		return false, err
+	}
+	if upd.Where != nil {
+		if err := p.checkCondition(table, upd.Where.Expr); err != nil {
+			return false, err
+		}
+	}
+	return true, p.encryptAssignments(table, upd.Exprs)
+}
+
+func (p *Policy) encryptAssignments(table string, exprs sqlparser.AssignmentExprs) error {
+	for _, assignment := range exprs {
+		column := assignment.Name.Name.Lowered()
+		if !p.columns[table][column] {
+			continue
+		}
+		encrypted, err := p.encryptExpr(table, column, assignment.Expr)
+		if err != nil {
+			return err
+		}
+		assignment.Expr = encrypted
+	}
+	return nil
+}
+
+// encryptExpr returns the encrypted literal of a value. NULL stays NULL.
+func (p *Policy) encryptExpr(table string, column string, expr sqlparser.Expr) (sqlparser.Expr, error) {
+	switch e := expr.(type) {
+	case *sqlparser.NullVal:
+		return e, nil
+	case *sqlparser.SQLVal:
+		if e.Type != sqlparser.ValArg {
+			ciphertext, err := p.encrypt(table, e.Val)
+			if err != nil {
+				return nil, err
+			}
+			return sqlparser.NewStrVal([]byte(ciphertext)), nil
+		}
+	}
+	return nil, fmt.Errorf("only literal values can be written to the encrypted column %s.%s", table, column)
+}
+
+// coveredTable returns the table with encrypted columns targeted by a write,
+// or an empty string if there is none
+func (p *Policy) coveredTable(exprs sqlparser.TableExprs) (string, error) {
+	tables := []string{}
+	err := sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if name, ok := node.(sqlparser.TableName); ok && p.columns[strings.ToLower(name.Name.String())] != nil {
+			tables = append(tables, strings.ToLower(name.Name.String()))
+		}
+		return true, nil
+	}, exprs)
+	if err != nil || len(tables) == 0 {
+		return "", err
+	}
+	if len(exprs) != 1 || len(tables) != 1 {
+		return "", fmt.Errorf("writes to tables with encrypted columns only support single-table statements")
+	}
+	return tables[0], nil
+}
+
+// checkCondition refuses conditions on encrypted columns
+func (p *Policy) checkCondition(table string, expr sqlparser.Expr) error {
+	return sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if col, ok := node.(*sqlparser.ColName); ok && p.columns[table][col.Name.Lowered()] {
+			return false, fmt.Errorf("the encrypted column %s.%s can't be used in conditions", table, col.Name.Lowered())
+		}
+		return true, nil
+	}, expr)
+}
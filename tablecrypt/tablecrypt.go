@@ -0,0 +1,151 @@
+// Package tablecrypt encrypts the values of sensitive columns before they are
+// committed, with per-table keys that only some nodes hold. Every node
+// replicates the ciphertext, but only the nodes holding the key of a table can
+// write its encrypted columns and read them back in plaintext, so that nodes
+// of different trust levels can share a cluster.
+//
+// Values are encrypted with AES-256-GCM and stored as strings of the form
+// dsenc:v1:<key id>:<base64 nonce and ciphertext>. The key ID identifies the
+// key without revealing it, so values encrypted with another key are left
+// alone. Encrypted columns have to be wide enough text columns.
+package tablecrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const prefix = "dsenc:v1:"
+
+// Config selects the encrypted columns and the keys held by the node
+type Config struct {
+	// Columns are the encrypted columns, as table.column
+	Columns []string
+	// Keys are the secrets the keys of the tables are derived from, by table.
+	// The encrypted columns of tables without a key can't be written and are
+	// read as ciphertext.
+	Keys map[string]string
+}
+
+type tableKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// Policy encrypts the writes and decrypts the reads of the encrypted columns
+type Policy struct {
+	columns map[string]map[string]bool
+	keys    map[string]tableKey
+	byID    map[string]cipher.AEAD
+}
+
+// TableStatus describes the encryption of a table on the node
+type TableStatus struct {
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+	// KeyID is empty if the node doesn't hold the key of the table
+	KeyID string `json:"key_id,omitempty"`
+}
+
+// New creates the policy of the configured columns
+func New(cfg Config) (*Policy, error) {
+	p := &Policy{
+		columns: map[string]map[string]bool{},
+		keys:    map[string]tableKey{},
+		byID:    map[string]cipher.AEAD{},
+	}
+	for _, column := range cfg.Columns {
+		table, name, found := strings.Cut(strings.ToLower(column), ".")
+		if !found || table == "" || name == "" {
+			return nil, fmt.Errorf("invalid encrypted column '%s', expected table.column", column)
+		}
+		if p.columns[table] == nil {
+			p.columns[table] = map[string]bool{}
+		}
+		p.columns[table][name] = true
+	}
+	for table, secret := range cfg.Keys {
+		table = strings.ToLower(table)
+		if p.columns[table] == nil {
+			return nil, fmt.Errorf("key given for table '%s', which has no encrypted columns", table)
+		}
+		if secret == "" {
+			return nil, fmt.Errorf("empty key for table '%s'", table)
+		}
+		key := sha256.Sum256([]byte(secret))
+		block, err := aes.NewCipher(key[:])
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		id := sha256.Sum256(key[:])
+		k := tableKey{id: hex.EncodeToString(id[:4]), aead: aead}
+		p.keys[table] = k
+		p.byID[k.id] = aead
+	}
+	return p, nil
+}
+
+// Tables returns the encryption of every table with encrypted columns
+func (p *Policy) Tables() []TableStatus {
+	tables := []TableStatus{}
+	for table, columns := range p.columns {
+		status := TableStatus{Table: table, KeyID: p.keys[table].id}
+		for column := range columns {
+			status.Columns = append(status.Columns, column)
+		}
+		sort.Strings(status.Columns)
+		tables = append(tables, status)
+	}
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].Table < tables[j].Table
+	})
+	return tables
+}
+
+// encrypt returns the ciphertext of a value of the table
+func (p *Policy) encrypt(table string, value []byte) (string, error) {
+	key, found := p.keys[table]
+	if !found {
+		return "", fmt.Errorf("this node doesn't hold the key of table '%s'", table)
+	}
+	nonce := make([]byte, key.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := key.aead.Seal(nonce, nonce, value, nil)
+	return prefix + key.id + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the plaintext of an encrypted value. Values that are not
+// encrypted, or encrypted with a key the node doesn't hold, are returned
+// unchanged.
+func (p *Policy) Decrypt(value string) string {
+	if !strings.HasPrefix(value, prefix) {
+		return value
+	}
+	id, encoded, found := strings.Cut(value[len(prefix):], ":")
+	aead := p.byID[id]
+	if !found || aead == nil {
+		return value
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return value
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return value
+	}
+	return string(plaintext)
+}
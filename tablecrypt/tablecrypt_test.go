@@ -0,0 +1,70 @@
+package tablecrypt
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var ciphertextRegex = regexp.MustCompile(`dsenc:v1:[^']+`)
+
+func TestRewrite(t *testing.T) {
+	cfg := Config{Columns: []string{"patients.diagnosis", "patients.notes"}, Keys: map[string]string{"patients": "s3cret"}}
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rewritten, err := p.Rewrite("INSERT INTO patients (id, diagnosis, notes) VALUES (1, 'flu', NULL) ON DUPLICATE KEY UPDATE diagnosis = 'it''s a cold'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertexts := ciphertextRegex.FindAllString(rewritten, -1)
+	if len(ciphertexts) != 2 || strings.Contains(rewritten, "flu") || !strings.Contains(rewritten, "null") {
+		t.Fatalf("expected the diagnoses to be encrypted, got %s", rewritten)
+	}
+	if p.Decrypt(ciphertexts[0]) != "flu" || p.Decrypt(ciphertexts[1]) != "it's a cold" {
+		t.Errorf("unexpected plaintexts %q and %q", p.Decrypt(ciphertexts[0]), p.Decrypt(ciphertexts[1]))
+	}
+
+	// nodes without the key replicate the ciphertext but can't read or write it
+	keyless, err := New(Config{Columns: cfg.Columns})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyless.Decrypt(ciphertexts[0]) != ciphertexts[0] {
+		t.Error("expected the ciphertext to be left alone without the key")
+	}
+	if _, err := keyless.Rewrite("UPDATE patients SET notes = 'x' WHERE id = 1"); err == nil {
+		t.Error("expected the write to be refused without the key")
+	}
+	if _, err := keyless.Rewrite("UPDATE patients SET id = 2 WHERE id = 1"); err != nil {
+		t.Errorf("expected writes to other columns to be allowed, got %v", err)
+	}
+
+	for _, statement := range []string{
+		"INSERT INTO patients VALUES (1, 'flu', NULL)",
+		"INSERT INTO patients (id, diagnosis) SELECT id, diagnosis FROM other",
+		"UPDATE patients SET diagnosis = UPPER(notes) WHERE id = 1",
+		"DELETE FROM patients WHERE diagnosis = 'flu'",
+		"INSERT INTO patients (id, diagnosis) VALUES (1, 'flu'); INSERT INTO patients VALUES (2, 'flu', NULL)",
+		"INSERT INTO patients (id, diagnosis) VALUES (1, 'flu') RETURNING oops",
+	} {
+		if _, err := p.Rewrite(statement); err == nil {
+			t.Errorf("expected %s to be refused", statement)
+		}
+	}
+	// every statement of a batch is encrypted
+	rewritten, err = p.Rewrite("INSERT INTO patients (id, diagnosis) VALUES (1, 'flu');\nSELECT 1;\nINSERT INTO patients (id, notes) VALUES (2, 'cold')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ciphertextRegex.FindAllString(rewritten, -1)) != 2 || strings.Contains(rewritten, "flu") || strings.Contains(rewritten, "cold") {
+		t.Errorf("expected every statement to be encrypted, got %s", rewritten)
+	}
+	for _, statement := range []string{"INSERT INTO other VALUES (1)", "DELETE FROM patients WHERE id = 1", "SELECT * FROM patients"} {
+		if rewritten, err := p.Rewrite(statement); err != nil || rewritten != statement {
+			t.Errorf("expected %s to be kept, got %s (%v)", statement, rewritten, err)
+		}
+	}
+}
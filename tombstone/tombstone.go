@@ -0,0 +1,202 @@
+// Package tombstone turns the deletes of selected tables into soft deletes. A
+// deleted row is kept with a tombstone, the time of the delete in a marker
+// column, so that late peers and conflict resolvers can tell a deleted row
+// from one that never existed. Tombstones are purged once they are older than
+// the retention window.
+package tombstone
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/dolthub/vitess/go/vt/sqlparser"
+)
+
+const (
+	defaultColumn    = "deleted_at"
+	defaultRetention = 7 * 24 * time.Hour
+)
+
+// Config selects the tables with soft deletes
+type Config struct {
+	Tables []string
+	// Column holds the time of the delete, and is NULL for live rows. It has
+	// to be a nullable DATETIME column of every table. Defaults to deleted_at
+	Column string
+	// Retention is how long tombstones are kept before they are purged.
+	// Defaults to 7 days
+	Retention time.Duration
+}
+
+// Policy rewrites the deletes of the tables with soft deletes
+type Policy struct {
+	tables    map[string]bool
+	column    string
+	retention time.Duration
+}
+
+// New creates the policy of the configured tables
+func New(cfg Config) *Policy {
+	p := &Policy{
+		tables:    map[string]bool{},
+		column:    cfg.Column,
+		retention: cfg.Retention,
+	}
+	if p.column == "" {
+		p.column = defaultColumn
+	}
+	if p.retention <= 0 {
+		p.retention = defaultRetention
+	}
+	for _, table := range cfg.Tables {
+		p.tables[strings.ToLower(table)] = true
+	}
+	return p
+}
+
+// Tables returns the tables with soft deletes
+func (p *Policy) Tables() []string {
+	tables := make([]string, 0, len(p.tables))
+	for table := range p.tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+func (p *Policy) covers(name sqlparser.TableName) bool {
+	return p.tables[strings.ToLower(name.Name.String())]
+}
+
+// Rewrite turns a delete of a table with soft deletes into an update setting
+// the tombstone of the live rows it matches. Deletes restricted to tombstoned
+// rows, with "<column> IS NOT NULL" in their condition, purge them and are
+// kept as they are, like every other statement. Each statement of a query,
+// like a batch of writes, is rewritten on its own. Statements that can't be
+// parsed are refused if they mention a table with soft deletes.
+func (p *Policy) Rewrite(query string) (string, error) {
+	if len(p.tables) == 0 {
+		return query, nil
+	}
+	pieces, err := sqlparser.SplitStatementToPieces(query)
+	if err != nil {
+		if err := p.unparsed(query, err); err != nil {
+			return "", err
+		}
+		return query, nil
+	}
+
+	changed := false
+	rewritten := make([]string, 0, len(pieces))
+	for _, piece := range pieces {
+		piece = strings.TrimSpace(piece)
+		if piece == "" {
+			continue
+		}
+		statement, err := p.rewriteStatement(piece)
+		if err != nil {
+			return "", err
+		}
+		changed = changed || statement != piece
+		rewritten = append(rewritten, statement)
+	}
+	if !changed {
+		return query, nil
+	}
+	return strings.Join(rewritten, ";\n"), nil
+}
+
+// unparsed refuses a statement that can't be parsed if it mentions a table
+// with soft deletes, since it could delete its rows. Others fail the same way
+// when they are executed.
+func (p *Policy) unparsed(statement string, err error) error {
+	words := strings.FieldsFunc(strings.ToLower(statement), func(r rune) bool {
+		return !(r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r))
+	})
+	for _, word := range words {
+		if p.tables[word] {
+			return fmt.Errorf("failed to parse a statement writing table '%s', which has soft deletes: %w", word, err)
+		}
+	}
+	return nil
+}
+
+func (p *Policy) rewriteStatement(statement string) (string, error) {
+	parsed, err := sqlparser.Parse(statement)
+	if err != nil {
+		if err := p.unparsed(statement, err); err != nil {
+			return "", err
+		}
+		return statement, nil
+	}
+	del, ok := parsed.(*sqlparser.Delete)
+	if !ok {
+		return statement, nil
+	}
+
+	covered := false
+	err = sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		if name, ok := node.(sqlparser.TableName); ok && p.covers(name) {
+			covered = true
+		}
+		return true, nil
+	}, del.Targets, del.TableExprs)
+	if err != nil {
+		return "", err
+	}
+	if !covered || (del.Where != nil && p.purges(del.Where.Expr)) {
+		return statement, nil
+	}
+	if del.Targets != nil || len(del.TableExprs) != 1 || del.With != nil {
+		return "", fmt.Errorf("tables with soft deletes only support single-table deletes")
+	}
+	table, ok := del.TableExprs[0].(*sqlparser.AliasedTableExpr)
+	if !ok {
+		return "", fmt.Errorf("tables with soft deletes only support single-table deletes")
+	}
+
+	column := &sqlparser.ColName{Name: sqlparser.NewColIdent(p.column)}
+	var live sqlparser.Expr = &sqlparser.IsExpr{Operator: sqlparser.IsNullStr, Expr: column}
+	if del.Where != nil {
+		live = &sqlparser.AndExpr{Left: live, Right: &sqlparser.ParenExpr{Expr: del.Where.Expr}}
+	}
+	update := &sqlparser.Update{
+		Comments:   del.Comments,
+		TableExprs: sqlparser.TableExprs{table},
+		Exprs: sqlparser.AssignmentExprs{{
+			Name: column,
+			Expr: &sqlparser.FuncExpr{Name: sqlparser.NewColIdent("utc_timestamp")},
+		}},
+		Where:   sqlparser.NewWhere(sqlparser.WhereStr, live),
+		OrderBy: del.OrderBy,
+		Limit:   del.Limit,
+	}
+	return sqlparser.String(update), nil
+}
+
+// purges returns true if the condition only matches tombstoned rows
+func (p *Policy) purges(expr sqlparser.Expr) bool {
+	switch e := expr.(type) {
+	case *sqlparser.AndExpr:
+		return p.purges(e.Left) || p.purges(e.Right)
+	case *sqlparser.ParenExpr:
+		return p.purges(e.Expr)
+	case *sqlparser.IsExpr:
+		col, ok := e.Expr.(*sqlparser.ColName)
+		return ok && e.Operator == sqlparser.IsNotNullStr && col.Name.EqualString(p.column)
+	}
+	return false
+}
+
+// Purge returns the statements counting and deleting the tombstones of a table
+// that expired at the given time
+func (p *Policy) Purge(table string, now time.Time) (count string, purge string) {
+	cutoff := now.UTC().Add(-p.retention).Format("2006-01-02 15:04:05")
+	quoted := "`" + strings.ReplaceAll(table, "`", "``") + "`"
+	column := "`" + strings.ReplaceAll(p.column, "`", "``") + "`"
+	cond := fmt.Sprintf("%s IS NOT NULL AND %s < '%s'", column, column, cutoff)
+	return fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s;", quoted, cond), fmt.Sprintf("DELETE FROM %s WHERE %s;", quoted, cond)
+}
@@ -0,0 +1,57 @@
+package tombstone
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRewrite(t *testing.T) {
+	p := New(Config{Tables: []string{"Items"}})
+	cases := map[string]string{
+		"DELETE FROM items WHERE id = 1 OR id = 2":             "update items set deleted_at = utc_timestamp() where deleted_at is null and (id = 1 or id = 2)",
+		"delete from `items`":                                  "update items set deleted_at = utc_timestamp() where deleted_at is null",
+		"DELETE FROM items WHERE id > 3 ORDER BY id LIMIT 2":   "update items set deleted_at = utc_timestamp() where deleted_at is null and (id > 3) order by id asc limit 2",
+		"DELETE FROM other WHERE id = 1":                       "DELETE FROM other WHERE id = 1",
+		"DELETE FROM items WHERE deleted_at IS NOT NULL":       "DELETE FROM items WHERE deleted_at IS NOT NULL",
+		"UPDATE items SET deleted_at = NULL WHERE id = 1":      "UPDATE items SET deleted_at = NULL WHERE id = 1",
+		"INSERT INTO items (id) VALUES (1)":                    "INSERT INTO items (id) VALUES (1)",
+		"DELETE FROM items WHERE id IN (SELECT id FROM other)": "update items set deleted_at = utc_timestamp() where deleted_at is null and (id in (select id from other))",
+		"DELETE FROM items WHERE id = 1; SELECT 1":             "update items set deleted_at = utc_timestamp() where deleted_at is null and (id = 1);\nSELECT 1",
+	}
+	for statement, expected := range cases {
+		rewritten, err := p.Rewrite(statement)
+		if err != nil {
+			t.Errorf("%s: %v", statement, err)
+			continue
+		}
+		if rewritten != expected {
+			t.Errorf("expected %q for %q, got %q", expected, statement, rewritten)
+		}
+	}
+
+	if _, err := p.Rewrite("DELETE items, other FROM items JOIN other ON items.id = other.id"); err == nil {
+		t.Error("expected multi-table deletes to be refused")
+	}
+	if _, err := p.Rewrite("DELETE FROM items RETURNING id"); err == nil {
+		t.Error("expected a delete that can't be parsed to be refused")
+	}
+	// no tables, no rewrites
+	if rewritten, _ := New(Config{}).Rewrite("DELETE FROM items"); rewritten != "DELETE FROM items" {
+		t.Errorf("unexpected rewrite %q", rewritten)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	p := New(Config{Tables: []string{"items"}, Column: "removed", Retention: time.Hour})
+	count, purge := p.Purge("items", time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	if count != "SELECT COUNT(*) FROM `items` WHERE `removed` IS NOT NULL AND `removed` < '2024-01-01 11:00:00';" {
+		t.Errorf("unexpected count %q", count)
+	}
+	if purge != "DELETE FROM `items` WHERE `removed` IS NOT NULL AND `removed` < '2024-01-01 11:00:00';" {
+		t.Errorf("unexpected purge %q", purge)
+	}
+	// purges are not rewritten
+	if rewritten, _ := p.Rewrite(purge); rewritten != purge {
+		t.Errorf("expected the purge to be kept, got %q", rewritten)
+	}
+}
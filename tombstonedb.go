@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
+	p2psrv "github.com/nustiueudinastea/doltswarmdemo/p2p/server"
+	"github.com/nustiueudinastea/doltswarmdemo/tombstone"
+)
+
+const tombstoneCleanupInterval = time.Hour
+
+// tombstoneDB wraps an ExternalDB and turns the deletes of the tables with
+// soft deletes into updates setting the tombstones of the rows
+type tombstoneDB struct {
+	p2psrv.ExternalDB
+
+	policy *tombstone.Policy
+}
+
+func newTombstoneDB(db p2psrv.ExternalDB, policy *tombstone.Policy) *tombstoneDB {
+	return &tombstoneDB{
+		ExternalDB: db,
+		policy:     policy,
+	}
+}
+
+func (db *tombstoneDB) ExecAndCommit(query string, commitMsg string) (string, error) {
+	query, err := db.policy.Rewrite(query)
+	if err != nil {
+		return "", err
+	}
+	return db.ExternalDB.ExecAndCommit(query, commitMsg)
+}
+
+// startTombstoneCleanup purges the expired tombstones every cleanup interval.
+// Every run is claimed like a leader-only job, so that a single node commits
+// the purge.
+func startTombstoneCleanup(policy *tombstone.Policy, consistency p2pproto.Consistency) func() error {
+	ticker := time.NewTicker(tombstoneCleanupInterval)
+	stopSignal := make(chan struct{})
+	crashReporter.Go("tombstone-cleanup", func() {
+		for {
+			select {
+			case now := <-ticker.C:
+				slot := now.Truncate(tombstoneCleanupInterval)
+				claimed, err := claimJobRun(context.Background(), "tombstone-cleanup", slot, tombstoneCleanupInterval/2)
+				if err != nil {
+					log.Warnf("Failed to claim the tombstone cleanup: %s", err.Error())
+					continue
+				}
+				if claimed {
+					purgeTombstones(policy, now, consistency)
+				}
+			case <-stopSignal:
+				return
+			}
+		}
+	})
+	return func() error {
+		ticker.Stop()
+		close(stopSignal)
+		return nil
+	}
+}
+
+// purgeTombstones deletes the expired tombstones of every table, in a commit
+// per table that has some
+func purgeTombstones(policy *tombstone.Policy, now time.Time, consistency p2pproto.Consistency) {
+	for _, table := range policy.Tables() {
+		count, purge := policy.Purge(table, now)
+		var expired int64
+		err := dbi.QueryRow(count).Scan(&expired)
+		if err != nil {
+			log.Errorf("Failed to count the expired tombstones of '%s': %s", table, err.Error())
+			continue
+		}
+		if expired == 0 {
+			continue
+		}
+		commit, err := p2pmgr.ExecAndCommit(purge, fmt.Sprintf("Purge %d expired tombstones of %s", expired, table), consistency)
+		if err != nil {
+			log.Errorf("Failed to purge the tombstones of '%s': %s", table, err.Error())
+			continue
+		}
+		log.Infof("Purged %d expired tombstones of '%s' in commit %s", expired, table, commit)
+	}
+}
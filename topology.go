@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+)
+
+const (
+	topologyInterval = 30 * time.Second
+	topologyFile     = "topology.json"
+)
+
+// startTopologyTracker periodically gathers the mesh topology and writes it to
+// the working directory for the topology command
+func startTopologyTracker() func() error {
+	log.Info("Starting topology tracker")
+	ticker := time.NewTicker(topologyInterval)
+	stopSignal := make(chan struct{})
+	crashReporter.Go("topology-tracker", func() {
+		for {
+			select {
+			case <-ticker.C:
+				topology := p2pmgr.Topology(context.Background())
+				data, err := json.Marshal(topology)
+				if err != nil {
+					log.Errorf("Failed to encode topology: %s", err.Error())
+					continue
+				}
+				path := filepath.Join(workDir, topologyFile)
+				err = os.WriteFile(path+".tmp", data, 0600)
+				if err == nil {
+					err = os.Rename(path+".tmp", path)
+				}
+				if err != nil {
+					log.Errorf("Failed to write topology: %s", err.Error())
+				}
+			case <-stopSignal:
+				return
+			}
+		}
+	})
+	return func() error {
+		log.Info("Stopping topology tracker")
+		ticker.Stop()
+		close(stopSignal)
+		return nil
+	}
+}
+
+// printTopology prints the topology reported by the server running in the
+// working directory, as JSON or as a Graphviz graph
+func printTopology(format string) error {
+	data, err := os.ReadFile(filepath.Join(workDir, topologyFile))
+	if err != nil {
+		return fmt.Errorf("failed to read topology. Is the server running? %w", err)
+	}
+	topology := p2p.Topology{}
+	err = json.Unmarshal(data, &topology)
+	if err != nil {
+		return fmt.Errorf("failed to parse topology: %w", err)
+	}
+
+	switch format {
+	case "json":
+		out, err := json.MarshalIndent(topology, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	case "dot":
+		fmt.Print(topology.DOT())
+	default:
+		return fmt.Errorf("unknown format '%s'", format)
+	}
+	return nil
+}
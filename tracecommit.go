@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nustiueudinastea/doltswarmdemo/feed"
+	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	traceRequestInterval = 500 * time.Millisecond
+	traceRequestPrefix   = "trace-request-"
+	traceResultPrefix    = "trace-result-"
+)
+
+// traceRequest asks the running server to trace a commit
+type traceRequest struct {
+	Commit string `json:"commit"`
+}
+
+// startCommitTracing records when new commits are applied locally, and answers
+// the traces requested by the trace-commit command
+func startCommitTracing() func() error {
+	events, cancel := commitFeed.Subscribe(feed.Filter{})
+	ticker := time.NewTicker(traceRequestInterval)
+	stopSignal := make(chan struct{})
+	crashReporter.Go("commit-tracing", func() {
+		for {
+			select {
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				p2pmgr.RecordApplied(ev.Hash, time.Now())
+			case <-ticker.C:
+				processTraceRequests()
+			case <-stopSignal:
+				return
+			}
+		}
+	})
+	return func() error {
+		cancel()
+		ticker.Stop()
+		close(stopSignal)
+		return nil
+	}
+}
+
+func processTraceRequests() {
+	paths, _ := filepath.Glob(filepath.Join(workDir, traceRequestPrefix+"*.json"))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Errorf("Failed to read commit trace request: %s", err.Error())
+			continue
+		}
+		os.Remove(path)
+
+		req := traceRequest{}
+		if err := json.Unmarshal(data, &req); err != nil {
+			log.Errorf("Failed to parse commit trace request: %s", err.Error())
+			continue
+		}
+		// peers are traced concurrently, so this takes at most the trace
+		// timeout of a peer
+		traces := p2pmgr.TraceCommit(context.Background(), req.Commit)
+
+		id := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), traceRequestPrefix), ".json")
+		err = writeJSON(filepath.Join(workDir, traceResultPrefix+id+".json"), traces)
+		if err != nil {
+			log.Errorf("Failed to write commit trace: %s", err.Error())
+		}
+	}
+}
+
+// traceCommit asks the server running in the working directory to trace a
+// commit on all its reachable peers and prints the propagation timeline
+func traceCommit(commit string, timeout time.Duration) error {
+	id := ksuid.New().String()
+	err := writeJSON(filepath.Join(workDir, traceRequestPrefix+id+".json"), traceRequest{Commit: commit})
+	if err != nil {
+		return err
+	}
+
+	resultPath := filepath.Join(workDir, traceResultPrefix+id+".json")
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(200 * time.Millisecond)
+		data, err := os.ReadFile(resultPath)
+		if err != nil {
+			continue
+		}
+		os.Remove(resultPath)
+		traces := []p2p.CommitTrace{}
+		err = json.Unmarshal(data, &traces)
+		if err != nil {
+			return fmt.Errorf("failed to parse commit trace: %w", err)
+		}
+		printCommitTrace(commit, traces)
+		return nil
+	}
+	os.Remove(filepath.Join(workDir, traceRequestPrefix+id+".json"))
+	return fmt.Errorf("no commit trace within %s. Is the server running?", timeout)
+}
+
+// printCommitTrace prints a line per node, in the order the nodes applied the
+// commit, with the delay since the first node applied it
+func printCommitTrace(commit string, traces []p2p.CommitTrace) {
+	fmt.Printf("COMMIT %s\n", commit)
+	var first time.Time
+	for _, trace := range traces {
+		if !trace.AppliedAt.IsZero() {
+			first = trace.AppliedAt
+			break
+		}
+	}
+	for _, trace := range traces {
+		node := trace.Node
+		if trace.Local {
+			node += " (local)"
+		}
+		switch {
+		case trace.Err != "":
+			fmt.Printf("%-60s unreachable: %s\n", node, trace.Err)
+			continue
+		case !trace.HasCommit:
+			fmt.Printf("%-60s missing (head %s)\n", node, trace.Head)
+		case trace.AppliedAt.IsZero():
+			fmt.Printf("%-60s applied, time unknown\n", node)
+		default:
+			fmt.Printf("%-60s applied %s +%s\n", node, trace.AppliedAt.Format(time.RFC3339Nano), trace.AppliedAt.Sub(first))
+		}
+		for _, a := range trace.Announcements {
+			line := fmt.Sprintf("    %s %s %s", a.Time.Format(time.RFC3339Nano), a.Direction, a.Peer)
+			if a.Err != "" {
+				line += ": " + a.Err
+			}
+			fmt.Println(line)
+		}
+	}
+}
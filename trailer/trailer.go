@@ -0,0 +1,57 @@
+// Package trailer reads and writes git style trailers, the "Key: value" lines
+// at the end of a commit message
+package trailer
+
+import (
+	"regexp"
+	"strings"
+)
+
+var trailerLine = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9-]*: `)
+
+// Get returns the value of the last trailer with the given key
+func Get(msg string, key string) (string, bool) {
+	prefix := key + ": "
+	lines := strings.Split(msg, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if strings.HasPrefix(lines[i], prefix) {
+			return strings.TrimPrefix(lines[i], prefix), true
+		}
+	}
+	return "", false
+}
+
+// GetAll returns the values of all the trailers with the given key, in the
+// order they appear in the message
+func GetAll(msg string, key string) []string {
+	prefix := key + ": "
+	values := []string{}
+	for _, line := range strings.Split(msg, "\n") {
+		if strings.HasPrefix(line, prefix) {
+			values = append(values, strings.TrimPrefix(line, prefix))
+		}
+	}
+	return values
+}
+
+// Append adds a trailer to the trailer block at the end of the message,
+// starting a new block if the message doesn't end with one
+func Append(msg string, key string, value string) string {
+	line := key + ": " + value
+	msg = strings.TrimRight(msg, "\n")
+	paragraphs := strings.Split(msg, "\n\n")
+	last := paragraphs[len(paragraphs)-1]
+	if len(paragraphs) > 1 && isTrailerBlock(last) {
+		return msg + "\n" + line
+	}
+	return msg + "\n\n" + line
+}
+
+func isTrailerBlock(paragraph string) bool {
+	for _, line := range strings.Split(paragraph, "\n") {
+		if !trailerLine.MatchString(line) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,124 @@
+package tsdb
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sample is a single metric value recorded at a point in time
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// ring is a fixed size circular buffer of samples
+type ring struct {
+	samples []Sample
+	next    int
+	full    bool
+}
+
+func (r *ring) add(s Sample) {
+	r.samples[r.next] = s
+	r.next = (r.next + 1) % len(r.samples)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// ordered returns the samples from oldest to newest
+func (r *ring) ordered() []Sample {
+	if !r.full {
+		return append([]Sample{}, r.samples[:r.next]...)
+	}
+	return append(append([]Sample{}, r.samples[r.next:]...), r.samples[:r.next]...)
+}
+
+// Store keeps the recent history of a set of metrics in memory. Each metric
+// retains enough samples to cover the retention window at the given interval.
+type Store struct {
+	mtx       sync.RWMutex
+	retention time.Duration
+	capacity  int
+	series    map[string]*ring
+}
+
+// New creates a store that retains samples recorded every interval for the
+// retention duration.
+func New(interval time.Duration, retention time.Duration) *Store {
+	capacity := int(retention / interval)
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Store{
+		retention: retention,
+		capacity:  capacity,
+		series:    map[string]*ring{},
+	}
+}
+
+// Record adds a sample for the metric
+func (s *Store) Record(name string, value float64) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	r, found := s.series[name]
+	if !found {
+		r = &ring{samples: make([]Sample, s.capacity)}
+		s.series[name] = r
+	}
+	r.add(Sample{Time: time.Now(), Value: value})
+}
+
+// Query returns the samples of the metric recorded after since, oldest first
+func (s *Store) Query(name string, since time.Time) []Sample {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	r, found := s.series[name]
+	if !found {
+		return []Sample{}
+	}
+
+	cutoff := time.Now().Add(-s.retention)
+	if since.Before(cutoff) {
+		since = cutoff
+	}
+	samples := []Sample{}
+	for _, sample := range r.ordered() {
+		if sample.Time.After(since) {
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
+
+// Last returns the most recent n samples of the metric, oldest first
+func (s *Store) Last(name string, n int) []Sample {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	r, found := s.series[name]
+	if !found {
+		return []Sample{}
+	}
+	samples := r.ordered()
+	if len(samples) > n {
+		samples = samples[len(samples)-n:]
+	}
+	return samples
+}
+
+// Names returns the names of all the recorded metrics
+func (s *Store) Names() []string {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+
+	names := make([]string, 0, len(s.series))
+	for name := range s.series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
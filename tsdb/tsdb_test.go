@@ -0,0 +1,32 @@
+package tsdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStoreRetention(t *testing.T) {
+	store := New(time.Second, 3*time.Second)
+	for i := 1; i <= 5; i++ {
+		store.Record("peers", float64(i))
+	}
+
+	samples := store.Query("peers", time.Time{})
+	if len(samples) != 3 {
+		t.Fatalf("expected 3 samples, got %d", len(samples))
+	}
+	for i, sample := range samples {
+		if sample.Value != float64(i+3) {
+			t.Errorf("sample %d: expected %d, got %f", i, i+3, sample.Value)
+		}
+	}
+
+	last := store.Last("peers", 2)
+	if len(last) != 2 || last[0].Value != 4 || last[1].Value != 5 {
+		t.Errorf("unexpected last samples: %v", last)
+	}
+
+	if len(store.Query("unknown", time.Time{})) != 0 {
+		t.Error("expected no samples for unknown metric")
+	}
+}
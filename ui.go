@@ -4,10 +4,39 @@ import (
 	"github.com/gdamore/tcell/v2"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/nustiueudinastea/doltswarm"
+	"github.com/nustiueudinastea/doltswarmdemo/tsdb"
 	"github.com/rivo/tview"
 )
 
-func uiUpdate(app *tview.Application, peerListView *tview.List, commitTreeRoot *tview.TreeNode, textView *tview.TextView, peerListChan chan peer.IDSlice, commitListChan chan []doltswarm.Commit, eventChan chan []byte) func() error {
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders the samples as a small bar chart
+func sparkline(samples []tsdb.Sample) string {
+	if len(samples) == 0 {
+		return ""
+	}
+	min, max := samples[0].Value, samples[0].Value
+	for _, sample := range samples {
+		if sample.Value < min {
+			min = sample.Value
+		}
+		if sample.Value > max {
+			max = sample.Value
+		}
+	}
+
+	line := make([]rune, len(samples))
+	for i, sample := range samples {
+		idx := 0
+		if max > min {
+			idx = int((sample.Value - min) / (max - min) * float64(len(sparks)-1))
+		}
+		line[i] = sparks[idx]
+	}
+	return string(line)
+}
+
+func uiUpdate(app *tview.Application, peerListView *tview.List, commitTreeRoot *tview.TreeNode, textView *tview.TextView, metricsView *tview.TextView, peerListChan chan peer.IDSlice, commitListChan chan []doltswarm.Commit, eventChan chan []byte, metricsChan chan string) func() error {
 	stopSignal := make(chan struct{})
 	go func() {
 		log.Info("Starting UI updater")
@@ -25,6 +54,9 @@ func uiUpdate(app *tview.Application, peerListView *tview.List, commitTreeRoot *
 					panic(err)
 				}
 				app.Draw()
+			case metrics := <-metricsChan:
+				metricsView.SetText(metrics)
+				app.Draw()
 			case commitList := <-commitListChan:
 				commitTreeRoot.ClearChildren()
 				for _, commit := range commitList {
@@ -45,7 +77,7 @@ func uiUpdate(app *tview.Application, peerListView *tview.List, commitTreeRoot *
 	return stopper
 }
 
-func createUI(peerListChan chan peer.IDSlice, commitListChan chan []doltswarm.Commit, eventChan chan []byte) *tview.Application {
+func createUI(peerListChan chan peer.IDSlice, commitListChan chan []doltswarm.Commit, eventChan chan []byte, metricsChan chan string) *tview.Application {
 	var app = tview.NewApplication()
 	var flex = tview.NewFlex()
 
@@ -61,13 +93,17 @@ func createUI(peerListChan chan peer.IDSlice, commitListChan chan []doltswarm.Co
 	peerList := tview.NewList()
 	peerList.SetBorder(true).SetTitle("Peers")
 
+	metricsView := tview.NewTextView()
+	metricsView.SetBorder(true).SetTitle("Metrics")
+
 	flexRow.AddItem(peerList, 0, 1, false).
+		AddItem(metricsView, 0, 1, false).
 		AddItem(commitTree, 0, 5, false)
 
 	flex.AddItem(flexRow, 0, 1, false).
 		AddItem(logView, 0, 1, false)
 
-	uiUpdateStopper := uiUpdate(app, peerList, commitTreeRoot, logView, peerListChan, commitListChan, eventChan)
+	uiUpdateStopper := uiUpdate(app, peerList, commitTreeRoot, logView, metricsView, peerListChan, commitListChan, eventChan, metricsChan)
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		if event.Key() == tcell.KeyCtrlC {
 			uiUpdateStopper()
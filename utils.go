@@ -2,7 +2,13 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"strings"
+
+	"github.com/nustiueudinastea/doltswarmdemo/client"
+	"github.com/nustiueudinastea/doltswarmdemo/p2p"
+	p2pproto "github.com/nustiueudinastea/doltswarmdemo/p2p/proto"
 )
 
 func ensureDir(dirName string) error {
@@ -22,3 +28,55 @@ func ensureDir(dirName string) error {
 	}
 	return err
 }
+
+func parseConsistency(level string) (p2pproto.Consistency, error) {
+	consistency, found := p2pproto.Consistency_value["CONSISTENCY_"+strings.ToUpper(level)]
+	if !found {
+		return p2pproto.Consistency_CONSISTENCY_LOCAL, fmt.Errorf("unknown consistency level '%s'", level)
+	}
+	return p2pproto.Consistency(consistency), nil
+}
+
+func parseDiscovery(kinds []string, staticPeers []string, k8sCfg p2p.KubernetesConfig) ([]p2p.Discovery, error) {
+	discoveries := []p2p.Discovery{}
+	for _, kind := range kinds {
+		switch kind {
+		case "mdns":
+			discoveries = append(discoveries, &p2p.MDNSDiscovery{})
+		case "static":
+			static, err := p2p.NewStaticDiscovery(staticPeers)
+			if err != nil {
+				return nil, err
+			}
+			discoveries = append(discoveries, static)
+		case "kubernetes":
+			k8s, err := p2p.NewKubernetesDiscovery(k8sCfg, log)
+			if err != nil {
+				return nil, err
+			}
+			discoveries = append(discoveries, k8s)
+		default:
+			return nil, fmt.Errorf("unknown discovery '%s'", kind)
+		}
+	}
+	return discoveries, nil
+}
+
+// adminClient connects to the admin API of the node at addr with the admin
+// identity
+func adminClient(addr string) (p2pproto.AdminClient, func() error, error) {
+	identity, err := adminIdentity()
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := client.New(identity)
+	if err != nil {
+		return nil, nil, err
+	}
+	peer, err := c.Connect(addr)
+	if err != nil {
+		c.Close()
+		return nil, nil, err
+	}
+	return p2pproto.NewAdminClient(peer.Conn()), c.Close, nil
+}
@@ -0,0 +1,80 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+var validIdentifier = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// ColumnRule constrains the values written to a column
+type ColumnRule struct {
+	// Regex has to match the string representation of every written value
+	Regex    string `json:"regex,omitempty"`
+	NotEmpty bool   `json:"not_empty,omitempty"`
+
+	regex *regexp.Regexp
+}
+
+// Reference requires the value of a column to exist in another table
+type Reference struct {
+	Column           string `json:"column"`
+	Table            string `json:"table"`
+	ReferencedColumn string `json:"referenced_column"`
+}
+
+// TableRules are the rules applied to the rows changed in a table
+type TableRules struct {
+	Columns    map[string]*ColumnRule `json:"columns,omitempty"`
+	References []Reference            `json:"references,omitempty"`
+	// MaxRowDelta is the maximum number of rows a single commit can add,
+	// modify or delete. Zero means unlimited.
+	MaxRowDelta int `json:"max_row_delta,omitempty"`
+}
+
+// Rules holds the validation rules of every table
+type Rules struct {
+	Tables map[string]*TableRules `json:"tables"`
+}
+
+// LoadRules reads and compiles the rules stored in a JSON file
+func LoadRules(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read validation rules: %w", err)
+	}
+	rules := &Rules{}
+	err = json.Unmarshal(data, rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse validation rules '%s': %w", path, err)
+	}
+	return rules, rules.compile()
+}
+
+func (r *Rules) compile() error {
+	for table, tableRules := range r.Tables {
+		if !validIdentifier.MatchString(table) {
+			return fmt.Errorf("invalid table name '%s'", table)
+		}
+		for column, rule := range tableRules.Columns {
+			if rule.Regex == "" {
+				continue
+			}
+			regex, err := regexp.Compile(rule.Regex)
+			if err != nil {
+				return fmt.Errorf("invalid regex for '%s.%s': %w", table, column, err)
+			}
+			rule.regex = regex
+		}
+		for _, ref := range tableRules.References {
+			for _, identifier := range []string{ref.Column, ref.Table, ref.ReferencedColumn} {
+				if !validIdentifier.MatchString(identifier) {
+					return fmt.Errorf("invalid reference '%s' in table '%s'", identifier, table)
+				}
+			}
+		}
+	}
+	return nil
+}
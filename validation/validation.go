@@ -0,0 +1,218 @@
+package validation
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Querier is implemented by *sql.DB and *sql.Tx
+type Querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// Violation describes a change that breaks a rule
+type Violation struct {
+	Table  string
+	Column string
+	Rule   string
+	Detail string
+}
+
+func (v Violation) String() string {
+	if v.Column != "" {
+		return fmt.Sprintf("%s.%s: %s: %s", v.Table, v.Column, v.Rule, v.Detail)
+	}
+	return fmt.Sprintf("%s: %s: %s", v.Table, v.Rule, v.Detail)
+}
+
+// Error is returned when a change violates one or more rules
+type Error struct {
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	details := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		details[i] = v.String()
+	}
+	return "validation failed: " + strings.Join(details, "; ")
+}
+
+// GRPCStatus makes validation errors reach remote callers as FailedPrecondition
+func (e *Error) GRPCStatus() *status.Status {
+	return status.New(codes.FailedPrecondition, e.Error())
+}
+
+// change is a row of dolt_diff
+type change struct {
+	diffType string
+	to       map[string]any
+}
+
+// Validator checks the uncommitted changes of a transaction against the rules
+type Validator struct {
+	rules *Rules
+}
+
+// New creates a validator for the rules
+func New(rules *Rules) *Validator {
+	return &Validator{rules: rules}
+}
+
+// Check validates the changes in the working set of the transaction
+func (v *Validator) Check(tx Querier) error {
+	tables := make([]string, 0, len(v.rules.Tables))
+	for table := range v.rules.Tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	violations := []Violation{}
+	for _, table := range tables {
+		changes, err := workingChanges(tx, table)
+		if err != nil {
+			return err
+		}
+		tableViolations, err := v.checkTable(tx, table, changes)
+		if err != nil {
+			return err
+		}
+		violations = append(violations, tableViolations...)
+	}
+
+	if len(violations) > 0 {
+		return &Error{Violations: violations}
+	}
+	return nil
+}
+
+func (v *Validator) checkTable(tx Querier, table string, changes []change) ([]Violation, error) {
+	rules := v.rules.Tables[table]
+	violations := []Violation{}
+
+	if rules.MaxRowDelta > 0 && len(changes) > rules.MaxRowDelta {
+		violations = append(violations, Violation{
+			Table:  table,
+			Rule:   "max_row_delta",
+			Detail: fmt.Sprintf("%d rows changed, at most %d allowed", len(changes), rules.MaxRowDelta),
+		})
+	}
+
+	for _, c := range changes {
+		if c.diffType == "removed" {
+			continue
+		}
+		violations = append(violations, checkRow(table, rules, c.to)...)
+		for _, ref := range rules.References {
+			value := c.to[ref.Column]
+			if value == nil {
+				continue
+			}
+			found, err := exists(tx, ref, value)
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				violations = append(violations, Violation{
+					Table:  table,
+					Column: ref.Column,
+					Rule:   "reference",
+					Detail: fmt.Sprintf("'%s' not found in %s.%s", toString(value), ref.Table, ref.ReferencedColumn),
+				})
+			}
+		}
+	}
+	return violations, nil
+}
+
+// checkRow applies the column rules to an added or modified row
+func checkRow(table string, rules *TableRules, row map[string]any) []Violation {
+	columns := make([]string, 0, len(rules.Columns))
+	for column := range rules.Columns {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	violations := []Violation{}
+	for _, column := range columns {
+		rule := rules.Columns[column]
+		value := toString(row[column])
+		if rule.NotEmpty && value == "" {
+			violations = append(violations, Violation{Table: table, Column: column, Rule: "not_empty", Detail: "value is empty"})
+			continue
+		}
+		if rule.regex != nil && row[column] != nil && !rule.regex.MatchString(value) {
+			violations = append(violations, Violation{
+				Table:  table,
+				Column: column,
+				Rule:   "regex",
+				Detail: fmt.Sprintf("'%s' doesn't match %s", value, rule.Regex),
+			})
+		}
+	}
+	return violations
+}
+
+// workingChanges returns the uncommitted changes of a table
+func workingChanges(tx Querier, table string) ([]change, error) {
+	rows, err := tx.Query(fmt.Sprintf("SELECT * FROM dolt_diff('HEAD', 'WORKING', '%s')", table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff table '%s': %w", table, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []change{}
+	for rows.Next() {
+		values := make([]any, len(columns))
+		ptrs := make([]any, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		err = rows.Scan(ptrs...)
+		if err != nil {
+			return nil, err
+		}
+
+		c := change{to: map[string]any{}}
+		for i, column := range columns {
+			switch {
+			case column == "diff_type":
+				c.diffType = toString(values[i])
+			case strings.HasPrefix(column, "to_"):
+				c.to[strings.TrimPrefix(column, "to_")] = values[i]
+			}
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+func exists(tx Querier, ref Reference, value any) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf("SELECT 1 FROM `%s` WHERE `%s` = ? LIMIT 1", ref.Table, ref.ReferencedColumn), value)
+	if err != nil {
+		return false, fmt.Errorf("failed to check reference to '%s.%s': %w", ref.Table, ref.ReferencedColumn, err)
+	}
+	defer rows.Close()
+	return rows.Next(), rows.Err()
+}
+
+func toString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
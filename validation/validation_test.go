@@ -0,0 +1,46 @@
+package validation
+
+import (
+	"testing"
+)
+
+func TestCheckRow(t *testing.T) {
+	rules := &Rules{Tables: map[string]*TableRules{
+		"testtable": {
+			Columns: map[string]*ColumnRule{
+				"id":   {NotEmpty: true},
+				"name": {Regex: "^[a-z]+$"},
+			},
+		},
+	}}
+	if err := rules.compile(); err != nil {
+		t.Fatal(err)
+	}
+	tableRules := rules.Tables["testtable"]
+
+	violations := checkRow("testtable", tableRules, map[string]any{"id": []byte("1"), "name": "abc"})
+	if len(violations) != 0 {
+		t.Errorf("expected no violations, got %v", violations)
+	}
+
+	violations = checkRow("testtable", tableRules, map[string]any{"id": "", "name": "ABC"})
+	if len(violations) != 2 {
+		t.Fatalf("expected 2 violations, got %v", violations)
+	}
+	if violations[0].Rule != "not_empty" || violations[1].Rule != "regex" {
+		t.Errorf("unexpected violations %v", violations)
+	}
+}
+
+func TestCompileRejectsInvalidRules(t *testing.T) {
+	invalid := []*Rules{
+		{Tables: map[string]*TableRules{"t; DROP": {}}},
+		{Tables: map[string]*TableRules{"t": {Columns: map[string]*ColumnRule{"c": {Regex: "("}}}}},
+		{Tables: map[string]*TableRules{"t": {References: []Reference{{Column: "c", Table: "x`", ReferencedColumn: "id"}}}}},
+	}
+	for i, rules := range invalid {
+		if err := rules.compile(); err == nil {
+			t.Errorf("expected rules %d to be rejected", i)
+		}
+	}
+}
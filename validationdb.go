@@ -0,0 +1,48 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+
+	p2psrv "github.com/nustiueudinastea/doltswarmdemo/p2p/server"
+	"github.com/nustiueudinastea/doltswarmdemo/validation"
+)
+
+type txBeginner interface {
+	Begin() (*sql.Tx, error)
+}
+
+// validationDB wraps an ExternalDB and rejects writes that violate the
+// validation rules. Every statement is first executed in a transaction that is
+// rolled back, and its changes are checked before the real commit.
+type validationDB struct {
+	p2psrv.ExternalDB
+
+	beginner  txBeginner
+	validator *validation.Validator
+}
+
+func newValidationDB(db p2psrv.ExternalDB, beginner txBeginner, rules *validation.Rules) *validationDB {
+	return &validationDB{
+		ExternalDB: db,
+		beginner:   beginner,
+		validator:  validation.New(rules),
+	}
+}
+
+func (db *validationDB) ExecAndCommit(query string, commitMsg string) (string, error) {
+	tx, err := db.beginner.Begin()
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(query)
+	if err == nil {
+		err = db.validator.Check(tx)
+	}
+	err = errors.Join(err, tx.Rollback())
+	if err != nil {
+		return "", err
+	}
+
+	return db.ExternalDB.ExecAndCommit(query, commitMsg)
+}
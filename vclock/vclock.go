@@ -0,0 +1,115 @@
+package vclock
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// trailerPrefix marks the line of a commit message that holds the vector clock
+const trailerPrefix = "VClock: "
+
+// Ordering describes the causal relationship between two vector clocks
+type Ordering int
+
+const (
+	Equal Ordering = iota
+	Before
+	After
+	Concurrent
+)
+
+func (o Ordering) String() string {
+	switch o {
+	case Equal:
+		return "equal"
+	case Before:
+		return "before"
+	case After:
+		return "after"
+	default:
+		return "concurrent"
+	}
+}
+
+// VClock maps peer IDs to the number of commits made by that peer
+type VClock map[string]uint64
+
+// Copy returns an independent copy of the clock
+func (vc VClock) Copy() VClock {
+	cp := make(VClock, len(vc))
+	for id, counter := range vc {
+		cp[id] = counter
+	}
+	return cp
+}
+
+// Increment advances the counter of the given peer
+func (vc VClock) Increment(id string) {
+	vc[id]++
+}
+
+// Merge sets each counter to the maximum of both clocks
+func (vc VClock) Merge(other VClock) {
+	for id, counter := range other {
+		if counter > vc[id] {
+			vc[id] = counter
+		}
+	}
+}
+
+// Compare returns the causal ordering of vc relative to other
+func (vc VClock) Compare(other VClock) Ordering {
+	less, greater := false, false
+	for id, counter := range vc {
+		if counter < other[id] {
+			less = true
+		} else if counter > other[id] {
+			greater = true
+		}
+	}
+	for id, counter := range other {
+		if _, found := vc[id]; !found && counter > 0 {
+			less = true
+		}
+	}
+
+	switch {
+	case less && greater:
+		return Concurrent
+	case less:
+		return Before
+	case greater:
+		return After
+	default:
+		return Equal
+	}
+}
+
+// Annotate appends the clock to a commit message as a trailer line
+func Annotate(msg string, vc VClock) (string, error) {
+	encoded, err := json.Marshal(vc)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode vector clock: %w", err)
+	}
+	return msg + "\n\n" + trailerPrefix + string(encoded), nil
+}
+
+// FromMessage extracts the clock from a commit message. It returns false if the
+// message has no clock attached.
+func FromMessage(msg string) (VClock, bool) {
+	idx := strings.LastIndex(msg, trailerPrefix)
+	if idx < 0 {
+		return nil, false
+	}
+	line := msg[idx+len(trailerPrefix):]
+	if end := strings.IndexByte(line, '\n'); end >= 0 {
+		line = line[:end]
+	}
+
+	vc := VClock{}
+	if err := json.Unmarshal([]byte(line), &vc); err != nil {
+		return nil, false
+	}
+	return vc, true
+}
@@ -0,0 +1,43 @@
+package vclock
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b     VClock
+		expected Ordering
+	}{
+		{VClock{}, VClock{}, Equal},
+		{VClock{"a": 1}, VClock{"a": 1}, Equal},
+		{VClock{"a": 1}, VClock{"a": 2}, Before},
+		{VClock{"a": 1}, VClock{"a": 1, "b": 1}, Before},
+		{VClock{"a": 2, "b": 1}, VClock{"a": 1}, After},
+		{VClock{"a": 2}, VClock{"a": 1, "b": 1}, Concurrent},
+	}
+
+	for _, test := range tests {
+		if ordering := test.a.Compare(test.b); ordering != test.expected {
+			t.Errorf("%v vs %v: expected %s, got %s", test.a, test.b, test.expected, ordering)
+		}
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	vc := VClock{"peer1": 3, "peer2": 1}
+	msg, err := Annotate("Periodic commit", vc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, found := FromMessage(msg)
+	if !found {
+		t.Fatalf("no clock found in message '%s'", msg)
+	}
+	if parsed.Compare(vc) != Equal {
+		t.Errorf("expected %v, got %v", vc, parsed)
+	}
+
+	if _, found := FromMessage("Periodic commit"); found {
+		t.Error("found clock in message without trailer")
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sync"
+
+	p2psrv "github.com/nustiueudinastea/doltswarmdemo/p2p/server"
+	"github.com/nustiueudinastea/doltswarmdemo/vclock"
+)
+
+// vclockDB wraps an ExternalDB and attaches the vector clock of the local node
+// to every commit it creates.
+type vclockDB struct {
+	p2psrv.ExternalDB
+
+	mtx    sync.Mutex
+	nodeID string
+	clock  vclock.VClock
+}
+
+func newVClockDB(db p2psrv.ExternalDB, nodeID string) *vclockDB {
+	return &vclockDB{
+		ExternalDB: db,
+		nodeID:     nodeID,
+		clock:      vclock.VClock{},
+	}
+}
+
+// ExecAndCommit merges the clocks of all known commits into the local clock,
+// advances it and attaches it to the new commit.
+func (db *vclockDB) ExecAndCommit(query string, commitMsg string) (string, error) {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+
+	commits, err := db.GetAllCommits()
+	if err != nil {
+		return "", err
+	}
+
+	clock := db.clock.Copy()
+	for _, commit := range commits {
+		if vc, found := vclock.FromMessage(commit.Message); found {
+			clock.Merge(vc)
+		}
+	}
+	clock.Increment(db.nodeID)
+
+	msg, err := vclock.Annotate(commitMsg, clock)
+	if err != nil {
+		return "", err
+	}
+
+	hash, err := db.ExternalDB.ExecAndCommit(query, msg)
+	if err != nil {
+		return "", err
+	}
+	db.clock = clock
+	return hash, nil
+}